@@ -0,0 +1,159 @@
+package cli
+
+import (
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+)
+
+// maxAliasDepth limits how often aliases referencing other aliases are expanded
+const maxAliasDepth = 10
+
+// ExpandAliases replaces the command name within args with its definition, if it refers to an
+// alias defined in the "aliases" section of the configuration. Like git, built-in commands can't be
+// overridden and any arguments following the alias are appended to its definition.
+func ExpandAliases(root *cobra.Command, args []string) ([]string, error) {
+	if err := initConfig(configFlag(args)); err != nil {
+		return nil, err
+	}
+
+	aliases := viper.GetStringMapString("aliases")
+	if len(aliases) == 0 {
+		return args, nil
+	}
+
+	for depth := 0; ; depth++ {
+		index := commandIndex(args)
+		if index < 0 {
+			return args, nil
+		}
+
+		name := args[index]
+		if cmd, _, err := root.Find([]string{name}); err == nil && cmd != root {
+			return args, nil
+		}
+
+		// Configuration keys are case-insensitive
+		definition, ok := aliases[strings.ToLower(name)]
+		if !ok {
+			return args, nil
+		}
+		if depth >= maxAliasDepth {
+			return nil, fmt.Errorf("alias '%s' exceeds the maximum expansion depth of %d (recursive alias?)", name, maxAliasDepth)
+		}
+
+		expanded, err := splitArgs(definition)
+		if err != nil {
+			return nil, fmt.Errorf("invalid alias '%s': %w", name, err)
+		}
+		if len(expanded) == 0 {
+			return nil, fmt.Errorf("alias '%s' is empty", name)
+		}
+
+		args = append(append(append([]string{}, args[:index]...), expanded...), args[index+1:]...)
+	}
+}
+
+// configFlag returns the value of the --config flag, which is needed before the flags are parsed
+func configFlag(args []string) string {
+	for i, arg := range args {
+		if arg == "--" {
+			break
+		}
+		if value, ok := strings.CutPrefix(arg, "--config="); ok {
+			return value
+		}
+		if arg == "--config" && i+1 < len(args) {
+			return args[i+1]
+		}
+	}
+	return ""
+}
+
+// commandIndex returns the index of the first argument that isn't a persistent root flag
+func commandIndex(args []string) int {
+	for i := 0; i < len(args); i++ {
+		arg := args[i]
+		switch {
+		case arg == "--":
+			return -1
+		case arg == "--config" || arg == "--log-level" || arg == "--locale":
+			// Skip the flag value
+			i++
+		case strings.HasPrefix(arg, "-"):
+		default:
+			return i
+		}
+	}
+	return -1
+}
+
+// splitArgs splits the alias definition into arguments, supporting single and double quotes
+func splitArgs(s string) ([]string, error) {
+	var args []string
+	var current strings.Builder
+	var quote rune
+	inArg := false
+
+	for _, r := range s {
+		switch {
+		case quote != 0:
+			if r == quote {
+				quote = 0
+			} else {
+				current.WriteRune(r)
+			}
+		case r == '"' || r == '\'':
+			quote = r
+			inArg = true
+		case r == ' ' || r == '\t':
+			if inArg {
+				args = append(args, current.String())
+				current.Reset()
+				inArg = false
+			}
+		default:
+			current.WriteRune(r)
+			inArg = true
+		}
+	}
+
+	if quote != 0 {
+		return nil, fmt.Errorf("unterminated quote in '%s'", s)
+	}
+	if inArg {
+		args = append(args, current.String())
+	}
+	return args, nil
+}
+
+func NewAliasesCommand() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "aliases",
+		Short: "List command aliases",
+		Long:  "Lists all command aliases defined in the \"aliases\" section of the configuration, e.g. \"photos: vfs ls minio-home/photos -l\".",
+		Args:  cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			aliases := viper.GetStringMapString("aliases")
+
+			names := make([]string, 0, len(aliases))
+			for name := range aliases {
+				names = append(names, name)
+			}
+			sort.Strings(names)
+
+			w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+			for _, name := range names {
+				fmt.Fprintf(w, "%s\t= %s\n", name, aliases[name])
+			}
+			return w.Flush()
+		},
+	}
+
+	return cmd
+}
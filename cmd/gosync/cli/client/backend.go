@@ -0,0 +1,683 @@
+package client
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/signal"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/mwantia/gosync/internal/i18n"
+	"github.com/mwantia/gosync/pkg/db/models"
+	"github.com/mwantia/gosync/pkg/filter"
+	"github.com/mwantia/gosync/pkg/storage"
+	"github.com/mwantia/gosync/pkg/vfs"
+	"github.com/spf13/cobra"
+	"golang.org/x/term"
+)
+
+// backendTestTimeout limits each step of a backend test, so unreachable endpoints fail fast
+const backendTestTimeout = 30 * time.Second
+
+// errListed stops listing after the first object during backend tests
+var errListed = errors.New("listed")
+
+func NewBackendCommand() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "backend",
+		Short: "Manage storage backends",
+		Long:  "Register, test, update and remove the storage backends referenced by virtual paths like <backend>/<path>.",
+	}
+
+	cmd.AddCommand(NewBackendAddCommand())
+	cmd.AddCommand(NewBackendListCommand())
+	cmd.AddCommand(NewBackendTestCommand())
+	cmd.AddCommand(NewBackendUpdateCommand())
+	cmd.AddCommand(NewBackendRemoveCommand())
+	cmd.AddCommand(NewBackendListingCommand())
+
+	return cmd
+}
+
+// backendFlags are the settings of a backend shared by add and update
+type backendFlags struct {
+	name           string
+	typ            string
+	endpoint       string
+	region         string
+	bucket         string
+	insecure       bool
+	accessKey      string
+	secretKey      string
+	dnsServer      string
+	ipPreference   string
+	happyEyeballs  bool
+	staticHosts    string
+	trash          bool
+	trashPrefix    string
+	trashRetention time.Duration
+	quotaSoft      string
+	quotaHard      string
+}
+
+func (f *backendFlags) bind(cmd *cobra.Command) {
+	cmd.Flags().StringVar(&f.name, "name", "", "Display name of the backend (defaults to the id)")
+	cmd.Flags().StringVar(&f.typ, "type", storage.TypeS3, "Type of the backend (s3, azure, gcs, local)")
+	cmd.Flags().StringVar(&f.endpoint, "endpoint", "", "Endpoint of the service, or the directory of local backends")
+	cmd.Flags().StringVar(&f.region, "region", "", "Region of the bucket")
+	cmd.Flags().StringVar(&f.bucket, "bucket", "", "Bucket (s3, gcs) or container (azure)")
+	cmd.Flags().BoolVar(&f.insecure, "insecure", false, "Connect to the endpoint without TLS")
+	cmd.Flags().StringVar(&f.accessKey, "access-key", "", "Access key (s3) or storage account name (azure), may reference a secret")
+	cmd.Flags().StringVar(&f.secretKey, "secret-key", "", "Secret key (s3), account key (azure) or service account JSON (gcs), may reference a secret")
+	cmd.Flags().StringVar(&f.dnsServer, "dns-server", "", "Custom DNS resolver used for the endpoint, e.g. 192.168.1.1:53")
+	cmd.Flags().StringVar(&f.ipPreference, "ip-preference", "", "Preferred address family (ipv4, ipv6, ipv4-only, ipv6-only)")
+	cmd.Flags().BoolVar(&f.happyEyeballs, "happy-eyeballs", false, "Dial both address families in parallel")
+	cmd.Flags().StringVar(&f.staticHosts, "static-hosts", "", "Comma separated host=ip pins bypassing DNS")
+	cmd.Flags().BoolVar(&f.trash, "trash", false, "Move deleted objects into the trash instead of deleting them")
+	cmd.Flags().StringVar(&f.trashPrefix, "trash-prefix", ".gosync-trash/", "Prefix of trashed objects")
+	cmd.Flags().DurationVar(&f.trashRetention, "trash-retention", 30*24*time.Hour, "Duration trashed objects are kept (0 = forever)")
+	cmd.Flags().StringVar(&f.quotaSoft, "quota-soft", "0", "Usage raising a notification once reached, e.g. 900GB (0 = unlimited)")
+	cmd.Flags().StringVar(&f.quotaHard, "quota-hard", "0", "Usage beyond which uploads are held back, e.g. 1TB (0 = unlimited)")
+}
+
+// apply sets all explicitly provided flags on the backend
+func (f *backendFlags) apply(cmd *cobra.Command, b *models.Backend) error {
+	changed := cmd.Flags().Changed
+	if changed("name") {
+		b.Name = f.name
+	}
+	if changed("type") {
+		b.Type = f.typ
+	}
+	if changed("endpoint") {
+		b.Endpoint = f.endpoint
+	}
+	if changed("region") {
+		b.Region = f.region
+	}
+	if changed("bucket") {
+		b.Bucket = f.bucket
+	}
+	if changed("insecure") {
+		b.UseSSL = !f.insecure
+	}
+	if changed("access-key") {
+		b.AccessKey = f.accessKey
+	}
+	if changed("secret-key") {
+		b.SecretKey = f.secretKey
+	}
+	if changed("dns-server") {
+		b.DNSServer = f.dnsServer
+	}
+	if changed("ip-preference") {
+		b.IPPreference = f.ipPreference
+	}
+	if changed("happy-eyeballs") {
+		b.HappyEyeballs = f.happyEyeballs
+	}
+	if changed("static-hosts") {
+		b.StaticHosts = f.staticHosts
+	}
+	if changed("trash") {
+		b.TrashEnabled = f.trash
+	}
+	if changed("trash-prefix") {
+		b.TrashPrefix = f.trashPrefix
+	}
+	if changed("trash-retention") {
+		b.TrashRetention = int64(f.trashRetention / time.Second)
+	}
+	if changed("quota-soft") {
+		quota, err := filter.ParseSize(f.quotaSoft)
+		if err != nil {
+			return i18n.Errorf("backend.invalid_quota", "--quota-soft", err)
+		}
+		b.QuotaSoft = quota
+	}
+	if changed("quota-hard") {
+		quota, err := filter.ParseSize(f.quotaHard)
+		if err != nil {
+			return i18n.Errorf("backend.invalid_quota", "--quota-hard", err)
+		}
+		b.QuotaHard = quota
+	}
+	return nil
+}
+
+func NewBackendAddCommand() *cobra.Command {
+	var flags backendFlags
+	var noPrompt bool
+
+	cmd := &cobra.Command{
+		Use:   "add <id>",
+		Short: "Register a backend",
+		Long: `Registers a storage backend, which is referenced by virtual paths like <id>/<path>.
+
+Settings missing from the flags are prompted for if the command runs in a terminal.
+Credentials may reference secrets like ${env:AWS_SECRET_ACCESS_KEY}, which are resolved once the backend is used.`,
+		Args: cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			b := &models.Backend{
+				ID:             args[0],
+				Name:           args[0],
+				Type:           flags.typ,
+				UseSSL:         true,
+				TrashPrefix:    flags.trashPrefix,
+				TrashRetention: int64(flags.trashRetention / time.Second),
+			}
+			if err := flags.apply(cmd, b); err != nil {
+				return err
+			}
+
+			if !noPrompt && term.IsTerminal(int(os.Stdin.Fd())) {
+				if err := promptBackend(cmd, b); err != nil {
+					return err
+				}
+			}
+			if err := validateBackend(b); err != nil {
+				return err
+			}
+
+			ctx := context.Background()
+
+			ms, err := openMetadataStore(ctx)
+			if err != nil {
+				return err
+			}
+			defer ms.Close()
+
+			if _, err := ms.GetBackend(ctx, b.ID); err == nil {
+				return i18n.Errorf("backend.exists", b.ID)
+			}
+			// Disabled SSL is replaced by the column default on create, so it's written by an update afterwards
+			useSSL := b.UseSSL
+			if err := ms.CreateBackend(ctx, b); err != nil {
+				return i18n.Errorf("backend.create_failed", b.ID, err)
+			}
+			if !useSSL {
+				b.UseSSL = useSSL
+				if err := ms.UpdateBackend(ctx, b); err != nil {
+					return i18n.Errorf("backend.create_failed", b.ID, err)
+				}
+			}
+
+			fmt.Println(i18n.T("backend.created", b.ID, b.Type, backendLocation(b), b.ID))
+			return nil
+		},
+	}
+
+	flags.bind(cmd)
+	cmd.Flags().BoolVar(&noPrompt, "no-prompt", false, "Never prompt for missing settings")
+
+	return cmd
+}
+
+// promptBackend asks for all required settings that weren't provided as flags
+func promptBackend(cmd *cobra.Command, b *models.Backend) error {
+	reader := bufio.NewReader(os.Stdin)
+	changed := cmd.Flags().Changed
+
+	var err error
+	if !changed("type") {
+		if b.Type, err = promptValue(reader, i18n.T("backend.prompt_type"), b.Type); err != nil {
+			return err
+		}
+	}
+	if !changed("endpoint") && b.Type != storage.TypeGCS {
+		label := i18n.T("backend.prompt_endpoint")
+		if b.Type == storage.TypeLocal {
+			label = i18n.T("backend.prompt_directory")
+		}
+		if b.Endpoint, err = promptValue(reader, label, b.Endpoint); err != nil {
+			return err
+		}
+	}
+	if b.Type == storage.TypeLocal {
+		return nil
+	}
+
+	if !changed("bucket") {
+		if b.Bucket, err = promptValue(reader, i18n.T("backend.prompt_bucket"), b.Bucket); err != nil {
+			return err
+		}
+	}
+	if !changed("region") && b.Type == storage.TypeS3 {
+		if b.Region, err = promptValue(reader, i18n.T("backend.prompt_region"), b.Region); err != nil {
+			return err
+		}
+	}
+	if !changed("access-key") && b.Type != storage.TypeGCS {
+		if b.AccessKey, err = promptValue(reader, i18n.T("backend.prompt_access_key"), b.AccessKey); err != nil {
+			return err
+		}
+	}
+	if !changed("secret-key") {
+		if b.SecretKey, err = promptSecret(i18n.T("backend.prompt_secret_key")); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// promptValue reads a single line, returning def if the answer is empty
+func promptValue(reader *bufio.Reader, label, def string) (string, error) {
+	if def != "" {
+		fmt.Printf("%s [%s]: ", label, def)
+	} else {
+		fmt.Printf("%s: ", label)
+	}
+
+	answer, err := reader.ReadString('\n')
+	if err != nil && answer == "" {
+		return "", i18n.Errorf("backend.prompt_failed", err)
+	}
+	if answer = strings.TrimSpace(answer); answer != "" {
+		return answer, nil
+	}
+	return def, nil
+}
+
+// promptSecret reads a single line without echoing it
+func promptSecret(label string) (string, error) {
+	fmt.Printf("%s: ", label)
+	secret, err := term.ReadPassword(int(os.Stdin.Fd()))
+	fmt.Println()
+	if err != nil {
+		return "", i18n.Errorf("backend.prompt_failed", err)
+	}
+	return strings.TrimSpace(string(secret)), nil
+}
+
+// validateBackend checks the required settings of the backend type before it is stored
+func validateBackend(b *models.Backend) error {
+	if b.ID == "" || strings.ContainsAny(b.ID, "/\\ \t") {
+		return i18n.Errorf("backend.invalid_id", b.ID)
+	}
+
+	switch b.Type {
+	case storage.TypeS3, storage.TypeAzure:
+		if b.Endpoint == "" && b.Type == storage.TypeS3 {
+			return i18n.Errorf("backend.missing", "--endpoint", b.Type)
+		}
+		if b.Bucket == "" {
+			return i18n.Errorf("backend.missing", "--bucket", b.Type)
+		}
+		if b.Type == storage.TypeAzure && (b.AccessKey == "" || b.SecretKey == "") {
+			return i18n.Errorf("backend.missing", "--access-key/--secret-key", b.Type)
+		}
+	case storage.TypeGCS:
+		if b.Bucket == "" {
+			return i18n.Errorf("backend.missing", "--bucket", b.Type)
+		}
+	case storage.TypeLocal:
+		if b.Endpoint == "" {
+			return i18n.Errorf("backend.missing", "--endpoint", b.Type)
+		}
+	default:
+		return i18n.Errorf("backend.invalid_type", b.Type)
+	}
+
+	switch b.IPPreference {
+	case "", storage.PreferIPv4, storage.PreferIPv6, storage.OnlyIPv4, storage.OnlyIPv6:
+	default:
+		return i18n.Errorf("backend.invalid_ip_preference", b.IPPreference)
+	}
+	if _, err := storage.ParseStaticHosts(b.StaticHosts); err != nil {
+		return i18n.Errorf("backend.invalid_static_hosts", err)
+	}
+	if b.TrashEnabled && b.TrashPrefix == "" {
+		return i18n.Errorf("backend.missing", "--trash-prefix", "trash")
+	}
+	if b.QuotaSoft > 0 && b.QuotaHard > 0 && b.QuotaSoft > b.QuotaHard {
+		return i18n.Errorf("backend.quota_exceeds_hard")
+	}
+	return nil
+}
+
+// backendInfo is the JSON representation of a backend, which never includes credentials
+type backendInfo struct {
+	ID             string    `json:"id"`
+	Name           string    `json:"name"`
+	Type           string    `json:"type"`
+	Endpoint       string    `json:"endpoint,omitempty"`
+	Region         string    `json:"region,omitempty"`
+	Bucket         string    `json:"bucket,omitempty"`
+	UseSSL         bool      `json:"use_ssl"`
+	Credentials    bool      `json:"credentials"`
+	TrashEnabled   bool      `json:"trash_enabled"`
+	TrashRetention int64     `json:"trash_retention,omitempty"`
+	QuotaSoft      int64     `json:"quota_soft,omitempty"`
+	QuotaHard      int64     `json:"quota_hard,omitempty"`
+	CreatedAt      time.Time `json:"created_at"`
+}
+
+func NewBackendListCommand() *cobra.Command {
+	var format string
+
+	cmd := &cobra.Command{
+		Use:   "list",
+		Short: "List backends",
+		Args:  cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			ctx := context.Background()
+
+			ms, err := openMetadataStore(ctx)
+			if err != nil {
+				return err
+			}
+			defer ms.Close()
+
+			backends, err := ms.ListBackends(ctx)
+			if err != nil {
+				return i18n.Errorf("backend.list_failed", err)
+			}
+
+			switch format {
+			case "json":
+				infos := make([]backendInfo, 0, len(backends))
+				for _, b := range backends {
+					infos = append(infos, backendInfo{
+						ID:             b.ID,
+						Name:           b.Name,
+						Type:           b.Type,
+						Endpoint:       b.Endpoint,
+						Region:         b.Region,
+						Bucket:         b.Bucket,
+						UseSSL:         b.UseSSL,
+						Credentials:    b.AccessKey != "" || b.SecretKey != "",
+						TrashEnabled:   b.TrashEnabled,
+						TrashRetention: b.TrashRetention,
+						QuotaSoft:      b.QuotaSoft,
+						QuotaHard:      b.QuotaHard,
+						CreatedAt:      b.CreatedAt,
+					})
+				}
+				enc := json.NewEncoder(os.Stdout)
+				enc.SetIndent("", "  ")
+				return enc.Encode(infos)
+			case "table":
+				w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+				fmt.Fprintln(w, i18n.T("backend.header"))
+				for _, b := range backends {
+					trash := "-"
+					if b.TrashEnabled {
+						trash = b.TrashPrefix
+					}
+					fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\n", b.ID, b.Name, b.Type, backendLocation(&b), trash)
+				}
+				return w.Flush()
+			default:
+				return i18n.Errorf("error.unsupported_format", format)
+			}
+		},
+	}
+
+	cmd.Flags().StringVarP(&format, "format", "o", "table", "Output format (table, json)")
+
+	return cmd
+}
+
+// backendLocation returns the endpoint and bucket of the backend in a readable form
+func backendLocation(b *models.Backend) string {
+	switch {
+	case b.Type == storage.TypeLocal:
+		return b.Endpoint
+	case b.Endpoint == "":
+		return b.Bucket
+	default:
+		return strings.TrimSuffix(b.Endpoint, "/") + "/" + b.Bucket
+	}
+}
+
+func NewBackendTestCommand() *cobra.Command {
+	var write bool
+
+	cmd := &cobra.Command{
+		Use:   "test <id>",
+		Short: "Test the connection to a backend",
+		Long: `Connects to the backend and lists its objects, verifying the endpoint, credentials and bucket.
+With --write a small object is also uploaded, read back and deleted again.`,
+		Args: cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			ctx, cancel := signal.NotifyContext(context.Background(), os.Interrupt)
+			defer cancel()
+
+			ms, err := openMetadataStore(ctx)
+			if err != nil {
+				return err
+			}
+			defer ms.Close()
+
+			b, err := ms.GetBackend(ctx, args[0])
+			if err != nil {
+				return i18n.Errorf("sync.backend_not_found", args[0], err)
+			}
+
+			st, flush, err := openStorage(ms, b)
+			if err != nil {
+				return i18n.Errorf("backend.open_failed", b.ID, err)
+			}
+			defer flush()
+
+			if err := backendTestStep("backend.test_list", func(ctx context.Context) error {
+				err := st.List(ctx, "", func(storage.ObjectInfo) error {
+					return errListed
+				})
+				if errors.Is(err, errListed) {
+					return nil
+				}
+				return err
+			}); err != nil {
+				return err
+			}
+			if !write {
+				fmt.Println(i18n.T("backend.test_passed", b.ID))
+				return nil
+			}
+
+			suffix := make([]byte, 8)
+			rand.Read(suffix)
+			key := ".gosync-test-" + hex.EncodeToString(suffix)
+			data := []byte("gosync backend test\n")
+
+			if err := backendTestStep("backend.test_put", func(ctx context.Context) error {
+				_, err := st.Put(ctx, key, bytes.NewReader(data), int64(len(data)), storage.PutOptions{})
+				return err
+			}); err != nil {
+				return err
+			}
+			getErr := backendTestStep("backend.test_get", func(ctx context.Context) error {
+				reader, err := st.Get(ctx, key)
+				if err != nil {
+					return err
+				}
+				defer reader.Close()
+
+				read, err := io.ReadAll(reader)
+				if err != nil {
+					return err
+				}
+				if !bytes.Equal(read, data) {
+					return i18n.Errorf("backend.test_mismatch", key)
+				}
+				return nil
+			})
+			// The test object is deleted even if it couldn't be read back
+			if err := backendTestStep("backend.test_delete", func(ctx context.Context) error {
+				return st.Delete(ctx, key)
+			}); err != nil {
+				return err
+			}
+			if getErr != nil {
+				return getErr
+			}
+
+			fmt.Println(i18n.T("backend.test_passed", b.ID))
+			return nil
+		},
+	}
+
+	cmd.Flags().BoolVar(&write, "write", false, "Also verify uploading, downloading and deleting an object")
+
+	return cmd
+}
+
+// backendTestStep runs a single step of a backend test and prints its result
+func backendTestStep(key string, fn func(ctx context.Context) error) error {
+	ctx, cancel := context.WithTimeout(context.Background(), backendTestTimeout)
+	defer cancel()
+
+	started := time.Now()
+	if err := fn(ctx); err != nil {
+		return i18n.Errorf("backend.test_failed", i18n.T(key), err)
+	}
+	fmt.Println(i18n.T("backend.test_step_ok", i18n.T(key), time.Since(started).Round(time.Millisecond)))
+	return nil
+}
+
+func NewBackendUpdateCommand() *cobra.Command {
+	var flags backendFlags
+
+	cmd := &cobra.Command{
+		Use:   "update <id>",
+		Short: "Update the settings of a backend",
+		Long:  "Updates only the settings provided as flags, e.g. rotated credentials with --access-key and --secret-key.",
+		Args:  cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			ctx := context.Background()
+
+			ms, err := openMetadataStore(ctx)
+			if err != nil {
+				return err
+			}
+			defer ms.Close()
+
+			b, err := ms.GetBackend(ctx, args[0])
+			if err != nil {
+				return i18n.Errorf("sync.backend_not_found", args[0], err)
+			}
+
+			if err := flags.apply(cmd, b); err != nil {
+				return err
+			}
+			if err := validateBackend(b); err != nil {
+				return err
+			}
+
+			if err := ms.UpdateBackend(ctx, b); err != nil {
+				return i18n.Errorf("backend.update_failed", b.ID, err)
+			}
+
+			fmt.Println(i18n.T("backend.updated", b.ID))
+			return nil
+		},
+	}
+
+	flags.bind(cmd)
+
+	return cmd
+}
+
+func NewBackendRemoveCommand() *cobra.Command {
+	var yes bool
+	var purgeFiles bool
+
+	cmd := &cobra.Command{
+		Use:   "remove <id>",
+		Short: "Remove a backend",
+		Long: `Removes the backend from the metadata store. Objects stored in the backend are never deleted,
+use "gosync vfs rm <id> --confirm" to wipe them first.
+
+The syncs, file records and trash items depending on the backend are listed before asking for confirmation.
+File records are kept, so the backend can be registered again, unless --purge-files is set.`,
+		Args: cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			ctx := context.Background()
+
+			ms, err := openMetadataStore(ctx)
+			if err != nil {
+				return err
+			}
+			defer ms.Close()
+
+			b, err := ms.GetBackend(ctx, args[0])
+			if err != nil {
+				return i18n.Errorf("sync.backend_not_found", args[0], err)
+			}
+
+			syncs, err := ms.ListSyncConfigs(ctx)
+			if err != nil {
+				return i18n.Errorf("backend.list_syncs_failed", err)
+			}
+			for _, sc := range syncs {
+				for _, p := range []string{sc.SourcePath, sc.DestPath} {
+					if vfs.ParsePath(p).Backend == b.ID {
+						fmt.Println(i18n.T("backend.warn_sync", sc.Name, p))
+						break
+					}
+				}
+			}
+
+			files := 0
+			if err := ms.IterateFiles(ctx, b.ID, "", func(*models.File) error {
+				files++
+				return nil
+			}); err != nil {
+				return i18n.Errorf("backend.count_files_failed", err)
+			}
+			if files > 0 {
+				if purgeFiles {
+					fmt.Println(i18n.T("backend.warn_purge_files", files))
+				} else {
+					fmt.Println(i18n.T("backend.warn_files", files))
+				}
+			}
+
+			trash, err := ms.ListTrashItems(ctx, b.ID, "")
+			if err != nil {
+				return i18n.Errorf("backend.count_trash_failed", err)
+			}
+			if len(trash) > 0 {
+				fmt.Println(i18n.T("backend.warn_trash", len(trash), b.TrashPrefix))
+			}
+
+			if !yes {
+				fmt.Print(i18n.T("backend.confirm", b.ID))
+				answer, err := bufio.NewReader(os.Stdin).ReadString('\n')
+				if err != nil && answer == "" {
+					return i18n.Errorf("backend.prompt_failed", err)
+				}
+				if strings.TrimSpace(answer) != b.ID {
+					return i18n.Errorf("backend.confirm_mismatch")
+				}
+			}
+
+			if purgeFiles {
+				if err := ms.DeleteFilesByBackend(ctx, b.ID); err != nil {
+					return i18n.Errorf("backend.purge_failed", b.ID, err)
+				}
+			}
+			if err := ms.DeleteBackend(ctx, b.ID); err != nil {
+				return i18n.Errorf("backend.remove_failed", b.ID, err)
+			}
+
+			fmt.Println(i18n.T("backend.removed", b.ID))
+			return nil
+		},
+	}
+
+	cmd.Flags().BoolVarP(&yes, "yes", "y", false, "Don't ask for confirmation")
+	cmd.Flags().BoolVar(&purgeFiles, "purge-files", false, "Also delete the file records of the backend")
+
+	return cmd
+}
@@ -0,0 +1,133 @@
+package client
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"os/signal"
+	"path"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/mwantia/gosync/internal/i18n"
+	"github.com/mwantia/gosync/pkg/db/store"
+	"github.com/mwantia/gosync/pkg/engine"
+	"github.com/mwantia/gosync/pkg/publish"
+	"github.com/spf13/cobra"
+)
+
+func NewCompareCommand() *cobra.Command {
+	var key string
+	var sizeOnly bool
+	var rehash bool
+	var format string
+
+	cmd := &cobra.Command{
+		Use:   "compare <a> <b>",
+		Short: "Compare two trees by hash without a sync",
+		Long: `Compares the files below two virtual paths or local directories by their relative path, e.g. two backends
+mirroring the same data or a backend with a local copy. Either path may also refer to the manifest of a published
+mirror (<backend/path>/.gosync-manifest.json), whose signature is verified with --key.
+
+Files only found within <a> are reported as missing, files only found within <b> as extra, and files with a
+different size or SHA256 as different. Recorded hashes of unchanged objects and cached hashes of unchanged local
+files are used unless --rehash is set, all other files are downloaded or read once. The command fails if any
+file is reported.`,
+		Args: cobra.ExactArgs(2),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if format != "table" && format != "json" {
+				return i18n.Errorf("error.unsupported_format", format)
+			}
+
+			ctx, cancel := signal.NotifyContext(context.Background(), os.Interrupt)
+			defer cancel()
+
+			ms, err := openMetadataStore(ctx)
+			if err != nil {
+				return err
+			}
+			defer ms.Close()
+
+			trees := make([]*engine.CompareTree, len(args))
+			for i, arg := range args {
+				tree, flush, err := openCompareTree(ctx, ms, arg, key)
+				if err != nil {
+					return err
+				}
+				defer flush()
+				trees[i] = tree
+			}
+
+			report, err := engine.Compare(ctx, ms, trees[0], trees[1], engine.CompareOptions{SizeOnly: sizeOnly, Rehash: rehash})
+			if err != nil {
+				return err
+			}
+
+			if format == "json" {
+				enc := json.NewEncoder(os.Stdout)
+				enc.SetIndent("", "  ")
+				if err := enc.Encode(report); err != nil {
+					return err
+				}
+			} else {
+				if len(report.Findings) > 0 {
+					w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+					fmt.Fprintln(w, i18n.T("compare.header"))
+					for _, f := range report.Findings {
+						fmt.Fprintf(w, "%s\t%s\t%s\n", f.Status, f.Path, f.Detail)
+					}
+					if err := w.Flush(); err != nil {
+						return err
+					}
+				}
+				fmt.Println(i18n.T("compare.summary", report.Compared, report.Hashed, formatSize(report.Bytes, true), len(report.Findings)))
+			}
+
+			if len(report.Findings) > 0 {
+				return i18n.Errorf("compare.failed", len(report.Findings))
+			}
+			return nil
+		},
+	}
+
+	cmd.Flags().StringVar(&key, "key", "", "Trusted base64 encoded ed25519 public key of published manifests")
+	cmd.Flags().BoolVar(&sizeOnly, "size-only", false, "Only compare the size of files found within both trees")
+	cmd.Flags().BoolVar(&rehash, "rehash", false, "Read all files instead of using recorded and cached hashes")
+	cmd.Flags().StringVarP(&format, "format", "o", "table", "Output format (table, json)")
+
+	return cmd
+}
+
+// openCompareTree opens the tree of a local directory, a virtual path or a published manifest;
+// the returned flush must be called once the tree isn't used anymore
+func openCompareTree(ctx context.Context, ms store.MetadataStore, arg, key string) (*engine.CompareTree, func(), error) {
+	manifest := path.Base(arg) == publish.ManifestName
+	root := arg
+	if manifest {
+		// Cutting the name keeps the "./" of relative local paths, which path.Dir would clean
+		if root = strings.TrimSuffix(arg, publish.ManifestName); root == "" {
+			root = "."
+		}
+	}
+
+	st, prefix, b, flush, err := openPath(ctx, ms, root)
+	if err != nil {
+		return nil, nil, err
+	}
+	tree := &engine.CompareTree{Name: arg, Storage: st, Prefix: prefix, Backend: b}
+	if !manifest {
+		return tree, flush, nil
+	}
+
+	trusted, err := publish.ParsePublicKey(key)
+	if err != nil {
+		flush()
+		return nil, nil, i18n.Errorf("publish.invalid_key", err)
+	}
+	if tree.Manifest, err = publish.Read(ctx, st, prefix, trusted); err != nil {
+		flush()
+		return nil, nil, i18n.Errorf("publish.read_failed", err)
+	}
+	return tree, flush, nil
+}
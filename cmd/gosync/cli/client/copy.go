@@ -0,0 +1,249 @@
+package client
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"strings"
+
+	"github.com/mwantia/gosync/internal/i18n"
+	"github.com/mwantia/gosync/pkg/backend"
+	"github.com/mwantia/gosync/pkg/db/models"
+	"github.com/mwantia/gosync/pkg/db/store"
+	"github.com/mwantia/gosync/pkg/engine"
+	"github.com/mwantia/gosync/pkg/storage"
+	"github.com/mwantia/gosync/pkg/vfs"
+	"github.com/spf13/cobra"
+)
+
+// errStopListing stops listings once the first object was found
+var errStopListing = errors.New("stop listing")
+
+// copyFlags are shared by cp and mv
+type copyFlags struct {
+	recursive bool
+	progress  bool
+	workers   int
+	dryRun    bool
+	regex     bool
+}
+
+func NewCopyCommand() *cobra.Command {
+	var flags copyFlags
+
+	cmd := &cobra.Command{
+		Use:   "cp <source> <destination>",
+		Short: "Copy files between virtual and local paths",
+		Long: `Copies a file or, with --recursive, a directory between virtual paths of backends and local paths. Files within the same
+backend are copied server-side, all other files are streamed by parallel workers. Existing directories receive the copy
+under its own name, like the paths ending with '/'. Virtual sources containing wildcards, or regular expressions with
+--regex, copy all matching files into the destination directory, keeping their paths below the last directory before
+the first wildcard.`,
+		Example: `  gosync cp ./report.pdf s3/documents/
+  gosync cp -r s3/photos/2024 ./photos
+  gosync cp -r --progress s3/photos azure/photos
+  gosync cp --dry-run 's3/photos/2023/**/*.jpg' ./jpegs`,
+		Args: cobra.ExactArgs(2),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return runCopy(args[0], args[1], false, flags)
+		},
+	}
+
+	addCopyFlags(cmd, &flags)
+
+	return cmd
+}
+
+func NewMoveCommand() *cobra.Command {
+	var flags copyFlags
+
+	cmd := &cobra.Command{
+		Use:   "mv <source> <destination>",
+		Short: "Move files between virtual and local paths",
+		Long: `Moves a file or, with --recursive, a directory between virtual paths of backends and local paths. Each source file
+is removed once it was copied, files of backends with trash enabled are moved into their trash.`,
+		Example: `  gosync mv s3/inbox/scan.pdf s3/documents/
+  gosync mv -r ./export s3/archive/`,
+		Args: cobra.ExactArgs(2),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return runCopy(args[0], args[1], true, flags)
+		},
+	}
+
+	addCopyFlags(cmd, &flags)
+
+	return cmd
+}
+
+func addCopyFlags(cmd *cobra.Command, flags *copyFlags) {
+	cmd.Flags().BoolVarP(&flags.recursive, "recursive", "r", false, "Copy directories with all their files")
+	cmd.Flags().BoolVar(&flags.progress, "progress", false, "Show the progress of all files being copied")
+	cmd.Flags().IntVar(&flags.workers, "workers", backend.DefaultCopyWorkers, "Number of files copied at once")
+	cmd.Flags().BoolVar(&flags.dryRun, "dry-run", false, "Only print the files that would be copied")
+	cmd.Flags().BoolVar(&flags.regex, "regex", false, "Match the source path within its backend as a regular expression")
+}
+
+// copyPath is the resolved source or destination of a copy
+type copyPath struct {
+	endpoint backend.CopyEndpoint
+	key      string
+	// into is set for destinations that are existing directories
+	into bool
+	// local is the absolute path of local paths
+	local string
+	// pattern matches the files of virtual sources containing wildcards
+	pattern *vfs.Pattern
+}
+
+func runCopy(source, destination string, move bool, flags copyFlags) error {
+	ctx, cancel := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer cancel()
+
+	ms, err := openMetadataStore(ctx)
+	if err != nil {
+		return err
+	}
+	defer ms.Close()
+
+	if err := checkMaintenance(ctx, ms); err != nil {
+		return err
+	}
+
+	from, flushFrom, err := resolveCopyPath(ctx, ms, source, false)
+	if err != nil {
+		return err
+	}
+	defer flushFrom()
+	if from.endpoint.Backend != nil {
+		if from.pattern, err = compilePattern(from.key, flags.regex); err != nil {
+			return err
+		}
+	}
+	to, flushTo, err := resolveCopyPath(ctx, ms, destination, true)
+	if err != nil {
+		return err
+	}
+	defer flushTo()
+
+	if from.local != "" && to.local != "" {
+		target := to.local
+		if to.into {
+			target = filepath.Join(to.local, filepath.Base(from.local))
+		}
+		if target == from.local || strings.HasPrefix(target, from.local+string(filepath.Separator)) {
+			return i18n.Errorf("copy.within_source", source, destination)
+		}
+	}
+
+	copier := backend.NewCopier(ms, from.endpoint, to.endpoint)
+	var items []backend.CopyItem
+	if from.pattern != nil {
+		items, err = copier.PlanMatching(ctx, from.pattern, to.key)
+	} else {
+		items, err = copier.Plan(ctx, from.key, to.key, flags.recursive, to.into)
+	}
+	if err != nil {
+		return err
+	}
+
+	if flags.dryRun {
+		for _, item := range items {
+			fmt.Printf("%s -> %s\n", item.From, item.To)
+		}
+		return nil
+	}
+
+	opts := backend.CopyOptions{
+		Move:    move,
+		Workers: flags.workers,
+	}
+	label := i18n.T("copy.copying")
+	if move {
+		label = i18n.T("copy.moving")
+	}
+	var display *progressDisplay
+	if flags.progress {
+		display = newProgressDisplay()
+		opts.Progress = func(p backend.CopyProgress) {
+			overall := progressItem{Label: label, Current: p.Bytes, Total: p.TotalBytes, Bytes: true}
+			active := make([]progressItem, 0, len(p.Active))
+			for _, t := range p.Active {
+				active = append(active, progressItem{Label: t.Path, Current: t.BytesDone, Total: t.Size, Bytes: true})
+			}
+			display.Update(overall, active)
+		}
+	}
+
+	copied, err := copier.Apply(ctx, items, opts)
+	if display != nil {
+		display.Finish()
+	}
+
+	var size int64
+	for _, item := range items {
+		size += item.Size
+	}
+	if move {
+		fmt.Println(i18n.T("copy.moved", copied, len(items), formatSize(size, true)))
+	} else {
+		fmt.Println(i18n.T("copy.copied", copied, len(items), formatSize(size, true)))
+	}
+	return err
+}
+
+// resolveCopyPath opens the storage of a local or virtual path. Local paths are opened within their parent directory,
+// unless destinations are existing directories. The returned function flushes the bandwidth usage of backends.
+func resolveCopyPath(ctx context.Context, ms store.MetadataStore, p string, destination bool) (*copyPath, func(), error) {
+	if engine.IsLocalPath(p) {
+		name, err := filepath.Abs(p)
+		if err != nil {
+			return nil, nil, err
+		}
+
+		root, key := filepath.Dir(name), filepath.Base(name)
+		info, err := os.Stat(name)
+		into := destination && (err == nil && info.IsDir() || strings.HasSuffix(p, "/") || strings.HasSuffix(p, string(filepath.Separator)))
+		if into {
+			root, key = name, ""
+		}
+
+		st, err := storage.NewLocalStorage(&models.Backend{Type: storage.TypeLocal, Endpoint: root})
+		if err != nil {
+			return nil, nil, err
+		}
+		return &copyPath{endpoint: backend.CopyEndpoint{Storage: st}, key: key, into: into, local: name}, func() {}, nil
+	}
+
+	path := vfs.ParsePath(p)
+	if path.IsRoot() {
+		return nil, nil, i18n.Errorf("copy.backend_required", p)
+	}
+	b, err := ms.GetBackend(ctx, path.Backend)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to find backend '%s': %w", path.Backend, err)
+	}
+	st, flush, err := openStorage(ms, b)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	resolved := &copyPath{endpoint: backend.CopyEndpoint{Storage: st, Backend: b}, key: path.Key}
+	if destination {
+		resolved.into = path.IsBackend() || strings.HasSuffix(p, "/")
+		if !resolved.into {
+			// Directories only exist as prefixes of their files
+			err := st.List(ctx, path.Key+"/", func(storage.ObjectInfo) error {
+				return errStopListing
+			})
+			if err != nil && !errors.Is(err, errStopListing) {
+				flush()
+				return nil, nil, fmt.Errorf("failed to list '%s': %w", p, err)
+			}
+			resolved.into = errors.Is(err, errStopListing)
+		}
+	}
+	return resolved, flush, nil
+}
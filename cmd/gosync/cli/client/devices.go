@@ -0,0 +1,185 @@
+package client
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/mwantia/gosync/internal/api"
+	"github.com/mwantia/gosync/internal/i18n"
+	"github.com/mwantia/gosync/pkg/db/store"
+	"github.com/mwantia/gosync/pkg/device"
+	"github.com/spf13/cobra"
+)
+
+func NewDevicesCommand() *cobra.Command {
+	cmd := NewDevicesListCommand()
+	cmd.Use = "devices"
+	cmd.Aliases = []string{"clients"}
+	cmd.Short = "List and revoke the devices sharing the metadata store"
+
+	cmd.AddCommand(NewDevicesListCommand())
+	cmd.AddCommand(NewDevicesRevokeCommand())
+	cmd.AddCommand(NewDevicesRestoreCommand())
+
+	return cmd
+}
+
+func NewDevicesListCommand() *cobra.Command {
+	var onlineOnly bool
+	var format string
+
+	cmd := &cobra.Command{
+		Use:   "ls",
+		Short: "List the devices sharing the metadata store",
+		Long: `Lists all agents that have recorded a heartbeat in the shared metadata store, showing whether they are online or revoked,
+their versions and their currently running syncs. The device the command runs on is marked with '*'.`,
+		Args: cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if format != "table" && format != "json" {
+				return i18n.Errorf("error.unsupported_format", format)
+			}
+
+			ctx := context.Background()
+
+			ms, err := openMetadataStore(ctx)
+			if err != nil {
+				return err
+			}
+			defer ms.Close()
+
+			clients, err := ms.ListClients(ctx)
+			if err != nil {
+				return i18n.Errorf("clients.list_failed", err)
+			}
+
+			// The current device is only marked if its machine id can be determined
+			current := ""
+			if machineID, err := device.MachineID(); err == nil {
+				if client := device.Lookup(clients, machineID); client != nil {
+					current = client.ID
+				}
+			}
+
+			now := time.Now()
+			presences := make([]api.Presence, 0, len(clients))
+			for _, client := range clients {
+				presence := api.NewPresence(client, now)
+				if onlineOnly && !presence.Online {
+					continue
+				}
+				presences = append(presences, presence)
+			}
+
+			if format == "json" {
+				enc := json.NewEncoder(os.Stdout)
+				enc.SetIndent("", "  ")
+				return enc.Encode(presences)
+			}
+
+			w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+			fmt.Fprintln(w, i18n.T("clients.header"))
+			for _, p := range presences {
+				state := i18n.T("clients.offline")
+				switch {
+				case p.RevokedAt != nil:
+					state = i18n.T("clients.revoked")
+				case p.Online:
+					state = i18n.T("clients.online")
+				}
+				active := strings.Join(p.ActiveSyncs, ", ")
+				if active == "" {
+					active = "-"
+				}
+				id := p.ID
+				if id == current {
+					id += " *"
+				}
+				name := p.Name
+				if name == "" {
+					name = "-"
+				}
+				fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\t%s\t%s\n", id, name, state, p.Version, p.Platform,
+					p.LastSeenAt.Local().Format(time.DateTime), active)
+			}
+			return w.Flush()
+		},
+	}
+
+	cmd.Flags().BoolVar(&onlineOnly, "online", false, "Only list devices that are currently online")
+	cmd.Flags().StringVarP(&format, "format", "o", "table", "Output format (table, json)")
+
+	return cmd
+}
+
+func NewDevicesRevokeCommand() *cobra.Command {
+	var reason string
+
+	cmd := &cobra.Command{
+		Use:   "revoke <id>",
+		Short: "Revoke a device, e.g. after it was stolen",
+		Long: `Revokes a device, so its agent stops all syncs with its next heartbeat and refuses to start again. The CLI of the device
+refuses to open the metadata store as well. Since the device still holds the credentials of the metadata store and the
+backends, rotate them if the device may be compromised. The baselines of the device are kept until it is restored.`,
+		Args: cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			ctx := context.Background()
+
+			ms, err := openMetadataStore(ctx)
+			if err != nil {
+				return err
+			}
+			defer ms.Close()
+
+			now := time.Now().UTC()
+			if err := ms.RevokeClient(ctx, args[0], &now, reason); err != nil {
+				if errors.Is(err, store.ErrNotFound) {
+					return i18n.Errorf("devices.not_found", args[0])
+				}
+				return err
+			}
+
+			fmt.Println(i18n.T("devices.revoked_device", args[0]))
+			return nil
+		},
+	}
+
+	cmd.Flags().StringVar(&reason, "reason", "", "Reason shown to the revoked device")
+
+	return cmd
+}
+
+func NewDevicesRestoreCommand() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "restore <id>",
+		Short: "Restore a revoked device",
+		Long:  "Restores a revoked device, so its agent can be started again and continues with its baselines.",
+		Args:  cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			ctx := context.Background()
+
+			ms, err := openMetadataStore(ctx)
+			if err != nil {
+				return err
+			}
+			defer ms.Close()
+
+			if err := ms.RevokeClient(ctx, args[0], nil, ""); err != nil {
+				if errors.Is(err, store.ErrNotFound) {
+					return i18n.Errorf("devices.not_found", args[0])
+				}
+				return err
+			}
+
+			fmt.Println(i18n.T("devices.restored", args[0]))
+			return nil
+		},
+	}
+
+	return cmd
+}
@@ -0,0 +1,105 @@
+package client
+
+import (
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"os"
+	"strconv"
+	"text/tabwriter"
+	"time"
+
+	"github.com/mwantia/gosync/internal/i18n"
+	"github.com/mwantia/gosync/pkg/backend"
+	"github.com/mwantia/gosync/pkg/engine"
+	"github.com/mwantia/gosync/pkg/vfs"
+	"github.com/spf13/cobra"
+)
+
+func NewDiffCommand() *cobra.Command {
+	var since string
+	var until string
+	var format string
+
+	cmd := &cobra.Command{
+		Use:   "diff <sync-name>",
+		Short: "Report changes of a sync within a time window",
+		Long:  "Lists all files added, modified or deleted within the time window based on the recorded file history, for change review and compliance reporting.",
+		Args:  cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			now := time.Now()
+
+			from, err := parseSince(since, now)
+			if err != nil {
+				return err
+			}
+			to, err := parseSince(until, now)
+			if err != nil {
+				return err
+			}
+
+			ctx := context.Background()
+
+			ms, err := openMetadataStore(ctx)
+			if err != nil {
+				return err
+			}
+			defer ms.Close()
+
+			sc, err := ms.GetSyncConfig(ctx, args[0])
+			if err != nil {
+				return fmt.Errorf("failed to find sync '%s': %w", args[0], err)
+			}
+
+			clientID, err := currentClientID(ctx, ms)
+			if err != nil {
+				return err
+			}
+
+			source, _ := engine.ResolvePaths(sc, clientID)
+			path := vfs.ParsePath(source)
+			changes, err := backend.Diff(ctx, ms, path.Backend, path.Key, from, to)
+			if err != nil {
+				return err
+			}
+
+			return printChanges(changes, format)
+		},
+	}
+
+	cmd.Flags().StringVar(&since, "since", "24h", "Start of the window as duration (e.g. 7d) or time")
+	cmd.Flags().StringVar(&until, "until", "", "End of the window as duration or time (default now)")
+	cmd.Flags().StringVarP(&format, "format", "o", "table", "Output format (table, json, csv)")
+
+	return cmd
+}
+
+func printChanges(changes []backend.Change, format string) error {
+	switch format {
+	case "json":
+		encoder := json.NewEncoder(os.Stdout)
+		encoder.SetIndent("", "    ")
+		return encoder.Encode(changes)
+
+	case "csv":
+		w := csv.NewWriter(os.Stdout)
+		w.Write([]string{"path", "type", "size", "sha256", "changed_at", "events"})
+		for _, c := range changes {
+			w.Write([]string{c.Path, string(c.Type), strconv.FormatInt(c.Size, 10), c.SHA256, c.ChangedAt.Format(time.RFC3339), strconv.Itoa(c.Events)})
+		}
+		w.Flush()
+		return w.Error()
+
+	case "table":
+		w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(w, i18n.T("diff.header"))
+		for _, c := range changes {
+			fmt.Fprintf(w, "%s\t%s\t%d\t%s\n", c.Type, c.ChangedAt.Local().Format(time.DateTime), c.Size, c.Path)
+		}
+		return w.Flush()
+
+	default:
+		return fmt.Errorf("unsupported output format '%s'", format)
+	}
+}
@@ -0,0 +1,102 @@
+package client
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"text/tabwriter"
+
+	"github.com/mwantia/gosync/internal/i18n"
+	"github.com/mwantia/gosync/pkg/resources"
+	"github.com/spf13/cobra"
+)
+
+func NewVerifyConfigCommand() *cobra.Command {
+	var format string
+	var exitCode bool
+
+	cmd := &cobra.Command{
+		Use:   "verify-config-against-agent <file>",
+		Short: "Report drift between declared resources and the metadata store",
+		Long: `Compares the backends, syncs and filters declared in a YAML file (or "-" for stdin) with the live state
+of the agent's metadata store and reports resources that are missing, changed or extra. Only declared settings are
+compared, and extra resources are only reported for kinds the file declares, e.g.
+
+  backends:
+    - id: minio
+      endpoint: minio.local:9000
+      bucket: home
+  syncs:
+    - name: documents
+      source: minio/documents
+      dest: ~/Documents
+      interval: 5m`,
+		Args: cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if format != "table" && format != "json" {
+				return i18n.Errorf("error.unsupported_format", format)
+			}
+
+			doc, err := resources.Load(args[0])
+			if err != nil {
+				return err
+			}
+
+			ctx := context.Background()
+
+			ms, err := openMetadataStore(ctx)
+			if err != nil {
+				return err
+			}
+			defer ms.Close()
+
+			drifts, err := resources.Compare(ctx, ms, doc)
+			if err != nil {
+				return err
+			}
+
+			if err := printDrift(drifts, format, args[0]); err != nil {
+				return err
+			}
+			if exitCode && len(drifts) > 0 {
+				return i18n.Errorf("drift.detected", len(drifts), args[0])
+			}
+			return nil
+		},
+	}
+
+	cmd.Flags().StringVarP(&format, "format", "o", "table", "Output format (table, json)")
+	cmd.Flags().BoolVar(&exitCode, "exit-code", false, "Exit with an error if any drift is detected")
+
+	return cmd
+}
+
+func printDrift(drifts []resources.Drift, format, file string) error {
+	if format == "json" {
+		if drifts == nil {
+			drifts = []resources.Drift{}
+		}
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		return enc.Encode(drifts)
+	}
+
+	if len(drifts) == 0 {
+		fmt.Println(i18n.T("drift.none", file))
+		return nil
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, i18n.T("drift.header"))
+	for _, d := range drifts {
+		if len(d.Changes) == 0 {
+			fmt.Fprintf(w, "%s\t%s\t%s\t-\t-\t-\n", d.Kind, d.Name, d.Status)
+			continue
+		}
+		for _, c := range d.Changes {
+			fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\t%s\n", d.Kind, d.Name, d.Status, c.Field, c.Desired, c.Actual)
+		}
+	}
+	return w.Flush()
+}
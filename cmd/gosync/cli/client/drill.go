@@ -0,0 +1,140 @@
+package client
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/signal"
+	"text/tabwriter"
+	"time"
+
+	"github.com/mwantia/gosync/internal/i18n"
+	"github.com/mwantia/gosync/pkg/backend"
+	"github.com/mwantia/gosync/pkg/db/models"
+	"github.com/spf13/cobra"
+)
+
+func NewDrillCommand() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "drill",
+		Short: "Run and list restore drills",
+		Long:  "Restore drills download a random sample of files of a backend and verify their recorded hashes, proving that backups can actually be restored.",
+	}
+
+	cmd.AddCommand(NewDrillRunCommand())
+	cmd.AddCommand(NewDrillListCommand())
+
+	return cmd
+}
+
+func NewDrillRunCommand() *cobra.Command {
+	var samples int
+	var maxFileSize int64
+
+	cmd := &cobra.Command{
+		Use:   "run <backend>",
+		Short: "Run a restore drill",
+		Long:  "Restores a random sample of files of the backend into a temporary directory, compares them with the recorded hashes and records the result.",
+		Args:  cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			ctx, cancel := signal.NotifyContext(context.Background(), os.Interrupt)
+			defer cancel()
+
+			ms, err := openMetadataStore(ctx)
+			if err != nil {
+				return err
+			}
+			defer ms.Close()
+
+			b, err := ms.GetBackend(ctx, args[0])
+			if err != nil {
+				return fmt.Errorf("failed to find backend '%s': %w", args[0], err)
+			}
+
+			st, flush, err := openStorage(ms, b)
+			if err != nil {
+				return err
+			}
+			defer flush()
+
+			result, err := backend.NewDrill(ms, st, b).Run(ctx, backend.DrillOptions{
+				Samples:     samples,
+				MaxFileSize: maxFileSize << 20,
+				Progress: func(path string, err error) {
+					if err != nil {
+						fmt.Println(i18n.T("drill.file_failed", path, err))
+						return
+					}
+					fmt.Println(i18n.T("drill.file_verified", path))
+				},
+			})
+			if err != nil {
+				return err
+			}
+			if result.Error != "" {
+				return fmt.Errorf("%s", i18n.T("drill.failed", b.ID, result.Error))
+			}
+
+			fmt.Println(i18n.T("drill.summary", result.Verified, result.Sampled, formatSize(result.Bytes, true), result.FinishedAt.Sub(result.StartedAt).Round(time.Millisecond)))
+			if !result.Passed() {
+				return fmt.Errorf("%s", i18n.T("drill.files_failed", result.Failed, result.Sampled))
+			}
+			return nil
+		},
+	}
+
+	cmd.Flags().IntVar(&samples, "samples", backend.DefaultDrillSamples, "Number of randomly chosen files to restore")
+	cmd.Flags().Int64Var(&maxFileSize, "max-file-size", 256, "Exclude files larger than this size in MB (0 = unlimited)")
+
+	return cmd
+}
+
+func NewDrillListCommand() *cobra.Command {
+	var limit int
+
+	cmd := &cobra.Command{
+		Use:   "ls [backend]",
+		Short: "List recorded restore drills",
+		Long:  "List the latest restore drills of all backends or of a single backend.",
+		Args:  cobra.MaximumNArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			ctx := context.Background()
+
+			ms, err := openMetadataStore(ctx)
+			if err != nil {
+				return err
+			}
+			defer ms.Close()
+
+			backendID := ""
+			if len(args) > 0 {
+				backendID = args[0]
+			}
+
+			drills, err := ms.ListRestoreDrills(ctx, backendID, limit)
+			if err != nil {
+				return fmt.Errorf("failed to list restore drills: %w", err)
+			}
+
+			w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+			fmt.Fprintln(w, i18n.T("drill.header"))
+			for _, drill := range drills {
+				fmt.Fprintf(w, "%s\t%s\t%s\t%d/%d\t%s\t%s\n", drill.BackendID, drill.StartedAt.Local().Format(time.DateTime),
+					drill.FinishedAt.Sub(drill.StartedAt).Round(time.Second), drill.Verified, drill.Sampled,
+					formatSize(drill.Bytes, true), drillStatus(&drill))
+			}
+			return w.Flush()
+		},
+	}
+
+	cmd.Flags().IntVar(&limit, "limit", 20, "Maximum number of listed drills (0 = unlimited)")
+
+	return cmd
+}
+
+func drillStatus(drill *models.RestoreDrill) string {
+	if drill.Passed() {
+		return i18n.T("drill.passed")
+	}
+	return i18n.T("drill.failed_status")
+}
@@ -0,0 +1,85 @@
+package client
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"os/signal"
+	"text/tabwriter"
+
+	"github.com/mwantia/gosync/internal/api"
+	"github.com/mwantia/gosync/internal/i18n"
+	"github.com/spf13/cobra"
+)
+
+func NewDuCommand() *cobra.Command {
+	var address string
+	var format string
+	var human bool
+
+	cmd := &cobra.Command{
+		Use:   "du [path]",
+		Short: "Show the storage used by backends and directories",
+		Long: "Shows the objects and bytes stored below a virtual path like backend/path or a local path within a sync, " +
+			"broken down by its direct subdirectories. Without a path, all backends are listed with their quotas.",
+		Args: cobra.MaximumNArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if format != "table" && format != "json" {
+				return i18n.Errorf("error.unsupported_format", format)
+			}
+			p := ""
+			if len(args) > 0 {
+				p = absTagPath(args[0])
+			}
+
+			client, err := newAgentClient(address)
+			if err != nil {
+				return err
+			}
+
+			ctx, cancel := signal.NotifyContext(context.Background(), os.Interrupt)
+			defer cancel()
+
+			usage, err := client.Usage(ctx, p)
+			if err != nil {
+				return i18n.Errorf("du.failed", p, err)
+			}
+			return printUsage(usage, format, human)
+		},
+	}
+
+	cmd.Flags().StringVar(&address, "address", "", "Address of the agent API (defaults to api.address of the configuration)")
+	cmd.Flags().StringVarP(&format, "format", "o", "table", "Output format (table, json)")
+	cmd.Flags().BoolVarP(&human, "human-readable", "H", false, "Print sizes in human readable format")
+
+	return cmd
+}
+
+func printUsage(usage *api.UsageResponse, format string, human bool) error {
+	if format == "json" {
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		return enc.Encode(usage)
+	}
+
+	quota := func(size int64) string {
+		if size <= 0 {
+			return "-"
+		}
+		return formatSize(size, human)
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, i18n.T("du.header"))
+	for _, entry := range usage.Entries {
+		fmt.Fprintf(w, "%s\t%d\t%s\t%s\t%s\n", entry.Path, entry.Objects, formatSize(entry.Bytes, human), quota(entry.QuotaSoft), quota(entry.QuotaHard))
+	}
+
+	total := usage.Path
+	if total == "" {
+		total = i18n.T("du.total")
+	}
+	fmt.Fprintf(w, "%s\t%d\t%s\t%s\t%s\n", total, usage.Objects, formatSize(usage.Bytes, human), quota(usage.QuotaSoft), quota(usage.QuotaHard))
+	return w.Flush()
+}
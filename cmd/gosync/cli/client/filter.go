@@ -0,0 +1,393 @@
+package client
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"os/signal"
+	"path"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/mwantia/gosync/internal/api"
+	"github.com/mwantia/gosync/internal/i18n"
+	"github.com/mwantia/gosync/pkg/db/models"
+	"github.com/mwantia/gosync/pkg/db/store"
+	"github.com/mwantia/gosync/pkg/filter"
+	"github.com/spf13/cobra"
+)
+
+func NewFilterCommand() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "filter",
+		Short: "Manage filters",
+		Long: `Manage filters, which are dynamic virtual paths below filters/ listing all files matching a query.
+
+Queries compare tags (tag:colour=red, tag:rating>=4, tag:people contains family, tag:favourite)
+or fields of the files (path:photos/2024, backend:selfhosted, size>10MB, modified_time>now-30d),
+combined with AND, OR, NOT and parentheses. Values containing spaces are quoted, e.g. tag:title='My trip'.
+Use 'filter preview' to check the files matched by a query before saving it.`,
+	}
+
+	cmd.AddCommand(NewFilterCreateCommand())
+	cmd.AddCommand(NewFilterListCommand())
+	cmd.AddCommand(NewFilterShowCommand())
+	cmd.AddCommand(NewFilterRemoveCommand())
+	cmd.AddCommand(NewFilterPreviewCommand())
+
+	return cmd
+}
+
+func NewFilterCreateCommand() *cobra.Command {
+	var expression string
+	var name string
+	var description string
+
+	cmd := &cobra.Command{
+		Use:   "create <path>",
+		Short: "Create a filter",
+		Args:  cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			p, err := filterPath(args[0])
+			if err != nil {
+				return err
+			}
+			if expression == "" {
+				return i18n.Errorf("filter.missing_query")
+			}
+			q, err := parseFilter(expression)
+			if err != nil {
+				return err
+			}
+			if name == "" {
+				name = path.Base(p)
+			}
+
+			ctx := context.Background()
+
+			ms, err := openMetadataStore(ctx)
+			if err != nil {
+				return err
+			}
+			defer ms.Close()
+
+			if _, err := ms.GetFilter(ctx, p); err == nil {
+				return i18n.Errorf("filter.exists", p)
+			}
+
+			f := &models.Filter{
+				VirtualPath:     p,
+				Name:            name,
+				QueryExpression: q.String(),
+				Description:     description,
+			}
+			if err := ms.CreateFilter(ctx, f); err != nil {
+				return i18n.Errorf("filter.create_failed", p, err)
+			}
+
+			fmt.Println(i18n.T("filter.created", p, q))
+			return nil
+		},
+	}
+
+	cmd.Flags().StringVar(&expression, "filter", "", "Query selecting the files of the filter")
+	cmd.Flags().StringVar(&name, "name", "", "Name of the filter (defaults to the last path segment)")
+	cmd.Flags().StringVar(&description, "description", "", "Description of the filter")
+
+	return cmd
+}
+
+func NewFilterListCommand() *cobra.Command {
+	var format string
+
+	cmd := &cobra.Command{
+		Use:   "ls",
+		Short: "List filters",
+		Args:  cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if format != "table" && format != "json" {
+				return i18n.Errorf("error.unsupported_format", format)
+			}
+			ctx := context.Background()
+
+			ms, err := openMetadataStore(ctx)
+			if err != nil {
+				return err
+			}
+			defer ms.Close()
+
+			filters, err := ms.ListFilters(ctx)
+			if err != nil {
+				return i18n.Errorf("filter.list_failed", err)
+			}
+
+			if format == "json" {
+				infos := make([]filterInfo, 0, len(filters))
+				for i := range filters {
+					infos = append(infos, newFilterInfo(&filters[i]))
+				}
+				enc := json.NewEncoder(os.Stdout)
+				enc.SetIndent("", "  ")
+				return enc.Encode(infos)
+			}
+
+			w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+			fmt.Fprintln(w, i18n.T("filter.header"))
+			for _, f := range filters {
+				fmt.Fprintf(w, "%s\t%s\t%s\n", f.VirtualPath, f.Name, f.QueryExpression)
+			}
+			return w.Flush()
+		},
+	}
+
+	cmd.Flags().StringVarP(&format, "format", "o", "table", "Output format (table, json)")
+
+	return cmd
+}
+
+func NewFilterShowCommand() *cobra.Command {
+	var limit int
+	var format string
+
+	cmd := &cobra.Command{
+		Use:   "show <path>",
+		Short: "Show a filter and the files matching it",
+		Args:  cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if format != "table" && format != "json" {
+				return i18n.Errorf("error.unsupported_format", format)
+			}
+			p, err := filterPath(args[0])
+			if err != nil {
+				return err
+			}
+
+			ctx, cancel := signal.NotifyContext(context.Background(), os.Interrupt)
+			defer cancel()
+
+			ms, err := openMetadataStore(ctx)
+			if err != nil {
+				return err
+			}
+			defer ms.Close()
+
+			f, err := ms.GetFilter(ctx, p)
+			if err != nil {
+				return i18n.Errorf("filter.not_found", p)
+			}
+
+			info := newFilterInfo(f)
+			q, err := parseFilter(f.QueryExpression)
+			if err != nil {
+				return err
+			}
+			info.Preview, err = previewFilter(ctx, ms, q, limit)
+			if err != nil {
+				return err
+			}
+
+			if format == "json" {
+				enc := json.NewEncoder(os.Stdout)
+				enc.SetIndent("", "  ")
+				return enc.Encode(info)
+			}
+
+			w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+			fmt.Fprintf(w, "%s\t%s\n", i18n.T("filter.path"), f.VirtualPath)
+			fmt.Fprintf(w, "%s\t%s\n", i18n.T("filter.name"), f.Name)
+			fmt.Fprintf(w, "%s\t%s\n", i18n.T("filter.query"), f.QueryExpression)
+			if f.Description != "" {
+				fmt.Fprintf(w, "%s\t%s\n", i18n.T("filter.description"), f.Description)
+			}
+			fmt.Fprintf(w, "%s\t%s\n", i18n.T("filter.updated"), f.UpdatedAt.Local().Format(time.DateTime))
+			if err := w.Flush(); err != nil {
+				return err
+			}
+
+			fmt.Println()
+			return printFilterPreview(info.Preview)
+		},
+	}
+
+	cmd.Flags().IntVar(&limit, "limit", 20, "Maximum number of matching files shown (0 = unlimited)")
+	cmd.Flags().StringVarP(&format, "format", "o", "table", "Output format (table, json)")
+
+	return cmd
+}
+
+func NewFilterRemoveCommand() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "rm <path>",
+		Short: "Remove a filter",
+		Long:  "Remove a filter. The files matched by the filter are not affected.",
+		Args:  cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			p, err := filterPath(args[0])
+			if err != nil {
+				return err
+			}
+			ctx := context.Background()
+
+			ms, err := openMetadataStore(ctx)
+			if err != nil {
+				return err
+			}
+			defer ms.Close()
+
+			f, err := ms.GetFilter(ctx, p)
+			if err != nil {
+				return i18n.Errorf("filter.not_found", p)
+			}
+			if err := ms.DeleteFilter(ctx, f.ID); err != nil {
+				return i18n.Errorf("filter.remove_failed", p, err)
+			}
+
+			fmt.Println(i18n.T("filter.removed", p))
+			return nil
+		},
+	}
+
+	return cmd
+}
+
+func NewFilterPreviewCommand() *cobra.Command {
+	var limit int
+	var format string
+
+	cmd := &cobra.Command{
+		Use:   "preview <expression>",
+		Short: "Show the files matching a query without saving it",
+		Args:  cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if format != "table" && format != "json" {
+				return i18n.Errorf("error.unsupported_format", format)
+			}
+			q, err := parseFilter(args[0])
+			if err != nil {
+				return err
+			}
+
+			ctx, cancel := signal.NotifyContext(context.Background(), os.Interrupt)
+			defer cancel()
+
+			ms, err := openMetadataStore(ctx)
+			if err != nil {
+				return err
+			}
+			defer ms.Close()
+
+			preview, err := previewFilter(ctx, ms, q, limit)
+			if err != nil {
+				return err
+			}
+
+			if format == "json" {
+				enc := json.NewEncoder(os.Stdout)
+				enc.SetIndent("", "  ")
+				return enc.Encode(preview)
+			}
+			return printFilterPreview(preview)
+		},
+	}
+
+	cmd.Flags().IntVar(&limit, "limit", 20, "Maximum number of matching files shown (0 = unlimited)")
+	cmd.Flags().StringVarP(&format, "format", "o", "table", "Output format (table, json)")
+
+	return cmd
+}
+
+// filterInfo is the JSON representation of a filter
+type filterInfo struct {
+	Path        string         `json:"path"`
+	Name        string         `json:"name"`
+	Query       string         `json:"query"`
+	Description string         `json:"description,omitempty"`
+	CreatedAt   time.Time      `json:"created_at"`
+	UpdatedAt   time.Time      `json:"updated_at"`
+	Preview     *filterPreview `json:"preview,omitempty"`
+}
+
+func newFilterInfo(f *models.Filter) filterInfo {
+	return filterInfo{
+		Path:        f.VirtualPath,
+		Name:        f.Name,
+		Query:       f.QueryExpression,
+		Description: f.Description,
+		CreatedAt:   f.CreatedAt,
+		UpdatedAt:   f.UpdatedAt,
+	}
+}
+
+// filterPreview contains the number of files matching a query and the first of them
+type filterPreview struct {
+	Query   string         `json:"query"`
+	Matches int            `json:"matches"`
+	Files   []api.FileTags `json:"files"`
+}
+
+// previewFilter evaluates the query, counting all matches but only keeping up to limit files
+func previewFilter(ctx context.Context, ms store.MetadataStore, q *filter.Query, limit int) (*filterPreview, error) {
+	preview := &filterPreview{
+		Query: q.String(),
+		Files: []api.FileTags{},
+	}
+
+	err := filter.Evaluate(ctx, ms, q, func(f *filter.File) error {
+		preview.Matches++
+		if limit <= 0 || len(preview.Files) < limit {
+			preview.Files = append(preview.Files, api.FileTags{
+				Path:       path.Join(f.Backend, f.Path),
+				Size:       f.Size,
+				ModifiedAt: f.ModifiedAt,
+				Tags:       f.Tags,
+			})
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, i18n.Errorf("filter.evaluate_failed", err)
+	}
+	return preview, nil
+}
+
+func printFilterPreview(preview *filterPreview) error {
+	if len(preview.Files) > 0 {
+		if err := printFileTags(preview.Files, "table"); err != nil {
+			return err
+		}
+		fmt.Println()
+	}
+
+	if len(preview.Files) < preview.Matches {
+		fmt.Println(i18n.T("filter.matches_limited", preview.Matches, len(preview.Files)))
+	} else {
+		fmt.Println(i18n.T("filter.matches", preview.Matches))
+	}
+	return nil
+}
+
+// parseFilter parses the query, pointing at the position of syntax errors within the expression
+func parseFilter(expression string) (*filter.Query, error) {
+	q, err := filter.Parse(expression)
+	if err == nil {
+		return q, nil
+	}
+
+	var syntax *filter.SyntaxError
+	if errors.As(err, &syntax) {
+		fmt.Fprintf(os.Stderr, "  %s\n  %s^\n", expression, strings.Repeat(" ", syntax.Pos))
+	}
+	return nil, i18n.Errorf("filter.invalid_query", err)
+}
+
+// filterPath validates and normalizes the path of a filter
+func filterPath(p string) (string, error) {
+	p = strings.Trim(path.Clean("/"+p), "/")
+	if !strings.HasPrefix(p, filter.Root+"/") {
+		return "", i18n.Errorf("filter.invalid_path", p, filter.Root)
+	}
+	return p, nil
+}
@@ -0,0 +1,70 @@
+package client
+
+import (
+	"fmt"
+	"strconv"
+	"time"
+)
+
+// timeLayouts contains all accepted layouts for time flags, parsed in local time
+var timeLayouts = []string{
+	time.RFC3339,
+	"2006-01-02T15:04:05",
+	"2006-01-02T15:04",
+	"2006-01-02 15:04:05",
+	"2006-01-02 15:04",
+	"2006-01-02",
+}
+
+// parseTime parses the provided value as absolute point in time
+func parseTime(value string) (time.Time, error) {
+	for _, layout := range timeLayouts {
+		if t, err := time.ParseInLocation(layout, value, time.Local); err == nil {
+			return t, nil
+		}
+	}
+	return time.Time{}, fmt.Errorf("invalid time '%s' (expected e.g. 2024-05-01T12:00)", value)
+}
+
+// parseSince parses the provided value either as relative duration (e.g. 90m, 7d, 2w)
+// counted back from now, or as absolute point in time.
+func parseSince(value string, now time.Time) (time.Time, error) {
+	if value == "" {
+		return time.Time{}, nil
+	}
+
+	if n := len(value) - 1; n > 0 && (value[n] == 'd' || value[n] == 'w') {
+		if count, err := strconv.Atoi(value[:n]); err == nil {
+			days := count
+			if value[n] == 'w' {
+				days *= 7
+			}
+			return now.AddDate(0, 0, -days), nil
+		}
+	}
+
+	if d, err := time.ParseDuration(value); err == nil {
+		return now.Add(-d), nil
+	}
+
+	return parseTime(value)
+}
+
+// formatSize formats the provided size in bytes, using binary units if human is set
+func formatSize(size int64, human bool) string {
+	if !human {
+		return fmt.Sprintf("%d", size)
+	}
+
+	const unit = 1024
+	if size < unit {
+		return fmt.Sprintf("%dB", size)
+	}
+
+	div, exp := int64(unit), 0
+	for n := size / unit; n >= unit; n /= unit {
+		div *= unit
+		exp++
+	}
+	return fmt.Sprintf("%.1f%c", float64(size)/float64(div), "KMGTPE"[exp])
+}
@@ -0,0 +1,123 @@
+package client
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"os/signal"
+	"text/tabwriter"
+	"time"
+
+	"github.com/mwantia/gosync/internal/api"
+	"github.com/mwantia/gosync/internal/i18n"
+	"github.com/mwantia/gosync/pkg/db/models"
+	"github.com/mwantia/gosync/pkg/engine"
+	"github.com/spf13/cobra"
+)
+
+func NewHistoryCommand() *cobra.Command {
+	var address string
+	var syncName string
+	var clientID string
+	var since string
+	var until string
+	var failed bool
+	var limit int
+	var before uint
+	var format string
+	var human bool
+
+	cmd := &cobra.Command{
+		Use:   "history [path]",
+		Short: "Show the uploads, downloads, deletions and conflicts applied by syncs",
+		Long: `Lists the operations recorded in the transfer log of the agent, the latest first. With a virtual or local path,
+only the operations on the file or the files below the directory are listed. The log is shared by all clients using
+the same database and pruned once it exceeds history.max_size.`,
+		Args: cobra.MaximumNArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if format != "table" && format != "json" {
+				return i18n.Errorf("error.unsupported_format", format)
+			}
+
+			req := api.HistoryRequest{
+				Sync:   syncName,
+				Client: clientID,
+				Failed: failed,
+				Before: before,
+				Limit:  limit,
+			}
+			if len(args) > 0 {
+				req.Path = absTagPath(args[0])
+			}
+
+			var err error
+			now := time.Now()
+			if req.Since, err = parseSince(since, now); err != nil {
+				return err
+			}
+			if req.Until, err = parseSince(until, now); err != nil {
+				return err
+			}
+
+			client, err := newAgentClient(address)
+			if err != nil {
+				return err
+			}
+
+			ctx, cancel := signal.NotifyContext(context.Background(), os.Interrupt)
+			defer cancel()
+
+			transfers, err := client.History(ctx, req)
+			if err != nil {
+				return i18n.Errorf("history.failed", err)
+			}
+
+			if err := printHistory(transfers, format, human); err != nil {
+				return err
+			}
+			if limit > 0 && len(transfers) == limit {
+				fmt.Fprintln(os.Stderr, i18n.T("history.more", transfers[len(transfers)-1].ID))
+			}
+			return nil
+		},
+	}
+
+	cmd.Flags().StringVar(&address, "address", "", "Address of the agent API (defaults to api.address of the configuration)")
+	cmd.Flags().StringVar(&syncName, "sync", "", "Only show operations of this sync")
+	cmd.Flags().StringVar(&clientID, "client", "", "Only show operations applied by this client")
+	cmd.Flags().StringVar(&since, "since", "", "Only show operations finished after this time or duration ago (e.g. 2024-05-01, 7d)")
+	cmd.Flags().StringVar(&until, "until", "", "Only show operations finished before this time or duration ago")
+	cmd.Flags().BoolVar(&failed, "failed", false, "Only show failed operations")
+	cmd.Flags().IntVar(&limit, "limit", 50, "Maximum number of operations shown")
+	cmd.Flags().UintVar(&before, "before", 0, "Continue with the operations older than this ID, as printed by history")
+	cmd.Flags().StringVarP(&format, "format", "o", "table", "Output format (table, json)")
+	cmd.Flags().BoolVarP(&human, "human-readable", "H", false, "Print sizes in human readable format")
+
+	return cmd
+}
+
+func printHistory(transfers []api.Transfer, format string, human bool) error {
+	if format == "json" {
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		return enc.Encode(transfers)
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, i18n.T("history.header"))
+	for _, t := range transfers {
+		// Shows the side the operation wrote to or deleted from
+		p := t.Destination
+		if t.Operation == string(engine.ActionUpload) || t.Operation == string(engine.ActionDeleteSource) {
+			p = t.Source
+		}
+		result := t.Result
+		if t.Result == models.TransferFailed {
+			result += ": " + t.Error
+		}
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\t%s\t%s\n", t.FinishedAt.Local().Format(time.DateTime), t.Sync, t.Client, t.Operation, p,
+			formatSize(t.Bytes, human), result)
+	}
+	return w.Flush()
+}
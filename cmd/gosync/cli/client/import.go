@@ -0,0 +1,114 @@
+package client
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/signal"
+	"strings"
+
+	"github.com/mwantia/gosync/pkg/backend"
+	"github.com/mwantia/gosync/pkg/vfs"
+	"github.com/spf13/cobra"
+)
+
+func NewImportCommand() *cobra.Command {
+	var into string
+	var workers int
+	var dryRun bool
+	var rehash bool
+	var tags []string
+	var rules []string
+
+	cmd := &cobra.Command{
+		Use:   "import <dir> --into <vfs-path>",
+		Short: "Import a local directory into a backend",
+		Long: `Import data copied from an external drive into the virtual filesystem.
+
+All files are hashed and matched against objects already present in the backend,
+so only missing content is uploaded. Content existing under a different path is
+copied server-side instead of being uploaded again.`,
+		Args: cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			path := vfs.ParsePath(into)
+			if path.IsRoot() {
+				return fmt.Errorf("the --into flag must reference a backend path")
+			}
+
+			var tagRules []backend.TagRule
+			for _, tag := range tags {
+				key, value, ok := strings.Cut(tag, "=")
+				if !ok || key == "" {
+					return fmt.Errorf("invalid tag '%s' (expected key=value)", tag)
+				}
+				tagRules = append(tagRules, backend.TagRule{Pattern: "*", Key: key, Value: value})
+			}
+			for _, r := range rules {
+				rule, err := backend.ParseTagRule(r)
+				if err != nil {
+					return err
+				}
+				tagRules = append(tagRules, rule)
+			}
+
+			ctx, cancel := signal.NotifyContext(context.Background(), os.Interrupt)
+			defer cancel()
+
+			ms, err := openMetadataStore(ctx)
+			if err != nil {
+				return err
+			}
+			defer ms.Close()
+
+			if err := checkMaintenance(ctx, ms); err != nil {
+				return err
+			}
+
+			b, err := ms.GetBackend(ctx, path.Backend)
+			if err != nil {
+				return fmt.Errorf("failed to find backend '%s': %w", path.Backend, err)
+			}
+
+			st, flush, err := openStorage(ms, b)
+			if err != nil {
+				return err
+			}
+			defer flush()
+
+			importer := backend.NewImporter(ms, st, b)
+			summary, err := importer.Import(ctx, args[0], path.Key, backend.ImportOptions{
+				Workers: workers,
+				DryRun:  dryRun,
+				Rules:   tagRules,
+				Rehash:  rehash,
+				Progress: func(r backend.ImportResult) {
+					if r.Err != nil {
+						fmt.Printf("%-8s %s: %v\n", r.Action, r.Key, r.Err)
+						return
+					}
+					fmt.Printf("%-8s %s\n", r.Action, r.Key)
+				},
+			})
+
+			fmt.Printf("\nImported %d files (%s): %d uploaded, %d copied, %d skipped, %d failed\n",
+				summary.Files, formatSize(summary.Bytes, true), summary.Uploaded, summary.Copied, summary.Skipped, summary.Failed)
+
+			if err != nil {
+				return err
+			}
+			if summary.Failed > 0 {
+				return fmt.Errorf("failed to import %d files", summary.Failed)
+			}
+			return nil
+		},
+	}
+
+	cmd.Flags().StringVar(&into, "into", "", "Virtual filesystem path to import into (e.g. backend/photos)")
+	cmd.Flags().IntVar(&workers, "workers", 4, "Number of files hashed and transferred in parallel")
+	cmd.Flags().BoolVar(&dryRun, "dry-run", false, "Only print what would be imported")
+	cmd.Flags().BoolVar(&rehash, "rehash", false, "Hash all files again instead of using cached hashes of unchanged files")
+	cmd.Flags().StringArrayVar(&tags, "tag", nil, "Tag applied to all imported files (key=value)")
+	cmd.Flags().StringArrayVar(&rules, "tag-rule", nil, "Tag applied to files matching a pattern (pattern:key=value)")
+
+	return cmd
+}
@@ -0,0 +1,102 @@
+package client
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"text/tabwriter"
+	"time"
+
+	config "github.com/mwantia/gosync/internal/config/server"
+	"github.com/mwantia/gosync/internal/i18n"
+	"github.com/mwantia/gosync/pkg/db/store"
+	"github.com/spf13/cobra"
+)
+
+func NewIndexCommand() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "index",
+		Short: "Inspect and reset search indexers",
+		Long:  "Search indexers push the metadata of all files into Elasticsearch, Meilisearch or Typesense and keep them up to date by following the change feed.",
+	}
+
+	cmd.AddCommand(NewIndexStatusCommand())
+	cmd.AddCommand(NewIndexResetCommand())
+
+	return cmd
+}
+
+func NewIndexStatusCommand() *cobra.Command {
+	return &cobra.Command{
+		Use:   "status",
+		Short: "Show the position of all indexers",
+		Long:  "Show the position of all configured indexers within the change feed and the number of events not yet pushed.",
+		Args:  cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			ctx := context.Background()
+
+			cfg, err := config.LoadServerConfig()
+			if err != nil {
+				return fmt.Errorf("failed to load configuration: %w", err)
+			}
+
+			ms, err := openMetadataStore(ctx)
+			if err != nil {
+				return err
+			}
+			defer ms.Close()
+
+			latest, err := ms.LatestFileEventID(ctx)
+			if err != nil {
+				return fmt.Errorf("failed to read latest file event: %w", err)
+			}
+
+			w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+			fmt.Fprintln(w, i18n.T("index.header"))
+			for _, indexer := range cfg.Indexers {
+				cursor, err := ms.GetIndexCursor(ctx, indexer.Name)
+				if errors.Is(err, store.ErrNotFound) {
+					fmt.Fprintf(w, "%s\t%s\t-\t%d\t-\t%s\n", indexer.Name, indexer.Type, latest, i18n.T("index.pending"))
+					continue
+				}
+				if err != nil {
+					return fmt.Errorf("failed to read position of indexer '%s': %w", indexer.Name, err)
+				}
+
+				lag := uint(0)
+				if latest > cursor.EventID {
+					lag = latest - cursor.EventID
+				}
+				fmt.Fprintf(w, "%s\t%s\t%d\t%d\t%d\t%s\n", indexer.Name, indexer.Type, cursor.EventID, latest, lag,
+					cursor.UpdatedAt.Local().Format(time.DateTime))
+			}
+			return w.Flush()
+		},
+	}
+}
+
+func NewIndexResetCommand() *cobra.Command {
+	return &cobra.Command{
+		Use:   "reset <name>",
+		Short: "Reindex all files",
+		Long:  "Forget the position of the indexer, so all current files are pushed again on its next run.",
+		Args:  cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			ctx := context.Background()
+
+			ms, err := openMetadataStore(ctx)
+			if err != nil {
+				return err
+			}
+			defer ms.Close()
+
+			if err := ms.DeleteIndexCursor(ctx, args[0]); err != nil {
+				return fmt.Errorf("failed to reset indexer '%s': %w", args[0], err)
+			}
+
+			fmt.Println(i18n.T("index.reset", args[0]))
+			return nil
+		},
+	}
+}
@@ -0,0 +1,135 @@
+package client
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/signal"
+	"time"
+
+	"github.com/mwantia/gosync/internal/i18n"
+	"github.com/mwantia/gosync/pkg/backend"
+	"github.com/mwantia/gosync/pkg/vfs"
+	"github.com/spf13/cobra"
+)
+
+func NewBackendListingCommand() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "listing",
+		Short: "Export and import snapshots of remote listings",
+		Long: `Listing snapshots contain the keys, sizes and ETags of all objects of a backend as gzip compressed JSON lines.
+Enumerating a huge bucket once is enough to share its listing between machines or to restore the file records
+after wiping the metadata database, without listing the bucket again.`,
+	}
+
+	cmd.AddCommand(NewBackendListingExportCommand())
+	cmd.AddCommand(NewBackendListingImportCommand())
+
+	return cmd
+}
+
+func NewBackendListingExportCommand() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "export <backend>[/prefix] <file>",
+		Short: "Export the listing of a backend into a file",
+		Long:  "Lists all objects of the backend, optionally limited to a path prefix, and writes them into the file, or to stdout for '-'.",
+		Args:  cobra.ExactArgs(2),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			path := vfs.ParsePath(args[0])
+			if path.IsRoot() {
+				return i18n.Errorf("listing.missing_backend")
+			}
+
+			ctx, cancel := signal.NotifyContext(context.Background(), os.Interrupt)
+			defer cancel()
+
+			ms, err := openMetadataStore(ctx)
+			if err != nil {
+				return err
+			}
+			defer ms.Close()
+
+			b, err := ms.GetBackend(ctx, path.Backend)
+			if err != nil {
+				return i18n.Errorf("listing.not_found", path.Backend)
+			}
+
+			st, flush, err := openStorage(ms, b)
+			if err != nil {
+				return err
+			}
+			defer flush()
+
+			out := os.Stdout
+			if args[1] != "-" {
+				out, err = os.Create(args[1])
+				if err != nil {
+					return i18n.Errorf("listing.create_failed", args[1], err)
+				}
+			}
+
+			summary, err := backend.ExportListing(ctx, st, b, path.Key, out)
+			if out != os.Stdout {
+				if cerr := out.Close(); err == nil {
+					err = cerr
+				}
+				if err != nil {
+					os.Remove(args[1])
+				}
+			}
+			if err != nil {
+				return err
+			}
+
+			fmt.Fprintln(os.Stderr, i18n.T("listing.exported", summary.Objects, formatSize(summary.Bytes, true), args[1]))
+			return nil
+		},
+	}
+
+	return cmd
+}
+
+func NewBackendListingImportCommand() *cobra.Command {
+	var into string
+
+	cmd := &cobra.Command{
+		Use:   "import <file>",
+		Short: "Record the objects of an exported listing",
+		Long: `Records all objects of the listing as files of its backend, or of the backend provided with --into, without
+accessing the backend. Files already recorded with the same ETag keep their recorded hashes, others are replaced.`,
+		Args: cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			ctx, cancel := signal.NotifyContext(context.Background(), os.Interrupt)
+			defer cancel()
+
+			in := os.Stdin
+			if args[0] != "-" {
+				file, err := os.Open(args[0])
+				if err != nil {
+					return i18n.Errorf("listing.open_failed", args[0], err)
+				}
+				defer file.Close()
+				in = file
+			}
+
+			ms, err := openMetadataStore(ctx)
+			if err != nil {
+				return err
+			}
+			defer ms.Close()
+
+			header, summary, err := backend.ImportListing(ctx, ms, in, into)
+			if err != nil {
+				return err
+			}
+
+			fmt.Println(i18n.T("listing.imported", summary.Objects, formatSize(summary.Bytes, true), header.Backend,
+				header.Created.Local().Format(time.DateTime), summary.Imported, summary.Skipped))
+			return nil
+		},
+	}
+
+	cmd.Flags().StringVar(&into, "into", "", "Backend the objects are recorded for (defaults to the backend of the listing)")
+
+	return cmd
+}
@@ -0,0 +1,143 @@
+package client
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"text/tabwriter"
+	"time"
+
+	"github.com/mwantia/gosync/internal/i18n"
+	"github.com/mwantia/gosync/pkg/backend"
+	"github.com/mwantia/gosync/pkg/vfs"
+	"github.com/spf13/cobra"
+)
+
+func NewLockCommand() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "lock",
+		Short: "Manage advisory file locks",
+		Long:  "Acquire, release or list advisory locks, which signal other clients that a file is currently being edited.",
+	}
+
+	cmd.AddCommand(NewLockAcquireCommand())
+	cmd.AddCommand(NewLockReleaseCommand())
+	cmd.AddCommand(NewLockListCommand())
+
+	return cmd
+}
+
+func NewLockAcquireCommand() *cobra.Command {
+	var owner string
+	var ttl time.Duration
+
+	cmd := &cobra.Command{
+		Use:   "acquire <backend>/<path>",
+		Short: "Lock a file for editing",
+		Long:  "Locks a file for editing until the ttl expires. Acquiring a lock already held by the same owner refreshes its expiry.",
+		Args:  cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			path := vfs.ParsePath(args[0])
+			if path.IsRoot() || path.IsBackend() {
+				return i18n.Errorf("error.file_path_required")
+			}
+
+			ctx := context.Background()
+
+			ms, err := openMetadataStore(ctx)
+			if err != nil {
+				return err
+			}
+			defer ms.Close()
+
+			clientID, err := currentClientID(ctx, ms)
+			if err != nil {
+				return err
+			}
+
+			lock, err := backend.NewLocker(ms, path.Backend).Acquire(ctx, path.Key, owner, clientID, ttl)
+			if err != nil {
+				return err
+			}
+
+			fmt.Println(i18n.T("lock.acquired", path, lock.Owner, lock.ExpiresAt.Local().Format(time.DateTime)))
+			return nil
+		},
+	}
+
+	cmd.Flags().StringVar(&owner, "owner", backend.LockOwner(), "Owner of the lock shown to other clients")
+	cmd.Flags().DurationVar(&ttl, "ttl", backend.DefaultLockTTL, "Duration after which the lock expires")
+
+	return cmd
+}
+
+func NewLockReleaseCommand() *cobra.Command {
+	var owner string
+	var force bool
+
+	cmd := &cobra.Command{
+		Use:   "release <backend>/<path>",
+		Short: "Release a file lock",
+		Long:  "Releases the lock of a file. Locks held by other owners can only be released with --force.",
+		Args:  cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			path := vfs.ParsePath(args[0])
+			if path.IsRoot() || path.IsBackend() {
+				return i18n.Errorf("error.file_path_required")
+			}
+
+			ctx := context.Background()
+
+			ms, err := openMetadataStore(ctx)
+			if err != nil {
+				return err
+			}
+			defer ms.Close()
+
+			if err := backend.NewLocker(ms, path.Backend).Release(ctx, path.Key, owner, force); err != nil {
+				return err
+			}
+
+			fmt.Println(i18n.T("lock.released", path))
+			return nil
+		},
+	}
+
+	cmd.Flags().StringVar(&owner, "owner", backend.LockOwner(), "Owner of the lock")
+	cmd.Flags().BoolVarP(&force, "force", "f", false, "Release the lock even if it is held by another owner")
+
+	return cmd
+}
+
+func NewLockListCommand() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "ls <backend>[/prefix]",
+		Short: "List active file locks",
+		Long:  "List all active locks of a backend, optionally limited to a path prefix.",
+		Args:  cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			path := vfs.ParsePath(args[0])
+			ctx := context.Background()
+
+			ms, err := openMetadataStore(ctx)
+			if err != nil {
+				return err
+			}
+			defer ms.Close()
+
+			locks, err := backend.NewLocker(ms, path.Backend).List(ctx, path.Key)
+			if err != nil {
+				return err
+			}
+
+			w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+			fmt.Fprintln(w, i18n.T("lock.header"))
+			for _, lock := range locks {
+				fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\n", lock.Owner, lock.ClientID, lock.AcquiredAt.Local().Format(time.DateTime), lock.ExpiresAt.Local().Format(time.DateTime), lock.Path)
+			}
+			return w.Flush()
+		},
+	}
+
+	return cmd
+}
@@ -0,0 +1,79 @@
+package client
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/mwantia/gosync/internal/api"
+	"github.com/mwantia/gosync/internal/i18n"
+	"github.com/spf13/cobra"
+)
+
+func NewMaintenanceCommand() *cobra.Command {
+	var address string
+	var reason string
+	var format string
+
+	cmd := &cobra.Command{
+		Use:       "maintenance [on|off]",
+		Short:     "Show or toggle the maintenance mode of the running agent",
+		Long:      "In maintenance mode the agent keeps serving its status and API, but doesn't run any sync passes or trash purges, so no backend, local sync root or metadata is changed destructively. The mode is kept across restarts of the agent, and commands changing backends refuse to run on this device while it's enabled. Without argument the current mode is shown.",
+		Args:      cobra.MatchAll(cobra.MaximumNArgs(1), cobra.OnlyValidArgs),
+		ValidArgs: []string{"on", "off"},
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if format != "table" && format != "json" {
+				return i18n.Errorf("error.unsupported_format", format)
+			}
+
+			client, err := newAgentClient(address)
+			if err != nil {
+				return err
+			}
+
+			ctx := context.Background()
+
+			var maintenance *api.Maintenance
+			if len(args) == 0 {
+				maintenance, err = client.Maintenance(ctx)
+			} else {
+				maintenance, err = client.SetMaintenance(ctx, api.MaintenanceRequest{
+					Enabled: args[0] == "on",
+					Reason:  reason,
+				})
+			}
+			if err != nil {
+				return err
+			}
+
+			if format == "json" {
+				enc := json.NewEncoder(os.Stdout)
+				enc.SetIndent("", "  ")
+				return enc.Encode(maintenance)
+			}
+
+			fmt.Println(formatMaintenance(maintenance))
+			return nil
+		},
+	}
+
+	cmd.Flags().StringVar(&address, "address", "", "Address of the agent API (defaults to api.address of the configuration)")
+	cmd.Flags().StringVar(&reason, "reason", "", "Reason shown in the status while the maintenance mode is enabled")
+	cmd.Flags().StringVarP(&format, "format", "o", "table", "Output format (table, json)")
+
+	return cmd
+}
+
+func formatMaintenance(m *api.Maintenance) string {
+	if !m.Enabled {
+		return i18n.T("maintenance.disabled")
+	}
+
+	since := m.Since.Local().Format(time.DateTime)
+	if m.Reason == "" {
+		return i18n.T("maintenance.enabled", since)
+	}
+	return i18n.T("maintenance.enabled_reason", since, m.Reason)
+}
@@ -0,0 +1,161 @@
+package client
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	config "github.com/mwantia/gosync/internal/config/server"
+	"github.com/mwantia/gosync/internal/i18n"
+	"github.com/mwantia/gosync/pkg/db/models"
+	"github.com/mwantia/gosync/pkg/db/store"
+	"github.com/mwantia/gosync/pkg/device"
+	"github.com/mwantia/gosync/pkg/engine"
+	"github.com/mwantia/gosync/pkg/secrets"
+	"github.com/mwantia/gosync/pkg/storage"
+	"github.com/mwantia/gosync/pkg/vfs"
+)
+
+// openMetadataStore opens the metadata store defined in the loaded configuration, unless this device was revoked
+func openMetadataStore(ctx context.Context) (store.MetadataStore, error) {
+	cfg, err := config.LoadServerConfig()
+	if err != nil {
+		return nil, fmt.Errorf("failed to load configuration: %w", err)
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, 10*time.Second)
+	defer cancel()
+
+	ms, err := store.Open(ctx, cfg.Metadata, strings.EqualFold(cfg.Log.Level, "DEBUG"))
+	if err != nil {
+		return nil, err
+	}
+	if err := checkRevoked(ctx, ms); err != nil {
+		ms.Close()
+		return nil, err
+	}
+	return ms, nil
+}
+
+// checkRevoked returns an error if the device the CLI runs on was revoked
+func checkRevoked(ctx context.Context, ms store.MetadataStore) error {
+	machineID, err := device.MachineID()
+	if err != nil {
+		return nil
+	}
+	clients, err := ms.ListClients(ctx)
+	if err != nil {
+		return i18n.Errorf("clients.list_failed", err)
+	}
+
+	if client := device.Lookup(clients, machineID); client != nil && client.RevokedAt != nil {
+		reason := client.RevokedReason
+		if reason == "" {
+			reason = "-"
+		}
+		return i18n.Errorf("devices.revoked", client.ID, client.RevokedAt.Local().Format(time.DateTime), reason, client.ID)
+	}
+	return nil
+}
+
+// checkMaintenance returns an error if the agent of this device is in maintenance mode, which write-capable
+// commands respect like the agent itself, so no backend is changed while the mode is set
+func checkMaintenance(ctx context.Context, ms store.MetadataStore) error {
+	clientID, err := currentClientID(ctx, ms)
+	if err != nil {
+		return err
+	}
+	maintenance, err := ms.GetMaintenance(ctx, clientID)
+	if errors.Is(err, store.ErrNotFound) {
+		return nil
+	}
+	if err != nil {
+		return i18n.Errorf("maintenance.check_failed", err)
+	}
+
+	reason := maintenance.Reason
+	if reason == "" {
+		reason = "-"
+	}
+	return i18n.Errorf("maintenance.refused", maintenance.Since.Local().Format(time.DateTime), reason)
+}
+
+// currentClientID returns the id of the client the agent of this device runs as, see device.ClientID
+func currentClientID(ctx context.Context, ms store.MetadataStore) (string, error) {
+	hostname, err := os.Hostname()
+	if err != nil {
+		return "", i18n.Errorf("error.client_id", err)
+	}
+	machineID, err := device.MachineID()
+	if err != nil {
+		return "", i18n.Errorf("error.client_id", err)
+	}
+	clients, err := ms.ListClients(ctx)
+	if err != nil {
+		return "", i18n.Errorf("clients.list_failed", err)
+	}
+	return device.ClientID(clients, machineID, hostname), nil
+}
+
+// openStorage opens the storage of the backend and meters its bandwidth usage;
+// the returned flush persists the usage and closes the storage, so it must be called once all operations are done
+func openStorage(ms store.MetadataStore, b *models.Backend) (storage.Storage, func(), error) {
+	cfg, err := config.LoadServerConfig()
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to load configuration: %w", err)
+	}
+
+	resolver, err := secrets.NewResolver(cfg.Secrets)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	meter := storage.NewMeter(ms)
+	meter.SetSecretResolver(resolver)
+
+	st, err := meter.Open(b)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return st, func() {
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+
+		if err := meter.Flush(ctx); err != nil {
+			fmt.Fprintf(os.Stderr, "Failed to record bandwidth usage: %v\n", err)
+		}
+		storage.Close(st)
+	}, nil
+}
+
+// openPath opens the storage of a local directory or the backend of a virtual path, returning the prefix of the path
+// within it (either empty or ending with "/"); the returned flush must be called once all operations are done
+func openPath(ctx context.Context, ms store.MetadataStore, arg string) (storage.Storage, string, *models.Backend, func(), error) {
+	if engine.IsLocalPath(arg) {
+		st, err := storage.NewLocalStorage(&models.Backend{Type: storage.TypeLocal, Endpoint: arg})
+		if err != nil {
+			return nil, "", nil, nil, err
+		}
+		return st, "", nil, func() {}, nil
+	}
+
+	vp := vfs.ParsePath(arg)
+	b, err := ms.GetBackend(ctx, vp.Backend)
+	if err != nil {
+		return nil, "", nil, nil, i18n.Errorf("sync.backend_not_found", vp.Backend, err)
+	}
+	st, flush, err := openStorage(ms, b)
+	if err != nil {
+		return nil, "", nil, nil, err
+	}
+
+	prefix := ""
+	if vp.Key != "" {
+		prefix = strings.TrimSuffix(vp.Key, "/") + "/"
+	}
+	return st, prefix, b, flush, nil
+}
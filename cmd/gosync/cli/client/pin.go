@@ -0,0 +1,189 @@
+package client
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/mwantia/gosync/internal/i18n"
+	"github.com/mwantia/gosync/pkg/db/models"
+	"github.com/mwantia/gosync/pkg/db/store"
+	"github.com/mwantia/gosync/pkg/engine"
+	"github.com/spf13/cobra"
+)
+
+func NewPinCommand() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "pin [path]",
+		Short: "Keep files of a sync with files on demand available offline",
+		Long: `Pins a local file or directory of a sync created with --on-demand, so the next pass downloads the content of
+all placeholders below it and keeps them downloaded. Without a path, the pinned and unpinned paths of this device are listed.`,
+		Args: cobra.MaximumNArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			ctx := context.Background()
+
+			ms, err := openMetadataStore(ctx)
+			if err != nil {
+				return err
+			}
+			defer ms.Close()
+
+			if len(args) == 0 {
+				return listPins(ctx, ms)
+			}
+
+			sc, rel, clientID, err := onDemandSync(ctx, ms, args[0])
+			if err != nil {
+				return err
+			}
+			if err := savePin(ctx, ms, sc, clientID, rel, true); err != nil {
+				return err
+			}
+
+			fmt.Println(i18n.T("pin.pinned", "/"+rel, sc.Name))
+			return nil
+		},
+	}
+
+	return cmd
+}
+
+func NewUnpinCommand() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "unpin <path>",
+		Short: "Free up the space of files of a sync with files on demand",
+		Long: `Unpins a local file or directory of a sync created with --on-demand, so the next pass replaces all unchanged files
+below it with placeholders again. Files that were changed locally are kept until they are synced.`,
+		Args: cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			ctx := context.Background()
+
+			ms, err := openMetadataStore(ctx)
+			if err != nil {
+				return err
+			}
+			defer ms.Close()
+
+			sc, rel, clientID, err := onDemandSync(ctx, ms, args[0])
+			if err != nil {
+				return err
+			}
+
+			pins, err := ms.ListSyncPins(ctx, sc.ID, clientID)
+			if err != nil {
+				return i18n.Errorf("pin.list_failed", err)
+			}
+			// Paths below a pinned directory can't be unpinned on their own, since the directory is downloaded again
+			for _, pin := range pins {
+				if pin.Pinned && pin.Path != rel && (pin.Path == "" || strings.HasPrefix(rel, pin.Path+"/")) {
+					return i18n.Errorf("pin.inherited", "/"+rel, "/"+pin.Path)
+				}
+			}
+
+			if err := savePin(ctx, ms, sc, clientID, rel, false); err != nil {
+				return err
+			}
+
+			fmt.Println(i18n.T("pin.unpinned", "/"+rel, sc.Name))
+			return nil
+		},
+	}
+
+	return cmd
+}
+
+// savePin replaces the pins below the path with a single pin of the path
+func savePin(ctx context.Context, ms store.MetadataStore, sc *models.SyncConfig, clientID, rel string, pinned bool) error {
+	pins, err := ms.ListSyncPins(ctx, sc.ID, clientID)
+	if err != nil {
+		return i18n.Errorf("pin.list_failed", err)
+	}
+	for _, pin := range pins {
+		if rel == "" || pin.Path == rel || strings.HasPrefix(pin.Path, rel+"/") {
+			if err := ms.DeleteSyncPin(ctx, sc.ID, clientID, pin.Path); err != nil {
+				return i18n.Errorf("pin.failed", err)
+			}
+		}
+	}
+
+	err = ms.SaveSyncPin(ctx, &models.SyncPin{
+		SyncConfigID: sc.ID,
+		ClientID:     clientID,
+		Path:         rel,
+		Pinned:       pinned,
+	})
+	if err != nil {
+		return i18n.Errorf("pin.failed", err)
+	}
+	return nil
+}
+
+// listPins prints the pinned paths and the unpinned paths not yet replaced by placeholders of this device
+func listPins(ctx context.Context, ms store.MetadataStore) error {
+	clientID, err := currentClientID(ctx, ms)
+	if err != nil {
+		return err
+	}
+	syncs, err := ms.ListSyncConfigs(ctx)
+	if err != nil {
+		return i18n.Errorf("sync.list_failed", err)
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, i18n.T("pin.header"))
+	for _, sc := range syncs {
+		if !sc.OnDemand {
+			continue
+		}
+		pins, err := ms.ListSyncPins(ctx, sc.ID, clientID)
+		if err != nil {
+			return i18n.Errorf("pin.list_failed", err)
+		}
+		for _, pin := range pins {
+			state := i18n.T("pin.state_pinned")
+			if !pin.Pinned {
+				state = i18n.T("pin.state_unpinned")
+			}
+			fmt.Fprintf(w, "%s\t/%s\t%s\n", sc.Name, pin.Path, state)
+		}
+	}
+	return w.Flush()
+}
+
+// onDemandSync returns the sync with files on demand whose local directory contains the path on this device,
+// together with the path relative to the sync and the client id of this device
+func onDemandSync(ctx context.Context, ms store.MetadataStore, arg string) (*models.SyncConfig, string, string, error) {
+	name, err := filepath.Abs(arg)
+	if err != nil {
+		return nil, "", "", err
+	}
+	clientID, err := currentClientID(ctx, ms)
+	if err != nil {
+		return nil, "", "", err
+	}
+	syncs, err := ms.ListSyncConfigs(ctx)
+	if err != nil {
+		return nil, "", "", i18n.Errorf("sync.list_failed", err)
+	}
+
+	for i := range syncs {
+		sc := &syncs[i]
+		_, dest := engine.ResolvePaths(sc, clientID)
+		if !sc.OnDemand || !engine.IsLocalPath(dest) {
+			continue
+		}
+		root, err := filepath.Abs(dest)
+		if err != nil {
+			continue
+		}
+		rel, err := filepath.Rel(root, name)
+		if err != nil || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+			continue
+		}
+		return sc, engine.CleanSelectionPath(filepath.ToSlash(rel)), clientID, nil
+	}
+	return nil, "", "", i18n.Errorf("pin.no_sync", name)
+}
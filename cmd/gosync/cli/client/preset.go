@@ -0,0 +1,76 @@
+package client
+
+import (
+	"fmt"
+	"path"
+	"sort"
+	"strings"
+
+	"github.com/mwantia/gosync/pkg/db/models"
+	"github.com/mwantia/gosync/pkg/engine"
+	"github.com/mwantia/gosync/pkg/knownfolder"
+)
+
+// syncPreset describes a template for mirroring a known folder into a per-device prefix
+type syncPreset struct {
+	Folder    knownfolder.Folder
+	Direction string
+	Interval  int64
+	Ignore    []string
+}
+
+// syncPresets are the templates available with `sync create --preset`
+var syncPresets = map[string]syncPreset{
+	"documents": {
+		Folder:    knownfolder.Documents,
+		Direction: engine.DirectionBidirectional,
+		Interval:  300,
+		Ignore:    []string{"~$*", "*.tmp", ".~lock.*#", "desktop.ini", ".DS_Store", "Thumbs.db"},
+	},
+	"pictures": {
+		// Pictures are backed up, so deleting them on another device doesn't remove the local copies
+		Folder:    knownfolder.Pictures,
+		Direction: engine.DirectionUpload,
+		Interval:  3600,
+		Ignore:    []string{"desktop.ini", ".DS_Store", "Thumbs.db", ".thumbnails"},
+	},
+	"desktop": {
+		Folder:    knownfolder.Desktop,
+		Direction: engine.DirectionBidirectional,
+		Interval:  300,
+		Ignore:    []string{"*.lnk", "*.url", "desktop.ini", ".DS_Store", "*.desktop"},
+	},
+}
+
+// presetNames returns the sorted names of all presets
+func presetNames() []string {
+	names := make([]string, 0, len(syncPresets))
+	for name := range syncPresets {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// newPresetSyncConfig creates the sync of the preset, mirroring the known folder into <backend>/<prefix>/<device>/<Folder>
+func newPresetSyncConfig(name, backendID, prefix, device string) (*models.SyncConfig, error) {
+	preset, ok := syncPresets[name]
+	if !ok {
+		return nil, fmt.Errorf("unknown preset '%s' (available: %s)", name, strings.Join(presetNames(), ", "))
+	}
+
+	local, err := knownfolder.Path(preset.Folder)
+	if err != nil {
+		return nil, err
+	}
+
+	return &models.SyncConfig{
+		Name:          fmt.Sprintf("%s-%s", device, name),
+		SourcePath:    path.Join(backendID, prefix, device, preset.Folder.Name()),
+		DestPath:      local,
+		Direction:     preset.Direction,
+		Enabled:       true,
+		Interval:      preset.Interval,
+		IgnorePattern: strings.Join(preset.Ignore, ","),
+	}, nil
+}
@@ -0,0 +1,189 @@
+package client
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/mwantia/gosync/internal/i18n"
+)
+
+// plainProgressInterval limits how often progress lines are written if the output isn't a terminal
+const plainProgressInterval = 5 * time.Second
+
+// progressLabelWidth is the maximum width of the labels of individual progress bars
+const progressLabelWidth = 40
+
+// progressItem is a single bar of a progress display
+type progressItem struct {
+	Label   string
+	Current int64
+	Total   int64
+	// Bytes formats current and total as sizes instead of counts
+	Bytes bool
+}
+
+// progressDisplay renders an overall progress bar and one bar per parallel transfer.
+// If the output isn't a terminal, it falls back to printing a plain line every few seconds.
+type progressDisplay struct {
+	out     io.Writer
+	tty     bool
+	started time.Time
+
+	lines     int
+	lastPlain time.Time
+	speeds    map[string]*progressSpeed
+}
+
+// progressSpeed tracks a smoothed rate of a progress item
+type progressSpeed struct {
+	current int64
+	at      time.Time
+	rate    float64
+}
+
+func newProgressDisplay() *progressDisplay {
+	return &progressDisplay{
+		out:     os.Stdout,
+		tty:     isTerminal(os.Stdout),
+		started: time.Now(),
+		speeds:  make(map[string]*progressSpeed),
+	}
+}
+
+// isTerminal returns true if the file is an interactive terminal
+func isTerminal(f *os.File) bool {
+	info, err := f.Stat()
+	return err == nil && info.Mode()&os.ModeCharDevice != 0
+}
+
+// Update renders the current progress, replacing the previous render on terminals
+func (d *progressDisplay) Update(overall progressItem, items []progressItem) {
+	now := time.Now()
+	rate := d.rate("", overall.Current, now)
+
+	eta := i18n.T("progress.eta_unknown")
+	if rate > 0 && overall.Total > overall.Current {
+		eta = time.Duration(float64(overall.Total-overall.Current) / rate * float64(time.Second)).Round(time.Second).String()
+	}
+
+	if !d.tty {
+		if now.Sub(d.lastPlain) < plainProgressInterval {
+			return
+		}
+		d.lastPlain = now
+
+		fmt.Fprintf(d.out, "%s %5.1f%%  %s  %s  %s\n", overall.Label, fraction(overall)*100,
+			formatProgress(overall), formatRate(rate, overall.Bytes), i18n.T("progress.eta", eta))
+		return
+	}
+
+	var b strings.Builder
+	if d.lines > 0 {
+		// Move the cursor to the start of the previous render
+		fmt.Fprintf(&b, "\033[%dA", d.lines)
+	}
+
+	fmt.Fprintf(&b, "\033[2K%s %s %5.1f%%  %s  %s  %s\n", overall.Label, progressBar(fraction(overall)), fraction(overall)*100,
+		formatProgress(overall), formatRate(rate, overall.Bytes), i18n.T("progress.eta", eta))
+
+	seen := make(map[string]bool, len(items))
+	for _, item := range items {
+		seen[item.Label] = true
+		fmt.Fprintf(&b, "\033[2K  %-*s %s %5.1f%%  %s  %s\n", progressLabelWidth, truncateLabel(item.Label), progressBar(fraction(item)), fraction(item)*100,
+			formatProgress(item), formatRate(d.rate(item.Label, item.Current, now), item.Bytes))
+	}
+
+	// Clear leftover lines of transfers that finished since the previous render
+	lines := 1 + len(items)
+	for i := lines; i < d.lines; i++ {
+		b.WriteString("\033[2K\n")
+	}
+	if d.lines > lines {
+		fmt.Fprintf(&b, "\033[%dA", d.lines-lines)
+	}
+	d.lines = lines
+
+	for label := range d.speeds {
+		if label != "" && !seen[label] {
+			delete(d.speeds, label)
+		}
+	}
+
+	io.WriteString(d.out, b.String())
+}
+
+// Finish removes the bars of individual transfers, keeping the overall progress on terminals
+func (d *progressDisplay) Finish() {
+	if !d.tty || d.lines <= 1 {
+		return
+	}
+
+	fmt.Fprintf(d.out, "\033[%dA", d.lines-1)
+	for i := 1; i < d.lines; i++ {
+		io.WriteString(d.out, "\033[2K\n")
+	}
+	fmt.Fprintf(d.out, "\033[%dA", d.lines-1)
+	d.lines = 1
+}
+
+// rate returns the smoothed rate per second of the item identified by the label
+func (d *progressDisplay) rate(label string, current int64, now time.Time) float64 {
+	speed, ok := d.speeds[label]
+	if !ok {
+		// The overall rate is measured since the display was created
+		if label != "" {
+			d.speeds[label] = &progressSpeed{current: current, at: now}
+			return 0
+		}
+		speed = &progressSpeed{at: d.started}
+		d.speeds[label] = speed
+	}
+
+	elapsed := now.Sub(speed.at).Seconds()
+	if elapsed < 0.5 {
+		return speed.rate
+	}
+
+	rate := float64(current-speed.current) / elapsed
+	if speed.rate == 0 {
+		speed.rate = rate
+	} else {
+		speed.rate = 0.3*rate + 0.7*speed.rate
+	}
+	speed.current = current
+	speed.at = now
+	return speed.rate
+}
+
+func fraction(item progressItem) float64 {
+	if item.Total <= 0 {
+		return 0
+	}
+	return min(float64(item.Current)/float64(item.Total), 1)
+}
+
+func formatProgress(item progressItem) string {
+	if item.Bytes {
+		return formatSize(item.Current, true) + "/" + formatSize(item.Total, true)
+	}
+	return fmt.Sprintf("%d/%d", item.Current, item.Total)
+}
+
+func formatRate(rate float64, bytes bool) string {
+	if bytes {
+		return formatSize(int64(rate), true) + "/s"
+	}
+	return fmt.Sprintf("%.1f/s", rate)
+}
+
+// truncateLabel shortens long labels from the left, since the end of a path is most significant
+func truncateLabel(label string) string {
+	runes := []rune(label)
+	if len(runes) <= progressLabelWidth {
+		return label
+	}
+	return "..." + string(runes[len(runes)-progressLabelWidth+3:])
+}
@@ -0,0 +1,130 @@
+package client
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"os/signal"
+	"text/tabwriter"
+	"time"
+
+	"github.com/mwantia/gosync/internal/i18n"
+	"github.com/mwantia/gosync/pkg/publish"
+	"github.com/spf13/cobra"
+)
+
+func NewPublishCommand() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "publish",
+		Short: "Manage the signing key of published syncs and verify published mirrors",
+		Long: `Syncs created with --publish write a manifest of all their files with sizes and SHA256 hashes to
+<prefix>/.gosync-manifest.json after each upload pass, signed with the ed25519 key publish.signing_key
+of the agent configuration. Consumers verify a mirror with the public key, without trusting its listings.`,
+	}
+
+	cmd.AddCommand(NewPublishKeygenCommand())
+	cmd.AddCommand(NewPublishVerifyCommand())
+
+	return cmd
+}
+
+func NewPublishKeygenCommand() *cobra.Command {
+	return &cobra.Command{
+		Use:   "keygen",
+		Short: "Generate a new key pair for signing manifests",
+		Args:  cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			private, public, err := publish.GenerateKey()
+			if err != nil {
+				return err
+			}
+			fmt.Println(i18n.T("publish.keygen", private, public))
+			return nil
+		},
+	}
+}
+
+func NewPublishVerifyCommand() *cobra.Command {
+	var key string
+	var hash bool
+	var format string
+
+	cmd := &cobra.Command{
+		Use:   "verify <backend/path|local path> --key <public key>",
+		Short: "Verify a published mirror against its signed manifest",
+		Long: `Reads the manifest of a mirror below a virtual path or a local copy of it and verifies its signature
+with the trusted public key. Each file of the manifest is then looked up by its path instead of listing the
+mirror, so files that are missing or were truncated are reported even if listings are incomplete.
+With --hash all files are also downloaded and compared with their SHA256.
+
+Files that aren't part of the manifest are ignored. The command fails if anything is reported.`,
+		Args: cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if format != "table" && format != "json" {
+				return i18n.Errorf("error.unsupported_format", format)
+			}
+
+			trusted, err := publish.ParsePublicKey(key)
+			if err != nil {
+				return i18n.Errorf("publish.invalid_key", err)
+			}
+
+			ctx, cancel := signal.NotifyContext(context.Background(), os.Interrupt)
+			defer cancel()
+
+			ms, err := openMetadataStore(ctx)
+			if err != nil {
+				return err
+			}
+			defer ms.Close()
+
+			st, prefix, _, flush, err := openPath(ctx, ms, args[0])
+			if err != nil {
+				return err
+			}
+			defer flush()
+
+			manifest, err := publish.Read(ctx, st, prefix, trusted)
+			if err != nil {
+				return i18n.Errorf("publish.read_failed", err)
+			}
+			report, err := publish.Check(ctx, st, prefix, manifest, hash)
+			if err != nil {
+				return err
+			}
+
+			if format == "json" {
+				enc := json.NewEncoder(os.Stdout)
+				enc.SetIndent("", "  ")
+				if err := enc.Encode(report); err != nil {
+					return err
+				}
+			} else {
+				if len(report.Findings) > 0 {
+					w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+					fmt.Fprintln(w, i18n.T("publish.header"))
+					for _, f := range report.Findings {
+						fmt.Fprintf(w, "%s\t%s\t%s\n", f.Status, f.Path, f.Detail)
+					}
+					if err := w.Flush(); err != nil {
+						return err
+					}
+				}
+				fmt.Println(i18n.T("publish.summary", report.Sync, report.GeneratedAt.Local().Format(time.DateTime),
+					report.Files, report.Hashed, formatSize(report.Bytes, true), len(report.Findings)))
+			}
+
+			if len(report.Findings) > 0 {
+				return i18n.Errorf("publish.failed", len(report.Findings))
+			}
+			return nil
+		},
+	}
+
+	cmd.Flags().StringVar(&key, "key", "", "Trusted base64 encoded ed25519 public key of the publisher (see \"gosync publish keygen\")")
+	cmd.Flags().BoolVar(&hash, "hash", false, "Download all files and compare their SHA256 with the manifest")
+	cmd.Flags().StringVarP(&format, "format", "o", "table", "Output format (table, json)")
+
+	return cmd
+}
@@ -0,0 +1,77 @@
+package client
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"os/signal"
+
+	"github.com/mwantia/gosync/pkg/backend"
+	"github.com/mwantia/gosync/pkg/storage"
+	"github.com/mwantia/gosync/pkg/vfs"
+	"github.com/spf13/cobra"
+)
+
+func NewQueryCommand() *cobra.Command {
+	var opts storage.SelectOptions
+
+	cmd := &cobra.Command{
+		Use:   "query <backend>/<path> <expression>",
+		Short: "Query the content of structured objects server-side",
+		Long: `Run an SQL expression against a CSV, JSON or Parquet object through its backend
+(S3 Select) and stream the matching records, so only the results are transferred.
+
+The format and compression are detected from the extension if not set,
+e.g. "logs/2024.csv.gz" is read as gzipped CSV. Records are returned in the
+input format, or as JSON lines for Parquet objects.`,
+		Args: cobra.ExactArgs(2),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			path := vfs.ParsePath(args[0])
+			if path.IsRoot() || path.IsBackend() {
+				return fmt.Errorf("'%s' doesn't reference an object", args[0])
+			}
+			opts.Expression = args[1]
+
+			ctx, cancel := signal.NotifyContext(context.Background(), os.Interrupt)
+			defer cancel()
+
+			ms, err := openMetadataStore(ctx)
+			if err != nil {
+				return err
+			}
+			defer ms.Close()
+
+			b, err := ms.GetBackend(ctx, path.Backend)
+			if err != nil {
+				return fmt.Errorf("failed to find backend '%s': %w", path.Backend, err)
+			}
+
+			st, flush, err := openStorage(ms, b)
+			if err != nil {
+				return err
+			}
+			defer flush()
+
+			reader, err := backend.NewQuery(ms, st, b).Select(ctx, path.Key, opts)
+			if err != nil {
+				return err
+			}
+			defer reader.Close()
+
+			if _, err := io.Copy(os.Stdout, reader); err != nil {
+				return fmt.Errorf("failed to stream query results: %w", err)
+			}
+			return nil
+		},
+	}
+
+	cmd.Flags().StringVar(&opts.Format, "format", "", "Format of the object (csv, json, parquet), detected from the extension if empty")
+	cmd.Flags().StringVar(&opts.Compression, "compression", "", "Compression of the object (none, gzip, bzip2), detected from the extension if empty")
+	cmd.Flags().StringVar(&opts.CSVHeader, "header", "use", "First line of CSV objects (use as column names, ignore, none)")
+	cmd.Flags().StringVar(&opts.CSVDelimiter, "delimiter", "", "Field delimiter of CSV objects (default \",\")")
+	cmd.Flags().BoolVar(&opts.JSONLines, "json-lines", false, "Read JSON objects as one document per line")
+	cmd.Flags().StringVar(&opts.Output, "output", "", "Format of the returned records (csv, json)")
+
+	return cmd
+}
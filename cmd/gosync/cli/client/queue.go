@@ -0,0 +1,164 @@
+package client
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"strconv"
+	"text/tabwriter"
+
+	"github.com/mwantia/gosync/internal/api"
+	"github.com/mwantia/gosync/internal/i18n"
+	"github.com/mwantia/gosync/pkg/engine"
+	"github.com/spf13/cobra"
+)
+
+func NewQueueCommand() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "queue",
+		Short: "Inspect and reorder the queued transfers of the running agent",
+		Long: `Each pass starts its transfers in the queue order of its sync (--queue-order of "sync create"),
+while free workers are shared between all syncs by their weight. Queued transfers can be moved ahead
+or removed from their pass until they are started.`,
+	}
+
+	cmd.AddCommand(NewQueueListCommand())
+	cmd.AddCommand(NewQueuePrioritizeCommand())
+	cmd.AddCommand(NewQueueCancelCommand())
+
+	return cmd
+}
+
+func NewQueueListCommand() *cobra.Command {
+	var address string
+	var format string
+
+	cmd := &cobra.Command{
+		Use:   "ls",
+		Short: "List the queued transfers of all running passes",
+		Long:  "Lists the transfers waiting in the queues of all running passes, in the order they are started.",
+		Args:  cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if format != "table" && format != "json" {
+				return i18n.Errorf("error.unsupported_format", format)
+			}
+
+			client, err := newAgentClient(address)
+			if err != nil {
+				return err
+			}
+
+			queue, err := client.Queue(context.Background())
+			if err != nil {
+				return err
+			}
+			return printQueue(queue, format)
+		},
+	}
+
+	cmd.Flags().StringVar(&address, "address", "", "Address of the agent API (defaults to api.address of the configuration)")
+	cmd.Flags().StringVarP(&format, "format", "o", "table", "Output format (table, json)")
+
+	return cmd
+}
+
+func NewQueuePrioritizeCommand() *cobra.Command {
+	var address string
+	var format string
+
+	cmd := &cobra.Command{
+		Use:   "prioritize <id> <priority>",
+		Short: "Change the priority of a queued transfer",
+		Long:  "Transfers with a higher priority are started before all other queued transfers of their pass. Transfers keep the default priority 0 until they are prioritized, negative priorities move them behind all others.",
+		Args:  cobra.ExactArgs(2),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if format != "table" && format != "json" {
+				return i18n.Errorf("error.unsupported_format", format)
+			}
+
+			id, err := strconv.ParseUint(args[0], 10, 64)
+			if err != nil {
+				return i18n.Errorf("queue.invalid_id", args[0])
+			}
+			priority, err := strconv.Atoi(args[1])
+			if err != nil {
+				return i18n.Errorf("queue.invalid_priority", args[1])
+			}
+
+			client, err := newAgentClient(address)
+			if err != nil {
+				return err
+			}
+
+			queue, err := client.PrioritizeTransfer(context.Background(), id, api.QueueRequest{Priority: priority})
+			if err != nil {
+				return i18n.Errorf("queue.prioritize_failed", id, err)
+			}
+			return printQueue(queue, format)
+		},
+	}
+
+	cmd.Flags().StringVar(&address, "address", "", "Address of the agent API (defaults to api.address of the configuration)")
+	cmd.Flags().StringVarP(&format, "format", "o", "table", "Output format (table, json)")
+
+	return cmd
+}
+
+func NewQueueCancelCommand() *cobra.Command {
+	var address string
+	var format string
+
+	cmd := &cobra.Command{
+		Use:   "cancel <id>",
+		Short: "Remove a transfer from the queue of its pass",
+		Long:  "Cancelled transfers aren't applied by the running pass. Their paths stay unsynced, so the next pass of the sync plans them again.",
+		Args:  cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if format != "table" && format != "json" {
+				return i18n.Errorf("error.unsupported_format", format)
+			}
+
+			id, err := strconv.ParseUint(args[0], 10, 64)
+			if err != nil {
+				return i18n.Errorf("queue.invalid_id", args[0])
+			}
+
+			client, err := newAgentClient(address)
+			if err != nil {
+				return err
+			}
+
+			queue, err := client.CancelTransfer(context.Background(), id)
+			if err != nil {
+				return i18n.Errorf("queue.cancel_failed", id, err)
+			}
+			return printQueue(queue, format)
+		},
+	}
+
+	cmd.Flags().StringVar(&address, "address", "", "Address of the agent API (defaults to api.address of the configuration)")
+	cmd.Flags().StringVarP(&format, "format", "o", "table", "Output format (table, json)")
+
+	return cmd
+}
+
+func printQueue(queue []engine.QueuedTransfer, format string) error {
+	if format == "json" {
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		return enc.Encode(queue)
+	}
+
+	if len(queue) == 0 {
+		fmt.Println(i18n.T("queue.empty"))
+		return nil
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, i18n.T("queue.header"))
+	for _, t := range queue {
+		fmt.Fprintf(w, "%d\t%s\t%d\t%s\t%s\t%d\t%s\n", t.ID, t.Sync, t.Position, t.Type, formatSize(t.Size, true), t.Priority, t.Path)
+	}
+	return w.Flush()
+}
@@ -0,0 +1,242 @@
+package client
+
+import (
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"os"
+	"strconv"
+	"text/tabwriter"
+	"time"
+
+	"github.com/mwantia/gosync/internal/i18n"
+	"github.com/mwantia/gosync/pkg/db/models"
+	"github.com/spf13/cobra"
+)
+
+func NewReportCommand() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "report",
+		Short: "Report usage statistics",
+	}
+
+	cmd.AddCommand(newReportBandwidthCommand())
+	cmd.AddCommand(newReportActivityCommand())
+
+	return cmd
+}
+
+type bandwidthRow struct {
+	Backend         string `json:"backend"`
+	Month           string `json:"month"`
+	BytesUploaded   int64  `json:"bytes_uploaded"`
+	BytesDownloaded int64  `json:"bytes_downloaded"`
+	APICalls        int64  `json:"api_calls"`
+}
+
+func newReportBandwidthCommand() *cobra.Command {
+	var backendID string
+	var months int
+	var format string
+	var human bool
+
+	cmd := &cobra.Command{
+		Use:   "bandwidth",
+		Short: "Report transferred bytes and API calls per backend and month",
+		Long:  "Lists the monthly uploaded and downloaded bytes and API calls of each backend, to keep track of the spend on egress-billed providers.",
+		Args:  cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if months < 1 {
+				return fmt.Errorf("--months must be at least 1")
+			}
+
+			ctx := context.Background()
+
+			ms, err := openMetadataStore(ctx)
+			if err != nil {
+				return err
+			}
+			defer ms.Close()
+
+			now := time.Now().UTC()
+			from := time.Date(now.Year(), now.Month()-time.Month(months-1), 1, 0, 0, 0, 0, time.UTC)
+
+			usages, err := ms.ListBandwidthUsage(ctx, backendID, from.Format("2006-01"), "")
+			if err != nil {
+				return fmt.Errorf("failed to list bandwidth usage: %w", err)
+			}
+
+			return printBandwidth(usages, format, human)
+		},
+	}
+
+	cmd.Flags().StringVarP(&backendID, "backend", "b", "", "Only report usage of this backend")
+	cmd.Flags().IntVar(&months, "months", 12, "Number of calendar months to report, including the current one")
+	cmd.Flags().StringVarP(&format, "format", "o", "table", "Output format (table, json, csv)")
+	cmd.Flags().BoolVarP(&human, "human-readable", "H", false, "Print sizes in human readable format")
+
+	return cmd
+}
+
+func printBandwidth(usages []models.BandwidthUsage, format string, human bool) error {
+	switch format {
+	case "json":
+		rows := make([]bandwidthRow, 0, len(usages))
+		for _, u := range usages {
+			rows = append(rows, bandwidthRow{
+				Backend:         u.BackendID,
+				Month:           u.Month,
+				BytesUploaded:   u.BytesUploaded,
+				BytesDownloaded: u.BytesDownloaded,
+				APICalls:        u.APICalls,
+			})
+		}
+
+		encoder := json.NewEncoder(os.Stdout)
+		encoder.SetIndent("", "    ")
+		return encoder.Encode(rows)
+
+	case "csv":
+		w := csv.NewWriter(os.Stdout)
+		w.Write([]string{"backend", "month", "bytes_uploaded", "bytes_downloaded", "api_calls"})
+		for _, u := range usages {
+			w.Write([]string{u.BackendID, u.Month, strconv.FormatInt(u.BytesUploaded, 10), strconv.FormatInt(u.BytesDownloaded, 10), strconv.FormatInt(u.APICalls, 10)})
+		}
+		w.Flush()
+		return w.Error()
+
+	case "table":
+		w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(w, i18n.T("report.bandwidth_header"))
+		for _, u := range usages {
+			fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%d\n", u.Month, u.BackendID, formatSize(u.BytesUploaded, human), formatSize(u.BytesDownloaded, human), u.APICalls)
+		}
+		return w.Flush()
+
+	default:
+		return fmt.Errorf("unsupported output format '%s'", format)
+	}
+}
+
+type activityRow struct {
+	Day       string `json:"day"`
+	Sync      string `json:"sync"`
+	Client    string `json:"client"`
+	Passes    int64  `json:"passes"`
+	Added     int64  `json:"added"`
+	Changed   int64  `json:"changed"`
+	Deleted   int64  `json:"deleted"`
+	Conflicts int64  `json:"conflicts"`
+	Errors    int64  `json:"errors"`
+	Bytes     int64  `json:"bytes"`
+}
+
+func newReportActivityCommand() *cobra.Command {
+	var syncName string
+	var days int
+	var format string
+	var human bool
+
+	cmd := &cobra.Command{
+		Use:   "activity",
+		Short: "Report the activity of syncs per client and day",
+		Long:  "Lists the daily added, changed and deleted files, moved bytes, conflicts and errors of each sync and client, as summarized by digests.",
+		Args:  cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if days < 1 {
+				return fmt.Errorf("--days must be at least 1")
+			}
+
+			ctx := context.Background()
+
+			ms, err := openMetadataStore(ctx)
+			if err != nil {
+				return err
+			}
+			defer ms.Close()
+
+			configs, err := ms.ListSyncConfigs(ctx)
+			if err != nil {
+				return fmt.Errorf("failed to list syncs: %w", err)
+			}
+			names := make(map[uint]string, len(configs))
+			var syncConfigID uint
+			for _, sc := range configs {
+				names[sc.ID] = sc.Name
+				if sc.Name == syncName {
+					syncConfigID = sc.ID
+				}
+			}
+			if syncName != "" && syncConfigID == 0 {
+				return fmt.Errorf("sync '%s' not found", syncName)
+			}
+
+			from := time.Now().UTC().AddDate(0, 0, -(days - 1))
+			activities, err := ms.ListSyncActivity(ctx, syncConfigID, from.Format("2006-01-02"), "")
+			if err != nil {
+				return fmt.Errorf("failed to list sync activity: %w", err)
+			}
+
+			rows := make([]activityRow, 0, len(activities))
+			for _, a := range activities {
+				name, ok := names[a.SyncConfigID]
+				if !ok {
+					continue
+				}
+				rows = append(rows, activityRow{
+					Day:       a.Day,
+					Sync:      name,
+					Client:    a.ClientID,
+					Passes:    a.Passes,
+					Added:     a.Added,
+					Changed:   a.Changed,
+					Deleted:   a.Deleted,
+					Conflicts: a.Conflicts,
+					Errors:    a.Errors,
+					Bytes:     a.Bytes,
+				})
+			}
+
+			return printActivity(rows, format, human)
+		},
+	}
+
+	cmd.Flags().StringVarP(&syncName, "sync", "s", "", "Only report activity of this sync")
+	cmd.Flags().IntVar(&days, "days", 7, "Number of days to report, including today")
+	cmd.Flags().StringVarP(&format, "format", "o", "table", "Output format (table, json, csv)")
+	cmd.Flags().BoolVarP(&human, "human-readable", "H", false, "Print sizes in human readable format")
+
+	return cmd
+}
+
+func printActivity(rows []activityRow, format string, human bool) error {
+	switch format {
+	case "json":
+		encoder := json.NewEncoder(os.Stdout)
+		encoder.SetIndent("", "    ")
+		return encoder.Encode(rows)
+
+	case "csv":
+		w := csv.NewWriter(os.Stdout)
+		w.Write([]string{"day", "sync", "client", "passes", "added", "changed", "deleted", "conflicts", "errors", "bytes"})
+		for _, r := range rows {
+			w.Write([]string{r.Day, r.Sync, r.Client, strconv.FormatInt(r.Passes, 10), strconv.FormatInt(r.Added, 10), strconv.FormatInt(r.Changed, 10),
+				strconv.FormatInt(r.Deleted, 10), strconv.FormatInt(r.Conflicts, 10), strconv.FormatInt(r.Errors, 10), strconv.FormatInt(r.Bytes, 10)})
+		}
+		w.Flush()
+		return w.Error()
+
+	case "table":
+		w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(w, i18n.T("report.activity_header"))
+		for _, r := range rows {
+			fmt.Fprintf(w, "%s\t%s\t%s\t%d\t%d\t%d\t%d\t%d\t%d\t%s\n", r.Day, r.Sync, r.Client, r.Passes, r.Added, r.Changed, r.Deleted,
+				r.Conflicts, r.Errors, formatSize(r.Bytes, human))
+		}
+		return w.Flush()
+
+	default:
+		return fmt.Errorf("unsupported output format '%s'", format)
+	}
+}
@@ -0,0 +1,252 @@
+package client
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"os/signal"
+	"text/tabwriter"
+	"time"
+
+	config "github.com/mwantia/gosync/internal/config/server"
+	"github.com/mwantia/gosync/internal/i18n"
+	"github.com/mwantia/gosync/pkg/backend"
+	"github.com/mwantia/gosync/pkg/engine"
+	"github.com/mwantia/gosync/pkg/vfs"
+	"github.com/spf13/cobra"
+)
+
+func NewSnapshotCommand() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "snapshot",
+		Short: "Manage the last known good snapshots of syncs",
+		Long: `Snapshots record the object versions of the remote roots of a sync in a manifest stored within
+the backend. Manifests are locked against deletion for the configured retention if the bucket has object lock
+enabled, so at least one consistent state survives even if later passes propagate bad data. The agent creates
+them on the schedule of the snapshots configuration and whenever a pass is paused after an anomaly.`,
+	}
+
+	cmd.AddCommand(NewSnapshotListCommand())
+	cmd.AddCommand(NewSnapshotCreateCommand())
+	cmd.AddCommand(NewSnapshotRestoreCommand())
+
+	return cmd
+}
+
+func NewSnapshotListCommand() *cobra.Command {
+	var format string
+
+	cmd := &cobra.Command{
+		Use:   "ls <backend>[/sync]",
+		Short: "List the snapshots of a backend",
+		Long:  "Lists the snapshots stored in the backend, optionally limited to a single sync, the most recent first.",
+		Args:  cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if format != "table" && format != "json" {
+				return i18n.Errorf("error.unsupported_format", format)
+			}
+
+			path := vfs.ParsePath(args[0])
+			ctx := context.Background()
+
+			ms, err := openMetadataStore(ctx)
+			if err != nil {
+				return err
+			}
+			defer ms.Close()
+
+			b, err := ms.GetBackend(ctx, path.Backend)
+			if err != nil {
+				return fmt.Errorf("failed to find backend '%s': %w", path.Backend, err)
+			}
+
+			st, flush, err := openStorage(ms, b)
+			if err != nil {
+				return err
+			}
+			defer flush()
+
+			snapshots, err := backend.NewSnapshots(ms, st, b).List(ctx, path.Key)
+			if err != nil {
+				return err
+			}
+
+			if format == "json" {
+				// Manifests may reference millions of files, which are only relevant for restores
+				for _, snap := range snapshots {
+					snap.Files = nil
+				}
+				enc := json.NewEncoder(os.Stdout)
+				enc.SetIndent("", "  ")
+				return enc.Encode(snapshots)
+			}
+
+			if len(snapshots) == 0 {
+				fmt.Println(i18n.T("snapshot.empty"))
+				return nil
+			}
+
+			w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+			fmt.Fprintln(w, i18n.T("snapshot.header"))
+			for _, snap := range snapshots {
+				locked := i18n.T("snapshot.unlocked")
+				if !snap.LockedUntil.IsZero() {
+					locked = snap.LockedUntil.Local().Format(time.DateTime)
+				}
+				fmt.Fprintf(w, "%s\t%s\t%d\t%s\t%s\t%s\n", snap.Created.Local().Format(time.DateTime), snap.Sync, len(snap.Files), locked, snap.Reason, snap.Key)
+			}
+			return w.Flush()
+		},
+	}
+
+	cmd.Flags().StringVarP(&format, "format", "o", "table", "Output format (table, json)")
+
+	return cmd
+}
+
+func NewSnapshotCreateCommand() *cobra.Command {
+	var reason string
+
+	cmd := &cobra.Command{
+		Use:   "create <sync>",
+		Short: "Create a snapshot of a sync",
+		Long: `Creates a snapshot of each remote root of the sync on this client, using the retention of the snapshots
+configuration. The snapshot records the state of the last applied pass, so take it before confirming an anomaly.`,
+		Args: cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			cfg, err := config.LoadServerConfig()
+			if err != nil {
+				return fmt.Errorf("failed to load configuration: %w", err)
+			}
+
+			var retention time.Duration
+			if cfg.Snapshots.Retention != "" {
+				if retention, err = time.ParseDuration(cfg.Snapshots.Retention); err != nil {
+					return fmt.Errorf("invalid snapshot retention '%s': %w", cfg.Snapshots.Retention, err)
+				}
+			}
+
+			ctx := context.Background()
+
+			ms, err := openMetadataStore(ctx)
+			if err != nil {
+				return err
+			}
+			defer ms.Close()
+
+			clientID, err := currentClientID(ctx, ms)
+			if err != nil {
+				return err
+			}
+
+			sc, err := ms.GetSyncConfig(ctx, args[0])
+			if err != nil {
+				return i18n.Errorf("sync.not_found", args[0], err)
+			}
+
+			roots := engine.RemoteRoots(sc, clientID)
+			if len(roots) == 0 {
+				return i18n.Errorf("snapshot.no_roots", sc.Name)
+			}
+
+			for _, root := range roots {
+				b, err := ms.GetBackend(ctx, root.Backend)
+				if err != nil {
+					return fmt.Errorf("failed to find backend '%s': %w", root.Backend, err)
+				}
+
+				st, flush, err := openStorage(ms, b)
+				if err != nil {
+					return err
+				}
+
+				snap, err := backend.NewSnapshots(ms, st, b).Create(ctx, sc.Name, root.Key, backend.SnapshotOptions{
+					Reason:     reason,
+					Retention:  retention,
+					Compliance: cfg.Snapshots.Compliance,
+				})
+				flush()
+				if err != nil {
+					return i18n.Errorf("snapshot.create_failed", root, sc.Name, err)
+				}
+
+				if snap.LockedUntil.IsZero() {
+					fmt.Println(i18n.T("snapshot.created_unlocked", b.ID, snap.Key, len(snap.Files)))
+				} else {
+					fmt.Println(i18n.T("snapshot.created", b.ID, snap.Key, len(snap.Files), snap.LockedUntil.Local().Format(time.DateTime)))
+				}
+			}
+			return nil
+		},
+	}
+
+	cmd.Flags().StringVar(&reason, "reason", "manual", "Reason recorded in the snapshot")
+
+	return cmd
+}
+
+func NewSnapshotRestoreCommand() *cobra.Command {
+	var dryRun bool
+	var confirm bool
+
+	cmd := &cobra.Command{
+		Use:   "restore <backend>/<key>",
+		Short: "Restore the remote root of a sync to a snapshot",
+		Long:  "Restores all entries below the prefix of the snapshot to the versions it recorded. Requires bucket versioning; removed entries are moved into the trash if enabled.",
+		Args:  cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			path := vfs.ParsePath(args[0])
+			if path.IsRoot() || path.IsBackend() {
+				return fmt.Errorf("a snapshot key is required")
+			}
+
+			ctx, cancel := signal.NotifyContext(context.Background(), os.Interrupt)
+			defer cancel()
+
+			ms, err := openMetadataStore(ctx)
+			if err != nil {
+				return err
+			}
+			defer ms.Close()
+
+			if err := checkMaintenance(ctx, ms); err != nil {
+				return err
+			}
+
+			b, err := ms.GetBackend(ctx, path.Backend)
+			if err != nil {
+				return fmt.Errorf("failed to find backend '%s': %w", path.Backend, err)
+			}
+
+			st, flush, err := openStorage(ms, b)
+			if err != nil {
+				return err
+			}
+			defer flush()
+
+			snap, err := backend.NewSnapshots(ms, st, b).Load(ctx, path.Key)
+			if err != nil {
+				return err
+			}
+
+			restorer := backend.NewRestorer(ms, st, b)
+			items, err := restorer.PlanSnapshot(ctx, snap)
+			if err != nil {
+				return err
+			}
+
+			if len(items) == 0 {
+				fmt.Println(i18n.T("snapshot.matches", vfs.Path{Backend: b.ID, Key: snap.Prefix}, snap.Key))
+				return nil
+			}
+
+			return applyRestore(ctx, restorer, items, dryRun, confirm)
+		},
+	}
+
+	cmd.Flags().BoolVar(&dryRun, "dry-run", false, "Only print the changes required for the restore")
+	cmd.Flags().BoolVarP(&confirm, "confirm", "c", false, "Confirms the restore")
+
+	return cmd
+}
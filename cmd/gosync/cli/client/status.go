@@ -0,0 +1,279 @@
+package client
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"os/signal"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/mwantia/gosync/internal/api"
+	config "github.com/mwantia/gosync/internal/config/server"
+	"github.com/mwantia/gosync/internal/i18n"
+	"github.com/mwantia/gosync/pkg/engine"
+	"github.com/mwantia/gosync/pkg/limits"
+	"github.com/mwantia/gosync/pkg/secrets"
+	"github.com/spf13/cobra"
+)
+
+// progressBarWidth is the number of characters used for progress bars
+const progressBarWidth = 30
+
+func NewStatusCommand() *cobra.Command {
+	var address string
+	var watch bool
+	var interval time.Duration
+	var format string
+
+	cmd := &cobra.Command{
+		Use:   "status",
+		Short: "Show the status of the running agent",
+		Long:  "Queries the running agent and prints its active syncs with progress and ETA, scheduled syncs, recent errors and the health of all backends and the metadata store.",
+		Args:  cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if format != "table" && format != "json" {
+				return i18n.Errorf("error.unsupported_format", format)
+			}
+			if watch && interval <= 0 {
+				return i18n.Errorf("status.interval_positive")
+			}
+
+			client, err := newAgentClient(address)
+			if err != nil {
+				return err
+			}
+
+			ctx, cancel := signal.NotifyContext(context.Background(), os.Interrupt)
+			defer cancel()
+
+			for {
+				status, err := client.Status(ctx)
+				if err != nil {
+					if ctx.Err() != nil {
+						return nil
+					}
+					return err
+				}
+
+				if watch && format == "table" {
+					// Clear the terminal before every refresh
+					fmt.Print("\033[H\033[2J")
+				}
+				if err := printStatus(status, format); err != nil {
+					return err
+				}
+
+				if !watch {
+					return nil
+				}
+
+				select {
+				case <-ctx.Done():
+					return nil
+				case <-time.After(interval):
+				}
+			}
+		},
+	}
+
+	cmd.Flags().StringVar(&address, "address", "", "Address of the agent API (defaults to api.address of the configuration)")
+	cmd.Flags().BoolVarP(&watch, "watch", "w", false, "Continuously refresh the status")
+	cmd.Flags().DurationVar(&interval, "interval", 2*time.Second, "Refresh interval used with --watch")
+	cmd.Flags().StringVarP(&format, "format", "o", "table", "Output format (table, json)")
+
+	return cmd
+}
+
+// newAgentClient creates a client for the agent API, using api.address of the configuration if address is empty.
+// Requests are authenticated with GOSYNC_TOKEN or api.token of the configuration if set.
+func newAgentClient(address string) (*api.Client, error) {
+	cfg, err := config.LoadServerConfig()
+	if err != nil {
+		return nil, i18n.Errorf("error.load_config", err)
+	}
+	if address == "" {
+		address = cfg.API.Address
+	}
+
+	token := os.Getenv("GOSYNC_TOKEN")
+	if token == "" && cfg.API.Token != "" {
+		resolver, err := secrets.NewResolver(cfg.Secrets)
+		if err != nil {
+			return nil, i18n.Errorf("error.resolve_token", err)
+		}
+		if token, err = resolver.Expand(context.Background(), cfg.API.Token); err != nil {
+			return nil, i18n.Errorf("error.resolve_token", err)
+		}
+	}
+
+	tlsConfig, err := api.ClientTLSConfig(cfg.API.TLS)
+	if err != nil {
+		return nil, i18n.Errorf("error.load_tls", err)
+	}
+
+	return api.NewClient(address, token, tlsConfig), nil
+}
+
+func printStatus(status *api.Status, format string) error {
+	if format == "json" {
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		return enc.Encode(status)
+	}
+
+	fmt.Println(i18n.T("status.agent", status.ClientID, status.Version, status.Time.Sub(status.StartedAt).Round(time.Second)))
+	fmt.Println(i18n.T("status.database", formatHealth(status.Database)))
+	if status.Maintenance != nil {
+		fmt.Println(i18n.T("status.maintenance", formatMaintenance(status.Maintenance)))
+	}
+	fmt.Println(i18n.T("status.resources", formatResources(status.Resources)))
+
+	fmt.Println()
+	fmt.Println(i18n.T("status.active_syncs"))
+	if len(status.Syncs) == 0 {
+		fmt.Println("  " + i18n.T("status.none"))
+	}
+	for _, p := range status.Syncs {
+		eta := i18n.T("progress.eta_unknown")
+		if d := p.ETA(status.Time); d > 0 {
+			eta = d.Round(time.Second).String()
+		}
+		deadline := ""
+		if !p.Deadline.IsZero() {
+			deadline = "  " + i18n.T("progress.deadline", p.Deadline.Local().Format(time.TimeOnly))
+		}
+
+		fmt.Printf("  %s [%s]  %s %5.1f%%  %s/%s  %s  %s%s\n",
+			p.Name, formatPhase(p), progressBar(p.Fraction()), p.Fraction()*100,
+			formatSize(p.BytesDone, true), formatSize(p.Bytes, true),
+			i18n.T("status.sync_progress", p.Completed+p.Failed, p.Actions, p.Queued(), p.Failed), i18n.T("progress.eta", eta), deadline)
+		for _, t := range p.Active {
+			fmt.Printf("    > #%d %s %s (%s/%s)\n", t.ID, t.Type, t.Path, formatSize(t.BytesDone, true), formatSize(t.Size, true))
+		}
+	}
+
+	if len(status.Scheduled) > 0 {
+		fmt.Println()
+		fmt.Println(i18n.T("status.scheduled_syncs"))
+
+		w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+		for _, s := range status.Scheduled {
+			next := i18n.T("status.not_scheduled")
+			switch {
+			case s.Waiting:
+				next = i18n.T("status.waiting")
+			case !s.NextRun.IsZero():
+				next = s.NextRun.Local().Format(time.DateTime)
+			}
+			polling := ""
+			if s.PollInterval > 0 {
+				polling = i18n.T("status.polling", time.Duration(s.PollInterval)*time.Second, s.ChangeRate*100)
+			}
+			fmt.Fprintf(w, "  %s\t%s\t%s\n", s.Name, next, polling)
+		}
+		w.Flush()
+	}
+
+	fmt.Println()
+	fmt.Println(i18n.T("status.backends"))
+	if len(status.Backends) == 0 {
+		fmt.Println("  " + i18n.T("status.none_checked"))
+	}
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	for _, b := range status.Backends {
+		fmt.Fprintf(w, "  %s\t%s\t%s\n", b.ID, b.Name, formatHealth(b.Health))
+	}
+	w.Flush()
+
+	if len(status.Pending) > 0 {
+		fmt.Println()
+		fmt.Println(i18n.T("status.pending_deletions"))
+
+		w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+		for _, p := range status.Pending {
+			fmt.Fprintf(w, "  %s\t%s\t%s\t%s\n", p.Sync, p.Side, i18n.T("status.due", p.DueAt.Local().Format(time.DateTime)), p.Path)
+		}
+		w.Flush()
+	}
+
+	if len(status.Denied) > 0 {
+		fmt.Println()
+		fmt.Println(i18n.T("status.access_denied"))
+
+		w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+		for _, d := range status.Denied {
+			operation := d.Operation
+			if d.Side != "" {
+				operation += " " + d.Side
+			}
+			fmt.Fprintf(w, "  %s\t/%s\t%s\t%s\t%s\n", d.Sync, d.Path, operation,
+				i18n.T("status.denied_failures", d.Failures), i18n.T("status.next_probe", d.NextProbeAt.Local().Format(time.DateTime)))
+		}
+		w.Flush()
+	}
+
+	if len(status.Errors) > 0 {
+		fmt.Println()
+		fmt.Println(i18n.T("status.recent_errors"))
+
+		w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+		for _, e := range status.Errors {
+			fmt.Fprintf(w, "  %s\t%s\t%s\t%s\n", e.Time.Local().Format(time.DateTime), e.Sync, e.Path, e.Error)
+		}
+		w.Flush()
+	}
+
+	return nil
+}
+
+// formatPhase returns the localized phase of the pass, e.g. "initial sync: transferring"
+func formatPhase(p engine.Progress) string {
+	phase := i18n.T("status.phase_" + string(p.Phase))
+	if p.Bootstrap {
+		return i18n.T("status.bootstrap", phase)
+	}
+	if p.Initial {
+		return i18n.T("status.initial_sync", phase)
+	}
+	return phase
+}
+
+func formatHealth(h api.Health) string {
+	if !h.Healthy {
+		return i18n.T("health.unhealthy", h.Error)
+	}
+	return i18n.T("health.healthy", h.Latency.Round(time.Millisecond))
+}
+
+// progressBar renders the fraction between 0 and 1 as bar, e.g. "[=====>    ]"
+func progressBar(fraction float64) string {
+	filled := int(fraction * progressBarWidth)
+	filled = min(max(filled, 0), progressBarWidth)
+
+	bar := strings.Repeat("=", filled)
+	if filled < progressBarWidth {
+		bar += ">" + strings.Repeat(" ", progressBarWidth-filled-1)
+	}
+	return "[" + bar + "]"
+}
+
+// formatResources formats the resource usage, including the limits if set
+func formatResources(r limits.Stats) string {
+	files := fmt.Sprintf("%d", r.OpenFiles)
+	if r.MaxOpenFiles > 0 {
+		files = fmt.Sprintf("%d/%d", r.OpenFiles, r.MaxOpenFiles)
+	}
+	memory := formatSize(int64(r.Memory), true)
+	if r.MemoryWatermark > 0 {
+		memory = fmt.Sprintf("%s/%s", memory, formatSize(int64(r.MemoryWatermark), true))
+	}
+
+	result := i18n.T("status.resources_usage", files, memory)
+	if r.Delayed > 0 || r.Shed > 0 {
+		result += "  " + i18n.T("status.resources_throttled", r.Delayed, r.Shed)
+	}
+	return result
+}
@@ -0,0 +1,987 @@
+package client
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"slices"
+	"sort"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/mwantia/gosync/internal/api"
+	"github.com/mwantia/gosync/internal/i18n"
+	"github.com/mwantia/gosync/pkg/db/models"
+	"github.com/mwantia/gosync/pkg/engine"
+	"github.com/mwantia/gosync/pkg/filter"
+	"github.com/mwantia/gosync/pkg/schedule"
+	"github.com/mwantia/gosync/pkg/storage"
+	"github.com/mwantia/gosync/pkg/vfs"
+	"github.com/spf13/cobra"
+)
+
+// syncWaitInterval defines how often the agent is polled while waiting for a sync pass
+const syncWaitInterval = time.Second
+
+func NewSyncCommand() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "sync",
+		Short: "Manage sync passes of the running agent",
+	}
+
+	cmd.AddCommand(NewSyncCreateCommand())
+	cmd.AddCommand(NewSyncRunCommand())
+	cmd.AddCommand(NewSyncRefreshCommand())
+	cmd.AddCommand(NewSyncExplainCommand())
+	cmd.AddCommand(NewSyncSelectCommand())
+	cmd.AddCommand(NewSyncBootstrapCommand())
+	cmd.AddCommand(NewSyncConfirmCommand())
+	cmd.AddCommand(NewSyncIntegrityCommand())
+	cmd.AddCommand(NewSyncMoveCommand())
+
+	return cmd
+}
+
+func NewSyncCreateCommand() *cobra.Command {
+	var preset string
+	var prefix string
+	var device string
+	var direction string
+	var interval int64
+	var cron string
+	var ignore string
+	var disabled bool
+	var isolated bool
+	var grace time.Duration
+	var weight int
+	var queueOrder string
+	var maxDuration time.Duration
+	var stopAt string
+	var deadlineGrace time.Duration
+	var verify string
+	var integrity string
+	var symlinks string
+	var normalization string
+	var reservedNames string
+	var preserve []string
+	var publish bool
+	var onDemand bool
+	var compression string
+	var compressionRules []string
+	var minSize string
+	var maxSize string
+	var modifiedAfter string
+	var modifiedBefore string
+	var includeMime []string
+	var excludeMime []string
+
+	cmd := &cobra.Command{
+		Use:   "create [name] <backend/path> <local path>",
+		Short: "Create a sync",
+		Long: `Creates a sync between a virtual path and a local directory.
+
+With --preset the sync is created from a template instead, which mirrors a known folder of the
+current user (documents, pictures, desktop) into <backend>/<prefix>/<device>/<Folder>, e.g.
+"gosync sync create --preset documents s3" creates the sync "laptop-documents" for s3/devices/laptop/Documents.
+
+Both paths may contain the variables {client_id}, {hostname} and {user}, which are expanded by each client.
+Download syncs may also organize files into directories with {date}, {year}, {month}, {day} and {tag:<key>}
+in the destination, which are expanded for each file, e.g. "~/Photos/{year}/{tag:event}".
+With --isolate each client stores its files within <backend>/devices/<client-id>/ automatically.
+With --on-demand files are downloaded as empty placeholders, whose content is downloaded once they are opened
+or pinned with "gosync pin".`,
+		Args: func(cmd *cobra.Command, args []string) error {
+			if preset != "" {
+				return cobra.ExactArgs(1)(cmd, args)
+			}
+			return cobra.ExactArgs(3)(cmd, args)
+		},
+		RunE: func(cmd *cobra.Command, args []string) error {
+			var sc *models.SyncConfig
+			var err error
+			if preset != "" {
+				if device == "" {
+					if device, err = os.Hostname(); err != nil {
+						return i18n.Errorf("error.client_id", err)
+					}
+				}
+				if sc, err = newPresetSyncConfig(preset, args[0], prefix, device); err != nil {
+					return err
+				}
+			} else {
+				sc = &models.SyncConfig{
+					Name:       args[0],
+					SourcePath: args[1],
+					DestPath:   args[2],
+					Direction:  engine.DirectionBidirectional,
+					Enabled:    true,
+					Interval:   300,
+				}
+			}
+
+			// Explicit flags override the defaults of the preset
+			if cmd.Flags().Changed("direction") {
+				sc.Direction = direction
+			}
+			if cmd.Flags().Changed("interval") {
+				sc.Interval = interval
+			}
+			if cmd.Flags().Changed("ignore") {
+				sc.IgnorePattern = ignore
+			}
+			sc.Schedule = cron
+			sc.Enabled = !disabled
+			sc.Isolated = isolated
+			sc.DeleteGrace = int64(grace / time.Second)
+			sc.Weight = weight
+			sc.QueueOrder = queueOrder
+			sc.MaxDuration = int64(maxDuration / time.Second)
+			sc.StopAt = stopAt
+			sc.DeadlineGrace = int64(deadlineGrace / time.Second)
+			sc.Verify = verify
+			sc.Integrity = integrity
+			sc.Symlinks = symlinks
+			sc.Normalization = normalization
+			sc.ReservedNames = reservedNames
+			sc.Preserve = strings.Join(preserve, ",")
+			sc.Publish = publish
+			sc.OnDemand = onDemand
+			sc.Compression = compression
+			sc.CompressionRules = strings.Join(compressionRules, ",")
+			if minSize != "" {
+				if sc.MinSize, err = filter.ParseSize(minSize); err != nil {
+					return i18n.Errorf("sync.invalid_size", "--min-size", err)
+				}
+			}
+			if maxSize != "" {
+				if sc.MaxSize, err = filter.ParseSize(maxSize); err != nil {
+					return i18n.Errorf("sync.invalid_size", "--max-size", err)
+				}
+			}
+			sc.ModifiedAfter = modifiedAfter
+			sc.ModifiedBefore = modifiedBefore
+			sc.IncludeMime = strings.Join(includeMime, ",")
+			sc.ExcludeMime = strings.Join(excludeMime, ",")
+
+			if err := validateSyncConfig(sc); err != nil {
+				return err
+			}
+
+			ctx := context.Background()
+
+			ms, err := openMetadataStore(ctx)
+			if err != nil {
+				return err
+			}
+			defer ms.Close()
+
+			clientID, err := currentClientID(ctx, ms)
+			if err != nil {
+				return err
+			}
+			source, dest := engine.ResolvePaths(sc, clientID)
+			if _, err := ms.GetBackend(ctx, vfs.ParsePath(source).Backend); err != nil {
+				return i18n.Errorf("sync.backend_not_found", vfs.ParsePath(source).Backend, err)
+			}
+			if root, _ := engine.SplitPathTemplate(dest); engine.IsLocalPath(root) {
+				if err := os.MkdirAll(root, 0755); err != nil {
+					return i18n.Errorf("sync.create_dest_failed", root, err)
+				}
+			}
+
+			if err := ms.CreateSyncConfig(ctx, sc); err != nil {
+				return i18n.Errorf("sync.create_failed", sc.Name, err)
+			}
+
+			fmt.Println(i18n.T("sync.created", sc.Name, dest, source, sc.Direction))
+			return nil
+		},
+	}
+
+	cmd.Flags().StringVar(&preset, "preset", "", fmt.Sprintf("Create the sync from a template (%s)", strings.Join(presetNames(), ", ")))
+	cmd.Flags().StringVar(&prefix, "prefix", "devices", "Prefix of the per-device folders used by presets")
+	cmd.Flags().StringVar(&device, "device", "", "Name of the per-device folder used by presets (defaults to the hostname)")
+	cmd.Flags().StringVar(&direction, "direction", engine.DirectionBidirectional, "Direction of the sync (bidirectional, download, upload)")
+	cmd.Flags().Int64Var(&interval, "interval", 300, "Seconds between passes, used if no schedule is set")
+	cmd.Flags().StringVar(&cron, "schedule", "", "Cron expression of the passes, e.g. \"0 2 * * *\"")
+	cmd.Flags().StringVar(&ignore, "ignore", "", "Comma separated glob patterns of ignored files")
+	cmd.Flags().BoolVar(&disabled, "disabled", false, "Create the sync without scheduling it")
+	cmd.Flags().BoolVar(&isolated, "isolate", false, "Store the files of each client within devices/<client-id>/ of the backend")
+	cmd.Flags().DurationVar(&grace, "delete-grace", 0, "Duration deletions stay pending before they are propagated (e.g. 24h)")
+	cmd.Flags().IntVar(&weight, "weight", 1, "Share of the agent's worker pool relative to other syncs (see scheduler.workers)")
+	cmd.Flags().StringVar(&queueOrder, "queue-order", "", "Order in which queued transfers are started (smallest, newest; default: planned order)")
+	cmd.Flags().DurationVar(&maxDuration, "max-duration", 0, "Duration after which a pass stops starting transfers (e.g. 4h)")
+	cmd.Flags().StringVar(&stopAt, "stop-at", "", "Time of day after which a pass stops starting transfers (e.g. 07:00)")
+	cmd.Flags().DurationVar(&deadlineGrace, "deadline-grace", 0, "Duration in-flight transfers may continue after the deadline before they are cancelled (0 = until they finish)")
+	cmd.Flags().StringVar(&verify, "verify", engine.VerifyOff, "Verify the checksums of transferred files (off, sampled, always)")
+	cmd.Flags().StringVar(&integrity, "integrity", engine.IntegrityStandard, "How changed files are detected (fast, standard, paranoid)")
+	cmd.Flags().StringVar(&symlinks, "symlinks", storage.SymlinkSkip, "How symbolic links within local directories are synced (skip, follow, preserve)")
+	cmd.Flags().StringVar(&reservedNames, "reserved-names", storage.ReservedEscape, "How names Windows doesn't allow are stored in local directories on Windows (escape, error)")
+	cmd.Flags().StringVar(&normalization, "normalization", storage.NormalizationNFC, "Unicode normalization of paths, written composed (nfc) or decomposed (nfd), or compared byte by byte (none)")
+	cmd.Flags().StringSliceVar(&preserve, "preserve", nil, "POSIX metadata of local files kept across clients (mode, owner, xattrs)")
+	cmd.Flags().BoolVar(&publish, "publish", false, "Write a signed manifest of all files to the backend after each upload pass (requires --direction upload)")
+	cmd.Flags().BoolVar(&onDemand, "on-demand", false, "Download files as placeholders until they are opened or pinned (requires a local directory)")
+	cmd.Flags().StringVar(&compression, "compression", "", "Compress files uploaded into the backend (zstd, gzip, none)")
+	cmd.Flags().StringSliceVar(&compressionRules, "compression-rule", nil, "Compression of files by extension overriding --compression, e.g. .log=zstd or .bin=none")
+	cmd.Flags().StringVar(&minSize, "min-size", "", "Skip files smaller than this size, e.g. 1KB")
+	cmd.Flags().StringVar(&maxSize, "max-size", "", "Skip files larger than this size, e.g. 2GB")
+	cmd.Flags().StringVar(&modifiedAfter, "modified-after", "", "Skip files modified before this time, e.g. 2024-01-01 or now-30d")
+	cmd.Flags().StringVar(&modifiedBefore, "modified-before", "", "Skip files modified after this time, e.g. 2024-01-01 or now-1d")
+	cmd.Flags().StringSliceVar(&includeMime, "include-mime", nil, "Only sync files of these MIME types, e.g. image/* or application/pdf")
+	cmd.Flags().StringSliceVar(&excludeMime, "exclude-mime", nil, "Skip files of these MIME types, e.g. video/*")
+
+	return cmd
+}
+
+// validateSyncConfig checks the sync before it is stored, since invalid syncs are only reported by the agent
+func validateSyncConfig(sc *models.SyncConfig) error {
+	switch sc.Direction {
+	case engine.DirectionBidirectional, engine.DirectionDownload, engine.DirectionUpload:
+	default:
+		return i18n.Errorf("sync.invalid_direction", sc.Direction)
+	}
+
+	if engine.IsLocalPath(sc.SourcePath) || vfs.ParsePath(sc.SourcePath).IsRoot() {
+		return i18n.Errorf("sync.invalid_source", sc.SourcePath)
+	}
+	if _, template := engine.SplitPathTemplate(sc.DestPath); template != "" && sc.Direction != engine.DirectionDownload {
+		return i18n.Errorf("sync.invalid_template", template, engine.DirectionDownload)
+	}
+	if sc.Weight < 1 {
+		return i18n.Errorf("sync.invalid_weight", sc.Weight)
+	}
+	if !engine.ValidQueueOrder(sc.QueueOrder) {
+		return i18n.Errorf("sync.invalid_queue_order", sc.QueueOrder, engine.QueueOrderSmallest, engine.QueueOrderNewest)
+	}
+	if !engine.ValidVerifyMode(sc.Verify) {
+		return i18n.Errorf("sync.invalid_verify", sc.Verify, engine.VerifyOff, engine.VerifySampled, engine.VerifyAlways)
+	}
+	if !engine.ValidIntegrityMode(sc.Integrity) {
+		return i18n.Errorf("sync.invalid_integrity", sc.Integrity, engine.IntegrityFast, engine.IntegrityStandard, engine.IntegrityParanoid)
+	}
+	if !engine.ValidSymlinkPolicy(sc.Symlinks) {
+		return i18n.Errorf("sync.invalid_symlinks", sc.Symlinks, storage.SymlinkSkip, storage.SymlinkFollow, storage.SymlinkPreserve)
+	}
+	if !engine.ValidNormalization(sc.Normalization) {
+		return i18n.Errorf("sync.invalid_normalization", sc.Normalization, storage.NormalizationNFC, storage.NormalizationNFD, storage.NormalizationNone)
+	}
+	if !engine.ValidReservedNames(sc.ReservedNames) {
+		return i18n.Errorf("sync.invalid_reserved_names", sc.ReservedNames, storage.ReservedEscape, storage.ReservedError)
+	}
+	if !engine.ValidPreserve(sc.Preserve) {
+		return i18n.Errorf("sync.invalid_preserve", sc.Preserve, storage.PreserveMode, storage.PreserveOwner, storage.PreserveXattrs)
+	}
+	if err := engine.ValidPublish(sc); err != nil {
+		return i18n.Errorf("sync.invalid_publish", err)
+	}
+	if err := engine.ValidOnDemand(sc); err != nil {
+		return i18n.Errorf("sync.invalid_on_demand", err)
+	}
+	if err := engine.ValidCompression(sc); err != nil {
+		return i18n.Errorf("sync.invalid_compression", err)
+	}
+	if err := engine.ValidRules(sc); err != nil {
+		return i18n.Errorf("sync.invalid_rules", err)
+	}
+	if sc.MaxDuration < 0 || sc.DeadlineGrace < 0 {
+		return i18n.Errorf("sync.invalid_deadline")
+	}
+	if sc.StopAt != "" {
+		if _, err := schedule.NextClock(sc.StopAt, time.Now()); err != nil {
+			return i18n.Errorf("sync.invalid_stop_at", sc.StopAt, err)
+		}
+	}
+	if sc.Schedule != "" {
+		if _, err := schedule.ParseCron(sc.Schedule); err != nil {
+			return i18n.Errorf("sync.invalid_schedule", sc.Schedule, err)
+		}
+	}
+	return nil
+}
+
+func NewSyncRunCommand() *cobra.Command {
+	var address string
+	var dryRun bool
+	var rehash bool
+	var wait bool
+	var format string
+
+	cmd := &cobra.Command{
+		Use:   "run <name>",
+		Short: "Run a sync pass",
+		Long:  "Starts a pass of the sync on the running agent. Use --dry-run to print all uploads, downloads, deletes and conflicts of the pass without changing any data.",
+		Args:  cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if format != "table" && format != "json" {
+				return i18n.Errorf("error.unsupported_format", format)
+			}
+
+			client, err := newAgentClient(address)
+			if err != nil {
+				return err
+			}
+
+			ctx, cancel := signal.NotifyContext(context.Background(), os.Interrupt)
+			defer cancel()
+
+			resp, err := client.RunSync(ctx, args[0], api.RunRequest{DryRun: dryRun, Rehash: rehash})
+			if err != nil {
+				return err
+			}
+
+			if dryRun {
+				return printPlan(resp, format)
+			}
+
+			if !wait {
+				fmt.Println(i18n.T("sync.started", resp.Sync))
+				return nil
+			}
+
+			result, err := waitForSync(ctx, client, resp)
+			if err != nil {
+				return err
+			}
+
+			fmt.Println(i18n.T("sync.finished", resp.Sync, result.FinishedAt.Sub(result.StartedAt).Round(time.Millisecond),
+				result.Uploaded, result.Downloaded, result.Deleted, result.Deferred, result.Conflicts, result.Failed, formatSize(result.Bytes, true)))
+
+			switch {
+			case result.Error != "":
+				return i18n.Errorf("sync.failed", resp.Sync, result.Error)
+			case result.Failed > 0:
+				return i18n.Errorf("sync.failed_actions", resp.Sync, result.Failed)
+			}
+			return nil
+		},
+	}
+
+	cmd.Flags().StringVar(&address, "address", "", "Address of the agent API (defaults to api.address of the configuration)")
+	cmd.Flags().BoolVar(&dryRun, "dry-run", false, "Only print the planned changes without touching any data")
+	cmd.Flags().BoolVar(&rehash, "rehash", false, "Read the content of all files again in paranoid integrity mode, ignoring cached hashes")
+	cmd.Flags().BoolVar(&wait, "wait", false, "Wait until the pass has finished")
+	cmd.Flags().StringVarP(&format, "format", "o", "table", "Output format of dry runs (table, json)")
+
+	return cmd
+}
+
+func NewSyncRefreshCommand() *cobra.Command {
+	var address string
+	var format string
+
+	cmd := &cobra.Command{
+		Use:   "refresh <path>",
+		Short: "Re-sync a single file or directory",
+		Long:  "Re-scans and reconciles a single file or directory within all enabled syncs containing it, without running full passes. The path is either a virtual path like backend/path or a local path.",
+		Args:  cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if format != "table" && format != "json" {
+				return i18n.Errorf("error.unsupported_format", format)
+			}
+
+			p := args[0]
+			if engine.IsLocalPath(p) {
+				// The agent may run within a different working directory
+				abs, err := filepath.Abs(p)
+				if err != nil {
+					return err
+				}
+				p = abs
+			}
+
+			client, err := newAgentClient(address)
+			if err != nil {
+				return err
+			}
+
+			ctx, cancel := signal.NotifyContext(context.Background(), os.Interrupt)
+			defer cancel()
+
+			resp, err := client.Refresh(ctx, api.RefreshRequest{Path: p})
+			if err != nil {
+				return i18n.Errorf("sync.refresh_failed", p, err)
+			}
+
+			sort.Slice(resp.Syncs, func(i, j int) bool {
+				return resp.Syncs[i].Sync < resp.Syncs[j].Sync
+			})
+
+			if format == "json" {
+				enc := json.NewEncoder(os.Stdout)
+				enc.SetIndent("", "  ")
+				return enc.Encode(resp)
+			}
+
+			failed := 0
+			w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+			fmt.Fprintln(w, i18n.T("sync.refresh_header"))
+			for _, s := range resp.Syncs {
+				scope := s.Scope
+				if scope == "" {
+					scope = "/"
+				}
+
+				result := s.Result
+				state := "-"
+				if result.Error != "" {
+					state = result.Error
+					failed++
+				} else if result.Failed > 0 {
+					state = i18n.T("sync.refresh_failed_actions", result.Failed)
+					failed++
+				}
+				fmt.Fprintf(w, "%s\t%s\t%d\t%d\t%d\t%d\t%s\n", s.Sync, scope,
+					result.Uploaded, result.Downloaded, result.Deleted, result.Conflicts, state)
+			}
+			if err := w.Flush(); err != nil {
+				return err
+			}
+
+			if failed > 0 {
+				return i18n.Errorf("sync.refresh_incomplete", failed, len(resp.Syncs))
+			}
+			return nil
+		},
+	}
+
+	cmd.Flags().StringVar(&address, "address", "", "Address of the agent API (defaults to api.address of the configuration)")
+	cmd.Flags().StringVarP(&format, "format", "o", "table", "Output format (table, json)")
+
+	return cmd
+}
+
+func NewSyncExplainCommand() *cobra.Command {
+	var address string
+	var format string
+
+	cmd := &cobra.Command{
+		Use:   "explain <path>",
+		Short: "Explain why a file is synced or skipped",
+		Long:  "Traces the planner for a single file within all syncs containing it: the ignore patterns, the selective sync, the size, modification time and MIME type rules, the direction, the baseline and the conflict state, followed by the action the next pass takes. Nothing is changed. The path is either a virtual path like backend/path or a local path.",
+		Args:  cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if format != "table" && format != "json" {
+				return i18n.Errorf("error.unsupported_format", format)
+			}
+
+			p := args[0]
+			if engine.IsLocalPath(p) {
+				// The agent may run within a different working directory
+				abs, err := filepath.Abs(p)
+				if err != nil {
+					return err
+				}
+				p = abs
+			}
+
+			client, err := newAgentClient(address)
+			if err != nil {
+				return err
+			}
+
+			ctx, cancel := signal.NotifyContext(context.Background(), os.Interrupt)
+			defer cancel()
+
+			resp, err := client.Explain(ctx, api.ExplainRequest{Path: p})
+			if err != nil {
+				return i18n.Errorf("sync.explain_failed", p, err)
+			}
+
+			sort.Slice(resp.Syncs, func(i, j int) bool {
+				return resp.Syncs[i].Sync < resp.Syncs[j].Sync
+			})
+
+			if format == "json" {
+				enc := json.NewEncoder(os.Stdout)
+				enc.SetIndent("", "  ")
+				return enc.Encode(resp)
+			}
+
+			for i, x := range resp.Syncs {
+				if i > 0 {
+					fmt.Println()
+				}
+				if x.Included {
+					fmt.Println(i18n.T("sync.explain_included", x.Sync, x.Path))
+				} else {
+					fmt.Println(i18n.T("sync.explain_skipped", x.Sync, x.Path))
+				}
+
+				w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+				fmt.Fprintln(w, i18n.T("sync.explain_header"))
+				for _, step := range x.Steps {
+					side, result := step.Side, i18n.T("sync.explain_pass")
+					if side == "" {
+						side = "-"
+					}
+					if !step.Passed {
+						result = i18n.T("sync.explain_fail")
+					}
+					fmt.Fprintf(w, "%s\t%s\t%s\t%s\n", step.Rule, side, result, step.Detail)
+				}
+				if err := w.Flush(); err != nil {
+					return err
+				}
+
+				if x.Decision != "" {
+					fmt.Println(i18n.T("sync.explain_decision", x.Decision, x.Reason))
+				} else {
+					fmt.Println(i18n.T("sync.explain_no_action", x.Reason))
+				}
+			}
+			return nil
+		},
+	}
+
+	cmd.Flags().StringVar(&address, "address", "", "Address of the agent API (defaults to api.address of the configuration)")
+	cmd.Flags().StringVarP(&format, "format", "o", "table", "Output format (table, json)")
+
+	return cmd
+}
+
+func NewSyncSelectCommand() *cobra.Command {
+	var include bool
+	var exclude bool
+
+	cmd := &cobra.Command{
+		Use:   "select <name> [path]",
+		Short: "Include or exclude directories of a sync",
+		Long: `Selective sync: toggles whether a directory of the sync is synced. Without a path, all selections are listed.
+
+A directory without own selection is switched to the opposite of its current state, while a directory with
+own selection falls back to the state of its parent. Use --include or --exclude to set the state explicitly.
+Once any directory is included, only included directories are synced. Files within directories that are no
+longer synced are kept on both sides.`,
+		Args: cobra.RangeArgs(1, 2),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if include && exclude {
+				return i18n.Errorf("sync.select_conflicting_flags")
+			}
+
+			ctx := context.Background()
+
+			ms, err := openMetadataStore(ctx)
+			if err != nil {
+				return err
+			}
+			defer ms.Close()
+
+			sc, err := ms.GetSyncConfig(ctx, args[0])
+			if err != nil {
+				return i18n.Errorf("sync.not_found", args[0], err)
+			}
+
+			selections, err := ms.ListSyncSelections(ctx, sc.ID)
+			if err != nil {
+				return i18n.Errorf("sync.select_list_failed", err)
+			}
+
+			if len(args) == 1 {
+				w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+				fmt.Fprintln(w, i18n.T("sync.select_header"))
+				for _, selection := range selections {
+					fmt.Fprintf(w, "%s\t/%s\n", selection.Mode, selection.Path)
+				}
+				return w.Flush()
+			}
+
+			dir := engine.CleanSelectionPath(args[1])
+			mode := ""
+			switch {
+			case include:
+				mode = models.SelectionInclude
+			case exclude:
+				mode = models.SelectionExclude
+			default:
+				for _, selection := range selections {
+					if engine.CleanSelectionPath(selection.Path) == dir {
+						// Toggling an own selection falls back to the state of the parent
+						if err := ms.DeleteSyncSelection(ctx, sc.ID, selection.Path); err != nil {
+							return i18n.Errorf("sync.select_failed", err)
+						}
+						fmt.Println(i18n.T("sync.select_reset", "/"+dir, sc.Name))
+						return nil
+					}
+				}
+
+				mode = models.SelectionExclude
+				if !engine.NewSelection(selections).Selected(dir) {
+					mode = models.SelectionInclude
+				}
+			}
+
+			err = ms.SaveSyncSelection(ctx, &models.SyncSelection{
+				SyncConfigID: sc.ID,
+				Path:         dir,
+				Mode:         mode,
+			})
+			if err != nil {
+				return i18n.Errorf("sync.select_failed", err)
+			}
+
+			fmt.Println(i18n.T("sync.select_"+mode, "/"+dir, sc.Name))
+			return nil
+		},
+	}
+
+	cmd.Flags().BoolVar(&include, "include", false, "Sync the directory")
+	cmd.Flags().BoolVar(&exclude, "exclude", false, "Don't sync the directory")
+
+	return cmd
+}
+
+func NewSyncBootstrapCommand() *cobra.Command {
+	var all bool
+	var stop bool
+
+	cmd := &cobra.Command{
+		Use:   "bootstrap [name...]",
+		Short: "Only download into syncs until this client has all of their files",
+		Long: `Bootstrap mode for a new or replaced machine joining existing syncs.
+
+The next passes of the syncs on this client only download from the source, overwriting local files that
+differ from it. Nothing is uploaded or deleted, so an empty folder isn't mistaken for the deletion of all
+files synced by the previous machine with the same client id. Once a pass applied all of its actions,
+the syncs continue in their configured direction. Use --cancel to end the bootstrap mode early.`,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if !all && len(args) == 0 {
+				return i18n.Errorf("sync.bootstrap_missing_args")
+			}
+			ctx := context.Background()
+
+			ms, err := openMetadataStore(ctx)
+			if err != nil {
+				return err
+			}
+			defer ms.Close()
+
+			clientID, err := currentClientID(ctx, ms)
+			if err != nil {
+				return err
+			}
+
+			var syncs []models.SyncConfig
+			if all {
+				if syncs, err = ms.ListSyncConfigs(ctx); err != nil {
+					return i18n.Errorf("sync.list_failed", err)
+				}
+				args = nil
+			}
+			for _, name := range args {
+				sc, err := ms.GetSyncConfig(ctx, name)
+				if err != nil {
+					return i18n.Errorf("sync.not_found", name, err)
+				}
+				syncs = append(syncs, *sc)
+			}
+
+			for i := range syncs {
+				sc := &syncs[i]
+				if err := engine.SetBootstrap(ctx, ms, sc, clientID, !stop); err != nil {
+					return i18n.Errorf("sync.bootstrap_failed", sc.Name, err)
+				}
+
+				if stop {
+					fmt.Println(i18n.T("sync.bootstrap_cancelled", sc.Name))
+				} else {
+					source, _ := engine.ResolvePaths(sc, clientID)
+					fmt.Println(i18n.T("sync.bootstrap_enabled", sc.Name, source))
+				}
+			}
+			return nil
+		},
+	}
+
+	cmd.Flags().BoolVar(&all, "all", false, "Bootstrap all syncs")
+	cmd.Flags().BoolVar(&stop, "cancel", false, "End the bootstrap mode, syncing in the configured direction again")
+
+	return cmd
+}
+
+func NewSyncConfirmCommand() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "confirm <name>",
+		Short: "Resume a sync paused after an anomaly",
+		Long: `Resumes a sync on this client that was paused, since its pass looked like an accidental mass change,
+e.g. most files deleted or rewritten at once. Check the changes with 'gosync sync run --dry-run <name>' first:
+the next pass applies them regardless of the heuristics.`,
+		Args: cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			ctx := context.Background()
+
+			ms, err := openMetadataStore(ctx)
+			if err != nil {
+				return err
+			}
+			defer ms.Close()
+
+			clientID, err := currentClientID(ctx, ms)
+			if err != nil {
+				return err
+			}
+
+			sc, err := ms.GetSyncConfig(ctx, args[0])
+			if err != nil {
+				return i18n.Errorf("sync.not_found", args[0], err)
+			}
+
+			anomaly, err := engine.ConfirmAnomaly(ctx, ms, sc, clientID)
+			if err != nil {
+				return i18n.Errorf("sync.confirm_failed", sc.Name, err)
+			}
+			if anomaly == "" {
+				return i18n.Errorf("sync.not_paused", sc.Name)
+			}
+
+			fmt.Println(i18n.T("sync.confirmed", sc.Name, anomaly))
+			return nil
+		},
+	}
+
+	return cmd
+}
+
+func NewSyncMoveCommand() *cobra.Command {
+	var merge bool
+
+	cmd := &cobra.Command{
+		Use:   "move <from> <to> [path]",
+		Short: "Move a directory of a sync into another sync",
+		Long: `Splits or merges syncs without transferring their files again. The baselines, pending deletions and
+selections below the directory of the first sync are moved into the second sync, whose source and destination
+have to contain the directory for all clients, e.g. a sync created for a subdirectory. The directory is
+excluded from the first sync afterwards. Without a path, --merge merges the whole sync into the second one
+and removes it.
+
+Run the command while no pass of either sync is running, e.g. while the agent is stopped.`,
+		Args: cobra.RangeArgs(2, 3),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			ctx := context.Background()
+
+			ms, err := openMetadataStore(ctx)
+			if err != nil {
+				return err
+			}
+			defer ms.Close()
+
+			clientID, err := currentClientID(ctx, ms)
+			if err != nil {
+				return err
+			}
+
+			from, err := ms.GetSyncConfig(ctx, args[0])
+			if err != nil {
+				return i18n.Errorf("sync.not_found", args[0], err)
+			}
+			to, err := ms.GetSyncConfig(ctx, args[1])
+			if err != nil {
+				return i18n.Errorf("sync.not_found", args[1], err)
+			}
+
+			var prefix string
+			if len(args) > 2 {
+				prefix = args[2]
+			}
+
+			// The paths of the syncs may contain variables, which have to resolve alike for all known clients
+			clientIDs := []string{clientID}
+			clients, err := ms.ListClients(ctx)
+			if err != nil {
+				return i18n.Errorf("sync.move_failed", err)
+			}
+			for _, client := range clients {
+				if !slices.Contains(clientIDs, client.ID) {
+					clientIDs = append(clientIDs, client.ID)
+				}
+			}
+
+			move, moved, err := engine.MovePrefix(ctx, ms, from, to, prefix, merge, clientIDs)
+			if err != nil {
+				return i18n.Errorf("sync.move_failed", err)
+			}
+
+			if move.Merge {
+				fmt.Println(i18n.T("sync.merged", moved, from.Name, "/"+move.ToPrefix, to.Name))
+			} else {
+				fmt.Println(i18n.T("sync.moved", moved, "/"+move.FromPrefix, from.Name, "/"+move.ToPrefix, to.Name))
+			}
+			return nil
+		},
+	}
+
+	cmd.Flags().BoolVar(&merge, "merge", false, "Merge the whole first sync into the second one and remove it")
+
+	return cmd
+}
+
+func NewSyncIntegrityCommand() *cobra.Command {
+	var format string
+	var limit int
+
+	cmd := &cobra.Command{
+		Use:   "integrity [name]",
+		Short: "List the failed verifications of transfers",
+		Long: `Lists transfers whose written content didn't match the checksums of their source, of all syncs
+or a single one, the latest first. Transfers are only verified by syncs created with --verify sampled or always,
+and each failed transfer is retried once within the same pass.`,
+		Args: cobra.MaximumNArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if format != "table" && format != "json" {
+				return i18n.Errorf("error.unsupported_format", format)
+			}
+
+			ctx := context.Background()
+
+			ms, err := openMetadataStore(ctx)
+			if err != nil {
+				return err
+			}
+			defer ms.Close()
+
+			var id uint
+			if len(args) > 0 {
+				sc, err := ms.GetSyncConfig(ctx, args[0])
+				if err != nil {
+					return i18n.Errorf("sync.not_found", args[0], err)
+				}
+				id = sc.ID
+			}
+
+			errs, err := ms.ListIntegrityErrors(ctx, id, limit)
+			if err != nil {
+				return err
+			}
+
+			if format == "json" {
+				enc := json.NewEncoder(os.Stdout)
+				enc.SetIndent("", "  ")
+				return enc.Encode(errs)
+			}
+
+			if len(errs) == 0 {
+				fmt.Println(i18n.T("sync.integrity_empty"))
+				return nil
+			}
+
+			w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+			fmt.Fprintln(w, i18n.T("sync.integrity_header"))
+			for _, e := range errs {
+				fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\t%s\n", e.DetectedAt.Local().Format(time.DateTime), e.ClientID, e.Path, e.Check, e.Expected, e.Actual)
+			}
+			return w.Flush()
+		},
+	}
+
+	cmd.Flags().StringVarP(&format, "format", "o", "table", "Output format (table, json)")
+	cmd.Flags().IntVar(&limit, "limit", 100, "Maximum number of listed errors")
+
+	return cmd
+}
+
+// waitForSync polls the agent until the pass requested with resp has finished
+func waitForSync(ctx context.Context, client *api.Client, resp *api.RunResponse) (*api.RunResult, error) {
+	display := newProgressDisplay()
+	defer display.Finish()
+
+	for {
+		status, err := client.Status(ctx)
+		if err != nil {
+			return nil, err
+		}
+
+		for _, s := range status.Scheduled {
+			if s.Name == resp.Sync && s.LastRun != nil && !s.LastRun.StartedAt.Before(resp.Time) {
+				return s.LastRun, nil
+			}
+		}
+
+		for _, p := range status.Syncs {
+			if p.Name == resp.Sync {
+				display.Update(syncProgress(p))
+			}
+		}
+
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-time.After(syncWaitInterval):
+		}
+	}
+}
+
+// syncProgress converts the progress of a sync pass into progress bars, weighted by bytes if known
+func syncProgress(p engine.Progress) (progressItem, []progressItem) {
+	label := fmt.Sprintf("%s [%s]", p.Name, formatPhase(p))
+	overall := progressItem{
+		Label:   label,
+		Current: p.BytesDone,
+		Total:   p.Bytes,
+		Bytes:   true,
+	}
+	if p.Bytes == 0 {
+		overall = progressItem{
+			Label:   label,
+			Current: int64(p.Completed + p.Failed),
+			Total:   int64(p.Actions),
+		}
+	}
+
+	items := make([]progressItem, 0, len(p.Active))
+	for _, t := range p.Active {
+		items = append(items, progressItem{
+			Label:   string(t.Type) + " " + t.Path,
+			Current: t.BytesDone,
+			Total:   t.Size,
+			Bytes:   true,
+		})
+	}
+	return overall, items
+}
+
+func printPlan(resp *api.RunResponse, format string) error {
+	if format == "json" {
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		return enc.Encode(resp.Plan)
+	}
+
+	counts := make(map[engine.ActionType]int)
+	for _, action := range resp.Plan.Actions {
+		counts[action.Type]++
+
+		// Baseline updates don't touch any data
+		if action.Type == engine.ActionRecord || action.Type == engine.ActionForget {
+			continue
+		}
+
+		line := fmt.Sprintf("%-13s %s", action.Type, action.Path)
+		if action.Target != "" {
+			line += " -> " + action.Target
+		}
+		if action.Size > 0 {
+			line += fmt.Sprintf(" [%s]", formatSize(action.Size, true))
+		}
+		if action.Reason != "" {
+			line += fmt.Sprintf(" (%s)", action.Reason)
+		}
+		fmt.Println(line)
+	}
+
+	summary := []string{
+		i18n.T("sync.plan_downloads", counts[engine.ActionDownload]),
+		i18n.T("sync.plan_uploads", counts[engine.ActionUpload]),
+		i18n.T("sync.plan_deletes", counts[engine.ActionDeleteSource]+counts[engine.ActionDeleteDest]),
+		i18n.T("sync.plan_conflicts", counts[engine.ActionConflict]),
+	}
+	for _, link := range resp.Plan.SkippedLinks {
+		fmt.Printf("%-13s %s -> %s (%s)\n", "skip-link", link.Key, link.Target, link.Reason)
+	}
+
+	fmt.Println(i18n.T("sync.dry_run", resp.Sync, strings.Join(summary, ", "), resp.Plan.Scanned, resp.Plan.Unchanged))
+	fmt.Println(i18n.T("sync.plan_symlinks", resp.Plan.Symlinks, len(resp.Plan.SkippedLinks)))
+	return nil
+}
@@ -0,0 +1,325 @@
+package client
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"sort"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/mwantia/gosync/internal/api"
+	"github.com/mwantia/gosync/internal/i18n"
+	"github.com/mwantia/gosync/pkg/engine"
+	"github.com/mwantia/gosync/pkg/filter"
+	"github.com/spf13/cobra"
+)
+
+func NewTagCommand() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "tag",
+		Short: "Manage the tags of files",
+		Long:  "Manage the key=value tags of files tracked by the running agent. Paths are either virtual paths like backend/path or local paths within a sync.",
+	}
+
+	cmd.AddCommand(NewTagSetCommand())
+	cmd.AddCommand(NewTagRemoveCommand())
+	cmd.AddCommand(NewTagListCommand())
+
+	return cmd
+}
+
+func NewTagSetCommand() *cobra.Command {
+	var address string
+	var recursive bool
+
+	cmd := &cobra.Command{
+		Use:   "set <path> <key=value>...",
+		Short: "Add or replace tags of a file",
+		Args:  cobra.MinimumNArgs(2),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			tags, err := parseTags(args[1:])
+			if err != nil {
+				return err
+			}
+			return updateTags(address, api.TagRequest{
+				Path:      args[0],
+				Recursive: recursive,
+				Set:       tags,
+			})
+		},
+	}
+
+	cmd.Flags().StringVar(&address, "address", "", "Address of the agent API (defaults to api.address of the configuration)")
+	cmd.Flags().BoolVarP(&recursive, "recursive", "r", false, "Tag all files below the path")
+
+	return cmd
+}
+
+func NewTagRemoveCommand() *cobra.Command {
+	var address string
+	var recursive bool
+
+	cmd := &cobra.Command{
+		Use:   "rm <path> <key>...",
+		Short: "Remove tags of a file",
+		Args:  cobra.MinimumNArgs(2),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return updateTags(address, api.TagRequest{
+				Path:      args[0],
+				Recursive: recursive,
+				Remove:    args[1:],
+			})
+		},
+	}
+
+	cmd.Flags().StringVar(&address, "address", "", "Address of the agent API (defaults to api.address of the configuration)")
+	cmd.Flags().BoolVarP(&recursive, "recursive", "r", false, "Remove the tags of all files below the path")
+
+	return cmd
+}
+
+// updateTags sends the tag changes to the agent and prints the number of changed files
+func updateTags(address string, req api.TagRequest) error {
+	req.Path = absTagPath(req.Path)
+
+	client, err := newAgentClient(address)
+	if err != nil {
+		return err
+	}
+
+	ctx, cancel := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer cancel()
+
+	resp, err := client.SetTags(ctx, req)
+	if err != nil {
+		return i18n.Errorf("tag.update_failed", req.Path, err)
+	}
+
+	fmt.Println(i18n.T("tag.updated", resp.Files, resp.Path))
+	return nil
+}
+
+func NewTagListCommand() *cobra.Command {
+	var address string
+	var recursive bool
+	var format string
+
+	cmd := &cobra.Command{
+		Use:   "ls <path>",
+		Short: "List the tags of a file",
+		Args:  cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if format != "table" && format != "json" {
+				return i18n.Errorf("error.unsupported_format", format)
+			}
+			p := absTagPath(args[0])
+
+			client, err := newAgentClient(address)
+			if err != nil {
+				return err
+			}
+
+			ctx, cancel := signal.NotifyContext(context.Background(), os.Interrupt)
+			defer cancel()
+
+			files, err := client.Tags(ctx, p, recursive)
+			if err != nil {
+				return i18n.Errorf("tag.list_failed", p, err)
+			}
+			return printFileTags(files, format)
+		},
+	}
+
+	cmd.Flags().StringVar(&address, "address", "", "Address of the agent API (defaults to api.address of the configuration)")
+	cmd.Flags().BoolVarP(&recursive, "recursive", "r", false, "List the tags of all files below the path")
+	cmd.Flags().StringVarP(&format, "format", "o", "table", "Output format (table, json)")
+
+	return cmd
+}
+
+func NewFindCommand() *cobra.Command {
+	var address string
+	var tags []string
+	var has []string
+	var within string
+	var modifiedAfter string
+	var modifiedBefore string
+	var minSize string
+	var maxSize string
+	var hash string
+	var glob string
+	var query string
+	var sortBy string
+	var descending bool
+	var limit int
+	var offset int
+	var cursor string
+	var format string
+
+	cmd := &cobra.Command{
+		Use:   "find",
+		Short: "Find files by their tags, name, modification time, size or hash",
+		Long: `Lists all files tracked by the running agent matching all filters, e.g. having the tags provided with --tag,
+optionally limited to the files below --path. The filters are applied by the agent, so only matching files are
+returned. Results are returned in pages of at most --limit files; the command prints the cursor to continue with
+if more files match, or reads all pages if --limit is 0.`,
+		Args: cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if format != "table" && format != "json" {
+				return i18n.Errorf("error.unsupported_format", format)
+			}
+
+			req := api.FindRequest{
+				HasTags:    has,
+				Path:       within,
+				Hash:       strings.ToLower(hash),
+				Glob:       glob,
+				Query:      query,
+				Sort:       sortBy,
+				Descending: descending,
+				Limit:      limit,
+				Offset:     offset,
+				Cursor:     cursor,
+			}
+			var err error
+			if req.Tags, err = parseTags(tags); err != nil {
+				return err
+			}
+			if req.Path != "" {
+				req.Path = absTagPath(req.Path)
+			}
+
+			now := time.Now()
+			if req.ModifiedAfter, err = parseSince(modifiedAfter, now); err != nil {
+				return err
+			}
+			if req.ModifiedBefore, err = parseSince(modifiedBefore, now); err != nil {
+				return err
+			}
+			if minSize != "" {
+				if req.MinSize, err = filter.ParseSize(minSize); err != nil {
+					return err
+				}
+			}
+			if maxSize != "" {
+				if req.MaxSize, err = filter.ParseSize(maxSize); err != nil {
+					return err
+				}
+			}
+
+			client, err := newAgentClient(address)
+			if err != nil {
+				return err
+			}
+
+			ctx, cancel := signal.NotifyContext(context.Background(), os.Interrupt)
+			defer cancel()
+
+			var files []api.FileTags
+			var next string
+			for {
+				page, err := client.Find(ctx, req)
+				if err != nil {
+					return i18n.Errorf("tag.find_failed", err)
+				}
+				files, next = append(files, page.Files...), page.Next
+
+				// Without a limit all pages are read, each continuing after the last file of the previous one
+				if next == "" || limit > 0 {
+					break
+				}
+				req.Cursor, req.Offset = next, 0
+			}
+
+			if err := printFileTags(files, format); err != nil {
+				return err
+			}
+			if next != "" {
+				fmt.Fprintln(os.Stderr, i18n.T("tag.find_more", next))
+			}
+			return nil
+		},
+	}
+
+	cmd.Flags().StringVar(&address, "address", "", "Address of the agent API (defaults to api.address of the configuration)")
+	cmd.Flags().StringArrayVarP(&tags, "tag", "t", nil, "Tag the files must have as key=value (repeatable)")
+	cmd.Flags().StringArrayVar(&has, "has", nil, "Key of a tag the files must have, regardless of its value (repeatable)")
+	cmd.Flags().StringVar(&within, "path", "", "Only find files below this virtual or local path")
+	cmd.Flags().StringVar(&modifiedAfter, "modified-after", "", "Only find files modified after this time or duration ago (e.g. 2024-05-01, 7d)")
+	cmd.Flags().StringVar(&modifiedBefore, "modified-before", "", "Only find files modified before this time or duration ago (e.g. 2024-05-01, 7d)")
+	cmd.Flags().StringVar(&minSize, "min-size", "", "Only find files of at least this size (e.g. 10MB)")
+	cmd.Flags().StringVar(&maxSize, "max-size", "", "Only find files of at most this size (e.g. 1.5GB)")
+	cmd.Flags().StringVar(&hash, "hash", "", "Only find files with this MD5 or SHA256 checksum")
+	cmd.Flags().StringVar(&glob, "glob", "", "Only find files whose name, or path within the backend if it contains a slash, matches this glob (e.g. '*.jpg')")
+	cmd.Flags().StringVarP(&query, "query", "q", "", "Only find files matching this filter expression (e.g. 'tag:rating>=4 AND NOT tag:archived')")
+	cmd.Flags().StringVar(&sortBy, "sort", "path", "Order of the files (path, size, modified)")
+	cmd.Flags().BoolVar(&descending, "desc", false, "Sort in descending order")
+	cmd.Flags().IntVar(&limit, "limit", 100, "Maximum number of files returned (0 = all pages)")
+	cmd.Flags().IntVar(&offset, "offset", 0, "Number of matching files skipped")
+	cmd.Flags().StringVar(&cursor, "cursor", "", "Continue after the last file of a previous page, as printed by find")
+	cmd.Flags().StringVarP(&format, "format", "o", "table", "Output format (table, json)")
+
+	return cmd
+}
+
+// parseTags parses key=value arguments
+func parseTags(args []string) (map[string]string, error) {
+	tags := make(map[string]string, len(args))
+	for _, arg := range args {
+		key, value, ok := strings.Cut(arg, "=")
+		if !ok || key == "" {
+			return nil, i18n.Errorf("tag.invalid", arg)
+		}
+		tags[key] = value
+	}
+	return tags, nil
+}
+
+// absTagPath makes local paths absolute, since the agent may run within a different working directory
+func absTagPath(p string) string {
+	if !engine.IsLocalPath(p) {
+		return p
+	}
+	if abs, err := filepath.Abs(p); err == nil {
+		return abs
+	}
+	return p
+}
+
+func printFileTags(files []api.FileTags, format string) error {
+	if format == "json" {
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		return enc.Encode(files)
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, i18n.T("tag.header"))
+	for _, file := range files {
+		keys := make([]string, 0, len(file.Tags))
+		for key := range file.Tags {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+
+		tags := make([]string, 0, len(keys))
+		for _, key := range keys {
+			tags = append(tags, key+"="+file.Tags[key])
+		}
+		if len(tags) == 0 {
+			tags = append(tags, "-")
+		}
+
+		modified := "-"
+		if !file.ModifiedAt.IsZero() {
+			modified = file.ModifiedAt.Local().Format(time.DateTime)
+		}
+		fmt.Fprintf(w, "%s\t%d\t%s\t%s\n", file.Path, file.Size, modified, strings.Join(tags, ", "))
+	}
+	return w.Flush()
+}
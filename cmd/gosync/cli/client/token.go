@@ -0,0 +1,149 @@
+package client
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"text/tabwriter"
+	"time"
+
+	"github.com/mwantia/gosync/internal/i18n"
+	"github.com/mwantia/gosync/pkg/auth"
+	"github.com/mwantia/gosync/pkg/db/models"
+	"github.com/spf13/cobra"
+)
+
+func NewTokenCommand() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "token",
+		Short: "Manage API tokens",
+		Long:  "Create, list or revoke the bearer tokens used to authenticate against the agent API if api.auth is enabled.",
+	}
+
+	cmd.AddCommand(NewTokenCreateCommand())
+	cmd.AddCommand(NewTokenListCommand())
+	cmd.AddCommand(NewTokenRevokeCommand())
+
+	return cmd
+}
+
+func NewTokenCreateCommand() *cobra.Command {
+	var scope string
+	var ttl time.Duration
+
+	cmd := &cobra.Command{
+		Use:   "create <name>",
+		Short: "Create an API token",
+		Long:  "Creates a token with the scope read-only (status), sync-control (running and refreshing syncs) or admin (all requests). Only a hash of the token is stored, so it is shown once.",
+		Args:  cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			parsed, err := auth.ParseScope(scope)
+			if err != nil {
+				return err
+			}
+
+			ctx := context.Background()
+
+			ms, err := openMetadataStore(ctx)
+			if err != nil {
+				return err
+			}
+			defer ms.Close()
+
+			token, record, err := auth.NewTokens(ms).Create(ctx, args[0], parsed, ttl)
+			if err != nil {
+				return err
+			}
+
+			fmt.Println(i18n.T("token.created", record.Name, record.Scope))
+			fmt.Println(token)
+			fmt.Fprintln(os.Stderr, i18n.T("token.created_hint"))
+			return nil
+		},
+	}
+
+	cmd.Flags().StringVar(&scope, "scope", string(auth.ScopeReadOnly), "Scope of the token (read-only, sync-control, admin)")
+	cmd.Flags().DurationVar(&ttl, "ttl", 0, "Duration after which the token expires (never if 0)")
+
+	return cmd
+}
+
+func NewTokenListCommand() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "ls",
+		Short: "List API tokens",
+		Long:  "List all API tokens, including expired and revoked tokens.",
+		Args:  cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			ctx := context.Background()
+
+			ms, err := openMetadataStore(ctx)
+			if err != nil {
+				return err
+			}
+			defer ms.Close()
+
+			tokens, err := auth.NewTokens(ms).List(ctx)
+			if err != nil {
+				return err
+			}
+
+			now := time.Now()
+			w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+			fmt.Fprintln(w, i18n.T("token.header"))
+			for _, token := range tokens {
+				fmt.Fprintf(w, "%s\t%s...\t%s\t%s\t%s\t%s\t%s\n", token.Name, token.Prefix, token.Scope,
+					token.CreatedAt.Local().Format(time.DateTime), formatOptionalTime(token.ExpiresAt),
+					formatOptionalTime(token.LastUsedAt), tokenStatus(token, now))
+			}
+			return w.Flush()
+		},
+	}
+
+	return cmd
+}
+
+func NewTokenRevokeCommand() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "revoke <name>",
+		Short: "Revoke an API token",
+		Long:  "Revokes a token, so requests using it are rejected. Revoked tokens are kept for auditing.",
+		Args:  cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			ctx := context.Background()
+
+			ms, err := openMetadataStore(ctx)
+			if err != nil {
+				return err
+			}
+			defer ms.Close()
+
+			if err := auth.NewTokens(ms).Revoke(ctx, args[0]); err != nil {
+				return err
+			}
+
+			fmt.Println(i18n.T("token.revoked", args[0]))
+			return nil
+		},
+	}
+
+	return cmd
+}
+
+func formatOptionalTime(t *time.Time) string {
+	if t == nil {
+		return i18n.T("token.never")
+	}
+	return t.Local().Format(time.DateTime)
+}
+
+func tokenStatus(token models.APIToken, now time.Time) string {
+	switch {
+	case token.RevokedAt != nil:
+		return i18n.T("token.revoked_status")
+	case token.ExpiresAt != nil && now.After(*token.ExpiresAt):
+		return i18n.T("token.expired")
+	default:
+		return i18n.T("token.active")
+	}
+}
@@ -0,0 +1,163 @@
+package client
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"strconv"
+	"text/tabwriter"
+
+	"github.com/mwantia/gosync/internal/api"
+	"github.com/mwantia/gosync/internal/i18n"
+	"github.com/mwantia/gosync/pkg/engine"
+	"github.com/spf13/cobra"
+)
+
+func NewTransferCommand() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "transfer",
+		Short: "Inspect and cancel the in-flight transfers of the running agent",
+		Long: `In-flight transfers keep the ID they had within the queue of their pass ("gosync queue ls").
+Cancelling them aborts the transfer without affecting the rest of the pass.`,
+	}
+
+	cmd.AddCommand(NewTransferListCommand())
+	cmd.AddCommand(NewTransferCancelCommand())
+
+	return cmd
+}
+
+func NewTransferListCommand() *cobra.Command {
+	var address string
+	var format string
+
+	cmd := &cobra.Command{
+		Use:   "ls",
+		Short: "List the in-flight transfers of all running passes",
+		Args:  cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if format != "table" && format != "json" {
+				return i18n.Errorf("error.unsupported_format", format)
+			}
+
+			client, err := newAgentClient(address)
+			if err != nil {
+				return err
+			}
+
+			status, err := client.Status(context.Background())
+			if err != nil {
+				return err
+			}
+
+			type row struct {
+				Sync string `json:"sync"`
+				engine.Transfer
+			}
+			var rows []row
+			for _, p := range status.Syncs {
+				for _, t := range p.Active {
+					rows = append(rows, row{Sync: p.Name, Transfer: t})
+				}
+			}
+
+			if format == "json" {
+				enc := json.NewEncoder(os.Stdout)
+				enc.SetIndent("", "  ")
+				return enc.Encode(rows)
+			}
+			if len(rows) == 0 {
+				fmt.Println(i18n.T("transfer.empty"))
+				return nil
+			}
+
+			w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+			fmt.Fprintln(w, i18n.T("transfer.header"))
+			for _, r := range rows {
+				fmt.Fprintf(w, "%d\t%s\t%s\t%s/%s\t%s\n", r.ID, r.Sync, r.Type, formatSize(r.BytesDone, true), formatSize(r.Size, true), r.Path)
+			}
+			return w.Flush()
+		},
+	}
+
+	cmd.Flags().StringVar(&address, "address", "", "Address of the agent API (defaults to api.address of the configuration)")
+	cmd.Flags().StringVarP(&format, "format", "o", "table", "Output format (table, json)")
+
+	return cmd
+}
+
+func NewTransferCancelCommand() *cobra.Command {
+	var address string
+	var format string
+	var path string
+	var sync string
+	var requeue bool
+
+	cmd := &cobra.Command{
+		Use:   "cancel [id]",
+		Short: "Cancel a queued or in-flight transfer, or all transfers below a path",
+		Long: `Cancels the transfer with the ID, or with --path all transfers of the path and the paths below it,
+relative to their sync. Queued transfers are removed from their pass, in-flight transfers are aborted and
+their incomplete multipart uploads are discarded. Cancelled paths stay unsynced until the next pass.
+
+With --requeue in-flight transfers are restarted once the other queued transfers of their pass were
+started instead, keeping interrupted delta uploads for resuming them.`,
+		Args: cobra.MaximumNArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if format != "table" && format != "json" {
+				return i18n.Errorf("error.unsupported_format", format)
+			}
+
+			req := api.CancelRequest{Path: path, Sync: sync, Requeue: requeue}
+			if len(args) == 1 {
+				id, err := strconv.ParseUint(args[0], 10, 64)
+				if err != nil {
+					return i18n.Errorf("queue.invalid_id", args[0])
+				}
+				req.ID = id
+			}
+			if (req.ID == 0) == (path == "" && sync == "") {
+				return i18n.Errorf("transfer.invalid_selection")
+			}
+
+			client, err := newAgentClient(address)
+			if err != nil {
+				return err
+			}
+
+			cancelled, err := client.CancelTransfers(context.Background(), req)
+			if err != nil {
+				return i18n.Errorf("transfer.cancel_failed", err)
+			}
+
+			if format == "json" {
+				enc := json.NewEncoder(os.Stdout)
+				enc.SetIndent("", "  ")
+				return enc.Encode(cancelled)
+			}
+
+			w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+			fmt.Fprintln(w, i18n.T("transfer.cancelled_header"))
+			for _, t := range cancelled {
+				state := i18n.T("transfer.state_queued")
+				switch {
+				case t.Requeued:
+					state = i18n.T("transfer.state_requeued")
+				case t.InFlight:
+					state = i18n.T("transfer.state_aborted")
+				}
+				fmt.Fprintf(w, "%d\t%s\t%s\t%s\t%s\n", t.ID, t.Sync, t.Type, state, t.Path)
+			}
+			return w.Flush()
+		},
+	}
+
+	cmd.Flags().StringVar(&address, "address", "", "Address of the agent API (defaults to api.address of the configuration)")
+	cmd.Flags().StringVarP(&format, "format", "o", "table", "Output format (table, json)")
+	cmd.Flags().StringVar(&path, "path", "", "Cancel all transfers of the path and below it, relative to their sync")
+	cmd.Flags().StringVar(&sync, "sync", "", "Only cancel transfers of the sync (all of them without --path)")
+	cmd.Flags().BoolVar(&requeue, "requeue", false, "Restart in-flight transfers later in their pass instead of dropping them")
+
+	return cmd
+}
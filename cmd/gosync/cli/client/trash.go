@@ -0,0 +1,207 @@
+package client
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"text/tabwriter"
+	"time"
+
+	"github.com/mwantia/gosync/internal/i18n"
+	"github.com/mwantia/gosync/pkg/backend"
+	"github.com/mwantia/gosync/pkg/db/models"
+	"github.com/mwantia/gosync/pkg/db/store"
+	"github.com/mwantia/gosync/pkg/vfs"
+	"github.com/spf13/cobra"
+)
+
+func NewTrashCommand() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "trash",
+		Short: "Manage trashed remote objects",
+		Long:  "List, restore or purge remote objects that have been moved into the trash of a backend.",
+	}
+
+	cmd.AddCommand(NewTrashListCommand())
+	cmd.AddCommand(NewTrashRestoreCommand())
+	cmd.AddCommand(NewTrashPurgeCommand())
+
+	return cmd
+}
+
+func NewTrashListCommand() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "ls <backend>[/prefix]",
+		Short: "List trashed objects",
+		Long:  "List all trashed objects of a backend, optionally limited to a path prefix.",
+		Args:  cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			path := vfs.ParsePath(args[0])
+			ctx := context.Background()
+
+			ms, err := openMetadataStore(ctx)
+			if err != nil {
+				return err
+			}
+			defer ms.Close()
+
+			items, err := ms.ListTrashItems(ctx, path.Backend, path.Key)
+			if err != nil {
+				return fmt.Errorf("failed to list trash items: %w", err)
+			}
+
+			w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+			fmt.Fprintln(w, i18n.T("trash.header"))
+			for _, item := range items {
+				expires := "never"
+				if !item.ExpiresAt.IsZero() {
+					expires = item.ExpiresAt.Local().Format(time.DateTime)
+				}
+				fmt.Fprintf(w, "%d\t%s\t%s\t%d\t%s\n", item.ID, item.TrashedAt.Local().Format(time.DateTime), expires, item.Size, item.Path)
+			}
+			return w.Flush()
+		},
+	}
+
+	return cmd
+}
+
+func NewTrashRestoreCommand() *cobra.Command {
+	var id uint
+	var force bool
+
+	cmd := &cobra.Command{
+		Use:   "restore <backend>/<path>",
+		Short: "Restore trashed objects",
+		Long:  "Restore the most recently trashed version of an object (or a specific trash item) to its original path.",
+		Args:  cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			path := vfs.ParsePath(args[0])
+			if path.IsRoot() || (path.IsBackend() && id == 0) {
+				return fmt.Errorf("a path or --id is required to restore trash items")
+			}
+
+			ctx := context.Background()
+
+			ms, err := openMetadataStore(ctx)
+			if err != nil {
+				return err
+			}
+			defer ms.Close()
+
+			if err := checkMaintenance(ctx, ms); err != nil {
+				return err
+			}
+
+			trash, b, flush, err := openTrash(ctx, ms, path.Backend)
+			if err != nil {
+				return err
+			}
+			defer flush()
+
+			item, err := findTrashItem(ctx, ms, b, path, id)
+			if err != nil {
+				return err
+			}
+
+			if err := trash.Restore(ctx, item, force); err != nil {
+				return err
+			}
+
+			fmt.Printf("Restored '%s/%s' (trashed at %s)\n", b.ID, item.Path, item.TrashedAt.Local().Format(time.DateTime))
+			return nil
+		},
+	}
+
+	cmd.Flags().UintVar(&id, "id", 0, "Restore a specific trash item by its ID")
+	cmd.Flags().BoolVarP(&force, "force", "f", false, "Overwrite existing objects at the original path")
+
+	return cmd
+}
+
+func NewTrashPurgeCommand() *cobra.Command {
+	var all bool
+
+	cmd := &cobra.Command{
+		Use:   "purge <backend>",
+		Short: "Purge trashed objects",
+		Long:  "Permanently delete expired trash items of a backend, or all of them using --all.",
+		Args:  cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			path := vfs.ParsePath(args[0])
+			ctx := context.Background()
+
+			ms, err := openMetadataStore(ctx)
+			if err != nil {
+				return err
+			}
+			defer ms.Close()
+
+			if err := checkMaintenance(ctx, ms); err != nil {
+				return err
+			}
+
+			trash, b, flush, err := openTrash(ctx, ms, path.Backend)
+			if err != nil {
+				return err
+			}
+			defer flush()
+
+			purged := 0
+			if all {
+				items, lerr := ms.ListTrashItems(ctx, b.ID, path.Key)
+				if lerr != nil {
+					return fmt.Errorf("failed to list trash items: %w", lerr)
+				}
+				purged, err = trash.Purge(ctx, items)
+			} else {
+				purged, err = trash.PurgeExpired(ctx, time.Now().UTC())
+			}
+
+			fmt.Printf("Purged %d trash items of backend '%s'\n", purged, b.ID)
+			return err
+		},
+	}
+
+	cmd.Flags().BoolVar(&all, "all", false, "Purge all trash items, including those not expired yet")
+
+	return cmd
+}
+
+func openTrash(ctx context.Context, ms store.MetadataStore, backendID string) (*backend.Trash, *models.Backend, func(), error) {
+	b, err := ms.GetBackend(ctx, backendID)
+	if err != nil {
+		return nil, nil, nil, fmt.Errorf("failed to find backend '%s': %w", backendID, err)
+	}
+
+	st, flush, err := openStorage(ms, b)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+
+	return backend.NewTrash(ms, st, b), b, flush, nil
+}
+
+func findTrashItem(ctx context.Context, ms store.MetadataStore, b *models.Backend, path vfs.Path, id uint) (*models.TrashItem, error) {
+	if id != 0 {
+		item, err := ms.GetTrashItem(ctx, id)
+		if err != nil || item.BackendID != b.ID {
+			return nil, fmt.Errorf("failed to find trash item %d in backend '%s'", id, b.ID)
+		}
+		return item, nil
+	}
+
+	items, err := ms.ListTrashItems(ctx, b.ID, path.Key)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list trash items: %w", err)
+	}
+
+	// Items are ordered by trash time, so the first exact match is the latest one
+	for i := range items {
+		if items[i].Path == path.Key {
+			return &items[i], nil
+		}
+	}
+
+	return nil, fmt.Errorf("no trash item found for '%s'", path)
+}
@@ -0,0 +1,334 @@
+//go:build !darwin || cgo
+
+package client
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"fyne.io/systray"
+	"github.com/mwantia/gosync/internal/api"
+	"github.com/mwantia/gosync/internal/i18n"
+	"github.com/spf13/cobra"
+)
+
+// trayActivityItems is the number of entries shown below "Recent activity"
+const trayActivityItems = 5
+
+func NewTrayCommand() *cobra.Command {
+	var address string
+	var interval time.Duration
+
+	cmd := &cobra.Command{
+		Use:   "tray",
+		Short: "Show the sync status in the system tray",
+		Long:  "Show a system tray icon with the current sync status and recent activity of the agent, allowing to pause and resume syncing and to open synced folders.",
+		Args:  cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if interval <= 0 {
+				return fmt.Errorf("%s", i18n.T("status.interval_positive"))
+			}
+
+			client, err := newAgentClient(address)
+			if err != nil {
+				return err
+			}
+
+			t := &tray{
+				client:   client,
+				interval: interval,
+				update:   make(chan struct{}, 1),
+				folders:  make(map[string]*systray.MenuItem),
+			}
+			// Run blocks until the tray is closed and must be called from the main goroutine
+			systray.Run(t.ready, t.exit)
+			return nil
+		},
+	}
+
+	cmd.Flags().StringVar(&address, "address", "", "Address of the agent API (defaults to api.address)")
+	cmd.Flags().DurationVar(&interval, "interval", 5*time.Second, "Interval in which the status is refreshed")
+
+	return cmd
+}
+
+// tray shows the status of the agent as a system tray icon
+type tray struct {
+	mutex    sync.Mutex
+	client   *api.Client
+	interval time.Duration
+	cancel   context.CancelFunc
+	paused   bool
+	// update requests an immediate refresh, e.g. after pausing
+	update chan struct{}
+
+	status   *systray.MenuItem
+	activity []*systray.MenuItem
+	pause    *systray.MenuItem
+	open     *systray.MenuItem
+	empty    *systray.MenuItem
+	folders  map[string]*systray.MenuItem
+}
+
+func (t *tray) ready() {
+	ctx, cancel := context.WithCancel(context.Background())
+	t.cancel = cancel
+
+	systray.SetIcon(trayIcon(trayGray))
+	systray.SetTitle(i18n.T("tray.title"))
+	systray.SetTooltip(i18n.T("tray.title"))
+
+	t.status = systray.AddMenuItem(i18n.T("tray.connecting"), "")
+	t.status.Disable()
+
+	recent := systray.AddMenuItem(i18n.T("tray.activity"), "")
+	for range trayActivityItems {
+		item := recent.AddSubMenuItem("", "")
+		item.Disable()
+		item.Hide()
+		t.activity = append(t.activity, item)
+	}
+
+	systray.AddSeparator()
+	t.pause = systray.AddMenuItem(i18n.T("tray.pause"), "")
+	t.pause.Disable()
+	t.open = systray.AddMenuItem(i18n.T("tray.open_folder"), "")
+	t.empty = t.open.AddSubMenuItem(i18n.T("tray.no_folders"), "")
+	t.empty.Disable()
+
+	systray.AddSeparator()
+	quit := systray.AddMenuItem(i18n.T("tray.quit"), "")
+
+	go func() {
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-quit.ClickedCh:
+				systray.Quit()
+				return
+			case <-t.pause.ClickedCh:
+				t.togglePause(ctx)
+				select {
+				case t.update <- struct{}{}:
+				default:
+				}
+			}
+		}
+	}()
+
+	// The menu is only updated by this goroutine
+	go func() {
+		ticker := time.NewTicker(t.interval)
+		defer ticker.Stop()
+
+		for {
+			t.refresh(ctx)
+
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			case <-t.update:
+			}
+		}
+	}()
+}
+
+func (t *tray) exit() {
+	if t.cancel != nil {
+		t.cancel()
+	}
+}
+
+// refresh updates the icon and menu with the current status of the agent
+func (t *tray) refresh(parent context.Context) {
+	ctx, cancel := context.WithTimeout(parent, t.interval)
+	defer cancel()
+
+	status, err := t.client.Status(ctx)
+	if err != nil {
+		// The tray is closing
+		if parent.Err() != nil {
+			return
+		}
+		systray.SetIcon(trayIcon(trayRed))
+		systray.SetTooltip(i18n.T("tray.unreachable", err))
+		t.status.SetTitle(i18n.T("tray.unreachable", err))
+		t.pause.Disable()
+		return
+	}
+
+	t.mutex.Lock()
+	t.paused = status.Maintenance != nil && status.Maintenance.Enabled
+	paused := t.paused
+	t.mutex.Unlock()
+
+	summary, icon := traySummary(status, paused)
+	systray.SetIcon(trayIcon(icon))
+	systray.SetTooltip(i18n.T("tray.title") + ": " + summary)
+	t.status.SetTitle(summary)
+
+	t.pause.Enable()
+	if paused {
+		t.pause.SetTitle(i18n.T("tray.resume"))
+	} else {
+		t.pause.SetTitle(i18n.T("tray.pause"))
+	}
+
+	entries := trayActivity(status)
+	for i, item := range t.activity {
+		switch {
+		case i < len(entries):
+			item.SetTitle(entries[i])
+			item.Show()
+		case i == 0:
+			item.SetTitle(i18n.T("tray.no_activity"))
+			item.Show()
+		default:
+			item.Hide()
+		}
+	}
+
+	t.updateFolders(status.Folders)
+}
+
+// updateFolders adds menu items for new folders and hides the items of removed ones, since items can't be reordered
+func (t *tray) updateFolders(folders []api.SyncFolder) {
+	visible := make(map[string]bool)
+	for _, folder := range folders {
+		visible[folder.Path] = true
+
+		if item, ok := t.folders[folder.Path]; ok {
+			item.Show()
+			continue
+		}
+
+		item := t.open.AddSubMenuItem(folder.Sync+": "+folder.Path, folder.Path)
+		t.folders[folder.Path] = item
+		go func(path string) {
+			for range item.ClickedCh {
+				if err := openFolder(path); err != nil {
+					fmt.Fprintln(os.Stderr, i18n.T("tray.open_failed", path, err))
+				}
+			}
+		}(folder.Path)
+	}
+
+	for path, item := range t.folders {
+		if !visible[path] {
+			item.Hide()
+		}
+	}
+	if len(folders) > 0 {
+		t.empty.Hide()
+	} else {
+		t.empty.Show()
+	}
+}
+
+// togglePause pauses syncing by enabling the maintenance mode of the agent, or resumes it again
+func (t *tray) togglePause(ctx context.Context) {
+	t.mutex.Lock()
+	req := api.MaintenanceRequest{Enabled: !t.paused}
+	t.mutex.Unlock()
+	if req.Enabled {
+		req.Reason = i18n.T("tray.pause_reason")
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, t.interval)
+	defer cancel()
+
+	if _, err := t.client.SetMaintenance(ctx, req); err != nil {
+		fmt.Fprintln(os.Stderr, i18n.T("tray.pause_failed", err))
+	}
+}
+
+// traySummary returns the status line and icon color for the status of the agent
+func traySummary(status *api.Status, paused bool) (string, trayColor) {
+	switch {
+	case paused:
+		if status.Maintenance.Reason != "" {
+			return i18n.T("tray.paused_reason", status.Maintenance.Reason), trayOrange
+		}
+		return i18n.T("tray.paused"), trayOrange
+	case len(status.Syncs) == 1:
+		p := status.Syncs[0]
+		return i18n.T("tray.syncing", p.Name, p.Completed+p.Failed, p.Actions), trayBlue
+	case len(status.Syncs) > 1:
+		return i18n.T("tray.syncing_many", len(status.Syncs)), trayBlue
+	case len(status.Errors) > 0:
+		return i18n.T("tray.errors", len(status.Errors)), trayRed
+	default:
+		return i18n.T("tray.idle"), trayGreen
+	}
+}
+
+// trayActivity returns the latest finished passes and errors, newest first
+func trayActivity(status *api.Status) []string {
+	type entry struct {
+		time time.Time
+		text string
+	}
+
+	var entries []entry
+	for _, s := range status.Scheduled {
+		if run := s.LastRun; run != nil {
+			entries = append(entries, entry{run.FinishedAt, i18n.T("tray.activity_run",
+				s.Name, run.Uploaded, run.Downloaded, run.Deleted, run.FinishedAt.Local().Format(time.TimeOnly))})
+		}
+	}
+	for _, e := range status.Errors {
+		subject := e.Sync
+		if e.Path != "" {
+			subject += "/" + e.Path
+		}
+		entries = append(entries, entry{e.Time, i18n.T("tray.activity_error",
+			subject, e.Error, e.Time.Local().Format(time.TimeOnly))})
+	}
+
+	sort.SliceStable(entries, func(i, j int) bool {
+		return entries[i].time.After(entries[j].time)
+	})
+
+	result := make([]string, 0, trayActivityItems)
+	for i := 0; i < len(entries) && i < trayActivityItems; i++ {
+		result = append(result, entries[i].text)
+	}
+	return result
+}
+
+// openFolder opens the directory in the file manager of the desktop
+func openFolder(path string) error {
+	if rest, ok := strings.CutPrefix(path, "~"); ok {
+		home, err := os.UserHomeDir()
+		if err != nil {
+			return err
+		}
+		path = filepath.Join(home, rest)
+	}
+
+	var cmd *exec.Cmd
+	switch runtime.GOOS {
+	case "windows":
+		cmd = exec.Command("explorer", path)
+	case "darwin":
+		cmd = exec.Command("open", path)
+	default:
+		cmd = exec.Command("xdg-open", path)
+	}
+	if err := cmd.Start(); err != nil {
+		return err
+	}
+	// The file manager may keep running, so only release the process once it exits
+	go cmd.Wait()
+	return nil
+}
@@ -0,0 +1,71 @@
+//go:build !darwin || cgo
+
+package client
+
+import (
+	"bytes"
+	"encoding/binary"
+	"image"
+	"image/color"
+	"image/png"
+	"runtime"
+	"sync"
+)
+
+// trayColor is the color of the tray icon, reflecting the status of the agent
+type trayColor color.RGBA
+
+var (
+	trayGray   = trayColor{R: 0x9e, G: 0x9e, B: 0x9e, A: 0xff}
+	trayGreen  = trayColor{R: 0x43, G: 0xa0, B: 0x47, A: 0xff}
+	trayBlue   = trayColor{R: 0x1e, G: 0x88, B: 0xe5, A: 0xff}
+	trayOrange = trayColor{R: 0xfb, G: 0x8c, B: 0x00, A: 0xff}
+	trayRed    = trayColor{R: 0xe5, G: 0x39, B: 0x35, A: 0xff}
+)
+
+// trayIconSize is the size of the generated icons in pixels, which are scaled down by the desktop
+const trayIconSize = 32
+
+var trayIcons sync.Map
+
+// trayIcon returns a filled circle of the color, encoded as ICO on Windows and as PNG otherwise
+func trayIcon(c trayColor) []byte {
+	if icon, ok := trayIcons.Load(c); ok {
+		return icon.([]byte)
+	}
+
+	img := image.NewRGBA(image.Rect(0, 0, trayIconSize, trayIconSize))
+	center := float64(trayIconSize-1) / 2
+	radius := float64(trayIconSize)/2 - 1
+	for y := range trayIconSize {
+		for x := range trayIconSize {
+			dx, dy := float64(x)-center, float64(y)-center
+			if dx*dx+dy*dy <= radius*radius {
+				img.Set(x, y, color.RGBA(c))
+			}
+		}
+	}
+
+	var buf bytes.Buffer
+	png.Encode(&buf, img)
+	icon := buf.Bytes()
+	if runtime.GOOS == "windows" {
+		icon = wrapICO(icon)
+	}
+
+	trayIcons.Store(c, icon)
+	return icon
+}
+
+// wrapICO embeds the PNG into an ICO container with a single image, as required by Windows
+func wrapICO(data []byte) []byte {
+	var buf bytes.Buffer
+	// ICONDIR: reserved, type (1 = icon), number of images
+	binary.Write(&buf, binary.LittleEndian, []uint16{0, 1, 1})
+	// ICONDIRENTRY: width, height, palette size, reserved, planes, bits per pixel, size and offset of the image
+	buf.Write([]byte{trayIconSize, trayIconSize, 0, 0})
+	binary.Write(&buf, binary.LittleEndian, []uint16{1, 32})
+	binary.Write(&buf, binary.LittleEndian, []uint32{uint32(len(data)), 6 + 16})
+	buf.Write(data)
+	return buf.Bytes()
+}
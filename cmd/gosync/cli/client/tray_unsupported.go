@@ -0,0 +1,22 @@
+//go:build darwin && !cgo
+
+package client
+
+import (
+	"fmt"
+
+	"github.com/mwantia/gosync/internal/i18n"
+	"github.com/spf13/cobra"
+)
+
+// NewTrayCommand is only available with cgo on macOS, since the menu bar is accessed via Cocoa
+func NewTrayCommand() *cobra.Command {
+	return &cobra.Command{
+		Use:   "tray",
+		Short: "Show the sync status in the system tray",
+		Args:  cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return fmt.Errorf("%s", i18n.T("tray.unsupported"))
+		},
+	}
+}
@@ -0,0 +1,124 @@
+package client
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"os/signal"
+	"text/tabwriter"
+
+	"github.com/mwantia/gosync/internal/i18n"
+	"github.com/mwantia/gosync/pkg/engine"
+	"github.com/mwantia/gosync/pkg/vfs"
+	"github.com/spf13/cobra"
+)
+
+func NewVerifyCommand() *cobra.Command {
+	var samples int
+	var maxFileSize int64
+	var format string
+
+	cmd := &cobra.Command{
+		Use:   "verify <sync|backend[/path]>",
+		Short: "Audit the integrity of a sync or backend",
+		Long: `Walks all files of a sync or below a virtual path and compares them with the metadata store: recorded
+objects must exist with their recorded ETags, and the local files of a sync are re-hashed and compared with the
+hashes recorded for their source. With --samples a random sample of objects is downloaded and re-hashed as well.
+
+Files are reported as missing, as corrupted if their content doesn't match the recorded hashes, or as drifted
+if they were changed or added without being synced. The command fails if any file is reported.`,
+		Args: cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if format != "table" && format != "json" {
+				return i18n.Errorf("error.unsupported_format", format)
+			}
+
+			ctx, cancel := signal.NotifyContext(context.Background(), os.Interrupt)
+			defer cancel()
+
+			ms, err := openMetadataStore(ctx)
+			if err != nil {
+				return err
+			}
+			defer ms.Close()
+
+			opts := engine.AuditOptions{
+				Samples:     samples,
+				MaxFileSize: maxFileSize << 20,
+			}
+			report := &engine.AuditReport{}
+
+			// Syncs take precedence over backends with the same name
+			roots := []vfs.Path{vfs.ParsePath(args[0])}
+			sc, err := ms.GetSyncConfig(ctx, args[0])
+			if err == nil {
+				clientID, err := currentClientID(ctx, ms)
+				if err != nil {
+					return err
+				}
+				if err := engine.AuditLocal(ctx, ms, sc, clientID, report); err != nil {
+					return err
+				}
+				roots = engine.RemoteRoots(sc, clientID)
+			}
+
+			for _, root := range roots {
+				b, err := ms.GetBackend(ctx, root.Backend)
+				if err != nil {
+					return i18n.Errorf("verify.not_found", args[0])
+				}
+
+				st, flush, err := openStorage(ms, b)
+				if err != nil {
+					return err
+				}
+				err = engine.AuditRemote(ctx, ms, st, b, root.Key, opts, report)
+				flush()
+				if err != nil {
+					return err
+				}
+			}
+
+			report.Sort()
+			if err := printAudit(report, format); err != nil {
+				return err
+			}
+			if len(report.Findings) > 0 {
+				return i18n.Errorf("verify.failed", len(report.Findings))
+			}
+			return nil
+		},
+	}
+
+	cmd.Flags().IntVar(&samples, "samples", 0, "Number of randomly chosen objects downloaded to verify their content")
+	cmd.Flags().Int64Var(&maxFileSize, "max-file-size", 256, "Exclude objects larger than this size in MB from the sample (0 = unlimited)")
+	cmd.Flags().StringVarP(&format, "format", "o", "table", "Output format (table, json)")
+
+	return cmd
+}
+
+func printAudit(report *engine.AuditReport, format string) error {
+	if format == "json" {
+		if report.Findings == nil {
+			report.Findings = []engine.AuditFinding{}
+		}
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		return enc.Encode(report)
+	}
+
+	if len(report.Findings) > 0 {
+		w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(w, i18n.T("verify.header"))
+		for _, f := range report.Findings {
+			fmt.Fprintf(w, "%s\t%s\t%s\t%s\n", f.Status, f.Side, f.Path, f.Detail)
+		}
+		if err := w.Flush(); err != nil {
+			return err
+		}
+	}
+
+	fmt.Println(i18n.T("verify.summary", report.Checked, report.Hashed, formatSize(report.Bytes, true), report.Unverified, len(report.Findings)))
+	return nil
+}
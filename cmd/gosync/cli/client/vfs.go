@@ -1,6 +1,27 @@
 package client
 
-import "github.com/spf13/cobra"
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/signal"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/mwantia/gosync/internal/i18n"
+	"github.com/mwantia/gosync/pkg/backend"
+	"github.com/mwantia/gosync/pkg/compress"
+	"github.com/mwantia/gosync/pkg/db/models"
+	"github.com/mwantia/gosync/pkg/db/store"
+	"github.com/mwantia/gosync/pkg/dedup"
+	"github.com/mwantia/gosync/pkg/storage"
+	"github.com/mwantia/gosync/pkg/vfs"
+	"github.com/spf13/cobra"
+)
 
 func NewVfsCommand() *cobra.Command {
 	cmd := &cobra.Command{
@@ -10,10 +31,12 @@ func NewVfsCommand() *cobra.Command {
 	}
 
 	cmd.AddCommand(NewVfsListCommand())
+	cmd.AddCommand(NewVfsCatCommand())
 	cmd.AddCommand(NewVfsTestCommand())
 	cmd.AddCommand(NewVfsTouchCommand())
 	cmd.AddCommand(NewVfsRemoveCommand())
 	cmd.AddCommand(NewVfsCreateDirectoryCommand())
+	cmd.AddCommand(NewVfsRestoreCommand())
 
 	return cmd
 }
@@ -21,23 +44,294 @@ func NewVfsCommand() *cobra.Command {
 func NewVfsListCommand() *cobra.Command {
 	var humanReadable bool
 	var longFormat bool
+	var at string
+	var regex bool
 
 	cmd := &cobra.Command{
 		Use:   "ls [path]",
 		Short: "List virtual filesystem entries",
-		Long:  "List all entries existing within the defined virtual filesystem path.",
-		Args:  cobra.MaximumNArgs(1),
+		Long: `List all entries existing within the defined virtual filesystem path. Use --at to list the entries as they existed at
+a past point in time. Paths containing wildcards like 'photos/2023/**/*.jpg', or regular expressions with --regex, list
+all matching files.`,
+		Args: cobra.MaximumNArgs(1),
 		RunE: func(cmd *cobra.Command, args []string) error {
+			path := vfs.Path{}
+			if len(args) > 0 {
+				path = vfs.ParsePath(args[0])
+			}
+
+			ctx := context.Background()
+
+			ms, err := openMetadataStore(ctx)
+			if err != nil {
+				return err
+			}
+			defer ms.Close()
+
+			if path.IsRoot() {
+				if at != "" {
+					return fmt.Errorf("listing with --at requires a backend path")
+				}
+				return listBackends(ctx, ms, longFormat)
+			}
+
+			pattern, err := compilePattern(path.Key, regex)
+			if err != nil {
+				return err
+			}
+			prefix := path.Key
+			if pattern != nil {
+				prefix = pattern.Base()
+			}
+
+			var objects []vfs.Object
+			if at == "" {
+				locks, err := backend.NewLocker(ms, path.Backend).List(ctx, prefix)
+				if err != nil {
+					return err
+				}
+				owners := make(map[string]string, len(locks))
+				for _, lock := range locks {
+					owners[lock.Path] = lock.Owner
+				}
+
+				add := func(file *models.File) error {
+					objects = append(objects, vfs.Object{Key: file.Path, Size: file.Size, ModifiedAt: file.ModifiedAt, LockedBy: owners[file.Path]})
+					return nil
+				}
+				if pattern != nil {
+					err = backend.MatchFiles(ctx, ms, path.Backend, pattern, add)
+				} else {
+					err = ms.IterateFiles(ctx, path.Backend, path.Key, add)
+				}
+				if err != nil {
+					return fmt.Errorf("failed to list files: %w", err)
+				}
+			} else {
+				t, err := parseTime(at)
+				if err != nil {
+					return err
+				}
+
+				events, err := ms.ListFilesAt(ctx, path.Backend, prefix, t)
+				if err != nil {
+					return fmt.Errorf("failed to reconstruct files: %w", err)
+				}
+				for _, event := range events {
+					if pattern != nil && !pattern.Match(event.Path) {
+						continue
+					}
+					objects = append(objects, vfs.Object{Key: event.Path, Size: event.Size, ModifiedAt: event.ModifiedAt})
+				}
+			}
+
+			// Matching files are listed by their full paths, since they may be located in any directory
+			if pattern != nil {
+				entries := make([]vfs.Entry, 0, len(objects))
+				for _, object := range objects {
+					entries = append(entries, vfs.Entry{Name: object.Key, Size: object.Size, ModifiedAt: object.ModifiedAt, LockedBy: object.LockedBy})
+				}
+				printEntries(entries, longFormat, humanReadable)
+				return nil
+			}
+
+			entries := vfs.Collapse(path.Key, objects)
+			for _, object := range objects {
+				// The path references a single file instead of a prefix
+				if object.Key == path.Key {
+					entries = append(entries, vfs.Entry{Name: object.Key[strings.LastIndex(object.Key, "/")+1:], Size: object.Size, ModifiedAt: object.ModifiedAt, LockedBy: object.LockedBy})
+				}
+			}
+
+			printEntries(entries, longFormat, humanReadable)
 			return nil
 		},
 	}
 
 	cmd.Flags().BoolVarP(&humanReadable, "human", "H", false, "Enable human-readable format")
 	cmd.Flags().BoolVarP(&longFormat, "long", "l", false, "Display long format")
+	cmd.Flags().StringVar(&at, "at", "", "List entries as they existed at the defined time (e.g. 2024-05-01T12:00)")
+	cmd.Flags().BoolVar(&regex, "regex", false, "Match the path within the backend as a regular expression")
+
+	return cmd
+}
+
+// compilePattern returns the pattern of a key containing wildcards or, with regex, of any key. Keys without
+// wildcards return nil, since they reference a single file or directory.
+func compilePattern(key string, regex bool) (*vfs.Pattern, error) {
+	switch {
+	case key == "":
+		return nil, nil
+	case regex:
+		return vfs.CompileRegex(key)
+	case vfs.IsGlob(key):
+		return vfs.CompileGlob(key)
+	}
+	return nil, nil
+}
+
+func listBackends(ctx context.Context, ms store.MetadataStore, longFormat bool) error {
+	backends, err := ms.ListBackends(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to list backends: %w", err)
+	}
+
+	if !longFormat {
+		for _, b := range backends {
+			fmt.Printf("%s/\n", b.ID)
+		}
+		return nil
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	for _, b := range backends {
+		fmt.Fprintf(w, "%s/\t%s\t%s\t%s\n", b.ID, b.Name, b.Endpoint, b.Bucket)
+	}
+	return w.Flush()
+}
+
+func printEntries(entries []vfs.Entry, longFormat, humanReadable bool) {
+	if !longFormat {
+		for _, entry := range entries {
+			if entry.IsDir {
+				fmt.Printf("%s/\n", entry.Name)
+			} else {
+				fmt.Println(entry.Name)
+			}
+		}
+		return
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', tabwriter.AlignRight)
+	for _, entry := range entries {
+		name := entry.Name
+		kind := "-"
+		if entry.IsDir {
+			name += "/"
+			kind = "d"
+		}
+		if entry.LockedBy != "" {
+			name += i18n.T("vfs.locked_by", entry.LockedBy)
+		}
+		fmt.Fprintf(w, "%s\t%s\t%s\t %s\n", kind, formatSize(entry.Size, humanReadable), entry.ModifiedAt.Local().Format(time.DateTime), name)
+	}
+	w.Flush()
+}
+
+func NewVfsCatCommand() *cobra.Command {
+	var offset int64
+	var length int64
+
+	cmd := &cobra.Command{
+		Use:   "cat <path>",
+		Short: "Print the content of a virtual filesystem file",
+		Long: `Streams the content of the file defined in the path to stdout. With --offset and --length only that part of the file
+is read from the backend, e.g. the end of a large log file with a negative offset counted from the end of the file.`,
+		Args: cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			path := vfs.ParsePath(args[0])
+			if path.IsRoot() || path.IsBackend() {
+				return fmt.Errorf("unable to print '%s', the path must reference a file", args[0])
+			}
+			if length < 0 {
+				return fmt.Errorf("invalid length %d, expected a positive number of bytes", length)
+			}
+
+			ctx, cancel := signal.NotifyContext(context.Background(), os.Interrupt)
+			defer cancel()
+
+			ms, err := openMetadataStore(ctx)
+			if err != nil {
+				return err
+			}
+			defer ms.Close()
+
+			b, err := ms.GetBackend(ctx, path.Backend)
+			if err != nil {
+				return fmt.Errorf("failed to find backend '%s': %w", path.Backend, err)
+			}
+
+			st, flush, err := openStorage(ms, b)
+			if err != nil {
+				return err
+			}
+			defer flush()
+
+			reader, err := openFileRange(ctx, ms, st, b, path.Key, offset, length)
+			if err != nil {
+				return fmt.Errorf("failed to read '%s': %w", path, err)
+			}
+			defer reader.Close()
+
+			if _, err := io.Copy(os.Stdout, reader); err != nil {
+				return fmt.Errorf("failed to read '%s': %w", path, err)
+			}
+			return nil
+		},
+	}
+
+	cmd.Flags().Int64Var(&offset, "offset", 0, "Byte offset to start reading at, negative offsets are counted from the end of the file")
+	cmd.Flags().Int64Var(&length, "length", 0, "Number of bytes to read (0 = until the end of the file)")
 
 	return cmd
 }
 
+// openFileRange returns a reader of length bytes of the file starting at offset. Only the range is read from the
+// backend, except for deduplicated and compressed files, whose content is read from the start of the file.
+func openFileRange(ctx context.Context, ms store.MetadataStore, st storage.Storage, b *models.Backend, key string, offset, length int64) (io.ReadCloser, error) {
+	stat, err := st.Stat(ctx, key)
+	if err != nil {
+		return nil, err
+	}
+	stat.Key = key
+
+	var assembled io.ReadCloser
+	size := stat.Size
+	if chunks := dedup.NewStore(ms, st, b); chunks.IsDeduplicated(ctx, key, stat) {
+		reader, manifest, err := chunks.Open(ctx, key)
+		if err != nil {
+			return nil, err
+		}
+		assembled, size = reader, manifest.Size
+	} else if compressed := backend.CompressedFile(ctx, ms, b, key, stat); compressed != nil {
+		reader, err := st.Get(ctx, key)
+		if err != nil {
+			return nil, err
+		}
+		if assembled, err = compress.Decompress(reader, compressed.Compression); err != nil {
+			return nil, err
+		}
+		size = compressed.Size
+	}
+
+	if offset < 0 {
+		offset = max(size+offset, 0)
+	}
+	offset = min(offset, size)
+	if length == 0 || length > size-offset {
+		length = size - offset
+	}
+	// Empty ranges aren't valid range requests
+	if length == 0 {
+		if assembled != nil {
+			assembled.Close()
+		}
+		return io.NopCloser(strings.NewReader("")), nil
+	}
+
+	if assembled == nil {
+		return storage.OpenRange(ctx, st, *stat, offset, length)
+	}
+	if _, err := io.CopyN(io.Discard, assembled, offset); err != nil {
+		assembled.Close()
+		return nil, err
+	}
+	return struct {
+		io.Reader
+		io.Closer
+	}{io.LimitReader(assembled, length), assembled}, nil
+}
+
 func NewVfsTestCommand() *cobra.Command {
 	cmd := &cobra.Command{
 		Use:   "test <path>",
@@ -68,22 +362,200 @@ func NewVfsTouchCommand() *cobra.Command {
 
 func NewVfsRemoveCommand() *cobra.Command {
 	var confirm bool
+	var workers int
+	var batchSize int
+	var dryRun bool
+	var regex bool
 
 	cmd := &cobra.Command{
 		Use:   "rm <path>",
 		Short: "Removes virtual filesystem entry",
-		Long:  "Removes the virtual filesystem entry defined in the path. Can also be used to wipe a backend (needs confirmation)",
-		Args:  cobra.ExactArgs(1),
+		Long: `Removes the virtual filesystem entry defined in the path. Can also be used to wipe a backend (needs confirmation).
+Paths containing wildcards like 'photos/2023/**/*.jpg', or regular expressions with --regex, remove all matching files
+(needs confirmation), use --dry-run to list them first.`,
+		Args: cobra.ExactArgs(1),
 		RunE: func(cmd *cobra.Command, args []string) error {
+			path := vfs.ParsePath(args[0])
+			if path.IsRoot() {
+				return fmt.Errorf("unable to remove the virtual filesystem root")
+			}
+
+			ctx, cancel := signal.NotifyContext(context.Background(), os.Interrupt)
+			defer cancel()
+
+			ms, err := openMetadataStore(ctx)
+			if err != nil {
+				return err
+			}
+			defer ms.Close()
+
+			if err := checkMaintenance(ctx, ms); err != nil {
+				return err
+			}
+
+			b, err := ms.GetBackend(ctx, path.Backend)
+			if err != nil {
+				return fmt.Errorf("failed to find backend '%s': %w", path.Backend, err)
+			}
+
+			st, flush, err := openStorage(ms, b)
+			if err != nil {
+				return err
+			}
+			defer flush()
+
+			pattern, err := compilePattern(path.Key, regex)
+			if err != nil {
+				return err
+			}
+			if pattern != nil {
+				return removeMatching(ctx, ms, backend.NewTrash(ms, st, b), path.Backend, pattern, dryRun, confirm)
+			}
+
+			if !path.IsBackend() {
+				if dryRun {
+					fmt.Printf("remove  %s\n", path.Key)
+					return nil
+				}
+				return removeFile(ctx, ms, backend.NewTrash(ms, st, b), path)
+			}
+
+			if dryRun {
+				fmt.Printf("wipe    %s (all objects in bucket '%s')\n", b.ID, b.Bucket)
+				return nil
+			}
+			if !confirm {
+				return fmt.Errorf("wiping backend '%s' requires the --confirm flag", b.ID)
+			}
+
+			if b.WipeStartedAt != nil {
+				fmt.Printf("Resuming wipe of backend '%s' started at %s\n", b.ID, b.WipeStartedAt.Format(time.RFC3339))
+			}
+
+			fmt.Printf("This will permanently delete ALL objects in bucket '%s' of backend '%s'.\n", b.Bucket, b.ID)
+			fmt.Printf("Type the backend name '%s' to confirm: ", b.Name)
+
+			answer, err := bufio.NewReader(os.Stdin).ReadString('\n')
+			if err != nil && answer == "" {
+				return fmt.Errorf("failed to read confirmation: %w", err)
+			}
+			if strings.TrimSpace(answer) != b.Name {
+				return fmt.Errorf("confirmation did not match backend name, aborting")
+			}
+
+			wiper := backend.NewWiper(ms, st, b)
+			err = wiper.Wipe(ctx, backend.WipeOptions{
+				Workers:   workers,
+				BatchSize: batchSize,
+				Progress: func(p backend.WipeProgress) {
+					switch p.Phase {
+					case backend.WipePhaseDelete:
+						fmt.Printf("\rDeleting objects: %d deleted, %d failed (%d known files)", p.Deleted, p.Failed, p.Total)
+					case backend.WipePhasePurge:
+						fmt.Printf("\nPurging file records...\n")
+					case backend.WipePhaseDone:
+						fmt.Printf("Backend '%s' wiped successfully\n", b.ID)
+					}
+				},
+			})
+			if err != nil {
+				fmt.Println()
+				return err
+			}
+
 			return nil
 		},
 	}
 
-	cmd.Flags().BoolVarP(&confirm, "confirm", "c", false, "Confirms the deletion of a backend")
+	cmd.Flags().BoolVarP(&confirm, "confirm", "c", false, "Confirms the deletion of a backend or of matching files")
+	cmd.Flags().IntVar(&workers, "workers", 4, "Number of parallel delete workers used to wipe a backend")
+	cmd.Flags().IntVar(&batchSize, "batch-size", 1000, "Number of objects deleted per batch call when wiping a backend (max 1000)")
+	cmd.Flags().BoolVar(&dryRun, "dry-run", false, "Only print the entries that would be removed")
+	cmd.Flags().BoolVar(&regex, "regex", false, "Match the path within the backend as a regular expression")
 
 	return cmd
 }
 
+// removeBatchSize is the number of matching files removed at once
+const removeBatchSize = 1000
+
+// removeMatching prints the files matching the pattern and removes them once the removal is confirmed
+func removeMatching(ctx context.Context, ms store.MetadataStore, trash *backend.Trash, backendID string, pattern *vfs.Pattern, dryRun, confirm bool) error {
+	var files []models.File
+	err := backend.MatchFiles(ctx, ms, backendID, pattern, func(file *models.File) error {
+		files = append(files, *file)
+		fmt.Printf("remove  %s\n", file.Path)
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("failed to match files: %w", err)
+	}
+
+	if len(files) == 0 {
+		return fmt.Errorf("no files match '%s'", pattern)
+	}
+	if dryRun {
+		return nil
+	}
+	if !confirm {
+		return fmt.Errorf("removing %d files requires the --confirm flag", len(files))
+	}
+
+	removed := 0
+	var errs []error
+	for start := 0; start < len(files); start += removeBatchSize {
+		batch := files[start:min(start+removeBatchSize, len(files))]
+		keys := make([]string, len(batch))
+		for i := range batch {
+			keys[i] = batch[i].Path
+		}
+
+		failed, err := trash.Remove(ctx, keys)
+		if err != nil {
+			return fmt.Errorf("failed to delete files: %w", err)
+		}
+		skip := make(map[string]bool, len(failed))
+		for _, f := range failed {
+			skip[f.Key] = true
+			errs = append(errs, fmt.Errorf("failed to delete '%s': %w", f.Key, f.Err))
+		}
+
+		for i := range batch {
+			if skip[batch[i].Path] {
+				continue
+			}
+			if err := ms.DeleteFile(ctx, batch[i].ID); err != nil {
+				errs = append(errs, fmt.Errorf("failed to delete metadata of '%s': %w", batch[i].Path, err))
+				continue
+			}
+			removed++
+		}
+	}
+
+	fmt.Printf("Removed %d of %d files\n", removed, len(files))
+	return errors.Join(errs...)
+}
+
+func removeFile(ctx context.Context, ms store.MetadataStore, trash *backend.Trash, path vfs.Path) error {
+	errs, err := trash.Remove(ctx, []string{path.Key})
+	if err != nil {
+		return fmt.Errorf("failed to delete '%s': %w", path, err)
+	}
+	if len(errs) > 0 {
+		return errs[0]
+	}
+
+	file, err := ms.GetFile(ctx, path.Backend, path.Key)
+	if err != nil {
+		if errors.Is(err, store.ErrNotFound) {
+			return nil
+		}
+		return fmt.Errorf("failed to query metadata of '%s': %w", path, err)
+	}
+
+	return ms.DeleteFile(ctx, file.ID)
+}
+
 func NewVfsCreateDirectoryCommand() *cobra.Command {
 	cmd := &cobra.Command{
 		Use:   "mkdir <path>",
@@ -97,3 +569,106 @@ func NewVfsCreateDirectoryCommand() *cobra.Command {
 
 	return cmd
 }
+
+func NewVfsRestoreCommand() *cobra.Command {
+	var at string
+	var dryRun bool
+	var confirm bool
+
+	cmd := &cobra.Command{
+		Use:   "restore <path> --at <time>",
+		Short: "Restore virtual filesystem entries to a past point in time",
+		Long:  "Restores all entries below the path to the state they had at the defined time. Requires bucket versioning; removed entries are moved into the trash if enabled.",
+		Args:  cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			path := vfs.ParsePath(args[0])
+			if path.IsRoot() {
+				return fmt.Errorf("a backend path is required")
+			}
+			if at == "" {
+				return fmt.Errorf("the --at flag is required")
+			}
+
+			t, err := parseTime(at)
+			if err != nil {
+				return err
+			}
+
+			ctx, cancel := signal.NotifyContext(context.Background(), os.Interrupt)
+			defer cancel()
+
+			ms, err := openMetadataStore(ctx)
+			if err != nil {
+				return err
+			}
+			defer ms.Close()
+
+			if err := checkMaintenance(ctx, ms); err != nil {
+				return err
+			}
+
+			b, err := ms.GetBackend(ctx, path.Backend)
+			if err != nil {
+				return fmt.Errorf("failed to find backend '%s': %w", path.Backend, err)
+			}
+
+			st, flush, err := openStorage(ms, b)
+			if err != nil {
+				return err
+			}
+			defer flush()
+
+			restorer := backend.NewRestorer(ms, st, b)
+			items, err := restorer.Plan(ctx, path.Key, t)
+			if err != nil {
+				return err
+			}
+
+			if len(items) == 0 {
+				fmt.Printf("'%s' already matches the state at %s\n", path, t.Format(time.RFC3339))
+				return nil
+			}
+
+			return applyRestore(ctx, restorer, items, dryRun, confirm)
+		},
+	}
+
+	cmd.Flags().StringVar(&at, "at", "", "Point in time to restore (e.g. 2024-05-01T12:00)")
+	cmd.Flags().BoolVar(&dryRun, "dry-run", false, "Only print the changes required for the restore")
+	cmd.Flags().BoolVarP(&confirm, "confirm", "c", false, "Confirms the restore")
+
+	return cmd
+}
+
+// applyRestore prints the planned restore items and applies them once the restore is confirmed
+func applyRestore(ctx context.Context, restorer *backend.Restorer, items []backend.RestoreItem, dryRun, confirm bool) error {
+	for _, item := range items {
+		if item.Reason != "" {
+			fmt.Printf("%-7s %s (%s)\n", item.Action, item.Path, item.Reason)
+		} else {
+			fmt.Printf("%-7s %s\n", item.Action, item.Path)
+		}
+	}
+
+	if dryRun {
+		return nil
+	}
+	if !confirm {
+		return fmt.Errorf("restoring %d entries requires the --confirm flag", len(items))
+	}
+
+	display := newProgressDisplay()
+	applied, err := restorer.Apply(ctx, items, backend.RestoreOptions{
+		Progress: func(p backend.RestoreProgress) {
+			display.Update(progressItem{
+				Label:   "Restoring",
+				Current: int64(p.Applied),
+				Total:   int64(p.Total),
+			}, nil)
+		},
+	})
+	display.Finish()
+
+	fmt.Printf("Applied %d of %d changes\n", applied, len(items))
+	return err
+}
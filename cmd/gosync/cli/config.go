@@ -5,6 +5,7 @@ import (
 	"path/filepath"
 
 	"github.com/joho/godotenv"
+	config "github.com/mwantia/gosync/internal/config/server"
 	"github.com/spf13/viper"
 )
 
@@ -31,11 +32,11 @@ func initConfig(path string) error {
 		viper.SetConfigType("yaml")
 		viper.AddConfigPath(".")
 		viper.AddConfigPath("./config")
-		viper.AddConfigPath("/etc/gosync")
+		viper.AddConfigPath(config.SystemDir())
 		viper.AddConfigPath("$HOME/.gosync")
 
 		// Load .env files from config directories
-		configPaths := []string{".", "./config", "/etc/gosync", "$HOME/.gosync"}
+		configPaths := []string{".", "./config", config.SystemDir(), "$HOME/.gosync"}
 		for _, configPath := range configPaths {
 			for _, envFile := range envFiles {
 				envPath := filepath.Join(configPath, envFile)
@@ -0,0 +1,119 @@
+package devtool
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/mwantia/gosync/pkg/fixture"
+	"github.com/spf13/cobra"
+)
+
+func NewDevtoolCommand() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "devtool",
+		Short: "Utilities for testing and benchmarking",
+		Long: `Utilities for testing and benchmarking GoSync deployments.
+
+This command provides generators for reproducible test data, which are
+used by integration tests and for benchmarking your own deployments.`,
+	}
+
+	cmd.AddCommand(newGenerateTreeCommand())
+	cmd.AddCommand(newVerifyTreeCommand())
+
+	return cmd
+}
+
+func newGenerateTreeCommand() *cobra.Command {
+	var opts fixture.Options
+	var manifestPath string
+	var force bool
+
+	cmd := &cobra.Command{
+		Use:   "generate-tree <dir>",
+		Short: "Generate a reproducible local tree with an expected manifest",
+		Long: `Generate a local tree of files with pseudo-random content.
+
+The same seed and options always produce identical paths, content and
+modification times. The manifest lists the size and checksums of every
+file and is written next to the tree by default, so it isn't synced.`,
+		Args: cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			dir := filepath.Clean(args[0])
+
+			entries, err := os.ReadDir(dir)
+			if err != nil && !os.IsNotExist(err) {
+				return fmt.Errorf("failed to read output directory: %w", err)
+			}
+			if len(entries) > 0 && !force {
+				return fmt.Errorf("output directory %s is not empty, use --force to generate into it", dir)
+			}
+
+			manifest, err := fixture.Generate(dir, opts)
+			if err != nil {
+				return err
+			}
+
+			if manifestPath == "" {
+				manifestPath = dir + ".manifest.json"
+			}
+			if err := fixture.WriteManifest(manifestPath, manifest); err != nil {
+				return fmt.Errorf("failed to write manifest: %w", err)
+			}
+
+			fmt.Printf("Generated %d files (%d bytes) in %s\n", len(manifest.Entries), manifest.Bytes, dir)
+			fmt.Printf("Wrote manifest to %s\n", manifestPath)
+			return nil
+		},
+	}
+
+	cmd.Flags().IntVar(&opts.Files, "files", 100, "number of files to generate")
+	cmd.Flags().IntVar(&opts.Depth, "depth", 3, "maximum directory depth")
+	cmd.Flags().IntVar(&opts.Fanout, "fanout", 4, "number of directories per level")
+	cmd.Flags().StringVar(&opts.Sizes, "sizes", fixture.SizesMixed, "size distribution (small, medium, large, mixed)")
+	cmd.Flags().Uint64Var(&opts.Seed, "seed", 1, "seed of the generated paths and content")
+	cmd.Flags().StringVar(&manifestPath, "manifest", "", "path of the manifest (default <dir>.manifest.json)")
+	cmd.Flags().BoolVar(&force, "force", false, "generate into a non-empty directory")
+
+	return cmd
+}
+
+func newVerifyTreeCommand() *cobra.Command {
+	var manifestPath string
+
+	cmd := &cobra.Command{
+		Use:   "verify-tree <dir>",
+		Short: "Compare a local tree with the manifest of a generated tree",
+		Args:  cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			dir := filepath.Clean(args[0])
+			if manifestPath == "" {
+				manifestPath = dir + ".manifest.json"
+			}
+
+			manifest, err := fixture.ReadManifest(manifestPath)
+			if err != nil {
+				return fmt.Errorf("failed to read manifest: %w", err)
+			}
+
+			problems, err := fixture.Verify(dir, manifest)
+			if err != nil {
+				return fmt.Errorf("failed to verify tree: %w", err)
+			}
+			if len(problems) == 0 {
+				fmt.Printf("%s matches the manifest (%d files)\n", dir, len(manifest.Entries))
+				return nil
+			}
+
+			for _, problem := range problems {
+				fmt.Printf("  %s\n", problem)
+			}
+			return fmt.Errorf("%s differs from the manifest in %d file(s)", dir, len(problems))
+		},
+	}
+
+	cmd.Flags().StringVar(&manifestPath, "manifest", "", "path of the manifest (default <dir>.manifest.json)")
+
+	return cmd
+}
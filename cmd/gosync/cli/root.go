@@ -3,6 +3,7 @@ package cli
 import (
 	"fmt"
 
+	"github.com/mwantia/gosync/internal/i18n"
 	"github.com/spf13/cobra"
 	"github.com/spf13/viper"
 )
@@ -18,16 +19,21 @@ func NewRootCommand(info VersionInfo) *cobra.Command {
 		SilenceUsage:  true,
 
 		PersistentPreRunE: func(cmd *cobra.Command, args []string) error {
-			return initConfig(path)
+			if err := initConfig(path); err != nil {
+				return err
+			}
+			return i18n.Detect(viper.GetString("locale"))
 		},
 	}
 
 	cmd.PersistentFlags().StringVar(&path, "config", "", "config file (default is ./config.yaml)")
 	cmd.PersistentFlags().Bool("no-color", false, "Disables colored command output")
 	cmd.PersistentFlags().String("log-level", "info", "log level (debug, info, warn, error)")
+	cmd.PersistentFlags().String("locale", "", "locale of command output, e.g. en or de (default from LANG)")
 
 	viper.BindPFlag("log.level", cmd.PersistentFlags().Lookup("log-level"))
 	viper.BindPFlag("log.no_color", cmd.PersistentFlags().Lookup("no-color"))
+	viper.BindPFlag("locale", cmd.PersistentFlags().Lookup("locale"))
 
 	cmd.Version = fmt.Sprintf("%s.%s", info.Version, info.Commit)
 
@@ -1,11 +1,10 @@
 package server
 
 import (
-	"context"
 	"fmt"
 
-	"github.com/mwantia/gosync/internal/agent"
 	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
 
 	config "github.com/mwantia/gosync/internal/config/server"
 )
@@ -21,8 +20,12 @@ func NewAgentCommand() *cobra.Command {
 				return fmt.Errorf("failed to load server configuration: %w", err)
 			}
 
-			agent := agent.NewAgent(cfg)
-			if err := agent.Serve(context.Background()); err != nil {
+			// Fail on startup instead of when an invalid setting is used for the first time
+			if errs := config.Validate(cfg, viper.AllSettings()); len(errs) > 0 {
+				return errs
+			}
+
+			if err := runAgent(cfg, cmd.Root().Version); err != nil {
 				print(err)
 				return err
 			}
@@ -6,6 +6,7 @@ import (
 	"path/filepath"
 
 	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
 	"gopkg.in/yaml.v3"
 
 	config "github.com/mwantia/gosync/internal/config/server"
@@ -22,6 +23,7 @@ managing configuration files for different environments.`,
 	}
 
 	cmd.AddCommand(newConfigGenerateCommand())
+	cmd.AddCommand(newConfigValidateCommand())
 
 	return cmd
 }
@@ -74,3 +76,51 @@ for your specific deployment requirements.`,
 
 	return cmd
 }
+
+func newConfigValidateCommand() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "validate",
+		Short: "Validate a configuration file",
+		Long: `Validate the configuration file and report all problems at once.
+
+This command checks for unknown keys, invalid durations, log levels and
+outputs, missing metadata settings and contradictory settings, using the
+same checks as the agent on startup.`,
+		Args: cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			file, _ := cmd.Flags().GetString("file")
+			if file != "" {
+				viper.SetConfigFile(file)
+				if err := viper.ReadInConfig(); err != nil {
+					return fmt.Errorf("failed to read config file %s: %w", file, err)
+				}
+			}
+
+			used := viper.ConfigFileUsed()
+			if used == "" {
+				used = "defaults (no config file found)"
+			}
+
+			cfg, err := config.LoadServerConfig()
+			if err != nil {
+				return err
+			}
+
+			errs := config.Validate(cfg, viper.AllSettings())
+			if len(errs) == 0 {
+				fmt.Printf("%s is valid\n", used)
+				return nil
+			}
+
+			fmt.Printf("%s has %d problem(s):\n", used, len(errs))
+			for _, err := range errs {
+				fmt.Printf("  %s\n", err)
+			}
+			return fmt.Errorf("configuration is invalid")
+		},
+	}
+
+	cmd.Flags().String("file", "", "config file to validate (defaults to the loaded configuration)")
+
+	return cmd
+}
@@ -0,0 +1,109 @@
+package server
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/signal"
+	"strings"
+	"time"
+
+	"github.com/spf13/cobra"
+
+	config "github.com/mwantia/gosync/internal/config/server"
+	"github.com/mwantia/gosync/pkg/db/models"
+	"github.com/mwantia/gosync/pkg/db/store"
+	"github.com/mwantia/gosync/pkg/secrets"
+	"github.com/mwantia/gosync/pkg/selftest"
+)
+
+func NewSelftestCommand() *cobra.Command {
+	var opts selftest.Options
+	var backendID string
+
+	cmd := &cobra.Command{
+		Use:   "selftest",
+		Short: "Run an end-to-end sync scenario against a test target",
+		Long: `Run a scripted end-to-end sync scenario and verify the final state.
+
+Two temporary clients upload, download and change a generated tree,
+create a conflict and interrupt a running pass, after which both
+clients must contain identical files.
+
+By default an ephemeral MinIO server is started if the minio binary
+can be found, otherwise a local directory is used as remote target.
+With --backend, a configured backend is used below a unique prefix,
+which is removed once the scenario has finished.`,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			ctx, cancel := signal.NotifyContext(cmd.Context(), os.Interrupt)
+			defer cancel()
+
+			if backendID != "" {
+				b, err := loadBackend(ctx, backendID)
+				if err != nil {
+					return err
+				}
+				opts.Backend = b
+			}
+
+			opts.OnStep = func(step selftest.Step) {
+				if step.Err != nil {
+					fmt.Printf("  FAIL  %-10s %s: %v\n", step.Name, step.Duration.Round(time.Millisecond), step.Err)
+					return
+				}
+				fmt.Printf("  PASS  %-10s %s\n", step.Name, step.Duration.Round(time.Millisecond))
+			}
+
+			fmt.Println("Running self-test...")
+			report, err := selftest.Run(ctx, opts)
+			if report != nil && report.Target != "" {
+				fmt.Printf("Target: %s\n", report.Target)
+			}
+			if err != nil {
+				return fmt.Errorf("failed to run self-test: %w", err)
+			}
+			if opts.KeepTemp {
+				fmt.Printf("Kept temporary files in %s\n", report.TempDir)
+			}
+
+			if report.Failed() {
+				return fmt.Errorf("self-test failed")
+			}
+			fmt.Println("Self-test passed")
+			return nil
+		},
+	}
+
+	cmd.Flags().StringVar(&backendID, "backend", "", "configured backend used as remote target")
+	cmd.Flags().StringVar(&opts.MinIOBinary, "minio", "minio", "minio binary started as ephemeral remote target")
+	cmd.Flags().IntVar(&opts.Files, "files", 20, "number of generated files")
+	cmd.Flags().Uint64Var(&opts.Seed, "seed", 1, "seed of the generated files")
+	cmd.Flags().BoolVar(&opts.KeepTemp, "keep", false, "keep the temporary directory for inspection")
+
+	return cmd
+}
+
+// loadBackend reads the backend from the metadata store of the loaded configuration and resolves its secrets
+func loadBackend(ctx context.Context, id string) (*models.Backend, error) {
+	cfg, err := config.LoadServerConfig()
+	if err != nil {
+		return nil, fmt.Errorf("failed to load server configuration: %w", err)
+	}
+
+	ms, err := store.Open(ctx, cfg.Metadata, strings.EqualFold(cfg.Log.Level, "DEBUG"))
+	if err != nil {
+		return nil, fmt.Errorf("failed to open metadata store: %w", err)
+	}
+	defer ms.Close()
+
+	b, err := ms.GetBackend(ctx, id)
+	if err != nil {
+		return nil, fmt.Errorf("failed to find backend '%s': %w", id, err)
+	}
+
+	resolver, err := secrets.NewResolver(cfg.Secrets)
+	if err != nil {
+		return nil, err
+	}
+	return resolver.ResolveBackend(ctx, b)
+}
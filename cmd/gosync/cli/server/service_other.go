@@ -0,0 +1,15 @@
+//go:build !windows
+
+package server
+
+import (
+	"context"
+
+	"github.com/mwantia/gosync/internal/agent"
+	config "github.com/mwantia/gosync/internal/config/server"
+)
+
+// runAgent serves the agent until it receives an interrupt signal
+func runAgent(cfg *config.BaseServerConfig, version string) error {
+	return agent.NewAgent(cfg, version).Serve(context.Background())
+}
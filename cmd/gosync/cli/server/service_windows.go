@@ -0,0 +1,80 @@
+//go:build windows
+
+package server
+
+import (
+	"context"
+	"fmt"
+	"path/filepath"
+
+	"github.com/mwantia/gosync/internal/agent"
+	config "github.com/mwantia/gosync/internal/config/server"
+	"golang.org/x/sys/windows/svc"
+)
+
+// ServiceName is the name the agent is registered with by the Windows installer
+const ServiceName = "GoSync"
+
+// runAgent serves the agent, using the service control manager if started as Windows service
+func runAgent(cfg *config.BaseServerConfig, version string) error {
+	isService, err := svc.IsWindowsService()
+	if err != nil {
+		return fmt.Errorf("failed to determine if running as windows service: %w", err)
+	}
+	if !isService {
+		return agent.NewAgent(cfg, version).Serve(context.Background())
+	}
+
+	// Services have no console, so logs are written next to the configuration by default
+	if cfg.Log.File == "" {
+		cfg.Log.File = filepath.Join(config.SystemDir(), "gosync.log")
+	}
+
+	return svc.Run(ServiceName, &agentService{
+		agent: agent.NewAgent(cfg, version),
+	})
+}
+
+// agentService runs the agent as Windows service, stopping it on service stop or system shutdown
+type agentService struct {
+	agent *agent.GoSyncAgent
+}
+
+func (s *agentService) Execute(args []string, requests <-chan svc.ChangeRequest, changes chan<- svc.Status) (bool, uint32) {
+	changes <- svc.Status{State: svc.StartPending}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	done := make(chan error, 1)
+	go func() {
+		done <- s.agent.Serve(ctx)
+	}()
+
+	changes <- svc.Status{State: svc.Running, Accepts: svc.AcceptStop | svc.AcceptShutdown}
+
+	for {
+		select {
+		case err := <-done:
+			return exitCode(err)
+
+		case req := <-requests:
+			switch req.Cmd {
+			case svc.Interrogate:
+				changes <- req.CurrentStatus
+			case svc.Stop, svc.Shutdown:
+				changes <- svc.Status{State: svc.StopPending}
+				cancel()
+				return exitCode(<-done)
+			}
+		}
+	}
+}
+
+// exitCode returns a service specific exit code if the agent failed
+func exitCode(err error) (bool, uint32) {
+	if err != nil {
+		return true, 1
+	}
+	return false, 0
+}
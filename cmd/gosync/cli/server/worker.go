@@ -0,0 +1,42 @@
+package server
+
+import (
+	"fmt"
+	"os"
+	"os/signal"
+
+	"github.com/spf13/cobra"
+
+	"github.com/mwantia/gosync/pkg/offload"
+)
+
+func NewWorkerCommand() *cobra.Command {
+	var listen string
+
+	cmd := &cobra.Command{
+		Use:   "worker",
+		Short: "Serve offloaded hashing for an agent (experimental)",
+		Long: `Serve CPU-heavy work offloaded by an agent with offload.enabled.
+
+Without --listen, requests are read from standard input and answered on
+standard output, which is how the agent runs its local worker processes.
+With --listen, agents on other machines connect over TCP and send the
+content of each file along with its request. Connections are neither
+authenticated nor encrypted, so only listen on trusted networks.`,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if listen == "" {
+				return offload.Serve(os.Stdin, os.Stdout, true)
+			}
+
+			ctx, cancel := signal.NotifyContext(cmd.Context(), os.Interrupt)
+			defer cancel()
+
+			fmt.Printf("Serving offloaded work on %s\n", listen)
+			return offload.Listen(ctx, listen)
+		},
+	}
+
+	cmd.Flags().StringVar(&listen, "listen", "", "Address to serve remote agents on, e.g. 0.0.0.0:9530")
+
+	return cmd
+}
@@ -0,0 +1,254 @@
+package cli
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"sort"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/mwantia/gosync/internal/i18n"
+	"github.com/mwantia/gosync/internal/telemetry"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+)
+
+// telemetryTimeout limits how long sending queued events may delay the exit of a command
+const telemetryTimeout = 2 * time.Second
+
+// RecordTelemetry queues the usage of the executed command if the user opted in. Failures are ignored,
+// since telemetry must never change the outcome of a command.
+func RecordTelemetry(cmd *cobra.Command, started time.Time, err error) {
+	// Unknown commands don't exercise any feature
+	if cmd == nil || cmd == cmd.Root() || telemetry.Suppressed() {
+		return
+	}
+
+	settings, lerr := telemetry.Load()
+	if lerr != nil || !settings.Enabled {
+		return
+	}
+
+	command := strings.TrimPrefix(cmd.CommandPath(), cmd.Root().Name()+" ")
+	queued, rerr := telemetry.Record(telemetry.NewEvent(command, cmd.Root().Version, started, errorClass(err)))
+	if rerr != nil {
+		return
+	}
+
+	if endpoint := viper.GetString("telemetry.endpoint"); endpoint != "" && queued >= telemetry.FlushBatch {
+		ctx, cancel := context.WithTimeout(context.Background(), telemetryTimeout)
+		defer cancel()
+		telemetry.Flush(ctx, endpoint, settings.ID)
+	}
+}
+
+// errorClass describes the error without any of its details, which may contain paths or names.
+// Errors of translated messages are classified by their message key.
+func errorClass(err error) string {
+	var netErr net.Error
+	switch {
+	case err == nil:
+		return ""
+	case i18n.Key(err) != "":
+		return i18n.Key(err)
+	case errors.Is(err, context.Canceled):
+		return "canceled"
+	case errors.Is(err, context.DeadlineExceeded):
+		return "timeout"
+	case errors.Is(err, os.ErrNotExist):
+		return "not_found"
+	case errors.Is(err, os.ErrPermission):
+		return "permission"
+	case errors.As(err, &netErr):
+		return "network"
+	default:
+		return "other"
+	}
+}
+
+func NewTelemetryCommand() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "telemetry",
+		Short: "Manage anonymous usage telemetry",
+		Long: `Telemetry is disabled unless enabled with 'gosync telemetry enable'. It records the invoked command, its
+duration and the class of its error, never arguments, paths or credentials. Events are queued locally and only
+sent to the endpoint configured with telemetry.endpoint, so self-hosters may collect them with their own service.
+Setting DO_NOT_TRACK=1 or GOSYNC_TELEMETRY=off disables telemetry regardless of this setting.`,
+	}
+
+	cmd.AddCommand(NewTelemetryStatusCommand())
+	cmd.AddCommand(NewTelemetryEnableCommand())
+	cmd.AddCommand(NewTelemetryDisableCommand())
+
+	return cmd
+}
+
+// TelemetryStatus is the output of 'gosync telemetry status -o json'
+type TelemetryStatus struct {
+	Enabled    bool              `json:"enabled"`
+	Suppressed bool              `json:"suppressed"`
+	ID         string            `json:"id,omitempty"`
+	Endpoint   string            `json:"endpoint,omitempty"`
+	Queue      string            `json:"queue"`
+	Queued     []telemetry.Event `json:"queued"`
+}
+
+func NewTelemetryStatusCommand() *cobra.Command {
+	var format string
+
+	cmd := &cobra.Command{
+		Use:   "status",
+		Short: "Show whether telemetry is enabled and the queued events",
+		Long:  "Shows whether telemetry is enabled and summarizes the events queued on this machine per command, exactly as they would be sent.",
+		Args:  cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if format != "table" && format != "json" {
+				return i18n.Errorf("error.unsupported_format", format)
+			}
+
+			settings, err := telemetry.Load()
+			if err != nil {
+				return err
+			}
+			queue, err := telemetry.QueuePath()
+			if err != nil {
+				return err
+			}
+			events, err := telemetry.Queued()
+			if err != nil {
+				return err
+			}
+
+			status := TelemetryStatus{
+				Enabled:    settings.Enabled,
+				Suppressed: telemetry.Suppressed(),
+				ID:         settings.ID,
+				Endpoint:   viper.GetString("telemetry.endpoint"),
+				Queue:      queue,
+				Queued:     events,
+			}
+
+			if format == "json" {
+				if status.Queued == nil {
+					status.Queued = []telemetry.Event{}
+				}
+				enc := json.NewEncoder(os.Stdout)
+				enc.SetIndent("", "  ")
+				return enc.Encode(status)
+			}
+
+			printTelemetryStatus(&status)
+			return nil
+		},
+	}
+
+	cmd.Flags().StringVarP(&format, "format", "o", "table", "Output format (table, json)")
+
+	return cmd
+}
+
+func printTelemetryStatus(status *TelemetryStatus) {
+	switch {
+	case status.Enabled && status.Suppressed:
+		fmt.Println(i18n.T("telemetry.suppressed"))
+	case status.Enabled:
+		fmt.Println(i18n.T("telemetry.status_enabled", status.ID))
+	default:
+		fmt.Println(i18n.T("telemetry.status_disabled"))
+	}
+	if status.Endpoint == "" {
+		fmt.Println(i18n.T("telemetry.no_endpoint"))
+	} else {
+		fmt.Println(i18n.T("telemetry.endpoint", status.Endpoint))
+	}
+	fmt.Println(i18n.T("telemetry.queued", len(status.Queued), status.Queue))
+
+	if len(status.Queued) == 0 {
+		return
+	}
+
+	type usage struct {
+		count    int
+		errors   int
+		duration int64
+	}
+	commands := make(map[string]*usage)
+	for _, event := range status.Queued {
+		u, ok := commands[event.Command]
+		if !ok {
+			u = &usage{}
+			commands[event.Command] = u
+		}
+		u.count++
+		u.duration += event.Duration
+		if event.Error != "" {
+			u.errors++
+		}
+	}
+
+	names := make([]string, 0, len(commands))
+	for name := range commands {
+		names = append(names, name)
+	}
+	sort.Slice(names, func(i, j int) bool {
+		if commands[names[i]].count != commands[names[j]].count {
+			return commands[names[i]].count > commands[names[j]].count
+		}
+		return names[i] < names[j]
+	})
+
+	fmt.Println()
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, i18n.T("telemetry.header"))
+	for _, name := range names {
+		u := commands[name]
+		average := time.Duration(u.duration/int64(u.count)) * time.Millisecond
+		fmt.Fprintf(w, "%s\t%d\t%d\t%s\n", name, u.count, u.errors, average)
+	}
+	w.Flush()
+}
+
+func NewTelemetryEnableCommand() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "enable",
+		Short: "Opt in to anonymous usage telemetry",
+		Args:  cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			settings, err := telemetry.SetEnabled(true)
+			if err != nil {
+				return err
+			}
+
+			fmt.Println(i18n.T("telemetry.enabled", settings.ID))
+			if telemetry.Suppressed() {
+				fmt.Println(i18n.T("telemetry.suppressed"))
+			}
+			return nil
+		},
+	}
+
+	return cmd
+}
+
+func NewTelemetryDisableCommand() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "disable",
+		Short: "Opt out of usage telemetry and remove all queued events",
+		Args:  cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if _, err := telemetry.SetEnabled(false); err != nil {
+				return err
+			}
+
+			fmt.Println(i18n.T("telemetry.disabled"))
+			return nil
+		},
+	}
+
+	return cmd
+}
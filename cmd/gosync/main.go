@@ -3,9 +3,11 @@ package main
 import (
 	"fmt"
 	"os"
+	"time"
 
 	"github.com/mwantia/gosync/cmd/gosync/cli"
 	"github.com/mwantia/gosync/cmd/gosync/cli/client"
+	"github.com/mwantia/gosync/cmd/gosync/cli/devtool"
 	"github.com/mwantia/gosync/cmd/gosync/cli/server"
 )
 
@@ -21,13 +23,60 @@ func main() {
 	})
 
 	root.AddCommand(cli.NewVersionCommand())
+	root.AddCommand(cli.NewAliasesCommand())
+	root.AddCommand(cli.NewTelemetryCommand())
 
 	root.AddCommand(server.NewAgentCommand())
 	root.AddCommand(server.NewConfigCommand())
+	root.AddCommand(server.NewSelftestCommand())
+	root.AddCommand(server.NewWorkerCommand())
 
+	root.AddCommand(client.NewStatusCommand())
+	root.AddCommand(client.NewMaintenanceCommand())
+	root.AddCommand(client.NewDevicesCommand())
+	root.AddCommand(client.NewQueueCommand())
+	root.AddCommand(client.NewTransferCommand())
+	root.AddCommand(client.NewBackendCommand())
+	root.AddCommand(client.NewSyncCommand())
+	root.AddCommand(client.NewPinCommand())
+	root.AddCommand(client.NewUnpinCommand())
+	root.AddCommand(client.NewTagCommand())
+	root.AddCommand(client.NewFindCommand())
+	root.AddCommand(client.NewDuCommand())
+	root.AddCommand(client.NewHistoryCommand())
+	root.AddCommand(client.NewFilterCommand())
 	root.AddCommand(client.NewVfsCommand())
+	root.AddCommand(client.NewCopyCommand())
+	root.AddCommand(client.NewMoveCommand())
+	root.AddCommand(client.NewTrashCommand())
+	root.AddCommand(client.NewSnapshotCommand())
+	root.AddCommand(client.NewLockCommand())
+	root.AddCommand(client.NewTokenCommand())
+	root.AddCommand(client.NewDrillCommand())
+	root.AddCommand(client.NewVerifyCommand())
+	root.AddCommand(client.NewPublishCommand())
+	root.AddCommand(client.NewCompareCommand())
+	root.AddCommand(client.NewQueryCommand())
+	root.AddCommand(client.NewVerifyConfigCommand())
+	root.AddCommand(client.NewIndexCommand())
+	root.AddCommand(client.NewTrayCommand())
+	root.AddCommand(client.NewDiffCommand())
+	root.AddCommand(client.NewImportCommand())
+	root.AddCommand(client.NewReportCommand())
 
-	if err := root.Execute(); err != nil {
+	root.AddCommand(devtool.NewDevtoolCommand())
+
+	args, err := cli.ExpandAliases(root, os.Args[1:])
+	if err != nil {
+		fmt.Println(err)
+		os.Exit(1)
+	}
+	root.SetArgs(args)
+
+	started := time.Now()
+	cmd, err := root.ExecuteC()
+	cli.RecordTelemetry(cmd, started, err)
+	if err != nil {
 		fmt.Println(err)
 		os.Exit(1)
 	}
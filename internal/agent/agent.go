@@ -2,34 +2,76 @@ package agent
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"os"
 	"os/signal"
+	"reflect"
 	"sync"
+	"syscall"
 	"time"
 
 	"github.com/mwantia/fabric/pkg/container"
+	"github.com/mwantia/gosync/internal/api"
 	config "github.com/mwantia/gosync/internal/config/server"
-	"github.com/mwantia/gosync/pkg/db/migrations"
+	"github.com/mwantia/gosync/internal/i18n"
+	"github.com/mwantia/gosync/internal/web"
+	"github.com/mwantia/gosync/pkg/auth"
 	"github.com/mwantia/gosync/pkg/db/store"
+	"github.com/mwantia/gosync/pkg/engine"
+	"github.com/mwantia/gosync/pkg/index"
+	"github.com/mwantia/gosync/pkg/limits"
 	"github.com/mwantia/gosync/pkg/log"
-	"gorm.io/gorm/logger"
+	"github.com/mwantia/gosync/pkg/metrics"
+	"github.com/mwantia/gosync/pkg/offload"
+	"github.com/mwantia/gosync/pkg/publish"
+	"github.com/mwantia/gosync/pkg/secrets"
+	"github.com/mwantia/gosync/pkg/storage"
+	"github.com/mwantia/gosync/pkg/webhook"
 )
 
+// meterFlushInterval defines how often bandwidth usage and learned tuning values are flushed into the metadata store
+const meterFlushInterval = time.Minute
+
 type GoSyncAgent struct {
 	mutex sync.RWMutex
 	wait  sync.WaitGroup
 
-	cfg *config.BaseServerConfig
-	sc  *container.ServiceContainer
-	log log.LoggerService
+	cfg     *config.BaseServerConfig
+	sc      *container.ServiceContainer
+	log     log.LoggerService
+	version string
+
+	// shutdown stops the agent, e.g. once this device was revoked
+	shutdown context.CancelCauseFunc
+
+	// Set once the background services have been started
+	clientID  string
+	machineID string
+	startedAt time.Time
+	store     store.MetadataStore
+	meter     *storage.Meter
+	cache     *storage.Cache
+	engine    *engine.Engine
+	limiter   *limits.Limiter
+	pool      *limits.Pool
+	scheduler *scheduler
+	health    *healthChecker
+	metrics   *metrics.Registry
+
+	// Set while the agent is in maintenance mode
+	maintenance *api.Maintenance
+
+	// States of the background services, reported by the health endpoints
+	services serviceStates
 }
 
-func NewAgent(cfg *config.BaseServerConfig) *GoSyncAgent {
+func NewAgent(cfg *config.BaseServerConfig, version string) *GoSyncAgent {
 	return &GoSyncAgent{
-		cfg: cfg,
-		sc:  container.NewServiceContainer(),
-		log: log.NewLoggerService("golang", cfg.Log),
+		cfg:     cfg,
+		sc:      container.NewServiceContainer(),
+		log:     log.NewLoggerService("golang", cfg.Log),
+		version: version,
 	}
 }
 
@@ -49,69 +91,333 @@ func (gsa *GoSyncAgent) setupServices() error {
 			return gsa.initMetadataStore()
 		})))
 
+	gsa.log.Debug("Registering 'SecretResolver'...")
+	errs.Add(container.Register[*secrets.Resolver](gsa.sc,
+		container.AsFactory(func(ctx context.Context, sc *container.ServiceContainer) (any, error) {
+			return secrets.NewResolver(gsa.cfg.Secrets)
+		})))
+
 	return errs.Errors()
 }
 
-func (gsa *GoSyncAgent) initMetadataStore() (store.MetadataStore, error) {
-	switch gsa.cfg.Metadata.Type {
-	case "sqlite":
-		gsa.log.Info("Initializing SQLite metadata store at %s", gsa.cfg.Metadata.SQLite.Path)
-
-		// Determine log level for GORM
-		gormLogLevel := logger.Silent
-		if gsa.cfg.Log.Level == "DEBUG" {
-			gormLogLevel = logger.Info
+func (gsa *GoSyncAgent) startBackgroundServices(ctx context.Context) error {
+	resolver, err := resolve[*secrets.Resolver](ctx, gsa.sc)
+	if err != nil {
+		return err
+	}
+	// Secrets of the configuration are resolved before any service uses them
+	if err := resolver.ExpandConfig(ctx, gsa.cfg); err != nil {
+		return fmt.Errorf("failed to resolve secrets: %w", err)
+	}
+
+	ms, err := resolve[store.MetadataStore](ctx, gsa.sc)
+	if err != nil {
+		return err
+	}
+
+	meter := storage.NewMeter(ms)
+	meter.SetSecretResolver(resolver)
+	gsa.runBackground(ctx, "meter", func(ctx context.Context) error {
+		return meter.Run(ctx, meterFlushInterval, gsa.log.Named("meter"))
+	})
+
+	gsa.runBackground(ctx, "trash", func(ctx context.Context) error {
+		return gsa.runTrashPurge(ctx, ms, meter)
+	})
+
+	if gsa.cfg.Metadata.Maintenance.Enabled {
+		gsa.runBackground(ctx, "housekeeping", func(ctx context.Context) error {
+			return gsa.runDatabaseMaintenance(ctx, ms, meter)
+		})
+	}
+
+	if gsa.cfg.History.Enabled && gsa.cfg.History.MaxSize > 0 {
+		gsa.runBackground(ctx, "history", func(ctx context.Context) error {
+			return gsa.runTransferLogPruning(ctx, ms)
+		})
+	}
+
+	if gsa.cfg.Metadata.SQLite.Backup.Enabled {
+		gsa.runBackground(ctx, "backup", func(ctx context.Context) error {
+			return gsa.runDatabaseBackups(ctx, ms)
+		})
+	}
+
+	if gsa.cfg.Drills.Enabled {
+		gsa.runBackground(ctx, "drill", func(ctx context.Context) error {
+			return gsa.runRestoreDrills(ctx, ms, meter)
+		})
+	}
+
+	for _, cfg := range gsa.cfg.Indexers {
+		indexer, err := index.NewIndexer(cfg, ms, meter, gsa.log.Named("index"))
+		if err != nil {
+			return fmt.Errorf("failed to create indexer '%s': %w", cfg.Name, err)
+		}
+		gsa.runBackground(ctx, "index/"+cfg.Name, indexer.Run)
+	}
+
+	clientID, err := gsa.registerDevice(ctx, ms)
+	if err != nil {
+		return err
+	}
+
+	profile := gsa.cfg.ProfileLimits()
+	if gsa.cfg.Profile == config.ProfileLowMemory {
+		gsa.log.Info("Using low-memory profile with at most %d workers per sync", profile.MaxWorkers)
+	}
+
+	limiter := limits.New(int64(gsa.cfg.Limits.MaxOpenFiles), uint64(gsa.cfg.Limits.MemoryWatermark)<<20, gsa.log.Named("limits"))
+	pool := limits.NewPool(gsa.cfg.Scheduler.Workers)
+
+	opts := engine.Options{
+		ClientID:      clientID,
+		Meter:         meter,
+		Limiter:       limiter,
+		Pool:          pool,
+		MaxWorkers:    profile.MaxWorkers,
+		StreamingOnly: profile.StreamingOnly,
+		ScanWorkers:   gsa.cfg.Scanner.Workers,
+		ScanPageSize:  gsa.cfg.Scanner.PageSize,
+		TransferLog:   gsa.cfg.History.Enabled,
+		Anomaly: engine.AnomalyOptions{
+			Enabled:        gsa.cfg.Anomaly.Enabled,
+			MaxChangeRatio: gsa.cfg.Anomaly.MaxChangeRatio,
+			MinFiles:       gsa.cfg.Anomaly.MinFiles,
+			Entropy:        gsa.cfg.Anomaly.Entropy,
+		},
+	}
+
+	if gsa.cfg.Tuning.Enabled {
+		tuner, err := storage.NewTuner(ctx, ms, int64(gsa.cfg.Tuning.MinChunkSize)<<20, int64(gsa.cfg.Tuning.MaxChunkSize)<<20)
+		if err != nil {
+			return fmt.Errorf("failed to load backend tuning: %w", err)
+		}
+		gsa.runBackground(ctx, "tuner", func(ctx context.Context) error {
+			return tuner.Run(ctx, meterFlushInterval)
+		})
+		opts.Tuner = tuner
+	}
+
+	if gsa.cfg.Cache.Enabled {
+		cache, err := storage.NewCache(gsa.cfg.Cache.Dir, int64(gsa.cfg.Cache.MaxSize)<<20, gsa.cfg.Cache.ReadAhead)
+		if err != nil {
+			return fmt.Errorf("failed to open content cache: %w", err)
+		}
+		opts.Cache = cache
+	}
+
+	opts.Downloads = storage.ParallelOptions{
+		Workers:   gsa.cfg.Downloads.Workers,
+		ChunkSize: int64(gsa.cfg.Downloads.ChunkSize) << 20,
+		MinSize:   int64(gsa.cfg.Downloads.MinSize) << 20,
+	}
+
+	if gsa.cfg.Publish.SigningKey != "" {
+		key, err := publish.ParseSigningKey(gsa.cfg.Publish.SigningKey)
+		if err != nil {
+			return fmt.Errorf("failed to load publish.signing_key: %w", err)
+		}
+		opts.SigningKey = key
+	}
+
+	if workers := gsa.cfg.Offload; workers.Enabled {
+		hashers, err := offload.NewPool(ctx, workers.Workers, workers.Remote, gsa.log.Named("offload"))
+		if err != nil {
+			return fmt.Errorf("failed to start offload workers: %w", err)
+		}
+		gsa.log.Info("Offloading hashing to %d local and %d remote workers (experimental)", workers.Workers, len(workers.Remote))
+		gsa.runBackground(ctx, "offload", hashers.Run)
+		opts.Hasher = hashers.Hash
+	}
+
+	if leases := gsa.cfg.Leases; leases.Enabled {
+		opts.Leases.Enabled = true
+		if opts.Leases.TTL, err = time.ParseDuration(leases.TTL); err != nil {
+			return fmt.Errorf("invalid leases.ttl '%s': %w", leases.TTL, err)
+		}
+	}
+	if adaptive := gsa.cfg.Scheduler.Adaptive; adaptive.Enabled {
+		opts.Adaptive.Enabled = true
+		if opts.Adaptive.MinInterval, err = time.ParseDuration(adaptive.MinInterval); err != nil {
+			return fmt.Errorf("invalid scheduler.adaptive.min_interval '%s': %w", adaptive.MinInterval, err)
+		}
+		if opts.Adaptive.MaxInterval, err = time.ParseDuration(adaptive.MaxInterval); err != nil {
+			return fmt.Errorf("invalid scheduler.adaptive.max_interval '%s': %w", adaptive.MaxInterval, err)
+		}
+	}
+
+	webhooks, err := webhook.NewDispatcher(gsa.cfg.Webhooks, gsa.log.Named("webhook"))
+	if err != nil {
+		return fmt.Errorf("failed to configure webhooks: %w", err)
+	}
+	gsa.runBackground(ctx, "webhook", webhooks.Run)
+
+	eng := engine.New(ms, opts)
+	// Passes and background services stay paused if the agent was stopped in maintenance mode
+	if err := gsa.restoreMaintenance(ctx, ms, clientID, eng); err != nil {
+		return err
+	}
+	sched, err := gsa.newScheduler(ms, eng, limiter, webhooks, clientID)
+	if err != nil {
+		return err
+	}
+	gsa.runBackground(ctx, "scheduler", sched.run)
+
+	if gsa.cfg.Snapshots.Enabled {
+		snapshots, err := newSnapshotter(gsa.cfg.Snapshots, ms, meter, eng, gsa.log.Named("snapshot"), clientID)
+		if err != nil {
+			return err
 		}
+		sched.snapshots = snapshots
+		gsa.runBackground(ctx, "snapshots", snapshots.run)
+	}
+
+	if gsa.cfg.Scanner.Enabled {
+		gsa.runBackground(ctx, "scanner", func(ctx context.Context) error {
+			return gsa.runScans(ctx, ms, eng)
+		})
+	}
 
-		sqliteStore, err := store.NewSQLiteStore(store.SQLiteConfig{
-			Path:     gsa.cfg.Metadata.SQLite.Path,
-			LogLevel: gormLogLevel,
+	if gsa.cfg.Digest.Enabled {
+		gsa.runBackground(ctx, "digest", func(ctx context.Context) error {
+			return gsa.runDigests(ctx, ms, webhooks, clientID)
 		})
+	}
+
+	health := newHealthChecker(ms, meter)
+	gsa.runBackground(ctx, "health", health.run)
+
+	gsa.clientID = clientID
+	gsa.startedAt = time.Now().UTC()
+	gsa.store = ms
+	gsa.meter = meter
+	gsa.cache = opts.Cache
+	gsa.engine = eng
+	gsa.limiter = limiter
+	gsa.pool = pool
+	gsa.scheduler = sched
+	gsa.health = health
+
+	// The registry serves /metrics and is pushed by the exporter, so both always report the same values
+	gsa.metrics = metrics.NewRegistry()
+	gsa.metrics.Register(metrics.CollectorFunc(gsa.collectMetrics))
+	if gsa.cfg.Metrics.Export.Enabled {
+		exporter, err := metrics.NewExporter(gsa.cfg.Metrics.Export, gsa.metrics, gsa.log.Named("metrics"))
 		if err != nil {
-			return nil, fmt.Errorf("failed to create sqlite store: %w", err)
+			return fmt.Errorf("failed to configure metrics export: %w", err)
 		}
+		gsa.runBackground(ctx, "metrics", exporter.Run)
+	}
 
-		// Connect to database
-		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
-		defer cancel()
+	gsa.runBackground(ctx, "heartbeat", gsa.runHeartbeat)
+	gsa.runBackground(ctx, "signals", gsa.runSignals)
 
-		if err := sqliteStore.Connect(ctx); err != nil {
-			return nil, fmt.Errorf("failed to connect to database: %w", err)
+	var authenticator api.Authenticator
+	if gsa.cfg.API.Auth {
+		tokens := auth.NewTokens(ms)
+		if existing, err := tokens.List(ctx); err == nil && len(existing) == 0 {
+			gsa.log.Warn("API authentication is enabled, but no tokens exist yet; create one with 'gosync token create'")
 		}
+		authenticator = tokens
+	}
+
+	tlsConfig, err := api.ServerTLSConfig(gsa.cfg.API.TLS, gsa.cfg.API.Address, gsa.log.Named("api"))
+	if err != nil {
+		return fmt.Errorf("failed to configure api tls: %w", err)
+	}
+
+	server := api.NewServer(gsa.cfg.API.Address, gsa, authenticator, gsa.log.Named("api"))
+	server.SetTLSConfig(tlsConfig)
+	server.SetRateLimit(gsa.cfg.API.RateLimit, gsa.cfg.API.RateBurst)
+	if gsa.cfg.API.Dashboard {
+		server.SetDashboard(web.Handler())
+	}
+	gsa.runBackground(ctx, "api", server.Run)
 
-		// Run migrations
-		gsa.log.Info("Running database migrations...")
-		migrator := migrations.NewMigrator(sqliteStore.DB())
-		if err := migrator.Migrate(ctx); err != nil {
-			return nil, fmt.Errorf("failed to run migrations: %w", err)
+	return nil
+}
+
+// runBackground runs fn in a goroutine that is awaited during shutdown
+func (gsa *GoSyncAgent) runBackground(ctx context.Context, name string, fn func(ctx context.Context) error) {
+	gsa.wait.Add(1)
+	gsa.services.set(name, api.ComponentOK)
+	go func() {
+		defer gsa.wait.Done()
+
+		if err := fn(ctx); err != nil && ctx.Err() == nil {
+			gsa.log.Error("Background service '%s' failed: %v", name, err)
+			gsa.services.set(name, api.ComponentDown)
+			return
 		}
+		gsa.services.set(name, "")
+	}()
+}
+
+// resolve returns the service registered for the type T
+func resolve[T any](ctx context.Context, sc *container.ServiceContainer) (T, error) {
+	var zero T
 
-		gsa.log.Info("Metadata store initialized successfully")
-		return sqliteStore, nil
+	t := reflect.TypeOf((*T)(nil)).Elem()
+	ok, resolved := sc.ResolveByType(ctx, t)
+	if !ok {
+		return zero, fmt.Errorf("failed to resolve service '%s'", t)
+	}
 
-	default:
-		return nil, fmt.Errorf("unsupported metadata store type: %s", gsa.cfg.Metadata.Type)
+	service, ok := resolved.(T)
+	if !ok {
+		return zero, fmt.Errorf("resolved service is not of type '%s'", t)
 	}
+
+	return service, nil
+}
+
+func (gsa *GoSyncAgent) initMetadataStore() (store.MetadataStore, error) {
+	gsa.log.Info("Initializing %s metadata store...", gsa.cfg.Metadata.Type)
+
+	// Connect to database and run migrations
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	metadataStore, err := store.Open(ctx, gsa.cfg.Metadata, gsa.cfg.Log.Level == "DEBUG")
+	if err != nil {
+		return nil, err
+	}
+
+	gsa.log.Info("Metadata store initialized successfully")
+	return metadataStore, nil
 }
 
 func (gsa *GoSyncAgent) Serve(ctx context.Context) error {
-	gsa.log.Info("Starting GoSync Agent...")
+	gsa.log.Info("%s", i18n.T("agent.starting"))
 
-	ctx, cancel := signal.NotifyContext(ctx, os.Interrupt)
+	ctx, cancel := signal.NotifyContext(ctx, os.Interrupt, syscall.SIGTERM)
 	defer cancel()
+	ctx, shutdown := context.WithCancelCause(ctx)
+	defer shutdown(nil)
+
+	// Background services outlive the signal, so running passes can finish their in-flight transfers
+	services, stop := context.WithCancel(context.WithoutCancel(ctx))
+	defer stop()
 
 	gsa.mutex.Lock()
+	gsa.shutdown = shutdown
 
 	gsa.log.Debug("Setting up services...")
 	if err := gsa.setupServices(); err != nil {
-		gsa.log.Error("Failed to setup services: %v", err)
+		gsa.log.Error("%s", i18n.T("agent.setup_failed", err))
+		return err
+	}
+
+	gsa.log.Debug("Starting background services...")
+	if err := gsa.startBackgroundServices(services); err != nil {
+		gsa.log.Error("%s", i18n.T("agent.start_failed", err))
 		return err
 	}
 
 	gsa.mutex.Unlock()
-	gsa.log.Info("GoSync Agent started successfully. Press Ctrl+C to stop.")
+	gsa.log.Info("%s", i18n.T("agent.started"))
 	<-ctx.Done()
-	gsa.log.Info("Shutdown signal received...")
 
 	timeout, err := time.ParseDuration(gsa.cfg.ShutdownTimeout)
 	if err != nil {
@@ -119,13 +425,36 @@ func (gsa *GoSyncAgent) Serve(ctx context.Context) error {
 		timeout = 60 * time.Second
 	}
 
-	shutdown, cancel := context.WithTimeout(context.Background(), timeout)
-	defer cancel()
+	// Revoked devices cancel their in-flight transfers right away
+	revoked := context.Cause(ctx)
+	if errors.Is(revoked, store.ErrClientRevoked) {
+		gsa.log.Error("%s", i18n.T("agent.revoked", gsa.clientID))
+		gsa.engine.SetReadOnly(true)
+	} else {
+		revoked = nil
+		gsa.log.Info("%s", i18n.T("agent.shutdown"))
 
-	if err := gsa.sc.Cleanup(shutdown); err != nil {
-		return fmt.Errorf("failed to complete service container cleanup: %w", err)
+		// No further actions are started, while in-flight transfers get until the timeout to finish. Transfers
+		// cancelled afterwards are resumed after the restart, starting with the cursor persisted by their pass.
+		gsa.log.Info("%s", i18n.T("agent.draining", timeout))
+		draining, cancelDrain := context.WithTimeout(context.Background(), timeout)
+		defer cancelDrain()
+
+		if err := gsa.engine.Drain(draining); err != nil {
+			gsa.log.Warn("%s", i18n.T("agent.drain_timeout", timeout))
+		}
 	}
+	stop()
+
+	cleanup, cancelCleanup := context.WithTimeout(context.Background(), timeout)
+	defer cancelCleanup()
 
+	// Background services may still flush into the metadata store
 	gsa.wait.Wait()
-	return nil
+
+	if err := gsa.sc.Cleanup(cleanup); err != nil {
+		return fmt.Errorf("failed to complete service container cleanup: %w", err)
+	}
+
+	return revoked
 }
@@ -0,0 +1,85 @@
+package agent
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/mwantia/gosync/pkg/db/store"
+)
+
+// backupPrefix and backupSuffix enclose the timestamp within the file names of database backups
+const (
+	backupPrefix = "gosync-"
+	backupSuffix = ".db"
+)
+
+// runDatabaseBackups periodically writes an online backup of the metadata database and deletes older backups
+// beyond the configured number. Backups are also written in maintenance mode, since they don't change any data.
+func (gsa *GoSyncAgent) runDatabaseBackups(ctx context.Context, ms store.MetadataStore) error {
+	cfg := gsa.cfg.Metadata.SQLite.Backup
+	interval, err := time.ParseDuration(cfg.Interval)
+	if err != nil {
+		return fmt.Errorf("invalid database backup interval '%s': %w", cfg.Interval, err)
+	}
+
+	dir := cfg.Dir
+	if dir == "" {
+		dir = filepath.Join(filepath.Dir(gsa.cfg.Metadata.SQLite.Path), "backups")
+	}
+
+	log := gsa.log.Named("backup")
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-ticker.C:
+		}
+
+		started := time.Now()
+		name := filepath.Join(dir, backupPrefix+started.UTC().Format("20060102T150405")+backupSuffix)
+		if err := ms.Backup(ctx, name); err != nil {
+			log.Error("Failed to back up database: %v", err)
+			continue
+		}
+		log.Info("Backed up database to '%s' in %s", name, time.Since(started).Round(time.Millisecond))
+
+		if err := pruneBackups(dir, cfg.Keep); err != nil {
+			log.Error("Failed to delete old database backups: %v", err)
+		}
+	}
+}
+
+// pruneBackups deletes all but the latest keep backups within dir
+func pruneBackups(dir string, keep int) error {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return err
+	}
+
+	var backups []string
+	for _, entry := range entries {
+		if !entry.IsDir() && strings.HasPrefix(entry.Name(), backupPrefix) && strings.HasSuffix(entry.Name(), backupSuffix) {
+			backups = append(backups, entry.Name())
+		}
+	}
+	if len(backups) <= keep {
+		return nil
+	}
+
+	// Timestamps within the names sort chronologically
+	sort.Strings(backups)
+	for _, name := range backups[:len(backups)-keep] {
+		if err := os.Remove(filepath.Join(dir, name)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,131 @@
+package agent
+
+import (
+	"context"
+	"fmt"
+	"path"
+	"sort"
+	"time"
+
+	"github.com/mwantia/gosync/internal/api"
+	"github.com/mwantia/gosync/pkg/backend"
+	"github.com/mwantia/gosync/pkg/db/models"
+	"github.com/mwantia/gosync/pkg/vfs"
+)
+
+// Activity returns the daily activity of all syncs over the last days including today, summed over all clients
+func (gsa *GoSyncAgent) Activity(ctx context.Context, days int) ([]api.Activity, error) {
+	gsa.mutex.RLock()
+	defer gsa.mutex.RUnlock()
+
+	configs, err := gsa.store.ListSyncConfigs(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list syncs: %w", err)
+	}
+	names := make(map[uint]string, len(configs))
+	for _, config := range configs {
+		names[config.ID] = config.Name
+	}
+
+	today := time.Now().UTC()
+	from := today.AddDate(0, 0, 1-days).Format(time.DateOnly)
+	rollups, err := gsa.store.ListSyncActivity(ctx, 0, from, today.Format(time.DateOnly))
+	if err != nil {
+		return nil, fmt.Errorf("failed to list activity: %w", err)
+	}
+
+	type key struct {
+		day  string
+		sync uint
+	}
+	summed := make(map[key]*api.Activity)
+	for _, rollup := range rollups {
+		name, ok := names[rollup.SyncConfigID]
+		if !ok {
+			continue
+		}
+		k := key{day: rollup.Day, sync: rollup.SyncConfigID}
+		a, ok := summed[k]
+		if !ok {
+			a = &api.Activity{Day: rollup.Day, Sync: name}
+			summed[k] = a
+		}
+		a.Passes += rollup.Passes
+		a.Added += rollup.Added
+		a.Changed += rollup.Changed
+		a.Deleted += rollup.Deleted
+		a.Conflicts += rollup.Conflicts
+		a.Errors += rollup.Errors
+		a.Bytes += rollup.Bytes
+	}
+
+	result := make([]api.Activity, 0, len(summed))
+	for _, a := range summed {
+		result = append(result, *a)
+	}
+	sort.Slice(result, func(i, j int) bool {
+		if result[i].Day != result[j].Day {
+			return result[i].Day < result[j].Day
+		}
+		return result[i].Sync < result[j].Sync
+	})
+	return result, nil
+}
+
+// Browse returns the files and directories within the directory of the virtual path, like "gosync vfs ls".
+// The root lists all backends as directories with their total usage.
+func (gsa *GoSyncAgent) Browse(ctx context.Context, p string) ([]api.Entry, error) {
+	gsa.mutex.RLock()
+	defer gsa.mutex.RUnlock()
+
+	vp := vfs.ParsePath(p)
+	if vp.IsRoot() {
+		backends, err := gsa.store.ListBackends(ctx)
+		if err != nil {
+			return nil, fmt.Errorf("failed to list backends: %w", err)
+		}
+		entries := make([]api.Entry, 0, len(backends))
+		for _, b := range backends {
+			entry := api.Entry{Name: b.ID, Dir: true}
+			if usage, err := gsa.store.GetStorageUsage(ctx, b.ID, ""); err == nil {
+				entry.Size = usage.Bytes
+			}
+			entries = append(entries, entry)
+		}
+		return entries, nil
+	}
+	if _, err := gsa.store.GetBackend(ctx, vp.Backend); err != nil {
+		return nil, fmt.Errorf("%w: backend '%s'", api.ErrNotFound, vp.Backend)
+	}
+
+	locks, err := backend.NewLocker(gsa.store, vp.Backend).List(ctx, vp.Key)
+	if err != nil {
+		return nil, err
+	}
+	owners := make(map[string]string, len(locks))
+	for _, lock := range locks {
+		owners[lock.Path] = lock.Owner
+	}
+
+	var objects []vfs.Object
+	err = gsa.store.IterateFiles(ctx, vp.Backend, vp.Key, func(file *models.File) error {
+		objects = append(objects, vfs.Object{Key: file.Path, Size: file.Size, ModifiedAt: file.ModifiedAt, LockedBy: owners[file.Path]})
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to list files: %w", err)
+	}
+
+	collapsed := vfs.Collapse(vp.Key, objects)
+	entries := make([]api.Entry, 0, len(collapsed))
+	for _, entry := range collapsed {
+		entries = append(entries, api.Entry{Name: entry.Name, Dir: entry.IsDir, Size: entry.Size, ModifiedAt: entry.ModifiedAt, LockedBy: entry.LockedBy})
+	}
+	for _, object := range objects {
+		// The path references a single file instead of a directory
+		if object.Key == vp.Key {
+			entries = append(entries, api.Entry{Name: path.Base(object.Key), Size: object.Size, ModifiedAt: object.ModifiedAt, LockedBy: object.LockedBy})
+		}
+	}
+	return entries, nil
+}
@@ -0,0 +1,130 @@
+package agent
+
+import (
+	"bytes"
+	"fmt"
+	"runtime"
+	"strings"
+	"time"
+
+	"github.com/mwantia/gosync/pkg/log"
+)
+
+// diagnosticsTimeout limits waiting for the state of the agent, which can't be read while a lock is held forever
+const diagnosticsTimeout = 5 * time.Second
+
+// diagnosticErrors limits the number of recent errors included in the diagnostics
+const diagnosticErrors = 10
+
+// dumpDiagnostics writes the sync state, queues and stacks of all goroutines to the log.
+// The stacks are written even if the state can't be read, since that's usually the case for stuck agents.
+func (gsa *GoSyncAgent) dumpDiagnostics() {
+	gsa.log.Info("Dumping diagnostics...")
+
+	state := make(chan string, 1)
+	go func() {
+		state <- gsa.diagnosticState()
+	}()
+
+	select {
+	case s := <-state:
+		gsa.log.Info("Sync state:\n%s", strings.TrimSuffix(s, "\n"))
+	case <-time.After(diagnosticsTimeout):
+		gsa.log.Warn("Failed to read the sync state within %s, the agent may be deadlocked", diagnosticsTimeout)
+	}
+
+	gsa.log.Info("Goroutine stacks (%d goroutines):\n%s", runtime.NumGoroutine(), bytes.TrimSpace(goroutineStacks()))
+}
+
+// diagnosticState formats the same state as the status, without querying the metadata store
+func (gsa *GoSyncAgent) diagnosticState() string {
+	gsa.mutex.RLock()
+	defer gsa.mutex.RUnlock()
+
+	var b strings.Builder
+	if gsa.engine == nil {
+		b.WriteString("  agent is still starting\n")
+		return b.String()
+	}
+
+	fmt.Fprintf(&b, "  uptime: %s\n", time.Since(gsa.startedAt).Round(time.Second))
+	if gsa.maintenance != nil {
+		fmt.Fprintf(&b, "  maintenance: enabled since %s (%s)\n", gsa.maintenance.Since.Format(time.RFC3339), gsa.maintenance.Reason)
+	}
+
+	syncs := gsa.engine.Progress()
+	fmt.Fprintf(&b, "  running: %d of %d slots\n", len(syncs), gsa.scheduler.concurrency)
+	for _, p := range syncs {
+		fmt.Fprintf(&b, "    %s: phase %s for %s, %d/%d actions, %d failed, %d queued\n", p.Name, p.Phase,
+			time.Since(p.PhaseStartedAt).Round(time.Second), p.Completed, p.Actions, p.Failed, p.Queued())
+		for _, t := range p.Active {
+			fmt.Fprintf(&b, "      %s %s (%d/%d bytes)\n", t.Type, t.Path, t.BytesDone, t.Size)
+		}
+	}
+
+	scheduled := gsa.scheduler.Scheduled()
+	fmt.Fprintf(&b, "  scheduled: %d\n", len(scheduled))
+	for _, s := range scheduled {
+		switch {
+		case s.Waiting:
+			fmt.Fprintf(&b, "    %s: waiting for a free slot since %s\n", s.Name, s.NextRun.Format(time.RFC3339))
+		case s.NextRun.IsZero():
+			fmt.Fprintf(&b, "    %s: not scheduled\n", s.Name)
+		case s.PollInterval > 0:
+			fmt.Fprintf(&b, "    %s: next run at %s, polling every %s (change rate %.2f)\n", s.Name, s.NextRun.Format(time.RFC3339),
+				time.Duration(s.PollInterval)*time.Second, s.ChangeRate)
+		default:
+			fmt.Fprintf(&b, "    %s: next run at %s\n", s.Name, s.NextRun.Format(time.RFC3339))
+		}
+	}
+
+	resources := gsa.limiter.Stats()
+	fmt.Fprintf(&b, "  resources: %d/%d open files, %d/%d bytes memory, %d actions delayed, %d passes shed\n",
+		resources.OpenFiles, resources.MaxOpenFiles, resources.Memory, resources.MemoryWatermark, resources.Delayed, resources.Shed)
+	if gsa.pool != nil {
+		pool := gsa.pool.Stats()
+		fmt.Fprintf(&b, "  worker pool: %d/%d used, %d actions waiting\n", pool.Used, pool.Size, pool.Waiting)
+	}
+
+	for _, h := range gsa.health.Backends() {
+		if !h.Healthy {
+			fmt.Fprintf(&b, "  backend %s: unhealthy at %s: %s\n", h.ID, h.CheckedAt.Format(time.RFC3339), h.Error)
+		}
+	}
+
+	recent := gsa.engine.RecentErrors()
+	fmt.Fprintf(&b, "  recent errors: %d\n", len(recent))
+	for i := 0; i < len(recent) && i < diagnosticErrors; i++ {
+		e := recent[i]
+		fmt.Fprintf(&b, "    %s %s: %s\n", e.Time.Format(time.RFC3339), strings.TrimSuffix(e.Sync+"/"+e.Path, "/"), e.Error)
+	}
+
+	return b.String()
+}
+
+// toggleDebug switches the log level between DEBUG and the configured level
+func (gsa *GoSyncAgent) toggleDebug() {
+	level := log.Debug
+	if gsa.log.Level() == log.Debug {
+		level = log.Parse(gsa.cfg.Log.Level)
+		if level == log.Debug {
+			level = log.Info
+		}
+	}
+
+	// Logged as warning, so the change is visible with the common levels in both directions
+	gsa.log.Warn("Changing log level from %s to %s", gsa.log.Level(), level)
+	gsa.log.SetLevel(level)
+}
+
+// goroutineStacks returns the stacks of all goroutines, growing the buffer until they fit
+func goroutineStacks() []byte {
+	buf := make([]byte, 64<<10)
+	for {
+		n := runtime.Stack(buf, true)
+		if n < len(buf) {
+			return buf[:n]
+		}
+		buf = make([]byte, 2*len(buf))
+	}
+}
@@ -0,0 +1,165 @@
+package agent
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"net"
+	"net/smtp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	config "github.com/mwantia/gosync/internal/config/server"
+	"github.com/mwantia/gosync/pkg/db/store"
+	"github.com/mwantia/gosync/pkg/schedule"
+	"github.com/mwantia/gosync/pkg/webhook"
+)
+
+// runDigests sends a digest of the activity of all syncs on this client whenever the schedule of the digest is due.
+// Digests are built from the daily activity rollups and sent to webhooks subscribed to "sync.digest" and by email.
+func (gsa *GoSyncAgent) runDigests(ctx context.Context, ms store.MetadataStore, webhooks *webhook.Dispatcher, clientID string) error {
+	cfg := gsa.cfg.Digest
+	cron, err := schedule.ParseCron(cfg.Schedule)
+	if err != nil {
+		return fmt.Errorf("invalid digest schedule: %w", err)
+	}
+
+	log := gsa.log.Named("digest")
+	for {
+		next := cron.Next(time.Now())
+		if next.IsZero() {
+			return fmt.Errorf("digest schedule '%s' never matches", cfg.Schedule)
+		}
+
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-time.After(time.Until(next)):
+		}
+
+		if gsa.inMaintenance() {
+			log.Debug("Skipping digest in maintenance mode")
+			continue
+		}
+
+		digest, err := buildDigest(ctx, ms, clientID, cfg.Period, next)
+		if err != nil {
+			log.Error("Failed to build digest: %v", err)
+			continue
+		}
+
+		webhooks.Notify(webhook.Event{Type: webhook.EventDigest, ClientID: clientID, Digest: digest})
+		if cfg.Email.Host != "" {
+			if err := sendDigestMail(cfg.Email, clientID, digest); err != nil {
+				log.Error("Failed to mail digest: %v", err)
+				continue
+			}
+		}
+		log.Info("Sent %s digest of %d syncs from %s to %s", digest.Period, len(digest.Syncs), digest.From, digest.To)
+	}
+}
+
+// buildDigest sums up the activity of this client per sync over the complete days of the period before now.
+// Syncs without any activity are included, so their absence stands out.
+func buildDigest(ctx context.Context, ms store.MetadataStore, clientID, period string, now time.Time) (*webhook.Digest, error) {
+	days := 1
+	if period == "weekly" {
+		days = 7
+	}
+
+	to := now.UTC().AddDate(0, 0, -1)
+	from := to.AddDate(0, 0, -(days - 1))
+	digest := &webhook.Digest{
+		Period: period,
+		From:   from.Format("2006-01-02"),
+		To:     to.Format("2006-01-02"),
+	}
+
+	configs, err := ms.ListSyncConfigs(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list syncs: %w", err)
+	}
+	activities, err := ms.ListSyncActivity(ctx, 0, digest.From, digest.To)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list activity: %w", err)
+	}
+
+	syncs := make(map[uint]*webhook.DigestSync, len(configs))
+	for _, sc := range configs {
+		syncs[sc.ID] = &webhook.DigestSync{Sync: sc.Name}
+	}
+	for _, a := range activities {
+		s, ok := syncs[a.SyncConfigID]
+		if !ok || a.ClientID != clientID {
+			continue
+		}
+		s.Passes += a.Passes
+		s.Added += a.Added
+		s.Changed += a.Changed
+		s.Deleted += a.Deleted
+		s.Conflicts += a.Conflicts
+		s.Errors += a.Errors
+		s.Bytes += a.Bytes
+	}
+
+	for _, s := range syncs {
+		digest.Syncs = append(digest.Syncs, *s)
+	}
+	sort.Slice(digest.Syncs, func(i, j int) bool {
+		return digest.Syncs[i].Sync < digest.Syncs[j].Sync
+	})
+	return digest, nil
+}
+
+// sendDigestMail sends the digest as plain text mail, authenticating only if a username is configured
+func sendDigestMail(cfg config.DigestEmailConfig, clientID string, digest *webhook.Digest) error {
+	var body bytes.Buffer
+	fmt.Fprintf(&body, "From: %s\r\n", cfg.From)
+	fmt.Fprintf(&body, "To: %s\r\n", strings.Join(cfg.To, ", "))
+	fmt.Fprintf(&body, "Subject: GoSync %s digest of %s (%s)\r\n", digest.Period, clientID, digestRange(digest))
+	fmt.Fprintf(&body, "Date: %s\r\n", time.Now().Format(time.RFC1123Z))
+	body.WriteString("Content-Type: text/plain; charset=utf-8\r\n\r\n")
+
+	fmt.Fprintf(&body, "Activity of all syncs on %s (%s):\r\n\r\n", clientID, digestRange(digest))
+	for _, s := range digest.Syncs {
+		if s.Passes == 0 {
+			fmt.Fprintf(&body, "%s: no passes\r\n", s.Sync)
+			continue
+		}
+		fmt.Fprintf(&body, "%s: %d added, %d changed, %d deleted, %s moved, %d conflicts, %d errors in %d passes\r\n",
+			s.Sync, s.Added, s.Changed, s.Deleted, formatBytes(s.Bytes), s.Conflicts, s.Errors, s.Passes)
+	}
+	if len(digest.Syncs) == 0 {
+		body.WriteString("No syncs are configured.\r\n")
+	}
+
+	var auth smtp.Auth
+	if cfg.Username != "" {
+		auth = smtp.PlainAuth("", cfg.Username, cfg.Password, cfg.Host)
+	}
+	address := net.JoinHostPort(cfg.Host, strconv.Itoa(cfg.Port))
+	return smtp.SendMail(address, auth, cfg.From, cfg.To, body.Bytes())
+}
+
+func digestRange(digest *webhook.Digest) string {
+	if digest.From == digest.To {
+		return digest.From
+	}
+	return digest.From + " to " + digest.To
+}
+
+// formatBytes formats the size with binary units, e.g. "1.5 GiB"
+func formatBytes(size int64) string {
+	const unit = 1024
+	if size < unit {
+		return fmt.Sprintf("%d B", size)
+	}
+	div, exp := int64(unit), 0
+	for n := size / unit; n >= unit; n /= unit {
+		div *= unit
+		exp++
+	}
+	return fmt.Sprintf("%.1f %ciB", float64(size)/float64(div), "KMGTPE"[exp])
+}
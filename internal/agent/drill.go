@@ -0,0 +1,72 @@
+package agent
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"time"
+
+	"github.com/mwantia/gosync/pkg/backend"
+	"github.com/mwantia/gosync/pkg/db/store"
+	"github.com/mwantia/gosync/pkg/storage"
+)
+
+// runRestoreDrills periodically restores a sample of files of all configured backends and verifies their hashes
+func (gsa *GoSyncAgent) runRestoreDrills(ctx context.Context, ms store.MetadataStore, meter *storage.Meter) error {
+	interval, err := time.ParseDuration(gsa.cfg.Drills.Interval)
+	if err != nil {
+		return fmt.Errorf("invalid restore drill interval '%s': %w", gsa.cfg.Drills.Interval, err)
+	}
+
+	log := gsa.log.Named("drill")
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-ticker.C:
+		}
+
+		if gsa.inMaintenance() {
+			log.Debug("Skipping restore drills in maintenance mode")
+			continue
+		}
+
+		backends, err := ms.ListBackends(ctx)
+		if err != nil {
+			log.Error("Failed to list backends: %v", err)
+			continue
+		}
+
+		for i := range backends {
+			b := &backends[i]
+			if len(gsa.cfg.Drills.Backends) > 0 && !slices.Contains(gsa.cfg.Drills.Backends, b.ID) {
+				continue
+			}
+
+			st, err := meter.Open(b)
+			if err != nil {
+				log.Error("Failed to create storage for backend '%s': %v", b.ID, err)
+				continue
+			}
+
+			result, err := backend.NewDrill(ms, st, b).Run(ctx, backend.DrillOptions{
+				Samples:     gsa.cfg.Drills.Samples,
+				MaxFileSize: int64(gsa.cfg.Drills.MaxFileSize) << 20,
+			})
+			storage.Close(st)
+			switch {
+			case err != nil:
+				log.Error("Failed to run restore drill of backend '%s': %v", b.ID, err)
+			case result.Error != "":
+				log.Error("Restore drill of backend '%s' failed: %s", b.ID, result.Error)
+			case result.Failed > 0:
+				log.Error("Restore drill of backend '%s' failed to restore %d of %d files:\n%s", b.ID, result.Failed, result.Sampled, result.Failures)
+			default:
+				log.Info("Restore drill of backend '%s' verified %d files", b.ID, result.Verified)
+			}
+		}
+	}
+}
@@ -0,0 +1,133 @@
+package agent
+
+import (
+	"context"
+	"errors"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/mwantia/gosync/internal/api"
+	"github.com/mwantia/gosync/pkg/db/models"
+	"github.com/mwantia/gosync/pkg/db/store"
+	"github.com/mwantia/gosync/pkg/storage"
+)
+
+// healthCheckInterval defines how often the reachability of all backends is checked
+const healthCheckInterval = time.Minute
+
+// healthCheckTimeout limits the duration of a single backend health check
+const healthCheckTimeout = 10 * time.Second
+
+// healthProbePrefix is listed to check a backend, which is expected to match no objects
+const healthProbePrefix = ".gosync-health/"
+
+var errProbeDone = errors.New("probe done")
+
+// healthChecker periodically checks whether all backends are reachable
+type healthChecker struct {
+	mutex sync.RWMutex
+
+	store    store.MetadataStore
+	meter    *storage.Meter
+	backends []api.BackendHealth
+}
+
+func newHealthChecker(ms store.MetadataStore, meter *storage.Meter) *healthChecker {
+	return &healthChecker{
+		store: ms,
+		meter: meter,
+	}
+}
+
+// run checks all backends until the context is cancelled
+func (h *healthChecker) run(ctx context.Context) error {
+	ticker := time.NewTicker(healthCheckInterval)
+	defer ticker.Stop()
+
+	for {
+		if err := h.check(ctx); err != nil && ctx.Err() == nil {
+			return err
+		}
+
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-ticker.C:
+		}
+	}
+}
+
+// check runs the health checks of all backends in parallel
+func (h *healthChecker) check(ctx context.Context) error {
+	backends, err := h.store.ListBackends(ctx)
+	if err != nil {
+		return err
+	}
+
+	results := make([]api.BackendHealth, len(backends))
+
+	var wait sync.WaitGroup
+	for i := range backends {
+		wait.Add(1)
+		go func() {
+			defer wait.Done()
+
+			results[i] = api.BackendHealth{
+				ID:     backends[i].ID,
+				Name:   backends[i].Name,
+				Health: h.probe(ctx, &backends[i]),
+			}
+		}()
+	}
+	wait.Wait()
+
+	sort.Slice(results, func(i, j int) bool {
+		return results[i].ID < results[j].ID
+	})
+
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+
+	h.backends = results
+	return nil
+}
+
+func (h *healthChecker) probe(ctx context.Context, b *models.Backend) api.Health {
+	ctx, cancel := context.WithTimeout(ctx, healthCheckTimeout)
+	defer cancel()
+
+	started := time.Now()
+	err := func() error {
+		st, err := h.meter.Open(b)
+		if err != nil {
+			return err
+		}
+		defer storage.Close(st)
+		return st.List(ctx, healthProbePrefix, func(storage.ObjectInfo) error {
+			return errProbeDone
+		})
+	}()
+
+	return newHealth(started, err)
+}
+
+// Backends returns the results of the last health check
+func (h *healthChecker) Backends() []api.BackendHealth {
+	h.mutex.RLock()
+	defer h.mutex.RUnlock()
+
+	return append([]api.BackendHealth(nil), h.backends...)
+}
+
+func newHealth(started time.Time, err error) api.Health {
+	health := api.Health{
+		Healthy:   err == nil || errors.Is(err, errProbeDone),
+		Latency:   time.Since(started),
+		CheckedAt: started.UTC(),
+	}
+	if !health.Healthy {
+		health.Error = err.Error()
+	}
+	return health
+}
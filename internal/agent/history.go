@@ -0,0 +1,77 @@
+package agent
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+
+	"github.com/mwantia/gosync/internal/api"
+	"github.com/mwantia/gosync/pkg/db/store"
+)
+
+// maxHistoryLimit is the maximum number of operations returned by History at once, older operations are
+// paged through by the ID of the last returned operation
+const maxHistoryLimit = 1000
+
+// History returns the operations of the transfer log matching the request, the latest first
+func (gsa *GoSyncAgent) History(ctx context.Context, req api.HistoryRequest) ([]api.Transfer, error) {
+	gsa.mutex.RLock()
+	defer gsa.mutex.RUnlock()
+
+	filter := store.TransferLogFilter{
+		Path:     req.Path,
+		ClientID: req.Client,
+		Since:    req.Since,
+		Until:    req.Until,
+		Failed:   req.Failed,
+		Before:   req.Before,
+		Limit:    req.Limit,
+	}
+	if filter.Limit <= 0 || filter.Limit > maxHistoryLimit {
+		filter.Limit = maxHistoryLimit
+	}
+	if req.Sync != "" {
+		sc, err := gsa.loadSyncConfig(ctx, req.Sync)
+		if err != nil {
+			return nil, err
+		}
+		filter.SyncConfigID = sc.ID
+	}
+
+	entries, err := gsa.store.ListTransferLogs(ctx, filter)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read transfer log: %w", err)
+	}
+
+	configs, err := gsa.store.ListSyncConfigs(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list syncs: %w", err)
+	}
+	names := make(map[uint]string, len(configs))
+	for _, config := range configs {
+		names[config.ID] = config.Name
+	}
+
+	transfers := make([]api.Transfer, 0, len(entries))
+	for _, entry := range entries {
+		name, ok := names[entry.SyncConfigID]
+		if !ok {
+			// The operations of deleted syncs are kept until they are pruned
+			name = "#" + strconv.FormatUint(uint64(entry.SyncConfigID), 10)
+		}
+		transfers = append(transfers, api.Transfer{
+			ID:          entry.ID,
+			Sync:        name,
+			Client:      entry.ClientID,
+			Operation:   entry.Operation,
+			Source:      entry.Source,
+			Destination: entry.Destination,
+			Bytes:       entry.Bytes,
+			Result:      entry.Result,
+			Error:       entry.Error,
+			StartedAt:   entry.StartedAt,
+			FinishedAt:  entry.FinishedAt,
+		})
+	}
+	return transfers, nil
+}
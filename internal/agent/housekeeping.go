@@ -0,0 +1,132 @@
+package agent
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/mwantia/gosync/pkg/db/store"
+	"github.com/mwantia/gosync/pkg/dedup"
+	"github.com/mwantia/gosync/pkg/storage"
+)
+
+// runDatabaseMaintenance periodically hard-deletes soft-deleted records older than the retention,
+// prunes records of files and syncs that no longer exist, collects unreferenced chunks and vacuums the database
+func (gsa *GoSyncAgent) runDatabaseMaintenance(ctx context.Context, ms store.MetadataStore, meter *storage.Meter) error {
+	cfg := gsa.cfg.Metadata.Maintenance
+	interval, err := time.ParseDuration(cfg.Interval)
+	if err != nil {
+		return fmt.Errorf("invalid database maintenance interval '%s': %w", cfg.Interval, err)
+	}
+	retention, err := time.ParseDuration(cfg.Retention)
+	if err != nil {
+		return fmt.Errorf("invalid database maintenance retention '%s': %w", cfg.Retention, err)
+	}
+	grace, err := time.ParseDuration(cfg.ChunkGrace)
+	if err != nil {
+		return fmt.Errorf("invalid chunk grace period '%s': %w", cfg.ChunkGrace, err)
+	}
+
+	log := gsa.log.Named("housekeeping")
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-ticker.C:
+		}
+
+		if gsa.inMaintenance() {
+			log.Debug("Skipping database maintenance in maintenance mode")
+			continue
+		}
+
+		started := time.Now()
+		purged, err := ms.PurgeDeleted(ctx, started.UTC().Add(-retention))
+		if err != nil {
+			log.Error("Failed to purge deleted records: %v", err)
+			continue
+		}
+		pruned, err := ms.PruneOrphans(ctx)
+		if err != nil {
+			log.Error("Failed to prune orphaned records: %v", err)
+			continue
+		}
+		// Chunks are collected after pruning, which removes the references of purged files
+		collected := gsa.collectChunks(ctx, ms, meter, started.UTC().Add(-grace))
+		if cfg.Vacuum {
+			if err := ms.Vacuum(ctx); err != nil {
+				log.Error("Failed to vacuum database: %v", err)
+				continue
+			}
+		}
+
+		log.Info("Purged %d deleted and %d orphaned records and %d unreferenced chunks in %s", purged, pruned, collected, time.Since(started).Round(time.Millisecond))
+	}
+}
+
+// collectChunks deletes the chunks created before the time that no file of their backend references anymore,
+// returning the number of deleted chunks. Failed backends are logged and collected by the next run.
+func (gsa *GoSyncAgent) collectChunks(ctx context.Context, ms store.MetadataStore, meter *storage.Meter, before time.Time) int {
+	log := gsa.log.Named("housekeeping")
+	backends, err := ms.ListBackends(ctx)
+	if err != nil {
+		log.Error("Failed to list backends: %v", err)
+		return 0
+	}
+
+	collected := 0
+	for i := range backends {
+		b := &backends[i]
+		st, err := meter.Open(b)
+		if err != nil {
+			log.Error("Failed to create storage for backend '%s': %v", b.ID, err)
+			continue
+		}
+
+		n, err := dedup.NewStore(ms, st, b).CollectGarbage(ctx, before)
+		storage.Close(st)
+		collected += n
+		if err != nil {
+			log.Error("Failed to collect chunks of backend '%s': %v", b.ID, err)
+		}
+	}
+	return collected
+}
+
+// runTransferLogPruning periodically deletes the oldest entries of the transfer log, once it exceeds its size
+func (gsa *GoSyncAgent) runTransferLogPruning(ctx context.Context, ms store.MetadataStore) error {
+	cfg := gsa.cfg.History
+	interval, err := time.ParseDuration(cfg.PruneInterval)
+	if err != nil {
+		return fmt.Errorf("invalid transfer log prune interval '%s': %w", cfg.PruneInterval, err)
+	}
+
+	log := gsa.log.Named("history")
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-ticker.C:
+		}
+
+		if gsa.inMaintenance() {
+			log.Debug("Skipping transfer log pruning in maintenance mode")
+			continue
+		}
+
+		pruned, err := ms.PruneTransferLogs(ctx, int64(cfg.MaxSize)<<20)
+		if err != nil {
+			log.Error("Failed to prune transfer log: %v", err)
+			continue
+		}
+		if pruned > 0 {
+			log.Info("Pruned %d entries of the transfer log exceeding %d MB", pruned, cfg.MaxSize)
+		}
+	}
+}
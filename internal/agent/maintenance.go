@@ -0,0 +1,91 @@
+package agent
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/mwantia/gosync/internal/api"
+	"github.com/mwantia/gosync/pkg/db/models"
+	"github.com/mwantia/gosync/pkg/db/store"
+	"github.com/mwantia/gosync/pkg/engine"
+)
+
+// Maintenance returns the maintenance mode of the agent
+func (gsa *GoSyncAgent) Maintenance(ctx context.Context) (*api.Maintenance, error) {
+	gsa.mutex.RLock()
+	defer gsa.mutex.RUnlock()
+
+	if gsa.maintenance == nil {
+		return &api.Maintenance{}, nil
+	}
+	maintenance := *gsa.maintenance
+	return &maintenance, nil
+}
+
+// SetMaintenance enables or disables the maintenance mode. While enabled, the agent keeps serving
+// its status and API, but no sync passes, trash purges or database maintenance are run, so no backend,
+// local sync root or metadata is changed destructively. Running passes stop after their in-flight actions.
+// The mode is recorded in the metadata store, so it survives restarts and commands changing backends refuse
+// to run on this client.
+func (gsa *GoSyncAgent) SetMaintenance(ctx context.Context, req api.MaintenanceRequest) (*api.Maintenance, error) {
+	gsa.mutex.Lock()
+	defer gsa.mutex.Unlock()
+
+	switch {
+	case req.Enabled:
+		maintenance := &models.Maintenance{ClientID: gsa.clientID, Reason: req.Reason, Since: time.Now().UTC()}
+		if gsa.maintenance != nil {
+			maintenance.Since = gsa.maintenance.Since
+		}
+		if err := gsa.store.SaveMaintenance(ctx, maintenance); err != nil {
+			return nil, fmt.Errorf("failed to record maintenance mode: %w", err)
+		}
+		if gsa.maintenance == nil {
+			gsa.log.Warn("Entered maintenance mode: %s", req.Reason)
+		}
+		gsa.maintenance = &api.Maintenance{Enabled: true, Reason: maintenance.Reason, Since: maintenance.Since}
+
+	case gsa.maintenance != nil:
+		if err := gsa.store.DeleteMaintenance(ctx, gsa.clientID); err != nil {
+			return nil, fmt.Errorf("failed to record maintenance mode: %w", err)
+		}
+		gsa.maintenance = nil
+		gsa.log.Info("Left maintenance mode")
+	}
+	gsa.engine.SetReadOnly(req.Enabled)
+
+	if gsa.maintenance == nil {
+		return &api.Maintenance{}, nil
+	}
+	maintenance := *gsa.maintenance
+	return &maintenance, nil
+}
+
+// restoreMaintenance enters the maintenance mode recorded for the client before the agent was restarted
+func (gsa *GoSyncAgent) restoreMaintenance(ctx context.Context, ms store.MetadataStore, clientID string, eng *engine.Engine) error {
+	maintenance, err := ms.GetMaintenance(ctx, clientID)
+	if errors.Is(err, store.ErrNotFound) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("failed to load maintenance mode: %w", err)
+	}
+
+	gsa.mutex.Lock()
+	defer gsa.mutex.Unlock()
+
+	gsa.maintenance = &api.Maintenance{Enabled: true, Reason: maintenance.Reason, Since: maintenance.Since}
+	eng.SetReadOnly(true)
+	gsa.log.Warn("Resuming maintenance mode since %s: %s", maintenance.Since.Local().Format(time.DateTime), maintenance.Reason)
+	return nil
+}
+
+// inMaintenance returns true if the agent is in maintenance mode
+func (gsa *GoSyncAgent) inMaintenance() bool {
+	gsa.mutex.RLock()
+	defer gsa.mutex.RUnlock()
+
+	return gsa.maintenance != nil
+}
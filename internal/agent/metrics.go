@@ -0,0 +1,112 @@
+package agent
+
+import (
+	"context"
+	"time"
+
+	"github.com/mwantia/gosync/pkg/metrics"
+)
+
+// Metrics returns the current value of all metrics of the agent
+func (gsa *GoSyncAgent) Metrics(ctx context.Context) ([]metrics.Sample, error) {
+	return gsa.metrics.Gather(ctx)
+}
+
+// collectMetrics reads the metrics of the agent from the same state as the status
+func (gsa *GoSyncAgent) collectMetrics(ctx context.Context) ([]metrics.Sample, error) {
+	gsa.mutex.RLock()
+	defer gsa.mutex.RUnlock()
+
+	samples := []metrics.Sample{
+		gauge("uptime_seconds", "Time since the agent was started", nil, time.Since(gsa.startedAt).Seconds()),
+		gauge("maintenance", "Whether the agent is in maintenance mode", nil, boolValue(gsa.maintenance != nil)),
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, healthCheckTimeout)
+	defer cancel()
+
+	started := time.Now()
+	database := newHealth(started, gsa.store.Health(ctx))
+	samples = append(samples,
+		gauge("database_healthy", "Whether the metadata store is reachable", nil, boolValue(database.Healthy)),
+		gauge("database_latency_seconds", "Latency of the last health check of the metadata store", nil, database.Latency.Seconds()))
+
+	for _, b := range gsa.health.Backends() {
+		labels := map[string]string{"backend": b.ID}
+		samples = append(samples,
+			gauge("backend_healthy", "Whether the last health check of the backend succeeded", labels, boolValue(b.Healthy)),
+			gauge("backend_latency_seconds", "Latency of the last health check of the backend", labels, b.Latency.Seconds()))
+	}
+
+	syncs := gsa.engine.Progress()
+	samples = append(samples, gauge("syncs_running", "Number of sync passes currently running", nil, float64(len(syncs))))
+	for _, p := range syncs {
+		labels := map[string]string{"sync": p.Name}
+		samples = append(samples,
+			gauge("sync_actions", "Number of actions of the running pass", labels, float64(p.Actions)),
+			gauge("sync_actions_completed", "Number of completed actions of the running pass", labels, float64(p.Completed)),
+			gauge("sync_actions_failed", "Number of failed actions of the running pass", labels, float64(p.Failed)),
+			gauge("sync_bytes", "Number of bytes transferred by the running pass", labels, float64(p.Bytes)),
+			gauge("sync_bytes_done", "Number of bytes already transferred by the running pass", labels, float64(p.BytesDone)))
+	}
+
+	waiting := 0
+	scheduled := gsa.scheduler.Scheduled()
+	for _, s := range scheduled {
+		if s.Waiting {
+			waiting++
+		}
+	}
+	samples = append(samples,
+		gauge("syncs_scheduled", "Number of enabled syncs that aren't running", nil, float64(len(scheduled))),
+		gauge("syncs_waiting", "Number of due syncs waiting for a free scheduler slot", nil, float64(waiting)),
+		gauge("recent_errors", "Number of recently failed actions", nil, float64(len(gsa.engine.RecentErrors()))),
+		gauge("denied_paths", "Number of sync subtrees the backends denied access to", nil, float64(len(gsa.engine.DeniedPaths()))))
+
+	resources := gsa.limiter.Stats()
+	samples = append(samples,
+		gauge("open_files", "Number of files opened by sync passes", nil, float64(resources.OpenFiles)),
+		gauge("max_open_files", "Maximum number of files opened by sync passes", nil, float64(resources.MaxOpenFiles)),
+		gauge("memory_bytes", "Estimated heap memory", nil, float64(resources.Memory)),
+		gauge("memory_watermark_bytes", "Heap memory at which new work is delayed", nil, float64(resources.MemoryWatermark)),
+		counter("actions_delayed_total", "Number of actions that had to wait for resources", nil, float64(resources.Delayed)),
+		counter("passes_shed_total", "Number of scheduled passes postponed due to the memory watermark", nil, float64(resources.Shed)))
+
+	if gsa.pool != nil {
+		pool := gsa.pool.Stats()
+		samples = append(samples,
+			gauge("pool_workers", "Number of actions all passes may apply at the same time", nil, float64(pool.Size)),
+			gauge("pool_workers_used", "Number of actions currently applied by all passes", nil, float64(pool.Used)),
+			gauge("pool_actions_waiting", "Number of actions waiting for a free worker of the pool", nil, float64(pool.Waiting)))
+	}
+
+	if gsa.cache != nil {
+		cache := gsa.cache.Stats()
+		samples = append(samples,
+			gauge("cache_size_bytes", "Size of the blocks within the content cache", nil, float64(cache.Size)),
+			gauge("cache_max_size_bytes", "Size the content cache may occupy", nil, float64(cache.MaxSize)),
+			gauge("cache_blocks", "Number of blocks within the content cache", nil, float64(cache.Blocks)),
+			counter("cache_hits_total", "Number of blocks read from the content cache", nil, float64(cache.Hits)),
+			counter("cache_misses_total", "Number of blocks read from the backends, since they weren't cached", nil, float64(cache.Misses)),
+			counter("cache_read_ahead_total", "Number of blocks fetched ahead of sequential reads", nil, float64(cache.ReadAhead)),
+			counter("cache_evictions_total", "Number of blocks evicted from the content cache", nil, float64(cache.Evictions)),
+			counter("cache_fetched_bytes_total", "Number of bytes read from the backends into the content cache", nil, float64(cache.Fetched)))
+	}
+
+	return samples, nil
+}
+
+func gauge(name, help string, labels map[string]string, value float64) metrics.Sample {
+	return metrics.Sample{Name: name, Help: help, Type: metrics.TypeGauge, Labels: labels, Value: value}
+}
+
+func counter(name, help string, labels map[string]string, value float64) metrics.Sample {
+	return metrics.Sample{Name: name, Help: help, Type: metrics.TypeCounter, Labels: labels, Value: value}
+}
+
+func boolValue(b bool) float64 {
+	if b {
+		return 1
+	}
+	return 0
+}
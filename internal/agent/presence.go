@@ -0,0 +1,125 @@
+package agent
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"runtime"
+	"strings"
+	"time"
+
+	"github.com/mwantia/gosync/internal/api"
+	"github.com/mwantia/gosync/internal/i18n"
+	"github.com/mwantia/gosync/pkg/db/models"
+	"github.com/mwantia/gosync/pkg/db/store"
+	"github.com/mwantia/gosync/pkg/device"
+)
+
+// registerDevice returns the client id of this device, refusing to start if the device was revoked
+func (gsa *GoSyncAgent) registerDevice(ctx context.Context, ms store.MetadataStore) (string, error) {
+	hostname, err := os.Hostname()
+	if err != nil {
+		return "", fmt.Errorf("failed to determine client id: %w", err)
+	}
+	machineID, err := device.MachineID()
+	if err != nil {
+		return "", err
+	}
+
+	clients, err := ms.ListClients(ctx)
+	if err != nil {
+		return "", fmt.Errorf("failed to list clients: %w", err)
+	}
+
+	id := device.ClientID(clients, machineID, hostname)
+	for _, client := range clients {
+		if client.ID == id && client.RevokedAt != nil {
+			return "", i18n.Errorf("devices.revoked", id, client.RevokedAt.Local().Format(time.DateTime), revokedReason(client), id)
+		}
+	}
+
+	gsa.machineID = machineID
+	return id, nil
+}
+
+// revokedReason returns the reason the client was revoked for, or "-" if none was given
+func revokedReason(client models.Client) string {
+	if client.RevokedReason == "" {
+		return "-"
+	}
+	return client.RevokedReason
+}
+
+// runHeartbeat records the presence of this agent in the metadata store until the context is cancelled.
+// The agent is shut down once the metadata store refuses the heartbeat, since this device was revoked.
+func (gsa *GoSyncAgent) runHeartbeat(ctx context.Context) error {
+	name := gsa.cfg.Device.Name
+	if name == "" {
+		name, _ = os.Hostname()
+	}
+
+	client := &models.Client{
+		ID:        gsa.clientID,
+		Name:      name,
+		MachineID: gsa.machineID,
+		Version:   gsa.version,
+		Platform:  runtime.GOOS + "/" + runtime.GOARCH,
+		Address:   gsa.cfg.API.Address,
+		StartedAt: gsa.startedAt,
+	}
+
+	ticker := time.NewTicker(api.HeartbeatInterval)
+	defer ticker.Stop()
+
+	for {
+		if err := gsa.heartbeat(ctx, client); errors.Is(err, store.ErrClientRevoked) {
+			gsa.shutdown(err)
+			return nil
+		} else if err != nil {
+			gsa.log.Warn("Failed to record heartbeat: %v", err)
+		}
+
+		select {
+		case <-ctx.Done():
+			// Mark the client as offline right away instead of waiting for the timeout
+			stopped := time.Now().UTC()
+			client.StoppedAt = &stopped
+			return gsa.heartbeat(context.WithoutCancel(ctx), client)
+		case <-ticker.C:
+		}
+	}
+}
+
+func (gsa *GoSyncAgent) heartbeat(ctx context.Context, client *models.Client) error {
+	var names []string
+	for _, progress := range gsa.engine.Progress() {
+		names = append(names, progress.Name)
+	}
+
+	client.ActiveSyncs = strings.Join(names, ",")
+	client.LastSeenAt = time.Now().UTC()
+
+	ctx, cancel := context.WithTimeout(ctx, 10*time.Second)
+	defer cancel()
+
+	return gsa.store.SaveClient(ctx, client)
+}
+
+// Clients returns the presence of all clients sharing the metadata store
+func (gsa *GoSyncAgent) Clients(ctx context.Context) ([]api.Presence, error) {
+	gsa.mutex.RLock()
+	defer gsa.mutex.RUnlock()
+
+	clients, err := gsa.store.ListClients(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list clients: %w", err)
+	}
+
+	now := time.Now()
+	result := make([]api.Presence, 0, len(clients))
+	for _, client := range clients {
+		result = append(result, api.NewPresence(client, now))
+	}
+	return result, nil
+}
@@ -0,0 +1,155 @@
+package agent
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/mwantia/gosync/internal/api"
+)
+
+// criticalServices are the background services the agent can't work without
+var criticalServices = map[string]bool{
+	"scheduler": true,
+	"api":       true,
+}
+
+// serviceStates tracks the background services for the health report
+type serviceStates struct {
+	mutex  sync.Mutex
+	states map[string]string
+}
+
+// set records the state of the service, removing services that finished without error
+func (s *serviceStates) set(name, state string) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if s.states == nil {
+		s.states = make(map[string]string)
+	}
+	if state == "" {
+		delete(s.states, name)
+		return
+	}
+	s.states[name] = state
+}
+
+func (s *serviceStates) get(name string) (string, bool) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	state, ok := s.states[name]
+	return state, ok
+}
+
+// components returns the states of all services except skip, ordered by their name
+func (s *serviceStates) components(skip string) []api.Component {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	var result []api.Component
+	for name, state := range s.states {
+		if name == skip {
+			continue
+		}
+		result = append(result, api.Component{
+			Name:   "service/" + name,
+			Status: state,
+		})
+	}
+
+	sort.Slice(result, func(i, j int) bool {
+		return result[i].Name < result[j].Name
+	})
+	return result
+}
+
+// Health reports the state of the metadata store, the scheduler, all backends and the background services
+func (gsa *GoSyncAgent) Health(ctx context.Context) (*api.HealthReport, error) {
+	gsa.mutex.RLock()
+	defer gsa.mutex.RUnlock()
+
+	report := &api.HealthReport{
+		Live: true,
+		Time: time.Now().UTC(),
+	}
+	if gsa.engine == nil {
+		report.Status = api.ComponentDown
+		report.Components = []api.Component{{Name: "agent", Status: api.ComponentDown, Detail: "starting"}}
+		return report, nil
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, healthCheckTimeout)
+	defer cancel()
+
+	started := time.Now()
+	database := newHealth(started, gsa.store.Health(ctx))
+	metadata := api.Component{
+		Name:      "metadata",
+		Status:    api.ComponentOK,
+		Detail:    gsa.cfg.Metadata.Type,
+		Latency:   database.Latency,
+		CheckedAt: database.CheckedAt,
+	}
+	if !database.Healthy {
+		metadata.Status = api.ComponentDown
+	}
+
+	running, enabled := gsa.scheduler.Load()
+	scheduler := api.Component{
+		Name:   "scheduler",
+		Status: api.ComponentOK,
+		Detail: fmt.Sprintf("%d of %d syncs running", running, enabled),
+	}
+	if state, ok := gsa.services.get("scheduler"); ok {
+		scheduler.Status = state
+	}
+	if gsa.maintenance != nil {
+		scheduler.Status = api.ComponentDegraded
+		scheduler.Detail += ", maintenance mode"
+	}
+	if gsa.engine.Draining() {
+		scheduler.Status = api.ComponentDegraded
+		scheduler.Detail += ", shutting down"
+	}
+
+	report.Components = append(report.Components, metadata, scheduler)
+	for _, b := range gsa.health.Backends() {
+		component := api.Component{
+			Name:      "backend/" + b.ID,
+			Status:    api.ComponentOK,
+			Detail:    b.Name,
+			Latency:   b.Latency,
+			CheckedAt: b.CheckedAt,
+		}
+		if !b.Healthy {
+			// Syncs of other backends continue, so an unreachable backend only degrades the agent
+			component.Status = api.ComponentDegraded
+		}
+		report.Components = append(report.Components, component)
+	}
+	report.Components = append(report.Components, gsa.services.components("scheduler")...)
+
+	for name := range criticalServices {
+		if state, _ := gsa.services.get(name); state == api.ComponentDown {
+			report.Live = false
+		}
+	}
+	// Draining agents don't start new passes, so they stop being ready until the restart
+	report.Ready = report.Live && database.Healthy && !gsa.engine.Draining()
+
+	report.Status = api.ComponentOK
+	for _, c := range report.Components {
+		if c.Status != api.ComponentOK && report.Status == api.ComponentOK {
+			report.Status = api.ComponentDegraded
+		}
+	}
+	if !report.Ready {
+		report.Status = api.ComponentDown
+	}
+
+	return report, nil
+}
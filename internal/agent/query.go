@@ -0,0 +1,71 @@
+package agent
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+
+	"github.com/mwantia/gosync/internal/api"
+	"github.com/mwantia/gosync/pkg/backend"
+	"github.com/mwantia/gosync/pkg/storage"
+	"github.com/mwantia/gosync/pkg/vfs"
+)
+
+// Query runs a server-side query against an object through its backend. Queries only read data,
+// so they are also served in maintenance mode.
+func (gsa *GoSyncAgent) Query(ctx context.Context, req api.QueryRequest) (io.ReadCloser, error) {
+	gsa.mutex.RLock()
+	defer gsa.mutex.RUnlock()
+
+	path := vfs.ParsePath(req.Path)
+	if path.IsRoot() || path.IsBackend() {
+		return nil, fmt.Errorf("%w: '%s' doesn't reference an object", api.ErrUnsupported, req.Path)
+	}
+
+	b, err := gsa.store.GetBackend(ctx, path.Backend)
+	if err != nil {
+		return nil, fmt.Errorf("%w: no backend named '%s'", api.ErrNotFound, path.Backend)
+	}
+
+	st, err := gsa.meter.Open(b)
+	if err != nil {
+		return nil, err
+	}
+
+	reader, err := backend.NewQuery(gsa.store, st, b).Select(ctx, path.Key, storage.SelectOptions{
+		Expression:   req.Expression,
+		Format:       req.Format,
+		Compression:  req.Compression,
+		CSVHeader:    req.CSVHeader,
+		CSVDelimiter: req.CSVDelimiter,
+		JSONLines:    req.JSONLines,
+		Output:       req.Output,
+	})
+	if err != nil {
+		storage.Close(st)
+	}
+	switch {
+	case errors.Is(err, storage.ErrObjectNotFound):
+		return nil, fmt.Errorf("%w: %v", api.ErrNotFound, err)
+	case errors.Is(err, storage.ErrNotSupported):
+		return nil, fmt.Errorf("%w: %v", api.ErrUnsupported, err)
+	case err != nil:
+		return nil, err
+	}
+
+	gsa.log.Debug("Querying '%s' via API", req.Path)
+	return &queryReader{ReadCloser: reader, storage: st}, nil
+}
+
+// queryReader closes the storage of the queried backend once the result was read
+type queryReader struct {
+	io.ReadCloser
+	storage storage.Storage
+}
+
+func (r *queryReader) Close() error {
+	err := r.ReadCloser.Close()
+	storage.Close(r.storage)
+	return err
+}
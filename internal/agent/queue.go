@@ -0,0 +1,67 @@
+package agent
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/mwantia/gosync/internal/api"
+	"github.com/mwantia/gosync/pkg/engine"
+)
+
+// Queue returns the transfers waiting in the queues of all running passes
+func (gsa *GoSyncAgent) Queue(ctx context.Context) ([]engine.QueuedTransfer, error) {
+	gsa.mutex.RLock()
+	defer gsa.mutex.RUnlock()
+
+	return gsa.engine.Queue(), nil
+}
+
+// PrioritizeTransfer changes the priority of a queued transfer and returns the reordered queues
+func (gsa *GoSyncAgent) PrioritizeTransfer(ctx context.Context, id uint64, req api.QueueRequest) ([]engine.QueuedTransfer, error) {
+	gsa.mutex.RLock()
+	defer gsa.mutex.RUnlock()
+
+	if err := gsa.engine.PrioritizeTransfer(id, req.Priority); err != nil {
+		return nil, queueError(err)
+	}
+	return gsa.engine.Queue(), nil
+}
+
+// CancelTransfer removes a transfer from the queue of its pass and returns the remaining queues
+func (gsa *GoSyncAgent) CancelTransfer(ctx context.Context, id uint64) ([]engine.QueuedTransfer, error) {
+	gsa.mutex.RLock()
+	defer gsa.mutex.RUnlock()
+
+	if err := gsa.engine.CancelTransfer(id); err != nil {
+		return nil, queueError(err)
+	}
+	return gsa.engine.Queue(), nil
+}
+
+// CancelTransfers removes queued transfers and aborts in-flight transfers, returning the cancelled transfers
+func (gsa *GoSyncAgent) CancelTransfers(ctx context.Context, req api.CancelRequest) ([]engine.CancelledTransfer, error) {
+	gsa.mutex.RLock()
+	defer gsa.mutex.RUnlock()
+
+	cancelled, err := gsa.engine.CancelTransfers(engine.CancelOptions{
+		ID:      req.ID,
+		Path:    req.Path,
+		Sync:    req.Sync,
+		Requeue: req.Requeue,
+	})
+	if err != nil {
+		return nil, queueError(err)
+	}
+	for _, t := range cancelled {
+		gsa.log.Info("Cancelled transfer %d of '%s' within sync '%s' via API (in flight: %t, requeued: %t)", t.ID, t.Path, t.Sync, t.InFlight, t.Requeued)
+	}
+	return cancelled, nil
+}
+
+func queueError(err error) error {
+	if errors.Is(err, engine.ErrNotQueued) || errors.Is(err, engine.ErrNoTransfers) {
+		return fmt.Errorf("%w: %v", api.ErrNotFound, err)
+	}
+	return err
+}
@@ -0,0 +1,119 @@
+package agent
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/mwantia/gosync/internal/api"
+	"github.com/mwantia/gosync/pkg/db/models"
+	"github.com/mwantia/gosync/pkg/db/store"
+	"github.com/mwantia/gosync/pkg/engine"
+)
+
+// RunSync starts a pass of the sync through the scheduler, or only computes its plan for dry runs
+func (gsa *GoSyncAgent) RunSync(ctx context.Context, name string, req api.RunRequest) (*api.RunResponse, error) {
+	gsa.mutex.RLock()
+	defer gsa.mutex.RUnlock()
+
+	resp := &api.RunResponse{
+		Sync:   name,
+		DryRun: req.DryRun,
+		Time:   time.Now().UTC(),
+	}
+
+	if req.Rehash {
+		sc, err := gsa.loadSyncConfig(ctx, name)
+		if err != nil {
+			return nil, err
+		}
+		gsa.engine.Rehash(sc.ID)
+	}
+
+	if !req.DryRun {
+		if err := gsa.scheduler.Trigger(ctx, name); err != nil {
+			return nil, err
+		}
+		gsa.log.Info("Triggered sync '%s' via API", name)
+		return resp, nil
+	}
+
+	sc, err := gsa.loadSyncConfig(ctx, name)
+	if err != nil {
+		return nil, err
+	}
+
+	plan, err := gsa.engine.Plan(ctx, sc)
+	if err != nil {
+		return nil, err
+	}
+	defer plan.Close()
+
+	resp.Plan = &api.Plan{
+		Scanned:      plan.Scanned,
+		Unchanged:    plan.Unchanged,
+		Actions:      plan.Actions,
+		Symlinks:     plan.Symlinks,
+		SkippedLinks: plan.SkippedLinks,
+	}
+	return resp, nil
+}
+
+// loadSyncConfig returns the sync, reporting unknown syncs as api.ErrNotFound
+func (gsa *GoSyncAgent) loadSyncConfig(ctx context.Context, name string) (*models.SyncConfig, error) {
+	sc, err := gsa.store.GetSyncConfig(ctx, name)
+	if err != nil {
+		if errors.Is(err, store.ErrNotFound) {
+			return nil, fmt.Errorf("%w: no sync named '%s'", api.ErrNotFound, name)
+		}
+		return nil, fmt.Errorf("failed to load sync '%s': %w", name, err)
+	}
+	return sc, nil
+}
+
+// Refresh re-syncs the path within all enabled syncs containing it, without running full passes
+func (gsa *GoSyncAgent) Refresh(ctx context.Context, req api.RefreshRequest) (*api.RefreshResponse, error) {
+	gsa.mutex.RLock()
+	defer gsa.mutex.RUnlock()
+
+	syncs, err := gsa.scheduler.Refresh(ctx, req.Path)
+	if err != nil {
+		return nil, err
+	}
+
+	gsa.log.Info("Refreshed '%s' within %d syncs via API", req.Path, len(syncs))
+	return &api.RefreshResponse{
+		Path:  req.Path,
+		Syncs: syncs,
+	}, nil
+}
+
+// Explain traces the planner for the path within all syncs containing it, including disabled ones
+func (gsa *GoSyncAgent) Explain(ctx context.Context, req api.ExplainRequest) (*api.ExplainResponse, error) {
+	gsa.mutex.RLock()
+	defer gsa.mutex.RUnlock()
+
+	configs, err := gsa.store.ListSyncConfigs(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list syncs: %w", err)
+	}
+
+	resp := &api.ExplainResponse{Path: req.Path, Syncs: []engine.Explanation{}}
+	for i := range configs {
+		scope, ok := engine.ScopeOf(&configs[i], gsa.clientID, req.Path)
+		if !ok {
+			continue
+		}
+		explanation, err := gsa.engine.Explain(ctx, &configs[i], scope)
+		if err != nil {
+			return nil, err
+		}
+		resp.Syncs = append(resp.Syncs, *explanation)
+	}
+
+	if len(resp.Syncs) == 0 {
+		return nil, fmt.Errorf("%w: no sync contains '%s'", api.ErrNotFound, req.Path)
+	}
+	return resp, nil
+}
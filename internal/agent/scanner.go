@@ -0,0 +1,61 @@
+package agent
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/mwantia/gosync/pkg/db/store"
+	"github.com/mwantia/gosync/pkg/engine"
+)
+
+// runScans periodically scans the backends of all enabled syncs and records new or changed objects.
+// Scans interrupted by a shutdown continue after the last completed prefix on the next run.
+func (gsa *GoSyncAgent) runScans(ctx context.Context, ms store.MetadataStore, eng *engine.Engine) error {
+	cfg := gsa.cfg.Scanner
+	interval, err := time.ParseDuration(cfg.Interval)
+	if err != nil {
+		return fmt.Errorf("invalid scanner interval '%s': %w", cfg.Interval, err)
+	}
+
+	log := gsa.log.Named("scanner")
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-ticker.C:
+		}
+
+		if gsa.inMaintenance() {
+			log.Debug("Skipping backend scans in maintenance mode")
+			continue
+		}
+
+		configs, err := ms.ListSyncConfigs(ctx)
+		if err != nil {
+			log.Error("Failed to list syncs: %v", err)
+			continue
+		}
+
+		for i := range configs {
+			sc := &configs[i]
+			if !sc.Enabled {
+				continue
+			}
+
+			result, err := eng.Scan(ctx, sc)
+			if ctx.Err() != nil {
+				return nil
+			}
+			if err != nil {
+				log.Error("Failed to scan sync '%s': %v", sc.Name, err)
+				continue
+			}
+			log.Info("Scanned %d objects of sync '%s' in %s, recorded %d new or changed objects", result.Objects, sc.Name,
+				result.FinishedAt.Sub(result.StartedAt).Round(time.Millisecond), result.Recorded)
+		}
+	}
+}
@@ -0,0 +1,638 @@
+package agent
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/rand/v2"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/mwantia/gosync/internal/api"
+	"github.com/mwantia/gosync/pkg/db/models"
+	"github.com/mwantia/gosync/pkg/db/store"
+	"github.com/mwantia/gosync/pkg/engine"
+	"github.com/mwantia/gosync/pkg/limits"
+	"github.com/mwantia/gosync/pkg/log"
+	"github.com/mwantia/gosync/pkg/schedule"
+	"github.com/mwantia/gosync/pkg/webhook"
+)
+
+// schedulerTick defines how often sync configurations are reloaded and checked for due passes
+const schedulerTick = 30 * time.Second
+
+// scheduler runs sync passes based on the interval or cron schedule of each SyncConfig
+type scheduler struct {
+	mutex sync.Mutex
+	wait  sync.WaitGroup
+
+	store       store.MetadataStore
+	engine      *engine.Engine
+	limiter     *limits.Limiter
+	webhooks    *webhook.Dispatcher
+	snapshots   *snapshotter // nil if snapshots are disabled
+	log         log.LoggerService
+	clientID    string
+	concurrency int
+	blackout    []schedule.Window
+
+	syncs   map[uint]*scheduledSync
+	running int
+	wake    chan struct{}
+}
+
+type scheduledSync struct {
+	config   models.SyncConfig
+	cron     *schedule.Cron
+	blackout []schedule.Window
+	next     time.Time
+	running  bool
+	last     *api.RunResult
+	// polling is the interval learned by adaptive polling, the configured interval is used if it is zero
+	polling engine.Polling
+}
+
+func (gsa *GoSyncAgent) newScheduler(ms store.MetadataStore, eng *engine.Engine, limiter *limits.Limiter, webhooks *webhook.Dispatcher, clientID string) (*scheduler, error) {
+	blackout, err := schedule.ParseWindows(gsa.cfg.Scheduler.Blackout)
+	if err != nil {
+		return nil, fmt.Errorf("invalid scheduler blackout: %w", err)
+	}
+
+	return &scheduler{
+		store:       ms,
+		engine:      eng,
+		limiter:     limiter,
+		webhooks:    webhooks,
+		log:         gsa.log.Named("scheduler"),
+		clientID:    clientID,
+		concurrency: max(gsa.cfg.Scheduler.Concurrency, 1),
+		blackout:    blackout,
+		syncs:       make(map[uint]*scheduledSync),
+		wake:        make(chan struct{}, 1),
+	}, nil
+}
+
+// run runs the scheduler until the context is cancelled and all passes have finished
+func (s *scheduler) run(ctx context.Context) error {
+	defer s.wait.Wait()
+
+	ticker := time.NewTicker(schedulerTick)
+	defer ticker.Stop()
+
+	if err := s.reload(ctx); err != nil {
+		s.log.Error("Failed to reload sync configurations: %v", err)
+	}
+	s.resumeInterrupted(ctx)
+
+	for {
+		if err := s.reload(ctx); err != nil {
+			s.log.Error("Failed to reload sync configurations: %v", err)
+		}
+		s.dispatch(ctx, time.Now())
+
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-ticker.C:
+		case <-s.wake:
+		}
+	}
+}
+
+// Trigger schedules a pass of the enabled sync to be started right away
+func (s *scheduler) Trigger(ctx context.Context, name string) error {
+	// Pick up configurations created or enabled since the last tick
+	if err := s.reload(ctx); err != nil {
+		return fmt.Errorf("failed to reload sync configurations: %w", err)
+	}
+
+	if s.engine.ReadOnly() {
+		return fmt.Errorf("%w: agent is in maintenance mode", api.ErrConflict)
+	}
+	if s.engine.Draining() {
+		return fmt.Errorf("%w: agent is shutting down", api.ErrConflict)
+	}
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	for _, entry := range s.syncs {
+		if entry.config.Name != name {
+			continue
+		}
+		if entry.running {
+			return fmt.Errorf("%w: sync '%s' is already running", api.ErrConflict, name)
+		}
+
+		entry.next = time.Now()
+		select {
+		case s.wake <- struct{}{}:
+		default:
+		}
+		return nil
+	}
+
+	return fmt.Errorf("%w: no enabled sync named '%s'", api.ErrNotFound, name)
+}
+
+// Refresh runs a pass limited to the path for each enabled sync containing it and waits until all
+// passes have finished. Syncs that are running right now are skipped, since their pass covers the path.
+func (s *scheduler) Refresh(ctx context.Context, p string) ([]api.RefreshedSync, error) {
+	if err := s.reload(ctx); err != nil {
+		return nil, fmt.Errorf("failed to reload sync configurations: %w", err)
+	}
+
+	if s.engine.ReadOnly() {
+		return nil, fmt.Errorf("%w: agent is in maintenance mode", api.ErrConflict)
+	}
+
+	var result []api.RefreshedSync
+	var entries []*scheduledSync
+
+	s.mutex.Lock()
+	for _, entry := range s.syncs {
+		scope, ok := engine.ScopeOf(&entry.config, s.clientID, p)
+		if !ok {
+			continue
+		}
+
+		result = append(result, api.RefreshedSync{
+			Sync:  entry.config.Name,
+			Scope: scope,
+		})
+		entries = append(entries, entry)
+	}
+
+	// Running syncs keep a nil entry and are reported as skipped
+	for i, entry := range entries {
+		if entry.running {
+			entries[i] = nil
+			continue
+		}
+		entry.running = true
+		s.wait.Add(1)
+	}
+	s.mutex.Unlock()
+
+	if len(result) == 0 {
+		return nil, fmt.Errorf("%w: no enabled sync contains '%s'", api.ErrNotFound, p)
+	}
+
+	for i, entry := range entries {
+		if entry == nil {
+			result[i].Result = &api.RunResult{Error: "sync is already running"}
+			continue
+		}
+		result[i].Result = s.refresh(ctx, entry, result[i].Scope)
+	}
+
+	return result, nil
+}
+
+// refresh executes a single pass limited to the scope, keeping the schedule of the sync untouched
+func (s *scheduler) refresh(ctx context.Context, entry *scheduledSync, scope string) *api.RunResult {
+	defer s.wait.Done()
+
+	name := entry.config.Name
+	s.log.Info("Refreshing '%s' within sync '%s'", scope, name)
+
+	started := time.Now().UTC()
+	s.notify(webhook.Event{Type: webhook.EventSyncStarted, Time: started, Sync: name})
+
+	result, err := s.engine.Refresh(ctx, &entry.config, scope)
+	last := newRunResult(started, result, err)
+	s.notifyResult(name, result, last)
+
+	if err != nil {
+		s.log.Error("Failed to refresh '%s' within sync '%s': %v", scope, name, err)
+	}
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	entry.running = false
+	// The entry may have been replaced by a reload while running
+	if current, ok := s.syncs[entry.config.ID]; ok && current != entry {
+		current.running = false
+	}
+	return last
+}
+
+// reload synchronizes the scheduled syncs with the stored configurations
+func (s *scheduler) reload(ctx context.Context) error {
+	configs, err := s.store.ListSyncConfigs(ctx)
+	if err != nil {
+		return err
+	}
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	now := time.Now()
+	seen := make(map[uint]bool, len(configs))
+
+	for _, config := range configs {
+		if !config.Enabled {
+			continue
+		}
+		seen[config.ID] = true
+
+		current, ok := s.syncs[config.ID]
+		if ok && current.config.UpdatedAt.Equal(config.UpdatedAt) {
+			continue
+		}
+
+		entry, err := newScheduledSync(config)
+		if err != nil {
+			s.log.Error("Unable to schedule sync '%s': %v", config.Name, err)
+			entry = &scheduledSync{config: config}
+		} else {
+			if entry.polling, err = s.engine.Polling(ctx, &config); err != nil {
+				s.log.Warn("Unable to load the polling interval of sync '%s': %v", config.Name, err)
+			}
+			entry.next = entry.nextRun(now)
+			if entry.cron != nil && entry.next.IsZero() {
+				s.log.Warn("Schedule '%s' of sync '%s' never matches, so no pass is scheduled", config.Schedule, config.Name)
+			}
+		}
+
+		if ok {
+			entry.running = current.running
+			entry.last = current.last
+		}
+		s.syncs[config.ID] = entry
+
+		if !entry.next.IsZero() {
+			s.log.Debug("Scheduled sync '%s' for %s", config.Name, entry.next.Format(time.DateTime))
+		}
+	}
+
+	for id := range s.syncs {
+		if !seen[id] {
+			delete(s.syncs, id)
+		}
+	}
+
+	return nil
+}
+
+// resumeInterrupted schedules syncs whose last pass on this client was interrupted, e.g. by a shutdown,
+// to be started right away, so the remaining actions don't wait for their next regular run
+func (s *scheduler) resumeInterrupted(ctx context.Context) {
+	s.mutex.Lock()
+	entries := make([]*scheduledSync, 0, len(s.syncs))
+	for _, entry := range s.syncs {
+		entries = append(entries, entry)
+	}
+	s.mutex.Unlock()
+
+	for _, entry := range entries {
+		cursor, err := s.engine.Cursor(ctx, &entry.config)
+		if err != nil {
+			s.log.Warn("Unable to load the state of sync '%s': %v", entry.config.Name, err)
+			continue
+		}
+		if cursor == "" {
+			continue
+		}
+
+		s.log.Info("Resuming interrupted sync '%s' at '%s'", entry.config.Name, cursor)
+		s.mutex.Lock()
+		entry.next = time.Now()
+		s.mutex.Unlock()
+	}
+}
+
+func newScheduledSync(config models.SyncConfig) (*scheduledSync, error) {
+	entry := &scheduledSync{
+		config: config,
+	}
+
+	if config.Schedule != "" {
+		cron, err := schedule.ParseCron(config.Schedule)
+		if err != nil {
+			return nil, err
+		}
+		entry.cron = cron
+	}
+
+	blackout, err := schedule.ParseWindows(config.Blackout)
+	if err != nil {
+		return nil, fmt.Errorf("invalid blackout: %w", err)
+	}
+	entry.blackout = blackout
+
+	return entry, nil
+}
+
+// nextRun returns the next run after t including jitter, or the zero time if the sync isn't scheduled
+func (e *scheduledSync) nextRun(t time.Time) time.Time {
+	var next time.Time
+	switch {
+	case e.cron != nil:
+		next = e.cron.Next(t)
+	case e.polling.Interval > 0:
+		next = t.Add(e.polling.Interval)
+	case e.config.Interval > 0:
+		next = t.Add(time.Duration(e.config.Interval) * time.Second)
+	}
+
+	if !next.IsZero() && e.config.Jitter > 0 {
+		next = next.Add(rand.N(time.Duration(e.config.Jitter) * time.Second))
+	}
+	return next
+}
+
+// dispatch starts all due passes, postponing passes that are due within a blackout window.
+// Due passes are kept waiting while the agent is in maintenance mode or shutting down.
+func (s *scheduler) dispatch(ctx context.Context, now time.Time) {
+	if s.engine.ReadOnly() || s.engine.Draining() {
+		return
+	}
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	for _, entry := range s.syncs {
+		if entry.running || entry.next.IsZero() || now.Before(entry.next) {
+			continue
+		}
+
+		windows := append(append([]schedule.Window{}, s.blackout...), entry.blackout...)
+		if active, until := schedule.Blackout(windows, now); active {
+			s.log.Info("Postponing sync '%s' until the blackout window ends at %s", entry.config.Name, until.Format(time.DateTime))
+			entry.next = until
+			continue
+		}
+
+		if s.running >= s.concurrency {
+			// Retried with the next tick once a pass has finished
+			continue
+		}
+		if s.limiter.Shed() {
+			// Retried with the next tick, which may have freed enough memory
+			return
+		}
+
+		entry.running = true
+		s.running++
+		s.wait.Add(1)
+
+		go s.runPass(ctx, entry, schedule.NextBlackout(windows, now))
+	}
+}
+
+// Scheduled returns all enabled syncs that aren't running right now, ordered by their next run
+func (s *scheduler) Scheduled() []api.ScheduledSync {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	now := time.Now()
+	result := make([]api.ScheduledSync, 0, len(s.syncs))
+	for _, entry := range s.syncs {
+		if entry.running {
+			continue
+		}
+		result = append(result, api.ScheduledSync{
+			SyncConfigID: entry.config.ID,
+			Name:         entry.config.Name,
+			NextRun:      entry.next,
+			Waiting:      !entry.next.IsZero() && !now.Before(entry.next),
+			LastRun:      entry.last,
+			PollInterval: int(entry.polling.Interval / time.Second),
+			ChangeRate:   entry.polling.ChangeRate,
+		})
+	}
+
+	sort.Slice(result, func(i, j int) bool {
+		// Unscheduled syncs are listed last
+		if result[i].NextRun.IsZero() != result[j].NextRun.IsZero() {
+			return !result[i].NextRun.IsZero()
+		}
+		return result[i].NextRun.Before(result[j].NextRun)
+	})
+	return result
+}
+
+// Load returns the number of running passes and of enabled syncs
+func (s *scheduler) Load() (int, int) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	return s.running, len(s.syncs)
+}
+
+// Folders returns the local directories of all enabled syncs, ordered by the name of their sync
+func (s *scheduler) Folders() []api.SyncFolder {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	var result []api.SyncFolder
+	for _, entry := range s.syncs {
+		source, dest := engine.ResolvePaths(&entry.config, s.clientID)
+		// Destinations with per-file directories are opened at their static root
+		dest, _ = engine.SplitPathTemplate(dest)
+
+		for _, p := range []string{source, dest} {
+			if p != "" && engine.IsLocalPath(p) {
+				result = append(result, api.SyncFolder{Sync: entry.config.Name, Path: p})
+			}
+		}
+	}
+
+	sort.Slice(result, func(i, j int) bool {
+		return result[i].Sync < result[j].Sync
+	})
+	return result
+}
+
+// runPass executes a single pass, which is interrupted once the next blackout window starts
+func (s *scheduler) runPass(ctx context.Context, entry *scheduledSync, deadline time.Time) {
+	defer s.wait.Done()
+
+	if !deadline.IsZero() {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithDeadline(ctx, deadline)
+		defer cancel()
+	}
+
+	name := entry.config.Name
+	// The anomaly was reported when it was detected, the sync isn't run again until it is confirmed
+	if anomaly, err := s.engine.Paused(ctx, &entry.config); err == nil && anomaly != "" {
+		s.log.Warn("Sync '%s' is paused after an anomaly (%s), confirm it with 'gosync sync confirm %s'", name, anomaly, name)
+		s.finishPass(entry, nil)
+		return
+	}
+
+	s.log.Info("Starting sync '%s'", name)
+
+	started := time.Now().UTC()
+	s.notify(webhook.Event{Type: webhook.EventSyncStarted, Time: started, Sync: name})
+
+	result, err := s.engine.Run(ctx, &entry.config)
+	last := newRunResult(started, result, err)
+	s.notifyResult(name, result, last)
+	s.notifyQuotas(name, result)
+
+	var anomaly *engine.AnomalyError
+	switch {
+	case errors.As(err, &anomaly):
+		s.log.Warn("Sync '%s' was paused without applying any changes, since %s; confirm it with 'gosync sync confirm %s'", name, anomaly.Reason, name)
+		s.notify(webhook.Event{Type: webhook.EventAnomaly, Sync: name, Error: anomaly.Reason})
+		if s.snapshots != nil {
+			s.snapshots.snapshotAnomaly(ctx, &entry.config, anomaly.Reason)
+		}
+	case errors.Is(err, engine.ErrPaused):
+		s.log.Warn("Sync '%s' is paused after an anomaly, confirm it with 'gosync sync confirm %s'", name, name)
+	case errors.Is(err, engine.ErrDeadline):
+		s.log.Warn("Sync '%s' reached its deadline, the remaining actions are applied by the next pass", name)
+	case errors.Is(err, engine.ErrShutdown):
+		s.log.Warn("Sync '%s' was stopped by the shutdown, the remaining actions are applied after the restart", name)
+	case errors.Is(err, context.DeadlineExceeded):
+		s.log.Warn("Sync '%s' was interrupted by a blackout window", name)
+	case errors.Is(err, context.Canceled):
+		s.log.Warn("Sync '%s' was cancelled", name)
+	case errors.Is(err, engine.ErrReadOnly):
+		s.log.Warn("Sync '%s' was stopped by the maintenance mode", name)
+	case err != nil:
+		s.log.Error("Sync '%s' failed: %v", name, err)
+	}
+
+	if result != nil {
+		for _, actionErr := range result.Errors {
+			s.log.Warn("Sync '%s': %v", name, actionErr)
+		}
+		if result.Denied > 0 {
+			s.log.Warn("Sync '%s': skipped %d operations, since access was denied", name, result.Denied)
+		}
+		if result.Held > 0 {
+			s.log.Warn("Sync '%s': held back %d transfers, since they would exceed the quota of their backend", name, result.Held)
+		}
+		s.log.Info("Finished sync '%s' in %s: %d uploaded, %d downloaded, %d deleted, %d deferred, %d conflicts, %d errors",
+			name, result.FinishedAt.Sub(result.StartedAt).Round(time.Millisecond),
+			result.Uploaded, result.Downloaded, result.Deleted, result.Deferred, result.Conflicts, len(result.Errors))
+	}
+
+	if err == nil && result != nil {
+		s.adaptPolling(ctx, entry, result)
+	}
+
+	s.finishPass(entry, last)
+}
+
+// adaptPolling updates the learned polling interval of the sync after a complete pass
+func (s *scheduler) adaptPolling(ctx context.Context, entry *scheduledSync, result *engine.Result) {
+	polling, err := s.engine.AdaptPolling(ctx, &entry.config, result)
+	if err != nil {
+		s.log.Warn("Unable to adapt the polling interval of sync '%s': %v", entry.config.Name, err)
+		return
+	}
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if polling.Interval != entry.polling.Interval {
+		s.log.Debug("Polling sync '%s' every %s, %.0f%% of its passes found changes", entry.config.Name, polling.Interval, polling.ChangeRate*100)
+	}
+	entry.polling = polling
+	// The entry may have been replaced by a reload while running
+	if current, ok := s.syncs[entry.config.ID]; ok && current != entry && current.config.Interval == entry.config.Interval {
+		current.polling = polling
+	}
+}
+
+// finishPass releases the slot of the pass and schedules the next run of its sync.
+// The result of the last pass is kept if last is nil, e.g. for skipped passes.
+func (s *scheduler) finishPass(entry *scheduledSync, last *api.RunResult) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	s.running--
+	entry.running = false
+	if last != nil {
+		entry.last = last
+	}
+	entry.next = entry.nextRun(time.Now())
+
+	// The entry may have been replaced by a reload while running
+	if current, ok := s.syncs[entry.config.ID]; ok && current != entry {
+		current.running = false
+		if last != nil {
+			current.last = last
+		}
+	}
+}
+
+// notify sends the event to the subscribed webhooks
+func (s *scheduler) notify(event webhook.Event) {
+	event.ClientID = s.clientID
+	s.webhooks.Notify(event)
+}
+
+// notifyResult sends an event for each conflict of the pass followed by the outcome of the pass
+func (s *scheduler) notifyResult(name string, result *engine.Result, last *api.RunResult) {
+	if result != nil {
+		for _, path := range result.Conflicted {
+			s.notify(webhook.Event{Type: webhook.EventConflict, Sync: name, Path: path})
+		}
+	}
+
+	event := webhook.Event{
+		Type: webhook.EventSyncFinished,
+		Time: last.FinishedAt,
+		Sync: name,
+		Result: &webhook.Result{
+			StartedAt:  last.StartedAt,
+			FinishedAt: last.FinishedAt,
+			Uploaded:   last.Uploaded,
+			Downloaded: last.Downloaded,
+			Deleted:    last.Deleted,
+			Deferred:   last.Deferred,
+			Conflicts:  last.Conflicts,
+			Failed:     last.Failed,
+			Bytes:      last.Bytes,
+		},
+	}
+	if last.Error != "" {
+		event.Type = webhook.EventSyncFailed
+		event.Error = last.Error
+	}
+	s.notify(event)
+}
+
+// notifyQuotas sends an event for each backend that reached one of its quotas during the pass
+func (s *scheduler) notifyQuotas(name string, result *engine.Result) {
+	if result == nil {
+		return
+	}
+	for _, alert := range result.Quotas {
+		s.log.Warn("Backend '%s' reached its %s quota of %d bytes with %d bytes", alert.Backend, alert.Level, alert.Quota, alert.Bytes)
+		s.notify(webhook.Event{Type: webhook.EventQuota, Sync: name, Quota: &webhook.Quota{
+			Backend: alert.Backend,
+			Level:   alert.Level,
+			Bytes:   alert.Bytes,
+			Quota:   alert.Quota,
+		}})
+	}
+}
+
+func newRunResult(started time.Time, result *engine.Result, err error) *api.RunResult {
+	last := &api.RunResult{
+		StartedAt:  started,
+		FinishedAt: time.Now().UTC(),
+	}
+	if result != nil {
+		last.Uploaded = result.Uploaded
+		last.Downloaded = result.Downloaded
+		last.Deleted = result.Deleted
+		last.Conflicts = result.Conflicts
+		last.Deferred = result.Deferred
+		last.Failed = len(result.Errors)
+		last.Bytes = result.Bytes
+	}
+	if err != nil {
+		last.Error = err.Error()
+	}
+	return last
+}
@@ -0,0 +1,33 @@
+//go:build !windows
+
+package agent
+
+import (
+	"context"
+	"os"
+	"os/signal"
+	"syscall"
+)
+
+// runSignals handles the diagnostic signals until the context is cancelled. SIGUSR1 dumps the
+// sync state and goroutine stacks to the log and SIGUSR2 toggles debug logging, which both work
+// while the API is unresponsive.
+func (gsa *GoSyncAgent) runSignals(ctx context.Context) error {
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, syscall.SIGUSR1, syscall.SIGUSR2)
+	defer signal.Stop(signals)
+
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case sig := <-signals:
+			switch sig {
+			case syscall.SIGUSR1:
+				gsa.dumpDiagnostics()
+			case syscall.SIGUSR2:
+				gsa.toggleDebug()
+			}
+		}
+	}
+}
@@ -0,0 +1,12 @@
+//go:build windows
+
+package agent
+
+import (
+	"context"
+)
+
+// runSignals does nothing on Windows, which doesn't support SIGUSR1 and SIGUSR2
+func (gsa *GoSyncAgent) runSignals(ctx context.Context) error {
+	return nil
+}
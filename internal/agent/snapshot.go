@@ -0,0 +1,166 @@
+package agent
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	config "github.com/mwantia/gosync/internal/config/server"
+	"github.com/mwantia/gosync/pkg/backend"
+	"github.com/mwantia/gosync/pkg/db/models"
+	"github.com/mwantia/gosync/pkg/db/store"
+	"github.com/mwantia/gosync/pkg/engine"
+	"github.com/mwantia/gosync/pkg/log"
+	"github.com/mwantia/gosync/pkg/storage"
+	"github.com/mwantia/gosync/pkg/vfs"
+)
+
+// snapshotCheckInterval defines how often syncs are checked for due snapshots
+const snapshotCheckInterval = time.Hour
+
+// snapshotter creates retention-locked snapshots of the remote roots of all syncs, so that at least one
+// consistent state survives even if later passes propagate bad data
+type snapshotter struct {
+	store    store.MetadataStore
+	meter    *storage.Meter
+	engine   *engine.Engine
+	log      log.LoggerService
+	clientID string
+
+	interval   time.Duration
+	retention  time.Duration
+	compliance bool
+	keep       int
+}
+
+func newSnapshotter(cfg config.SnapshotServerConfig, ms store.MetadataStore, meter *storage.Meter, eng *engine.Engine, logger log.LoggerService, clientID string) (*snapshotter, error) {
+	interval, err := time.ParseDuration(cfg.Interval)
+	if err != nil {
+		return nil, fmt.Errorf("invalid snapshot interval '%s': %w", cfg.Interval, err)
+	}
+
+	var retention time.Duration
+	if cfg.Retention != "" {
+		if retention, err = time.ParseDuration(cfg.Retention); err != nil {
+			return nil, fmt.Errorf("invalid snapshot retention '%s': %w", cfg.Retention, err)
+		}
+	}
+
+	return &snapshotter{
+		store:      ms,
+		meter:      meter,
+		engine:     eng,
+		log:        logger,
+		clientID:   clientID,
+		interval:   interval,
+		retention:  retention,
+		compliance: cfg.Compliance,
+		keep:       max(cfg.Keep, 1),
+	}, nil
+}
+
+// run creates the scheduled snapshots of all enabled syncs until the context is cancelled
+func (s *snapshotter) run(ctx context.Context) error {
+	ticker := time.NewTicker(min(s.interval, snapshotCheckInterval))
+	defer ticker.Stop()
+
+	for {
+		s.createDue(ctx, time.Now().UTC())
+
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-ticker.C:
+		}
+	}
+}
+
+// createDue snapshots all enabled syncs whose latest snapshot is older than the interval
+func (s *snapshotter) createDue(ctx context.Context, now time.Time) {
+	if s.engine.ReadOnly() {
+		s.log.Debug("Skipping snapshots in maintenance mode")
+		return
+	}
+
+	configs, err := s.store.ListSyncConfigs(ctx)
+	if err != nil {
+		s.log.Error("Failed to list sync configurations: %v", err)
+		return
+	}
+
+	for i := range configs {
+		sc := &configs[i]
+		if !sc.Enabled {
+			continue
+		}
+		if err := s.snapshot(ctx, sc, "scheduled", now.Add(-s.interval)); err != nil {
+			s.log.Error("Failed to snapshot sync '%s': %v", sc.Name, err)
+		}
+	}
+}
+
+// snapshotAnomaly snapshots the sync right after a pass was paused, since the remote roots still hold the
+// state of the last applied pass until the anomaly is confirmed
+func (s *snapshotter) snapshotAnomaly(ctx context.Context, sc *models.SyncConfig, reason string) {
+	if err := s.snapshot(ctx, sc, "anomaly: "+reason, time.Time{}); err != nil {
+		s.log.Error("Failed to snapshot sync '%s' after anomaly: %v", sc.Name, err)
+	}
+}
+
+// snapshot creates a snapshot of each remote root of the sync, unless its latest snapshot was created after
+// the provided time, and prunes the snapshots exceeding the number to keep
+func (s *snapshotter) snapshot(ctx context.Context, sc *models.SyncConfig, reason string, after time.Time) error {
+	for _, root := range engine.RemoteRoots(sc, s.clientID) {
+		if err := s.snapshotRoot(ctx, sc, root, reason, after); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// snapshotRoot creates a snapshot of the remote root of the sync, see snapshot
+func (s *snapshotter) snapshotRoot(ctx context.Context, sc *models.SyncConfig, root vfs.Path, reason string, after time.Time) error {
+	b, err := s.store.GetBackend(ctx, root.Backend)
+	if err != nil {
+		return fmt.Errorf("failed to find backend '%s': %w", root.Backend, err)
+	}
+
+	st, err := s.meter.Open(b)
+	if err != nil {
+		return err
+	}
+	defer storage.Close(st)
+	snapshots := backend.NewSnapshots(s.store, st, b)
+
+	if !after.IsZero() {
+		existing, err := snapshots.List(ctx, sc.Name)
+		if err != nil {
+			return err
+		}
+		if len(existing) > 0 && existing[0].Created.After(after) {
+			return nil
+		}
+	}
+
+	snap, err := snapshots.Create(ctx, sc.Name, root.Key, backend.SnapshotOptions{
+		Reason:     reason,
+		Retention:  s.retention,
+		Compliance: s.compliance,
+	})
+	if err != nil {
+		return err
+	}
+	if snap.LockedUntil.IsZero() && s.retention > 0 {
+		s.log.Warn("Backend '%s' doesn't support retention locks, snapshot '%s' of sync '%s' isn't locked", b.ID, snap.Key, sc.Name)
+	}
+	s.log.Info("Created snapshot '%s' of sync '%s' with %d files", snap.Key, sc.Name, len(snap.Files))
+
+	pruned, err := snapshots.Prune(ctx, sc.Name, s.keep, time.Now().UTC())
+	if err != nil {
+		return err
+	}
+	if pruned > 0 {
+		s.log.Info("Pruned %d snapshots of sync '%s' in backend '%s'", pruned, sc.Name, b.ID)
+	}
+	return nil
+}
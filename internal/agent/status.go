@@ -0,0 +1,75 @@
+package agent
+
+import (
+	"context"
+	"time"
+
+	"github.com/mwantia/gosync/internal/api"
+)
+
+// Status returns the current status of the agent served by the API
+func (gsa *GoSyncAgent) Status(ctx context.Context) (*api.Status, error) {
+	gsa.mutex.RLock()
+	defer gsa.mutex.RUnlock()
+
+	status := &api.Status{
+		ClientID:  gsa.clientID,
+		Version:   gsa.version,
+		StartedAt: gsa.startedAt,
+		Time:      time.Now().UTC(),
+		Backends:  gsa.health.Backends(),
+		Syncs:     gsa.engine.Progress(),
+		Scheduled: gsa.scheduler.Scheduled(),
+		Errors:    gsa.engine.RecentErrors(),
+		Denied:    gsa.engine.DeniedPaths(),
+		Resources: gsa.limiter.Stats(),
+		Folders:   gsa.scheduler.Folders(),
+	}
+	if gsa.maintenance != nil {
+		maintenance := *gsa.maintenance
+		status.Maintenance = &maintenance
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, healthCheckTimeout)
+	defer cancel()
+
+	started := time.Now()
+	status.Database = newHealth(started, gsa.store.Health(ctx))
+
+	pending, err := gsa.pendingDeletions(ctx)
+	if err != nil {
+		return nil, err
+	}
+	status.Pending = pending
+
+	return status, nil
+}
+
+// pendingDeletions returns the deletions of this client waiting for the grace period of their sync
+func (gsa *GoSyncAgent) pendingDeletions(ctx context.Context) ([]api.PendingDeletion, error) {
+	pending, err := gsa.engine.PendingDeletions(ctx)
+	if err != nil || len(pending) == 0 {
+		return nil, err
+	}
+
+	configs, err := gsa.store.ListSyncConfigs(ctx)
+	if err != nil {
+		return nil, err
+	}
+	names := make(map[uint]string, len(configs))
+	for _, config := range configs {
+		names[config.ID] = config.Name
+	}
+
+	result := make([]api.PendingDeletion, 0, len(pending))
+	for _, p := range pending {
+		result = append(result, api.PendingDeletion{
+			Sync:       names[p.SyncConfigID],
+			Path:       p.Path,
+			Side:       p.Side,
+			DetectedAt: p.DetectedAt,
+			DueAt:      p.DueAt,
+		})
+	}
+	return result, nil
+}
@@ -0,0 +1,359 @@
+package agent
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"path"
+	"strings"
+	"time"
+
+	"github.com/mwantia/gosync/internal/api"
+	"github.com/mwantia/gosync/pkg/backend"
+	"github.com/mwantia/gosync/pkg/db/models"
+	"github.com/mwantia/gosync/pkg/db/store"
+	"github.com/mwantia/gosync/pkg/dedup"
+	"github.com/mwantia/gosync/pkg/engine"
+	"github.com/mwantia/gosync/pkg/filter"
+	"github.com/mwantia/gosync/pkg/vfs"
+)
+
+// Tags returns the tags of the file at the path, or of all files below it if recursive is set
+func (gsa *GoSyncAgent) Tags(ctx context.Context, p string, recursive bool) ([]api.FileTags, error) {
+	gsa.mutex.RLock()
+	defer gsa.mutex.RUnlock()
+
+	vp, err := gsa.resolveTagPath(ctx, p)
+	if err != nil {
+		return nil, err
+	}
+	files, err := gsa.tagFiles(ctx, vp, recursive)
+	if err != nil {
+		return nil, err
+	}
+
+	result := make([]api.FileTags, 0, len(files))
+	for _, file := range files {
+		tags, err := gsa.fileTags(ctx, file)
+		if err != nil {
+			return nil, err
+		}
+		result = append(result, *tags)
+	}
+	return result, nil
+}
+
+// SetTags adds, replaces and removes the tags of the file at the path, or of all files below it if recursive is set
+func (gsa *GoSyncAgent) SetTags(ctx context.Context, req api.TagRequest) (*api.TagResponse, error) {
+	for key := range req.Set {
+		if key == "" || strings.Contains(key, "=") {
+			return nil, fmt.Errorf("%w: invalid tag key '%s'", api.ErrUnsupported, key)
+		}
+	}
+
+	gsa.mutex.RLock()
+	defer gsa.mutex.RUnlock()
+
+	vp, err := gsa.resolveTagPath(ctx, req.Path)
+	if err != nil {
+		return nil, err
+	}
+	files, err := gsa.tagFiles(ctx, vp, req.Recursive)
+	if err != nil {
+		return nil, err
+	}
+
+	remove := make(map[string]bool, len(req.Remove))
+	for _, key := range req.Remove {
+		remove[key] = true
+	}
+
+	for _, file := range files {
+		existing, err := gsa.store.GetFileTags(ctx, file.ID)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read tags of '%s': %w", file.Path, err)
+		}
+
+		unchanged := make(map[string]bool)
+		for _, tag := range existing {
+			value, set := req.Set[tag.Key]
+			if set && value == tag.Value && !unchanged[tag.Key] {
+				unchanged[tag.Key] = true
+				continue
+			}
+			// Replaced values and duplicates of the same key are removed as well
+			if set || remove[tag.Key] {
+				if err := gsa.store.DeleteTag(ctx, tag.ID); err != nil {
+					return nil, fmt.Errorf("failed to remove tag '%s' of '%s': %w", tag.Key, file.Path, err)
+				}
+			}
+		}
+
+		for key, value := range req.Set {
+			if unchanged[key] {
+				continue
+			}
+			if err := gsa.store.CreateTag(ctx, &models.Tag{FileID: file.ID, Key: key, Value: value}); err != nil {
+				return nil, fmt.Errorf("failed to set tag '%s' of '%s': %w", key, file.Path, err)
+			}
+		}
+	}
+
+	gsa.log.Info("Updated tags of %d files below '%s' via API", len(files), req.Path)
+	return &api.TagResponse{
+		Path:  path.Join(vp.Backend, vp.Key),
+		Files: len(files),
+	}, nil
+}
+
+// Find returns a page of the files matching all filters of the request in the requested order. The filters are
+// applied by the metadata store, except for globs and query expressions, which are evaluated for each file it returns.
+func (gsa *GoSyncAgent) Find(ctx context.Context, req api.FindRequest) (*api.FindResponse, error) {
+	if !store.ValidFileSort(req.Sort) {
+		return nil, fmt.Errorf("%w: unsupported sort '%s', expected path, size or modified", api.ErrUnsupported, req.Sort)
+	}
+	if req.Glob != "" {
+		if _, err := path.Match(req.Glob, ""); err != nil {
+			return nil, fmt.Errorf("%w: invalid glob '%s'", api.ErrUnsupported, req.Glob)
+		}
+	}
+	var query *filter.Query
+	if req.Query != "" {
+		var err error
+		if query, err = filter.Parse(req.Query); err != nil {
+			return nil, fmt.Errorf("%w: invalid query: %v", api.ErrUnsupported, err)
+		}
+	}
+
+	gsa.mutex.RLock()
+	defer gsa.mutex.RUnlock()
+
+	ff := store.FileFilter{
+		ModifiedAfter:  req.ModifiedAfter,
+		ModifiedBefore: req.ModifiedBefore,
+		MinSize:        req.MinSize,
+		MaxSize:        req.MaxSize,
+		Hash:           req.Hash,
+		Tags:           req.Tags,
+		HasTags:        req.HasTags,
+		Sort:           req.Sort,
+		Descending:     req.Descending,
+	}
+	if req.Cursor != "" {
+		after, err := decodeFindCursor(req)
+		if err != nil {
+			return nil, err
+		}
+		ff.After = after
+	}
+
+	var backendID string
+	if req.Path != "" {
+		vp, err := gsa.resolveTagPath(ctx, req.Path)
+		if err != nil {
+			return nil, err
+		}
+		backendID = vp.Backend
+		ff.PathPrefix = vp.Key
+		// Directories are matched with a trailing slash, so siblings like photos2 aren't found below photos
+		if vp.Key != "" {
+			if _, err := gsa.store.GetFile(ctx, vp.Backend, vp.Key); err != nil {
+				ff.PathPrefix = strings.TrimSuffix(vp.Key, "/") + "/"
+			}
+		}
+	}
+
+	limit := req.Limit
+	if limit <= 0 || limit > maxFindLimit {
+		limit = maxFindLimit
+	}
+	// Files skipped by globs and queries are only known once they were read, so the offset is applied to the matches
+	offset, skip := req.Offset, 0
+	if req.Glob != "" || query != nil {
+		offset, skip = 0, req.Offset
+	}
+
+	resp := &api.FindResponse{Files: make([]api.FileTags, 0)}
+	for len(resp.Files) < limit {
+		files, err := gsa.store.ListFiles(ctx, backendID, ff, limit, offset)
+		if err != nil {
+			return nil, fmt.Errorf("failed to find files: %w", err)
+		}
+		offset = 0
+
+		for i := range files {
+			ff.After = &files[i]
+			if req.Glob != "" && !matchFindGlob(req.Glob, files[i].Path) {
+				continue
+			}
+			tags, err := gsa.fileTags(ctx, &files[i])
+			if err != nil {
+				return nil, err
+			}
+			if query != nil && !query.Match(&filter.File{
+				Backend:    files[i].BackendID,
+				Path:       files[i].Path,
+				Size:       files[i].Size,
+				ModifiedAt: files[i].ModifiedAt,
+				Tags:       tags.Tags,
+			}) {
+				continue
+			}
+			if skip > 0 {
+				skip--
+				continue
+			}
+
+			resp.Files = append(resp.Files, *tags)
+			if len(resp.Files) == limit {
+				resp.Next = encodeFindCursor(req, ff.After)
+				break
+			}
+		}
+		if len(files) < limit {
+			break
+		}
+	}
+	return resp, nil
+}
+
+// maxFindLimit is the maximum number of files returned by Find at once, further files are paged through with cursors
+const maxFindLimit = 1000
+
+// matchFindGlob matches the name of the file against globs without a slash, and its path otherwise
+func matchFindGlob(glob, p string) bool {
+	if !strings.Contains(glob, "/") {
+		ok, _ := path.Match(glob, path.Base(p))
+		return ok
+	}
+	return filter.MatchPath(glob, p)
+}
+
+// findCursor is the last file of a page returned by Find, encoded as opaque token continuing the listing behind it
+type findCursor struct {
+	Sort       string    `json:"sort,omitempty"`
+	Descending bool      `json:"desc,omitempty"`
+	Backend    string    `json:"backend"`
+	Path       string    `json:"path"`
+	Size       int64     `json:"size"`
+	ModifiedAt time.Time `json:"modified_at"`
+	ID         uint      `json:"id"`
+}
+
+func encodeFindCursor(req api.FindRequest, file *models.File) string {
+	data, _ := json.Marshal(findCursor{
+		Sort:       req.Sort,
+		Descending: req.Descending,
+		Backend:    file.BackendID,
+		Path:       file.Path,
+		Size:       file.Size,
+		ModifiedAt: file.ModifiedAt,
+		ID:         file.ID,
+	})
+	return base64.RawURLEncoding.EncodeToString(data)
+}
+
+// decodeFindCursor returns the file to continue the listing behind, which has to be ordered like the request
+func decodeFindCursor(req api.FindRequest) (*models.File, error) {
+	var cursor findCursor
+	data, err := base64.RawURLEncoding.DecodeString(req.Cursor)
+	if err == nil {
+		err = json.Unmarshal(data, &cursor)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("%w: invalid cursor", api.ErrUnsupported)
+	}
+	if cursor.Sort != req.Sort || cursor.Descending != req.Descending {
+		return nil, fmt.Errorf("%w: cursor was created for another order", api.ErrUnsupported)
+	}
+	return &models.File{
+		ID:         cursor.ID,
+		BackendID:  cursor.Backend,
+		Path:       cursor.Path,
+		Size:       cursor.Size,
+		ModifiedAt: cursor.ModifiedAt,
+	}, nil
+}
+
+// resolveTagPath returns the virtual path of p, mapping local paths to the source of the sync containing them
+func (gsa *GoSyncAgent) resolveTagPath(ctx context.Context, p string) (vfs.Path, error) {
+	if !engine.IsLocalPath(p) {
+		vp := vfs.ParsePath(p)
+		if vp.IsRoot() {
+			return vfs.Path{}, fmt.Errorf("%w: path '%s' doesn't reference a backend", api.ErrUnsupported, p)
+		}
+		if _, err := gsa.store.GetBackend(ctx, vp.Backend); err != nil {
+			return vfs.Path{}, fmt.Errorf("%w: backend '%s'", api.ErrNotFound, vp.Backend)
+		}
+		return vp, nil
+	}
+
+	configs, err := gsa.store.ListSyncConfigs(ctx)
+	if err != nil {
+		return vfs.Path{}, fmt.Errorf("failed to list syncs: %w", err)
+	}
+	for _, config := range configs {
+		rel, ok := engine.ScopeOf(&config, gsa.clientID, p)
+		if !ok {
+			continue
+		}
+		source, _ := engine.ResolvePaths(&config, gsa.clientID)
+		return vfs.ParsePath(path.Join(source, rel)), nil
+	}
+	return vfs.Path{}, fmt.Errorf("%w: no sync contains '%s'", api.ErrNotFound, p)
+}
+
+// tagFiles returns the file at the path, or all files below it if recursive is set.
+// Trashed objects and chunks aren't files and are never returned.
+func (gsa *GoSyncAgent) tagFiles(ctx context.Context, vp vfs.Path, recursive bool) ([]*models.File, error) {
+	if !recursive {
+		file, err := gsa.store.GetFile(ctx, vp.Backend, vp.Key)
+		if err != nil {
+			return nil, fmt.Errorf("%w: no file tracked at '%s/%s'", api.ErrNotFound, vp.Backend, vp.Key)
+		}
+		return []*models.File{file}, nil
+	}
+
+	b, err := gsa.store.GetBackend(ctx, vp.Backend)
+	if err != nil {
+		return nil, fmt.Errorf("%w: backend '%s'", api.ErrNotFound, vp.Backend)
+	}
+	trash := backend.NewTrash(gsa.store, nil, b)
+
+	prefix := vp.Key
+	if prefix != "" {
+		prefix = strings.TrimSuffix(prefix, "/") + "/"
+	}
+
+	var files []*models.File
+	err = gsa.store.IterateFiles(ctx, vp.Backend, prefix, func(file *models.File) error {
+		if !trash.IsTrashKey(file.Path) && !dedup.IsChunkKey(file.Path) {
+			files = append(files, file)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to list files below '%s': %w", path.Join(vp.Backend, vp.Key), err)
+	}
+	return files, nil
+}
+
+// fileTags returns the file together with its tags
+func (gsa *GoSyncAgent) fileTags(ctx context.Context, file *models.File) (*api.FileTags, error) {
+	records, err := gsa.store.GetFileTags(ctx, file.ID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read tags of '%s': %w", file.Path, err)
+	}
+
+	tags := make(map[string]string, len(records))
+	for _, tag := range records {
+		tags[tag.Key] = tag.Value
+	}
+	return &api.FileTags{
+		Path:       path.Join(file.BackendID, file.Path),
+		Size:       file.Size,
+		ModifiedAt: file.ModifiedAt,
+		Tags:       tags,
+	}, nil
+}
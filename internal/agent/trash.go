@@ -0,0 +1,64 @@
+package agent
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/mwantia/gosync/pkg/backend"
+	"github.com/mwantia/gosync/pkg/db/store"
+	"github.com/mwantia/gosync/pkg/storage"
+)
+
+// runTrashPurge periodically deletes expired trash items of all backends
+func (gsa *GoSyncAgent) runTrashPurge(ctx context.Context, ms store.MetadataStore, meter *storage.Meter) error {
+	interval, err := time.ParseDuration(gsa.cfg.Trash.PurgeInterval)
+	if err != nil {
+		return fmt.Errorf("invalid trash purge interval '%s': %w", gsa.cfg.Trash.PurgeInterval, err)
+	}
+
+	log := gsa.log.Named("trash")
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-ticker.C:
+		}
+
+		if gsa.inMaintenance() {
+			log.Debug("Skipping trash purge in maintenance mode")
+			continue
+		}
+
+		backends, err := ms.ListBackends(ctx)
+		if err != nil {
+			log.Error("Failed to list backends: %v", err)
+			continue
+		}
+
+		for i := range backends {
+			b := &backends[i]
+			if !b.TrashEnabled || b.TrashRetention <= 0 {
+				continue
+			}
+
+			st, err := meter.Open(b)
+			if err != nil {
+				log.Error("Failed to create storage for backend '%s': %v", b.ID, err)
+				continue
+			}
+
+			purged, err := backend.NewTrash(ms, st, b).PurgeExpired(ctx, time.Now().UTC())
+			storage.Close(st)
+			if err != nil {
+				log.Error("Failed to purge trash of backend '%s': %v", b.ID, err)
+			}
+			if purged > 0 {
+				log.Info("Purged %d expired trash items of backend '%s'", purged, b.ID)
+			}
+		}
+	}
+}
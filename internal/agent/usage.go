@@ -0,0 +1,75 @@
+package agent
+
+import (
+	"context"
+	"fmt"
+	"path"
+	"strings"
+
+	"github.com/mwantia/gosync/internal/api"
+)
+
+// Usage returns the storage used below the virtual or local path and by its direct subdirectories,
+// or by all backends if the path is empty
+func (gsa *GoSyncAgent) Usage(ctx context.Context, p string) (*api.UsageResponse, error) {
+	gsa.mutex.RLock()
+	defer gsa.mutex.RUnlock()
+
+	if p == "" {
+		backends, err := gsa.store.ListBackends(ctx)
+		if err != nil {
+			return nil, fmt.Errorf("failed to list backends: %w", err)
+		}
+
+		resp := &api.UsageResponse{Entries: make([]api.Usage, 0, len(backends))}
+		for _, b := range backends {
+			usage, err := gsa.store.GetStorageUsage(ctx, b.ID, "")
+			if err != nil {
+				return nil, fmt.Errorf("failed to read usage of backend '%s': %w", b.ID, err)
+			}
+			resp.Objects += usage.Objects
+			resp.Bytes += usage.Bytes
+			resp.Entries = append(resp.Entries, api.Usage{
+				Path:      b.ID,
+				Objects:   usage.Objects,
+				Bytes:     usage.Bytes,
+				QuotaSoft: b.QuotaSoft,
+				QuotaHard: b.QuotaHard,
+			})
+		}
+		return resp, nil
+	}
+
+	vp, err := gsa.resolveTagPath(ctx, p)
+	if err != nil {
+		return nil, err
+	}
+	prefix := strings.Trim(vp.Key, "/")
+
+	usage, err := gsa.store.GetStorageUsage(ctx, vp.Backend, prefix)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read usage of '%s': %w", p, err)
+	}
+	children, err := gsa.store.ListStorageUsage(ctx, vp.Backend, prefix)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list usage below '%s': %w", p, err)
+	}
+
+	resp := &api.UsageResponse{
+		Usage:   api.Usage{Path: path.Join(vp.Backend, prefix), Objects: usage.Objects, Bytes: usage.Bytes},
+		Entries: make([]api.Usage, 0, len(children)),
+	}
+	if prefix == "" {
+		if b, err := gsa.store.GetBackend(ctx, vp.Backend); err == nil {
+			resp.QuotaSoft, resp.QuotaHard = b.QuotaSoft, b.QuotaHard
+		}
+	}
+	for _, child := range children {
+		resp.Entries = append(resp.Entries, api.Usage{
+			Path:    path.Join(vp.Backend, child.Prefix),
+			Objects: child.Objects,
+			Bytes:   child.Bytes,
+		})
+	}
+	return resp, nil
+}
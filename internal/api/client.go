@@ -0,0 +1,365 @@
+package api
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/mwantia/gosync/pkg/engine"
+)
+
+// Client queries the API of a running agent
+type Client struct {
+	base  string
+	token string
+	http  *http.Client
+}
+
+// NewClient creates a new client for the agent listening on the address, authenticating with the token if set.
+// The agent is reached via HTTPS if tlsConfig isn't nil.
+func NewClient(address, token string, tlsConfig *tls.Config) *Client {
+	base := address
+	if !strings.Contains(base, "://") {
+		if tlsConfig != nil {
+			base = "https://" + base
+		} else {
+			base = "http://" + base
+		}
+	}
+
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.TLSClientConfig = tlsConfig
+
+	return &Client{
+		base:  strings.TrimSuffix(base, "/"),
+		token: token,
+		// Dry runs may scan large buckets, so requests are only bound by their context
+		http: &http.Client{Transport: transport},
+	}
+}
+
+// Status returns the current status of the agent
+func (c *Client) Status(ctx context.Context) (*Status, error) {
+	var status Status
+	if err := c.do(ctx, http.MethodGet, "/v1/status", nil, &status); err != nil {
+		return nil, err
+	}
+	return &status, nil
+}
+
+// Clients returns the presence of all clients sharing the metadata store of the agent
+func (c *Client) Clients(ctx context.Context) ([]Presence, error) {
+	var clients []Presence
+	if err := c.do(ctx, http.MethodGet, "/v1/clients", nil, &clients); err != nil {
+		return nil, err
+	}
+	return clients, nil
+}
+
+// RunSync starts a pass of the sync, or only returns its plan if req.DryRun is set
+func (c *Client) RunSync(ctx context.Context, name string, req RunRequest) (*RunResponse, error) {
+	var resp RunResponse
+	if err := c.do(ctx, http.MethodPost, "/v1/syncs/"+url.PathEscape(name)+"/run", req, &resp); err != nil {
+		return nil, err
+	}
+	return &resp, nil
+}
+
+// Refresh re-syncs a single file or directory within all affected syncs and waits until it has finished
+func (c *Client) Refresh(ctx context.Context, req RefreshRequest) (*RefreshResponse, error) {
+	var resp RefreshResponse
+	if err := c.do(ctx, http.MethodPost, "/v1/refresh", req, &resp); err != nil {
+		return nil, err
+	}
+	return &resp, nil
+}
+
+// Explain traces why a file is synced, skipped or left unchanged by each sync containing it
+func (c *Client) Explain(ctx context.Context, req ExplainRequest) (*ExplainResponse, error) {
+	var resp ExplainResponse
+	if err := c.do(ctx, http.MethodPost, "/v1/explain", req, &resp); err != nil {
+		return nil, err
+	}
+	return &resp, nil
+}
+
+// Maintenance returns the maintenance mode of the agent
+func (c *Client) Maintenance(ctx context.Context) (*Maintenance, error) {
+	var maintenance Maintenance
+	if err := c.do(ctx, http.MethodGet, "/v1/maintenance", nil, &maintenance); err != nil {
+		return nil, err
+	}
+	return &maintenance, nil
+}
+
+// SetMaintenance enables or disables the maintenance mode of the agent
+func (c *Client) SetMaintenance(ctx context.Context, req MaintenanceRequest) (*Maintenance, error) {
+	var maintenance Maintenance
+	if err := c.do(ctx, http.MethodPut, "/v1/maintenance", req, &maintenance); err != nil {
+		return nil, err
+	}
+	return &maintenance, nil
+}
+
+// Query streams the records of an object matching the expression; the caller must close the returned reader
+func (c *Client) Query(ctx context.Context, req QueryRequest) (io.ReadCloser, error) {
+	resp, err := c.send(ctx, http.MethodPost, "/v1/query", req)
+	if err != nil {
+		return nil, err
+	}
+	return resp.Body, nil
+}
+
+// Tags returns the tags of the file, or of all files below the path if recursive is set
+func (c *Client) Tags(ctx context.Context, path string, recursive bool) ([]FileTags, error) {
+	query := url.Values{"path": {path}}
+	if recursive {
+		query.Set("recursive", "true")
+	}
+
+	var files []FileTags
+	if err := c.do(ctx, http.MethodGet, "/v1/tags?"+query.Encode(), nil, &files); err != nil {
+		return nil, err
+	}
+	return files, nil
+}
+
+// SetTags adds, replaces and removes tags of one or more files
+func (c *Client) SetTags(ctx context.Context, req TagRequest) (*TagResponse, error) {
+	var resp TagResponse
+	if err := c.do(ctx, http.MethodPut, "/v1/tags", req, &resp); err != nil {
+		return nil, err
+	}
+	return &resp, nil
+}
+
+// Find returns a page of the files matching all filters of the request, continue with Next as cursor of the request
+func (c *Client) Find(ctx context.Context, req FindRequest) (*FindResponse, error) {
+	query := url.Values{}
+	for key, value := range req.Tags {
+		query.Add("tag", key+"="+value)
+	}
+	for _, key := range req.HasTags {
+		query.Add("has", key)
+	}
+	if req.Path != "" {
+		query.Set("path", req.Path)
+	}
+	if !req.ModifiedAfter.IsZero() {
+		query.Set("modified_after", req.ModifiedAfter.Format(time.RFC3339))
+	}
+	if !req.ModifiedBefore.IsZero() {
+		query.Set("modified_before", req.ModifiedBefore.Format(time.RFC3339))
+	}
+	if req.MinSize > 0 {
+		query.Set("min_size", strconv.FormatInt(req.MinSize, 10))
+	}
+	if req.MaxSize > 0 {
+		query.Set("max_size", strconv.FormatInt(req.MaxSize, 10))
+	}
+	if req.Hash != "" {
+		query.Set("hash", req.Hash)
+	}
+	if req.Limit > 0 {
+		query.Set("limit", strconv.Itoa(req.Limit))
+	}
+	if req.Offset > 0 {
+		query.Set("offset", strconv.Itoa(req.Offset))
+	}
+	if req.Glob != "" {
+		query.Set("glob", req.Glob)
+	}
+	if req.Query != "" {
+		query.Set("query", req.Query)
+	}
+	if req.Sort != "" {
+		query.Set("sort", req.Sort)
+	}
+	if req.Descending {
+		query.Set("order", "desc")
+	}
+	if req.Cursor != "" {
+		query.Set("cursor", req.Cursor)
+	}
+
+	resp, err := c.send(ctx, http.MethodGet, "/v1/files?"+query.Encode(), nil)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	page := &FindResponse{Next: resp.Header.Get(NextCursorHeader)}
+	if err := json.NewDecoder(resp.Body).Decode(&page.Files); err != nil {
+		return nil, fmt.Errorf("failed to decode agent response: %w", err)
+	}
+	return page, nil
+}
+
+// Usage returns the storage used below a virtual or local path, or by all backends if path is empty
+func (c *Client) Usage(ctx context.Context, path string) (*UsageResponse, error) {
+	query := url.Values{}
+	if path != "" {
+		query.Set("path", path)
+	}
+
+	var usage UsageResponse
+	if err := c.do(ctx, http.MethodGet, "/v1/usage?"+query.Encode(), nil, &usage); err != nil {
+		return nil, err
+	}
+	return &usage, nil
+}
+
+// History returns the operations of the transfer log matching the request, the latest first
+func (c *Client) History(ctx context.Context, req HistoryRequest) ([]Transfer, error) {
+	query := url.Values{}
+	if req.Path != "" {
+		query.Set("path", req.Path)
+	}
+	if req.Sync != "" {
+		query.Set("sync", req.Sync)
+	}
+	if req.Client != "" {
+		query.Set("client", req.Client)
+	}
+	if !req.Since.IsZero() {
+		query.Set("since", req.Since.Format(time.RFC3339))
+	}
+	if !req.Until.IsZero() {
+		query.Set("until", req.Until.Format(time.RFC3339))
+	}
+	if req.Failed {
+		query.Set("failed", "true")
+	}
+	if req.Before > 0 {
+		query.Set("before", strconv.FormatUint(uint64(req.Before), 10))
+	}
+	if req.Limit > 0 {
+		query.Set("limit", strconv.Itoa(req.Limit))
+	}
+
+	var transfers []Transfer
+	if err := c.do(ctx, http.MethodGet, "/v1/history?"+query.Encode(), nil, &transfers); err != nil {
+		return nil, err
+	}
+	return transfers, nil
+}
+
+// Queue returns the transfers waiting in the queues of all running passes
+func (c *Client) Queue(ctx context.Context) ([]engine.QueuedTransfer, error) {
+	var queue []engine.QueuedTransfer
+	if err := c.do(ctx, http.MethodGet, "/v1/queue", nil, &queue); err != nil {
+		return nil, err
+	}
+	return queue, nil
+}
+
+// PrioritizeTransfer changes the priority of a queued transfer and returns the reordered queues
+func (c *Client) PrioritizeTransfer(ctx context.Context, id uint64, req QueueRequest) ([]engine.QueuedTransfer, error) {
+	var queue []engine.QueuedTransfer
+	if err := c.do(ctx, http.MethodPut, "/v1/queue/"+strconv.FormatUint(id, 10), req, &queue); err != nil {
+		return nil, err
+	}
+	return queue, nil
+}
+
+// CancelTransfer removes a transfer from the queue of its pass and returns the remaining queues
+func (c *Client) CancelTransfer(ctx context.Context, id uint64) ([]engine.QueuedTransfer, error) {
+	var queue []engine.QueuedTransfer
+	if err := c.do(ctx, http.MethodDelete, "/v1/queue/"+strconv.FormatUint(id, 10), nil, &queue); err != nil {
+		return nil, err
+	}
+	return queue, nil
+}
+
+// CancelTransfers removes queued transfers and aborts in-flight transfers, returning the cancelled transfers
+func (c *Client) CancelTransfers(ctx context.Context, req CancelRequest) ([]engine.CancelledTransfer, error) {
+	var cancelled []engine.CancelledTransfer
+	if err := c.do(ctx, http.MethodPost, "/v1/transfers/cancel", req, &cancelled); err != nil {
+		return nil, err
+	}
+	return cancelled, nil
+}
+
+func (c *Client) do(ctx context.Context, method, path string, body, result any) error {
+	resp, err := c.send(ctx, method, path, body)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if err := json.NewDecoder(resp.Body).Decode(result); err != nil {
+		return fmt.Errorf("failed to decode agent response: %w", err)
+	}
+	return nil
+}
+
+// send performs the request and returns the response if the agent accepted it.
+// Requests rejected by the rate limit of the agent are retried once it allows them again.
+func (c *Client) send(ctx context.Context, method, path string, body any) (*http.Response, error) {
+	var data []byte
+	if body != nil {
+		var err error
+		if data, err = json.Marshal(body); err != nil {
+			return nil, fmt.Errorf("failed to encode request: %w", err)
+		}
+	}
+
+	for attempt := 1; ; attempt++ {
+		var reader io.Reader
+		if data != nil {
+			reader = bytes.NewReader(data)
+		}
+		req, err := http.NewRequestWithContext(ctx, method, c.base+path, reader)
+		if err != nil {
+			return nil, fmt.Errorf("failed to create request: %w", err)
+		}
+		if reader != nil {
+			req.Header.Set("Content-Type", "application/json")
+		}
+		if c.token != "" {
+			req.Header.Set("Authorization", "Bearer "+c.token)
+		}
+
+		resp, err := c.http.Do(req)
+		if err != nil {
+			return nil, fmt.Errorf("failed to reach agent at %s: %w", c.base, err)
+		}
+
+		delay, err := strconv.Atoi(resp.Header.Get("Retry-After"))
+		if resp.StatusCode != http.StatusTooManyRequests || err != nil || attempt == maxRateLimitRetries {
+			return checkResponse(resp)
+		}
+		resp.Body.Close()
+
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-time.After(time.Duration(delay) * time.Second):
+		}
+	}
+}
+
+// maxRateLimitRetries is the number of attempts of requests rejected by the rate limit of the agent
+const maxRateLimitRetries = 5
+
+// checkResponse returns the response if the agent accepted the request, or the error it responded with
+func checkResponse(resp *http.Response) (*http.Response, error) {
+	if resp.StatusCode != http.StatusOK && resp.StatusCode != http.StatusAccepted {
+		defer resp.Body.Close()
+
+		var apiErr Error
+		if err := json.NewDecoder(resp.Body).Decode(&apiErr); err != nil || apiErr.Error == "" {
+			return nil, fmt.Errorf("agent responded with status %d", resp.StatusCode)
+		}
+		return nil, fmt.Errorf("agent responded with status %d: %s", resp.StatusCode, apiErr.Error)
+	}
+	return resp, nil
+}
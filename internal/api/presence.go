@@ -0,0 +1,51 @@
+package api
+
+import (
+	"strings"
+	"time"
+
+	"github.com/mwantia/gosync/pkg/db/models"
+)
+
+// HeartbeatInterval defines how often agents record their presence in the metadata store
+const HeartbeatInterval = 30 * time.Second
+
+// OnlineTimeout is the duration without heartbeat after which a client is considered offline
+const OnlineTimeout = 3 * HeartbeatInterval
+
+// Presence describes a client sharing the metadata store, returned by GET /v1/clients
+type Presence struct {
+	ID          string    `json:"id"`
+	Name        string    `json:"name"`
+	Online      bool      `json:"online"`
+	Version     string    `json:"version"`
+	Platform    string    `json:"platform"`
+	Address     string    `json:"address"`
+	ActiveSyncs []string  `json:"active_syncs"`
+	StartedAt   time.Time `json:"started_at"`
+	LastSeenAt  time.Time `json:"last_seen_at"`
+	// Set if the device was revoked, which keeps its agent from using the metadata store
+	RevokedAt     *time.Time `json:"revoked_at,omitempty"`
+	RevokedReason string     `json:"revoked_reason,omitempty"`
+}
+
+// NewPresence returns the presence of the client at the point in time now
+func NewPresence(client models.Client, now time.Time) Presence {
+	presence := Presence{
+		ID:            client.ID,
+		Name:          client.Name,
+		Online:        client.StoppedAt == nil && client.RevokedAt == nil && now.Sub(client.LastSeenAt) < OnlineTimeout,
+		Version:       client.Version,
+		Platform:      client.Platform,
+		Address:       client.Address,
+		ActiveSyncs:   []string{},
+		StartedAt:     client.StartedAt,
+		LastSeenAt:    client.LastSeenAt,
+		RevokedAt:     client.RevokedAt,
+		RevokedReason: client.RevokedReason,
+	}
+	if presence.Online && client.ActiveSyncs != "" {
+		presence.ActiveSyncs = strings.Split(client.ActiveSyncs, ",")
+	}
+	return presence
+}
@@ -0,0 +1,99 @@
+package api
+
+import (
+	"fmt"
+	"math"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/time/rate"
+)
+
+// NextCursorHeader carries the cursor of the next page of paginated listings
+const NextCursorHeader = "X-Next-Cursor"
+
+// rateLimiterIdle is the duration after which the limiters of callers without requests are dropped
+const rateLimiterIdle = 10 * time.Minute
+
+// rateLimiter tracks a token bucket per caller, so a single client paging through large listings
+// can't starve the others or the syncs of the agent
+type rateLimiter struct {
+	mutex   sync.Mutex
+	limit   rate.Limit
+	burst   int
+	callers map[string]*callerLimiter
+	pruned  time.Time
+}
+
+type callerLimiter struct {
+	limiter *rate.Limiter
+	seen    time.Time
+}
+
+// newRateLimiter returns nil if rps is zero, which doesn't limit any requests
+func newRateLimiter(rps float64, burst int) *rateLimiter {
+	if rps <= 0 {
+		return nil
+	}
+	return &rateLimiter{
+		limit:   rate.Limit(rps),
+		burst:   max(burst, 1),
+		callers: make(map[string]*callerLimiter),
+		pruned:  time.Now(),
+	}
+}
+
+// reserve takes a token of the caller, returning the duration to wait for the next one if none is left
+func (l *rateLimiter) reserve(caller string) (time.Duration, bool) {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	now := time.Now()
+	if now.Sub(l.pruned) > rateLimiterIdle {
+		for key, c := range l.callers {
+			if now.Sub(c.seen) > rateLimiterIdle {
+				delete(l.callers, key)
+			}
+		}
+		l.pruned = now
+	}
+
+	c, ok := l.callers[caller]
+	if !ok {
+		c = &callerLimiter{limiter: rate.NewLimiter(l.limit, l.burst)}
+		l.callers[caller] = c
+	}
+	c.seen = now
+
+	r := c.limiter.ReserveN(now, 1)
+	if delay := r.DelayFrom(now); delay > 0 {
+		r.CancelAt(now)
+		return delay, false
+	}
+	return 0, true
+}
+
+// limit rejects requests with 429 once their caller exceeds the rate limit of the server
+func (s *Server) limit(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if s.limiter == nil {
+			next(w, r)
+			return
+		}
+
+		caller, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+		if !ok || caller == "" {
+			caller, _, _ = net.SplitHostPort(r.RemoteAddr)
+		}
+		if delay, ok := s.limiter.reserve(caller); !ok {
+			w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(delay.Seconds()))))
+			s.writeError(w, http.StatusTooManyRequests, fmt.Errorf("rate limit exceeded, retry in %s", delay.Round(time.Millisecond)))
+			return
+		}
+		next(w, r)
+	}
+}
@@ -0,0 +1,670 @@
+package api
+
+import (
+	"context"
+	"crypto/tls"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/mwantia/gosync/pkg/auth"
+	"github.com/mwantia/gosync/pkg/engine"
+	"github.com/mwantia/gosync/pkg/log"
+	"github.com/mwantia/gosync/pkg/metrics"
+)
+
+// ErrNotFound is returned by providers if the requested resource doesn't exist
+var ErrNotFound = errors.New("not found")
+
+// ErrConflict is returned by providers if the request conflicts with the current state
+var ErrConflict = errors.New("conflict")
+
+// ErrUnsupported is returned by providers if the request can't be served for the resource
+var ErrUnsupported = errors.New("unsupported")
+
+// Provider supplies the data served by the API
+type Provider interface {
+	Status(ctx context.Context) (*Status, error)
+	Clients(ctx context.Context) ([]Presence, error)
+	RunSync(ctx context.Context, name string, req RunRequest) (*RunResponse, error)
+	Refresh(ctx context.Context, req RefreshRequest) (*RefreshResponse, error)
+	// Explain traces the decision of each sync containing the path without applying it
+	Explain(ctx context.Context, req ExplainRequest) (*ExplainResponse, error)
+	Maintenance(ctx context.Context) (*Maintenance, error)
+	SetMaintenance(ctx context.Context, req MaintenanceRequest) (*Maintenance, error)
+	// Query streams the records of an object matching the expression, evaluated by its backend
+	Query(ctx context.Context, req QueryRequest) (io.ReadCloser, error)
+	// Metrics returns the current value of all metrics of the agent
+	Metrics(ctx context.Context) ([]metrics.Sample, error)
+	// Tags returns the tags of the file at the path, or of all files below it if recursive is set
+	Tags(ctx context.Context, path string, recursive bool) ([]FileTags, error)
+	// SetTags adds, replaces and removes the tags of one or more files
+	SetTags(ctx context.Context, req TagRequest) (*TagResponse, error)
+	// Find returns a page of the files matching all filters of the request
+	Find(ctx context.Context, req FindRequest) (*FindResponse, error)
+	// Usage returns the storage used below a virtual or local path, or by all backends if path is empty
+	Usage(ctx context.Context, path string) (*UsageResponse, error)
+	// Activity returns the daily activity of all syncs over the last days, including today
+	Activity(ctx context.Context, days int) ([]Activity, error)
+	// Browse returns the files and directories within a directory of the virtual filesystem, or all backends
+	Browse(ctx context.Context, path string) ([]Entry, error)
+	// History returns the operations of the transfer log matching the request, the latest first
+	History(ctx context.Context, req HistoryRequest) ([]Transfer, error)
+	// Health checks the components of the agent
+	Health(ctx context.Context) (*HealthReport, error)
+	// Queue returns the transfers waiting in the queues of all running passes
+	Queue(ctx context.Context) ([]engine.QueuedTransfer, error)
+	// PrioritizeTransfer changes the priority of a queued transfer and returns the reordered queues
+	PrioritizeTransfer(ctx context.Context, id uint64, req QueueRequest) ([]engine.QueuedTransfer, error)
+	// CancelTransfer removes a transfer from the queue of its pass and returns the remaining queues
+	CancelTransfer(ctx context.Context, id uint64) ([]engine.QueuedTransfer, error)
+	// CancelTransfers removes queued transfers and aborts in-flight transfers, returning the cancelled transfers
+	CancelTransfers(ctx context.Context, req CancelRequest) ([]engine.CancelledTransfer, error)
+}
+
+// Authenticator returns the scope granted to a bearer token, or auth.ErrInvalidToken
+type Authenticator interface {
+	Authenticate(ctx context.Context, token string) (auth.Scope, error)
+}
+
+// Server serves the HTTP API of the agent
+type Server struct {
+	address   string
+	provider  Provider
+	auth      Authenticator
+	tls       *tls.Config
+	limiter   *rateLimiter
+	dashboard http.Handler
+	log       log.LoggerService
+}
+
+// NewServer creates a new API server listening on the address.
+// Requests are only authenticated if authenticator isn't nil.
+func NewServer(address string, provider Provider, authenticator Authenticator, logger log.LoggerService) *Server {
+	return &Server{
+		address:  address,
+		provider: provider,
+		auth:     authenticator,
+		log:      logger,
+	}
+}
+
+// SetRateLimit limits the requests listing files to rps requests per second of each caller with bursts of up to
+// burst requests, callers being identified by their bearer token or address. Zero rps disables the limit.
+func (s *Server) SetRateLimit(rps float64, burst int) {
+	s.limiter = newRateLimiter(rps, burst)
+}
+
+// SetDashboard serves the web dashboard below /ui/. Its assets don't contain any data, so they are served without
+// authentication, while the dashboard authenticates its requests to the API with a token entered by the user.
+func (s *Server) SetDashboard(dashboard http.Handler) {
+	s.dashboard = dashboard
+}
+
+// SetTLSConfig serves the API via HTTPS, requiring client certificates if tlsConfig.ClientAuth demands them
+func (s *Server) SetTLSConfig(tlsConfig *tls.Config) {
+	s.tls = tlsConfig
+}
+
+// Handler returns the handler serving all API routes
+func (s *Server) Handler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /v1/status", s.authorize(auth.ScopeReadOnly, s.handleStatus))
+	mux.HandleFunc("GET /v1/clients", s.authorize(auth.ScopeReadOnly, s.handleClients))
+	mux.HandleFunc("POST /v1/syncs/{name}/run", s.authorize(auth.ScopeSyncControl, s.handleRunSync))
+	mux.HandleFunc("POST /v1/refresh", s.authorize(auth.ScopeSyncControl, s.handleRefresh))
+	mux.HandleFunc("POST /v1/explain", s.authorize(auth.ScopeReadOnly, s.handleExplain))
+	mux.HandleFunc("GET /v1/maintenance", s.authorize(auth.ScopeReadOnly, s.handleMaintenance))
+	mux.HandleFunc("PUT /v1/maintenance", s.authorize(auth.ScopeAdmin, s.handleSetMaintenance))
+	mux.HandleFunc("POST /v1/query", s.authorize(auth.ScopeReadOnly, s.handleQuery))
+	mux.HandleFunc("GET /v1/tags", s.authorize(auth.ScopeReadOnly, s.limit(s.handleTags)))
+	mux.HandleFunc("PUT /v1/tags", s.authorize(auth.ScopeSyncControl, s.handleSetTags))
+	mux.HandleFunc("GET /v1/files", s.authorize(auth.ScopeReadOnly, s.limit(s.handleFind)))
+	mux.HandleFunc("GET /v1/usage", s.authorize(auth.ScopeReadOnly, s.limit(s.handleUsage)))
+	mux.HandleFunc("GET /v1/activity", s.authorize(auth.ScopeReadOnly, s.handleActivity))
+	mux.HandleFunc("GET /v1/vfs", s.authorize(auth.ScopeReadOnly, s.limit(s.handleBrowse)))
+	mux.HandleFunc("GET /v1/history", s.authorize(auth.ScopeReadOnly, s.limit(s.handleHistory)))
+	mux.HandleFunc("GET /v1/queue", s.authorize(auth.ScopeReadOnly, s.handleQueue))
+	mux.HandleFunc("PUT /v1/queue/{id}", s.authorize(auth.ScopeSyncControl, s.handlePrioritizeTransfer))
+	mux.HandleFunc("DELETE /v1/queue/{id}", s.authorize(auth.ScopeSyncControl, s.handleCancelTransfer))
+	mux.HandleFunc("POST /v1/transfers/cancel", s.authorize(auth.ScopeSyncControl, s.handleCancelTransfers))
+	mux.HandleFunc("GET /metrics", s.authorize(auth.ScopeReadOnly, s.handleMetrics))
+	// Probes of container orchestrators can't authenticate, so the health reports never contain errors
+	mux.HandleFunc("GET /healthz", s.handleProbe(func(h *HealthReport) bool { return h.Live }))
+	mux.HandleFunc("GET /readyz", s.handleProbe(func(h *HealthReport) bool { return h.Ready }))
+	if s.dashboard != nil {
+		mux.Handle("GET /ui/", http.StripPrefix("/ui", s.dashboard))
+		mux.Handle("GET /{$}", http.RedirectHandler("/ui/", http.StatusFound))
+	}
+	return mux
+}
+
+// authorize only passes requests to next if their bearer token grants the required scope
+func (s *Server) authorize(scope auth.Scope, next http.HandlerFunc) http.HandlerFunc {
+	if s.auth == nil {
+		return next
+	}
+
+	return func(w http.ResponseWriter, r *http.Request) {
+		token, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+		if !ok || token == "" {
+			w.Header().Set("WWW-Authenticate", `Bearer realm="gosync"`)
+			s.writeError(w, http.StatusUnauthorized, errors.New("missing bearer token"))
+			return
+		}
+
+		granted, err := s.auth.Authenticate(r.Context(), token)
+		if err != nil {
+			if errors.Is(err, auth.ErrInvalidToken) {
+				w.Header().Set("WWW-Authenticate", `Bearer realm="gosync", error="invalid_token"`)
+				s.writeError(w, http.StatusUnauthorized, err)
+				return
+			}
+			s.writeError(w, http.StatusInternalServerError, err)
+			return
+		}
+
+		if !granted.Allows(scope) {
+			s.writeError(w, http.StatusForbidden, fmt.Errorf("scope '%s' of the token doesn't allow this request, '%s' is required", granted, scope))
+			return
+		}
+		next(w, r)
+	}
+}
+
+// Run serves the API until the context is cancelled
+func (s *Server) Run(ctx context.Context) error {
+	listener, err := net.Listen("tcp", s.address)
+	if err != nil {
+		return fmt.Errorf("failed to listen on '%s': %w", s.address, err)
+	}
+	scheme := "http"
+	if s.tls != nil {
+		listener = tls.NewListener(listener, s.tls)
+		scheme = "https"
+	}
+
+	server := &http.Server{
+		Handler:           s.Handler(),
+		ReadHeaderTimeout: 10 * time.Second,
+	}
+
+	go func() {
+		<-ctx.Done()
+
+		shutdown, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+
+		server.Shutdown(shutdown)
+	}()
+
+	s.log.Info("Serving API on %s://%s", scheme, listener.Addr())
+	if err := server.Serve(listener); err != nil && !errors.Is(err, http.ErrServerClosed) {
+		return err
+	}
+	return nil
+}
+
+func (s *Server) handleStatus(w http.ResponseWriter, r *http.Request) {
+	status, err := s.provider.Status(r.Context())
+	if err != nil {
+		s.writeError(w, http.StatusInternalServerError, err)
+		return
+	}
+	s.writeJSON(w, http.StatusOK, status)
+}
+
+// handleProbe serves the health report, responding with 503 unless passed returns true for it
+func (s *Server) handleProbe(passed func(*HealthReport) bool) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		report, err := s.provider.Health(r.Context())
+		if err != nil {
+			s.writeError(w, http.StatusServiceUnavailable, err)
+			return
+		}
+
+		code := http.StatusOK
+		if !passed(report) {
+			code = http.StatusServiceUnavailable
+		}
+		s.writeJSON(w, code, report)
+	}
+}
+
+func (s *Server) handleMetrics(w http.ResponseWriter, r *http.Request) {
+	samples, err := s.provider.Metrics(r.Context())
+	if err != nil {
+		s.writeError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", metrics.ContentType)
+	if err := metrics.WritePrometheus(w, samples); err != nil {
+		s.log.Debug("Failed to write metrics: %v", err)
+	}
+}
+
+func (s *Server) handleClients(w http.ResponseWriter, r *http.Request) {
+	clients, err := s.provider.Clients(r.Context())
+	if err != nil {
+		s.writeError(w, http.StatusInternalServerError, err)
+		return
+	}
+	s.writeJSON(w, http.StatusOK, clients)
+}
+
+func (s *Server) handleRunSync(w http.ResponseWriter, r *http.Request) {
+	var req RunRequest
+	if r.ContentLength != 0 {
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			s.writeError(w, http.StatusBadRequest, fmt.Errorf("invalid request body: %w", err))
+			return
+		}
+	}
+
+	resp, err := s.provider.RunSync(r.Context(), r.PathValue("name"), req)
+	if err != nil {
+		s.writeError(w, errorStatus(err), err)
+		return
+	}
+
+	if req.DryRun {
+		s.writeJSON(w, http.StatusOK, resp)
+	} else {
+		s.writeJSON(w, http.StatusAccepted, resp)
+	}
+}
+
+func (s *Server) handleRefresh(w http.ResponseWriter, r *http.Request) {
+	var req RefreshRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		s.writeError(w, http.StatusBadRequest, fmt.Errorf("invalid request body: %w", err))
+		return
+	}
+	if req.Path == "" {
+		s.writeError(w, http.StatusBadRequest, errors.New("missing path"))
+		return
+	}
+
+	resp, err := s.provider.Refresh(r.Context(), req)
+	if err != nil {
+		s.writeError(w, errorStatus(err), err)
+		return
+	}
+	s.writeJSON(w, http.StatusOK, resp)
+}
+
+func (s *Server) handleExplain(w http.ResponseWriter, r *http.Request) {
+	var req ExplainRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		s.writeError(w, http.StatusBadRequest, fmt.Errorf("invalid request body: %w", err))
+		return
+	}
+	if req.Path == "" {
+		s.writeError(w, http.StatusBadRequest, errors.New("missing path"))
+		return
+	}
+
+	resp, err := s.provider.Explain(r.Context(), req)
+	if err != nil {
+		s.writeError(w, errorStatus(err), err)
+		return
+	}
+	s.writeJSON(w, http.StatusOK, resp)
+}
+
+func (s *Server) handleMaintenance(w http.ResponseWriter, r *http.Request) {
+	maintenance, err := s.provider.Maintenance(r.Context())
+	if err != nil {
+		s.writeError(w, errorStatus(err), err)
+		return
+	}
+	s.writeJSON(w, http.StatusOK, maintenance)
+}
+
+func (s *Server) handleSetMaintenance(w http.ResponseWriter, r *http.Request) {
+	var req MaintenanceRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		s.writeError(w, http.StatusBadRequest, fmt.Errorf("invalid request body: %w", err))
+		return
+	}
+
+	maintenance, err := s.provider.SetMaintenance(r.Context(), req)
+	if err != nil {
+		s.writeError(w, errorStatus(err), err)
+		return
+	}
+	s.writeJSON(w, http.StatusOK, maintenance)
+}
+
+func (s *Server) handleQueue(w http.ResponseWriter, r *http.Request) {
+	queue, err := s.provider.Queue(r.Context())
+	if err != nil {
+		s.writeError(w, errorStatus(err), err)
+		return
+	}
+	s.writeJSON(w, http.StatusOK, queue)
+}
+
+func (s *Server) handlePrioritizeTransfer(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.ParseUint(r.PathValue("id"), 10, 64)
+	if err != nil {
+		s.writeError(w, http.StatusBadRequest, fmt.Errorf("invalid transfer id: %w", err))
+		return
+	}
+
+	var req QueueRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		s.writeError(w, http.StatusBadRequest, fmt.Errorf("invalid request body: %w", err))
+		return
+	}
+
+	queue, err := s.provider.PrioritizeTransfer(r.Context(), id, req)
+	if err != nil {
+		s.writeError(w, errorStatus(err), err)
+		return
+	}
+	s.writeJSON(w, http.StatusOK, queue)
+}
+
+func (s *Server) handleCancelTransfer(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.ParseUint(r.PathValue("id"), 10, 64)
+	if err != nil {
+		s.writeError(w, http.StatusBadRequest, fmt.Errorf("invalid transfer id: %w", err))
+		return
+	}
+
+	queue, err := s.provider.CancelTransfer(r.Context(), id)
+	if err != nil {
+		s.writeError(w, errorStatus(err), err)
+		return
+	}
+	s.writeJSON(w, http.StatusOK, queue)
+}
+
+func (s *Server) handleCancelTransfers(w http.ResponseWriter, r *http.Request) {
+	var req CancelRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		s.writeError(w, http.StatusBadRequest, fmt.Errorf("invalid request body: %w", err))
+		return
+	}
+	if req.ID == 0 && req.Path == "" && req.Sync == "" {
+		s.writeError(w, http.StatusBadRequest, errors.New("missing transfer id, path or sync"))
+		return
+	}
+
+	cancelled, err := s.provider.CancelTransfers(r.Context(), req)
+	if err != nil {
+		s.writeError(w, errorStatus(err), err)
+		return
+	}
+	s.writeJSON(w, http.StatusOK, cancelled)
+}
+
+func (s *Server) handleQuery(w http.ResponseWriter, r *http.Request) {
+	var req QueryRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		s.writeError(w, http.StatusBadRequest, fmt.Errorf("invalid request body: %w", err))
+		return
+	}
+	if req.Path == "" || req.Expression == "" {
+		s.writeError(w, http.StatusBadRequest, errors.New("missing path or expression"))
+		return
+	}
+
+	reader, err := s.provider.Query(r.Context(), req)
+	if err != nil {
+		s.writeError(w, errorStatus(err), err)
+		return
+	}
+	defer reader.Close()
+
+	w.Header().Set("Content-Type", "application/octet-stream")
+	w.WriteHeader(http.StatusOK)
+
+	// Records are flushed as they arrive, so large results are streamed instead of buffered
+	if _, err := io.Copy(flushWriter{w}, reader); err != nil {
+		s.log.Debug("Failed to stream query results of '%s': %v", req.Path, err)
+	}
+}
+
+func (s *Server) handleTags(w http.ResponseWriter, r *http.Request) {
+	path := r.URL.Query().Get("path")
+	if path == "" {
+		s.writeError(w, http.StatusBadRequest, errors.New("missing path"))
+		return
+	}
+
+	files, err := s.provider.Tags(r.Context(), path, r.URL.Query().Get("recursive") == "true")
+	if err != nil {
+		s.writeError(w, errorStatus(err), err)
+		return
+	}
+	s.writeJSON(w, http.StatusOK, files)
+}
+
+func (s *Server) handleSetTags(w http.ResponseWriter, r *http.Request) {
+	var req TagRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		s.writeError(w, http.StatusBadRequest, fmt.Errorf("invalid request body: %w", err))
+		return
+	}
+	if req.Path == "" {
+		s.writeError(w, http.StatusBadRequest, errors.New("missing path"))
+		return
+	}
+	if len(req.Set) == 0 && len(req.Remove) == 0 {
+		s.writeError(w, http.StatusBadRequest, errors.New("missing tags to set or remove"))
+		return
+	}
+
+	resp, err := s.provider.SetTags(r.Context(), req)
+	if err != nil {
+		s.writeError(w, errorStatus(err), err)
+		return
+	}
+	s.writeJSON(w, http.StatusOK, resp)
+}
+
+func (s *Server) handleUsage(w http.ResponseWriter, r *http.Request) {
+	usage, err := s.provider.Usage(r.Context(), r.URL.Query().Get("path"))
+	if err != nil {
+		s.writeError(w, errorStatus(err), err)
+		return
+	}
+	s.writeJSON(w, http.StatusOK, usage)
+}
+
+func (s *Server) handleActivity(w http.ResponseWriter, r *http.Request) {
+	days := 30
+	if value := r.URL.Query().Get("days"); value != "" {
+		parsed, err := strconv.Atoi(value)
+		if err != nil || parsed < 1 || parsed > 366 {
+			s.writeError(w, http.StatusBadRequest, fmt.Errorf("invalid days '%s', expected 1 to 366", value))
+			return
+		}
+		days = parsed
+	}
+
+	activity, err := s.provider.Activity(r.Context(), days)
+	if err != nil {
+		s.writeError(w, errorStatus(err), err)
+		return
+	}
+	s.writeJSON(w, http.StatusOK, activity)
+}
+
+func (s *Server) handleBrowse(w http.ResponseWriter, r *http.Request) {
+	entries, err := s.provider.Browse(r.Context(), r.URL.Query().Get("path"))
+	if err != nil {
+		s.writeError(w, errorStatus(err), err)
+		return
+	}
+	s.writeJSON(w, http.StatusOK, entries)
+}
+
+func (s *Server) handleHistory(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	req := HistoryRequest{
+		Path:   query.Get("path"),
+		Sync:   query.Get("sync"),
+		Client: query.Get("client"),
+	}
+	if value := query.Get("failed"); value != "" {
+		failed, err := strconv.ParseBool(value)
+		if err != nil {
+			s.writeError(w, http.StatusBadRequest, fmt.Errorf("invalid failed '%s'", value))
+			return
+		}
+		req.Failed = failed
+	}
+	for name, t := range map[string]*time.Time{"since": &req.Since, "until": &req.Until} {
+		if value := query.Get(name); value != "" {
+			parsed, err := time.Parse(time.RFC3339, value)
+			if err != nil {
+				s.writeError(w, http.StatusBadRequest, fmt.Errorf("invalid %s '%s', expected RFC 3339", name, value))
+				return
+			}
+			*t = parsed
+		}
+	}
+	if value := query.Get("before"); value != "" {
+		before, err := strconv.ParseUint(value, 10, 64)
+		if err != nil {
+			s.writeError(w, http.StatusBadRequest, fmt.Errorf("invalid before '%s'", value))
+			return
+		}
+		req.Before = uint(before)
+	}
+	if value := query.Get("limit"); value != "" {
+		limit, err := strconv.Atoi(value)
+		if err != nil || limit < 0 {
+			s.writeError(w, http.StatusBadRequest, fmt.Errorf("invalid limit '%s'", value))
+			return
+		}
+		req.Limit = limit
+	}
+
+	transfers, err := s.provider.History(r.Context(), req)
+	if err != nil {
+		s.writeError(w, errorStatus(err), err)
+		return
+	}
+	s.writeJSON(w, http.StatusOK, transfers)
+}
+
+func (s *Server) handleFind(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	req := FindRequest{
+		Tags:    make(map[string]string),
+		HasTags: query["has"],
+		Path:    query.Get("path"),
+		Hash:    query.Get("hash"),
+		Glob:    query.Get("glob"),
+		Query:   query.Get("query"),
+		Sort:    query.Get("sort"),
+		Cursor:  query.Get("cursor"),
+	}
+	switch order := query.Get("order"); order {
+	case "", "asc":
+	case "desc":
+		req.Descending = true
+	default:
+		s.writeError(w, http.StatusBadRequest, fmt.Errorf("invalid order '%s', expected asc or desc", order))
+		return
+	}
+	for _, tag := range query["tag"] {
+		key, value, ok := strings.Cut(tag, "=")
+		if !ok || key == "" {
+			s.writeError(w, http.StatusBadRequest, fmt.Errorf("invalid tag '%s', expected key=value", tag))
+			return
+		}
+		req.Tags[key] = value
+	}
+
+	for name, t := range map[string]*time.Time{"modified_after": &req.ModifiedAfter, "modified_before": &req.ModifiedBefore} {
+		if value := query.Get(name); value != "" {
+			parsed, err := time.Parse(time.RFC3339, value)
+			if err != nil {
+				s.writeError(w, http.StatusBadRequest, fmt.Errorf("invalid %s '%s', expected RFC 3339", name, value))
+				return
+			}
+			*t = parsed
+		}
+	}
+	for name, n := range map[string]*int64{"min_size": &req.MinSize, "max_size": &req.MaxSize} {
+		if value := query.Get(name); value != "" {
+			parsed, err := strconv.ParseInt(value, 10, 64)
+			if err != nil || parsed < 0 {
+				s.writeError(w, http.StatusBadRequest, fmt.Errorf("invalid %s '%s'", name, value))
+				return
+			}
+			*n = parsed
+		}
+	}
+	for name, n := range map[string]*int{"limit": &req.Limit, "offset": &req.Offset} {
+		if value := query.Get(name); value != "" {
+			parsed, err := strconv.Atoi(value)
+			if err != nil || parsed < 0 {
+				s.writeError(w, http.StatusBadRequest, fmt.Errorf("invalid %s '%s'", name, value))
+				return
+			}
+			*n = parsed
+		}
+	}
+
+	resp, err := s.provider.Find(r.Context(), req)
+	if err != nil {
+		s.writeError(w, errorStatus(err), err)
+		return
+	}
+	if resp.Next != "" {
+		w.Header().Set(NextCursorHeader, resp.Next)
+	}
+	s.writeJSON(w, http.StatusOK, resp.Files)
+}
+
+func (s *Server) writeJSON(w http.ResponseWriter, code int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+
+	if err := json.NewEncoder(w).Encode(v); err != nil {
+		s.log.Debug("Failed to write API response: %v", err)
+	}
+}
+
+func (s *Server) writeError(w http.ResponseWriter, code int, err error) {
+	s.writeJSON(w, code, Error{Error: err.Error()})
+}
+
+func errorStatus(err error) int {
+	switch {
+	case errors.Is(err, ErrNotFound):
+		return http.StatusNotFound
+	case errors.Is(err, ErrConflict):
+		return http.StatusConflict
+	case errors.Is(err, ErrUnsupported):
+		return http.StatusBadRequest
+	default:
+		return http.StatusInternalServerError
+	}
+}
+
+// flushWriter flushes the response after each write
+type flushWriter struct {
+	w http.ResponseWriter
+}
+
+func (f flushWriter) Write(p []byte) (int, error) {
+	n, err := f.w.Write(p)
+	if flusher, ok := f.w.(http.Flusher); ok {
+		flusher.Flush()
+	}
+	return n, err
+}
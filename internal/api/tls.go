@@ -0,0 +1,194 @@
+package api
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"math/big"
+	"net"
+	"os"
+	"path/filepath"
+	"time"
+
+	config "github.com/mwantia/gosync/internal/config/server"
+	"github.com/mwantia/gosync/pkg/log"
+)
+
+// selfSignedValidity is the lifetime of generated self-signed certificates
+const selfSignedValidity = 2 * 365 * 24 * time.Hour
+
+// ServerTLSConfig returns the TLS configuration of the API listener, or nil if TLS is disabled.
+// With self_signed, a certificate for the address is generated if none exists or it has expired.
+func ServerTLSConfig(cfg config.APITLSServerConfig, address string, logger log.LoggerService) (*tls.Config, error) {
+	if !cfg.Enabled {
+		return nil, nil
+	}
+
+	if cfg.SelfSigned {
+		generated, err := ensureSelfSigned(cfg.CertFile, cfg.KeyFile, address)
+		if err != nil {
+			return nil, err
+		}
+		if generated {
+			logger.Info("Generated self-signed certificate '%s'", cfg.CertFile)
+		}
+	}
+
+	cert, err := tls.LoadX509KeyPair(cfg.CertFile, cfg.KeyFile)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load certificate '%s': %w", cfg.CertFile, err)
+	}
+
+	tlsConfig := &tls.Config{
+		MinVersion:   tls.VersionTLS12,
+		Certificates: []tls.Certificate{cert},
+	}
+
+	if cfg.ClientCAFile != "" {
+		pool, err := loadCertPool(x509.NewCertPool(), cfg.ClientCAFile)
+		if err != nil {
+			return nil, err
+		}
+		tlsConfig.ClientCAs = pool
+		tlsConfig.ClientAuth = tls.RequireAndVerifyClientCert
+	}
+
+	return tlsConfig, nil
+}
+
+// ClientTLSConfig returns the TLS configuration used by CLI commands to connect to the agent, or nil
+// if TLS is disabled. The certificate of the agent is trusted, so self-signed certificates are accepted.
+func ClientTLSConfig(cfg config.APITLSServerConfig) (*tls.Config, error) {
+	if !cfg.Enabled {
+		return nil, nil
+	}
+
+	pool, err := x509.SystemCertPool()
+	if err != nil {
+		pool = x509.NewCertPool()
+	}
+	// The certificate may only be readable by the agent, in which case ca_file must be configured
+	if _, err := os.Stat(cfg.CertFile); err == nil {
+		if pool, err = loadCertPool(pool, cfg.CertFile); err != nil {
+			return nil, err
+		}
+	}
+	if cfg.CAFile != "" {
+		if pool, err = loadCertPool(pool, cfg.CAFile); err != nil {
+			return nil, err
+		}
+	}
+
+	tlsConfig := &tls.Config{
+		MinVersion: tls.VersionTLS12,
+		RootCAs:    pool,
+	}
+
+	if cfg.ClientCertFile != "" {
+		cert, err := tls.LoadX509KeyPair(cfg.ClientCertFile, cfg.ClientKeyFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to load client certificate '%s': %w", cfg.ClientCertFile, err)
+		}
+		tlsConfig.Certificates = []tls.Certificate{cert}
+	}
+
+	return tlsConfig, nil
+}
+
+func loadCertPool(pool *x509.CertPool, file string) (*x509.CertPool, error) {
+	data, err := os.ReadFile(file)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read certificates '%s': %w", file, err)
+	}
+	if !pool.AppendCertsFromPEM(data) {
+		return nil, fmt.Errorf("no certificates found in '%s'", file)
+	}
+	return pool, nil
+}
+
+// ensureSelfSigned generates a self-signed certificate unless a valid one already exists
+func ensureSelfSigned(certFile, keyFile, address string) (bool, error) {
+	if cert, err := tls.LoadX509KeyPair(certFile, keyFile); err == nil {
+		leaf, err := x509.ParseCertificate(cert.Certificate[0])
+		if err == nil && time.Now().Before(leaf.NotAfter) {
+			return false, nil
+		}
+	} else if !errors.Is(err, os.ErrNotExist) {
+		return false, fmt.Errorf("failed to load certificate '%s': %w", certFile, err)
+	}
+
+	if err := GenerateSelfSigned(certFile, keyFile, address); err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+// GenerateSelfSigned writes a self-signed certificate valid for the host of the address,
+// the hostname of the machine and the loopback interfaces
+func GenerateSelfSigned(certFile, keyFile, address string) error {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return fmt.Errorf("failed to generate key: %w", err)
+	}
+
+	serial, err := rand.Int(rand.Reader, new(big.Int).Lsh(big.NewInt(1), 128))
+	if err != nil {
+		return fmt.Errorf("failed to generate serial number: %w", err)
+	}
+
+	now := time.Now()
+	template := &x509.Certificate{
+		SerialNumber:          serial,
+		Subject:               pkix.Name{CommonName: "gosync agent"},
+		NotBefore:             now.Add(-time.Hour),
+		NotAfter:              now.Add(selfSignedValidity),
+		KeyUsage:              x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+		ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+		DNSNames:              []string{"localhost"},
+		IPAddresses:           []net.IP{net.IPv4(127, 0, 0, 1), net.IPv6loopback},
+	}
+	if hostname, err := os.Hostname(); err == nil && hostname != "localhost" {
+		template.DNSNames = append(template.DNSNames, hostname)
+	}
+	if host, _, err := net.SplitHostPort(address); err == nil && host != "" && host != "localhost" {
+		if ip := net.ParseIP(host); ip == nil {
+			template.DNSNames = append(template.DNSNames, host)
+		} else if !ip.IsUnspecified() && !ip.IsLoopback() {
+			template.IPAddresses = append(template.IPAddresses, ip)
+		}
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		return fmt.Errorf("failed to create certificate: %w", err)
+	}
+	keyDER, err := x509.MarshalPKCS8PrivateKey(key)
+	if err != nil {
+		return fmt.Errorf("failed to encode key: %w", err)
+	}
+
+	if err := writePEM(keyFile, "PRIVATE KEY", keyDER, 0600); err != nil {
+		return err
+	}
+	return writePEM(certFile, "CERTIFICATE", der, 0644)
+}
+
+func writePEM(file, blockType string, der []byte, perm os.FileMode) error {
+	if err := os.MkdirAll(filepath.Dir(file), 0755); err != nil {
+		return fmt.Errorf("failed to create directory of '%s': %w", file, err)
+	}
+
+	data := pem.EncodeToMemory(&pem.Block{Type: blockType, Bytes: der})
+	if err := os.WriteFile(file, data, perm); err != nil {
+		return fmt.Errorf("failed to write '%s': %w", file, err)
+	}
+	return nil
+}
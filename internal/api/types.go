@@ -0,0 +1,361 @@
+package api
+
+import (
+	"time"
+
+	"github.com/mwantia/gosync/pkg/engine"
+	"github.com/mwantia/gosync/pkg/limits"
+	"github.com/mwantia/gosync/pkg/storage"
+)
+
+// Status is the summary of a running agent returned by GET /v1/status
+type Status struct {
+	ClientID  string    `json:"client_id"`
+	Version   string    `json:"version"`
+	StartedAt time.Time `json:"started_at"`
+	Time      time.Time `json:"time"`
+
+	Database  Health               `json:"database"`
+	Backends  []BackendHealth      `json:"backends"`
+	Syncs     []engine.Progress    `json:"syncs"`
+	Scheduled []ScheduledSync      `json:"scheduled"`
+	Errors    []engine.RecentError `json:"errors"`
+	Denied    []engine.DeniedPath  `json:"access_denied"`
+	Pending   []PendingDeletion    `json:"pending_deletions"`
+	Folders   []SyncFolder         `json:"folders"`
+	Resources limits.Stats         `json:"resources"`
+	// Maintenance is set while the agent is in maintenance mode
+	Maintenance *Maintenance `json:"maintenance,omitempty"`
+}
+
+// Maintenance describes the maintenance mode of the agent, in which no changes are applied
+type Maintenance struct {
+	Enabled bool      `json:"enabled"`
+	Reason  string    `json:"reason,omitempty"`
+	Since   time.Time `json:"since,omitempty"`
+}
+
+// MaintenanceRequest is the body of PUT /v1/maintenance
+type MaintenanceRequest struct {
+	Enabled bool   `json:"enabled"`
+	Reason  string `json:"reason"`
+}
+
+// QueueRequest is the body of PUT /v1/queue/{id}
+type QueueRequest struct {
+	// Priority of the transfer, higher priorities are started first
+	Priority int `json:"priority"`
+}
+
+// CancelRequest is the body of POST /v1/transfers/cancel, selecting transfers either by ID or by path
+type CancelRequest struct {
+	ID   uint64 `json:"id,omitempty"`
+	Path string `json:"path,omitempty"`
+	// Sync limits the transfers selected by path to a single sync
+	Sync string `json:"sync,omitempty"`
+	// Requeue restarts in-flight transfers later in their pass instead of dropping them
+	Requeue bool `json:"requeue,omitempty"`
+}
+
+// PendingDeletion is a deletion waiting for the grace period of its sync
+type PendingDeletion struct {
+	Sync       string    `json:"sync"`
+	Path       string    `json:"path"`
+	Side       string    `json:"side"`
+	DetectedAt time.Time `json:"detected_at"`
+	DueAt      time.Time `json:"due_at"`
+}
+
+// SyncFolder is the local directory of an enabled sync on the client of the agent
+type SyncFolder struct {
+	Sync string `json:"sync"`
+	Path string `json:"path"`
+}
+
+// Health is the result of a single health check
+type Health struct {
+	Healthy   bool          `json:"healthy"`
+	Error     string        `json:"error,omitempty"`
+	Latency   time.Duration `json:"latency"`
+	CheckedAt time.Time     `json:"checked_at"`
+}
+
+// BackendHealth is the last health check result of a backend
+type BackendHealth struct {
+	ID   string `json:"id"`
+	Name string `json:"name"`
+	Health
+}
+
+// Component states reported by GET /healthz and GET /readyz
+const (
+	ComponentOK       = "ok"
+	ComponentDegraded = "degraded"
+	ComponentDown     = "down"
+)
+
+// HealthReport is returned by GET /healthz and GET /readyz for container orchestration probes
+type HealthReport struct {
+	// Status is the worst state of all components
+	Status string `json:"status"`
+	// Live is unset if a background service the agent can't work without has failed
+	Live bool `json:"live"`
+	// Ready is unset until the agent is live and its metadata store is reachable
+	Ready      bool        `json:"ready"`
+	Time       time.Time   `json:"time"`
+	Components []Component `json:"components"`
+}
+
+// Component is the state of a single component of the agent.
+// The health endpoints aren't authenticated, so errors are only reported by GET /v1/status.
+type Component struct {
+	Name      string        `json:"name"`
+	Status    string        `json:"status"`
+	Detail    string        `json:"detail,omitempty"`
+	Latency   time.Duration `json:"latency,omitempty"`
+	CheckedAt time.Time     `json:"checked_at,omitempty"`
+}
+
+// ScheduledSync describes an enabled sync that isn't running right now
+type ScheduledSync struct {
+	SyncConfigID uint      `json:"sync_config_id"`
+	Name         string    `json:"name"`
+	NextRun      time.Time `json:"next_run"`
+	// Waiting is set if the sync is due but all scheduler slots are in use
+	Waiting bool `json:"waiting"`
+	// LastRun summarizes the last pass run by this agent, if any
+	LastRun *RunResult `json:"last_run,omitempty"`
+	// PollInterval is the interval in seconds learned by adaptive polling, 0 if the configured interval is used
+	PollInterval int     `json:"poll_interval,omitempty"`
+	ChangeRate   float64 `json:"change_rate,omitempty"`
+}
+
+// RunResult summarizes a finished sync pass
+type RunResult struct {
+	StartedAt  time.Time `json:"started_at"`
+	FinishedAt time.Time `json:"finished_at"`
+	Uploaded   int       `json:"uploaded"`
+	Downloaded int       `json:"downloaded"`
+	Deleted    int       `json:"deleted"`
+	Conflicts  int       `json:"conflicts"`
+	Deferred   int       `json:"deferred"`
+	Failed     int       `json:"failed"`
+	Bytes      int64     `json:"bytes"`
+	Error      string    `json:"error,omitempty"`
+}
+
+// RunRequest is the body of POST /v1/syncs/{name}/run
+type RunRequest struct {
+	// DryRun only computes and returns the plan without changing any data
+	DryRun bool `json:"dry_run"`
+	// Rehash reads the content of all files again in paranoid integrity mode instead of using cached hashes
+	Rehash bool `json:"rehash"`
+}
+
+// RunResponse is returned by POST /v1/syncs/{name}/run
+type RunResponse struct {
+	Sync   string `json:"sync"`
+	DryRun bool   `json:"dry_run"`
+	// Time of the agent at which the pass was requested
+	Time time.Time `json:"time"`
+	// Plan is only set for dry runs
+	Plan *Plan `json:"plan,omitempty"`
+}
+
+// RefreshRequest is the body of POST /v1/refresh
+type RefreshRequest struct {
+	// Path is a virtual or local path of a file or directory within one or more syncs
+	Path string `json:"path"`
+}
+
+// RefreshResponse is returned by POST /v1/refresh once all affected syncs have been refreshed
+type RefreshResponse struct {
+	Path  string          `json:"path"`
+	Syncs []RefreshedSync `json:"syncs"`
+}
+
+// RefreshedSync summarizes the refresh of a path within a single sync
+type RefreshedSync struct {
+	Sync string `json:"sync"`
+	// Scope is the refreshed path relative to the sync
+	Scope  string     `json:"scope"`
+	Result *RunResult `json:"result"`
+}
+
+// ExplainRequest is the body of POST /v1/explain
+type ExplainRequest struct {
+	// Path is a virtual or local path of a file within one or more syncs
+	Path string `json:"path"`
+}
+
+// ExplainResponse is returned by POST /v1/explain with the explanation of each sync containing the path
+type ExplainResponse struct {
+	Path  string               `json:"path"`
+	Syncs []engine.Explanation `json:"syncs"`
+}
+
+// QueryRequest is the body of POST /v1/query
+type QueryRequest struct {
+	// Path is the virtual path of the queried object, e.g. "selfhosted/logs/2024.csv.gz"
+	Path string `json:"path"`
+	// Expression is the SQL expression evaluated by the backend
+	Expression string `json:"expression"`
+	// Format (csv, json, parquet) and Compression (none, gzip, bzip2) are detected from the extension if empty
+	Format       string `json:"format,omitempty"`
+	Compression  string `json:"compression,omitempty"`
+	CSVHeader    string `json:"csv_header,omitempty"`
+	CSVDelimiter string `json:"csv_delimiter,omitempty"`
+	JSONLines    bool   `json:"json_lines,omitempty"`
+	// Output format of the streamed records (csv or json)
+	Output string `json:"output,omitempty"`
+}
+
+// FileTags are the tags of a file tracked in the metadata store
+type FileTags struct {
+	// Path is the virtual path of the file, e.g. "selfhosted/photos/beach.jpg"
+	Path       string            `json:"path"`
+	Size       int64             `json:"size"`
+	ModifiedAt time.Time         `json:"modified_at"`
+	Tags       map[string]string `json:"tags"`
+}
+
+// TagRequest is the body of PUT /v1/tags
+type TagRequest struct {
+	// Path is a virtual path like backend/path or a local path within a sync
+	Path string `json:"path"`
+	// Recursive applies the changes to all files below the path instead of a single file
+	Recursive bool `json:"recursive"`
+	// Set adds the tags or replaces the values of existing tags with the same keys
+	Set map[string]string `json:"set,omitempty"`
+	// Remove deletes the tags with the keys
+	Remove []string `json:"remove,omitempty"`
+}
+
+// TagResponse is returned by PUT /v1/tags
+type TagResponse struct {
+	Path  string `json:"path"`
+	Files int    `json:"files"`
+}
+
+// FindRequest selects the files returned by GET /v1/files, which have to match all of its filters
+type FindRequest struct {
+	// Tags are matched by key and value, files have to match all of them
+	Tags map[string]string `json:"tags"`
+	// HasTags are keys of tags the files have to have, regardless of their values
+	HasTags []string `json:"has_tags,omitempty"`
+	// Path limits the results to files below a virtual or local path (optional)
+	Path           string    `json:"path,omitempty"`
+	ModifiedAfter  time.Time `json:"modified_after,omitempty"`
+	ModifiedBefore time.Time `json:"modified_before,omitempty"`
+	MinSize        int64     `json:"min_size,omitempty"`
+	MaxSize        int64     `json:"max_size,omitempty"`
+	// Hash is compared with both the MD5 and SHA256 of the content
+	Hash string `json:"hash,omitempty"`
+	// Glob is matched against the names of the files, or against their paths within the backend if it contains a slash
+	Glob string `json:"glob,omitempty"`
+	// Query is a filter expression like "tag:rating>=4 AND NOT tag:archived" the files have to match
+	Query string `json:"query,omitempty"`
+	// Sort orders the files by "path" (default), "size" or "modified"
+	Sort       string `json:"sort,omitempty"`
+	Descending bool   `json:"desc,omitempty"`
+	// Limit is capped at 1000 files, Cursor continues after the last file of the previous page
+	Limit  int    `json:"limit,omitempty"`
+	Offset int    `json:"offset,omitempty"`
+	Cursor string `json:"cursor,omitempty"`
+}
+
+// FindResponse is a page of the files returned by GET /v1/files.
+// Next is sent as X-Next-Cursor header, it is empty once the last page was returned.
+type FindResponse struct {
+	Files []FileTags
+	Next  string
+}
+
+// Usage is the storage used by a backend or a directory within it
+type Usage struct {
+	// Path is the virtual path of the backend or directory, e.g. "selfhosted/photos"
+	Path    string `json:"path"`
+	Objects int64  `json:"objects"`
+	Bytes   int64  `json:"bytes"`
+	// QuotaSoft and QuotaHard are only set for backends with quotas
+	QuotaSoft int64 `json:"quota_soft,omitempty"`
+	QuotaHard int64 `json:"quota_hard,omitempty"`
+}
+
+// UsageResponse is returned by GET /v1/usage. Without a path, Entries contains all backends and the usage their total;
+// otherwise the usage of the path and its direct subdirectories.
+type UsageResponse struct {
+	Usage
+	Entries []Usage `json:"entries"`
+}
+
+// Activity is the activity of a sync on a single day summed over all clients, returned by GET /v1/activity
+type Activity struct {
+	// Day is the calendar day in UTC, e.g. "2024-05-01"
+	Day       string `json:"day"`
+	Sync      string `json:"sync"`
+	Passes    int64  `json:"passes"`
+	Added     int64  `json:"added"`
+	Changed   int64  `json:"changed"`
+	Deleted   int64  `json:"deleted"`
+	Conflicts int64  `json:"conflicts"`
+	Errors    int64  `json:"errors"`
+	Bytes     int64  `json:"bytes"`
+}
+
+// Entry is a file or directory of the virtual filesystem returned by GET /v1/vfs.
+// Directories have the total size and latest modification of their contents.
+type Entry struct {
+	Name       string    `json:"name"`
+	Dir        bool      `json:"dir"`
+	Size       int64     `json:"size"`
+	ModifiedAt time.Time `json:"modified_at,omitempty"`
+	LockedBy   string    `json:"locked_by,omitempty"`
+}
+
+// HistoryRequest filters the transfer log returned by GET /v1/history, zero values don't restrict the result
+type HistoryRequest struct {
+	// Path is a virtual or local path matching the operations on the file or the files below the directory
+	Path string `json:"path,omitempty"`
+	Sync string `json:"sync,omitempty"`
+	// Client only returns the operations applied by the client
+	Client string    `json:"client,omitempty"`
+	Since  time.Time `json:"since,omitempty"`
+	Until  time.Time `json:"until,omitempty"`
+	Failed bool      `json:"failed,omitempty"`
+	// Before continues the transfer log behind the entry with this ID, e.g. the last entry of the previous page
+	Before uint `json:"before,omitempty"`
+	Limit  int  `json:"limit,omitempty"`
+}
+
+// Transfer is a single operation of the transfer log, the latest operations are returned first
+type Transfer struct {
+	ID   uint   `json:"id"`
+	Sync string `json:"sync"`
+	// Client is the client that applied the operation
+	Client string `json:"client"`
+	// Operation is "upload", "download", "delete-source", "delete-dest" or "conflict"
+	Operation   string    `json:"operation"`
+	Source      string    `json:"source"`
+	Destination string    `json:"destination"`
+	Bytes       int64     `json:"bytes"`
+	Result      string    `json:"result"`
+	Error       string    `json:"error,omitempty"`
+	StartedAt   time.Time `json:"started_at"`
+	FinishedAt  time.Time `json:"finished_at"`
+}
+
+// Plan contains the actions a sync pass would apply
+type Plan struct {
+	Scanned   int             `json:"scanned"`
+	Unchanged int             `json:"unchanged"`
+	Actions   []engine.Action `json:"actions"`
+	// Symlinks is the policy for symbolic links within local directories, SkippedLinks the links it didn't sync
+	Symlinks     string                `json:"symlinks"`
+	SkippedLinks []storage.SkippedLink `json:"skipped_links,omitempty"`
+}
+
+// Error is the body of all failed API responses
+type Error struct {
+	Error string `json:"error"`
+}
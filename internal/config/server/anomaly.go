@@ -0,0 +1,13 @@
+package server
+
+// AnomalyServerConfig holds the heuristics pausing syncs whose passes look like an accidental mass change,
+// e.g. a wiped or encrypted local folder, until the pass is confirmed with 'gosync sync confirm'
+type AnomalyServerConfig struct {
+	Enabled bool `mapstructure:"enabled" yaml:"enabled"`
+	// Share of the synced files a pass may modify or delete in the source (0.5 = 50%)
+	MaxChangeRatio float64 `mapstructure:"max_change_ratio" yaml:"max_change_ratio"`
+	// Passes modifying or deleting fewer files are never considered anomalous
+	MinFiles int `mapstructure:"min_files" yaml:"min_files"`
+	// Compare the entropy of rewritten files with the source to detect encryption
+	Entropy bool `mapstructure:"entropy" yaml:"entropy"`
+}
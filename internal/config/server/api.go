@@ -0,0 +1,37 @@
+package server
+
+// APIServerConfig holds configuration for the agent's HTTP API
+type APIServerConfig struct {
+	// Address the API listens on, also used by CLI commands to reach the agent
+	Address string `mapstructure:"address" yaml:"address"`
+	// Require bearer tokens created with "gosync token create" for all requests
+	Auth bool `mapstructure:"auth" yaml:"auth"`
+	// Token used by CLI commands to authenticate, may reference a secret (overridden by GOSYNC_TOKEN)
+	Token string `mapstructure:"token" yaml:"token"`
+	// TLS of the API listener, also used by CLI commands to connect to the agent
+	TLS APITLSServerConfig `mapstructure:"tls" yaml:"tls"`
+	// Requests per second each caller may send to endpoints listing files, with bursts of up to rate_burst (0 = unlimited)
+	RateLimit float64 `mapstructure:"rate_limit" yaml:"rate_limit"`
+	RateBurst int     `mapstructure:"rate_burst" yaml:"rate_burst"`
+	// Serve the web dashboard below /ui/ of the API address
+	Dashboard bool `mapstructure:"dashboard" yaml:"dashboard"`
+}
+
+// APITLSServerConfig holds the TLS configuration of the agent's HTTP API
+type APITLSServerConfig struct {
+	// Serve the API via HTTPS
+	Enabled bool `mapstructure:"enabled" yaml:"enabled"`
+	// Certificate and private key of the API listener (PEM)
+	CertFile string `mapstructure:"cert_file" yaml:"cert_file"`
+	KeyFile  string `mapstructure:"key_file"  yaml:"key_file"`
+	// Generate a self-signed certificate at cert_file and key_file if they don't exist yet
+	SelfSigned bool `mapstructure:"self_signed" yaml:"self_signed"`
+	// Only accept clients presenting a certificate signed by this CA (mutual TLS)
+	ClientCAFile string `mapstructure:"client_ca_file" yaml:"client_ca_file"`
+
+	// CA trusted by CLI commands in addition to the system roots and cert_file
+	CAFile string `mapstructure:"ca_file" yaml:"ca_file"`
+	// Certificate and private key presented by CLI commands if mutual TLS is enabled
+	ClientCertFile string `mapstructure:"client_cert_file" yaml:"client_cert_file"`
+	ClientKeyFile  string `mapstructure:"client_key_file"  yaml:"client_key_file"`
+}
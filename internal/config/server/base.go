@@ -8,9 +8,38 @@ import (
 
 type BaseServerConfig struct {
 	ShutdownTimeout string `mapstructure:"shutdown_timeout" yaml:"shutdown_timeout"`
-
-	Log      LogServerConfig      `mapstructure:"log" yaml:"log"`
-	Metadata MetadataServerConfig `mapstructure:"metadata" yaml:"metadata"`
+	// Locale of CLI and log messages, e.g. "de" (detected from LANG if empty)
+	Locale string `mapstructure:"locale" yaml:"locale"`
+	// Resource profile, "default" or "low-memory" for small devices
+	Profile string `mapstructure:"profile" yaml:"profile"`
+
+	Device    DeviceServerConfig    `mapstructure:"device" yaml:"device"`
+	Log       LogServerConfig       `mapstructure:"log" yaml:"log"`
+	API       APIServerConfig       `mapstructure:"api" yaml:"api"`
+	Metadata  MetadataServerConfig  `mapstructure:"metadata" yaml:"metadata"`
+	Trash     TrashServerConfig     `mapstructure:"trash" yaml:"trash"`
+	History   HistoryServerConfig   `mapstructure:"history" yaml:"history"`
+	Leases    LeaseServerConfig     `mapstructure:"leases" yaml:"leases"`
+	Cache     CacheServerConfig     `mapstructure:"cache" yaml:"cache"`
+	Downloads DownloadServerConfig  `mapstructure:"downloads" yaml:"downloads"`
+	Scheduler SchedulerServerConfig `mapstructure:"scheduler" yaml:"scheduler"`
+	Anomaly   AnomalyServerConfig   `mapstructure:"anomaly" yaml:"anomaly"`
+	Snapshots SnapshotServerConfig  `mapstructure:"snapshots" yaml:"snapshots"`
+	Tuning    TuningServerConfig    `mapstructure:"tuning" yaml:"tuning"`
+	Scanner   ScannerServerConfig   `mapstructure:"scanner" yaml:"scanner"`
+	Offload   OffloadServerConfig   `mapstructure:"offload" yaml:"offload"`
+	Digest    DigestServerConfig    `mapstructure:"digest" yaml:"digest"`
+	Limits    LimitsServerConfig    `mapstructure:"limits" yaml:"limits"`
+	Secrets   SecretsServerConfig   `mapstructure:"secrets" yaml:"secrets"`
+	Drills    DrillServerConfig     `mapstructure:"drills" yaml:"drills"`
+	Publish   PublishServerConfig   `mapstructure:"publish" yaml:"publish"`
+	Metrics   MetricsServerConfig   `mapstructure:"metrics" yaml:"metrics"`
+	Telemetry TelemetryServerConfig `mapstructure:"telemetry" yaml:"telemetry"`
+	Webhooks  []WebhookServerConfig `mapstructure:"webhooks" yaml:"webhooks"`
+	Indexers  []IndexerServerConfig `mapstructure:"indexers" yaml:"indexers"`
+
+	// CLI command aliases, e.g. "photos: vfs ls minio-home/photos -l"
+	Aliases map[string]string `mapstructure:"aliases" yaml:"aliases"`
 }
 
 func LoadServerConfig() (*BaseServerConfig, error) {
@@ -22,5 +51,7 @@ func LoadServerConfig() (*BaseServerConfig, error) {
 		return nil, fmt.Errorf("failed to unmarshal configuration: %w", err)
 	}
 
+	cfg.applyProfile()
+
 	return cfg, nil
 }
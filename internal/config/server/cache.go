@@ -0,0 +1,16 @@
+package server
+
+// cacheBlockSize is the size in MB of the blocks objects are cached in (storage.CacheBlockSize)
+const cacheBlockSize = 4
+
+// CacheServerConfig configures the disk cache of content read from backends, which serves repeated reads of files
+// on demand without downloading them again
+type CacheServerConfig struct {
+	Enabled bool `mapstructure:"enabled" yaml:"enabled"`
+	// Directory of the cached blocks (defaults to "gosync-cache" next to the metadata store)
+	Dir string `mapstructure:"dir" yaml:"dir"`
+	// Size in MB the cache may occupy, the least recently used blocks are evicted beyond it
+	MaxSize int `mapstructure:"max_size" yaml:"max_size"`
+	// Blocks of 4 MB fetched ahead of sequential reads (0 = disabled)
+	ReadAhead int `mapstructure:"read_ahead" yaml:"read_ahead"`
+}
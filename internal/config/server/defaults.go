@@ -5,6 +5,12 @@ import "github.com/spf13/viper"
 func GetServerDefault() BaseServerConfig {
 	return BaseServerConfig{
 		ShutdownTimeout: "10s",
+		Locale:          "",
+		Profile:         ProfileDefault,
+
+		Device: DeviceServerConfig{
+			Name: "",
+		},
 
 		Log: LogServerConfig{
 			Level:      "INFO",
@@ -19,14 +25,183 @@ func GetServerDefault() BaseServerConfig {
 				MaxAge:     16,
 				Compress:   false,
 			},
+			Outputs: []LogOutputConfig{},
+		},
+
+		API: APIServerConfig{
+			Address: "127.0.0.1:9520",
+			Auth:    false,
+			Token:   "",
+			TLS: APITLSServerConfig{
+				Enabled:        false,
+				CertFile:       DefaultTLSCertPath(),
+				KeyFile:        DefaultTLSKeyPath(),
+				SelfSigned:     false,
+				ClientCAFile:   "",
+				CAFile:         "",
+				ClientCertFile: "",
+				ClientKeyFile:  "",
+			},
+			RateLimit: 10,
+			RateBurst: 20,
+			Dashboard: true,
 		},
 
 		Metadata: MetadataServerConfig{
 			Type: "sqlite",
 			SQLite: MetadataSQLiteConfig{
-				Path: "./gosync.db",
+				Path:        DefaultSQLitePath(),
+				JournalMode: "wal",
+				BusyTimeout: 5000,
+				Synchronous: "normal",
+				CacheSize:   0,
+				Backup: MetadataBackupConfig{
+					Enabled:  false,
+					Interval: "24h",
+					Dir:      "",
+					Keep:     7,
+				},
+			},
+			Maintenance: MetadataMaintenanceConfig{
+				Enabled:    false,
+				Interval:   "24h",
+				Retention:  "2160h",
+				Vacuum:     true,
+				ChunkGrace: "24h",
+			},
+		},
+
+		Trash: TrashServerConfig{
+			PurgeInterval: "1h",
+		},
+
+		History: HistoryServerConfig{
+			Enabled:       true,
+			MaxSize:       64,
+			PruneInterval: "1h",
+		},
+
+		Leases: LeaseServerConfig{
+			Enabled: false,
+			TTL:     "5m",
+		},
+
+		Cache: CacheServerConfig{
+			Enabled:   true,
+			Dir:       DefaultCacheDir(),
+			MaxSize:   1024,
+			ReadAhead: 4,
+		},
+
+		Downloads: DownloadServerConfig{
+			Workers:   4,
+			ChunkSize: 0,
+			MinSize:   64,
+		},
+
+		Scheduler: SchedulerServerConfig{
+			Concurrency: 2,
+			Workers:     0,
+			Blackout:    "",
+			Adaptive: SchedulerAdaptiveConfig{
+				Enabled:     false,
+				MinInterval: "1m",
+				MaxInterval: "24h",
 			},
 		},
+
+		Anomaly: AnomalyServerConfig{
+			Enabled:        true,
+			MaxChangeRatio: 0.5,
+			MinFiles:       50,
+			Entropy:        true,
+		},
+
+		Snapshots: SnapshotServerConfig{
+			Enabled:    false,
+			Interval:   "24h",
+			Retention:  "168h",
+			Compliance: false,
+			Keep:       7,
+		},
+
+		Tuning: TuningServerConfig{
+			Enabled:      true,
+			MinChunkSize: 5,
+			MaxChunkSize: 256,
+		},
+
+		Scanner: ScannerServerConfig{
+			Enabled:  false,
+			Interval: "6h",
+			Workers:  4,
+			PageSize: 1000,
+		},
+
+		Offload: OffloadServerConfig{
+			Enabled: false,
+			Workers: 2,
+			Remote:  []string{},
+		},
+
+		Digest: DigestServerConfig{
+			Enabled:  false,
+			Period:   "daily",
+			Schedule: "0 8 * * *",
+			Email: DigestEmailConfig{
+				Host:     "",
+				Port:     587,
+				Username: "",
+				Password: "",
+				From:     "",
+				To:       []string{},
+			},
+		},
+
+		Limits: LimitsServerConfig{
+			MaxOpenFiles:    512,
+			MemoryWatermark: 0,
+		},
+
+		Secrets: SecretsServerConfig{
+			CacheTTL: "5m",
+			Vault: VaultSecretsConfig{
+				Address:   "",
+				Token:     "",
+				Namespace: "",
+				Timeout:   "10s",
+			},
+		},
+
+		Drills: DrillServerConfig{
+			Enabled:     false,
+			Interval:    "24h",
+			Samples:     10,
+			MaxFileSize: 256,
+			Backends:    []string{},
+		},
+
+		Publish: PublishServerConfig{
+			SigningKey: "",
+		},
+
+		Metrics: MetricsServerConfig{
+			Export: MetricsExportServerConfig{
+				Enabled:  false,
+				Format:   "statsd",
+				Address:  "127.0.0.1:8125",
+				Protocol: "udp",
+				Interval: "10s",
+				Prefix:   "gosync",
+			},
+		},
+
+		Telemetry: TelemetryServerConfig{
+			Endpoint: "",
+		},
+
+		Webhooks: []WebhookServerConfig{},
+		Indexers: []IndexerServerConfig{},
 	}
 }
 
@@ -34,6 +209,10 @@ func setDefaults() {
 	defaults := GetServerDefault()
 
 	viper.SetDefault("shutdown_timeout", defaults.ShutdownTimeout)
+	viper.SetDefault("locale", defaults.Locale)
+	viper.SetDefault("profile", defaults.Profile)
+
+	viper.SetDefault("device.name", defaults.Device.Name)
 
 	viper.SetDefault("log.level", defaults.Log.Level)
 	viper.SetDefault("log.time_format", defaults.Log.TimeFormat)
@@ -45,7 +224,123 @@ func setDefaults() {
 	viper.SetDefault("log.rotation.max_backups", defaults.Log.Rotation.MaxBackups)
 	viper.SetDefault("log.rotation.max_age", defaults.Log.Rotation.MaxAge)
 	viper.SetDefault("log.rotation.compress", defaults.Log.Rotation.Compress)
+	viper.SetDefault("log.outputs", defaults.Log.Outputs)
+
+	viper.SetDefault("api.address", defaults.API.Address)
+	viper.SetDefault("api.auth", defaults.API.Auth)
+	viper.SetDefault("api.token", defaults.API.Token)
+	viper.SetDefault("api.rate_limit", defaults.API.RateLimit)
+	viper.SetDefault("api.rate_burst", defaults.API.RateBurst)
+	viper.SetDefault("api.dashboard", defaults.API.Dashboard)
+	viper.SetDefault("api.tls.enabled", defaults.API.TLS.Enabled)
+	viper.SetDefault("api.tls.cert_file", defaults.API.TLS.CertFile)
+	viper.SetDefault("api.tls.key_file", defaults.API.TLS.KeyFile)
+	viper.SetDefault("api.tls.self_signed", defaults.API.TLS.SelfSigned)
+	viper.SetDefault("api.tls.client_ca_file", defaults.API.TLS.ClientCAFile)
+	viper.SetDefault("api.tls.ca_file", defaults.API.TLS.CAFile)
+	viper.SetDefault("api.tls.client_cert_file", defaults.API.TLS.ClientCertFile)
+	viper.SetDefault("api.tls.client_key_file", defaults.API.TLS.ClientKeyFile)
 
 	viper.SetDefault("metadata.type", defaults.Metadata.Type)
 	viper.SetDefault("metadata.sqlite.path", defaults.Metadata.SQLite.Path)
+	viper.SetDefault("metadata.sqlite.journal_mode", defaults.Metadata.SQLite.JournalMode)
+	viper.SetDefault("metadata.sqlite.busy_timeout", defaults.Metadata.SQLite.BusyTimeout)
+	viper.SetDefault("metadata.sqlite.synchronous", defaults.Metadata.SQLite.Synchronous)
+	viper.SetDefault("metadata.sqlite.cache_size", defaults.Metadata.SQLite.CacheSize)
+	viper.SetDefault("metadata.sqlite.backup.enabled", defaults.Metadata.SQLite.Backup.Enabled)
+	viper.SetDefault("metadata.sqlite.backup.interval", defaults.Metadata.SQLite.Backup.Interval)
+	viper.SetDefault("metadata.sqlite.backup.dir", defaults.Metadata.SQLite.Backup.Dir)
+	viper.SetDefault("metadata.sqlite.backup.keep", defaults.Metadata.SQLite.Backup.Keep)
+	viper.SetDefault("metadata.maintenance.enabled", defaults.Metadata.Maintenance.Enabled)
+	viper.SetDefault("metadata.maintenance.interval", defaults.Metadata.Maintenance.Interval)
+	viper.SetDefault("metadata.maintenance.retention", defaults.Metadata.Maintenance.Retention)
+	viper.SetDefault("metadata.maintenance.vacuum", defaults.Metadata.Maintenance.Vacuum)
+	viper.SetDefault("metadata.maintenance.chunk_grace", defaults.Metadata.Maintenance.ChunkGrace)
+
+	viper.SetDefault("trash.purge_interval", defaults.Trash.PurgeInterval)
+
+	viper.SetDefault("history.enabled", defaults.History.Enabled)
+	viper.SetDefault("history.max_size", defaults.History.MaxSize)
+	viper.SetDefault("history.prune_interval", defaults.History.PruneInterval)
+
+	viper.SetDefault("leases.enabled", defaults.Leases.Enabled)
+	viper.SetDefault("leases.ttl", defaults.Leases.TTL)
+
+	viper.SetDefault("cache.enabled", defaults.Cache.Enabled)
+	viper.SetDefault("cache.dir", defaults.Cache.Dir)
+	viper.SetDefault("cache.max_size", defaults.Cache.MaxSize)
+	viper.SetDefault("cache.read_ahead", defaults.Cache.ReadAhead)
+	viper.SetDefault("downloads.workers", defaults.Downloads.Workers)
+	viper.SetDefault("downloads.chunk_size", defaults.Downloads.ChunkSize)
+	viper.SetDefault("downloads.min_size", defaults.Downloads.MinSize)
+
+	viper.SetDefault("scheduler.concurrency", defaults.Scheduler.Concurrency)
+	viper.SetDefault("scheduler.workers", defaults.Scheduler.Workers)
+	viper.SetDefault("scheduler.blackout", defaults.Scheduler.Blackout)
+	viper.SetDefault("scheduler.adaptive.enabled", defaults.Scheduler.Adaptive.Enabled)
+	viper.SetDefault("scheduler.adaptive.min_interval", defaults.Scheduler.Adaptive.MinInterval)
+	viper.SetDefault("scheduler.adaptive.max_interval", defaults.Scheduler.Adaptive.MaxInterval)
+
+	viper.SetDefault("anomaly.enabled", defaults.Anomaly.Enabled)
+	viper.SetDefault("anomaly.max_change_ratio", defaults.Anomaly.MaxChangeRatio)
+	viper.SetDefault("anomaly.min_files", defaults.Anomaly.MinFiles)
+	viper.SetDefault("anomaly.entropy", defaults.Anomaly.Entropy)
+
+	viper.SetDefault("snapshots.enabled", defaults.Snapshots.Enabled)
+	viper.SetDefault("snapshots.interval", defaults.Snapshots.Interval)
+	viper.SetDefault("snapshots.retention", defaults.Snapshots.Retention)
+	viper.SetDefault("snapshots.compliance", defaults.Snapshots.Compliance)
+	viper.SetDefault("snapshots.keep", defaults.Snapshots.Keep)
+
+	viper.SetDefault("tuning.enabled", defaults.Tuning.Enabled)
+	viper.SetDefault("tuning.min_chunk_size", defaults.Tuning.MinChunkSize)
+	viper.SetDefault("tuning.max_chunk_size", defaults.Tuning.MaxChunkSize)
+
+	viper.SetDefault("scanner.enabled", defaults.Scanner.Enabled)
+	viper.SetDefault("scanner.interval", defaults.Scanner.Interval)
+	viper.SetDefault("scanner.workers", defaults.Scanner.Workers)
+	viper.SetDefault("scanner.page_size", defaults.Scanner.PageSize)
+
+	viper.SetDefault("offload.enabled", defaults.Offload.Enabled)
+	viper.SetDefault("offload.workers", defaults.Offload.Workers)
+	viper.SetDefault("offload.remote", defaults.Offload.Remote)
+
+	viper.SetDefault("digest.enabled", defaults.Digest.Enabled)
+	viper.SetDefault("digest.period", defaults.Digest.Period)
+	viper.SetDefault("digest.schedule", defaults.Digest.Schedule)
+	viper.SetDefault("digest.email.host", defaults.Digest.Email.Host)
+	viper.SetDefault("digest.email.port", defaults.Digest.Email.Port)
+	viper.SetDefault("digest.email.username", defaults.Digest.Email.Username)
+	viper.SetDefault("digest.email.password", defaults.Digest.Email.Password)
+	viper.SetDefault("digest.email.from", defaults.Digest.Email.From)
+	viper.SetDefault("digest.email.to", defaults.Digest.Email.To)
+
+	viper.SetDefault("limits.max_open_files", defaults.Limits.MaxOpenFiles)
+	viper.SetDefault("limits.memory_watermark", defaults.Limits.MemoryWatermark)
+
+	viper.SetDefault("secrets.cache_ttl", defaults.Secrets.CacheTTL)
+	viper.SetDefault("secrets.vault.address", defaults.Secrets.Vault.Address)
+	viper.SetDefault("secrets.vault.token", defaults.Secrets.Vault.Token)
+	viper.SetDefault("secrets.vault.namespace", defaults.Secrets.Vault.Namespace)
+	viper.SetDefault("secrets.vault.timeout", defaults.Secrets.Vault.Timeout)
+
+	viper.SetDefault("drills.enabled", defaults.Drills.Enabled)
+	viper.SetDefault("drills.interval", defaults.Drills.Interval)
+	viper.SetDefault("drills.samples", defaults.Drills.Samples)
+	viper.SetDefault("drills.max_file_size", defaults.Drills.MaxFileSize)
+	viper.SetDefault("drills.backends", defaults.Drills.Backends)
+
+	viper.SetDefault("publish.signing_key", defaults.Publish.SigningKey)
+
+	viper.SetDefault("metrics.export.enabled", defaults.Metrics.Export.Enabled)
+	viper.SetDefault("metrics.export.format", defaults.Metrics.Export.Format)
+	viper.SetDefault("metrics.export.address", defaults.Metrics.Export.Address)
+	viper.SetDefault("metrics.export.protocol", defaults.Metrics.Export.Protocol)
+	viper.SetDefault("metrics.export.interval", defaults.Metrics.Export.Interval)
+	viper.SetDefault("metrics.export.prefix", defaults.Metrics.Export.Prefix)
+
+	viper.SetDefault("telemetry.endpoint", defaults.Telemetry.Endpoint)
+
+	viper.SetDefault("webhooks", defaults.Webhooks)
+	viper.SetDefault("indexers", defaults.Indexers)
 }
@@ -0,0 +1,7 @@
+package server
+
+// DeviceServerConfig describes this device within the device registry shown by 'gosync devices'
+type DeviceServerConfig struct {
+	// Name shown for this device (defaults to the hostname)
+	Name string `mapstructure:"name" yaml:"name"`
+}
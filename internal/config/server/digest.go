@@ -0,0 +1,23 @@
+package server
+
+// DigestServerConfig configures the digests summarizing the activity of all syncs on this client
+type DigestServerConfig struct {
+	Enabled bool `mapstructure:"enabled" yaml:"enabled"`
+	// Period covered by each digest, either "daily" or "weekly"
+	Period string `mapstructure:"period" yaml:"period"`
+	// Cron expression in local time the digest is sent at, e.g. "0 8 * * mon"
+	Schedule string `mapstructure:"schedule" yaml:"schedule"`
+	// Email sends digests as plain text mails in addition to webhooks subscribed to "sync.digest"
+	Email DigestEmailConfig `mapstructure:"email" yaml:"email"`
+}
+
+// DigestEmailConfig holds the SMTP server digests are mailed through (disabled if host is empty)
+type DigestEmailConfig struct {
+	Host     string `mapstructure:"host"     yaml:"host"`
+	Port     int    `mapstructure:"port"     yaml:"port"`
+	Username string `mapstructure:"username" yaml:"username"`
+	// Password may reference a secret, e.g. "${env:SMTP_PASSWORD}"
+	Password string   `mapstructure:"password" yaml:"password"`
+	From     string   `mapstructure:"from"     yaml:"from"`
+	To       []string `mapstructure:"to"       yaml:"to"`
+}
@@ -0,0 +1,12 @@
+package server
+
+// DownloadServerConfig configures the parallel downloads of large files, which are split into ranged reads fetched
+// by multiple workers at once
+type DownloadServerConfig struct {
+	// Workers fetching ranges of the same file at once (1 = disabled)
+	Workers int `mapstructure:"workers" yaml:"workers"`
+	// Size in MB of each range (0 = chunk size learned by tuning, or 16 MB without tuning)
+	ChunkSize int `mapstructure:"chunk_size" yaml:"chunk_size"`
+	// Size in MB files need to have to be downloaded in parallel
+	MinSize int `mapstructure:"min_size" yaml:"min_size"`
+}
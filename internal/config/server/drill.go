@@ -0,0 +1,14 @@
+package server
+
+// DrillServerConfig holds configuration for scheduled restore drills
+type DrillServerConfig struct {
+	// Periodically restore a random sample of files and verify their hashes
+	Enabled  bool   `mapstructure:"enabled"  yaml:"enabled"`
+	Interval string `mapstructure:"interval" yaml:"interval"`
+	// Number of files restored per backend and drill
+	Samples int `mapstructure:"samples" yaml:"samples"`
+	// Files larger than this size in megabytes are never sampled (0 = unlimited)
+	MaxFileSize int `mapstructure:"max_file_size" yaml:"max_file_size"`
+	// Backends to drill (all backends if empty)
+	Backends []string `mapstructure:"backends" yaml:"backends"`
+}
@@ -0,0 +1,11 @@
+package server
+
+// HistoryServerConfig configures the transfer log recording every upload, download, deletion and conflict
+// resolution applied by sync passes, queried with "gosync history"
+type HistoryServerConfig struct {
+	Enabled bool `mapstructure:"enabled" yaml:"enabled"`
+	// Size in MB the transfer log may occupy within the database, the oldest entries are pruned beyond it (0 = unlimited)
+	MaxSize int `mapstructure:"max_size" yaml:"max_size"`
+	// Interval the size of the transfer log is checked at
+	PruneInterval string `mapstructure:"prune_interval" yaml:"prune_interval"`
+}
@@ -0,0 +1,24 @@
+package server
+
+// IndexerServerConfig holds configuration for a search engine kept up to date with the indexed files
+type IndexerServerConfig struct {
+	// Name identifies the indexer and its position within the change feed
+	Name string `mapstructure:"name" yaml:"name"`
+	// Type of the search engine (elasticsearch, meilisearch or typesense)
+	Type string `mapstructure:"type" yaml:"type"`
+	URL  string `mapstructure:"url"  yaml:"url"`
+	// Index (elasticsearch, meilisearch) or collection (typesense) receiving the documents
+	Index string `mapstructure:"index" yaml:"index"`
+	// API key of the search engine, may reference a secret
+	APIKey string `mapstructure:"api_key" yaml:"api_key"`
+	// Backends whose files are indexed (all if empty)
+	Backends []string `mapstructure:"backends" yaml:"backends"`
+	// Include the content of files with these extensions (e.g. ".txt") as text, up to max_text_size KB
+	TextExtensions []string `mapstructure:"text_extensions" yaml:"text_extensions"`
+	MaxTextSize    int      `mapstructure:"max_text_size"   yaml:"max_text_size"`
+	// Interval in which the change feed is polled for new events
+	Interval string `mapstructure:"interval" yaml:"interval"`
+	// Number of documents sent per request
+	BatchSize int    `mapstructure:"batch_size" yaml:"batch_size"`
+	Timeout   string `mapstructure:"timeout"    yaml:"timeout"`
+}
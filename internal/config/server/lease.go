@@ -0,0 +1,10 @@
+package server
+
+// LeaseServerConfig configures the leases written next to the files of backends, so clients sharing a backend
+// never write the same file at once, even if they use separate metadata databases
+type LeaseServerConfig struct {
+	Enabled bool `mapstructure:"enabled" yaml:"enabled"`
+	// Duration a lease stays valid without being renewed, after which other clients take it over; must exceed
+	// the clock skew between the clients
+	TTL string `mapstructure:"ttl" yaml:"ttl"`
+}
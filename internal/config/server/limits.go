@@ -0,0 +1,9 @@
+package server
+
+// LimitsServerConfig holds the self-imposed resource limits of the agent
+type LimitsServerConfig struct {
+	// Maximum number of files held open by transfers at the same time (0 = unlimited)
+	MaxOpenFiles int `mapstructure:"max_open_files" yaml:"max_open_files"`
+	// Heap size in megabytes above which new work is delayed and scheduled syncs are postponed (0 = unlimited)
+	MemoryWatermark int `mapstructure:"memory_watermark" yaml:"memory_watermark"`
+}
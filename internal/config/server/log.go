@@ -8,6 +8,8 @@ type LogServerConfig struct {
 	JSON       bool                    `mapstructure:"json"        yaml:"json"`
 	NoTerminal bool                    `mapstructure:"no_terminal" yaml:"no_terminal"`
 	Rotation   LogServerRotationConfig `mapstructure:"rotation"    yaml:"rotation"`
+	// Outputs receiving all log messages at the same time, replacing file and no_terminal if set
+	Outputs []LogOutputConfig `mapstructure:"outputs" yaml:"outputs"`
 }
 
 type LogServerRotationConfig struct {
@@ -16,3 +18,20 @@ type LogServerRotationConfig struct {
 	MaxAge     int  `mapstructure:"max_age"      yaml:"max_age"`
 	Compress   bool `mapstructure:"compress"     yaml:"compress"`
 }
+
+// LogOutputConfig defines a single log output
+type LogOutputConfig struct {
+	// "stdout", "file", "syslog" or "journald"
+	Type string `mapstructure:"type" yaml:"type"`
+	// Path of the file output, rotated as defined in log.rotation (defaults to log.file)
+	Path string `mapstructure:"path" yaml:"path,omitempty"`
+	// Network of the syslog output, "udp", "tcp" or "unix"
+	Network string `mapstructure:"network" yaml:"network,omitempty"`
+	// Address of the syslog server, e.g. "logs.example.com:514" or "/dev/log",
+	// or the socket of journald (defaults to "/run/systemd/journal/socket")
+	Address string `mapstructure:"address" yaml:"address,omitempty"`
+	// Syslog facility, e.g. "daemon" (default) or "local0"
+	Facility string `mapstructure:"facility" yaml:"facility,omitempty"`
+	// Application name reported to syslog and journald (defaults to "gosync")
+	Tag string `mapstructure:"tag" yaml:"tag,omitempty"`
+}
@@ -2,11 +2,46 @@ package server
 
 // MetadataServerConfig holds metadata store configuration
 type MetadataServerConfig struct {
-	Type   string               `mapstructure:"type"   yaml:"type"`
-	SQLite MetadataSQLiteConfig `mapstructure:"sqlite" yaml:"sqlite"`
+	Type        string                    `mapstructure:"type"        yaml:"type"`
+	SQLite      MetadataSQLiteConfig      `mapstructure:"sqlite"      yaml:"sqlite"`
+	Maintenance MetadataMaintenanceConfig `mapstructure:"maintenance" yaml:"maintenance"`
+}
+
+// MetadataMaintenanceConfig holds the schedule of the database maintenance, which hard-deletes soft-deleted
+// records after the retention, prunes records of files and syncs that no longer exist, deletes unreferenced
+// chunks of deduplicated files and vacuums the database
+type MetadataMaintenanceConfig struct {
+	Enabled  bool   `mapstructure:"enabled"  yaml:"enabled"`
+	Interval string `mapstructure:"interval" yaml:"interval"`
+	// Duration soft-deleted records are kept, e.g. to list deleted files
+	Retention string `mapstructure:"retention" yaml:"retention"`
+	// Rebuild the database after each run to reclaim the space of deleted records
+	Vacuum bool `mapstructure:"vacuum" yaml:"vacuum"`
+	// Age of chunks no deduplicated file references before they are deleted, covering uploads in progress
+	ChunkGrace string `mapstructure:"chunk_grace" yaml:"chunk_grace"`
 }
 
 // SQLiteMetadataConfig holds SQLite-specific configuration
 type MetadataSQLiteConfig struct {
 	Path string `mapstructure:"path" yaml:"path"`
+	// Journal mode of the database, "wal" lets the CLI read while the agent writes ("" = SQLite default)
+	JournalMode string `mapstructure:"journal_mode" yaml:"journal_mode"`
+	// Milliseconds a connection waits for locks held by other processes (0 = fail immediately)
+	BusyTimeout int `mapstructure:"busy_timeout" yaml:"busy_timeout"`
+	// Durability of commits, "off", "normal", "full" or "extra" ("" = SQLite default)
+	Synchronous string `mapstructure:"synchronous" yaml:"synchronous"`
+	// Page cache size in kilobytes (0 = SQLite default)
+	CacheSize int `mapstructure:"cache_size" yaml:"cache_size"`
+
+	Backup MetadataBackupConfig `mapstructure:"backup" yaml:"backup"`
+}
+
+// MetadataBackupConfig holds the schedule of online backups of the SQLite database
+type MetadataBackupConfig struct {
+	Enabled  bool   `mapstructure:"enabled"  yaml:"enabled"`
+	Interval string `mapstructure:"interval" yaml:"interval"`
+	// Directory of the backups ("" = "backups" next to the database)
+	Dir string `mapstructure:"dir" yaml:"dir"`
+	// Number of backups kept, older backups are deleted after each backup
+	Keep int `mapstructure:"keep" yaml:"keep"`
 }
@@ -0,0 +1,21 @@
+package server
+
+// MetricsServerConfig holds configuration for the metrics of the agent
+type MetricsServerConfig struct {
+	Export MetricsExportServerConfig `mapstructure:"export" yaml:"export"`
+}
+
+// MetricsExportServerConfig holds configuration for pushing the metrics served by /metrics
+// to statsd, graphite or InfluxDB for setups without Prometheus
+type MetricsExportServerConfig struct {
+	Enabled bool `mapstructure:"enabled" yaml:"enabled"`
+	// Format of the pushed metrics (statsd, graphite or influx)
+	Format string `mapstructure:"format" yaml:"format"`
+	// Address of the receiver, e.g. "127.0.0.1:8125" for statsd
+	Address string `mapstructure:"address" yaml:"address"`
+	// Protocol used to connect to the receiver (udp or tcp)
+	Protocol string `mapstructure:"protocol" yaml:"protocol"`
+	Interval string `mapstructure:"interval" yaml:"interval"`
+	// Prefix of all metric names, e.g. "gosync.sync_actions"
+	Prefix string `mapstructure:"prefix" yaml:"prefix"`
+}
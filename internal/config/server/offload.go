@@ -0,0 +1,12 @@
+package server
+
+// OffloadServerConfig configures the experimental offloading of hashing files to worker processes, keeping the
+// agent responsive on weak hardware
+type OffloadServerConfig struct {
+	Enabled bool `mapstructure:"enabled" yaml:"enabled"`
+	// Worker processes started by the agent on the same machine
+	Workers int `mapstructure:"workers" yaml:"workers"`
+	// Addresses of workers started with "gosync worker --listen" on other machines, which receive the content
+	// of the files over the network
+	Remote []string `mapstructure:"remote" yaml:"remote"`
+}
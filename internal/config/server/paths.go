@@ -0,0 +1,35 @@
+package server
+
+import "path/filepath"
+
+// DefaultSQLitePath returns the default location of the SQLite metadata store
+func DefaultSQLitePath() string {
+	if dir := dataDir(); dir != "" {
+		return filepath.Join(dir, "gosync.db")
+	}
+	return "./gosync.db"
+}
+
+// DefaultTLSCertPath returns the default location of the API certificate
+func DefaultTLSCertPath() string {
+	if dir := dataDir(); dir != "" {
+		return filepath.Join(dir, "gosync-api.crt")
+	}
+	return "./gosync-api.crt"
+}
+
+// DefaultTLSKeyPath returns the default location of the private key of the API certificate
+func DefaultTLSKeyPath() string {
+	if dir := dataDir(); dir != "" {
+		return filepath.Join(dir, "gosync-api.key")
+	}
+	return "./gosync-api.key"
+}
+
+// DefaultCacheDir returns the default location of the content cache
+func DefaultCacheDir() string {
+	if dir := dataDir(); dir != "" {
+		return filepath.Join(dir, "gosync-cache")
+	}
+	return "./gosync-cache"
+}
@@ -0,0 +1,13 @@
+//go:build !windows
+
+package server
+
+// SystemDir returns the machine-wide configuration directory
+func SystemDir() string {
+	return "/etc/gosync"
+}
+
+// dataDir returns the directory of the metadata store, which is the working directory if empty
+func dataDir() string {
+	return ""
+}
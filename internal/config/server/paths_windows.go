@@ -0,0 +1,23 @@
+//go:build windows
+
+package server
+
+import (
+	"os"
+	"path/filepath"
+)
+
+// SystemDir returns the machine-wide configuration directory, e.g. "C:\ProgramData\GoSync"
+func SystemDir() string {
+	base := os.Getenv("ProgramData")
+	if base == "" {
+		base = `C:\ProgramData`
+	}
+	return filepath.Join(base, "GoSync")
+}
+
+// dataDir returns the directory of the metadata store, since the working directory
+// of Windows services is the system directory
+func dataDir() string {
+	return SystemDir()
+}
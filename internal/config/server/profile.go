@@ -0,0 +1,60 @@
+package server
+
+const (
+	// ProfileDefault applies no resource limits beyond the configured values
+	ProfileDefault = "default"
+	// ProfileLowMemory caps concurrency, buffers and caches for small devices, e.g. ARM boards with 512MB of memory
+	ProfileLowMemory = "low-memory"
+)
+
+// Limits of the low-memory profile
+const (
+	lowMemoryConcurrency  = 1
+	lowMemoryWorkers      = 2
+	lowMemoryMaxChunkSize = 16   // Megabytes, every worker buffers up to one part per transfer
+	lowMemoryCacheSize    = 2048 // Kilobytes of SQLite page cache
+	lowMemoryWatermark    = 256  // Megabytes of heap before new work is delayed
+	lowMemoryOpenFiles    = 64
+	lowMemoryScanWorkers  = 1
+	lowMemoryDownloads    = 1 // Workers per file, every worker buffers one range
+)
+
+// ProfileLimits holds the limits of the resource profile that aren't part of the configuration itself
+type ProfileLimits struct {
+	// Maximum number of workers per sync pass, regardless of the workers of the sync (0 = unlimited)
+	MaxWorkers int
+	// Skip delta transfers, so files are only hashed while being streamed instead of in a separate pass
+	StreamingOnly bool
+}
+
+// ProfileLimits returns the limits of the configured resource profile
+func (c *BaseServerConfig) ProfileLimits() ProfileLimits {
+	if c.Profile == ProfileLowMemory {
+		return ProfileLimits{
+			MaxWorkers:    lowMemoryWorkers,
+			StreamingOnly: true,
+		}
+	}
+	return ProfileLimits{}
+}
+
+// applyProfile caps the configured values at the limits of the resource profile.
+// Unsupported profiles are reported by Validate and don't change any values.
+func (c *BaseServerConfig) applyProfile() {
+	if c.Profile == ProfileLowMemory {
+		c.Scheduler.Concurrency = min(c.Scheduler.Concurrency, lowMemoryConcurrency)
+		c.Tuning.MaxChunkSize = min(c.Tuning.MaxChunkSize, lowMemoryMaxChunkSize)
+		c.Tuning.MinChunkSize = min(c.Tuning.MinChunkSize, c.Tuning.MaxChunkSize)
+		c.Scanner.Workers = min(c.Scanner.Workers, lowMemoryScanWorkers)
+		c.Downloads.Workers = min(c.Downloads.Workers, lowMemoryDownloads)
+		if c.Limits.MemoryWatermark <= 0 || c.Limits.MemoryWatermark > lowMemoryWatermark {
+			c.Limits.MemoryWatermark = lowMemoryWatermark
+		}
+		if c.Limits.MaxOpenFiles <= 0 || c.Limits.MaxOpenFiles > lowMemoryOpenFiles {
+			c.Limits.MaxOpenFiles = lowMemoryOpenFiles
+		}
+		if c.Metadata.SQLite.CacheSize <= 0 || c.Metadata.SQLite.CacheSize > lowMemoryCacheSize {
+			c.Metadata.SQLite.CacheSize = lowMemoryCacheSize
+		}
+	}
+}
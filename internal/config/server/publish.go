@@ -0,0 +1,8 @@
+package server
+
+// PublishServerConfig holds the key signing the manifests of published syncs
+type PublishServerConfig struct {
+	// Base64 encoded ed25519 private key or seed, may reference a secret, e.g. "${env:GOSYNC_SIGNING_KEY}"
+	// (see "gosync publish keygen"; published syncs fail if empty)
+	SigningKey string `mapstructure:"signing_key" yaml:"signing_key"`
+}
@@ -0,0 +1,11 @@
+package server
+
+// ScannerServerConfig configures the scans recording the objects of the backends of all enabled syncs
+type ScannerServerConfig struct {
+	Enabled  bool   `mapstructure:"enabled" yaml:"enabled"`
+	Interval string `mapstructure:"interval" yaml:"interval"`
+	// Workers listing the subdirectories of a backend in parallel, also used by the listings of sync passes
+	Workers int `mapstructure:"workers" yaml:"workers"`
+	// Maximum number of keys listed per request
+	PageSize int `mapstructure:"page_size" yaml:"page_size"`
+}
@@ -0,0 +1,22 @@
+package server
+
+// SchedulerServerConfig holds configuration for the agent's sync scheduler
+type SchedulerServerConfig struct {
+	// Maximum number of sync passes running at the same time
+	Concurrency int `mapstructure:"concurrency" yaml:"concurrency"`
+	// Maximum number of actions applied at the same time by all passes, shared between the running
+	// syncs by their weight, so a large sync can't starve the others (0 = unlimited)
+	Workers int `mapstructure:"workers" yaml:"workers"`
+	// Global windows without transfers, e.g. "Mon-Fri 08:00-18:00"
+	Blackout string `mapstructure:"blackout" yaml:"blackout"`
+	// Adaptive polling of syncs with an interval based on how often their passes find changes
+	Adaptive SchedulerAdaptiveConfig `mapstructure:"adaptive" yaml:"adaptive"`
+}
+
+// SchedulerAdaptiveConfig bounds the polling intervals learned for syncs, which start at their configured
+// interval, grow while passes find no changes and shrink once they do
+type SchedulerAdaptiveConfig struct {
+	Enabled     bool   `mapstructure:"enabled" yaml:"enabled"`
+	MinInterval string `mapstructure:"min_interval" yaml:"min_interval"`
+	MaxInterval string `mapstructure:"max_interval" yaml:"max_interval"`
+}
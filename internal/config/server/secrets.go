@@ -0,0 +1,18 @@
+package server
+
+// SecretsServerConfig holds the configuration used to resolve secret references, e.g. "${vault:secret/data/gosync#key}"
+type SecretsServerConfig struct {
+	// Duration resolved values are cached before they are resolved again
+	CacheTTL string             `mapstructure:"cache_ttl" yaml:"cache_ttl"`
+	Vault    VaultSecretsConfig `mapstructure:"vault"     yaml:"vault"`
+}
+
+// VaultSecretsConfig holds the connection to the Vault server resolving "${vault:...}" references
+type VaultSecretsConfig struct {
+	// Address of the Vault server, e.g. "https://vault:8200" (VAULT_ADDR if empty)
+	Address string `mapstructure:"address" yaml:"address"`
+	// Token used to authenticate, may reference an environment variable or file (VAULT_TOKEN if empty)
+	Token     string `mapstructure:"token"     yaml:"token"`
+	Namespace string `mapstructure:"namespace" yaml:"namespace"`
+	Timeout   string `mapstructure:"timeout"   yaml:"timeout"`
+}
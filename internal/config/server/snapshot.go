@@ -0,0 +1,16 @@
+package server
+
+// SnapshotServerConfig holds the schedule of "last known good" snapshots, which record the object versions of
+// all remote sync roots in a retention-locked manifest. Snapshots are also created once a pass is paused after
+// an anomaly, before its changes could be confirmed.
+type SnapshotServerConfig struct {
+	Enabled bool `mapstructure:"enabled" yaml:"enabled"`
+	// Interval between scheduled snapshots of each sync
+	Interval string `mapstructure:"interval" yaml:"interval"`
+	// Duration manifests are locked against deletion, which requires object lock for S3 buckets ("" disables the lock)
+	Retention string `mapstructure:"retention" yaml:"retention"`
+	// Lock manifests in compliance mode, which can't be lifted before the retention expires
+	Compliance bool `mapstructure:"compliance" yaml:"compliance"`
+	// Number of snapshots kept per sync, older snapshots are deleted once their lock expired
+	Keep int `mapstructure:"keep" yaml:"keep"`
+}
@@ -0,0 +1,8 @@
+package server
+
+// TelemetryServerConfig holds configuration for the anonymous usage telemetry of the CLI, which is only
+// recorded after opting in with 'gosync telemetry enable'
+type TelemetryServerConfig struct {
+	// Endpoint receiving the queued events as JSON via POST, events are only kept locally if empty
+	Endpoint string `mapstructure:"endpoint" yaml:"endpoint"`
+}
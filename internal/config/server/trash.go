@@ -0,0 +1,6 @@
+package server
+
+// TrashServerConfig holds configuration for the agent's trash purge job
+type TrashServerConfig struct {
+	PurgeInterval string `mapstructure:"purge_interval" yaml:"purge_interval"`
+}
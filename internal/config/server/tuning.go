@@ -0,0 +1,9 @@
+package server
+
+// TuningServerConfig holds the bounds for the automatic chunk size tuning
+type TuningServerConfig struct {
+	Enabled bool `mapstructure:"enabled" yaml:"enabled"`
+	// Chunk size bounds in megabytes
+	MinChunkSize int `mapstructure:"min_chunk_size" yaml:"min_chunk_size"`
+	MaxChunkSize int `mapstructure:"max_chunk_size" yaml:"max_chunk_size"`
+}
@@ -0,0 +1,400 @@
+package server
+
+import (
+	"fmt"
+	"net"
+	"net/url"
+	"reflect"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/mwantia/gosync/pkg/schedule"
+)
+
+// ValidationError describes an invalid setting by its YAML path, e.g. "log.outputs[0].network"
+type ValidationError struct {
+	Path    string
+	Message string
+}
+
+func (e ValidationError) Error() string {
+	return fmt.Sprintf("%s: %s", e.Path, e.Message)
+}
+
+// ValidationErrors contains all problems found within a configuration
+type ValidationErrors []ValidationError
+
+func (e ValidationErrors) Error() string {
+	messages := make([]string, 0, len(e))
+	for _, err := range e {
+		messages = append(messages, err.Error())
+	}
+	return fmt.Sprintf("invalid configuration:\n  %s", strings.Join(messages, "\n  "))
+}
+
+func (e *ValidationErrors) add(path, msg string, args ...any) {
+	*e = append(*e, ValidationError{
+		Path:    path,
+		Message: fmt.Sprintf(msg, args...),
+	})
+}
+
+// Validate checks the configuration and reports all problems at once instead of failing on first use.
+// Settings are the raw values of the configuration (e.g. viper.AllSettings()), which are checked for unknown keys.
+func Validate(cfg *BaseServerConfig, settings map[string]any) ValidationErrors {
+	var errs ValidationErrors
+	if settings != nil {
+		unknownKeys(&errs, settings, reflect.TypeOf(*cfg), "")
+	}
+
+	errs.duration("shutdown_timeout", cfg.ShutdownTimeout, true)
+
+	switch cfg.Profile {
+	case "", ProfileDefault, ProfileLowMemory:
+	default:
+		errs.add("profile", "unsupported profile '%s', expected '%s' or '%s'", cfg.Profile, ProfileDefault, ProfileLowMemory)
+	}
+
+	validateLog(&errs, cfg.Log)
+
+	if cfg.API.Address == "" {
+		errs.add("api.address", "address is required")
+	} else if _, _, err := net.SplitHostPort(cfg.API.Address); err != nil {
+		errs.add("api.address", "invalid address '%s': %v", cfg.API.Address, err)
+	}
+	if cfg.API.TLS.Enabled {
+		if cfg.API.TLS.CertFile == "" {
+			errs.add("api.tls.cert_file", "certificate is required if tls is enabled")
+		}
+		if cfg.API.TLS.KeyFile == "" {
+			errs.add("api.tls.key_file", "key is required if tls is enabled")
+		}
+	}
+	if (cfg.API.TLS.ClientCertFile == "") != (cfg.API.TLS.ClientKeyFile == "") {
+		errs.add("api.tls.client_cert_file", "client certificate and key must be configured together")
+	}
+	if cfg.API.RateLimit < 0 {
+		errs.add("api.rate_limit", "rate limit must not be negative")
+	}
+	if cfg.API.RateLimit > 0 && cfg.API.RateBurst < 1 {
+		errs.add("api.rate_burst", "burst must be at least 1 if a rate limit is set")
+	}
+
+	switch cfg.Metadata.Type {
+	case "sqlite":
+		if cfg.Metadata.SQLite.Path == "" {
+			errs.add("metadata.sqlite.path", "path is required")
+		}
+	default:
+		errs.add("metadata.type", "unsupported metadata store type '%s'", cfg.Metadata.Type)
+	}
+	switch strings.ToLower(cfg.Metadata.SQLite.JournalMode) {
+	case "", "delete", "truncate", "persist", "memory", "wal", "off":
+	default:
+		errs.add("metadata.sqlite.journal_mode", "unsupported journal mode '%s', expected e.g. 'wal' or 'delete'", cfg.Metadata.SQLite.JournalMode)
+	}
+	if cfg.Metadata.SQLite.BusyTimeout < 0 {
+		errs.add("metadata.sqlite.busy_timeout", "must not be negative")
+	}
+	switch strings.ToLower(cfg.Metadata.SQLite.Synchronous) {
+	case "", "off", "normal", "full", "extra":
+	default:
+		errs.add("metadata.sqlite.synchronous", "unsupported synchronous setting '%s', expected 'off', 'normal', 'full' or 'extra'", cfg.Metadata.SQLite.Synchronous)
+	}
+	if cfg.Metadata.SQLite.CacheSize < 0 {
+		errs.add("metadata.sqlite.cache_size", "must not be negative")
+	}
+	errs.duration("metadata.sqlite.backup.interval", cfg.Metadata.SQLite.Backup.Interval, cfg.Metadata.SQLite.Backup.Enabled)
+	if cfg.Metadata.SQLite.Backup.Keep < 1 {
+		errs.add("metadata.sqlite.backup.keep", "must be at least 1")
+	}
+	errs.duration("metadata.maintenance.interval", cfg.Metadata.Maintenance.Interval, cfg.Metadata.Maintenance.Enabled)
+	errs.duration("metadata.maintenance.retention", cfg.Metadata.Maintenance.Retention, cfg.Metadata.Maintenance.Enabled)
+	errs.duration("metadata.maintenance.chunk_grace", cfg.Metadata.Maintenance.ChunkGrace, cfg.Metadata.Maintenance.Enabled)
+
+	errs.duration("trash.purge_interval", cfg.Trash.PurgeInterval, true)
+
+	if cfg.History.MaxSize < 0 {
+		errs.add("history.max_size", "must not be negative")
+	}
+	errs.duration("history.prune_interval", cfg.History.PruneInterval, cfg.History.Enabled && cfg.History.MaxSize > 0)
+
+	errs.duration("leases.ttl", cfg.Leases.TTL, cfg.Leases.Enabled)
+
+	if cfg.Cache.ReadAhead < 0 {
+		errs.add("cache.read_ahead", "must not be negative")
+	}
+	// Blocks read ahead must not evict the block being read
+	if minSize := (max(cfg.Cache.ReadAhead, 0) + 1) * cacheBlockSize; cfg.Cache.Enabled && cfg.Cache.MaxSize < minSize {
+		errs.add("cache.max_size", "must be at least %d with a read-ahead of %d blocks", minSize, cfg.Cache.ReadAhead)
+	}
+	if cfg.Cache.Enabled && cfg.Cache.Dir == "" {
+		errs.add("cache.dir", "must not be empty")
+	}
+	if cfg.Downloads.Workers < 1 {
+		errs.add("downloads.workers", "must be at least 1")
+	}
+	if cfg.Downloads.ChunkSize < 0 {
+		errs.add("downloads.chunk_size", "must not be negative")
+	}
+	if cfg.Downloads.MinSize < 0 {
+		errs.add("downloads.min_size", "must not be negative")
+	}
+
+	if cfg.Scheduler.Concurrency < 1 {
+		errs.add("scheduler.concurrency", "must be at least 1")
+	}
+	if cfg.Scheduler.Workers < 0 {
+		errs.add("scheduler.workers", "must not be negative")
+	}
+	if _, err := schedule.ParseWindows(cfg.Scheduler.Blackout); err != nil {
+		errs.add("scheduler.blackout", "%v", err)
+	}
+	errs.duration("scheduler.adaptive.min_interval", cfg.Scheduler.Adaptive.MinInterval, cfg.Scheduler.Adaptive.Enabled)
+	errs.duration("scheduler.adaptive.max_interval", cfg.Scheduler.Adaptive.MaxInterval, cfg.Scheduler.Adaptive.Enabled)
+	if cfg.Scheduler.Adaptive.Enabled {
+		minInterval, errMin := time.ParseDuration(cfg.Scheduler.Adaptive.MinInterval)
+		maxInterval, errMax := time.ParseDuration(cfg.Scheduler.Adaptive.MaxInterval)
+		if errMin == nil && errMax == nil && maxInterval < minInterval {
+			errs.add("scheduler.adaptive.max_interval", "must not be shorter than scheduler.adaptive.min_interval")
+		}
+	}
+
+	if cfg.Anomaly.MaxChangeRatio <= 0 || cfg.Anomaly.MaxChangeRatio > 1 {
+		errs.add("anomaly.max_change_ratio", "must be greater than 0 and at most 1")
+	}
+	if cfg.Anomaly.MinFiles < 1 {
+		errs.add("anomaly.min_files", "must be at least 1")
+	}
+
+	errs.duration("snapshots.interval", cfg.Snapshots.Interval, true)
+	errs.duration("snapshots.retention", cfg.Snapshots.Retention, false)
+	if cfg.Snapshots.Keep < 1 {
+		errs.add("snapshots.keep", "must be at least 1")
+	}
+
+	if cfg.Tuning.MinChunkSize < 1 {
+		errs.add("tuning.min_chunk_size", "must be at least 1")
+	}
+	if cfg.Tuning.MaxChunkSize < cfg.Tuning.MinChunkSize {
+		errs.add("tuning.max_chunk_size", "must not be smaller than tuning.min_chunk_size (%d)", cfg.Tuning.MinChunkSize)
+	}
+
+	errs.duration("scanner.interval", cfg.Scanner.Interval, cfg.Scanner.Enabled)
+	if cfg.Scanner.Workers < 1 {
+		errs.add("scanner.workers", "must be at least 1")
+	}
+	if cfg.Scanner.PageSize < 1 || cfg.Scanner.PageSize > 1000 {
+		errs.add("scanner.page_size", "must be between 1 and 1000")
+	}
+
+	if cfg.Offload.Workers < 0 {
+		errs.add("offload.workers", "must not be negative")
+	}
+	if cfg.Offload.Enabled && cfg.Offload.Workers == 0 && len(cfg.Offload.Remote) == 0 {
+		errs.add("offload.workers", "must be at least 1 without remote workers")
+	}
+
+	if digest := cfg.Digest; digest.Enabled {
+		switch digest.Period {
+		case "daily", "weekly":
+		default:
+			errs.add("digest.period", "unsupported period '%s', expected daily or weekly", digest.Period)
+		}
+		if _, err := schedule.ParseCron(digest.Schedule); err != nil {
+			errs.add("digest.schedule", "%v", err)
+		}
+		if email := digest.Email; email.Host != "" {
+			if email.Port < 1 || email.Port > 65535 {
+				errs.add("digest.email.port", "must be between 1 and 65535")
+			}
+			if email.From == "" {
+				errs.add("digest.email.from", "sender is required")
+			}
+			if len(email.To) == 0 {
+				errs.add("digest.email.to", "at least one recipient is required")
+			}
+		}
+	}
+
+	if cfg.Limits.MaxOpenFiles < 0 {
+		errs.add("limits.max_open_files", "must not be negative")
+	}
+	if cfg.Limits.MemoryWatermark < 0 {
+		errs.add("limits.memory_watermark", "must not be negative")
+	}
+
+	errs.duration("secrets.cache_ttl", cfg.Secrets.CacheTTL, false)
+	errs.duration("secrets.vault.timeout", cfg.Secrets.Vault.Timeout, false)
+
+	errs.duration("drills.interval", cfg.Drills.Interval, cfg.Drills.Enabled)
+	if cfg.Drills.Samples < 1 {
+		errs.add("drills.samples", "must be at least 1")
+	}
+	if cfg.Drills.MaxFileSize < 0 {
+		errs.add("drills.max_file_size", "must not be negative")
+	}
+
+	if export := cfg.Metrics.Export; export.Enabled {
+		switch export.Format {
+		case "statsd", "graphite", "influx":
+		default:
+			errs.add("metrics.export.format", "unsupported format '%s', expected statsd, graphite or influx", export.Format)
+		}
+		switch export.Protocol {
+		case "udp", "tcp":
+		default:
+			errs.add("metrics.export.protocol", "unsupported protocol '%s', expected udp or tcp", export.Protocol)
+		}
+		if export.Address == "" {
+			errs.add("metrics.export.address", "address is required")
+		}
+		errs.duration("metrics.export.interval", export.Interval, true)
+	}
+
+	if endpoint := cfg.Telemetry.Endpoint; endpoint != "" {
+		if u, err := url.Parse(endpoint); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			errs.add("telemetry.endpoint", "invalid endpoint '%s', expected an http or https url", endpoint)
+		}
+	}
+
+	for i, webhook := range cfg.Webhooks {
+		path := fmt.Sprintf("webhooks[%d]", i)
+		if webhook.URL == "" {
+			errs.add(path+".url", "url is required")
+		}
+		errs.duration(path+".timeout", webhook.Timeout, false)
+		if webhook.MaxRetries < 0 {
+			errs.add(path+".max_retries", "must not be negative")
+		}
+	}
+
+	names := make(map[string]bool)
+	for i, indexer := range cfg.Indexers {
+		path := fmt.Sprintf("indexers[%d]", i)
+		if indexer.Name == "" {
+			errs.add(path+".name", "name is required")
+		} else if names[indexer.Name] {
+			errs.add(path+".name", "duplicate name '%s'", indexer.Name)
+		}
+		names[indexer.Name] = true
+
+		switch indexer.Type {
+		case "elasticsearch", "meilisearch", "typesense":
+		default:
+			errs.add(path+".type", "unsupported type '%s', expected elasticsearch, meilisearch or typesense", indexer.Type)
+		}
+		if indexer.URL == "" {
+			errs.add(path+".url", "url is required")
+		}
+		if indexer.Index == "" {
+			errs.add(path+".index", "index is required")
+		}
+		if indexer.MaxTextSize < 0 {
+			errs.add(path+".max_text_size", "must not be negative")
+		}
+		if indexer.BatchSize < 0 {
+			errs.add(path+".batch_size", "must not be negative")
+		}
+		errs.duration(path+".interval", indexer.Interval, false)
+		errs.duration(path+".timeout", indexer.Timeout, false)
+	}
+
+	return errs
+}
+
+func validateLog(errs *ValidationErrors, cfg LogServerConfig) {
+	switch strings.ToUpper(cfg.Level) {
+	case "DEBUG", "INFO", "WARN", "ERROR", "FATAL":
+	default:
+		errs.add("log.level", "unsupported level '%s', expected debug, info, warn, error or fatal", cfg.Level)
+	}
+	if cfg.TimeFormat == "" {
+		errs.add("log.time_format", "time format is required")
+	}
+
+	for i, output := range cfg.Outputs {
+		path := fmt.Sprintf("log.outputs[%d]", i)
+
+		switch output.Type {
+		case "stdout", "journald":
+		case "file":
+			if output.Path == "" && cfg.File == "" {
+				errs.add(path+".path", "path is required, since log.file isn't set")
+			}
+		case "syslog":
+			switch output.Network {
+			case "udp", "tcp", "unix":
+			default:
+				errs.add(path+".network", "unsupported network '%s', expected udp, tcp or unix", output.Network)
+			}
+			if output.Address == "" {
+				errs.add(path+".address", "address is required")
+			}
+		default:
+			errs.add(path+".type", "unsupported type '%s', expected stdout, file, syslog or journald", output.Type)
+		}
+	}
+}
+
+// duration reports values that can't be parsed as duration, which are only allowed to be empty if optional
+func (e *ValidationErrors) duration(path, value string, required bool) {
+	if value == "" {
+		if required {
+			e.add(path, "duration is required")
+		}
+		return
+	}
+
+	if d, err := time.ParseDuration(value); err != nil {
+		e.add(path, "invalid duration '%s', expected e.g. '30s' or '5m'", value)
+	} else if d <= 0 {
+		e.add(path, "duration must be positive")
+	}
+}
+
+// unknownKeys reports all settings without a matching field in the configuration type t
+func unknownKeys(errs *ValidationErrors, settings map[string]any, t reflect.Type, prefix string) {
+	fields := make(map[string]reflect.Type)
+	for i := 0; i < t.NumField(); i++ {
+		name, _, _ := strings.Cut(t.Field(i).Tag.Get("mapstructure"), ",")
+		if name != "" {
+			fields[name] = t.Field(i).Type
+		}
+	}
+
+	keys := make([]string, 0, len(settings))
+	for key := range settings {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	for _, key := range keys {
+		path := key
+		if prefix != "" {
+			path = prefix + "." + key
+		}
+
+		fieldType, ok := fields[strings.ToLower(key)]
+		if !ok {
+			errs.add(path, "unknown key")
+			continue
+		}
+
+		switch value := settings[key].(type) {
+		case map[string]any:
+			if fieldType.Kind() == reflect.Struct {
+				unknownKeys(errs, value, fieldType, path)
+			}
+		case []any:
+			if fieldType.Kind() == reflect.Slice && fieldType.Elem().Kind() == reflect.Struct {
+				for i, item := range value {
+					if m, ok := item.(map[string]any); ok {
+						unknownKeys(errs, m, fieldType.Elem(), fmt.Sprintf("%s[%d]", path, i))
+					}
+				}
+			}
+		}
+	}
+}
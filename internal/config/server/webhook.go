@@ -0,0 +1,16 @@
+package server
+
+// WebhookServerConfig holds configuration for a webhook notified about sync events
+type WebhookServerConfig struct {
+	URL string `mapstructure:"url" yaml:"url"`
+	// Events sent to the webhook, e.g. "sync.finished" (all events if empty)
+	Events []string `mapstructure:"events" yaml:"events"`
+	// Go template of the request body rendered with the event (JSON encoded event if empty)
+	Template string `mapstructure:"template" yaml:"template"`
+	// Secret used to sign the body with HMAC-SHA256 in the X-GoSync-Signature header (unsigned if empty)
+	Secret  string            `mapstructure:"secret" yaml:"secret"`
+	Headers map[string]string `mapstructure:"headers" yaml:"headers"`
+	Timeout string            `mapstructure:"timeout" yaml:"timeout"`
+	// Number of retries with exponential backoff after failed deliveries
+	MaxRetries int `mapstructure:"max_retries" yaml:"max_retries"`
+}
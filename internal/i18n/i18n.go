@@ -0,0 +1,188 @@
+package i18n
+
+import (
+	"embed"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// DefaultLocale is used if no locale is configured and for messages missing in the selected catalog
+const DefaultLocale = "en"
+
+// locales contains one JSON catalog per locale, e.g. "de.json", mapping message keys to printf formats.
+// Translations are added by placing a new catalog next to the existing ones.
+//
+//go:embed locales/*.json
+var locales embed.FS
+
+var (
+	mutex   sync.RWMutex
+	current = DefaultLocale
+
+	loadOnce sync.Once
+	catalogs map[string]map[string]string
+	loadErr  error
+)
+
+// load parses all embedded catalogs once
+func load() error {
+	loadOnce.Do(func() {
+		catalogs, loadErr = parse()
+	})
+	return loadErr
+}
+
+func parse() (map[string]map[string]string, error) {
+	entries, err := locales.ReadDir("locales")
+	if err != nil {
+		return nil, fmt.Errorf("failed to read catalogs: %w", err)
+	}
+
+	loaded := make(map[string]map[string]string, len(entries))
+	for _, entry := range entries {
+		data, err := locales.ReadFile(path.Join("locales", entry.Name()))
+		if err != nil {
+			return nil, fmt.Errorf("failed to read catalog '%s': %w", entry.Name(), err)
+		}
+
+		var catalog map[string]string
+		if err := json.Unmarshal(data, &catalog); err != nil {
+			return nil, fmt.Errorf("failed to parse catalog '%s': %w", entry.Name(), err)
+		}
+		loaded[strings.TrimSuffix(entry.Name(), ".json")] = catalog
+	}
+
+	return loaded, nil
+}
+
+// Available returns all locales with a catalog
+func Available() []string {
+	if err := load(); err != nil {
+		return []string{DefaultLocale}
+	}
+
+	result := make([]string, 0, len(catalogs))
+	for locale := range catalogs {
+		result = append(result, locale)
+	}
+	sort.Strings(result)
+	return result
+}
+
+// Locale returns the selected locale
+func Locale() string {
+	mutex.RLock()
+	defer mutex.RUnlock()
+
+	return current
+}
+
+// SetLocale selects the catalog used for all messages, e.g. "de" or "de_DE.UTF-8"
+func SetLocale(locale string) error {
+	if err := load(); err != nil {
+		return err
+	}
+
+	normalized := normalize(locale)
+	if _, ok := catalogs[normalized]; !ok {
+		return fmt.Errorf("unsupported locale '%s'", locale)
+	}
+
+	mutex.Lock()
+	defer mutex.Unlock()
+
+	current = normalized
+	return nil
+}
+
+// Detect selects the configured locale, or the locale of the environment (LC_ALL, LC_MESSAGES, LANG)
+// if none is configured. Unsupported environment locales fall back to the default locale.
+func Detect(configured string) error {
+	if configured != "" {
+		return SetLocale(configured)
+	}
+
+	for _, name := range []string{"LC_ALL", "LC_MESSAGES", "LANG"} {
+		if value := os.Getenv(name); value != "" {
+			if err := SetLocale(value); err != nil {
+				return SetLocale(DefaultLocale)
+			}
+			return nil
+		}
+	}
+
+	return SetLocale(DefaultLocale)
+}
+
+// normalize reduces locales like "de_DE.UTF-8" or "de-AT" to their language
+func normalize(locale string) string {
+	locale = strings.ToLower(locale)
+	if i := strings.IndexAny(locale, "_-.@"); i >= 0 {
+		locale = locale[:i]
+	}
+	if locale == "c" || locale == "posix" {
+		return DefaultLocale
+	}
+	return locale
+}
+
+// T returns the message of the key in the selected locale, formatted with the args.
+// Missing messages fall back to the default locale and finally to the key itself.
+func T(key string, args ...any) string {
+	format := lookup(key)
+	if len(args) == 0 {
+		return format
+	}
+	return fmt.Sprintf(format, args...)
+}
+
+// Error is returned by Errorf and keeps the key of its message
+type Error struct {
+	Key string
+	err error
+}
+
+func (e *Error) Error() string {
+	return e.err.Error()
+}
+
+func (e *Error) Unwrap() error {
+	return e.err
+}
+
+// Errorf returns an error with the message of the key, supporting %w like fmt.Errorf
+func Errorf(key string, args ...any) error {
+	if len(args) == 0 {
+		return &Error{Key: key, err: errors.New(lookup(key))}
+	}
+	return &Error{Key: key, err: fmt.Errorf(lookup(key), args...)}
+}
+
+// Key returns the message key of the outermost error returned by Errorf within the chain of err, if any
+func Key(err error) string {
+	var e *Error
+	if errors.As(err, &e) {
+		return e.Key
+	}
+	return ""
+}
+
+func lookup(key string) string {
+	if err := load(); err != nil {
+		return key
+	}
+
+	if format, ok := catalogs[Locale()][key]; ok {
+		return format
+	}
+	if format, ok := catalogs[DefaultLocale][key]; ok {
+		return format
+	}
+	return key
+}
@@ -0,0 +1,282 @@
+// Package telemetry records anonymous usage of the CLI if the user opted in. Events only contain the invoked
+// command, its duration and the class of its error, never arguments, paths or credentials. They are queued
+// locally and only sent if an endpoint is configured, so self-hosters may collect them with their own service.
+package telemetry
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"runtime"
+	"time"
+)
+
+const (
+	// settingsFile stores whether telemetry is enabled and the anonymous id of the installation
+	settingsFile = "telemetry.json"
+	// queueFile contains one JSON encoded event per line
+	queueFile = "telemetry-queue.jsonl"
+	// maxQueued limits the queue, dropping the oldest events if no endpoint accepts them
+	maxQueued = 1000
+	// FlushBatch is the number of queued events sent at once
+	FlushBatch = 50
+)
+
+// Settings are stored per user and only changed by 'gosync telemetry enable/disable'
+type Settings struct {
+	Enabled bool `json:"enabled"`
+	// ID identifies the installation without relation to the user or machine
+	ID        string    `json:"id,omitempty"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+// Event is the usage of a single command
+type Event struct {
+	Command  string `json:"command"`
+	Duration int64  `json:"duration_ms"`
+	// Error is the class of the error returned by the command, empty if it succeeded
+	Error   string `json:"error,omitempty"`
+	Version string `json:"version"`
+	OS      string `json:"os"`
+	Arch    string `json:"arch"`
+	// Time is truncated to the hour, so events can't be correlated with other activity
+	Time time.Time `json:"time"`
+}
+
+// Batch is the body sent to the endpoint
+type Batch struct {
+	ID     string  `json:"id"`
+	Events []Event `json:"events"`
+}
+
+// Dir returns the directory of the settings and the queue
+func Dir() (string, error) {
+	dir, err := os.UserConfigDir()
+	if err != nil {
+		return "", fmt.Errorf("failed to find the configuration directory: %w", err)
+	}
+	return filepath.Join(dir, "gosync"), nil
+}
+
+// QueuePath returns the file of the queued events
+func QueuePath() (string, error) {
+	dir, err := Dir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, queueFile), nil
+}
+
+// Suppressed returns true if the environment opts out of telemetry regardless of the settings
+func Suppressed() bool {
+	if v := os.Getenv("DO_NOT_TRACK"); v != "" && v != "0" {
+		return true
+	}
+	switch os.Getenv("GOSYNC_TELEMETRY") {
+	case "0", "off", "false":
+		return true
+	}
+	return false
+}
+
+// Load returns the settings, which are disabled if they were never saved
+func Load() (*Settings, error) {
+	dir, err := Dir()
+	if err != nil {
+		return nil, err
+	}
+
+	data, err := os.ReadFile(filepath.Join(dir, settingsFile))
+	if errors.Is(err, os.ErrNotExist) {
+		return &Settings{}, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read telemetry settings: %w", err)
+	}
+
+	settings := &Settings{}
+	if err := json.Unmarshal(data, settings); err != nil {
+		return nil, fmt.Errorf("failed to decode telemetry settings: %w", err)
+	}
+	return settings, nil
+}
+
+// SetEnabled saves the choice of the user. Enabling creates a new anonymous id, while disabling
+// removes the id and all queued events.
+func SetEnabled(enabled bool) (*Settings, error) {
+	dir, err := Dir()
+	if err != nil {
+		return nil, err
+	}
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return nil, fmt.Errorf("failed to create '%s': %w", dir, err)
+	}
+
+	settings, err := Load()
+	if err != nil {
+		return nil, err
+	}
+	settings.Enabled = enabled
+	settings.UpdatedAt = time.Now().UTC()
+
+	if enabled && settings.ID == "" {
+		id := make([]byte, 16)
+		if _, err := rand.Read(id); err != nil {
+			return nil, fmt.Errorf("failed to create telemetry id: %w", err)
+		}
+		settings.ID = hex.EncodeToString(id)
+	}
+	if !enabled {
+		settings.ID = ""
+		if err := os.Remove(filepath.Join(dir, queueFile)); err != nil && !errors.Is(err, os.ErrNotExist) {
+			return nil, fmt.Errorf("failed to remove queued events: %w", err)
+		}
+	}
+
+	data, err := json.MarshalIndent(settings, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+	if err := os.WriteFile(filepath.Join(dir, settingsFile), data, 0600); err != nil {
+		return nil, fmt.Errorf("failed to write telemetry settings: %w", err)
+	}
+	return settings, nil
+}
+
+// NewEvent creates the event of a command invoked at started
+func NewEvent(command, version string, started time.Time, class string) Event {
+	return Event{
+		Command:  command,
+		Duration: time.Since(started).Milliseconds(),
+		Error:    class,
+		Version:  version,
+		OS:       runtime.GOOS,
+		Arch:     runtime.GOARCH,
+		Time:     started.UTC().Truncate(time.Hour),
+	}
+}
+
+// Record appends the event to the queue, dropping the oldest events beyond maxQueued, and returns the number
+// of queued events
+func Record(event Event) (int, error) {
+	events, err := Queued()
+	if err != nil {
+		return 0, err
+	}
+	events = append(events, event)
+	if len(events) > maxQueued {
+		events = events[len(events)-maxQueued:]
+	}
+	return len(events), writeQueue(events)
+}
+
+// Queued returns all events waiting to be sent, the oldest first
+func Queued() ([]Event, error) {
+	path, err := QueuePath()
+	if err != nil {
+		return nil, err
+	}
+
+	file, err := os.Open(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read queued events: %w", err)
+	}
+	defer file.Close()
+
+	var events []Event
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		var event Event
+		// Lines that can't be decoded, e.g. after a crash while writing, are dropped
+		if err := json.Unmarshal(scanner.Bytes(), &event); err == nil {
+			events = append(events, event)
+		}
+	}
+	return events, scanner.Err()
+}
+
+// Flush sends the queued events to the endpoint in batches and removes all accepted ones from the queue
+func Flush(ctx context.Context, endpoint, id string) (int, error) {
+	events, err := Queued()
+	if err != nil {
+		return 0, err
+	}
+
+	sent := 0
+	for sent < len(events) {
+		batch := events[sent:min(sent+FlushBatch, len(events))]
+		if err := send(ctx, endpoint, Batch{ID: id, Events: batch}); err != nil {
+			if sent > 0 {
+				if werr := writeQueue(events[sent:]); werr != nil {
+					return sent, werr
+				}
+			}
+			return sent, err
+		}
+		sent += len(batch)
+	}
+	return sent, writeQueue(nil)
+}
+
+// send posts the batch as JSON to the endpoint
+func send(ctx context.Context, endpoint string, batch Batch) error {
+	body, err := json.Marshal(batch)
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, endpoint, bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("invalid telemetry endpoint '%s': %w", endpoint, err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to send events: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode/100 != 2 {
+		return fmt.Errorf("failed to send events: endpoint responded with %s", resp.Status)
+	}
+	return nil
+}
+
+// writeQueue replaces the queue with the events, removing it if there are none
+func writeQueue(events []Event) error {
+	path, err := QueuePath()
+	if err != nil {
+		return err
+	}
+
+	if len(events) == 0 {
+		if err := os.Remove(path); err != nil && !errors.Is(err, os.ErrNotExist) {
+			return fmt.Errorf("failed to clear queued events: %w", err)
+		}
+		return nil
+	}
+
+	var buf bytes.Buffer
+	enc := json.NewEncoder(&buf)
+	for _, event := range events {
+		if err := enc.Encode(event); err != nil {
+			return err
+		}
+	}
+	if err := os.WriteFile(path, buf.Bytes(), 0600); err != nil {
+		return fmt.Errorf("failed to queue events: %w", err)
+	}
+	return nil
+}
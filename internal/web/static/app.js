@@ -0,0 +1,307 @@
+'use strict';
+
+// The dashboard only reads the API of the agent serving it, authenticating with the token entered by the user
+const tokenKey = 'gosync-token';
+const refreshInterval = 5000;
+
+class Unauthorized extends Error {}
+
+async function api(path) {
+  const headers = {};
+  const token = sessionStorage.getItem(tokenKey);
+  if (token) {
+    headers.Authorization = 'Bearer ' + token;
+  }
+
+  const resp = await fetch(path, { headers });
+  if (resp.status === 401) {
+    throw new Unauthorized();
+  }
+  if (!resp.ok) {
+    const body = await resp.json().catch(() => ({}));
+    throw new Error(body.error || 'agent responded with status ' + resp.status);
+  }
+  return resp.json();
+}
+
+// el creates an element with the text or child elements
+function el(tag, content, className) {
+  const e = document.createElement(tag);
+  if (className) {
+    e.className = className;
+  }
+  for (const child of [].concat(content ?? [])) {
+    e.append(child instanceof Node ? child : String(child));
+  }
+  return e;
+}
+
+function row(cells) {
+  return el('tr', cells.map((cell) => (cell instanceof Node && cell.tagName === 'TD' ? cell : el('td', cell))));
+}
+
+function number(value) {
+  return el('td', value, 'number');
+}
+
+function fill(id, rows, columns, emptyText) {
+  const body = document.getElementById(id);
+  body.replaceChildren(...rows);
+  if (rows.length === 0) {
+    const cell = el('td', emptyText, 'empty');
+    cell.colSpan = columns;
+    body.append(el('tr', cell));
+  }
+}
+
+function formatSize(bytes) {
+  const units = ['B', 'K', 'M', 'G', 'T', 'P'];
+  let value = bytes;
+  let unit = 0;
+  while (value >= 1024 && unit < units.length - 1) {
+    value /= 1024;
+    unit++;
+  }
+  return (unit === 0 ? value : value.toFixed(1)) + units[unit];
+}
+
+function formatTime(value) {
+  if (!value || value.startsWith('0001-')) {
+    return '-';
+  }
+  return new Date(value).toLocaleString();
+}
+
+function formatDuration(nanoseconds) {
+  return (nanoseconds / 1e6).toFixed(0) + 'ms';
+}
+
+function banner(text, isError) {
+  const e = document.getElementById('banner');
+  e.hidden = !text;
+  e.textContent = text || '';
+  e.classList.toggle('error', Boolean(isError));
+}
+
+async function showSyncs() {
+  const status = await api('/v1/status');
+  document.getElementById('agent').textContent = status.client_id + ' · ' + status.version;
+  if (status.maintenance && status.maintenance.enabled) {
+    banner('Maintenance mode: ' + (status.maintenance.reason || 'no changes are applied'));
+  }
+
+  fill('running', (status.syncs || []).map((p) => {
+    const progress = el('progress');
+    progress.max = p.bytes > 0 ? p.bytes : Math.max(p.actions, 1);
+    progress.value = p.bytes > 0 ? p.bytes_done : p.completed + p.failed;
+    const active = (p.active || []).map((t) => t.type + ' ' + t.path).join(', ');
+    return row([p.name, p.phase, number(p.completed + '/' + p.actions), progress, el('td', active || '-', 'wrap')]);
+  }), 5, 'No sync is running');
+
+  fill('scheduled', (status.scheduled || []).map((s) => {
+    const last = s.last_run;
+    if (!last) {
+      return row([s.name, formatTime(s.next_run), '-', '', '', '', '']);
+    }
+    const transfers = last.uploaded + last.downloaded + last.deleted;
+    return row([
+      s.name,
+      formatTime(s.next_run) + (s.waiting ? ' (waiting)' : ''),
+      formatTime(last.finished_at),
+      number(transfers + ' (' + formatSize(last.bytes) + ')'),
+      number(last.conflicts),
+      el('td', last.failed, last.failed > 0 ? 'number error' : 'number'),
+      el('td', last.error || '', 'wrap error'),
+    ]);
+  }), 7, 'No sync is scheduled');
+
+  fill('errors', (status.errors || []).map((e) => row([
+    formatTime(e.time), e.sync, el('td', e.path || '', 'wrap'), el('td', e.error, 'wrap error'),
+  ])), 4, 'No recent errors');
+}
+
+async function showHistory() {
+  const activity = await api('/v1/activity?days=30');
+
+  const days = [];
+  const bytes = new Map();
+  const today = new Date();
+  for (let i = 29; i >= 0; i--) {
+    const day = new Date(Date.UTC(today.getUTCFullYear(), today.getUTCMonth(), today.getUTCDate() - i));
+    const key = day.toISOString().slice(0, 10);
+    days.push(key);
+    bytes.set(key, 0);
+  }
+  for (const a of activity) {
+    if (bytes.has(a.day)) {
+      bytes.set(a.day, bytes.get(a.day) + a.bytes);
+    }
+  }
+  drawChart(days, days.map((day) => bytes.get(day)));
+
+  fill('activity', activity.slice().reverse().map((a) => row([
+    a.day, a.sync, number(a.passes), number(a.added), number(a.changed), number(a.deleted),
+    el('td', a.conflicts, a.conflicts > 0 ? 'number warn' : 'number'),
+    el('td', a.errors, a.errors > 0 ? 'number error' : 'number'),
+    number(formatSize(a.bytes)),
+  ])), 9, 'No activity was recorded yet');
+}
+
+function drawChart(labels, values) {
+  const svg = document.getElementById('chart');
+  const ns = 'http://www.w3.org/2000/svg';
+  const width = 900;
+  const height = 240;
+  const bottom = 20;
+  const peak = Math.max(...values, 1);
+  const slot = width / values.length;
+
+  const children = [];
+  values.forEach((value, i) => {
+    const h = (value / peak) * (height - bottom - 16);
+    const bar = document.createElementNS(ns, 'rect');
+    bar.setAttribute('x', i * slot + 2);
+    bar.setAttribute('y', height - bottom - h);
+    bar.setAttribute('width', slot - 4);
+    bar.setAttribute('height', h);
+    const title = document.createElementNS(ns, 'title');
+    title.textContent = labels[i] + ': ' + formatSize(value);
+    bar.append(title);
+    children.push(bar);
+
+    if (i % 5 === 0) {
+      const label = document.createElementNS(ns, 'text');
+      label.setAttribute('x', i * slot + 2);
+      label.setAttribute('y', height - 5);
+      label.textContent = labels[i].slice(5);
+      children.push(label);
+    }
+  });
+
+  const peakLabel = document.createElementNS(ns, 'text');
+  peakLabel.setAttribute('x', 2);
+  peakLabel.setAttribute('y', 12);
+  peakLabel.textContent = formatSize(peak);
+  children.push(peakLabel);
+  svg.replaceChildren(...children);
+}
+
+async function showConflicts() {
+  const files = await api('/v1/files?glob=' + encodeURIComponent('*.conflict-*') + '&sort=modified&order=desc&limit=1000');
+  fill('conflict-copies', files.map((f) => row([
+    el('td', browseLink(f.path), 'wrap'), number(formatSize(f.size)), formatTime(f.modified_at),
+  ])), 3, 'No conflicts are awaiting resolution');
+}
+
+async function showBackends() {
+  const [status, usage] = await Promise.all([api('/v1/status'), api('/v1/usage')]);
+  const usages = new Map((usage.entries || []).map((u) => [u.path, u]));
+
+  fill('backend-health', (status.backends || []).map((b) => {
+    const u = usages.get(b.id) || { objects: 0, bytes: 0 };
+    let quota = '-';
+    let quotaClass = 'number';
+    if (u.quota_hard > 0 || u.quota_soft > 0) {
+      const limit = u.quota_hard || u.quota_soft;
+      quota = Math.round((u.bytes / limit) * 100) + '% of ' + formatSize(limit);
+      if (u.quota_hard > 0 && u.bytes >= u.quota_hard) {
+        quotaClass = 'number error';
+      } else if (u.quota_soft > 0 && u.bytes >= u.quota_soft) {
+        quotaClass = 'number warn';
+      }
+    }
+    return row([
+      b.name && b.name !== b.id ? b.id + ' (' + b.name + ')' : b.id,
+      el('td', b.healthy ? 'healthy' : b.error || 'unhealthy', b.healthy ? 'ok' : 'wrap error'),
+      number(formatDuration(b.latency)),
+      formatTime(b.checked_at),
+      number(u.objects),
+      number(formatSize(u.bytes)),
+      el('td', quota, quotaClass),
+    ]);
+  }), 7, 'No backends are registered');
+}
+
+function browseLink(path) {
+  const link = el('a', path);
+  link.href = '#files/' + path.split('/').map(encodeURIComponent).join('/');
+  return link;
+}
+
+async function showFiles(path) {
+  const entries = await api('/v1/vfs?path=' + encodeURIComponent(path));
+
+  const crumbs = [browseLink('')];
+  crumbs[0].textContent = 'Backends';
+  const parts = path ? path.split('/') : [];
+  parts.forEach((part, i) => {
+    const link = browseLink(parts.slice(0, i + 1).join('/'));
+    link.textContent = part;
+    crumbs.push(' / ', link);
+  });
+  document.getElementById('breadcrumbs').replaceChildren(...crumbs);
+
+  fill('entries', entries.map((e) => {
+    const target = path ? path + '/' + e.name : e.name;
+    const name = e.dir ? browseLink(target) : el('span', e.name);
+    if (e.dir) {
+      name.textContent = e.name + '/';
+    }
+    return row([el('td', name, 'wrap'), number(formatSize(e.size)), formatTime(e.modified_at), e.locked_by || '']);
+  }), 4, 'This directory is empty');
+}
+
+const views = {
+  syncs: showSyncs,
+  history: showHistory,
+  conflicts: showConflicts,
+  backends: showBackends,
+  files: showFiles,
+};
+
+let timer;
+
+async function render() {
+  clearTimeout(timer);
+
+  const [view, ...rest] = location.hash.slice(1).split('/');
+  const name = views[view] ? view : 'syncs';
+  const path = rest.map(decodeURIComponent).filter(Boolean).join('/');
+
+  for (const section of document.querySelectorAll('main section')) {
+    section.hidden = section.id !== name;
+  }
+  for (const link of document.querySelectorAll('nav a')) {
+    link.classList.toggle('active', link.getAttribute('href') === '#' + name);
+  }
+
+  try {
+    banner('');
+    await views[name](path);
+    document.getElementById('login').hidden = true;
+    document.querySelector('main').hidden = false;
+  } catch (err) {
+    if (err instanceof Unauthorized) {
+      sessionStorage.removeItem(tokenKey);
+      document.getElementById('login').hidden = false;
+      document.querySelector('main').hidden = true;
+      return;
+    }
+    banner(err.message, true);
+  }
+
+  // Running passes change quickly, the other views are only refreshed on navigation
+  if (name === 'syncs' || name === 'backends') {
+    timer = setTimeout(render, refreshInterval);
+  }
+}
+
+document.getElementById('login').addEventListener('submit', (event) => {
+  event.preventDefault();
+  sessionStorage.setItem(tokenKey, event.target.token.value);
+  event.target.reset();
+  render();
+});
+
+window.addEventListener('hashchange', render);
+render();
@@ -0,0 +1,160 @@
+package auth
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/mwantia/gosync/pkg/db/models"
+	"github.com/mwantia/gosync/pkg/db/store"
+)
+
+// TokenPrefix is prepended to all tokens, so leaked tokens can be recognized e.g. by secret scanners
+const TokenPrefix = "gst_"
+
+// lastUsedInterval limits how often the last use of a token is written to the metadata store
+const lastUsedInterval = time.Minute
+
+// ErrInvalidToken is returned for unknown, expired or revoked tokens
+var ErrInvalidToken = errors.New("invalid token")
+
+// ErrTokenExists is returned when creating a token with the name of an existing token
+var ErrTokenExists = errors.New("token already exists")
+
+// Scope limits the API endpoints a token may access, with each scope including all lower scopes
+type Scope string
+
+const (
+	// ScopeReadOnly allows querying the status of the agent
+	ScopeReadOnly Scope = "read-only"
+	// ScopeSyncControl additionally allows running and refreshing syncs and changing tags
+	ScopeSyncControl Scope = "sync-control"
+	// ScopeAdmin allows all requests, including changes of the maintenance mode
+	ScopeAdmin Scope = "admin"
+)
+
+var scopeLevels = map[Scope]int{
+	ScopeReadOnly:    1,
+	ScopeSyncControl: 2,
+	ScopeAdmin:       3,
+}
+
+// ParseScope returns the scope with the name
+func ParseScope(name string) (Scope, error) {
+	scope := Scope(name)
+	if _, ok := scopeLevels[scope]; !ok {
+		return "", fmt.Errorf("unsupported scope '%s', expected %s, %s or %s", name, ScopeReadOnly, ScopeSyncControl, ScopeAdmin)
+	}
+	return scope, nil
+}
+
+// Allows returns true if the scope includes the required scope
+func (s Scope) Allows(required Scope) bool {
+	level, ok := scopeLevels[s]
+	return ok && level >= scopeLevels[required]
+}
+
+// Hash returns the hash of the token stored within the metadata store
+func Hash(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+// Tokens manages the API tokens stored within the metadata store
+type Tokens struct {
+	store store.MetadataStore
+}
+
+// NewTokens creates a token manager for the metadata store
+func NewTokens(ms store.MetadataStore) *Tokens {
+	return &Tokens{
+		store: ms,
+	}
+}
+
+// Create generates a new token and returns it together with its record.
+// The token itself isn't stored and can't be shown again.
+func (t *Tokens) Create(ctx context.Context, name string, scope Scope, ttl time.Duration) (string, *models.APIToken, error) {
+	if _, err := ParseScope(string(scope)); err != nil {
+		return "", nil, err
+	}
+
+	if _, err := t.store.GetAPIToken(ctx, name); err == nil {
+		return "", nil, fmt.Errorf("%w: '%s'", ErrTokenExists, name)
+	} else if !errors.Is(err, store.ErrNotFound) {
+		return "", nil, fmt.Errorf("failed to check token '%s': %w", name, err)
+	}
+
+	secret := make([]byte, 24)
+	if _, err := rand.Read(secret); err != nil {
+		return "", nil, fmt.Errorf("failed to generate token: %w", err)
+	}
+	token := TokenPrefix + hex.EncodeToString(secret)
+
+	record := &models.APIToken{
+		Name:   name,
+		Hash:   Hash(token),
+		Prefix: token[:len(TokenPrefix)+8],
+		Scope:  string(scope),
+	}
+	if ttl > 0 {
+		expiresAt := time.Now().UTC().Add(ttl)
+		record.ExpiresAt = &expiresAt
+	}
+
+	if err := t.store.CreateAPIToken(ctx, record); err != nil {
+		return "", nil, fmt.Errorf("failed to create token '%s': %w", name, err)
+	}
+	return token, record, nil
+}
+
+// Revoke invalidates the token with the name, which is kept for auditing
+func (t *Tokens) Revoke(ctx context.Context, name string) error {
+	record, err := t.store.GetAPIToken(ctx, name)
+	if err != nil {
+		return fmt.Errorf("failed to find token '%s': %w", name, err)
+	}
+	if record.RevokedAt != nil {
+		return nil
+	}
+
+	now := time.Now().UTC()
+	record.RevokedAt = &now
+	if err := t.store.UpdateAPIToken(ctx, record); err != nil {
+		return fmt.Errorf("failed to revoke token '%s': %w", name, err)
+	}
+	return nil
+}
+
+// List returns all tokens, including expired and revoked tokens
+func (t *Tokens) List(ctx context.Context) ([]models.APIToken, error) {
+	return t.store.ListAPITokens(ctx)
+}
+
+// Authenticate returns the scope of the token, or ErrInvalidToken if it is unknown, expired or revoked
+func (t *Tokens) Authenticate(ctx context.Context, token string) (Scope, error) {
+	record, err := t.store.GetAPITokenByHash(ctx, Hash(token))
+	if err != nil {
+		if errors.Is(err, store.ErrNotFound) {
+			return "", ErrInvalidToken
+		}
+		return "", fmt.Errorf("failed to find token: %w", err)
+	}
+
+	now := time.Now().UTC()
+	if record.RevokedAt != nil || (record.ExpiresAt != nil && now.After(*record.ExpiresAt)) {
+		return "", ErrInvalidToken
+	}
+
+	if record.LastUsedAt == nil || now.Sub(*record.LastUsedAt) >= lastUsedInterval {
+		record.LastUsedAt = &now
+		if err := t.store.UpdateAPIToken(ctx, record); err != nil {
+			return "", fmt.Errorf("failed to update token '%s': %w", record.Name, err)
+		}
+	}
+	return Scope(record.Scope), nil
+}
@@ -0,0 +1,18 @@
+package backend
+
+import (
+	"context"
+
+	"github.com/mwantia/gosync/pkg/db/models"
+	"github.com/mwantia/gosync/pkg/db/store"
+	"github.com/mwantia/gosync/pkg/storage"
+)
+
+// CompressedFile returns the record of the object if its current version is stored compressed, or nil otherwise
+func CompressedFile(ctx context.Context, ms store.MetadataStore, b *models.Backend, key string, stat *storage.ObjectInfo) *models.File {
+	record, err := ms.GetFile(ctx, b.ID, key)
+	if err != nil || record.Compression == "" || record.ETag != stat.ETag {
+		return nil
+	}
+	return record
+}
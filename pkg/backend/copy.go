@@ -0,0 +1,413 @@
+package backend
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"path"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/mwantia/gosync/pkg/compress"
+	"github.com/mwantia/gosync/pkg/db/models"
+	"github.com/mwantia/gosync/pkg/db/store"
+	"github.com/mwantia/gosync/pkg/dedup"
+	"github.com/mwantia/gosync/pkg/publish"
+	"github.com/mwantia/gosync/pkg/storage"
+	"github.com/mwantia/gosync/pkg/vfs"
+)
+
+// DefaultCopyWorkers is the number of files copied at once if no workers are configured
+const DefaultCopyWorkers = 4
+
+// CopyEndpoint is the source or destination of a copy
+type CopyEndpoint struct {
+	Storage storage.Storage
+	// Backend is nil for local directories
+	Backend *models.Backend
+}
+
+// CopyItem is a single planned file of a copy
+type CopyItem struct {
+	From string
+	To   string
+	Size int64
+}
+
+// CopyTransfer is a file currently copied
+type CopyTransfer struct {
+	Path      string
+	Size      int64
+	BytesDone int64
+}
+
+// CopyProgress reports the state of a running copy
+type CopyProgress struct {
+	Copied     int
+	Total      int
+	Bytes      int64
+	TotalBytes int64
+	// Active contains the files currently copied, ordered by their path
+	Active []CopyTransfer
+}
+
+// CopyOptions configures how a copy is applied
+type CopyOptions struct {
+	// Move removes each source file once it was copied, files of backends go through their trash
+	Move bool
+	// Workers copy files at once (DefaultCopyWorkers if 0)
+	Workers int
+	// Progress is called whenever a file was copied and at least every second while files are copied (may be nil)
+	Progress func(CopyProgress)
+}
+
+// Copier copies or moves files between backends and local directories. Files within the same backend are copied
+// server-side, all other files are streamed by a queue of workers. The metadata of files written to backends is
+// recorded like the files written by sync passes.
+type Copier struct {
+	store store.MetadataStore
+	from  CopyEndpoint
+	to    CopyEndpoint
+}
+
+// NewCopier creates a new copier between the endpoints, which may be the same
+func NewCopier(ms store.MetadataStore, from, to CopyEndpoint) *Copier {
+	return &Copier{
+		store: ms,
+		from:  from,
+		to:    to,
+	}
+}
+
+// Plan returns the files copied from the key to the destination key. Directories are copied with all their files,
+// which requires recursive. With into, the file or directory is copied into the destination directory, keeping its name.
+func (c *Copier) Plan(ctx context.Context, fromKey, toKey string, recursive, into bool) ([]CopyItem, error) {
+	target := toKey
+	if into && fromKey != "" {
+		target = path.Join(toKey, path.Base(fromKey))
+	}
+	if c.sameBackend() && (target == fromKey || fromKey == "" || strings.HasPrefix(target, fromKey+"/")) {
+		return nil, fmt.Errorf("unable to copy '%s' to '%s', the destination is the same or within the source", fromKey, target)
+	}
+
+	if fromKey != "" {
+		stat, err := c.from.Storage.Stat(ctx, fromKey)
+		if err == nil {
+			return []CopyItem{{From: fromKey, To: target, Size: stat.Size}}, nil
+		}
+		if !errors.Is(err, storage.ErrObjectNotFound) {
+			return nil, fmt.Errorf("failed to stat '%s': %w", fromKey, err)
+		}
+	}
+
+	prefix := fromKey
+	if prefix != "" {
+		prefix += "/"
+	}
+	trash := c.trash(c.from)
+
+	var items []CopyItem
+	err := c.from.Storage.List(ctx, prefix, func(object storage.ObjectInfo) error {
+		// Manifests are copied along with the mirror they describe
+		if c.from.Backend != nil && IsInternalKey(trash, object.Key) && !publish.IsManifestKey(object.Key) {
+			return nil
+		}
+		items = append(items, CopyItem{
+			From: object.Key,
+			To:   path.Join(target, strings.TrimPrefix(object.Key, prefix)),
+			Size: object.Size,
+		})
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to list '%s': %w", prefix, err)
+	}
+
+	if len(items) == 0 {
+		return nil, fmt.Errorf("%w: '%s' doesn't exist", storage.ErrObjectNotFound, fromKey)
+	}
+	if !recursive {
+		return nil, fmt.Errorf("'%s' is a directory, copying it requires recursive", fromKey)
+	}
+
+	sort.Slice(items, func(i, j int) bool {
+		return items[i].From < items[j].From
+	})
+	return items, nil
+}
+
+// PlanMatching returns the files of the source backend matching the pattern copied into the destination directory,
+// keeping their paths below the base directory of the pattern. Matching files are resolved by the metadata store.
+func (c *Copier) PlanMatching(ctx context.Context, pattern *vfs.Pattern, toKey string) ([]CopyItem, error) {
+	if c.from.Backend == nil {
+		return nil, fmt.Errorf("%w: patterns only match files of backends", storage.ErrNotSupported)
+	}
+
+	var items []CopyItem
+	sources := make(map[string]bool)
+	err := MatchFiles(ctx, c.store, c.from.Backend.ID, pattern, func(file *models.File) error {
+		items = append(items, CopyItem{
+			From: file.Path,
+			To:   path.Join(toKey, strings.TrimPrefix(file.Path, pattern.Base())),
+			Size: file.Size,
+		})
+		sources[file.Path] = true
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to match files: %w", err)
+	}
+	if len(items) == 0 {
+		return nil, fmt.Errorf("%w: no files match '%s'", storage.ErrObjectNotFound, pattern)
+	}
+
+	if c.sameBackend() {
+		for _, item := range items {
+			if sources[item.To] {
+				return nil, fmt.Errorf("unable to copy '%s' to '%s', the destination is matched by the pattern as well", item.From, item.To)
+			}
+		}
+	}
+	return items, nil
+}
+
+// Apply copies the planned files and returns the number of copied files. Files that failed to copy don't stop
+// the remaining files, their errors are returned together.
+func (c *Copier) Apply(ctx context.Context, items []CopyItem, opts CopyOptions) (int, error) {
+	workers := opts.Workers
+	if workers <= 0 {
+		workers = DefaultCopyWorkers
+	}
+
+	// mutex guards the progress, reporting serializes the calls of the progress callback
+	var mutex, reporting sync.Mutex
+	progress := CopyProgress{Total: len(items)}
+	for _, item := range items {
+		progress.TotalBytes += item.Size
+	}
+	active := make(map[string]*CopyTransfer)
+	var errs []error
+
+	report := func() {
+		if opts.Progress == nil {
+			return
+		}
+		reporting.Lock()
+		defer reporting.Unlock()
+
+		mutex.Lock()
+		current := progress
+		current.Active = make([]CopyTransfer, 0, len(active))
+		for _, t := range active {
+			current.Active = append(current.Active, *t)
+			current.Bytes += t.BytesDone
+		}
+		mutex.Unlock()
+
+		sort.Slice(current.Active, func(i, j int) bool {
+			return current.Active[i].Path < current.Active[j].Path
+		})
+		opts.Progress(current)
+	}
+
+	queue := make(chan CopyItem)
+	var wait sync.WaitGroup
+	for i := 0; i < min(workers, len(items)); i++ {
+		wait.Add(1)
+		go func() {
+			defer wait.Done()
+			for item := range queue {
+				t := &CopyTransfer{Path: item.From, Size: item.Size}
+				mutex.Lock()
+				active[item.From] = t
+				mutex.Unlock()
+
+				err := c.apply(ctx, item, opts.Move, func(n int64) {
+					mutex.Lock()
+					t.BytesDone += n
+					mutex.Unlock()
+				})
+
+				mutex.Lock()
+				delete(active, item.From)
+				if err != nil {
+					errs = append(errs, err)
+				} else {
+					progress.Copied++
+					progress.Bytes += item.Size
+				}
+				mutex.Unlock()
+				report()
+			}
+		}()
+	}
+
+	done := make(chan struct{})
+	go func() {
+		ticker := time.NewTicker(time.Second)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-done:
+				return
+			case <-ticker.C:
+				report()
+			}
+		}
+	}()
+
+feed:
+	for _, item := range items {
+		select {
+		case queue <- item:
+		case <-ctx.Done():
+			break feed
+		}
+	}
+	close(queue)
+	wait.Wait()
+	close(done)
+
+	if ctx.Err() != nil {
+		errs = append(errs, ctx.Err())
+	}
+	return progress.Copied, errors.Join(errs...)
+}
+
+// apply copies a single file and removes its source if it's moved, counting the streamed bytes with transferred
+func (c *Copier) apply(ctx context.Context, item CopyItem, move bool, transferred func(int64)) error {
+	info, compressed, err := c.copy(ctx, item, transferred)
+	if err != nil {
+		return fmt.Errorf("failed to copy '%s': %w", item.From, err)
+	}
+
+	if c.to.Backend != nil {
+		record := &models.File{
+			BackendID:  c.to.Backend.ID,
+			Path:       item.To,
+			Size:       info.Size,
+			ETag:       info.ETag,
+			VersionID:  info.VersionID,
+			ModifiedAt: info.LastModified,
+		}
+		if compressed != nil {
+			record.Size, record.MD5Hash, record.SHA256Hash = compressed.Size, compressed.MD5Hash, compressed.SHA256Hash
+			record.Compression = compressed.Compression
+		}
+		if record.ModifiedAt.IsZero() {
+			record.ModifiedAt = time.Now().UTC()
+		}
+		if err := c.store.UpsertFile(ctx, record); err != nil {
+			return fmt.Errorf("failed to record metadata of '%s': %w", item.To, err)
+		}
+	}
+
+	if !move {
+		return nil
+	}
+	if err := c.remove(ctx, item.From); err != nil {
+		return fmt.Errorf("failed to remove '%s' after copying it: %w", item.From, err)
+	}
+	return nil
+}
+
+// copy writes the content of the source file to the destination, using a server-side copy within the same backend.
+// Deduplicated files are assembled from their chunks, since copies of their manifests wouldn't reference the chunks.
+// Compressed files are decompressed, unless they're copied server-side, which returns the record of the compressed
+// source as well.
+func (c *Copier) copy(ctx context.Context, item CopyItem, transferred func(int64)) (*storage.ObjectInfo, *models.File, error) {
+	stat, err := c.from.Storage.Stat(ctx, item.From)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	var reader io.ReadCloser
+	var compressed *models.File
+	if c.from.Backend != nil {
+		chunks := dedup.NewStore(c.store, c.from.Storage, c.from.Backend)
+		compressed = CompressedFile(ctx, c.store, c.from.Backend, item.From, stat)
+		if chunks.IsDeduplicated(ctx, item.From, stat) {
+			var manifest *dedup.Manifest
+			if reader, manifest, err = chunks.Open(ctx, item.From); err != nil {
+				return nil, nil, err
+			}
+			stat.Size, stat.ContentType = manifest.Size, ""
+		} else if c.sameBackend() {
+			info, err := c.to.Storage.Copy(ctx, item.From, item.To)
+			if err == nil {
+				transferred(stat.Size)
+			}
+			return info, compressed, err
+		}
+	}
+
+	if reader == nil {
+		if reader, err = c.from.Storage.Get(ctx, item.From); err != nil {
+			return nil, nil, err
+		}
+		if compressed != nil {
+			if reader, err = compress.Decompress(reader, compressed.Compression); err != nil {
+				return nil, nil, err
+			}
+			stat.Size = compressed.Size
+		}
+	}
+	defer reader.Close()
+
+	info, err := c.to.Storage.Put(ctx, item.To, &copyReader{Reader: reader, transferred: transferred}, stat.Size, storage.PutOptions{
+		ContentType: stat.ContentType,
+		ModifiedAt:  stat.LastModified,
+	})
+	return info, nil, err
+}
+
+// remove deletes the source file of a move, moving files of backends into their trash
+func (c *Copier) remove(ctx context.Context, key string) error {
+	if c.from.Backend == nil {
+		return c.from.Storage.Delete(ctx, key)
+	}
+
+	errs, err := c.trash(c.from).Remove(ctx, []string{key})
+	if err != nil {
+		return err
+	}
+	if len(errs) > 0 {
+		return errs[0]
+	}
+
+	file, err := c.store.GetFile(ctx, c.from.Backend.ID, key)
+	if err != nil {
+		if errors.Is(err, store.ErrNotFound) {
+			return nil
+		}
+		return err
+	}
+	return c.store.DeleteFile(ctx, file.ID)
+}
+
+// sameBackend returns true if files are copied within the same backend
+func (c *Copier) sameBackend() bool {
+	return c.from.Backend != nil && c.to.Backend != nil && c.from.Backend.ID == c.to.Backend.ID
+}
+
+func (c *Copier) trash(e CopyEndpoint) *Trash {
+	if e.Backend == nil {
+		return nil
+	}
+	return NewTrash(c.store, e.Storage, e.Backend)
+}
+
+// copyReader reports the bytes read from the source of a copy
+type copyReader struct {
+	io.Reader
+	transferred func(int64)
+}
+
+func (r *copyReader) Read(p []byte) (int, error) {
+	n, err := r.Reader.Read(p)
+	r.transferred(int64(n))
+	return n, err
+}
@@ -0,0 +1,117 @@
+package backend
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/mwantia/gosync/pkg/db/models"
+	"github.com/mwantia/gosync/pkg/db/store"
+)
+
+// ChangeType describes how a file changed within a time window
+type ChangeType string
+
+const (
+	ChangeAdded    ChangeType = "added"
+	ChangeModified ChangeType = "modified"
+	ChangeDeleted  ChangeType = "deleted"
+)
+
+// Change describes the accumulated change of a single file within a time window
+type Change struct {
+	Path      string     `json:"path"`
+	Type      ChangeType `json:"type"`
+	Size      int64      `json:"size"`
+	SHA256    string     `json:"sha256,omitempty"`
+	ChangedAt time.Time  `json:"changed_at"`
+	Events    int        `json:"events"`
+}
+
+// Diff lists all files below the prefix that were added, modified or deleted between since and until,
+// based on the recorded file events and the tombstones of deleted files.
+func Diff(ctx context.Context, ms store.MetadataStore, backendID, prefix string, since, until time.Time) ([]Change, error) {
+	events, err := ms.ListFileEvents(ctx, backendID, prefix, since, until)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list file events: %w", err)
+	}
+
+	type window struct {
+		first models.FileEvent
+		last  models.FileEvent
+		count int
+	}
+
+	windows := make(map[string]*window)
+	for _, event := range events {
+		if !InPrefix(event.Path, prefix) {
+			continue
+		}
+		w, ok := windows[event.Path]
+		if !ok {
+			w = &window{first: event}
+			windows[event.Path] = w
+		}
+		w.last = event
+		w.count++
+	}
+
+	var changes []Change
+	for path, w := range windows {
+		existedBefore := w.first.Type != models.FileEventCreated
+		existsAfter := w.last.Type != models.FileEventDeleted
+
+		var changeType ChangeType
+		switch {
+		case !existedBefore && !existsAfter:
+			// Created and deleted within the window
+			continue
+		case !existedBefore:
+			changeType = ChangeAdded
+		case !existsAfter:
+			changeType = ChangeDeleted
+		default:
+			changeType = ChangeModified
+		}
+
+		changes = append(changes, Change{
+			Path:      path,
+			Type:      changeType,
+			Size:      w.last.Size,
+			SHA256:    w.last.SHA256Hash,
+			ChangedAt: w.last.OccurredAt,
+			Events:    w.count,
+		})
+	}
+
+	tombstones, err := ms.ListDeletedFiles(ctx, backendID, prefix, since)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list deleted files: %w", err)
+	}
+
+	for _, file := range tombstones {
+		if _, ok := windows[file.Path]; ok || !InPrefix(file.Path, prefix) {
+			continue
+		}
+
+		deletedAt := file.DeletedAt.Time
+		if !until.IsZero() && deletedAt.After(until) {
+			continue
+		}
+
+		changes = append(changes, Change{
+			Path:      file.Path,
+			Type:      ChangeDeleted,
+			Size:      file.Size,
+			SHA256:    file.SHA256Hash,
+			ChangedAt: deletedAt,
+		})
+	}
+
+	sort.Slice(changes, func(i, j int) bool {
+		return changes[i].Path < changes[j].Path
+	})
+
+	return changes, nil
+}
@@ -0,0 +1,210 @@
+package backend
+
+import (
+	"context"
+	"crypto/md5"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"hash"
+	"io"
+	"math/rand/v2"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/mwantia/gosync/pkg/compress"
+	"github.com/mwantia/gosync/pkg/db/models"
+	"github.com/mwantia/gosync/pkg/db/store"
+	"github.com/mwantia/gosync/pkg/dedup"
+	"github.com/mwantia/gosync/pkg/storage"
+)
+
+// DefaultDrillSamples is the number of files restored by a drill if not configured
+const DefaultDrillSamples = 10
+
+// maxDrillFailures limits the number of failures recorded for a single drill
+const maxDrillFailures = 20
+
+// DrillOptions configures a restore drill
+type DrillOptions struct {
+	// Samples is the number of randomly chosen files to restore
+	Samples int
+	// MaxFileSize excludes larger files from the sample (0 = unlimited)
+	MaxFileSize int64
+	// Dir is the parent of the temporary directory files are restored into (system default if empty)
+	Dir string
+	// Progress is called after each restored file (may be nil)
+	Progress func(path string, err error)
+}
+
+// Drill restores a random sample of files of a backend into a temporary directory and compares
+// their content with the recorded hashes, proving that the stored files can actually be restored.
+type Drill struct {
+	store   store.MetadataStore
+	storage storage.Storage
+	trash   *Trash
+	dedup   *dedup.Store
+	backend *models.Backend
+}
+
+// NewDrill creates a new restore drill for the provided backend
+func NewDrill(ms store.MetadataStore, st storage.Storage, backend *models.Backend) *Drill {
+	return &Drill{
+		store:   ms,
+		storage: st,
+		trash:   NewTrash(ms, st, backend),
+		dedup:   dedup.NewStore(ms, st, backend),
+		backend: backend,
+	}
+}
+
+// Run executes the drill and records its result in the metadata store. Failed files are reported within
+// the result, while errors are only returned if the drill couldn't be run or recorded.
+func (d *Drill) Run(ctx context.Context, opts DrillOptions) (*models.RestoreDrill, error) {
+	if opts.Samples <= 0 {
+		opts.Samples = DefaultDrillSamples
+	}
+
+	result := &models.RestoreDrill{
+		BackendID: d.backend.ID,
+		StartedAt: time.Now().UTC(),
+	}
+
+	if err := d.run(ctx, opts, result); err != nil {
+		result.Error = err.Error()
+	}
+	result.FinishedAt = time.Now().UTC()
+
+	// The result is recorded even if the context was cancelled during the drill
+	if err := d.store.CreateRestoreDrill(context.WithoutCancel(ctx), result); err != nil {
+		return result, fmt.Errorf("failed to record restore drill: %w", err)
+	}
+	return result, nil
+}
+
+func (d *Drill) run(ctx context.Context, opts DrillOptions, result *models.RestoreDrill) error {
+	sample, err := d.sample(ctx, opts)
+	if err != nil {
+		return fmt.Errorf("failed to sample files: %w", err)
+	}
+	if len(sample) == 0 {
+		return fmt.Errorf("no files with recorded hashes found")
+	}
+
+	dir, err := os.MkdirTemp(opts.Dir, "gosync-drill-")
+	if err != nil {
+		return fmt.Errorf("failed to create temporary directory: %w", err)
+	}
+	defer os.RemoveAll(dir)
+
+	var failures []string
+	for i := range sample {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+
+		file := &sample[i]
+		result.Sampled++
+
+		size, err := d.restore(ctx, dir, file)
+		result.Bytes += size
+		if err != nil {
+			result.Failed++
+			if len(failures) < maxDrillFailures {
+				failures = append(failures, fmt.Sprintf("%s: %v", file.Path, err))
+			}
+		} else {
+			result.Verified++
+		}
+
+		if opts.Progress != nil {
+			opts.Progress(file.Path, err)
+		}
+	}
+
+	result.Failures = strings.Join(failures, "\n")
+	return nil
+}
+
+// sample chooses up to opts.Samples files with recorded hashes using reservoir sampling,
+// so every file has the same chance without loading all files of the backend at once
+func (d *Drill) sample(ctx context.Context, opts DrillOptions) ([]models.File, error) {
+	sample := make([]models.File, 0, opts.Samples)
+	seen := 0
+
+	err := d.store.IterateFiles(ctx, d.backend.ID, "", func(file *models.File) error {
+		if file.SHA256Hash == "" && file.MD5Hash == "" {
+			return nil
+		}
+		if opts.MaxFileSize > 0 && file.Size > opts.MaxFileSize {
+			return nil
+		}
+		if d.trash.IsTrashKey(file.Path) || dedup.IsChunkKey(file.Path) {
+			return nil
+		}
+
+		seen++
+		if len(sample) < opts.Samples {
+			sample = append(sample, *file)
+		} else if i := rand.IntN(seen); i < opts.Samples {
+			sample[i] = *file
+		}
+		return nil
+	})
+	return sample, err
+}
+
+// restore writes the content of the file into dir and compares its size and hashes with the recorded values
+func (d *Drill) restore(ctx context.Context, dir string, file *models.File) (int64, error) {
+	var reader io.ReadCloser
+	var err error
+	if file.Deduplicated {
+		reader, _, err = d.dedup.Open(ctx, file.Path)
+	} else if reader, err = d.storage.Get(ctx, file.Path); err == nil && file.Compression != "" {
+		reader, err = compress.Decompress(reader, file.Compression)
+	}
+	if err != nil {
+		return 0, fmt.Errorf("failed to read: %w", err)
+	}
+	defer reader.Close()
+
+	target, err := os.CreateTemp(dir, "restore-")
+	if err != nil {
+		return 0, err
+	}
+	defer os.Remove(target.Name())
+	defer target.Close()
+
+	md5Hash := md5.New()
+	sha256Hash := sha256.New()
+	size, err := io.Copy(io.MultiWriter(target, md5Hash, sha256Hash), reader)
+	if err != nil {
+		return size, fmt.Errorf("failed to restore: %w", err)
+	}
+	if err := target.Sync(); err != nil {
+		return size, fmt.Errorf("failed to restore: %w", err)
+	}
+
+	if size != file.Size {
+		return size, fmt.Errorf("restored %d bytes instead of %d", size, file.Size)
+	}
+	if err := compareHash("sha256", file.SHA256Hash, sha256Hash); err != nil {
+		return size, err
+	}
+	if err := compareHash("md5", file.MD5Hash, md5Hash); err != nil {
+		return size, err
+	}
+	return size, nil
+}
+
+// compareHash returns an error if the expected hash is known and differs from the computed hash
+func compareHash(name, expected string, h hash.Hash) error {
+	if expected == "" {
+		return nil
+	}
+	if actual := hex.EncodeToString(h.Sum(nil)); !strings.EqualFold(actual, expected) {
+		return fmt.Errorf("%s hash is %s instead of %s", name, actual, expected)
+	}
+	return nil
+}
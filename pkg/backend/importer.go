@@ -0,0 +1,321 @@
+package backend
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/mwantia/gosync/pkg/checksum"
+	"github.com/mwantia/gosync/pkg/db/models"
+	"github.com/mwantia/gosync/pkg/db/store"
+	"github.com/mwantia/gosync/pkg/storage"
+)
+
+// ImportAction describes how a single local file was handled by an import
+type ImportAction string
+
+const (
+	ImportUploaded ImportAction = "uploaded" // Content was uploaded
+	ImportCopied   ImportAction = "copied"   // Content already existed elsewhere in the backend and was copied server-side
+	ImportSkipped  ImportAction = "skipped"  // Identical object already exists at the destination
+	ImportFailed   ImportAction = "failed"
+)
+
+// ImportResult describes the outcome for a single local file
+type ImportResult struct {
+	Path   string
+	Key    string
+	Size   int64
+	Action ImportAction
+	Err    error
+}
+
+// ImportSummary accumulates the results of an import
+type ImportSummary struct {
+	Files    int
+	Bytes    int64
+	Uploaded int
+	Copied   int
+	Skipped  int
+	Failed   int
+}
+
+// TagRule applies a tag to all imported files matching the pattern
+type TagRule struct {
+	Pattern string
+	Key     string
+	Value   string
+}
+
+// ParseTagRule parses a rule in the form "[pattern:]key=value", where the
+// pattern is matched against the relative path or the file name.
+func ParseTagRule(rule string) (TagRule, error) {
+	pattern := "*"
+	if i := strings.LastIndex(rule, ":"); i >= 0 {
+		pattern, rule = rule[:i], rule[i+1:]
+	}
+
+	key, value, ok := strings.Cut(rule, "=")
+	if !ok || key == "" {
+		return TagRule{}, fmt.Errorf("invalid tag rule '%s' (expected [pattern:]key=value)", rule)
+	}
+	if _, err := path.Match(pattern, ""); err != nil {
+		return TagRule{}, fmt.Errorf("invalid tag rule pattern '%s': %w", pattern, err)
+	}
+
+	return TagRule{
+		Pattern: pattern,
+		Key:     key,
+		Value:   value,
+	}, nil
+}
+
+// Matches returns true if the rule applies to the relative (slash separated) path
+func (r TagRule) Matches(relPath string) bool {
+	if ok, _ := path.Match(r.Pattern, relPath); ok {
+		return true
+	}
+	ok, _ := path.Match(r.Pattern, path.Base(relPath))
+	return ok
+}
+
+// ImportOptions configures an import
+type ImportOptions struct {
+	Workers int
+	DryRun  bool
+	Rules   []TagRule
+	// Rehash reads all files again instead of using the cached hashes of files imported before
+	Rehash bool
+	// Progress is called after each processed file (may be nil)
+	Progress func(ImportResult)
+}
+
+// Importer ingests a local directory (e.g. copied from an external drive) into a backend prefix,
+// skipping content that is already present in the backend.
+type Importer struct {
+	store   store.MetadataStore
+	storage storage.Storage
+	backend *models.Backend
+	hashes  *checksum.Cache
+}
+
+// NewImporter creates a new importer for the provided backend
+func NewImporter(ms store.MetadataStore, st storage.Storage, backend *models.Backend) *Importer {
+	return &Importer{
+		store:   ms,
+		storage: st,
+		backend: backend,
+		hashes:  checksum.NewCache(ms),
+	}
+}
+
+// Import walks the directory and imports all regular files below the prefix
+func (i *Importer) Import(ctx context.Context, dir, prefix string, opts ImportOptions) (ImportSummary, error) {
+	if opts.Workers <= 0 {
+		opts.Workers = 4
+	}
+
+	var summary ImportSummary
+	var mutex sync.Mutex
+	var wait sync.WaitGroup
+
+	queue := make(chan string)
+	for w := 0; w < opts.Workers; w++ {
+		wait.Add(1)
+		go func() {
+			defer wait.Done()
+
+			for file := range queue {
+				result := i.importFile(ctx, dir, file, prefix, opts)
+
+				mutex.Lock()
+				summary.Files++
+				summary.Bytes += result.Size
+				switch result.Action {
+				case ImportUploaded:
+					summary.Uploaded++
+				case ImportCopied:
+					summary.Copied++
+				case ImportSkipped:
+					summary.Skipped++
+				case ImportFailed:
+					summary.Failed++
+				}
+				if opts.Progress != nil {
+					opts.Progress(result)
+				}
+				mutex.Unlock()
+			}
+		}()
+	}
+
+	err := filepath.WalkDir(dir, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if !d.Type().IsRegular() {
+			return nil
+		}
+
+		select {
+		case queue <- p:
+			return nil
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	})
+
+	close(queue)
+	wait.Wait()
+
+	return summary, err
+}
+
+func (i *Importer) importFile(ctx context.Context, dir, file, prefix string, opts ImportOptions) ImportResult {
+	rel, err := filepath.Rel(dir, file)
+	if err != nil {
+		return ImportResult{Path: file, Action: ImportFailed, Err: err}
+	}
+	rel = filepath.ToSlash(rel)
+
+	result := ImportResult{
+		Path: file,
+		Key:  path.Join(prefix, rel),
+	}
+
+	action, sums, info, err := i.transfer(ctx, file, result.Key, opts.DryRun, opts.Rehash)
+	result.Size = sums.Size
+	result.Action = action
+	if err != nil {
+		result.Action = ImportFailed
+		result.Err = err
+		return result
+	}
+
+	if opts.DryRun {
+		return result
+	}
+
+	if err := i.record(ctx, file, result.Key, rel, sums, info, opts.Rules); err != nil {
+		result.Action = ImportFailed
+		result.Err = err
+	}
+	return result
+}
+
+// transfer hashes the local file and either skips, copies or uploads its content
+func (i *Importer) transfer(ctx context.Context, file, key string, dryRun, rehash bool) (ImportAction, checksum.Sums, *storage.ObjectInfo, error) {
+	sums, err := i.hashes.File(ctx, file, rehash)
+	if err != nil {
+		return ImportFailed, sums, nil, err
+	}
+
+	if existing, err := i.store.GetFile(ctx, i.backend.ID, key); err == nil && existing.SHA256Hash == sums.SHA256 {
+		return ImportSkipped, sums, &storage.ObjectInfo{Key: key, Size: existing.Size, ETag: existing.ETag, VersionID: existing.VersionID}, nil
+	}
+
+	info, err := i.storage.Stat(ctx, key)
+	if err == nil && info.Size == sums.Size && sums.MatchesETag(info.ETag) {
+		return ImportSkipped, sums, info, nil
+	}
+	if err != nil && !errors.Is(err, storage.ErrObjectNotFound) {
+		return ImportFailed, sums, nil, fmt.Errorf("failed to stat '%s': %w", key, err)
+	}
+
+	duplicates, err := i.store.FindFilesByHash(ctx, i.backend.ID, sums.SHA256)
+	if err != nil {
+		return ImportFailed, sums, nil, fmt.Errorf("failed to search duplicates: %w", err)
+	}
+
+	if len(duplicates) > 0 {
+		if dryRun {
+			return ImportCopied, sums, nil, nil
+		}
+
+		info, err := i.storage.Copy(ctx, duplicates[0].Path, key)
+		if err != nil {
+			return ImportFailed, sums, nil, fmt.Errorf("failed to copy '%s': %w", duplicates[0].Path, err)
+		}
+		return ImportCopied, sums, info, nil
+	}
+
+	if dryRun {
+		return ImportUploaded, sums, nil, nil
+	}
+
+	f, err := os.Open(file)
+	if err != nil {
+		return ImportFailed, sums, nil, err
+	}
+	defer f.Close()
+
+	info, err = i.storage.Put(ctx, key, f, sums.Size, storage.PutOptions{})
+	if err != nil {
+		return ImportFailed, sums, nil, fmt.Errorf("failed to upload '%s': %w", key, err)
+	}
+	return ImportUploaded, sums, info, nil
+}
+
+// record creates or updates the file metadata and applies the matching tag rules
+func (i *Importer) record(ctx context.Context, file, key, rel string, sums checksum.Sums, info *storage.ObjectInfo, rules []TagRule) error {
+	modifiedAt := time.Now().UTC()
+	if stat, err := os.Stat(file); err == nil {
+		modifiedAt = stat.ModTime().UTC()
+	}
+
+	record := &models.File{
+		BackendID:  i.backend.ID,
+		Path:       key,
+		Size:       sums.Size,
+		MD5Hash:    sums.MD5,
+		SHA256Hash: sums.SHA256,
+		ETag:       info.ETag,
+		VersionID:  info.VersionID,
+		ModifiedAt: modifiedAt,
+	}
+	if err := i.store.UpsertFile(ctx, record); err != nil {
+		return fmt.Errorf("failed to record metadata of '%s': %w", key, err)
+	}
+
+	return i.applyTags(ctx, record.ID, rel, rules)
+}
+
+func (i *Importer) applyTags(ctx context.Context, fileID uint, rel string, rules []TagRule) error {
+	if len(rules) == 0 {
+		return nil
+	}
+
+	tags, err := i.store.GetFileTags(ctx, fileID)
+	if err != nil {
+		return fmt.Errorf("failed to get tags: %w", err)
+	}
+
+	existing := make(map[string]bool, len(tags))
+	for _, tag := range tags {
+		existing[tag.Key+"="+tag.Value] = true
+	}
+
+	for _, rule := range rules {
+		if !rule.Matches(rel) || existing[rule.Key+"="+rule.Value] {
+			continue
+		}
+
+		if err := i.store.CreateTag(ctx, &models.Tag{
+			FileID: fileID,
+			Key:    rule.Key,
+			Value:  rule.Value,
+		}); err != nil {
+			return fmt.Errorf("failed to create tag '%s': %w", rule.Key, err)
+		}
+		existing[rule.Key+"="+rule.Value] = true
+	}
+
+	return nil
+}
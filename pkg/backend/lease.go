@@ -0,0 +1,194 @@
+package backend
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/mwantia/gosync/pkg/storage"
+)
+
+// LeasePrefix contains the lease objects of all paths currently written by a client
+const LeasePrefix = ".gosync-leases/"
+
+// DefaultLeaseTTL is used if leases are acquired without an explicit expiry
+const DefaultLeaseTTL = 5 * time.Minute
+
+// ErrLeased is returned when a path is leased by another client
+var ErrLeased = errors.New("path is leased by another client")
+
+// IsLeaseKey returns true if the key is located within the lease prefix
+func IsLeaseKey(key string) bool {
+	return strings.HasPrefix(key, LeasePrefix)
+}
+
+// LeaseKey returns the key of the lease object of the path. Paths are hashed, since a path may be a file
+// and the directory of other paths at the same time, e.g. while a file replaces a directory.
+func LeaseKey(p string) string {
+	sum := sha256.Sum256([]byte(p))
+	return LeasePrefix + hex.EncodeToString(sum[:]) + ".json"
+}
+
+// Lease grants a client exclusive write access to a path of a backend until it expires
+type Lease struct {
+	Path       string    `json:"path"`
+	ClientID   string    `json:"client_id"`
+	AcquiredAt time.Time `json:"acquired_at"`
+	ExpiresAt  time.Time `json:"expires_at"`
+
+	// etag of the lease object written by this client, which is only replaced or deleted while it still matches
+	etag string
+}
+
+// Leaser coordinates the clients writing to a backend with lease objects stored next to the files. Leases are
+// written with conditional writes, so clients using separate databases can't acquire the same lease at once.
+// Expired leases of clients that crashed or lost their connection are taken over by the next client.
+// Expiry is compared with the clock of each client, so the ttl has to exceed their clock skew.
+type Leaser struct {
+	storage  storage.Storage
+	clientID string
+	ttl      time.Duration
+}
+
+// NewLeaser creates a new leaser acquiring leases for the client on the storage of a backend
+func NewLeaser(st storage.Storage, clientID string, ttl time.Duration) *Leaser {
+	if ttl <= 0 {
+		ttl = DefaultLeaseTTL
+	}
+	return &Leaser{
+		storage:  st,
+		clientID: clientID,
+		ttl:      ttl,
+	}
+}
+
+// TTL returns the duration leases are valid for without being renewed
+func (l *Leaser) TTL() time.Duration {
+	return l.ttl
+}
+
+// Acquire leases the path until the ttl expires. Leases still held by this client, e.g. before a restart,
+// are renewed and expired leases of other clients are taken over.
+func (l *Leaser) Acquire(ctx context.Context, p string) (*Lease, error) {
+	now := time.Now().UTC()
+	lease := &Lease{
+		Path:       p,
+		ClientID:   l.clientID,
+		AcquiredAt: now,
+		ExpiresAt:  now.Add(l.ttl),
+	}
+
+	err := l.write(ctx, lease, storage.PutOptions{IfNoneMatch: true})
+	if !errors.Is(err, storage.ErrPreconditionFailed) {
+		return lease, err
+	}
+
+	current, err := l.read(ctx, p)
+	if errors.Is(err, storage.ErrObjectNotFound) {
+		// The lease was released in the meantime
+		return lease, l.write(ctx, lease, storage.PutOptions{IfNoneMatch: true})
+	}
+	if err != nil {
+		return nil, err
+	}
+	if current.ClientID != l.clientID && now.Before(current.ExpiresAt) {
+		return nil, leasedError(current)
+	}
+
+	// Only one of the clients taking over the expired lease at once replaces its object
+	if err := l.write(ctx, lease, storage.PutOptions{IfMatch: current.etag}); err != nil {
+		if errors.Is(err, storage.ErrPreconditionFailed) {
+			return nil, fmt.Errorf("%w: '%s' was taken over by another client", ErrLeased, p)
+		}
+		return nil, err
+	}
+	return lease, nil
+}
+
+// Renew extends the lease by the ttl, failing with ErrLeased if it was taken over by another client
+func (l *Leaser) Renew(ctx context.Context, lease *Lease) error {
+	renewed := *lease
+	renewed.ExpiresAt = time.Now().UTC().Add(l.ttl)
+
+	if err := l.write(ctx, &renewed, storage.PutOptions{IfMatch: lease.etag}); err != nil {
+		if errors.Is(err, storage.ErrPreconditionFailed) || errors.Is(err, storage.ErrObjectNotFound) {
+			return fmt.Errorf("%w: '%s' was taken over by another client", ErrLeased, lease.Path)
+		}
+		return err
+	}
+	*lease = renewed
+	return nil
+}
+
+// Release deletes the lease object, unless the lease was taken over by another client in the meantime.
+// Objects can't be deleted conditionally, so a lease taken over right before it's deleted is lost as well.
+func (l *Leaser) Release(ctx context.Context, lease *Lease) error {
+	key := LeaseKey(lease.Path)
+	info, err := l.storage.Stat(ctx, key)
+	if err != nil {
+		if errors.Is(err, storage.ErrObjectNotFound) {
+			return nil
+		}
+		return fmt.Errorf("failed to release lease of '%s': %w", lease.Path, err)
+	}
+	if info.ETag != lease.etag {
+		return nil
+	}
+
+	if err := l.storage.Delete(ctx, key); err != nil && !errors.Is(err, storage.ErrObjectNotFound) {
+		return fmt.Errorf("failed to release lease of '%s': %w", lease.Path, err)
+	}
+	return nil
+}
+
+func (l *Leaser) write(ctx context.Context, lease *Lease, opts storage.PutOptions) error {
+	data, err := json.Marshal(lease)
+	if err != nil {
+		return err
+	}
+
+	opts.ContentType = "application/json"
+	info, err := l.storage.Put(ctx, LeaseKey(lease.Path), bytes.NewReader(data), int64(len(data)), opts)
+	if err != nil {
+		if errors.Is(err, storage.ErrPreconditionFailed) {
+			return err
+		}
+		return fmt.Errorf("failed to write lease of '%s': %w", lease.Path, err)
+	}
+	lease.etag = info.ETag
+	return nil
+}
+
+// read returns the current lease of the path together with the etag of its object
+func (l *Leaser) read(ctx context.Context, p string) (*Lease, error) {
+	key := LeaseKey(p)
+	info, err := l.storage.Stat(ctx, key)
+	if err != nil {
+		return nil, err
+	}
+
+	reader, err := l.storage.Get(ctx, key)
+	if err != nil {
+		return nil, err
+	}
+	defer reader.Close()
+
+	var lease Lease
+	if err := json.NewDecoder(reader).Decode(&lease); err != nil {
+		// Unreadable leases are taken over like expired ones
+		return &Lease{Path: p, etag: info.ETag}, nil
+	}
+	// The object may have been replaced between both requests, which fails the conditional write taking it over
+	lease.etag = info.ETag
+	return &lease, nil
+}
+
+func leasedError(lease *Lease) error {
+	return fmt.Errorf("%w: '%s' is written by %s until %s", ErrLeased, lease.Path, lease.ClientID, lease.ExpiresAt.Local().Format(time.DateTime))
+}
@@ -0,0 +1,168 @@
+package backend
+
+import (
+	"bufio"
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+
+	"github.com/mwantia/gosync/pkg/db/models"
+	"github.com/mwantia/gosync/pkg/db/store"
+	"github.com/mwantia/gosync/pkg/dedup"
+	"github.com/mwantia/gosync/pkg/storage"
+)
+
+// listingVersion is the format version of exported listings
+const listingVersion = 1
+
+// ListingHeader is the first line of an exported listing
+type ListingHeader struct {
+	Version int       `json:"version"`
+	Backend string    `json:"backend"`
+	Prefix  string    `json:"prefix"`
+	Created time.Time `json:"created"`
+}
+
+// ListingObject is a single object of an exported listing
+type ListingObject struct {
+	Key          string    `json:"key"`
+	Size         int64     `json:"size"`
+	ETag         string    `json:"etag"`
+	VersionID    string    `json:"version_id,omitempty"`
+	LastModified time.Time `json:"last_modified"`
+}
+
+// ListingSummary describes the outcome of an export or import
+type ListingSummary struct {
+	Objects  int
+	Bytes    int64
+	Imported int
+	// Skipped objects were already recorded with the same ETag, so their recorded hashes are kept
+	Skipped int
+}
+
+// ExportListing lists all objects below the prefix and writes them as gzip compressed JSON lines, preceded by
+// a header. Objects are streamed while listing, so exports of huge buckets don't need to fit into memory.
+func ExportListing(ctx context.Context, st storage.Storage, b *models.Backend, prefix string, w io.Writer) (ListingSummary, error) {
+	summary := ListingSummary{}
+	trash := NewTrash(nil, st, b)
+
+	gz := gzip.NewWriter(w)
+	enc := json.NewEncoder(gz)
+
+	header := ListingHeader{
+		Version: listingVersion,
+		Backend: b.ID,
+		Prefix:  prefix,
+		Created: time.Now().UTC(),
+	}
+	if err := enc.Encode(header); err != nil {
+		return summary, err
+	}
+
+	err := st.List(ctx, prefix, func(object storage.ObjectInfo) error {
+		if trash.IsTrashKey(object.Key) || dedup.IsChunkKey(object.Key) || IsSnapshotKey(object.Key) || IsLeaseKey(object.Key) || strings.HasSuffix(object.Key, "/") {
+			return nil
+		}
+
+		summary.Objects++
+		summary.Bytes += object.Size
+		return enc.Encode(ListingObject{
+			Key:          object.Key,
+			Size:         object.Size,
+			ETag:         object.ETag,
+			VersionID:    object.VersionID,
+			LastModified: object.LastModified.UTC(),
+		})
+	})
+	if err != nil {
+		return summary, fmt.Errorf("failed to list '%s/%s': %w", b.ID, prefix, err)
+	}
+
+	return summary, gz.Close()
+}
+
+// readListingHeader reads the header of an exported listing and returns a decoder positioned at its first object
+func readListingHeader(r io.Reader) (*ListingHeader, *json.Decoder, error) {
+	gz, err := gzip.NewReader(bufio.NewReader(r))
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to read listing: %w", err)
+	}
+
+	dec := json.NewDecoder(gz)
+	header := &ListingHeader{}
+	if err := dec.Decode(header); err != nil {
+		return nil, nil, fmt.Errorf("failed to read listing header: %w", err)
+	}
+	if header.Version != listingVersion {
+		return nil, nil, fmt.Errorf("unsupported listing version %d", header.Version)
+	}
+	return header, dec, nil
+}
+
+// ImportListing records all objects of an exported listing as files of the backend, without accessing the
+// backend itself. The listing is imported into its own backend unless another one is provided, which must be
+// registered. Objects already recorded with the same ETag are skipped, others replace the recorded metadata.
+func ImportListing(ctx context.Context, ms store.MetadataStore, r io.Reader, into string) (*ListingHeader, ListingSummary, error) {
+	summary := ListingSummary{}
+
+	header, dec, err := readListingHeader(r)
+	if err != nil {
+		return nil, summary, err
+	}
+	if into == "" {
+		into = header.Backend
+	}
+	b, err := ms.GetBackend(ctx, into)
+	if err != nil {
+		return header, summary, fmt.Errorf("failed to find backend '%s': %w", into, err)
+	}
+
+	for {
+		if err := ctx.Err(); err != nil {
+			return header, summary, err
+		}
+
+		var object ListingObject
+		err := dec.Decode(&object)
+		if errors.Is(err, io.EOF) {
+			return header, summary, nil
+		}
+		if err != nil {
+			return header, summary, fmt.Errorf("failed to read listing object %d: %w", summary.Objects+1, err)
+		}
+		if object.Key == "" {
+			continue
+		}
+
+		summary.Objects++
+		summary.Bytes += object.Size
+
+		existing, err := ms.GetFile(ctx, b.ID, object.Key)
+		if err == nil && existing.ETag == object.ETag && existing.Size == object.Size {
+			summary.Skipped++
+			continue
+		}
+
+		record := &models.File{
+			BackendID:  b.ID,
+			Path:       object.Key,
+			Size:       object.Size,
+			ETag:       object.ETag,
+			VersionID:  object.VersionID,
+			ModifiedAt: object.LastModified,
+		}
+		if record.ModifiedAt.IsZero() {
+			record.ModifiedAt = header.Created
+		}
+		if err := ms.UpsertFile(ctx, record); err != nil {
+			return header, summary, fmt.Errorf("failed to record metadata of '%s': %w", object.Key, err)
+		}
+		summary.Imported++
+	}
+}
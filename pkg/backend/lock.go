@@ -0,0 +1,141 @@
+package backend
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"os/user"
+	"strings"
+	"time"
+
+	"github.com/mwantia/gosync/pkg/db/models"
+	"github.com/mwantia/gosync/pkg/db/store"
+)
+
+// DefaultLockTTL is used if a lock is acquired without an explicit expiry
+const DefaultLockTTL = time.Hour
+
+// ErrLocked is returned when a file is already locked by another owner
+var ErrLocked = errors.New("file is locked")
+
+// ErrNotLocked is returned when releasing a file that isn't locked
+var ErrNotLocked = errors.New("file is not locked")
+
+// LockOwner returns the default owner of locks acquired by this client, e.g. "alice@laptop"
+func LockOwner() string {
+	name := "unknown"
+	if u, err := user.Current(); err == nil && u.Username != "" {
+		// Windows usernames are prefixed with the domain
+		name = u.Username[strings.LastIndex(u.Username, `\`)+1:]
+	}
+
+	host, err := os.Hostname()
+	if err != nil || host == "" {
+		return name
+	}
+	return name + "@" + host
+}
+
+// Locker manages advisory locks of files within a backend. Locks don't prevent any
+// writes, but are surfaced to other clients to avoid conflicting edits of shared files.
+type Locker struct {
+	store     store.MetadataStore
+	backendID string
+}
+
+// NewLocker creates a new locker for the provided backend
+func NewLocker(ms store.MetadataStore, backendID string) *Locker {
+	return &Locker{
+		store:     ms,
+		backendID: backendID,
+	}
+}
+
+// Acquire locks the file for the owner until the ttl expires. Locks already held by the
+// same owner are refreshed and expired locks of other owners are taken over.
+func (l *Locker) Acquire(ctx context.Context, path, owner, clientID string, ttl time.Duration) (*models.Lock, error) {
+	if ttl <= 0 {
+		ttl = DefaultLockTTL
+	}
+	now := time.Now()
+
+	lock, err := l.store.GetLock(ctx, l.backendID, path)
+	if err != nil {
+		if !errors.Is(err, store.ErrNotFound) {
+			return nil, fmt.Errorf("failed to query lock of '%s': %w", path, err)
+		}
+
+		lock = &models.Lock{
+			BackendID:  l.backendID,
+			Path:       path,
+			Owner:      owner,
+			ClientID:   clientID,
+			AcquiredAt: now,
+			ExpiresAt:  now.Add(ttl),
+		}
+		if err := l.store.CreateLock(ctx, lock); err != nil {
+			return nil, fmt.Errorf("failed to lock '%s': %w", path, err)
+		}
+		return lock, nil
+	}
+
+	if lock.Owner != owner && now.Before(lock.ExpiresAt) {
+		return nil, lockedError(lock)
+	}
+
+	if lock.Owner != owner || !now.Before(lock.ExpiresAt) {
+		lock.AcquiredAt = now
+	}
+	lock.Owner = owner
+	lock.ClientID = clientID
+	lock.ExpiresAt = now.Add(ttl)
+
+	if err := l.store.UpdateLock(ctx, lock); err != nil {
+		return nil, fmt.Errorf("failed to lock '%s': %w", path, err)
+	}
+	return lock, nil
+}
+
+// Release removes the lock of the file held by the owner. Locks of other owners
+// are only removed if they have expired or force is set.
+func (l *Locker) Release(ctx context.Context, path, owner string, force bool) error {
+	lock, err := l.store.GetLock(ctx, l.backendID, path)
+	if err != nil {
+		if errors.Is(err, store.ErrNotFound) {
+			return fmt.Errorf("%w: '%s'", ErrNotLocked, path)
+		}
+		return fmt.Errorf("failed to query lock of '%s': %w", path, err)
+	}
+
+	if lock.Owner != owner && !force && time.Now().Before(lock.ExpiresAt) {
+		return lockedError(lock)
+	}
+
+	if err := l.store.DeleteLock(ctx, lock.ID); err != nil {
+		return fmt.Errorf("failed to unlock '%s': %w", path, err)
+	}
+	return nil
+}
+
+// List returns all active locks of files below the prefix
+func (l *Locker) List(ctx context.Context, prefix string) ([]models.Lock, error) {
+	locks, err := l.store.ListLocks(ctx, l.backendID, prefix)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list locks: %w", err)
+	}
+
+	now := time.Now()
+	active := locks[:0]
+	for _, lock := range locks {
+		if now.Before(lock.ExpiresAt) {
+			active = append(active, lock)
+		}
+	}
+
+	return active, nil
+}
+
+func lockedError(lock *models.Lock) error {
+	return fmt.Errorf("%w: '%s' is locked by %s until %s", ErrLocked, lock.Path, lock.Owner, lock.ExpiresAt.Local().Format(time.DateTime))
+}
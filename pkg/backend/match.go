@@ -0,0 +1,43 @@
+package backend
+
+import (
+	"context"
+
+	"github.com/mwantia/gosync/pkg/db/models"
+	"github.com/mwantia/gosync/pkg/db/store"
+	"github.com/mwantia/gosync/pkg/vfs"
+)
+
+// matchBatchSize is the number of files loaded at once while matching files against a pattern
+const matchBatchSize = 1000
+
+// MatchFiles calls fn for every file of the backend matching the pattern ordered by path, stopping at the first error
+// returned by fn. The metadata store selects the files by the LIKE pattern of the pattern, which are matched exactly
+// afterwards, so only a superset of the matching files is loaded.
+func MatchFiles(ctx context.Context, ms store.MetadataStore, backendID string, pattern *vfs.Pattern, fn func(file *models.File) error) error {
+	filter := store.FileFilter{
+		PathPrefix: pattern.Base(),
+		PathLike:   pattern.Like(),
+	}
+
+	for {
+		files, err := ms.ListFiles(ctx, backendID, filter, matchBatchSize, 0)
+		if err != nil {
+			return err
+		}
+
+		for i := range files {
+			if !pattern.Match(files[i].Path) {
+				continue
+			}
+			if err := fn(&files[i]); err != nil {
+				return err
+			}
+		}
+
+		if len(files) < matchBatchSize {
+			return nil
+		}
+		filter.After = &files[len(files)-1]
+	}
+}
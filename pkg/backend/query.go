@@ -0,0 +1,107 @@
+package backend
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"path"
+	"strings"
+
+	"github.com/mwantia/gosync/pkg/db/models"
+	"github.com/mwantia/gosync/pkg/db/store"
+	"github.com/mwantia/gosync/pkg/storage"
+)
+
+// Query runs server-side SQL queries against structured objects of a backend
+type Query struct {
+	store   store.MetadataStore
+	storage storage.Storage
+	backend *models.Backend
+}
+
+// NewQuery creates a new query runner for the provided backend
+func NewQuery(ms store.MetadataStore, st storage.Storage, backend *models.Backend) *Query {
+	return &Query{
+		store:   ms,
+		storage: st,
+		backend: backend,
+	}
+}
+
+// Select streams the records of the object matching opts.Expression. The format and compression
+// are detected from the extension of the key if not set, e.g. "data.csv.gz" is read as gzipped CSV.
+func (q *Query) Select(ctx context.Context, key string, opts storage.SelectOptions) (io.ReadCloser, error) {
+	selector, ok := q.storage.(storage.SelectStorage)
+	if !ok {
+		return nil, fmt.Errorf("%w: backend '%s' doesn't support server-side queries", storage.ErrNotSupported, q.backend.ID)
+	}
+	if strings.TrimSpace(opts.Expression) == "" {
+		return nil, fmt.Errorf("query expression is required")
+	}
+
+	// Deduplicated and compressed files are stored as chunks or compressed objects, so their key doesn't contain
+	// the actual content
+	file, err := q.store.GetFile(ctx, q.backend.ID, key)
+	if err != nil && !errors.Is(err, store.ErrNotFound) {
+		return nil, fmt.Errorf("failed to find file '%s': %w", key, err)
+	}
+	if file != nil && file.Deduplicated {
+		return nil, fmt.Errorf("%w: '%s' is stored deduplicated", storage.ErrNotSupported, key)
+	}
+	if file != nil && file.Compression != "" {
+		return nil, fmt.Errorf("%w: '%s' is stored compressed by %s", storage.ErrNotSupported, key, file.Compression)
+	}
+
+	detected := DetectSelectFormat(key)
+	if opts.Format == "" {
+		opts.Format = detected.Format
+		opts.JSONLines = opts.JSONLines || detected.JSONLines
+		if opts.CSVDelimiter == "" {
+			opts.CSVDelimiter = detected.CSVDelimiter
+		}
+	}
+	if opts.Format == "" {
+		return nil, fmt.Errorf("%w: failed to detect format of '%s', expected csv, json or parquet", storage.ErrNotSupported, key)
+	}
+	if opts.Compression == "" {
+		opts.Compression = detected.Compression
+	}
+
+	reader, err := selector.Select(ctx, key, opts)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query '%s': %w", key, err)
+	}
+	return reader, nil
+}
+
+// DetectSelectFormat returns the format and compression of an object based on the extensions of its key
+func DetectSelectFormat(key string) storage.SelectOptions {
+	var opts storage.SelectOptions
+	name := strings.ToLower(path.Base(key))
+
+	switch ext := path.Ext(name); ext {
+	case ".gz":
+		opts.Compression = "gzip"
+		name = strings.TrimSuffix(name, ext)
+	case ".bz2":
+		opts.Compression = "bzip2"
+		name = strings.TrimSuffix(name, ext)
+	}
+
+	switch path.Ext(name) {
+	case ".csv":
+		opts.Format = storage.SelectFormatCSV
+	case ".tsv":
+		opts.Format = storage.SelectFormatCSV
+		opts.CSVDelimiter = "\t"
+	case ".json":
+		opts.Format = storage.SelectFormatJSON
+	case ".jsonl", ".ndjson":
+		opts.Format = storage.SelectFormatJSON
+		opts.JSONLines = true
+	case ".parquet":
+		opts.Format = storage.SelectFormatParquet
+	}
+	return opts
+}
@@ -0,0 +1,231 @@
+package backend
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/mwantia/gosync/pkg/db/models"
+	"github.com/mwantia/gosync/pkg/db/store"
+	"github.com/mwantia/gosync/pkg/storage"
+)
+
+// RestoreAction describes what happens to a single path when restoring a point in time
+type RestoreAction string
+
+const (
+	RestoreActionRevert RestoreAction = "revert" // Copy the historical version back
+	RestoreActionRemove RestoreAction = "remove" // Path didn't exist at that time
+	RestoreActionSkip   RestoreAction = "skip"   // Historical version isn't available
+)
+
+// RestoreItem is a single planned change of a point-in-time restore
+type RestoreItem struct {
+	Path   string
+	Action RestoreAction
+	Reason string
+	Target *models.FileEvent
+}
+
+// RestoreProgress reports the state of a running restore
+type RestoreProgress struct {
+	Path    string // Path of the last applied change
+	Applied int
+	Total   int
+}
+
+// RestoreOptions configures how a restore is applied
+type RestoreOptions struct {
+	// Progress is called after each applied change (may be nil)
+	Progress func(RestoreProgress)
+}
+
+// Restorer reverts a backend prefix to the state recorded at a past point in time.
+// Reverting content requires versioning to be enabled for the backend's bucket.
+type Restorer struct {
+	store   store.MetadataStore
+	storage storage.Storage
+	trash   *Trash
+	backend *models.Backend
+}
+
+// NewRestorer creates a new point-in-time restorer for the provided backend
+func NewRestorer(ms store.MetadataStore, st storage.Storage, backend *models.Backend) *Restorer {
+	return &Restorer{
+		store:   ms,
+		storage: st,
+		trash:   NewTrash(ms, st, backend),
+		backend: backend,
+	}
+}
+
+// Plan compares the current files below the prefix with the state at the provided time
+func (r *Restorer) Plan(ctx context.Context, prefix string, at time.Time) ([]RestoreItem, error) {
+	past, err := r.store.ListFilesAt(ctx, r.backend.ID, prefix, at)
+	if err != nil {
+		return nil, fmt.Errorf("failed to reconstruct files at %s: %w", at.Format(time.RFC3339), err)
+	}
+	return r.plan(ctx, prefix, past)
+}
+
+func (r *Restorer) plan(ctx context.Context, prefix string, past []models.FileEvent) ([]RestoreItem, error) {
+	existing := make(map[string]models.File)
+	err := r.store.IterateFiles(ctx, r.backend.ID, prefix, func(file *models.File) error {
+		if InPrefix(file.Path, prefix) && !IsSnapshotKey(file.Path) {
+			existing[file.Path] = *file
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to list current files: %w", err)
+	}
+
+	var items []RestoreItem
+	for i := range past {
+		event := &past[i]
+		if !InPrefix(event.Path, prefix) {
+			continue
+		}
+
+		file, ok := existing[event.Path]
+		delete(existing, event.Path)
+
+		if ok && file.ETag == event.ETag && file.Size == event.Size {
+			continue
+		}
+
+		if event.VersionID == "" {
+			items = append(items, RestoreItem{
+				Path:   event.Path,
+				Action: RestoreActionSkip,
+				Reason: "no object version recorded (bucket versioning disabled?)",
+				Target: event,
+			})
+			continue
+		}
+
+		items = append(items, RestoreItem{
+			Path:   event.Path,
+			Action: RestoreActionRevert,
+			Target: event,
+		})
+	}
+
+	for path := range existing {
+		items = append(items, RestoreItem{
+			Path:   path,
+			Action: RestoreActionRemove,
+		})
+	}
+
+	sort.Slice(items, func(i, j int) bool {
+		return items[i].Path < items[j].Path
+	})
+
+	return items, nil
+}
+
+// InPrefix returns true if the path is the prefix itself or located below it, so the prefix "docs" matches
+// "docs/a.txt" but not "docs2/a.txt". The stores match prefixes by string, which is bounded to directories here.
+func InPrefix(path, prefix string) bool {
+	prefix = strings.TrimSuffix(prefix, "/")
+	return prefix == "" || path == prefix || strings.HasPrefix(path, prefix+"/")
+}
+
+// Apply executes the planned restore items, returning the number of applied changes
+func (r *Restorer) Apply(ctx context.Context, items []RestoreItem, opts RestoreOptions) (int, error) {
+	applied := 0
+	var removals []string
+
+	progress := RestoreProgress{}
+	for _, item := range items {
+		if item.Action != RestoreActionSkip {
+			progress.Total++
+		}
+	}
+	report := func(path string) {
+		if opts.Progress != nil {
+			progress.Path = path
+			progress.Applied = applied
+			opts.Progress(progress)
+		}
+	}
+
+	for _, item := range items {
+		switch item.Action {
+		case RestoreActionRevert:
+			if err := r.revert(ctx, item.Target); err != nil {
+				return applied, err
+			}
+			applied++
+			report(item.Path)
+
+		case RestoreActionRemove:
+			removals = append(removals, item.Path)
+		}
+	}
+
+	if len(removals) == 0 {
+		return applied, nil
+	}
+
+	// Removed objects go through the trash, so the restore itself can be undone
+	errs, err := r.trash.Remove(ctx, removals)
+	if err != nil {
+		return applied, fmt.Errorf("failed to remove objects: %w", err)
+	}
+
+	failed := make(map[string]bool, len(errs))
+	for _, e := range errs {
+		failed[e.Key] = true
+	}
+
+	for _, path := range removals {
+		if failed[path] {
+			continue
+		}
+
+		file, err := r.store.GetFile(ctx, r.backend.ID, path)
+		if err == nil {
+			if err := r.store.DeleteFile(ctx, file.ID); err != nil {
+				return applied, fmt.Errorf("failed to delete metadata of '%s': %w", path, err)
+			}
+		}
+		applied++
+		report(path)
+	}
+
+	if len(errs) > 0 {
+		return applied, fmt.Errorf("failed to remove %d objects", len(errs))
+	}
+	return applied, nil
+}
+
+func (r *Restorer) revert(ctx context.Context, target *models.FileEvent) error {
+	info, err := r.storage.CopyVersion(ctx, target.Path, target.VersionID, target.Path)
+	if err != nil {
+		return fmt.Errorf("failed to revert '%s' to version '%s': %w", target.Path, target.VersionID, err)
+	}
+
+	file, err := r.store.GetFile(ctx, r.backend.ID, target.Path)
+	if err != nil {
+		file = &models.File{
+			BackendID: r.backend.ID,
+			Path:      target.Path,
+		}
+	}
+
+	file.Size = target.Size
+	file.MD5Hash = target.MD5Hash
+	file.SHA256Hash = target.SHA256Hash
+	file.ETag = info.ETag
+	file.VersionID = info.VersionID
+	file.ModifiedAt = target.ModifiedAt
+
+	if file.ID == 0 {
+		return r.store.CreateFile(ctx, file)
+	}
+	return r.store.UpdateFile(ctx, file)
+}
@@ -0,0 +1,195 @@
+package backend
+
+import (
+	"context"
+	"errors"
+	"sort"
+	"sync"
+
+	"github.com/mwantia/gosync/pkg/storage"
+)
+
+// Defaults of scanners
+const (
+	DefaultScanWorkers  = 4
+	DefaultScanPageSize = 1000
+	// maxSplitDepth limits how deep scanners descend into single subdirectories to find prefixes to split
+	maxSplitDepth = 4
+)
+
+// ScanOptions configures a scanner
+type ScanOptions struct {
+	// Workers listing prefixes in parallel (DefaultScanWorkers if 0)
+	Workers int
+	// PageSize is the maximum number of keys listed per request (DefaultScanPageSize if 0)
+	PageSize int
+	// Cursor continues an interrupted scan after the last prefix it completed
+	Cursor string
+	// Checkpoint is called with the cursor of the scan whenever it completed further prefixes (optional)
+	Checkpoint func(cursor string) error
+}
+
+// Scanner lists the objects of a backend by splitting prefixes by their subdirectories, which are listed page
+// by page by parallel workers. Storages without paginated listings are listed entirely with a single List call.
+type Scanner struct {
+	storage storage.Storage
+	opts    ScanOptions
+}
+
+// NewScanner creates a new scanner for the storage of a backend
+func NewScanner(st storage.Storage, opts ScanOptions) *Scanner {
+	if opts.Workers <= 0 {
+		opts.Workers = DefaultScanWorkers
+	}
+	if opts.PageSize <= 0 {
+		opts.PageSize = DefaultScanPageSize
+	}
+
+	return &Scanner{
+		storage: st,
+		opts:    opts,
+	}
+}
+
+// Scan calls fn for all objects below the prefix. fn is called concurrently by the workers of the scanner.
+// Subdirectories up to the cursor of the options were completed by an interrupted scan and aren't listed again,
+// while objects directly below the prefix are always passed on.
+func (s *Scanner) Scan(ctx context.Context, prefix string, fn func(storage.ObjectInfo) error) error {
+	pager, ok := s.storage.(storage.PageStorage)
+	if !ok {
+		return s.storage.List(ctx, prefix, fn)
+	}
+
+	objects, prefixes, err := s.split(ctx, pager, prefix)
+	if errors.Is(err, storage.ErrNotSupported) {
+		// Wrapped storages implement paginated listings regardless of the storage they wrap
+		return s.storage.List(ctx, prefix, fn)
+	}
+	if err != nil {
+		return err
+	}
+
+	for _, object := range objects {
+		if err := fn(object); err != nil {
+			return err
+		}
+	}
+
+	start := 0
+	if s.opts.Cursor != "" {
+		start = sort.SearchStrings(prefixes, s.opts.Cursor)
+		if start < len(prefixes) && prefixes[start] == s.opts.Cursor {
+			start++
+		}
+	}
+	return s.scanPrefixes(ctx, pager, prefixes[start:], fn)
+}
+
+// split returns the objects directly below the prefix and the sorted subdirectories to list in parallel, descending
+// into single subdirectories, e.g. "photos/", until the keys are spread across several of them
+func (s *Scanner) split(ctx context.Context, pager storage.PageStorage, prefix string) ([]storage.ObjectInfo, []string, error) {
+	var objects []storage.ObjectInfo
+	for depth := 0; ; depth++ {
+		level, prefixes, err := pager.ListLevel(ctx, prefix)
+		if err != nil {
+			return nil, nil, err
+		}
+		objects = append(objects, level...)
+
+		if len(prefixes) != 1 || depth == maxSplitDepth {
+			sort.Strings(prefixes)
+			return objects, prefixes, nil
+		}
+		prefix = prefixes[0]
+	}
+}
+
+// scanPrefixes lists the prefixes using the workers of the scanner. The cursor is advanced once all
+// prefixes up to a completed prefix are completed, so prefixes are never skipped by a resumed scan.
+func (s *Scanner) scanPrefixes(ctx context.Context, pager storage.PageStorage, prefixes []string, fn func(storage.ObjectInfo) error) error {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	var mutex sync.Mutex
+	var wait sync.WaitGroup
+	var scanErr error
+
+	completed := make([]bool, len(prefixes))
+	next := 0
+
+	fail := func(err error) {
+		if scanErr == nil {
+			scanErr = err
+			cancel()
+		}
+	}
+
+	queue := make(chan int)
+	for w := 0; w < s.opts.Workers; w++ {
+		wait.Add(1)
+		go func() {
+			defer wait.Done()
+
+			for i := range queue {
+				err := s.listPages(ctx, pager, prefixes[i], fn)
+
+				mutex.Lock()
+				if err != nil {
+					fail(err)
+					mutex.Unlock()
+					continue
+				}
+
+				completed[i] = true
+				advanced := false
+				for next < len(prefixes) && completed[next] {
+					next++
+					advanced = true
+				}
+				if advanced && scanErr == nil && s.opts.Checkpoint != nil {
+					if err := s.opts.Checkpoint(prefixes[next-1]); err != nil {
+						fail(err)
+					}
+				}
+				mutex.Unlock()
+			}
+		}()
+	}
+
+dispatch:
+	for i := range prefixes {
+		select {
+		case queue <- i:
+		case <-ctx.Done():
+			break dispatch
+		}
+	}
+	close(queue)
+	wait.Wait()
+
+	if scanErr != nil {
+		return scanErr
+	}
+	return ctx.Err()
+}
+
+// listPages lists all objects below the prefix, continuing each page after the last key of the previous one
+func (s *Scanner) listPages(ctx context.Context, pager storage.PageStorage, prefix string, fn func(storage.ObjectInfo) error) error {
+	startAfter := ""
+	for {
+		objects, more, err := pager.ListPage(ctx, prefix, startAfter, s.opts.PageSize)
+		if err != nil {
+			return err
+		}
+
+		for _, object := range objects {
+			if err := fn(object); err != nil {
+				return err
+			}
+		}
+		if !more || len(objects) == 0 {
+			return nil
+		}
+		startAfter = objects[len(objects)-1].Key
+	}
+}
@@ -0,0 +1,248 @@
+package backend
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"path"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/mwantia/gosync/pkg/db/models"
+	"github.com/mwantia/gosync/pkg/db/store"
+	"github.com/mwantia/gosync/pkg/storage"
+)
+
+// SnapshotPrefix is the key prefix below which snapshot manifests are stored in each backend
+const SnapshotPrefix = ".gosync-snapshots/"
+
+// snapshotVersion is the format version of snapshot manifests
+const snapshotVersion = 1
+
+// IsSnapshotKey returns true if the key is located within the snapshot prefix
+func IsSnapshotKey(key string) bool {
+	return strings.HasPrefix(key, SnapshotPrefix)
+}
+
+// Snapshot is a manifest of the object versions below a prefix at the time it was created.
+// Manifests only reference versions, so restoring them requires versioning to be enabled for the bucket.
+type Snapshot struct {
+	Version int `json:"version"`
+	// Key of the manifest within the backend
+	Key     string    `json:"key"`
+	Sync    string    `json:"sync"`
+	Backend string    `json:"backend"`
+	Prefix  string    `json:"prefix"`
+	Reason  string    `json:"reason"`
+	Created time.Time `json:"created"`
+	// LockedUntil is the time until which the manifest can't be deleted or overwritten, zero if it isn't locked
+	LockedUntil time.Time      `json:"locked_until,omitempty"`
+	Files       []SnapshotFile `json:"files"`
+}
+
+// SnapshotFile is the state of a single file within a snapshot
+type SnapshotFile struct {
+	Path       string    `json:"path"`
+	Size       int64     `json:"size"`
+	MD5Hash    string    `json:"md5,omitempty"`
+	SHA256Hash string    `json:"sha256,omitempty"`
+	ETag       string    `json:"etag"`
+	VersionID  string    `json:"version_id,omitempty"`
+	ModifiedAt time.Time `json:"modified_at"`
+}
+
+// SnapshotOptions configures how a snapshot is created
+type SnapshotOptions struct {
+	// Reason is recorded in the manifest, e.g. "scheduled" or the detected anomaly
+	Reason string
+	// Retention locks the manifest for the duration, falling back to an unlocked manifest
+	// if the backend doesn't support retention locks (0 disables the lock)
+	Retention time.Duration
+	// Compliance locks the manifest in compliance mode instead of governance mode
+	Compliance bool
+}
+
+// Snapshots creates and manages the snapshot manifests of a backend
+type Snapshots struct {
+	store   store.MetadataStore
+	storage storage.Storage
+	backend *models.Backend
+}
+
+// NewSnapshots creates a new snapshot manager for the provided backend
+func NewSnapshots(ms store.MetadataStore, st storage.Storage, backend *models.Backend) *Snapshots {
+	return &Snapshots{
+		store:   ms,
+		storage: st,
+		backend: backend,
+	}
+}
+
+// Create writes a manifest of the files recorded below the prefix for the sync. The metadata of files is
+// only updated by applied passes, so the manifest describes the state of the last pass that was applied.
+func (s *Snapshots) Create(ctx context.Context, sync, prefix string, opts SnapshotOptions) (*Snapshot, error) {
+	if prefix != "" && !strings.HasSuffix(prefix, "/") {
+		prefix += "/"
+	}
+
+	now := time.Now().UTC()
+	snap := &Snapshot{
+		Version: snapshotVersion,
+		Key:     SnapshotPrefix + path.Join(sync, now.Format("20060102T150405Z")+".json"),
+		Sync:    sync,
+		Backend: s.backend.ID,
+		Prefix:  prefix,
+		Reason:  opts.Reason,
+		Created: now,
+	}
+
+	err := s.store.IterateFiles(ctx, s.backend.ID, prefix, func(file *models.File) error {
+		if IsSnapshotKey(file.Path) {
+			return nil
+		}
+		snap.Files = append(snap.Files, SnapshotFile{
+			Path:       file.Path,
+			Size:       file.Size,
+			MD5Hash:    file.MD5Hash,
+			SHA256Hash: file.SHA256Hash,
+			ETag:       file.ETag,
+			VersionID:  file.VersionID,
+			ModifiedAt: file.ModifiedAt,
+		})
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to list files: %w", err)
+	}
+
+	putOpts := storage.PutOptions{
+		ContentType: "application/json",
+		IfNoneMatch: true,
+	}
+	if opts.Retention > 0 {
+		snap.LockedUntil = now.Add(opts.Retention)
+		putOpts.RetainUntil = snap.LockedUntil
+		putOpts.Compliance = opts.Compliance
+	}
+
+	err = s.put(ctx, snap, putOpts)
+	if errors.Is(err, storage.ErrNotSupported) && opts.Retention > 0 {
+		snap.LockedUntil = time.Time{}
+		putOpts.RetainUntil = time.Time{}
+		err = s.put(ctx, snap, putOpts)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to write snapshot '%s': %w", snap.Key, err)
+	}
+
+	return snap, nil
+}
+
+func (s *Snapshots) put(ctx context.Context, snap *Snapshot, opts storage.PutOptions) error {
+	data, err := json.Marshal(snap)
+	if err != nil {
+		return err
+	}
+
+	_, err = s.storage.Put(ctx, snap.Key, bytes.NewReader(data), int64(len(data)), opts)
+	return err
+}
+
+// List returns the snapshots of the sync (or all syncs if empty), the most recent first
+func (s *Snapshots) List(ctx context.Context, sync string) ([]*Snapshot, error) {
+	prefix := SnapshotPrefix
+	if sync != "" {
+		prefix += sync + "/"
+	}
+
+	var keys []string
+	err := s.storage.List(ctx, prefix, func(object storage.ObjectInfo) error {
+		if strings.HasSuffix(object.Key, ".json") {
+			keys = append(keys, object.Key)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to list snapshots: %w", err)
+	}
+
+	snapshots := make([]*Snapshot, 0, len(keys))
+	for _, key := range keys {
+		snap, err := s.Load(ctx, key)
+		if err != nil {
+			return nil, err
+		}
+		snapshots = append(snapshots, snap)
+	}
+
+	sort.Slice(snapshots, func(i, j int) bool {
+		return snapshots[i].Created.After(snapshots[j].Created)
+	})
+	return snapshots, nil
+}
+
+// Load reads the snapshot manifest with the provided key
+func (s *Snapshots) Load(ctx context.Context, key string) (*Snapshot, error) {
+	if !IsSnapshotKey(key) {
+		key = SnapshotPrefix + key
+	}
+
+	reader, err := s.storage.Get(ctx, key)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read snapshot '%s': %w", key, err)
+	}
+	defer reader.Close()
+
+	snap := &Snapshot{}
+	if err := json.NewDecoder(reader).Decode(snap); err != nil {
+		return nil, fmt.Errorf("failed to decode snapshot '%s': %w", key, err)
+	}
+	if snap.Version != snapshotVersion {
+		return nil, fmt.Errorf("unsupported version %d of snapshot '%s'", snap.Version, key)
+	}
+
+	snap.Key = key
+	return snap, nil
+}
+
+// Prune deletes all but the most recent snapshots of the sync. Manifests that are still locked are
+// kept until their lock expires, so at least one consistent state survives even if keep is exceeded.
+func (s *Snapshots) Prune(ctx context.Context, sync string, keep int, now time.Time) (int, error) {
+	snapshots, err := s.List(ctx, sync)
+	if err != nil {
+		return 0, err
+	}
+
+	pruned := 0
+	for i, snap := range snapshots {
+		if i < keep || snap.LockedUntil.After(now) {
+			continue
+		}
+		if err := s.storage.Delete(ctx, snap.Key); err != nil {
+			return pruned, fmt.Errorf("failed to delete snapshot '%s': %w", snap.Key, err)
+		}
+		pruned++
+	}
+	return pruned, nil
+}
+
+// PlanSnapshot compares the current files below the prefix of the snapshot with the state it recorded
+func (r *Restorer) PlanSnapshot(ctx context.Context, snap *Snapshot) ([]RestoreItem, error) {
+	past := make([]models.FileEvent, len(snap.Files))
+	for i, file := range snap.Files {
+		past[i] = models.FileEvent{
+			Path:       file.Path,
+			Size:       file.Size,
+			MD5Hash:    file.MD5Hash,
+			SHA256Hash: file.SHA256Hash,
+			ETag:       file.ETag,
+			VersionID:  file.VersionID,
+			ModifiedAt: file.ModifiedAt,
+			OccurredAt: snap.Created,
+		}
+	}
+	return r.plan(ctx, snap.Prefix, past)
+}
@@ -0,0 +1,224 @@
+package backend
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"path"
+	"strings"
+	"time"
+
+	"github.com/mwantia/gosync/pkg/db/models"
+	"github.com/mwantia/gosync/pkg/db/store"
+	"github.com/mwantia/gosync/pkg/dedup"
+	"github.com/mwantia/gosync/pkg/publish"
+	"github.com/mwantia/gosync/pkg/storage"
+)
+
+// DefaultTrashPrefix is used if the backend doesn't define its own trash prefix
+const DefaultTrashPrefix = ".gosync-trash/"
+
+// ErrTrashConflict is returned when restoring an item would overwrite an existing object
+var ErrTrashConflict = errors.New("object already exists at the original path")
+
+// Trash handles remote deletions of a backend, moving objects into the
+// backend's trash prefix instead of deleting them if the trash is enabled.
+type Trash struct {
+	store   store.MetadataStore
+	storage storage.Storage
+	backend *models.Backend
+}
+
+// NewTrash creates a new trash for the provided backend
+func NewTrash(ms store.MetadataStore, st storage.Storage, backend *models.Backend) *Trash {
+	return &Trash{
+		store:   ms,
+		storage: st,
+		backend: backend,
+	}
+}
+
+// Prefix returns the key prefix under which trashed objects are stored
+func (t *Trash) Prefix() string {
+	prefix := t.backend.TrashPrefix
+	if prefix == "" {
+		prefix = DefaultTrashPrefix
+	}
+	if !strings.HasSuffix(prefix, "/") {
+		prefix += "/"
+	}
+	return prefix
+}
+
+// IsTrashKey returns true if the key is located within the trash prefix
+func (t *Trash) IsTrashKey(key string) bool {
+	return strings.HasPrefix(key, t.Prefix())
+}
+
+// IsInternalKey returns true if the key belongs to the trash, chunks, snapshots, leases or published manifests of
+// the backend instead of its files
+func IsInternalKey(trash *Trash, key string) bool {
+	return trash.IsTrashKey(key) || dedup.IsChunkKey(key) || IsSnapshotKey(key) || IsLeaseKey(key) || publish.IsManifestKey(key)
+}
+
+// Remove deletes the objects with the provided keys, or moves them into
+// the trash if it is enabled for the backend.
+func (t *Trash) Remove(ctx context.Context, keys []string) ([]storage.DeleteError, error) {
+	if !t.backend.TrashEnabled {
+		return t.storage.DeleteMany(ctx, keys)
+	}
+
+	now := time.Now().UTC()
+	var failed []storage.DeleteError
+	var moved []string
+
+	for _, key := range keys {
+		if err := t.moveToTrash(ctx, key, now); err != nil {
+			failed = append(failed, storage.DeleteError{
+				Key: key,
+				Err: err,
+			})
+			continue
+		}
+		moved = append(moved, key)
+	}
+
+	errs, err := t.storage.DeleteMany(ctx, moved)
+	return append(failed, errs...), err
+}
+
+func (t *Trash) moveToTrash(ctx context.Context, key string, now time.Time) error {
+	trashKey := t.Prefix() + path.Join(now.Format("20060102T150405Z"), key)
+
+	info, err := t.storage.Copy(ctx, key, trashKey)
+	if err != nil {
+		return fmt.Errorf("failed to copy object into trash: %w", err)
+	}
+
+	item := &models.TrashItem{
+		BackendID: t.backend.ID,
+		Path:      key,
+		TrashKey:  trashKey,
+		Size:      info.Size,
+		ETag:      info.ETag,
+		TrashedAt: now,
+	}
+	if t.backend.TrashRetention > 0 {
+		item.ExpiresAt = now.Add(time.Duration(t.backend.TrashRetention) * time.Second)
+	}
+
+	if err := t.store.CreateTrashItem(ctx, item); err != nil {
+		return fmt.Errorf("failed to record trash item: %w", err)
+	}
+
+	return nil
+}
+
+// Restore moves a trashed object back to its original path.
+// Existing objects at the original path are only overwritten if force is set.
+func (t *Trash) Restore(ctx context.Context, item *models.TrashItem, force bool) error {
+	if !force {
+		_, err := t.storage.Stat(ctx, item.Path)
+		if err == nil {
+			return fmt.Errorf("failed to restore '%s': %w", item.Path, ErrTrashConflict)
+		}
+		if !errors.Is(err, storage.ErrObjectNotFound) {
+			return fmt.Errorf("failed to check original path '%s': %w", item.Path, err)
+		}
+	}
+
+	info, err := t.storage.Copy(ctx, item.TrashKey, item.Path)
+	if err != nil {
+		return fmt.Errorf("failed to restore '%s': %w", item.Path, err)
+	}
+
+	if err := t.storage.Delete(ctx, item.TrashKey); err != nil {
+		return fmt.Errorf("failed to delete trash object '%s': %w", item.TrashKey, err)
+	}
+
+	if err := t.store.DeleteTrashItem(ctx, item.ID); err != nil {
+		return fmt.Errorf("failed to delete trash item: %w", err)
+	}
+
+	return t.restoreFile(ctx, item, info)
+}
+
+func (t *Trash) restoreFile(ctx context.Context, item *models.TrashItem, info *storage.ObjectInfo) error {
+	file, err := t.store.GetFile(ctx, t.backend.ID, item.Path)
+	if err != nil {
+		file = &models.File{
+			BackendID: t.backend.ID,
+			Path:      item.Path,
+		}
+	}
+
+	file.Size = item.Size
+	file.ETag = info.ETag
+	file.ModifiedAt = info.LastModified
+
+	if file.ID == 0 {
+		return t.store.CreateFile(ctx, file)
+	}
+	return t.store.UpdateFile(ctx, file)
+}
+
+// Purge permanently deletes the provided trash items
+func (t *Trash) Purge(ctx context.Context, items []models.TrashItem) (int, error) {
+	if len(items) == 0 {
+		return 0, nil
+	}
+
+	keys := make([]string, 0, len(items))
+	for _, item := range items {
+		keys = append(keys, item.TrashKey)
+	}
+
+	errs, err := t.storage.DeleteMany(ctx, keys)
+	if err != nil {
+		return 0, fmt.Errorf("failed to delete trash objects: %w", err)
+	}
+
+	// Objects that are already gone are purged as well, so their items aren't retried forever
+	failed := make(map[string]bool, len(errs))
+	for _, e := range errs {
+		if !errors.Is(e.Err, storage.ErrObjectNotFound) {
+			failed[e.Key] = true
+		}
+	}
+
+	purged := 0
+	for _, item := range items {
+		if failed[item.TrashKey] {
+			continue
+		}
+		if err := t.store.DeleteTrashItem(ctx, item.ID); err != nil {
+			return purged, fmt.Errorf("failed to delete trash item: %w", err)
+		}
+		purged++
+	}
+
+	if len(failed) > 0 {
+		return purged, fmt.Errorf("failed to purge %d trash objects", len(failed))
+	}
+	return purged, nil
+}
+
+// PurgeExpired permanently deletes all trash items whose retention expired before the provided time
+func (t *Trash) PurgeExpired(ctx context.Context, before time.Time) (int, error) {
+	total := 0
+	for {
+		items, err := t.store.ListExpiredTrashItems(ctx, t.backend.ID, before, storage.MaxDeleteBatchSize)
+		if err != nil {
+			return total, fmt.Errorf("failed to list expired trash items: %w", err)
+		}
+		if len(items) == 0 {
+			return total, nil
+		}
+
+		purged, err := t.Purge(ctx, items)
+		total += purged
+		if err != nil {
+			return total, err
+		}
+	}
+}
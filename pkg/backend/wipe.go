@@ -0,0 +1,170 @@
+package backend
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"sync/atomic"
+
+	"github.com/mwantia/gosync/pkg/db/models"
+	"github.com/mwantia/gosync/pkg/db/store"
+	"github.com/mwantia/gosync/pkg/storage"
+)
+
+// WipePhase describes the current phase of a backend wipe
+type WipePhase string
+
+const (
+	WipePhaseMark   WipePhase = "mark"
+	WipePhaseDelete WipePhase = "delete"
+	WipePhasePurge  WipePhase = "purge"
+	WipePhaseDone   WipePhase = "done"
+)
+
+// WipeProgress reports the state of a running backend wipe
+type WipeProgress struct {
+	Phase   WipePhase
+	Total   int64
+	Deleted int64
+	Failed  int64
+}
+
+// WipeOptions configures how a backend wipe is executed
+type WipeOptions struct {
+	Workers   int
+	BatchSize int
+	// Progress is called whenever the wipe made progress (may be nil)
+	Progress func(WipeProgress)
+}
+
+// Wiper removes all objects and file records of a single backend.
+// Wipes are executed in two phases: All file records are soft-marked first,
+// before the remote objects are deleted with parallel batch delete calls. An interrupted
+// wipe can be resumed by running it again.
+type Wiper struct {
+	store   store.MetadataStore
+	storage storage.Storage
+	backend *models.Backend
+}
+
+// NewWiper creates a new wiper for the provided backend
+func NewWiper(ms store.MetadataStore, st storage.Storage, backend *models.Backend) *Wiper {
+	return &Wiper{
+		store:   ms,
+		storage: st,
+		backend: backend,
+	}
+}
+
+// Wipe executes (or resumes) the wipe of the backend
+func (w *Wiper) Wipe(ctx context.Context, opts WipeOptions) error {
+	if opts.Workers <= 0 {
+		opts.Workers = 4
+	}
+	if opts.BatchSize <= 0 || opts.BatchSize > storage.MaxDeleteBatchSize {
+		opts.BatchSize = storage.MaxDeleteBatchSize
+	}
+
+	progress := WipeProgress{
+		Phase: WipePhaseMark,
+	}
+	w.report(opts, progress)
+
+	total, err := w.store.BeginBackendWipe(ctx, w.backend.ID)
+	if err != nil {
+		return fmt.Errorf("failed to mark files of backend '%s': %w", w.backend.ID, err)
+	}
+
+	progress.Phase = WipePhaseDelete
+	progress.Total = total
+	w.report(opts, progress)
+
+	deleted, failed, err := w.deleteObjects(ctx, opts, progress)
+	progress.Deleted = deleted
+	progress.Failed = failed
+	if err != nil {
+		return fmt.Errorf("failed to delete objects of backend '%s': %w", w.backend.ID, err)
+	}
+	if failed > 0 {
+		return fmt.Errorf("failed to delete %d objects of backend '%s', run the wipe again to resume", failed, w.backend.ID)
+	}
+
+	progress.Phase = WipePhasePurge
+	w.report(opts, progress)
+
+	if err := w.store.CompleteBackendWipe(ctx, w.backend.ID); err != nil {
+		return fmt.Errorf("failed to purge files of backend '%s': %w", w.backend.ID, err)
+	}
+
+	progress.Phase = WipePhaseDone
+	w.report(opts, progress)
+
+	return nil
+}
+
+func (w *Wiper) deleteObjects(ctx context.Context, opts WipeOptions, progress WipeProgress) (int64, int64, error) {
+	var deleted, failed atomic.Int64
+	var mutex sync.Mutex
+	var wait sync.WaitGroup
+
+	batches := make(chan []string)
+	for i := 0; i < opts.Workers; i++ {
+		wait.Add(1)
+		go func() {
+			defer wait.Done()
+
+			for batch := range batches {
+				errs, err := w.storage.DeleteMany(ctx, batch)
+				if err != nil {
+					// The whole batch is treated as failed and picked up by the next run
+					failed.Add(int64(len(batch)))
+				} else {
+					failed.Add(int64(len(errs)))
+					deleted.Add(int64(len(batch) - len(errs)))
+				}
+
+				mutex.Lock()
+				progress.Deleted = deleted.Load()
+				progress.Failed = failed.Load()
+				w.report(opts, progress)
+				mutex.Unlock()
+			}
+		}()
+	}
+
+	batch := make([]string, 0, opts.BatchSize)
+	err := w.storage.List(ctx, "", func(object storage.ObjectInfo) error {
+		batch = append(batch, object.Key)
+		if len(batch) < opts.BatchSize {
+			return nil
+		}
+
+		select {
+		case batches <- batch:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+
+		batch = make([]string, 0, opts.BatchSize)
+		return nil
+	})
+
+	if err == nil && len(batch) > 0 {
+		select {
+		case batches <- batch:
+		case <-ctx.Done():
+			err = ctx.Err()
+		}
+	}
+
+	close(batches)
+	wait.Wait()
+
+	return deleted.Load(), failed.Load(), err
+}
+
+func (w *Wiper) report(opts WipeOptions, progress WipeProgress) {
+	if opts.Progress != nil {
+		opts.Progress(progress)
+	}
+}
@@ -0,0 +1,87 @@
+package checksum
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/mwantia/gosync/pkg/db/models"
+)
+
+// HashStore persists the checksums of local files between runs
+type HashStore interface {
+	GetLocalHash(ctx context.Context, path string) (*models.LocalHash, error)
+	SaveLocalHash(ctx context.Context, hash *models.LocalHash) error
+}
+
+// Cache computes the checksums of local files, skipping files whose size, modification time and inode
+// are unchanged since they were hashed
+type Cache struct {
+	store HashStore
+	hash  func(ctx context.Context, path string) (Sums, error)
+}
+
+// NewCache creates a new cache persisting checksums in the store
+func NewCache(store HashStore) *Cache {
+	return &Cache{
+		store: store,
+		hash: func(ctx context.Context, path string) (Sums, error) {
+			return File(path)
+		},
+	}
+}
+
+// SetHasher replaces how files are read when they aren't cached, e.g. to dispatch the work to other processes
+func (c *Cache) SetHasher(hash func(ctx context.Context, path string) (Sums, error)) {
+	c.hash = hash
+}
+
+// File returns the checksums of the file, which is only read if it changed since it was hashed or if rehash is set.
+// Files modified while they were hashed aren't cached, since their checksums may not match any version of them.
+func (c *Cache) File(ctx context.Context, path string, rehash bool) (Sums, error) {
+	path, err := filepath.Abs(path)
+	if err != nil {
+		return Sums{}, err
+	}
+
+	stat, err := os.Stat(path)
+	if err != nil {
+		return Sums{}, err
+	}
+	if stat.IsDir() {
+		return Sums{}, fmt.Errorf("'%s' is a directory", path)
+	}
+
+	modified := stat.ModTime().UTC()
+	inode := fileInode(stat)
+	if !rehash {
+		if cached, err := c.store.GetLocalHash(ctx, path); err == nil && cached.Size == stat.Size() &&
+			cached.ModifiedAt.Equal(modified) && cached.Inode == inode && cached.SHA256Hash != "" {
+			return Sums{Size: cached.Size, MD5: cached.MD5Hash, SHA256: cached.SHA256Hash}, nil
+		}
+	}
+
+	sums, err := c.hash(ctx, path)
+	if err != nil {
+		return Sums{}, err
+	}
+
+	after, err := os.Stat(path)
+	if err != nil || after.Size() != sums.Size || !after.ModTime().UTC().Equal(modified) {
+		return sums, nil
+	}
+
+	// A failure to cache the checksums only costs hashing the file again
+	c.store.SaveLocalHash(ctx, &models.LocalHash{
+		Path:       path,
+		Size:       sums.Size,
+		ModifiedAt: modified,
+		Inode:      inode,
+		MD5Hash:    sums.MD5,
+		SHA256Hash: sums.SHA256,
+		HashedAt:   time.Now().UTC(),
+	})
+	return sums, nil
+}
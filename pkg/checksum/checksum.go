@@ -0,0 +1,81 @@
+package checksum
+
+import (
+	"crypto/md5"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"hash"
+	"io"
+	"os"
+	"strings"
+)
+
+// Sums holds the hex encoded checksums of a single file
+type Sums struct {
+	Size   int64
+	MD5    string
+	SHA256 string
+}
+
+// Hasher computes the checksums of all data written to it, e.g. while it is transferred
+type Hasher struct {
+	md5    hash.Hash
+	sha256 hash.Hash
+	size   int64
+}
+
+// NewHasher creates a new hasher computing MD5 and SHA256 checksums
+func NewHasher() *Hasher {
+	return &Hasher{
+		md5:    md5.New(),
+		sha256: sha256.New(),
+	}
+}
+
+func (h *Hasher) Write(p []byte) (int, error) {
+	h.md5.Write(p)
+	h.sha256.Write(p)
+	h.size += int64(len(p))
+	return len(p), nil
+}
+
+// Sums returns the checksums of the data written so far
+func (h *Hasher) Sums() Sums {
+	return Sums{
+		Size:   h.size,
+		MD5:    hex.EncodeToString(h.md5.Sum(nil)),
+		SHA256: hex.EncodeToString(h.sha256.Sum(nil)),
+	}
+}
+
+// Reader computes the checksums of all data read from the reader
+func Reader(r io.Reader) (Sums, error) {
+	h := NewHasher()
+	if _, err := io.Copy(h, r); err != nil {
+		return Sums{}, err
+	}
+	return h.Sums(), nil
+}
+
+// File computes the checksums of the file at the provided path
+func File(path string) (Sums, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return Sums{}, err
+	}
+	defer f.Close()
+
+	sums, err := Reader(f)
+	if err != nil {
+		return Sums{}, fmt.Errorf("failed to hash '%s': %w", path, err)
+	}
+	return sums, nil
+}
+
+// MatchesETag returns true if the ETag of a single-part upload matches the MD5 checksum.
+// Multipart ETags (containing a '-') can never match and return false.
+func (s Sums) MatchesETag(etag string) bool {
+	etag = strings.Trim(etag, `"`)
+	return etag != "" && strings.EqualFold(etag, s.MD5)
+}
@@ -0,0 +1,16 @@
+//go:build !windows
+
+package checksum
+
+import (
+	"io/fs"
+	"syscall"
+)
+
+// fileInode returns the inode of the file, so files replaced with the same size and modification time are detected
+func fileInode(stat fs.FileInfo) uint64 {
+	if sys, ok := stat.Sys().(*syscall.Stat_t); ok {
+		return uint64(sys.Ino)
+	}
+	return 0
+}
@@ -0,0 +1,11 @@
+//go:build windows
+
+package checksum
+
+import "io/fs"
+
+// fileInode returns 0, since the file index on Windows is only available for open files.
+// Cached checksums are compared by size and modification time instead.
+func fileInode(stat fs.FileInfo) uint64 {
+	return 0
+}
@@ -0,0 +1,97 @@
+// Package compress compresses the content of files stored within backends, which is transparently decompressed
+// whenever the files are read again
+package compress
+
+import (
+	"compress/gzip"
+	"fmt"
+	"io"
+
+	"github.com/klauspost/compress/zstd"
+)
+
+// Compression algorithms of files
+const (
+	None = "none"
+	Gzip = "gzip"
+	Zstd = "zstd"
+)
+
+// Valid returns an error unless the algorithm is supported, "" and "none" storing files uncompressed
+func Valid(algorithm string) error {
+	switch algorithm {
+	case "", None, Gzip, Zstd:
+		return nil
+	default:
+		return fmt.Errorf("unsupported compression '%s', it must be %s, %s or %s", algorithm, Zstd, Gzip, None)
+	}
+}
+
+// NewWriter returns a writer compressing everything written to it into w. Closing the writer flushes the
+// remaining content, but doesn't close w.
+func NewWriter(w io.Writer, algorithm string) (io.WriteCloser, error) {
+	switch algorithm {
+	case Gzip:
+		return gzip.NewWriter(w), nil
+	case Zstd:
+		return zstd.NewWriter(w)
+	default:
+		return nil, Valid(algorithm)
+	}
+}
+
+// NewReader returns a reader of the content decompressed from r. Closing the reader releases the decoder,
+// but doesn't close r.
+func NewReader(r io.Reader, algorithm string) (io.ReadCloser, error) {
+	switch algorithm {
+	case Gzip:
+		return gzip.NewReader(r)
+	case Zstd:
+		decoder, err := zstd.NewReader(r)
+		if err != nil {
+			return nil, err
+		}
+		return decoder.IOReadCloser(), nil
+	default:
+		return nil, Valid(algorithm)
+	}
+}
+
+// Compress returns a reader of the content of r compressed by the algorithm. The content is compressed by
+// a goroutine while it's read, which stops once the reader is closed.
+func Compress(r io.Reader, algorithm string) (io.ReadCloser, error) {
+	pr, pw := io.Pipe()
+	w, err := NewWriter(pw, algorithm)
+	if err != nil {
+		return nil, err
+	}
+
+	go func() {
+		_, err := io.Copy(w, r)
+		if closeErr := w.Close(); err == nil {
+			err = closeErr
+		}
+		pw.CloseWithError(err)
+	}()
+	return pr, nil
+}
+
+// Decompress returns a reader of the content decompressed from the reader, which is closed together with it
+func Decompress(reader io.ReadCloser, algorithm string) (io.ReadCloser, error) {
+	decompressed, err := NewReader(reader, algorithm)
+	if err != nil {
+		reader.Close()
+		return nil, err
+	}
+	return &decompressReader{ReadCloser: decompressed, source: reader}, nil
+}
+
+type decompressReader struct {
+	io.ReadCloser
+	source io.Closer
+}
+
+func (r *decompressReader) Close() error {
+	r.ReadCloser.Close()
+	return r.source.Close()
+}
@@ -0,0 +1,89 @@
+package compress
+
+import (
+	"fmt"
+	"path"
+	"strings"
+)
+
+// compressedFormats are the extensions of formats whose content is already compressed, so compressing them again
+// only costs time without saving space
+var compressedFormats = map[string]bool{
+	".7z": true, ".br": true, ".bz2": true, ".gz": true, ".lz4": true, ".lzma": true, ".rar": true, ".tgz": true,
+	".xz": true, ".zip": true, ".zst": true,
+	".avif": true, ".gif": true, ".heic": true, ".jpeg": true, ".jpg": true, ".png": true, ".webp": true,
+	".aac": true, ".flac": true, ".m4a": true, ".mp3": true, ".ogg": true, ".opus": true,
+	".avi": true, ".m4v": true, ".mkv": true, ".mov": true, ".mp4": true, ".webm": true,
+	".apk": true, ".docx": true, ".epub": true, ".jar": true, ".odt": true, ".pptx": true, ".xlsx": true,
+}
+
+// IsCompressedFormat returns true if the extension of the key belongs to a format that is already compressed
+func IsCompressedFormat(key string) bool {
+	return compressedFormats[strings.ToLower(path.Ext(key))]
+}
+
+// Policy selects the algorithm each file of a sync is compressed by
+type Policy struct {
+	algorithm string
+	// rules maps lowercase extensions including their dot to the algorithm of their files
+	rules map[string]string
+}
+
+// ParsePolicy parses the compression of a sync and its rules, a comma separated list of extensions with their
+// algorithm, e.g. ".log=zstd,.csv=gzip,.bin=none"
+func ParsePolicy(algorithm, rules string) (*Policy, error) {
+	if err := Valid(algorithm); err != nil {
+		return nil, err
+	}
+
+	p := &Policy{algorithm: algorithm, rules: make(map[string]string)}
+	for _, rule := range strings.Split(rules, ",") {
+		rule = strings.TrimSpace(rule)
+		if rule == "" {
+			continue
+		}
+
+		ext, alg, ok := strings.Cut(rule, "=")
+		ext, alg = strings.ToLower(strings.TrimSpace(ext)), strings.TrimSpace(alg)
+		if !ok || ext == "" || alg == "" {
+			return nil, fmt.Errorf("invalid compression rule '%s', it must be <extension>=<algorithm>", rule)
+		}
+		if err := Valid(alg); err != nil {
+			return nil, fmt.Errorf("invalid compression rule '%s': %w", rule, err)
+		}
+		if !strings.HasPrefix(ext, ".") {
+			ext = "." + ext
+		}
+		p.rules[ext] = alg
+	}
+	return p, nil
+}
+
+// Enabled returns true if any file may be compressed by the policy
+func (p *Policy) Enabled() bool {
+	if p.algorithm != "" && p.algorithm != None {
+		return true
+	}
+	for _, alg := range p.rules {
+		if alg != None {
+			return true
+		}
+	}
+	return false
+}
+
+// Algorithm returns the algorithm the file at the key is compressed by, or "" if it's stored uncompressed.
+// Rules of the extension take precedence, while files of already compressed formats are only compressed by a rule.
+func (p *Policy) Algorithm(key string) string {
+	alg, ok := p.rules[strings.ToLower(path.Ext(key))]
+	if !ok {
+		if IsCompressedFormat(key) {
+			return ""
+		}
+		alg = p.algorithm
+	}
+	if alg == None {
+		return ""
+	}
+	return alg
+}
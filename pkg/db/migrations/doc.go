@@ -0,0 +1,3 @@
+// Package migrations contains the versioned schema migrations of the GORM based metadata store.
+// Builds with the nogorm tag create the schema from the statements in the store package instead.
+package migrations
@@ -1,8 +1,11 @@
+//go:build !nogorm
+
 package migrations
 
 import (
 	"context"
 	"fmt"
+	"time"
 
 	"github.com/mwantia/gosync/pkg/db/models"
 	"gorm.io/gorm"
@@ -178,5 +181,580 @@ func allMigrations() []Migration {
 				)
 			},
 		},
+		{
+			Version:     2,
+			Description: "Add backend wipe state",
+			Up: func(db *gorm.DB) error {
+				return db.AutoMigrate(&models.Backend{})
+			},
+			Down: func(db *gorm.DB) error {
+				return db.Migrator().DropColumn(&models.Backend{}, "WipeStartedAt")
+			},
+		},
+		{
+			Version:     3,
+			Description: "Add backend trash",
+			Up: func(db *gorm.DB) error {
+				return db.AutoMigrate(&models.Backend{}, &models.TrashItem{})
+			},
+			Down: func(db *gorm.DB) error {
+				if err := db.Migrator().DropTable(&models.TrashItem{}); err != nil {
+					return err
+				}
+				for _, column := range []string{"TrashEnabled", "TrashPrefix", "TrashRetention"} {
+					if err := db.Migrator().DropColumn(&models.Backend{}, column); err != nil {
+						return err
+					}
+				}
+				return nil
+			},
+		},
+		{
+			Version:     4,
+			Description: "Add file version history",
+			Up: func(db *gorm.DB) error {
+				return db.AutoMigrate(&models.File{}, &models.FileEvent{})
+			},
+			Down: func(db *gorm.DB) error {
+				if err := db.Migrator().DropTable(&models.FileEvent{}); err != nil {
+					return err
+				}
+				return db.Migrator().DropColumn(&models.File{}, "VersionID")
+			},
+		},
+		{
+			Version:     5,
+			Description: "Add backend type discriminator",
+			Up: func(db *gorm.DB) error {
+				return db.AutoMigrate(&models.Backend{})
+			},
+			Down: func(db *gorm.DB) error {
+				return db.Migrator().DropColumn(&models.Backend{}, "Type")
+			},
+		},
+		{
+			Version:     6,
+			Description: "Add bandwidth usage rollups",
+			Up: func(db *gorm.DB) error {
+				return db.AutoMigrate(&models.BandwidthUsage{})
+			},
+			Down: func(db *gorm.DB) error {
+				return db.Migrator().DropTable(&models.BandwidthUsage{})
+			},
+		},
+		{
+			Version:     7,
+			Description: "Add backend dns options",
+			Up: func(db *gorm.DB) error {
+				return db.AutoMigrate(&models.Backend{})
+			},
+			Down: func(db *gorm.DB) error {
+				for _, column := range []string{"DNSServer", "IPPreference", "HappyEyeballs", "StaticHosts"} {
+					if err := db.Migrator().DropColumn(&models.Backend{}, column); err != nil {
+						return err
+					}
+				}
+				return nil
+			},
+		},
+		{
+			Version:     8,
+			Description: "Add sync schedules and baselines",
+			Up: func(db *gorm.DB) error {
+				return db.AutoMigrate(&models.SyncConfig{}, &models.SyncBaseline{})
+			},
+			Down: func(db *gorm.DB) error {
+				for _, column := range []string{"Schedule", "Jitter", "Blackout"} {
+					if err := db.Migrator().DropColumn(&models.SyncConfig{}, column); err != nil {
+						return err
+					}
+				}
+				return db.Migrator().DropTable(&models.SyncBaseline{})
+			},
+		},
+		{
+			Version:     9,
+			Description: "Add block signatures for delta sync",
+			Up: func(db *gorm.DB) error {
+				return db.AutoMigrate(&models.SyncConfig{}, &models.FileBlock{})
+			},
+			Down: func(db *gorm.DB) error {
+				if err := db.Migrator().DropColumn(&models.SyncConfig{}, "DeltaThreshold"); err != nil {
+					return err
+				}
+				return db.Migrator().DropTable(&models.FileBlock{})
+			},
+		},
+		{
+			Version:     10,
+			Description: "Add learned backend tuning",
+			Up: func(db *gorm.DB) error {
+				return db.AutoMigrate(&models.BackendTuning{})
+			},
+			Down: func(db *gorm.DB) error {
+				return db.Migrator().DropTable(&models.BackendTuning{})
+			},
+		},
+		{
+			Version:     11,
+			Description: "Add chunk deduplication",
+			Up: func(db *gorm.DB) error {
+				return db.AutoMigrate(&models.File{}, &models.SyncConfig{}, &models.Chunk{}, &models.FileChunk{})
+			},
+			Down: func(db *gorm.DB) error {
+				if err := db.Migrator().DropTable(&models.FileChunk{}, &models.Chunk{}); err != nil {
+					return err
+				}
+				if err := db.Migrator().DropColumn(&models.SyncConfig{}, "Dedup"); err != nil {
+					return err
+				}
+				return db.Migrator().DropColumn(&models.File{}, "Deduplicated")
+			},
+		},
+		{
+			Version:     12,
+			Description: "Add advisory file locks",
+			Up: func(db *gorm.DB) error {
+				return db.AutoMigrate(&models.Lock{})
+			},
+			Down: func(db *gorm.DB) error {
+				return db.Migrator().DropTable(&models.Lock{})
+			},
+		},
+		{
+			Version:     13,
+			Description: "Add client presence",
+			Up: func(db *gorm.DB) error {
+				return db.AutoMigrate(&models.Client{})
+			},
+			Down: func(db *gorm.DB) error {
+				return db.Migrator().DropTable(&models.Client{})
+			},
+		},
+		{
+			Version:     14,
+			Description: "Add per-device isolation of sync configs",
+			Up: func(db *gorm.DB) error {
+				return db.AutoMigrate(&models.SyncConfig{})
+			},
+			Down: func(db *gorm.DB) error {
+				return db.Migrator().DropColumn(&models.SyncConfig{}, "Isolated")
+			},
+		},
+		{
+			Version:     15,
+			Description: "Add unique index on file paths",
+			Up: func(db *gorm.DB) error {
+				// Keep only the latest of duplicate rows created by concurrent writers
+				latest := db.Model(&models.File{}).Select("MAX(id)").Where("deleted_at IS NULL").Group("backend_id, path")
+				if err := db.Unscoped().Where("deleted_at IS NULL AND id NOT IN (?)", latest).Delete(&models.File{}).Error; err != nil {
+					return err
+				}
+				return db.AutoMigrate(&models.File{})
+			},
+			Down: func(db *gorm.DB) error {
+				return db.Migrator().DropIndex(&models.File{}, "idx_file_path")
+			},
+		},
+		{
+			Version:     16,
+			Description: "Add deferred deletions",
+			Up: func(db *gorm.DB) error {
+				return db.AutoMigrate(&models.SyncConfig{}, &models.PendingDeletion{})
+			},
+			Down: func(db *gorm.DB) error {
+				if err := db.Migrator().DropTable(&models.PendingDeletion{}); err != nil {
+					return err
+				}
+				return db.Migrator().DropColumn(&models.SyncConfig{}, "DeleteGrace")
+			},
+		},
+		{
+			Version:     17,
+			Description: "Add selective sync",
+			Up: func(db *gorm.DB) error {
+				return db.AutoMigrate(&models.SyncSelection{})
+			},
+			Down: func(db *gorm.DB) error {
+				return db.Migrator().DropTable(&models.SyncSelection{})
+			},
+		},
+		{
+			Version:     18,
+			Description: "Add API tokens",
+			Up: func(db *gorm.DB) error {
+				return db.AutoMigrate(&models.APIToken{})
+			},
+			Down: func(db *gorm.DB) error {
+				return db.Migrator().DropTable(&models.APIToken{})
+			},
+		},
+		{
+			Version:     19,
+			Description: "Add restore drills",
+			Up: func(db *gorm.DB) error {
+				return db.AutoMigrate(&models.RestoreDrill{})
+			},
+			Down: func(db *gorm.DB) error {
+				return db.Migrator().DropTable(&models.RestoreDrill{})
+			},
+		},
+		{
+			Version:     20,
+			Description: "Add search index cursors",
+			Up: func(db *gorm.DB) error {
+				return db.AutoMigrate(&models.IndexCursor{})
+			},
+			Down: func(db *gorm.DB) error {
+				return db.Migrator().DropTable(&models.IndexCursor{})
+			},
+		},
+		{
+			Version:     21,
+			Description: "Add sync weights",
+			Up: func(db *gorm.DB) error {
+				return db.AutoMigrate(&models.SyncConfig{})
+			},
+			Down: func(db *gorm.DB) error {
+				return db.Migrator().DropColumn(&models.SyncConfig{}, "Weight")
+			},
+		},
+		{
+			Version:     22,
+			Description: "Add sync pass deadlines",
+			Up: func(db *gorm.DB) error {
+				return db.AutoMigrate(&models.SyncConfig{})
+			},
+			Down: func(db *gorm.DB) error {
+				for _, column := range []string{"MaxDuration", "StopAt", "DeadlineGrace"} {
+					if err := db.Migrator().DropColumn(&models.SyncConfig{}, column); err != nil {
+						return err
+					}
+				}
+				return nil
+			},
+		},
+		{
+			Version:     23,
+			Description: "Add sync bootstrap mode",
+			Up: func(db *gorm.DB) error {
+				return db.AutoMigrate(&models.SyncState{})
+			},
+			Down: func(db *gorm.DB) error {
+				return db.Migrator().DropColumn(&models.SyncState{}, "Bootstrap")
+			},
+		},
+		{
+			Version:     24,
+			Description: "Add sync anomaly detection",
+			Up: func(db *gorm.DB) error {
+				return db.AutoMigrate(&models.SyncState{})
+			},
+			Down: func(db *gorm.DB) error {
+				for _, column := range []string{"Anomaly", "AnomalyConfirmed"} {
+					if err := db.Migrator().DropColumn(&models.SyncState{}, column); err != nil {
+						return err
+					}
+				}
+				return nil
+			},
+		},
+		{
+			Version:     25,
+			Description: "Add sync transfer queue order",
+			Up: func(db *gorm.DB) error {
+				return db.AutoMigrate(&models.SyncConfig{})
+			},
+			Down: func(db *gorm.DB) error {
+				return db.Migrator().DropColumn(&models.SyncConfig{}, "QueueOrder")
+			},
+		},
+		{
+			Version:     26,
+			Description: "Add transfer verification",
+			Up: func(db *gorm.DB) error {
+				return db.AutoMigrate(&models.SyncConfig{}, &models.IntegrityError{})
+			},
+			Down: func(db *gorm.DB) error {
+				if err := db.Migrator().DropTable(&models.IntegrityError{}); err != nil {
+					return err
+				}
+				return db.Migrator().DropColumn(&models.SyncConfig{}, "Verify")
+			},
+		},
+		{
+			Version:     27,
+			Description: "Add integrity modes",
+			Up: func(db *gorm.DB) error {
+				return db.AutoMigrate(&models.SyncConfig{}, &models.SyncBaseline{})
+			},
+			Down: func(db *gorm.DB) error {
+				if err := db.Migrator().DropColumn(&models.SyncBaseline{}, "SourceModifiedAt"); err != nil {
+					return err
+				}
+				if err := db.Migrator().DropColumn(&models.SyncBaseline{}, "DestModifiedAt"); err != nil {
+					return err
+				}
+				return db.Migrator().DropColumn(&models.SyncConfig{}, "Integrity")
+			},
+		},
+		{
+			Version:     28,
+			Description: "Add incremental backend scans",
+			Up: func(db *gorm.DB) error {
+				return db.AutoMigrate(&models.SyncState{})
+			},
+			Down: func(db *gorm.DB) error {
+				for _, column := range []string{"ScanCursor", "ScannedAt"} {
+					if err := db.Migrator().DropColumn(&models.SyncState{}, column); err != nil {
+						return err
+					}
+				}
+				return nil
+			},
+		},
+		{
+			Version:     29,
+			Description: "Add sync activity rollups",
+			Up: func(db *gorm.DB) error {
+				return db.AutoMigrate(&models.SyncActivity{})
+			},
+			Down: func(db *gorm.DB) error {
+				return db.Migrator().DropTable(&models.SyncActivity{})
+			},
+		},
+		{
+			Version:     30,
+			Description: "Add local hash cache",
+			Up: func(db *gorm.DB) error {
+				return db.AutoMigrate(&models.LocalHash{})
+			},
+			Down: func(db *gorm.DB) error {
+				return db.Migrator().DropTable(&models.LocalHash{})
+			},
+		},
+		{
+			Version:     31,
+			Description: "Add symlink policies",
+			Up: func(db *gorm.DB) error {
+				return db.AutoMigrate(&models.SyncConfig{})
+			},
+			Down: func(db *gorm.DB) error {
+				return db.Migrator().DropColumn(&models.SyncConfig{}, "Symlinks")
+			},
+		},
+		{
+			Version:     32,
+			Description: "Add POSIX metadata preservation",
+			Up: func(db *gorm.DB) error {
+				return db.AutoMigrate(&models.SyncConfig{}, &models.File{})
+			},
+			Down: func(db *gorm.DB) error {
+				for _, column := range []string{"Mode", "Owner", "Xattrs"} {
+					if err := db.Migrator().DropColumn(&models.File{}, column); err != nil {
+						return err
+					}
+				}
+				return db.Migrator().DropColumn(&models.SyncConfig{}, "Preserve")
+			},
+		},
+		{
+			Version:     33,
+			Description: "Add manifest publishing",
+			Up: func(db *gorm.DB) error {
+				return db.AutoMigrate(&models.SyncConfig{})
+			},
+			Down: func(db *gorm.DB) error {
+				return db.Migrator().DropColumn(&models.SyncConfig{}, "Publish")
+			},
+		},
+		{
+			Version:     34,
+			Description: "Add sparse file maps",
+			Up: func(db *gorm.DB) error {
+				return db.AutoMigrate(&models.File{})
+			},
+			Down: func(db *gorm.DB) error {
+				return db.Migrator().DropColumn(&models.File{}, "Sparse")
+			},
+		},
+		{
+			Version:     35,
+			Description: "Add adaptive polling intervals",
+			Up: func(db *gorm.DB) error {
+				return db.AutoMigrate(&models.SyncState{})
+			},
+			Down: func(db *gorm.DB) error {
+				for _, column := range []string{"PollInterval", "ChangeRate"} {
+					if err := db.Migrator().DropColumn(&models.SyncState{}, column); err != nil {
+						return err
+					}
+				}
+				return nil
+			},
+		},
+		{
+			Version:     36,
+			Description: "Add local change journal cursors",
+			Up: func(db *gorm.DB) error {
+				return db.AutoMigrate(&models.SyncState{})
+			},
+			Down: func(db *gorm.DB) error {
+				return db.Migrator().DropColumn(&models.SyncState{}, "JournalCursor")
+			},
+		},
+		{
+			Version:     37,
+			Description: "Add Unicode path normalization",
+			Up: func(db *gorm.DB) error {
+				// Paths are kept as the keys of their objects, so they are only normalized to compare them
+				return db.AutoMigrate(&models.SyncConfig{})
+			},
+			Down: func(db *gorm.DB) error {
+				return db.Migrator().DropColumn(&models.SyncConfig{}, "Normalization")
+			},
+		},
+		{
+			Version:     38,
+			Description: "Add reserved name policies",
+			Up: func(db *gorm.DB) error {
+				return db.AutoMigrate(&models.SyncConfig{})
+			},
+			Down: func(db *gorm.DB) error {
+				return db.Migrator().DropColumn(&models.SyncConfig{}, "ReservedNames")
+			},
+		},
+		{
+			Version:     39,
+			Description: "Add storage usage and backend quotas",
+			Up: func(db *gorm.DB) error {
+				if err := db.AutoMigrate(&models.Backend{}, &models.StorageUsage{}); err != nil {
+					return err
+				}
+				return db.Exec(storageUsageStatement, time.Now().UTC()).Error
+			},
+			Down: func(db *gorm.DB) error {
+				if err := db.Migrator().DropTable(&models.StorageUsage{}); err != nil {
+					return err
+				}
+				for _, column := range []string{"QuotaSoft", "QuotaHard"} {
+					if err := db.Migrator().DropColumn(&models.Backend{}, column); err != nil {
+						return err
+					}
+				}
+				return nil
+			},
+		},
+		{
+			Version:     40,
+			Description: "Add transfer log",
+			Up: func(db *gorm.DB) error {
+				return db.AutoMigrate(&models.TransferLog{})
+			},
+			Down: func(db *gorm.DB) error {
+				return db.Migrator().DropTable(&models.TransferLog{})
+			},
+		},
+		{
+			Version:     41,
+			Description: "Add device registry",
+			Up: func(db *gorm.DB) error {
+				return db.AutoMigrate(&models.Client{})
+			},
+			Down: func(db *gorm.DB) error {
+				for _, column := range []string{"Name", "MachineID", "RevokedAt", "RevokedReason"} {
+					if err := db.Migrator().DropColumn(&models.Client{}, column); err != nil {
+						return err
+					}
+				}
+				return nil
+			},
+		},
+		{
+			Version:     42,
+			Description: "Add files on demand",
+			Up: func(db *gorm.DB) error {
+				return db.AutoMigrate(&models.SyncConfig{}, &models.SyncBaseline{}, &models.SyncPin{})
+			},
+			Down: func(db *gorm.DB) error {
+				if err := db.Migrator().DropTable(&models.SyncPin{}); err != nil {
+					return err
+				}
+				if err := db.Migrator().DropColumn(&models.SyncBaseline{}, "Placeholder"); err != nil {
+					return err
+				}
+				return db.Migrator().DropColumn(&models.SyncConfig{}, "OnDemand")
+			},
+		},
+		{
+			Version:     43,
+			Description: "Add compression",
+			Up: func(db *gorm.DB) error {
+				return db.AutoMigrate(&models.SyncConfig{}, &models.File{})
+			},
+			Down: func(db *gorm.DB) error {
+				for _, column := range []string{"Compression", "CompressionRules"} {
+					if err := db.Migrator().DropColumn(&models.SyncConfig{}, column); err != nil {
+						return err
+					}
+				}
+				return db.Migrator().DropColumn(&models.File{}, "Compression")
+			},
+		},
+		{
+			Version:     44,
+			Description: "Add include and exclude rules",
+			Up: func(db *gorm.DB) error {
+				return db.AutoMigrate(&models.SyncConfig{})
+			},
+			Down: func(db *gorm.DB) error {
+				for _, column := range []string{"MinSize", "MaxSize", "ModifiedAfter", "ModifiedBefore", "IncludeMime", "ExcludeMime"} {
+					if err := db.Migrator().DropColumn(&models.SyncConfig{}, column); err != nil {
+						return err
+					}
+				}
+				return nil
+			},
+		},
+		{
+			Version:     45,
+			Description: "Backfill file events",
+			Up: func(db *gorm.DB) error {
+				return db.Exec(fileEventStatement).Error
+			},
+			Down: func(db *gorm.DB) error {
+				// Seeded events can't be told apart from recorded ones, so they are kept
+				return nil
+			},
+		},
+		{
+			Version:     46,
+			Description: "Add persistent maintenance mode",
+			Up: func(db *gorm.DB) error {
+				return db.AutoMigrate(&models.Maintenance{})
+			},
+			Down: func(db *gorm.DB) error {
+				return db.Migrator().DropTable(&models.Maintenance{})
+			},
+		},
 	}
 }
+
+// fileEventStatement records a created event for each existing file without history, which were uploaded before
+// the version history was added. Otherwise these files wouldn't exist at any point in time of a restore.
+const fileEventStatement = `INSERT INTO file_events (backend_id, path, type, size, md5_hash, sha256_hash, e_tag, version_id, modified_at, occurred_at)
+	SELECT backend_id, path, 'created', size, md5_hash, sha256_hash, e_tag, version_id, modified_at, COALESCE(created_at, modified_at)
+	FROM files WHERE deleted_at IS NULL AND NOT EXISTS (
+		SELECT 1 FROM file_events WHERE file_events.backend_id = files.backend_id AND file_events.path = files.path
+	)`
+
+// storageUsageStatement sums up the existing files of each backend for all directories containing them,
+// by splitting off one directory of their paths after the other
+const storageUsageStatement = `INSERT INTO storage_usages (backend_id, prefix, parent, objects, bytes, updated_at)
+	WITH RECURSIVE dirs (backend_id, prefix, parent, bytes, rest) AS (
+		SELECT backend_id, '', '', CASE WHEN deduplicated THEN 0 ELSE size END, path FROM files WHERE deleted_at IS NULL
+		UNION ALL
+		SELECT backend_id, CASE WHEN prefix = '' THEN '' ELSE prefix || '/' END || substr(rest, 1, instr(rest, '/') - 1), prefix, bytes,
+			substr(rest, instr(rest, '/') + 1) FROM dirs WHERE instr(rest, '/') > 0
+	)
+	SELECT backend_id, prefix, parent, COUNT(*), SUM(bytes), ? FROM dirs GROUP BY backend_id, prefix`
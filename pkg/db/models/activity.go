@@ -0,0 +1,24 @@
+package models
+
+import "time"
+
+// SyncActivity is the daily rollup of the passes of a sync on a single client
+type SyncActivity struct {
+	ID           uint   `gorm:"primaryKey"`
+	SyncConfigID uint   `gorm:"not null;uniqueIndex:idx_activity_sync_client_day"`
+	ClientID     string `gorm:"type:text;not null;uniqueIndex:idx_activity_sync_client_day"`
+	Day          string `gorm:"type:text;not null;uniqueIndex:idx_activity_sync_client_day;index"` // Calendar day in UTC, e.g. "2024-05-01"
+
+	Passes int64 `gorm:"default:0"`
+	// Added counts files transferred for the first time, Changed counts transfers of files synced before
+	Added     int64 `gorm:"default:0"`
+	Changed   int64 `gorm:"default:0"`
+	Deleted   int64 `gorm:"default:0"`
+	Conflicts int64 `gorm:"default:0"`
+	// Errors counts failed actions and passes as well as operations skipped since access was denied
+	Errors int64 `gorm:"default:0"`
+	Bytes  int64 `gorm:"default:0"`
+
+	CreatedAt time.Time
+	UpdatedAt time.Time
+}
@@ -1,15 +1,15 @@
 package models
 
-import (
-	"time"
+import "time"
 
-	"gorm.io/gorm"
-)
-
-// Backend represents an S3-compatible storage backend configuration
+// Backend represents a storage backend configuration (S3-compatible, Azure Blob, GCS or local).
+// For Azure, AccessKey and SecretKey hold the storage account name and key and Bucket the container.
+// For GCS, SecretKey holds the service account JSON (application default credentials if empty).
+// For local backends, Endpoint holds the target directory and no credentials are used.
 type Backend struct {
 	ID        string `gorm:"primaryKey;type:text"`
 	Name      string `gorm:"type:text;not null"`
+	Type      string `gorm:"type:text;not null;default:'s3'"` // "s3", "azure", "gcs" or "local"
 	Endpoint  string `gorm:"type:text;not null"`
 	Region    string `gorm:"type:text"`
 	Bucket    string `gorm:"type:text;not null"`
@@ -19,9 +19,28 @@ type Backend struct {
 	AccessKey string `gorm:"type:text;not null"`
 	SecretKey string `gorm:"type:text;not null"`
 
+	// DNS options used to resolve and dial the endpoint
+	DNSServer     string `gorm:"type:text"` // Custom resolver, e.g. "192.168.1.1:53"
+	IPPreference  string `gorm:"type:text"` // "ipv4", "ipv6", "ipv4-only" or "ipv6-only"
+	HappyEyeballs bool   `gorm:"default:false"`
+	StaticHosts   string `gorm:"type:text"` // Comma separated "host=ip" pins bypassing DNS
+
+	// Trash settings for deletions propagated by sync
+	TrashEnabled   bool   `gorm:"default:false"`
+	TrashPrefix    string `gorm:"type:text;default:'.gosync-trash/'"`
+	TrashRetention int64  // Seconds before trashed objects are purged (0 = forever), the CLI defaults to 30 days
+
+	// Quotas of the stored bytes: exceeding the soft quota only raises a notification, while writes are held back
+	// once they would exceed the hard quota (0 = unlimited)
+	QuotaSoft int64 `gorm:"default:0"`
+	QuotaHard int64 `gorm:"default:0"`
+
+	// Set while a wipe of this backend is in progress, allowing it to be resumed
+	WipeStartedAt *time.Time
+
 	CreatedAt time.Time
 	UpdatedAt time.Time
-	DeletedAt gorm.DeletedAt `gorm:"index"`
+	DeletedAt DeletedAt `gorm:"index"`
 
 	// Relationships
 	Files []File `gorm:"foreignKey:BackendID;constraint:OnDelete:CASCADE"`
@@ -0,0 +1,18 @@
+package models
+
+import "time"
+
+// FileBlock is the signature of a fixed-size block of a stored object, used for delta transfers
+type FileBlock struct {
+	ID        uint   `gorm:"primaryKey"`
+	BackendID string `gorm:"type:text;not null;uniqueIndex:idx_block_path"`
+	Path      string `gorm:"type:text;not null;uniqueIndex:idx_block_path"`
+	Number    int    `gorm:"not null;uniqueIndex:idx_block_path"`
+
+	Offset int64  `gorm:"not null"`
+	Size   int64  `gorm:"not null"`
+	Hash   string `gorm:"type:text;not null"` // SHA256 of the block
+	ETag   string `gorm:"type:text"`          // ETag of the object the signatures belong to
+
+	CreatedAt time.Time
+}
@@ -0,0 +1,24 @@
+package models
+
+import "time"
+
+// Chunk is a content-addressed part of deduplicated files, stored once per backend
+type Chunk struct {
+	ID        uint   `gorm:"primaryKey"`
+	BackendID string `gorm:"type:text;not null;uniqueIndex:idx_chunk_hash"`
+	Hash      string `gorm:"type:text;not null;uniqueIndex:idx_chunk_hash"` // SHA256 of the chunk content
+	Size      int64  `gorm:"not null"`
+
+	CreatedAt time.Time
+}
+
+// FileChunk references the chunk at a position of a deduplicated file's manifest
+type FileChunk struct {
+	ID       uint `gorm:"primaryKey"`
+	FileID   uint `gorm:"not null;index"`
+	Position int  `gorm:"not null"`
+	ChunkID  uint `gorm:"not null;index"`
+
+	// Relationships
+	Chunk Chunk `gorm:"foreignKey:ChunkID;references:ID"`
+}
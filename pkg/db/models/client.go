@@ -0,0 +1,28 @@
+package models
+
+import "time"
+
+// Client is an agent using the metadata store, kept up to date by periodic heartbeats
+type Client struct {
+	ID   string `gorm:"primaryKey;type:text"` // Client id, the hostname unless it is taken by another device
+	Name string `gorm:"type:text"`            // Name of the device shown by 'gosync devices'
+	// MachineID identifies the device independent of its hostname, derived from the id of its operating system
+	MachineID string `gorm:"type:text"`
+	Version   string `gorm:"type:text"`
+	Platform  string `gorm:"type:text"` // e.g. "linux/amd64"
+	Address   string `gorm:"type:text"` // Address of the agent API
+
+	// Comma separated names of the syncs running during the last heartbeat
+	ActiveSyncs string `gorm:"type:text"`
+
+	StartedAt  time.Time
+	LastSeenAt time.Time  `gorm:"index"`
+	StoppedAt  *time.Time // Set if the agent was shut down gracefully
+
+	// Revoked clients are refused by the metadata store, e.g. after the device was stolen
+	RevokedAt     *time.Time
+	RevokedReason string `gorm:"type:text"`
+
+	CreatedAt time.Time
+	UpdatedAt time.Time
+}
@@ -0,0 +1,8 @@
+//go:build !nogorm
+
+package models
+
+import "gorm.io/gorm"
+
+// DeletedAt marks soft-deleted records, which are hidden from all queries
+type DeletedAt = gorm.DeletedAt
@@ -0,0 +1,24 @@
+//go:build nogorm
+
+package models
+
+import (
+	"database/sql"
+	"database/sql/driver"
+)
+
+// DeletedAt marks soft-deleted records, which are hidden from all queries
+type DeletedAt sql.NullTime
+
+// Scan implements the sql.Scanner interface
+func (d *DeletedAt) Scan(value any) error {
+	return (*sql.NullTime)(d).Scan(value)
+}
+
+// Value implements the driver.Valuer interface
+func (d DeletedAt) Value() (driver.Value, error) {
+	if !d.Valid {
+		return nil, nil
+	}
+	return d.Time, nil
+}
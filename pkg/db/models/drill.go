@@ -0,0 +1,27 @@
+package models
+
+import "time"
+
+// RestoreDrill records a restore drill, which restored a random sample of files of a backend and verified their hashes
+type RestoreDrill struct {
+	ID         uint      `gorm:"primaryKey"`
+	BackendID  string    `gorm:"type:text;not null;index:idx_drill_backend"`
+	StartedAt  time.Time `gorm:"index:idx_drill_backend"`
+	FinishedAt time.Time
+
+	Sampled  int   `gorm:"default:0"`
+	Verified int   `gorm:"default:0"`
+	Failed   int   `gorm:"default:0"`
+	Bytes    int64 `gorm:"default:0"`
+	// Failures lists the failed files as "<path>: <reason>", one per line
+	Failures string `gorm:"type:text"`
+	// Error is set if the drill couldn't be run at all
+	Error string `gorm:"type:text"`
+
+	CreatedAt time.Time
+}
+
+// Passed returns true if the drill has run and all sampled files were restored successfully
+func (d *RestoreDrill) Passed() bool {
+	return d.Error == "" && d.Failed == 0
+}
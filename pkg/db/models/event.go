@@ -0,0 +1,30 @@
+package models
+
+import "time"
+
+// FileEventType describes the kind of change recorded by a FileEvent
+type FileEventType string
+
+const (
+	FileEventCreated  FileEventType = "created"
+	FileEventModified FileEventType = "modified"
+	FileEventDeleted  FileEventType = "deleted"
+)
+
+// FileEvent records a single change of a file, building the version history of a backend
+type FileEvent struct {
+	ID        uint          `gorm:"primaryKey"`
+	BackendID string        `gorm:"type:text;not null;index:idx_event_backend_path"`
+	Path      string        `gorm:"type:text;not null;index:idx_event_backend_path"`
+	Type      FileEventType `gorm:"type:text;not null"`
+
+	// File metadata at the time of the event
+	Size       int64  `gorm:"not null"`
+	MD5Hash    string `gorm:"type:text"`
+	SHA256Hash string `gorm:"type:text"`
+	ETag       string `gorm:"type:text"`
+	VersionID  string `gorm:"type:text"`
+	ModifiedAt time.Time
+
+	OccurredAt time.Time `gorm:"not null;index"`
+}
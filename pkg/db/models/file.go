@@ -1,30 +1,41 @@
 package models
 
-import (
-	"time"
-
-	"gorm.io/gorm"
-)
+import "time"
 
 // File represents metadata for a file stored in a backend
 type File struct {
 	ID         uint   `gorm:"primaryKey"`
-	BackendID  string `gorm:"type:text;not null;index:idx_backend_path"`
-	Path       string `gorm:"type:text;not null;index:idx_backend_path"`
+	BackendID  string `gorm:"type:text;not null;index:idx_backend_path;uniqueIndex:idx_file_path,where:deleted_at IS NULL"`
+	Path       string `gorm:"type:text;not null;index:idx_backend_path;uniqueIndex:idx_file_path,where:deleted_at IS NULL"`
 
 	// File metadata
 	Size       int64  `gorm:"not null"`
 	MD5Hash    string `gorm:"type:text"`
 	SHA256Hash string `gorm:"type:text"`
 	ETag       string `gorm:"type:text"`
+	VersionID  string `gorm:"type:text"` // Object version if the bucket has versioning enabled
+
+	// Deduplicated files are stored as chunk manifest, with Size and hashes describing the content
+	Deduplicated bool `gorm:"default:false"`
+	// Compressed files are stored by this algorithm, with Size and hashes describing the uncompressed content
+	Compression string `gorm:"type:text"`
+
+	// POSIX metadata of the local file the object was uploaded from, only recorded by syncs preserving it
+	Mode   uint32 `gorm:"default:0"` // Permission bits including setuid, setgid and sticky bit (0 = not recorded)
+	Owner  string `gorm:"type:text"` // Numeric owner and group, e.g. "1000:1000"
+	Xattrs string `gorm:"type:text"` // Extended attributes as JSON object of base64 encoded values
+
+	// Data extents of sparse local files as JSON, so downloads recreate their holes ("" = not sparse)
+	Sparse string `gorm:"type:text"`
 
 	// Timestamps
 	ModifiedAt time.Time
 	CreatedAt  time.Time
 	UpdatedAt  time.Time
-	DeletedAt  gorm.DeletedAt `gorm:"index"`
+	DeletedAt  DeletedAt `gorm:"index"`
 
 	// Relationships
 	Backend Backend `gorm:"foreignKey:BackendID;references:ID"`
 	Tags    []Tag   `gorm:"foreignKey:FileID;constraint:OnDelete:CASCADE"`
+	Chunks  []FileChunk `gorm:"foreignKey:FileID;constraint:OnDelete:CASCADE"`
 }
@@ -1,10 +1,6 @@
 package models
 
-import (
-	"time"
-
-	"gorm.io/gorm"
-)
+import "time"
 
 // Filter represents a dynamic virtual path based on tag queries
 type Filter struct {
@@ -16,5 +12,5 @@ type Filter struct {
 
 	CreatedAt time.Time
 	UpdatedAt time.Time
-	DeletedAt gorm.DeletedAt `gorm:"index"`
+	DeletedAt DeletedAt `gorm:"index"`
 }
@@ -0,0 +1,17 @@
+package models
+
+import "time"
+
+// LocalHash caches the checksums of a local file, which stay valid as long as its size, modification time and inode
+// are unchanged, so unchanged files aren't read again by every pass
+type LocalHash struct {
+	Path       string `gorm:"primaryKey;type:text"` // Absolute path of the file
+	Size       int64  `gorm:"not null"`
+	ModifiedAt time.Time
+	// Inode of the file, 0 on platforms without inodes
+	Inode      uint64 `gorm:"default:0"`
+	MD5Hash    string `gorm:"type:text"`
+	SHA256Hash string `gorm:"type:text"`
+
+	HashedAt time.Time
+}
@@ -0,0 +1,12 @@
+package models
+
+import "time"
+
+// IndexCursor is the position of a search indexer within the change feed of file events
+type IndexCursor struct {
+	Name string `gorm:"primaryKey;type:text"`
+	// EventID is the last file event pushed into the search index
+	EventID uint `gorm:"not null;default:0"`
+
+	UpdatedAt time.Time
+}
@@ -0,0 +1,19 @@
+package models
+
+import "time"
+
+// IntegrityError records a transfer whose content didn't match the checksums of its source after it was written
+type IntegrityError struct {
+	ID           uint      `gorm:"primaryKey"`
+	SyncConfigID uint      `gorm:"not null;index:idx_integrity_sync"`
+	ClientID     string    `gorm:"type:text;not null"`
+	Path         string    `gorm:"type:text;not null"` // Key of the written object within its side
+	DetectedAt   time.Time `gorm:"index:idx_integrity_sync"`
+
+	// Check that failed, "size", "md5" or "sha256"
+	Check    string `gorm:"type:text;not null"`
+	Expected string `gorm:"type:text"`
+	Actual   string `gorm:"type:text"`
+
+	CreatedAt time.Time
+}
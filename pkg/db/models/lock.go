@@ -0,0 +1,18 @@
+package models
+
+import "time"
+
+// Lock is an advisory lock on a file, held by a client while the file is being edited
+type Lock struct {
+	ID        uint   `gorm:"primaryKey"`
+	BackendID string `gorm:"type:text;not null;uniqueIndex:idx_lock_path"`
+	Path      string `gorm:"type:text;not null;uniqueIndex:idx_lock_path"`
+	Owner     string `gorm:"type:text;not null"` // Displayed to other clients, e.g. "alice@laptop"
+	ClientID  string `gorm:"type:text;not null"`
+
+	AcquiredAt time.Time
+	ExpiresAt  time.Time `gorm:"index"`
+
+	CreatedAt time.Time
+	UpdatedAt time.Time
+}
@@ -0,0 +1,11 @@
+package models
+
+import "time"
+
+// Maintenance records the maintenance mode of a client, so it survives restarts of its agent and
+// commands changing backends refuse to run on the client while it's set
+type Maintenance struct {
+	ClientID string    `gorm:"primaryKey;type:text"`
+	Reason   string    `gorm:"type:text"`
+	Since    time.Time `gorm:"not null"`
+}
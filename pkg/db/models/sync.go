@@ -1,10 +1,6 @@
 package models
 
-import (
-	"time"
-
-	"gorm.io/gorm"
-)
+import "time"
 
 // SyncConfig represents a sync mirror configuration between source and destination
 type SyncConfig struct {
@@ -13,20 +9,67 @@ type SyncConfig struct {
 	SourcePath  string `gorm:"type:text;not null"` // Virtual path (backend/path or filter/path)
 	DestPath    string `gorm:"type:text;not null"` // Local or virtual path
 	Direction   string `gorm:"type:text;not null"` // "bidirectional", "download", "upload"
+	// Store the files of each client within devices/<client-id>/ of the source backend
+	Isolated    bool   `gorm:"default:false"`
 	Enabled     bool   `gorm:"default:true"`
 
 	// Sync settings
-	Interval      int64  `gorm:"not null"` // Seconds between syncs
+	Interval      int64  `gorm:"not null"` // Seconds between syncs, used if no schedule is set
+	Schedule      string `gorm:"type:text"` // Cron expression, e.g. "0 2 * * *"
+	Jitter        int64  `gorm:"default:0"` // Maximum random delay in seconds added to each run
+	Blackout      string `gorm:"type:text"` // Windows without transfers, e.g. "Mon-Fri 08:00-18:00"
+	// Soft deadlines after which a pass stops starting transfers, either relative to its start or at a time of day.
+	// The hard deadline cancels in-flight transfers once the grace period after the soft deadline has passed.
+	MaxDuration   int64  `gorm:"default:0"` // Seconds a pass may start transfers (0 = unlimited)
+	StopAt        string `gorm:"type:text"` // Time of day, e.g. "07:00"
+	DeadlineGrace int64  `gorm:"default:0"` // Seconds in-flight transfers may continue after the soft deadline (0 = until they finish)
 	Workers       int    `gorm:"default:4"`
-	ChunkSize     int64  `gorm:"default:5242880"` // 5MB default
+	Weight        int    `gorm:"default:1"` // Share of the agent's worker pool relative to other syncs
+	QueueOrder    string `gorm:"type:text"` // Order of queued transfers, "smallest" or "newest" (default: planned order)
+	ChunkSize     int64  `gorm:"default:5242880"` // Block size of delta transfers, 5MB default
 	IgnorePattern string `gorm:"type:text"` // Glob pattern for ignoring files
+	DeleteGrace   int64  `gorm:"default:0"` // Seconds a deletion stays pending before it is propagated (0 deletes right away)
+
+	// Files outside of these bounds are skipped on both sides like ignored files, 0 or "" disabling a bound
+	MinSize        int64  `gorm:"default:0"` // Bytes
+	MaxSize        int64  `gorm:"default:0"` // Bytes
+	ModifiedAfter  string `gorm:"type:text"` // Absolute like "2024-01-01" or relative like "now-30d"
+	ModifiedBefore string `gorm:"type:text"`
+	IncludeMime    string `gorm:"type:text"` // Comma separated MIME types of synced files, e.g. "image/*,video/*"
+	ExcludeMime    string `gorm:"type:text"` // Comma separated MIME types of skipped files
+
+	// Files of at least this size only transfer changed blocks (0 disables delta sync)
+	DeltaThreshold int64 `gorm:"default:67108864"` // 64MB default
+	// Store uploaded files as content-defined chunks, sharing identical chunks across files
+	Dedup bool `gorm:"default:false"`
+	// Compress uploaded files, "zstd", "gzip" or "" (default) for none
+	Compression string `gorm:"type:text"`
+	// Algorithms of files by extension overriding the compression, e.g. ".log=zstd,.csv=gzip,.bin=none"
+	CompressionRules string `gorm:"type:text"`
+	// Verify transferred files against the checksums of their source, "off" (default), "sampled" or "always"
+	Verify string `gorm:"type:text"`
+	// How changes are detected, "fast" (size and modification time), "standard" (ETag, default) or "paranoid" (content hashes)
+	Integrity string `gorm:"type:text"`
+	// How symbolic links within local directories are synced, "skip" (default), "follow" or "preserve" (as link target)
+	Symlinks string `gorm:"type:text"`
+	// Unicode normalization of paths, "nfc" (default), "nfd" or "none" to compare paths byte by byte
+	Normalization string `gorm:"type:text"`
+	// How names Windows doesn't allow are stored in local directories on Windows, "escape" (default) or "error"
+	ReservedNames string `gorm:"type:text"`
+	// POSIX metadata of local files kept across clients, comma separated list of "mode", "owner" and "xattrs" (default: none)
+	Preserve string `gorm:"type:text"`
+	// Write a signed manifest of all files to the destination backend after each successful upload pass
+	Publish bool `gorm:"default:false"`
+	// Keep files as empty placeholders within the local destination until they are opened or pinned (files on demand)
+	OnDemand bool `gorm:"default:false"`
 
 	CreatedAt time.Time
 	UpdatedAt time.Time
-	DeletedAt gorm.DeletedAt `gorm:"index"`
+	DeletedAt DeletedAt `gorm:"index"`
 
 	// Relationships
-	States []SyncState `gorm:"foreignKey:SyncConfigID;constraint:OnDelete:CASCADE"`
+	States     []SyncState     `gorm:"foreignKey:SyncConfigID;constraint:OnDelete:CASCADE"`
+	Selections []SyncSelection `gorm:"foreignKey:SyncConfigID;constraint:OnDelete:CASCADE"`
 }
 
 // SyncState tracks per-client, per-backend sync cursor for resumability
@@ -44,6 +87,19 @@ type SyncState struct {
 	BytesSynced   int64  `gorm:"default:0"`
 	ErrorCount    int    `gorm:"default:0"`
 	LastError     string `gorm:"type:text"`
+	// Set while a replaced or new client only downloads until it reached parity with the source
+	Bootstrap     bool   `gorm:"default:false"`
+	// Set while passes are paused, since the last pass looked like an accidental mass change
+	Anomaly          string `gorm:"type:text"`
+	AnomalyConfirmed bool   `gorm:"default:false"` // The next pass is applied regardless of the heuristics
+	// Last prefix completed by an interrupted scan of the backends, which the next scan continues after
+	ScanCursor string `gorm:"type:text"`
+	ScannedAt  time.Time
+	// Polling interval in seconds learned from the change rate of the source, 0 until the first scheduled pass
+	PollInterval int     `gorm:"default:0"`
+	ChangeRate   float64 `gorm:"default:0"` // Moving average of the share of scheduled passes that applied changes
+	// Position of the change journal of the local side after the last complete pass, see engine.journalCursor
+	JournalCursor string `gorm:"type:text"`
 
 	CreatedAt time.Time
 	UpdatedAt time.Time
@@ -51,3 +107,72 @@ type SyncState struct {
 	// Relationships
 	SyncConfig SyncConfig `gorm:"foreignKey:SyncConfigID;references:ID"`
 }
+
+// SyncBaseline records the state of a path on both sides after its last successful sync,
+// allowing changes and deletions to be detected per side
+type SyncBaseline struct {
+	ID           uint   `gorm:"primaryKey"`
+	SyncConfigID uint   `gorm:"not null;uniqueIndex:idx_baseline_path"`
+	ClientID     string `gorm:"type:text;not null;uniqueIndex:idx_baseline_path"`
+	Path         string `gorm:"type:text;not null;uniqueIndex:idx_baseline_path"` // Relative to both sides
+
+	Size       int64  `gorm:"not null"`
+	SourceETag string `gorm:"type:text"`
+	DestETag   string `gorm:"type:text"`
+	// Modification times of both sides, compared by syncs in the fast integrity mode
+	SourceModifiedAt time.Time
+	DestModifiedAt   time.Time
+	SyncedAt         time.Time
+	// The destination only holds an empty placeholder of the file, whose content is downloaded on demand
+	Placeholder bool `gorm:"default:false"`
+
+	CreatedAt time.Time
+	UpdatedAt time.Time
+}
+
+// PendingDeletion is a deletion detected by a sync pass, which is only propagated once its grace period has passed
+type PendingDeletion struct {
+	ID           uint   `gorm:"primaryKey"`
+	SyncConfigID uint   `gorm:"not null;uniqueIndex:idx_pending_path"`
+	ClientID     string `gorm:"type:text;not null;uniqueIndex:idx_pending_path"`
+	Path         string `gorm:"type:text;not null;uniqueIndex:idx_pending_path"` // Relative to both sides
+	Side         string `gorm:"type:text;not null"`                              // Side the object is deleted from, "source" or "dest"
+
+	DetectedAt time.Time
+	DueAt      time.Time `gorm:"index"`
+
+	CreatedAt time.Time
+	UpdatedAt time.Time
+}
+
+// Modes of a SyncSelection
+const (
+	SelectionInclude = "include"
+	SelectionExclude = "exclude"
+)
+
+// SyncSelection includes or excludes a directory of a sync (selective sync). If any directory
+// is included, only included directories are synced. The most specific selection of a path wins.
+type SyncSelection struct {
+	ID           uint   `gorm:"primaryKey"`
+	SyncConfigID uint   `gorm:"not null;uniqueIndex:idx_selection_path"`
+	Path         string `gorm:"type:text;not null;uniqueIndex:idx_selection_path"` // Directory relative to both sides
+	Mode         string `gorm:"type:text;not null"`                                // "include" or "exclude"
+
+	CreatedAt time.Time
+	UpdatedAt time.Time
+}
+
+// SyncPin keeps the files below a path of a sync in files-on-demand mode available offline on a client.
+// Unpinned paths free up the space of their files once with the next pass, after which they are removed.
+// The most specific pin of a path wins.
+type SyncPin struct {
+	ID           uint   `gorm:"primaryKey"`
+	SyncConfigID uint   `gorm:"not null;uniqueIndex:idx_pin_path"`
+	ClientID     string `gorm:"type:text;not null;uniqueIndex:idx_pin_path"`
+	Path         string `gorm:"type:text;not null;uniqueIndex:idx_pin_path"` // File or directory relative to both sides
+	Pinned       bool   `gorm:"not null"`
+
+	CreatedAt time.Time
+	UpdatedAt time.Time
+}
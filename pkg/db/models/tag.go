@@ -1,10 +1,6 @@
 package models
 
-import (
-	"time"
-
-	"gorm.io/gorm"
-)
+import "time"
 
 // Tag represents a key-value tag attached to a file
 type Tag struct {
@@ -15,7 +11,7 @@ type Tag struct {
 
 	CreatedAt time.Time
 	UpdatedAt time.Time
-	DeletedAt gorm.DeletedAt `gorm:"index"`
+	DeletedAt DeletedAt `gorm:"index"`
 
 	// Relationships
 	File File `gorm:"foreignKey:FileID;references:ID"`
@@ -0,0 +1,19 @@
+package models
+
+import "time"
+
+// APIToken authenticates requests to the agent API. Only the SHA-256 hash of the token is stored.
+type APIToken struct {
+	ID     uint   `gorm:"primaryKey"`
+	Name   string `gorm:"type:text;not null;uniqueIndex"`
+	Hash   string `gorm:"type:text;not null;uniqueIndex"`
+	Prefix string `gorm:"type:text;not null"` // First characters of the token, used to identify it
+	Scope  string `gorm:"type:text;not null"` // "read-only", "sync-control" or "admin"
+
+	ExpiresAt  *time.Time // Never expires if not set
+	LastUsedAt *time.Time
+	RevokedAt  *time.Time
+
+	CreatedAt time.Time
+	UpdatedAt time.Time
+}
@@ -0,0 +1,30 @@
+package models
+
+import "time"
+
+// Results of transfer log entries
+const (
+	TransferSucceeded = "succeeded"
+	TransferFailed    = "failed"
+)
+
+// TransferLog records a single upload, download, deletion or conflict resolution applied by a sync pass,
+// building the audit log of all clients sharing the database
+type TransferLog struct {
+	ID           uint   `gorm:"primaryKey"`
+	SyncConfigID uint   `gorm:"not null;index:idx_transfer_sync"`
+	ClientID     string `gorm:"type:text;not null"` // Client that applied the operation
+	// Operation is the type of the applied action, e.g. "upload", "delete-dest" or "conflict"
+	Operation string `gorm:"type:text;not null"`
+
+	// Paths of the file within the source and destination of the sync, either virtual or local paths
+	Source      string `gorm:"type:text;not null"`
+	Destination string `gorm:"type:text;not null"`
+	// Bytes transferred, which are only partially transferred for failed operations
+	Bytes  int64  `gorm:"default:0"`
+	Result string `gorm:"type:text;not null"`
+	Error  string `gorm:"type:text"`
+
+	StartedAt  time.Time
+	FinishedAt time.Time `gorm:"not null;index"`
+}
@@ -0,0 +1,21 @@
+package models
+
+import "time"
+
+// TrashItem represents a remote object that has been moved into the trash prefix of its backend
+type TrashItem struct {
+	ID        uint   `gorm:"primaryKey"`
+	BackendID string `gorm:"type:text;not null;index:idx_trash_backend_path"`
+	Path      string `gorm:"type:text;not null;index:idx_trash_backend_path"` // Original object key
+	TrashKey  string `gorm:"type:text;not null"`                              // Object key within the trash prefix
+	Size      int64  `gorm:"not null"`
+	ETag      string `gorm:"type:text"`
+
+	TrashedAt time.Time `gorm:"not null"`
+	ExpiresAt time.Time `gorm:"index"` // Zero if the item is retained forever
+
+	CreatedAt time.Time
+
+	// Relationships
+	Backend Backend `gorm:"foreignKey:BackendID;references:ID"`
+}
@@ -0,0 +1,15 @@
+package models
+
+import "time"
+
+// BackendTuning holds the transfer parameters learned from measured throughput and latency of a backend
+type BackendTuning struct {
+	BackendID string `gorm:"primaryKey;type:text"`
+
+	ChunkSize  int64   `gorm:"not null"`  // Part size for multipart uploads and ranged downloads
+	Throughput float64 `gorm:"default:0"` // Bytes per second
+	Latency    float64 `gorm:"default:0"` // Seconds per request
+	Samples    int64   `gorm:"default:0"`
+
+	UpdatedAt time.Time
+}
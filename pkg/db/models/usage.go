@@ -0,0 +1,33 @@
+package models
+
+import "time"
+
+// BandwidthUsage is the monthly rollup of transferred bytes and API calls of a backend
+type BandwidthUsage struct {
+	ID        uint   `gorm:"primaryKey"`
+	BackendID string `gorm:"type:text;not null;uniqueIndex:idx_usage_backend_month"`
+	Month     string `gorm:"type:text;not null;uniqueIndex:idx_usage_backend_month"` // Calendar month in UTC, e.g. "2024-05"
+
+	BytesUploaded   int64 `gorm:"default:0"`
+	BytesDownloaded int64 `gorm:"default:0"`
+	APICalls        int64 `gorm:"default:0"`
+
+	CreatedAt time.Time
+	UpdatedAt time.Time
+}
+
+// StorageUsage is the number and size of the objects of a backend below a directory, maintained along with the file
+// records of the backend. Deduplicated files count as objects without bytes, since their content is stored as chunks.
+type StorageUsage struct {
+	ID        uint   `gorm:"primaryKey"`
+	BackendID string `gorm:"type:text;not null;uniqueIndex:idx_storage_usage_prefix;index:idx_storage_usage_parent"`
+	// Prefix is the directory without trailing slash, "" for the whole backend
+	Prefix string `gorm:"type:text;not null;uniqueIndex:idx_storage_usage_prefix"`
+	// Parent is the directory containing the prefix, "" for the whole backend and its top-level directories
+	Parent string `gorm:"type:text;not null;index:idx_storage_usage_parent"`
+
+	Objects int64 `gorm:"default:0"`
+	Bytes   int64 `gorm:"default:0"`
+
+	UpdatedAt time.Time
+}
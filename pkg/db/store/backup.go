@@ -0,0 +1,99 @@
+package store
+
+import (
+	"context"
+	"fmt"
+	"runtime"
+	"time"
+	"unsafe"
+
+	"modernc.org/libc"
+	sqlite3 "modernc.org/sqlite/lib"
+)
+
+// backupBusyTimeout is the time the backup waits for locks held by writers before retrying
+const backupBusyTimeout = 5 * time.Second
+
+// onlineBackup copies the database at srcPath to destPath with the sqlite3_backup API of the library linked by the
+// driver, which doesn't expose the API on its connections. The source is opened with a connection of its own and
+// all pages are copied within a single step, so writes of the store during the backup don't restart it.
+func onlineBackup(ctx context.Context, srcPath, destPath string) error {
+	tls := libc.NewTLS()
+	defer tls.Close()
+
+	src, err := openBackupConn(tls, srcPath, sqlite3.SQLITE_OPEN_READONLY|sqlite3.SQLITE_OPEN_URI)
+	if err != nil {
+		return fmt.Errorf("failed to open database: %w", err)
+	}
+	defer sqlite3.Xsqlite3_close_v2(tls, src)
+
+	dest, err := openBackupConn(tls, destPath, sqlite3.SQLITE_OPEN_READWRITE|sqlite3.SQLITE_OPEN_CREATE)
+	if err != nil {
+		return fmt.Errorf("failed to create backup: %w", err)
+	}
+	defer sqlite3.Xsqlite3_close_v2(tls, dest)
+
+	name, err := libc.CString("main")
+	if err != nil {
+		return err
+	}
+	defer libc.Xfree(tls, name)
+
+	backup := sqlite3.Xsqlite3_backup_init(tls, dest, name, src, name)
+	if backup == 0 {
+		return backupError(tls, dest)
+	}
+
+	for {
+		rc := sqlite3.Xsqlite3_backup_step(tls, backup, -1)
+		if rc == sqlite3.SQLITE_DONE {
+			break
+		}
+		if rc != sqlite3.SQLITE_OK && rc != sqlite3.SQLITE_BUSY && rc != sqlite3.SQLITE_LOCKED {
+			sqlite3.Xsqlite3_backup_finish(tls, backup)
+			return backupError(tls, dest)
+		}
+
+		// Writers are holding locks on the source, the step is retried once they are released
+		select {
+		case <-ctx.Done():
+			sqlite3.Xsqlite3_backup_finish(tls, backup)
+			return ctx.Err()
+		case <-time.After(100 * time.Millisecond):
+		}
+	}
+
+	if rc := sqlite3.Xsqlite3_backup_finish(tls, backup); rc != sqlite3.SQLITE_OK {
+		return backupError(tls, dest)
+	}
+	return nil
+}
+
+func openBackupConn(tls *libc.TLS, path string, flags int32) (uintptr, error) {
+	name, err := libc.CString(path)
+	if err != nil {
+		return 0, err
+	}
+	defer libc.Xfree(tls, name)
+
+	// The handle is written to a heap value, which isn't moved and is kept alive for the call
+	handle := new(uintptr)
+	rc := sqlite3.Xsqlite3_open_v2(tls, name, uintptr(unsafe.Pointer(handle)), flags, 0)
+	runtime.KeepAlive(handle)
+	db := *handle
+	if rc != sqlite3.SQLITE_OK {
+		err := backupError(tls, db)
+		sqlite3.Xsqlite3_close_v2(tls, db)
+		return 0, err
+	}
+	sqlite3.Xsqlite3_busy_timeout(tls, db, int32(backupBusyTimeout/time.Millisecond))
+	return db, nil
+}
+
+// backupError returns the latest error of the connection
+func backupError(tls *libc.TLS, db uintptr) error {
+	if db == 0 {
+		return fmt.Errorf("out of memory")
+	}
+	return fmt.Errorf("%s", libc.GoString(sqlite3.Xsqlite3_errmsg(tls, db)))
+}
@@ -2,10 +2,15 @@ package store
 
 import (
 	"context"
+	"errors"
+	"time"
 
 	"github.com/mwantia/gosync/pkg/db/models"
 )
 
+// ErrClientRevoked is returned if a revoked client records its presence
+var ErrClientRevoked = errors.New("client was revoked")
+
 // MetadataStore defines the interface for database operations
 type MetadataStore interface {
 	// Lifecycle
@@ -13,6 +18,8 @@ type MetadataStore interface {
 	Close() error
 	Migrate(ctx context.Context) error
 	Health(ctx context.Context) error
+	// Backup writes a consistent copy of the database to destPath while it stays in use
+	Backup(ctx context.Context, destPath string) error
 
 	// Backend operations
 	CreateBackend(ctx context.Context, backend *models.Backend) error
@@ -20,14 +27,48 @@ type MetadataStore interface {
 	ListBackends(ctx context.Context) ([]models.Backend, error)
 	UpdateBackend(ctx context.Context, backend *models.Backend) error
 	DeleteBackend(ctx context.Context, id string) error
+	BeginBackendWipe(ctx context.Context, id string) (int64, error)
+	CompleteBackendWipe(ctx context.Context, id string) error
+	ListBackendTunings(ctx context.Context) ([]models.BackendTuning, error)
+	SaveBackendTuning(ctx context.Context, tuning *models.BackendTuning) error
 
 	// File operations
 	CreateFile(ctx context.Context, file *models.File) error
 	GetFile(ctx context.Context, backendID, path string) (*models.File, error)
-	ListFiles(ctx context.Context, backendID, pathPrefix string, limit, offset int) ([]models.File, error)
+	// ListFiles returns the files matching the filter in the order of filter.Sort, of all backends if backendID is empty
+	ListFiles(ctx context.Context, backendID string, filter FileFilter, limit, offset int) ([]models.File, error)
+	IterateFiles(ctx context.Context, backendID, pathPrefix string, fn func(file *models.File) error) error
 	UpdateFile(ctx context.Context, file *models.File) error
+	UpsertFile(ctx context.Context, file *models.File) error
+	// UpsertFiles records all files within a single transaction, skipping files that are already recorded with the
+	// same ETag, which keeps their recorded hashes. Returns the number of created or modified files.
+	UpsertFiles(ctx context.Context, files []models.File) (int, error)
 	DeleteFile(ctx context.Context, id uint) error
 	DeleteFilesByBackend(ctx context.Context, backendID string) error
+	FindFilesByHash(ctx context.Context, backendID, sha256Hash string) ([]models.File, error)
+
+	// Chunk operations
+	GetChunk(ctx context.Context, backendID, hash string) (*models.Chunk, error)
+	CreateChunk(ctx context.Context, chunk *models.Chunk) error
+	ListFileChunks(ctx context.Context, fileID uint) ([]models.Chunk, error)
+	SetFileChunks(ctx context.Context, fileID uint, chunkIDs []uint) error
+	// ListUnreferencedChunks returns chunks of the backend created before the time that no file references
+	ListUnreferencedChunks(ctx context.Context, backendID string, before time.Time, limit int) ([]models.Chunk, error)
+	// DeleteChunk deletes the chunk unless a file references it by now, returning whether it was deleted
+	DeleteChunk(ctx context.Context, id uint) (bool, error)
+
+	// File block operations
+	ListFileBlocks(ctx context.Context, backendID, path string) ([]models.FileBlock, error)
+	ReplaceFileBlocks(ctx context.Context, backendID, path string, blocks []models.FileBlock) error
+
+	// File history operations
+	ListFileEvents(ctx context.Context, backendID, pathPrefix string, since, until time.Time) ([]models.FileEvent, error)
+	ListFilesAt(ctx context.Context, backendID, pathPrefix string, at time.Time) ([]models.FileEvent, error)
+	ListDeletedFiles(ctx context.Context, backendID, pathPrefix string, since time.Time) ([]models.File, error)
+	// ListFileEventsAfter returns up to limit events of all backends with an id greater than afterID, in order
+	ListFileEventsAfter(ctx context.Context, afterID uint, limit int) ([]models.FileEvent, error)
+	// LatestFileEventID returns the id of the latest event of all backends (0 if none exist)
+	LatestFileEventID(ctx context.Context) (uint, error)
 
 	// Tag operations
 	CreateTag(ctx context.Context, tag *models.Tag) error
@@ -43,6 +84,82 @@ type MetadataStore interface {
 	UpdateFilter(ctx context.Context, filter *models.Filter) error
 	DeleteFilter(ctx context.Context, id uint) error
 
+	// Trash operations
+	CreateTrashItem(ctx context.Context, item *models.TrashItem) error
+	GetTrashItem(ctx context.Context, id uint) (*models.TrashItem, error)
+	ListTrashItems(ctx context.Context, backendID, pathPrefix string) ([]models.TrashItem, error)
+	ListExpiredTrashItems(ctx context.Context, backendID string, before time.Time, limit int) ([]models.TrashItem, error)
+	DeleteTrashItem(ctx context.Context, id uint) error
+
+	// Client operations
+	// SaveClient records the presence of the client, returning ErrClientRevoked without changes if it was revoked
+	SaveClient(ctx context.Context, client *models.Client) error
+	ListClients(ctx context.Context) ([]models.Client, error)
+	// RevokeClient revokes the client at revokedAt, or restores it if revokedAt is nil
+	RevokeClient(ctx context.Context, id string, revokedAt *time.Time, reason string) error
+
+	// Maintenance operations
+	// GetMaintenance returns the maintenance mode of the client, or ErrNotFound if it isn't in maintenance mode
+	GetMaintenance(ctx context.Context, clientID string) (*models.Maintenance, error)
+	SaveMaintenance(ctx context.Context, maintenance *models.Maintenance) error
+	DeleteMaintenance(ctx context.Context, clientID string) error
+
+	// Lock operations
+	CreateLock(ctx context.Context, lock *models.Lock) error
+	GetLock(ctx context.Context, backendID, path string) (*models.Lock, error)
+	ListLocks(ctx context.Context, backendID, pathPrefix string) ([]models.Lock, error)
+	UpdateLock(ctx context.Context, lock *models.Lock) error
+	DeleteLock(ctx context.Context, id uint) error
+
+	// API token operations
+	CreateAPIToken(ctx context.Context, token *models.APIToken) error
+	GetAPIToken(ctx context.Context, name string) (*models.APIToken, error)
+	GetAPITokenByHash(ctx context.Context, hash string) (*models.APIToken, error)
+	ListAPITokens(ctx context.Context) ([]models.APIToken, error)
+	UpdateAPIToken(ctx context.Context, token *models.APIToken) error
+
+	// Restore drill operations
+	CreateRestoreDrill(ctx context.Context, drill *models.RestoreDrill) error
+	// ListRestoreDrills returns the latest drills first, of all backends if backendID is empty
+	ListRestoreDrills(ctx context.Context, backendID string, limit int) ([]models.RestoreDrill, error)
+
+	// Integrity error operations
+	CreateIntegrityError(ctx context.Context, integrity *models.IntegrityError) error
+	// ListIntegrityErrors returns the latest integrity errors first, of all syncs if syncConfigID is 0
+	ListIntegrityErrors(ctx context.Context, syncConfigID uint, limit int) ([]models.IntegrityError, error)
+
+	// Search index operations
+	GetIndexCursor(ctx context.Context, name string) (*models.IndexCursor, error)
+	SaveIndexCursor(ctx context.Context, cursor *models.IndexCursor) error
+	DeleteIndexCursor(ctx context.Context, name string) error
+
+	// Bandwidth usage operations
+	AddBandwidthUsage(ctx context.Context, usage *models.BandwidthUsage) error
+	ListBandwidthUsage(ctx context.Context, backendID, fromMonth, toMonth string) ([]models.BandwidthUsage, error)
+
+	// Storage usage operations
+	// GetStorageUsage returns the usage of the backend below the prefix ("" for the whole backend), zero if it's empty
+	GetStorageUsage(ctx context.Context, backendID, prefix string) (*models.StorageUsage, error)
+	// ListStorageUsage returns the usage of the directories directly within the prefix, ordered by prefix
+	ListStorageUsage(ctx context.Context, backendID, prefix string) ([]models.StorageUsage, error)
+
+	// Sync activity operations
+	AddSyncActivity(ctx context.Context, activity *models.SyncActivity) error
+	// ListSyncActivity returns the daily rollups between both days (inclusive), of all syncs if syncConfigID is 0
+	ListSyncActivity(ctx context.Context, syncConfigID uint, fromDay, toDay string) ([]models.SyncActivity, error)
+
+	// Transfer log operations
+	CreateTransferLog(ctx context.Context, entry *models.TransferLog) error
+	// ListTransferLogs returns the entries matching the filter, the latest first
+	ListTransferLogs(ctx context.Context, filter TransferLogFilter) ([]models.TransferLog, error)
+	// PruneTransferLogs deletes the oldest entries until the log is estimated to occupy at most maxBytes
+	// and returns the number of deleted entries
+	PruneTransferLogs(ctx context.Context, maxBytes int64) (int64, error)
+
+	// Local hash operations
+	GetLocalHash(ctx context.Context, path string) (*models.LocalHash, error)
+	SaveLocalHash(ctx context.Context, hash *models.LocalHash) error
+
 	// Sync operations
 	CreateSyncConfig(ctx context.Context, config *models.SyncConfig) error
 	GetSyncConfig(ctx context.Context, name string) (*models.SyncConfig, error)
@@ -50,9 +167,97 @@ type MetadataStore interface {
 	UpdateSyncConfig(ctx context.Context, config *models.SyncConfig) error
 	DeleteSyncConfig(ctx context.Context, id uint) error
 
+	// Sync selection operations
+	SaveSyncSelection(ctx context.Context, selection *models.SyncSelection) error
+	ListSyncSelections(ctx context.Context, syncConfigID uint) ([]models.SyncSelection, error)
+	DeleteSyncSelection(ctx context.Context, syncConfigID uint, path string) error
+
+	// Sync pin operations
+	SaveSyncPin(ctx context.Context, pin *models.SyncPin) error
+	ListSyncPins(ctx context.Context, syncConfigID uint, clientID string) ([]models.SyncPin, error)
+	DeleteSyncPin(ctx context.Context, syncConfigID uint, clientID, path string) error
+
+	// Pending deletion operations
+	SavePendingDeletion(ctx context.Context, pending *models.PendingDeletion) error
+	ListPendingDeletions(ctx context.Context, clientID string) ([]models.PendingDeletion, error)
+	DeletePendingDeletion(ctx context.Context, syncConfigID uint, clientID, path string) error
+
 	// Sync state operations
 	CreateSyncState(ctx context.Context, state *models.SyncState) error
 	GetSyncState(ctx context.Context, syncConfigID uint, backendID, clientID string) (*models.SyncState, error)
 	UpdateSyncState(ctx context.Context, state *models.SyncState) error
 	DeleteSyncState(ctx context.Context, id uint) error
+
+	// Sync baseline operations
+	ListSyncBaselines(ctx context.Context, syncConfigID uint, clientID string) ([]models.SyncBaseline, error)
+	GetSyncBaseline(ctx context.Context, syncConfigID uint, clientID, path string) (*models.SyncBaseline, error)
+	SaveSyncBaseline(ctx context.Context, baseline *models.SyncBaseline) error
+	DeleteSyncBaseline(ctx context.Context, syncConfigID uint, clientID, path string) error
+	// MoveSyncPrefix hands the baselines, pending deletions, selections, pins and states below a directory of one sync
+	// over to another sync within a single transaction and returns the number of moved baselines
+	MoveSyncPrefix(ctx context.Context, move SyncPrefixMove) (int64, error)
+
+	// Maintenance operations
+	// PurgeDeleted hard-deletes all records soft-deleted before the time and returns their number
+	PurgeDeleted(ctx context.Context, before time.Time) (int64, error)
+	// PruneOrphans deletes records referring to files or syncs that no longer exist and returns their number
+	PruneOrphans(ctx context.Context) (int64, error)
+	// Vacuum reclaims the space of deleted records and updates the statistics of the query planner
+	Vacuum(ctx context.Context) error
+}
+
+// SyncPrefixMove describes the paths handed over from one sync to another. The directory is excluded from the
+// sync giving it up, which is removed entirely if its root is merged.
+type SyncPrefixMove struct {
+	FromSyncID uint
+	FromPrefix string // Directory relative to the sync giving up the paths, "" for its root
+	ToSyncID   uint
+	ToPrefix   string // Directory relative to the sync taking over the paths, "" for its root
+	// Merge moves the root of the sync giving up the paths and removes it, required if FromPrefix is ""
+	Merge bool
+}
+
+// FileFilter selects the files returned by ListFiles, zero values don't restrict the result
+type FileFilter struct {
+	PathPrefix     string
+	PathLike       string // SQL LIKE pattern of the paths, escaping '%', '_' and '\' by '\'
+	ModifiedAfter  time.Time
+	ModifiedBefore time.Time
+	MinSize        int64
+	MaxSize        int64 // 0 = unlimited
+	// Hash is compared with both the MD5 and SHA256 of the content
+	Hash string
+	// Tags are matched by key and value, files have to match all of them
+	Tags map[string]string
+	// HasTags are keys of tags the files have to have, regardless of their values
+	HasTags []string
+
+	// Sort orders the files by FileSortPath (default), FileSortSize or FileSortModified, followed by backend and path
+	Sort       string
+	Descending bool
+	// After continues the listing behind this file in the sort order, allowing to page through large results by
+	// the last file of the previous page instead of an offset, which has to skip all previous files again
+	After *models.File
+}
+
+// Orders of the files returned by ListFiles
+const (
+	FileSortPath     = "path"
+	FileSortSize     = "size"
+	FileSortModified = "modified"
+)
+
+// TransferLogFilter selects the entries returned by ListTransferLogs, zero values don't restrict the result
+type TransferLogFilter struct {
+	// Path matches entries whose source or destination is the path or within it
+	Path         string
+	SyncConfigID uint
+	ClientID     string
+	Since        time.Time
+	Until        time.Time
+	// Failed only matches operations that failed
+	Failed bool
+	// Before continues the listing behind the entry with this ID, since entries are returned the latest first
+	Before uint
+	Limit  int
 }
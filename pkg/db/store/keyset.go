@@ -0,0 +1,48 @@
+package store
+
+import "strings"
+
+// ValidFileSort returns true if the files can be ordered by the field
+func ValidFileSort(sort string) bool {
+	switch sort {
+	case "", FileSortPath, FileSortSize, FileSortModified:
+		return true
+	}
+	return false
+}
+
+// fileKeyset returns the ORDER BY clause of the filter, and the condition selecting the files behind filter.After
+// in this order together with its arguments, or an empty condition if the listing starts at the first file
+func fileKeyset(filter FileFilter) (string, string, []any) {
+	columns := []string{"backend_id", "path", "id"}
+	var args []any
+	if after := filter.After; after != nil {
+		args = []any{after.BackendID, after.Path, after.ID}
+	}
+
+	switch filter.Sort {
+	case FileSortSize:
+		columns = append([]string{"size"}, columns...)
+		if filter.After != nil {
+			args = append([]any{filter.After.Size}, args...)
+		}
+	case FileSortModified:
+		columns = append([]string{"modified_at"}, columns...)
+		if filter.After != nil {
+			args = append([]any{filter.After.ModifiedAt}, args...)
+		}
+	}
+
+	direction, operator := "", ">"
+	if filter.Descending {
+		direction, operator = " DESC", "<"
+	}
+	order := strings.Join(columns, direction+", ") + direction
+	if args == nil {
+		return order, "", nil
+	}
+
+	// Row values compare column by column, just like the files are ordered
+	params := strings.TrimSuffix(strings.Repeat("?, ", len(columns)), ", ")
+	return order, "(" + strings.Join(columns, ", ") + ") " + operator + " (" + params + ")", args
+}
@@ -0,0 +1,176 @@
+package store
+
+import (
+	"context"
+	"path/filepath"
+	"slices"
+	"testing"
+
+	config "github.com/mwantia/gosync/internal/config/server"
+	"github.com/mwantia/gosync/pkg/db/models"
+)
+
+const testClientID = "client"
+
+func openTestStore(t *testing.T) MetadataStore {
+	t.Helper()
+
+	ms, err := Open(context.Background(), config.MetadataServerConfig{
+		Type:   "sqlite",
+		SQLite: config.MetadataSQLiteConfig{Path: filepath.Join(t.TempDir(), "gosync.db")},
+	}, false)
+	if err != nil {
+		t.Fatalf("failed to open store: %v", err)
+	}
+	t.Cleanup(func() { ms.Close() })
+	return ms
+}
+
+func createTestSync(t *testing.T, ms MetadataStore, name string, baselines, selections []string) *models.SyncConfig {
+	t.Helper()
+	ctx := context.Background()
+
+	sc := &models.SyncConfig{Name: name, SourcePath: "s3/" + name, DestPath: "/data/" + name, Direction: "bidirectional", Interval: 60}
+	if err := ms.CreateSyncConfig(ctx, sc); err != nil {
+		t.Fatalf("failed to create sync '%s': %v", name, err)
+	}
+	for _, p := range baselines {
+		if err := ms.SaveSyncBaseline(ctx, &models.SyncBaseline{SyncConfigID: sc.ID, ClientID: testClientID, Path: p}); err != nil {
+			t.Fatalf("failed to save baseline '%s': %v", p, err)
+		}
+	}
+	for _, p := range selections {
+		selection := &models.SyncSelection{SyncConfigID: sc.ID, Path: p, Mode: models.SelectionInclude}
+		if err := ms.SaveSyncSelection(ctx, selection); err != nil {
+			t.Fatalf("failed to save selection '%s': %v", p, err)
+		}
+	}
+	return sc
+}
+
+func baselinePaths(t *testing.T, ms MetadataStore, id uint) []string {
+	t.Helper()
+
+	baselines, err := ms.ListSyncBaselines(context.Background(), id, testClientID)
+	if err != nil {
+		t.Fatalf("failed to list baselines: %v", err)
+	}
+	var paths []string
+	for _, b := range baselines {
+		paths = append(paths, b.Path)
+	}
+	slices.Sort(paths)
+	return paths
+}
+
+func selectionPaths(t *testing.T, ms MetadataStore, id uint, mode string) []string {
+	t.Helper()
+
+	selections, err := ms.ListSyncSelections(context.Background(), id)
+	if err != nil {
+		t.Fatalf("failed to list selections: %v", err)
+	}
+	var paths []string
+	for _, s := range selections {
+		if s.Mode == mode {
+			paths = append(paths, s.Path)
+		}
+	}
+	slices.Sort(paths)
+	return paths
+}
+
+func TestMoveSyncPrefixMatchesExactDirectory(t *testing.T) {
+	ms := openTestStore(t)
+	ctx := context.Background()
+
+	// LIKE would match 'docs/' case-insensitively and treat '_' as a wildcard
+	from := createTestSync(t, ms, "from", []string{
+		"a_b/file.txt",
+		"axb/file.txt",
+		"A_B/file.txt",
+		"a_b.txt",
+		"a_b/Sub/Ünïcode.txt",
+	}, []string{"a_b", "a_b/Sub", "axb"})
+	to := createTestSync(t, ms, "to", []string{"old/file.txt", "other.txt"}, []string{"old/keep"})
+
+	moved, err := ms.MoveSyncPrefix(ctx, SyncPrefixMove{FromSyncID: from.ID, FromPrefix: "a_b", ToSyncID: to.ID, ToPrefix: "old"})
+	if err != nil {
+		t.Fatalf("failed to move prefix: %v", err)
+	}
+	if moved != 2 {
+		t.Errorf("expected 2 moved baselines, got %d", moved)
+	}
+
+	if got, want := baselinePaths(t, ms, from.ID), []string{"A_B/file.txt", "a_b.txt", "axb/file.txt"}; !slices.Equal(got, want) {
+		t.Errorf("baselines of the source sync: got %v, want %v", got, want)
+	}
+	if got, want := baselinePaths(t, ms, to.ID), []string{"old/Sub/Ünïcode.txt", "old/file.txt", "other.txt"}; !slices.Equal(got, want) {
+		t.Errorf("baselines of the target sync: got %v, want %v", got, want)
+	}
+
+	// The selection of the directory itself is moved along, and the directory is excluded from the source sync
+	if got, want := selectionPaths(t, ms, from.ID, models.SelectionInclude), []string{"axb"}; !slices.Equal(got, want) {
+		t.Errorf("included selections of the source sync: got %v, want %v", got, want)
+	}
+	if got, want := selectionPaths(t, ms, from.ID, models.SelectionExclude), []string{"a_b"}; !slices.Equal(got, want) {
+		t.Errorf("excluded selections of the source sync: got %v, want %v", got, want)
+	}
+	if got, want := selectionPaths(t, ms, to.ID, models.SelectionInclude), []string{"old", "old/Sub"}; !slices.Equal(got, want) {
+		t.Errorf("selections of the target sync: got %v, want %v", got, want)
+	}
+}
+
+func TestMoveSyncPrefixToRoot(t *testing.T) {
+	ms := openTestStore(t)
+	ctx := context.Background()
+
+	from := createTestSync(t, ms, "from", []string{"Photos/2024/a.jpg", "photos/2024/b.jpg"}, []string{"Photos"})
+	to := createTestSync(t, ms, "to", []string{"stale.jpg"}, nil)
+
+	if _, err := ms.MoveSyncPrefix(ctx, SyncPrefixMove{FromSyncID: from.ID, FromPrefix: "Photos", ToSyncID: to.ID}); err != nil {
+		t.Fatalf("failed to move prefix: %v", err)
+	}
+
+	if got, want := baselinePaths(t, ms, from.ID), []string{"photos/2024/b.jpg"}; !slices.Equal(got, want) {
+		t.Errorf("baselines of the source sync: got %v, want %v", got, want)
+	}
+	if got, want := baselinePaths(t, ms, to.ID), []string{"2024/a.jpg"}; !slices.Equal(got, want) {
+		t.Errorf("baselines of the target sync: got %v, want %v", got, want)
+	}
+	if got, want := selectionPaths(t, ms, to.ID, models.SelectionInclude), []string{""}; !slices.Equal(got, want) {
+		t.Errorf("selections of the target sync: got %v, want %v", got, want)
+	}
+}
+
+func TestMoveSyncPrefixRequiresMerge(t *testing.T) {
+	ms := openTestStore(t)
+	ctx := context.Background()
+
+	from := createTestSync(t, ms, "from", []string{"file.txt"}, nil)
+	to := createTestSync(t, ms, "to", nil, nil)
+
+	if _, err := ms.MoveSyncPrefix(ctx, SyncPrefixMove{FromSyncID: from.ID, ToSyncID: to.ID}); err == nil {
+		t.Fatal("expected moving the root without merging to fail")
+	}
+	if _, err := ms.MoveSyncPrefix(ctx, SyncPrefixMove{FromSyncID: from.ID, FromPrefix: "dir", ToSyncID: to.ID, Merge: true}); err == nil {
+		t.Fatal("expected merging a directory to fail")
+	}
+	if got, want := baselinePaths(t, ms, from.ID), []string{"file.txt"}; !slices.Equal(got, want) {
+		t.Errorf("baselines of the source sync: got %v, want %v", got, want)
+	}
+
+	moved, err := ms.MoveSyncPrefix(ctx, SyncPrefixMove{FromSyncID: from.ID, ToSyncID: to.ID, Merge: true})
+	if err != nil {
+		t.Fatalf("failed to merge sync: %v", err)
+	}
+	if moved != 1 {
+		t.Errorf("expected 1 moved baseline, got %d", moved)
+	}
+	if got, want := baselinePaths(t, ms, to.ID), []string{"file.txt"}; !slices.Equal(got, want) {
+		t.Errorf("baselines of the target sync: got %v, want %v", got, want)
+	}
+	if _, err := ms.GetSyncConfig(ctx, "from"); err == nil {
+		t.Error("expected the merged sync to be removed")
+	}
+}
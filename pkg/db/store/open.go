@@ -0,0 +1,149 @@
+package store
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"unicode/utf8"
+
+	config "github.com/mwantia/gosync/internal/config/server"
+)
+
+// iterateBatchSize defines how many rows are loaded at once while iterating over files
+const iterateBatchSize = 1000
+
+// Open creates the metadata store defined in the configuration, connects to it and runs all pending migrations.
+// Builds with the nogorm tag use the database/sql based store instead of GORM.
+func Open(ctx context.Context, cfg config.MetadataServerConfig, debug bool) (MetadataStore, error) {
+	switch cfg.Type {
+	case "sqlite":
+		return openSQLite(ctx, cfg.SQLite, debug)
+
+	default:
+		return nil, fmt.Errorf("unsupported metadata store type: %s", cfg.Type)
+	}
+}
+
+// SQLitePragmas configures every connection of a SQLite database
+type SQLitePragmas struct {
+	JournalMode string // e.g. "wal" or "delete" ("" = SQLite default)
+	BusyTimeout int    // Milliseconds to wait for locks held by other connections (0 = fail immediately)
+	Synchronous string // "off", "normal", "full" or "extra" ("" = SQLite default)
+	CacheSize   int    // Page cache size in kilobytes (0 = SQLite default)
+}
+
+// sqlitePragmas returns the pragmas of the configured database
+func sqlitePragmas(cfg config.MetadataSQLiteConfig) SQLitePragmas {
+	return SQLitePragmas{
+		JournalMode: cfg.JournalMode,
+		BusyTimeout: cfg.BusyTimeout,
+		Synchronous: cfg.Synchronous,
+		CacheSize:   cfg.CacheSize,
+	}
+}
+
+// sqliteDSN returns the data source name of the database at path with the pragmas applied to each connection
+func sqliteDSN(path string, pragmas SQLitePragmas) string {
+	var params []string
+	// The busy timeout is set first, since changing the journal mode may already wait for locks
+	if pragmas.BusyTimeout > 0 {
+		params = append(params, fmt.Sprintf("_pragma=busy_timeout(%d)", pragmas.BusyTimeout))
+	}
+	if pragmas.JournalMode != "" {
+		params = append(params, fmt.Sprintf("_pragma=journal_mode(%s)", pragmas.JournalMode))
+	}
+	if pragmas.Synchronous != "" {
+		params = append(params, fmt.Sprintf("_pragma=synchronous(%s)", pragmas.Synchronous))
+	}
+	if pragmas.CacheSize > 0 {
+		// Negative cache sizes are interpreted as kibibytes instead of pages
+		params = append(params, fmt.Sprintf("_pragma=cache_size(-%d)", pragmas.CacheSize))
+	}
+	if len(params) == 0 {
+		return path
+	}
+
+	separator := "?"
+	if strings.Contains(path, "?") {
+		separator = "&"
+	}
+	return path + separator + strings.Join(params, "&")
+}
+
+// backupSQLite writes a consistent copy of the database at srcPath to destPath while it stays in use. The copy is
+// written next to destPath first, so an existing backup is only replaced by a complete one.
+func backupSQLite(ctx context.Context, srcPath, destPath string) error {
+	if err := os.MkdirAll(filepath.Dir(destPath), 0755); err != nil {
+		return fmt.Errorf("failed to create backup directory: %w", err)
+	}
+
+	temp := destPath + ".tmp"
+	if err := os.Remove(temp); err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return fmt.Errorf("failed to remove incomplete backup: %w", err)
+	}
+
+	if err := onlineBackup(ctx, srcPath, temp); err != nil {
+		os.Remove(temp)
+		return fmt.Errorf("failed to back up database: %w", err)
+	}
+	if err := os.Rename(temp, destPath); err != nil {
+		os.Remove(temp)
+		return fmt.Errorf("failed to move backup: %w", err)
+	}
+	return nil
+}
+
+// like returns the pattern matching all values starting with prefix, escaping '%', '_' and '\' by '\' so they
+// are matched literally. Queries have to declare the escape character by ESCAPE '\'.
+func like(prefix string) string {
+	return likeEscaper.Replace(prefix) + "%"
+}
+
+var likeEscaper = strings.NewReplacer(`\`, `\\`, "%", `\%`, "_", `\_`)
+
+// pathsBelow returns the condition and arguments matching the directory itself and all paths below it.
+// Paths are compared by their leading characters, since LIKE ignores the case of ASCII letters and treats
+// '_' and '%' within the directory as wildcards. SQLite counts characters instead of bytes.
+func pathsBelow(prefix string) (string, []any) {
+	if prefix == "" {
+		return "1 = 1", nil
+	}
+	return "(path = ? OR substr(path, 1, ?) = ?)", []any{prefix, utf8.RuneCountInString(prefix) + 1, prefix + "/"}
+}
+
+// rebase returns the expression and arguments replacing FromPrefix with ToPrefix, for the directory itself
+// as well as the paths below it
+func (m SyncPrefixMove) rebase() (string, []any) {
+	base, start := "", 1
+	if m.FromPrefix != "" {
+		start = utf8.RuneCountInString(m.FromPrefix) + 2
+	}
+	if m.ToPrefix != "" {
+		base = m.ToPrefix + "/"
+	}
+	return "CASE WHEN path = ? THEN ? ELSE ? || substr(path, ?) END", []any{m.FromPrefix, m.ToPrefix, base, start}
+}
+
+// validate rejects moves of a sync into itself and moves of its root that aren't requested as a merge
+func (m SyncPrefixMove) validate() error {
+	if m.FromSyncID == m.ToSyncID {
+		return fmt.Errorf("can't move paths of sync %d to itself", m.FromSyncID)
+	}
+	if m.FromPrefix == "" && !m.Merge {
+		return fmt.Errorf("moving the root of sync %d merges it into sync %d and requires a merge", m.FromSyncID, m.ToSyncID)
+	}
+	if m.FromPrefix != "" && m.Merge {
+		return fmt.Errorf("only the root of sync %d can be merged into sync %d", m.FromSyncID, m.ToSyncID)
+	}
+	return nil
+}
+
+// unreferencedChunk is the condition matching chunks no deduplicated file references
+const unreferencedChunk = "NOT EXISTS (SELECT 1 FROM file_chunks WHERE file_chunks.chunk_id = chunks.id)"
+
+// purgedBackend is the condition matching backends soft-deleted before the time, which no file refers to anymore
+const purgedBackend = "deleted_at < ? AND NOT EXISTS (SELECT 1 FROM files WHERE files.backend_id = backends.id)"
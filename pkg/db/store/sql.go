@@ -0,0 +1,1754 @@
+//go:build nogorm
+
+package store
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	_ "github.com/glebarez/go-sqlite"
+	config "github.com/mwantia/gosync/internal/config/server"
+	"github.com/mwantia/gosync/pkg/db/models"
+)
+
+// ErrNotFound is returned if a requested record doesn't exist
+var ErrNotFound = errors.New("record not found")
+
+// openSQLite opens the database/sql based SQLite store and creates its schema if required
+func openSQLite(ctx context.Context, cfg config.MetadataSQLiteConfig, debug bool) (MetadataStore, error) {
+	sqlStore, err := NewSQLStore(cfg.Path, sqlitePragmas(cfg))
+	if err != nil {
+		return nil, fmt.Errorf("failed to create sqlite store: %w", err)
+	}
+
+	if err := sqlStore.Connect(ctx); err != nil {
+		return nil, fmt.Errorf("failed to connect to database: %w", err)
+	}
+
+	if err := sqlStore.Migrate(ctx); err != nil {
+		sqlStore.Close()
+		return nil, fmt.Errorf("failed to run migrations: %w", err)
+	}
+
+	return sqlStore, nil
+}
+
+// SQLStore implements MetadataStore on top of database/sql without GORM, trading the
+// query builder for less reflection and a smaller binary. It reads and writes the same
+// schema as SQLiteStore, including soft deletes and default values.
+type SQLStore struct {
+	db   *sql.DB
+	path string
+}
+
+// NewSQLStore creates a new SQLite-backed metadata store using database/sql,
+// applying the pragmas to each connection.
+func NewSQLStore(path string, pragmas SQLitePragmas) (*SQLStore, error) {
+	if path == "" {
+		return nil, fmt.Errorf("sqlite path is required")
+	}
+
+	db, err := sql.Open("sqlite", sqliteDSN(path, pragmas))
+	if err != nil {
+		return nil, fmt.Errorf("failed to open sqlite database: %w", err)
+	}
+
+	return &SQLStore{
+		db:   db,
+		path: path,
+	}, nil
+}
+
+// Connect initializes the database connection
+func (s *SQLStore) Connect(ctx context.Context) error {
+	// Configure connection pool
+	s.db.SetMaxOpenConns(1) // SQLite only supports 1 writer
+	s.db.SetMaxIdleConns(1)
+	s.db.SetConnMaxLifetime(time.Hour)
+
+	return s.db.PingContext(ctx)
+}
+
+// Close closes the database connection
+func (s *SQLStore) Close() error {
+	return s.db.Close()
+}
+
+// Migrate creates the schema of new databases
+func (s *SQLStore) Migrate(ctx context.Context) error {
+	return s.migrate(ctx)
+}
+
+// Backup writes a consistent copy of the database to destPath while it stays in use
+func (s *SQLStore) Backup(ctx context.Context, destPath string) error {
+	return backupSQLite(ctx, s.path, destPath)
+}
+
+// Health checks database connectivity
+func (s *SQLStore) Health(ctx context.Context) error {
+	return s.db.PingContext(ctx)
+}
+
+// querier is implemented by both *sql.DB and *sql.Tx
+type querier interface {
+	ExecContext(ctx context.Context, query string, args ...any) (sql.Result, error)
+	QueryContext(ctx context.Context, query string, args ...any) (*sql.Rows, error)
+	QueryRowContext(ctx context.Context, query string, args ...any) *sql.Row
+}
+
+// scanner is implemented by both *sql.Row and *sql.Rows
+type scanner interface {
+	Scan(dest ...any) error
+}
+
+// transaction runs fn within a transaction, which is rolled back if fn returns an error.
+// Since only a single connection is used, fn must not use s.db.
+func (s *SQLStore) transaction(ctx context.Context, fn func(tx *sql.Tx) error) error {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+
+	if err := fn(tx); err != nil {
+		tx.Rollback()
+		return err
+	}
+	return tx.Commit()
+}
+
+// queryAll returns all rows of the query scanned by scan
+func queryAll[T any](ctx context.Context, q querier, scan func(scanner, *T) error, query string, args ...any) ([]T, error) {
+	rows, err := q.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var result []T
+	for rows.Next() {
+		var v T
+		if err := scan(rows, &v); err != nil {
+			return nil, err
+		}
+		result = append(result, v)
+	}
+	return result, rows.Err()
+}
+
+// queryOne returns the first row of the query scanned by scan, or ErrNotFound
+func queryOne[T any](ctx context.Context, q querier, scan func(scanner, *T) error, query string, args ...any) (*T, error) {
+	var v T
+	if err := scan(q.QueryRowContext(ctx, query, args...), &v); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, ErrNotFound
+		}
+		return nil, err
+	}
+	return &v, nil
+}
+
+// insert executes the insert and returns the id of the created row
+func insert(ctx context.Context, q querier, query string, args ...any) (uint, error) {
+	result, err := q.ExecContext(ctx, query, args...)
+	if err != nil {
+		return 0, err
+	}
+	id, err := result.LastInsertId()
+	return uint(id), err
+}
+
+// nullable scans NULL into the zero value, which GORM does for columns added to existing rows
+type nullable[T any] struct {
+	v *T
+}
+
+func null[T any](v *T) nullable[T] {
+	return nullable[T]{v: v}
+}
+
+func (n nullable[T]) Scan(src any) error {
+	var value sql.Null[T]
+	if err := value.Scan(src); err != nil {
+		return err
+	}
+	*n.v = value.V
+	return nil
+}
+
+// timestamps sets the creation and update time of new records, matching GORM
+func timestamps(createdAt, updatedAt *time.Time) {
+	now := time.Now().UTC()
+	if createdAt != nil && createdAt.IsZero() {
+		*createdAt = now
+	}
+	if updatedAt != nil && updatedAt.IsZero() {
+		*updatedAt = now
+	}
+}
+
+func placeholders(n int) string {
+	return strings.TrimSuffix(strings.Repeat("?, ", n), ", ")
+}
+
+// Backend operations
+
+const backendColumns = "id, name, type, endpoint, region, bucket, use_ssl, access_key, secret_key, dns_server, ip_preference, happy_eyeballs, static_hosts, trash_enabled, trash_prefix, trash_retention, quota_soft, quota_hard, wipe_started_at, created_at, updated_at, deleted_at"
+
+func scanBackend(row scanner, b *models.Backend) error {
+	return row.Scan(&b.ID, null(&b.Name), null(&b.Type), null(&b.Endpoint), null(&b.Region), null(&b.Bucket), null(&b.UseSSL),
+		null(&b.AccessKey), null(&b.SecretKey), null(&b.DNSServer), null(&b.IPPreference), null(&b.HappyEyeballs), null(&b.StaticHosts),
+		null(&b.TrashEnabled), null(&b.TrashPrefix), null(&b.TrashRetention), null(&b.QuotaSoft), null(&b.QuotaHard), &b.WipeStartedAt, null(&b.CreatedAt), null(&b.UpdatedAt), &b.DeletedAt)
+}
+
+func backendValues(b *models.Backend) []any {
+	return []any{b.ID, b.Name, b.Type, b.Endpoint, b.Region, b.Bucket, b.UseSSL, b.AccessKey, b.SecretKey, b.DNSServer, b.IPPreference,
+		b.HappyEyeballs, b.StaticHosts, b.TrashEnabled, b.TrashPrefix, b.TrashRetention, b.QuotaSoft, b.QuotaHard, b.WipeStartedAt, b.CreatedAt, b.UpdatedAt, b.DeletedAt}
+}
+
+func (s *SQLStore) CreateBackend(ctx context.Context, backend *models.Backend) error {
+	// Zero values of columns with a default are replaced by the default, matching GORM
+	if backend.Type == "" {
+		backend.Type = "s3"
+	}
+	if !backend.UseSSL {
+		backend.UseSSL = true
+	}
+	if backend.TrashPrefix == "" {
+		backend.TrashPrefix = ".gosync-trash/"
+	}
+	timestamps(&backend.CreatedAt, &backend.UpdatedAt)
+
+	_, err := s.db.ExecContext(ctx, "INSERT INTO backends ("+backendColumns+") VALUES ("+placeholders(22)+")", backendValues(backend)...)
+	return err
+}
+
+func (s *SQLStore) GetBackend(ctx context.Context, id string) (*models.Backend, error) {
+	return queryOne(ctx, s.db, scanBackend, "SELECT "+backendColumns+" FROM backends WHERE id = ? AND deleted_at IS NULL ORDER BY id LIMIT 1", id)
+}
+
+func (s *SQLStore) ListBackends(ctx context.Context) ([]models.Backend, error) {
+	return queryAll(ctx, s.db, scanBackend, "SELECT "+backendColumns+" FROM backends WHERE deleted_at IS NULL")
+}
+
+func (s *SQLStore) UpdateBackend(ctx context.Context, backend *models.Backend) error {
+	backend.UpdatedAt = time.Now().UTC()
+
+	values := backendValues(backend)
+	_, err := s.db.ExecContext(ctx, `UPDATE backends SET name = ?, type = ?, endpoint = ?, region = ?, bucket = ?, use_ssl = ?,
+		access_key = ?, secret_key = ?, dns_server = ?, ip_preference = ?, happy_eyeballs = ?, static_hosts = ?, trash_enabled = ?,
+		trash_prefix = ?, trash_retention = ?, quota_soft = ?, quota_hard = ?, wipe_started_at = ?, created_at = ?, updated_at = ?, deleted_at = ?
+		WHERE id = ? AND deleted_at IS NULL`, append(values[1:], backend.ID)...)
+	return err
+}
+
+func (s *SQLStore) DeleteBackend(ctx context.Context, id string) error {
+	_, err := s.db.ExecContext(ctx, "UPDATE backends SET deleted_at = ? WHERE id = ? AND deleted_at IS NULL", time.Now().UTC(), id)
+	return err
+}
+
+// BeginBackendWipe marks the backend as being wiped and soft-deletes all of its files.
+// It returns the total number of file records (including already soft-deleted ones).
+func (s *SQLStore) BeginBackendWipe(ctx context.Context, id string) (int64, error) {
+	var total int64
+	err := s.transaction(ctx, func(tx *sql.Tx) error {
+		now := time.Now().UTC()
+		if _, err := tx.ExecContext(ctx, "UPDATE backends SET wipe_started_at = ?, updated_at = ? WHERE id = ? AND wipe_started_at IS NULL AND deleted_at IS NULL",
+			now, now, id); err != nil {
+			return err
+		}
+
+		if err := recordSQLFileEvents(ctx, tx, id, models.FileEventDeleted); err != nil {
+			return err
+		}
+
+		if _, err := tx.ExecContext(ctx, "UPDATE files SET deleted_at = ? WHERE backend_id = ? AND deleted_at IS NULL", now, id); err != nil {
+			return err
+		}
+		if _, err := tx.ExecContext(ctx, "DELETE FROM storage_usages WHERE backend_id = ?", id); err != nil {
+			return err
+		}
+
+		return tx.QueryRowContext(ctx, "SELECT COUNT(*) FROM files WHERE backend_id = ?", id).Scan(&total)
+	})
+	return total, err
+}
+
+// CompleteBackendWipe permanently removes all file records of the backend and clears the wipe state
+func (s *SQLStore) CompleteBackendWipe(ctx context.Context, id string) error {
+	return s.transaction(ctx, func(tx *sql.Tx) error {
+		statements := []string{
+			"DELETE FROM tags WHERE file_id IN (SELECT id FROM files WHERE backend_id = ?)",
+			"DELETE FROM files WHERE backend_id = ?",
+			"DELETE FROM trash_items WHERE backend_id = ?",
+			"DELETE FROM file_events WHERE backend_id = ?",
+			"DELETE FROM file_blocks WHERE backend_id = ?",
+			"DELETE FROM file_chunks WHERE chunk_id IN (SELECT id FROM chunks WHERE backend_id = ?)",
+			"DELETE FROM chunks WHERE backend_id = ?",
+			"DELETE FROM locks WHERE backend_id = ?",
+		}
+		for _, statement := range statements {
+			if _, err := tx.ExecContext(ctx, statement, id); err != nil {
+				return err
+			}
+		}
+
+		_, err := tx.ExecContext(ctx, "UPDATE backends SET wipe_started_at = NULL, updated_at = ? WHERE id = ? AND deleted_at IS NULL", time.Now().UTC(), id)
+		return err
+	})
+}
+
+func scanBackendTuning(row scanner, t *models.BackendTuning) error {
+	return row.Scan(&t.BackendID, null(&t.ChunkSize), null(&t.Throughput), null(&t.Latency), null(&t.Samples), null(&t.UpdatedAt))
+}
+
+func (s *SQLStore) ListBackendTunings(ctx context.Context) ([]models.BackendTuning, error) {
+	return queryAll(ctx, s.db, scanBackendTuning, "SELECT backend_id, chunk_size, throughput, latency, samples, updated_at FROM backend_tunings")
+}
+
+func (s *SQLStore) SaveBackendTuning(ctx context.Context, tuning *models.BackendTuning) error {
+	tuning.UpdatedAt = time.Now().UTC()
+
+	_, err := s.db.ExecContext(ctx, `INSERT INTO backend_tunings (backend_id, chunk_size, throughput, latency, samples, updated_at)
+		VALUES (?, ?, ?, ?, ?, ?) ON CONFLICT (backend_id) DO UPDATE SET chunk_size = excluded.chunk_size,
+		throughput = excluded.throughput, latency = excluded.latency, samples = excluded.samples, updated_at = excluded.updated_at`,
+		tuning.BackendID, tuning.ChunkSize, tuning.Throughput, tuning.Latency, tuning.Samples, tuning.UpdatedAt)
+	return err
+}
+
+// File operations
+
+const fileColumns = "id, backend_id, path, size, md5_hash, sha256_hash, e_tag, version_id, deduplicated, compression, mode, owner, xattrs, sparse, modified_at, created_at, updated_at, deleted_at"
+
+func scanFile(row scanner, f *models.File) error {
+	return row.Scan(&f.ID, null(&f.BackendID), null(&f.Path), null(&f.Size), null(&f.MD5Hash), null(&f.SHA256Hash), null(&f.ETag),
+		null(&f.VersionID), null(&f.Deduplicated), null(&f.Compression), null(&f.Mode), null(&f.Owner), null(&f.Xattrs), null(&f.Sparse), null(&f.ModifiedAt), null(&f.CreatedAt),
+		null(&f.UpdatedAt), &f.DeletedAt)
+}
+
+func insertFile(ctx context.Context, q querier, file *models.File) error {
+	timestamps(&file.CreatedAt, &file.UpdatedAt)
+
+	id, err := insert(ctx, q, `INSERT INTO files (backend_id, path, size, md5_hash, sha256_hash, e_tag, version_id, deduplicated,
+		compression, mode, owner, xattrs, sparse, modified_at, created_at, updated_at, deleted_at) VALUES (`+placeholders(17)+`)`,
+		file.BackendID, file.Path, file.Size, file.MD5Hash, file.SHA256Hash, file.ETag, file.VersionID, file.Deduplicated,
+		file.Compression, file.Mode, file.Owner, file.Xattrs, file.Sparse, file.ModifiedAt, file.CreatedAt, file.UpdatedAt, file.DeletedAt)
+	if err != nil {
+		return err
+	}
+	file.ID = id
+	return nil
+}
+
+func (s *SQLStore) CreateFile(ctx context.Context, file *models.File) error {
+	return s.transaction(ctx, func(tx *sql.Tx) error {
+		if err := insertFile(ctx, tx, file); err != nil {
+			return err
+		}
+		if err := addSQLStorageUsage(ctx, tx, file, 1); err != nil {
+			return err
+		}
+		return recordSQLFileEvent(ctx, tx, file, models.FileEventCreated)
+	})
+}
+
+func (s *SQLStore) GetFile(ctx context.Context, backendID, path string) (*models.File, error) {
+	return queryOne(ctx, s.db, scanFile, "SELECT "+fileColumns+" FROM files WHERE backend_id = ? AND path = ? AND deleted_at IS NULL ORDER BY id LIMIT 1",
+		backendID, path)
+}
+
+func (s *SQLStore) ListFiles(ctx context.Context, backendID string, filter FileFilter, limit, offset int) ([]models.File, error) {
+	query := "SELECT " + fileColumns + " FROM files WHERE deleted_at IS NULL"
+	var args []any
+
+	if backendID != "" {
+		query += " AND backend_id = ?"
+		args = append(args, backendID)
+	}
+	if filter.PathPrefix != "" {
+		query += " AND path LIKE ? ESCAPE '\\'"
+		args = append(args, like(filter.PathPrefix))
+	}
+	if filter.PathLike != "" {
+		query += " AND path LIKE ? ESCAPE '\\'"
+		args = append(args, filter.PathLike)
+	}
+	if !filter.ModifiedAfter.IsZero() {
+		query += " AND modified_at > ?"
+		args = append(args, filter.ModifiedAfter.UTC())
+	}
+	if !filter.ModifiedBefore.IsZero() {
+		query += " AND modified_at < ?"
+		args = append(args, filter.ModifiedBefore.UTC())
+	}
+	if filter.MinSize > 0 {
+		query += " AND size >= ?"
+		args = append(args, filter.MinSize)
+	}
+	if filter.MaxSize > 0 {
+		query += " AND size <= ?"
+		args = append(args, filter.MaxSize)
+	}
+	if filter.Hash != "" {
+		query += " AND (md5_hash = ? OR sha256_hash = ?)"
+		args = append(args, filter.Hash, filter.Hash)
+	}
+	for key, value := range filter.Tags {
+		query += " AND EXISTS (SELECT 1 FROM tags WHERE tags.file_id = files.id AND tags.key = ? AND tags.value = ? AND tags.deleted_at IS NULL)"
+		args = append(args, key, value)
+	}
+	for _, key := range filter.HasTags {
+		query += " AND EXISTS (SELECT 1 FROM tags WHERE tags.file_id = files.id AND tags.key = ? AND tags.deleted_at IS NULL)"
+		args = append(args, key)
+	}
+	order, keyset, keysetArgs := fileKeyset(filter)
+	if keyset != "" {
+		query += " AND " + keyset
+		args = append(args, keysetArgs...)
+	}
+
+	query, args = paginate(query+" ORDER BY "+order, args, limit, offset)
+	return queryAll(ctx, s.db, scanFile, query, args...)
+}
+
+// paginate appends the limit and offset to the query, if set
+func paginate(query string, args []any, limit, offset int) (string, []any) {
+	switch {
+	case limit > 0:
+		query += " LIMIT ?"
+		args = append(args, limit)
+	case offset > 0:
+		// SQLite doesn't support an offset without limit
+		query += " LIMIT -1"
+	}
+	if offset > 0 {
+		query += " OFFSET ?"
+		args = append(args, offset)
+	}
+	return query, args
+}
+
+// IterateFiles calls fn for every file below the prefix ordered by path, stopping at the first error returned by fn.
+// Files are loaded in batches continuing after the last path, so memory usage is independent of the number of files.
+func (s *SQLStore) IterateFiles(ctx context.Context, backendID, pathPrefix string, fn func(file *models.File) error) error {
+	var lastPath string
+	var lastID uint
+
+	for {
+		query := "SELECT " + fileColumns + " FROM files WHERE backend_id = ? AND deleted_at IS NULL"
+		args := []any{backendID}
+
+		if pathPrefix != "" {
+			query += " AND path LIKE ? ESCAPE '\\'"
+			args = append(args, like(pathPrefix))
+		}
+		if lastID != 0 {
+			query += " AND (path > ? OR (path = ? AND id > ?))"
+			args = append(args, lastPath, lastPath, lastID)
+		}
+
+		files, err := queryAll(ctx, s.db, scanFile, query+" ORDER BY path, id LIMIT ?", append(args, iterateBatchSize)...)
+		if err != nil {
+			return err
+		}
+
+		for i := range files {
+			if err := fn(&files[i]); err != nil {
+				return err
+			}
+		}
+
+		if len(files) < iterateBatchSize {
+			return nil
+		}
+		lastPath = files[len(files)-1].Path
+		lastID = files[len(files)-1].ID
+	}
+}
+
+func (s *SQLStore) UpdateFile(ctx context.Context, file *models.File) error {
+	if file.ID == 0 {
+		return s.CreateFile(ctx, file)
+	}
+
+	return s.transaction(ctx, func(tx *sql.Tx) error {
+		file.UpdatedAt = time.Now().UTC()
+
+		previous, err := queryOne(ctx, tx, scanFile, "SELECT "+fileColumns+" FROM files WHERE id = ? AND deleted_at IS NULL ORDER BY id LIMIT 1", file.ID)
+		if err != nil && !errors.Is(err, ErrNotFound) {
+			return err
+		}
+		if err == nil {
+			if err := addSQLStorageUsage(ctx, tx, previous, -1); err != nil {
+				return err
+			}
+		}
+
+		if _, err := tx.ExecContext(ctx, `UPDATE files SET backend_id = ?, path = ?, size = ?, md5_hash = ?, sha256_hash = ?, e_tag = ?,
+			version_id = ?, deduplicated = ?, compression = ?, mode = ?, owner = ?, xattrs = ?, sparse = ?, modified_at = ?, created_at = ?, updated_at = ?
+			WHERE id = ? AND deleted_at IS NULL`,
+			file.BackendID, file.Path, file.Size, file.MD5Hash, file.SHA256Hash, file.ETag, file.VersionID, file.Deduplicated,
+			file.Compression, file.Mode, file.Owner, file.Xattrs, file.Sparse, file.ModifiedAt, file.CreatedAt, file.UpdatedAt, file.ID); err != nil {
+			return err
+		}
+		if err := addSQLStorageUsage(ctx, tx, file, 1); err != nil {
+			return err
+		}
+		return recordSQLFileEvent(ctx, tx, file, models.FileEventModified)
+	})
+}
+
+// UpsertFile creates the file or updates the existing file with the same backend and path,
+// relying on the unique index instead of a separate lookup to avoid duplicate rows
+func (s *SQLStore) UpsertFile(ctx context.Context, file *models.File) error {
+	return s.transaction(ctx, func(tx *sql.Tx) error {
+		// Only used to choose the event type and to replace the usage, the conflict clause handles concurrent inserts
+		existing, err := queryOne(ctx, tx, scanFile, "SELECT "+fileColumns+" FROM files WHERE backend_id = ? AND path = ? AND deleted_at IS NULL ORDER BY id LIMIT 1",
+			file.BackendID, file.Path)
+		if err != nil && !errors.Is(err, ErrNotFound) {
+			return err
+		}
+		return upsertSQLFile(ctx, tx, file, existing)
+	})
+}
+
+func (s *SQLStore) UpsertFiles(ctx context.Context, files []models.File) (int, error) {
+	changed := 0
+	err := s.transaction(ctx, func(tx *sql.Tx) error {
+		changed = 0
+		for i := range files {
+			file := &files[i]
+
+			existing, err := queryOne(ctx, tx, scanFile, "SELECT "+fileColumns+" FROM files WHERE backend_id = ? AND path = ? AND deleted_at IS NULL ORDER BY id LIMIT 1",
+				file.BackendID, file.Path)
+			if err != nil && !errors.Is(err, ErrNotFound) {
+				return err
+			}
+			if err == nil && existing.ETag == file.ETag {
+				file.ID = existing.ID
+				continue
+			}
+
+			if err := upsertSQLFile(ctx, tx, file, existing); err != nil {
+				return err
+			}
+			changed++
+		}
+		return nil
+	})
+	return changed, err
+}
+
+// upsertSQLFile creates the file or updates its previous record, if it already exists
+func upsertSQLFile(ctx context.Context, tx *sql.Tx, file *models.File, previous *models.File) error {
+	timestamps(&file.CreatedAt, &file.UpdatedAt)
+	err := tx.QueryRowContext(ctx, `INSERT INTO files (backend_id, path, size, md5_hash, sha256_hash, e_tag, version_id, deduplicated,
+		compression, mode, owner, xattrs, sparse, modified_at, created_at, updated_at, deleted_at) VALUES (`+placeholders(17)+`)
+		ON CONFLICT (backend_id, path) WHERE deleted_at IS NULL DO UPDATE SET size = excluded.size, md5_hash = excluded.md5_hash,
+		sha256_hash = excluded.sha256_hash, e_tag = excluded.e_tag, version_id = excluded.version_id, deduplicated = excluded.deduplicated,
+		compression = excluded.compression, mode = excluded.mode, owner = excluded.owner, xattrs = excluded.xattrs, sparse = excluded.sparse, modified_at = excluded.modified_at,
+		updated_at = excluded.updated_at RETURNING id`,
+		file.BackendID, file.Path, file.Size, file.MD5Hash, file.SHA256Hash, file.ETag, file.VersionID, file.Deduplicated,
+		file.Compression, file.Mode, file.Owner, file.Xattrs, file.Sparse, file.ModifiedAt, file.CreatedAt, file.UpdatedAt, file.DeletedAt).Scan(&file.ID)
+	if err != nil {
+		return err
+	}
+
+	eventType := models.FileEventCreated
+	if previous != nil {
+		eventType = models.FileEventModified
+		if err := addSQLStorageUsage(ctx, tx, previous, -1); err != nil {
+			return err
+		}
+	}
+	if err := addSQLStorageUsage(ctx, tx, file, 1); err != nil {
+		return err
+	}
+	return recordSQLFileEvent(ctx, tx, file, eventType)
+}
+
+func (s *SQLStore) DeleteFile(ctx context.Context, id uint) error {
+	return s.transaction(ctx, func(tx *sql.Tx) error {
+		file, err := queryOne(ctx, tx, scanFile, "SELECT "+fileColumns+" FROM files WHERE id = ? AND deleted_at IS NULL ORDER BY id LIMIT 1", id)
+		if err != nil {
+			return err
+		}
+
+		if _, err := tx.ExecContext(ctx, "UPDATE files SET deleted_at = ? WHERE id = ? AND deleted_at IS NULL", time.Now().UTC(), id); err != nil {
+			return err
+		}
+		if err := addSQLStorageUsage(ctx, tx, file, -1); err != nil {
+			return err
+		}
+		return recordSQLFileEvent(ctx, tx, file, models.FileEventDeleted)
+	})
+}
+
+func (s *SQLStore) DeleteFilesByBackend(ctx context.Context, backendID string) error {
+	return s.transaction(ctx, func(tx *sql.Tx) error {
+		if err := recordSQLFileEvents(ctx, tx, backendID, models.FileEventDeleted); err != nil {
+			return err
+		}
+		if _, err := tx.ExecContext(ctx, "DELETE FROM storage_usages WHERE backend_id = ?", backendID); err != nil {
+			return err
+		}
+		_, err := tx.ExecContext(ctx, "UPDATE files SET deleted_at = ? WHERE backend_id = ? AND deleted_at IS NULL", time.Now().UTC(), backendID)
+		return err
+	})
+}
+
+func (s *SQLStore) FindFilesByHash(ctx context.Context, backendID, sha256Hash string) ([]models.File, error) {
+	return queryAll(ctx, s.db, scanFile, "SELECT "+fileColumns+" FROM files WHERE backend_id = ? AND sha256_hash = ? AND deleted_at IS NULL",
+		backendID, sha256Hash)
+}
+
+// File history operations
+
+const fileEventColumns = "id, backend_id, path, type, size, md5_hash, sha256_hash, e_tag, version_id, modified_at, occurred_at"
+
+func scanFileEvent(row scanner, e *models.FileEvent) error {
+	return row.Scan(&e.ID, null(&e.BackendID), null(&e.Path), null(&e.Type), null(&e.Size), null(&e.MD5Hash), null(&e.SHA256Hash),
+		null(&e.ETag), null(&e.VersionID), null(&e.ModifiedAt), null(&e.OccurredAt))
+}
+
+func (s *SQLStore) ListFileEvents(ctx context.Context, backendID, pathPrefix string, since, until time.Time) ([]models.FileEvent, error) {
+	query := "SELECT " + fileEventColumns + " FROM file_events WHERE backend_id = ?"
+	args := []any{backendID}
+
+	if pathPrefix != "" {
+		query += " AND path LIKE ? ESCAPE '\\'"
+		args = append(args, like(pathPrefix))
+	}
+	if !since.IsZero() {
+		query += " AND occurred_at >= ?"
+		args = append(args, since)
+	}
+	if !until.IsZero() {
+		query += " AND occurred_at <= ?"
+		args = append(args, until)
+	}
+
+	return queryAll(ctx, s.db, scanFileEvent, query+" ORDER BY id", args...)
+}
+
+// ListFilesAt reconstructs the files below the prefix as they existed at the provided time,
+// returning the latest non-deleted event of each path.
+func (s *SQLStore) ListFilesAt(ctx context.Context, backendID, pathPrefix string, at time.Time) ([]models.FileEvent, error) {
+	return queryAll(ctx, s.db, scanFileEvent, "SELECT "+fileEventColumns+` FROM file_events WHERE id IN (
+		SELECT MAX(id) FROM file_events WHERE backend_id = ? AND path LIKE ? ESCAPE '\' AND occurred_at <= ? GROUP BY path
+	) AND type != ? ORDER BY path`, backendID, like(pathPrefix), at, models.FileEventDeleted)
+}
+
+// ListDeletedFiles returns the tombstones of files below the prefix deleted since the provided time
+func (s *SQLStore) ListDeletedFiles(ctx context.Context, backendID, pathPrefix string, since time.Time) ([]models.File, error) {
+	return queryAll(ctx, s.db, scanFile, "SELECT "+fileColumns+` FROM files
+		WHERE backend_id = ? AND path LIKE ? ESCAPE '\' AND deleted_at IS NOT NULL AND deleted_at >= ? ORDER BY path`,
+		backendID, like(pathPrefix), since)
+}
+
+func (s *SQLStore) ListFileEventsAfter(ctx context.Context, afterID uint, limit int) ([]models.FileEvent, error) {
+	return queryAll(ctx, s.db, scanFileEvent, "SELECT "+fileEventColumns+" FROM file_events WHERE id > ? ORDER BY id LIMIT ?", afterID, limit)
+}
+
+func (s *SQLStore) LatestFileEventID(ctx context.Context) (uint, error) {
+	var id uint
+	err := s.db.QueryRowContext(ctx, "SELECT COALESCE(MAX(id), 0) FROM file_events").Scan(&id)
+	return id, err
+}
+
+func recordSQLFileEvent(ctx context.Context, tx *sql.Tx, file *models.File, eventType models.FileEventType) error {
+	_, err := tx.ExecContext(ctx, `INSERT INTO file_events
+		(backend_id, path, type, size, md5_hash, sha256_hash, e_tag, version_id, modified_at, occurred_at)
+		VALUES (`+placeholders(10)+`)`, file.BackendID, file.Path, eventType, file.Size, file.MD5Hash, file.SHA256Hash,
+		file.ETag, file.VersionID, file.ModifiedAt, time.Now().UTC())
+	return err
+}
+
+// recordSQLFileEvents records an event for every (non-deleted) file of the backend
+func recordSQLFileEvents(ctx context.Context, tx *sql.Tx, backendID string, eventType models.FileEventType) error {
+	_, err := tx.ExecContext(ctx, `INSERT INTO file_events
+		(backend_id, path, type, size, md5_hash, sha256_hash, e_tag, version_id, modified_at, occurred_at)
+		SELECT backend_id, path, ?, size, md5_hash, sha256_hash, e_tag, version_id, modified_at, ?
+		FROM files WHERE backend_id = ? AND deleted_at IS NULL`, eventType, time.Now().UTC(), backendID)
+	return err
+}
+
+// addSQLStorageUsage adds the file to the usage of all directories containing it, or removes it again if sign is -1.
+// Directories without objects are removed, so their usage isn't listed anymore.
+func addSQLStorageUsage(ctx context.Context, tx *sql.Tx, file *models.File, sign int64) error {
+	prefixes, parents := usageDirs(file.Path)
+	now := time.Now().UTC()
+	for i, prefix := range prefixes {
+		if _, err := tx.ExecContext(ctx, `INSERT INTO storage_usages (backend_id, prefix, parent, objects, bytes, updated_at)
+			VALUES (?, ?, ?, ?, ?, ?) ON CONFLICT (backend_id, prefix) DO UPDATE SET objects = objects + excluded.objects,
+			bytes = bytes + excluded.bytes, updated_at = excluded.updated_at`,
+			file.BackendID, prefix, parents[i], sign, sign*usageBytes(file), now); err != nil {
+			return err
+		}
+	}
+	if sign > 0 {
+		return nil
+	}
+
+	args := []any{file.BackendID}
+	for _, prefix := range prefixes {
+		args = append(args, prefix)
+	}
+	_, err := tx.ExecContext(ctx, "DELETE FROM storage_usages WHERE backend_id = ? AND prefix IN ("+placeholders(len(prefixes))+") AND objects <= 0", args...)
+	return err
+}
+
+// Chunk operations
+
+func scanChunk(row scanner, c *models.Chunk) error {
+	return row.Scan(&c.ID, null(&c.BackendID), null(&c.Hash), null(&c.Size), null(&c.CreatedAt))
+}
+
+func (s *SQLStore) GetChunk(ctx context.Context, backendID, hash string) (*models.Chunk, error) {
+	return queryOne(ctx, s.db, scanChunk, "SELECT id, backend_id, hash, size, created_at FROM chunks WHERE backend_id = ? AND hash = ? ORDER BY id LIMIT 1",
+		backendID, hash)
+}
+
+// CreateChunk records the chunk, loading the existing record if it was already created concurrently
+func (s *SQLStore) CreateChunk(ctx context.Context, chunk *models.Chunk) error {
+	timestamps(&chunk.CreatedAt, nil)
+
+	err := s.db.QueryRowContext(ctx, "INSERT INTO chunks (backend_id, hash, size, created_at) VALUES (?, ?, ?, ?) ON CONFLICT DO NOTHING RETURNING id",
+		chunk.BackendID, chunk.Hash, chunk.Size, chunk.CreatedAt).Scan(&chunk.ID)
+	if !errors.Is(err, sql.ErrNoRows) {
+		return err
+	}
+
+	existing, err := s.GetChunk(ctx, chunk.BackendID, chunk.Hash)
+	if err != nil {
+		return err
+	}
+	*chunk = *existing
+	return nil
+}
+
+// ListFileChunks returns the chunks of a deduplicated file in manifest order
+func (s *SQLStore) ListFileChunks(ctx context.Context, fileID uint) ([]models.Chunk, error) {
+	return queryAll(ctx, s.db, scanChunk, `SELECT chunks.id, chunks.backend_id, chunks.hash, chunks.size, chunks.created_at
+		FROM chunks JOIN file_chunks ON file_chunks.chunk_id = chunks.id WHERE file_chunks.file_id = ? ORDER BY file_chunks.position`, fileID)
+}
+
+// SetFileChunks replaces the manifest of the file with the chunks in order
+func (s *SQLStore) SetFileChunks(ctx context.Context, fileID uint, chunkIDs []uint) error {
+	return s.transaction(ctx, func(tx *sql.Tx) error {
+		if _, err := tx.ExecContext(ctx, "DELETE FROM file_chunks WHERE file_id = ?", fileID); err != nil {
+			return err
+		}
+
+		stmt, err := tx.PrepareContext(ctx, "INSERT INTO file_chunks (file_id, position, chunk_id) VALUES (?, ?, ?)")
+		if err != nil {
+			return err
+		}
+		defer stmt.Close()
+
+		for i, chunkID := range chunkIDs {
+			if _, err := stmt.ExecContext(ctx, fileID, i, chunkID); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// ListUnreferencedChunks returns chunks of the backend created before the time that no file references
+func (s *SQLStore) ListUnreferencedChunks(ctx context.Context, backendID string, before time.Time, limit int) ([]models.Chunk, error) {
+	query, args := paginate("SELECT id, backend_id, hash, size, created_at FROM chunks WHERE backend_id = ? AND created_at < ? AND "+unreferencedChunk+" ORDER BY id",
+		[]any{backendID, before}, limit, 0)
+	return queryAll(ctx, s.db, scanChunk, query, args...)
+}
+
+// DeleteChunk deletes the chunk unless a file references it by now, returning whether it was deleted
+func (s *SQLStore) DeleteChunk(ctx context.Context, id uint) (bool, error) {
+	result, err := s.db.ExecContext(ctx, "DELETE FROM chunks WHERE id = ? AND "+unreferencedChunk, id)
+	if err != nil {
+		return false, err
+	}
+	deleted, err := result.RowsAffected()
+	return deleted > 0, err
+}
+
+// File block operations
+
+func scanFileBlock(row scanner, b *models.FileBlock) error {
+	return row.Scan(&b.ID, null(&b.BackendID), null(&b.Path), null(&b.Number), null(&b.Offset), null(&b.Size), null(&b.Hash), null(&b.ETag), null(&b.CreatedAt))
+}
+
+func (s *SQLStore) ListFileBlocks(ctx context.Context, backendID, path string) ([]models.FileBlock, error) {
+	return queryAll(ctx, s.db, scanFileBlock, "SELECT id, backend_id, path, number, `offset`, size, hash, e_tag, created_at FROM file_blocks WHERE backend_id = ? AND path = ? ORDER BY number",
+		backendID, path)
+}
+
+// ReplaceFileBlocks replaces all block signatures of the path
+func (s *SQLStore) ReplaceFileBlocks(ctx context.Context, backendID, path string, blocks []models.FileBlock) error {
+	return s.transaction(ctx, func(tx *sql.Tx) error {
+		if _, err := tx.ExecContext(ctx, "DELETE FROM file_blocks WHERE backend_id = ? AND path = ?", backendID, path); err != nil {
+			return err
+		}
+
+		stmt, err := tx.PrepareContext(ctx, "INSERT INTO file_blocks (backend_id, path, number, `offset`, size, hash, e_tag, created_at) VALUES (?, ?, ?, ?, ?, ?, ?, ?)")
+		if err != nil {
+			return err
+		}
+		defer stmt.Close()
+
+		for i := range blocks {
+			block := &blocks[i]
+			timestamps(&block.CreatedAt, nil)
+
+			result, err := stmt.ExecContext(ctx, block.BackendID, block.Path, block.Number, block.Offset, block.Size, block.Hash, block.ETag, block.CreatedAt)
+			if err != nil {
+				return err
+			}
+			id, err := result.LastInsertId()
+			if err != nil {
+				return err
+			}
+			block.ID = uint(id)
+		}
+		return nil
+	})
+}
+
+// Tag operations
+
+func scanTag(row scanner, t *models.Tag) error {
+	return row.Scan(&t.ID, null(&t.FileID), null(&t.Key), null(&t.Value), null(&t.CreatedAt), null(&t.UpdatedAt), &t.DeletedAt)
+}
+
+func (s *SQLStore) CreateTag(ctx context.Context, tag *models.Tag) error {
+	timestamps(&tag.CreatedAt, &tag.UpdatedAt)
+
+	id, err := insert(ctx, s.db, "INSERT INTO tags (file_id, key, value, created_at, updated_at, deleted_at) VALUES (?, ?, ?, ?, ?, ?)",
+		tag.FileID, tag.Key, tag.Value, tag.CreatedAt, tag.UpdatedAt, tag.DeletedAt)
+	if err != nil {
+		return err
+	}
+	tag.ID = id
+	return nil
+}
+
+func (s *SQLStore) GetFileTags(ctx context.Context, fileID uint) ([]models.Tag, error) {
+	return queryAll(ctx, s.db, scanTag, "SELECT id, file_id, key, value, created_at, updated_at, deleted_at FROM tags WHERE file_id = ? AND deleted_at IS NULL", fileID)
+}
+
+func (s *SQLStore) GetFilesByTag(ctx context.Context, key, value string, limit, offset int) ([]models.File, error) {
+	query := `SELECT files.id, files.backend_id, files.path, files.size, files.md5_hash, files.sha256_hash, files.e_tag, files.version_id,
+		files.deduplicated, files.compression, files.mode, files.owner, files.xattrs, files.sparse, files.modified_at, files.created_at, files.updated_at, files.deleted_at
+		FROM files JOIN tags ON tags.file_id = files.id AND tags.deleted_at IS NULL
+		WHERE tags.key = ? AND tags.value = ? AND files.deleted_at IS NULL ORDER BY files.id`
+
+	query, args := paginate(query, []any{key, value}, limit, offset)
+	return queryAll(ctx, s.db, scanFile, query, args...)
+}
+
+func (s *SQLStore) DeleteTag(ctx context.Context, id uint) error {
+	_, err := s.db.ExecContext(ctx, "UPDATE tags SET deleted_at = ? WHERE id = ? AND deleted_at IS NULL", time.Now().UTC(), id)
+	return err
+}
+
+func (s *SQLStore) DeleteFileTags(ctx context.Context, fileID uint) error {
+	_, err := s.db.ExecContext(ctx, "UPDATE tags SET deleted_at = ? WHERE file_id = ? AND deleted_at IS NULL", time.Now().UTC(), fileID)
+	return err
+}
+
+// Filter operations
+
+const filterColumns = "id, virtual_path, name, query_expression, description, created_at, updated_at, deleted_at"
+
+func scanFilter(row scanner, f *models.Filter) error {
+	return row.Scan(&f.ID, null(&f.VirtualPath), null(&f.Name), null(&f.QueryExpression), null(&f.Description),
+		null(&f.CreatedAt), null(&f.UpdatedAt), &f.DeletedAt)
+}
+
+func (s *SQLStore) CreateFilter(ctx context.Context, filter *models.Filter) error {
+	timestamps(&filter.CreatedAt, &filter.UpdatedAt)
+
+	id, err := insert(ctx, s.db, "INSERT INTO filters (virtual_path, name, query_expression, description, created_at, updated_at, deleted_at) VALUES (?, ?, ?, ?, ?, ?, ?)",
+		filter.VirtualPath, filter.Name, filter.QueryExpression, filter.Description, filter.CreatedAt, filter.UpdatedAt, filter.DeletedAt)
+	if err != nil {
+		return err
+	}
+	filter.ID = id
+	return nil
+}
+
+func (s *SQLStore) GetFilter(ctx context.Context, virtualPath string) (*models.Filter, error) {
+	return queryOne(ctx, s.db, scanFilter, "SELECT "+filterColumns+" FROM filters WHERE virtual_path = ? AND deleted_at IS NULL ORDER BY id LIMIT 1", virtualPath)
+}
+
+func (s *SQLStore) ListFilters(ctx context.Context) ([]models.Filter, error) {
+	return queryAll(ctx, s.db, scanFilter, "SELECT "+filterColumns+" FROM filters WHERE deleted_at IS NULL")
+}
+
+func (s *SQLStore) UpdateFilter(ctx context.Context, filter *models.Filter) error {
+	if filter.ID == 0 {
+		return s.CreateFilter(ctx, filter)
+	}
+	filter.UpdatedAt = time.Now().UTC()
+
+	_, err := s.db.ExecContext(ctx, `UPDATE filters SET virtual_path = ?, name = ?, query_expression = ?, description = ?, created_at = ?, updated_at = ?
+		WHERE id = ? AND deleted_at IS NULL`, filter.VirtualPath, filter.Name, filter.QueryExpression, filter.Description,
+		filter.CreatedAt, filter.UpdatedAt, filter.ID)
+	return err
+}
+
+// DeleteFilter removes the filter permanently, so its virtual path can be used again
+func (s *SQLStore) DeleteFilter(ctx context.Context, id uint) error {
+	_, err := s.db.ExecContext(ctx, "DELETE FROM filters WHERE id = ?", id)
+	return err
+}
+
+// Trash operations
+
+const trashItemColumns = "id, backend_id, path, trash_key, size, e_tag, trashed_at, expires_at, created_at"
+
+func scanTrashItem(row scanner, t *models.TrashItem) error {
+	return row.Scan(&t.ID, null(&t.BackendID), null(&t.Path), null(&t.TrashKey), null(&t.Size), null(&t.ETag),
+		null(&t.TrashedAt), null(&t.ExpiresAt), null(&t.CreatedAt))
+}
+
+func (s *SQLStore) CreateTrashItem(ctx context.Context, item *models.TrashItem) error {
+	timestamps(&item.CreatedAt, nil)
+
+	id, err := insert(ctx, s.db, "INSERT INTO trash_items (backend_id, path, trash_key, size, e_tag, trashed_at, expires_at, created_at) VALUES (?, ?, ?, ?, ?, ?, ?, ?)",
+		item.BackendID, item.Path, item.TrashKey, item.Size, item.ETag, item.TrashedAt, item.ExpiresAt, item.CreatedAt)
+	if err != nil {
+		return err
+	}
+	item.ID = id
+	return nil
+}
+
+func (s *SQLStore) GetTrashItem(ctx context.Context, id uint) (*models.TrashItem, error) {
+	return queryOne(ctx, s.db, scanTrashItem, "SELECT "+trashItemColumns+" FROM trash_items WHERE id = ? ORDER BY id LIMIT 1", id)
+}
+
+func (s *SQLStore) ListTrashItems(ctx context.Context, backendID, pathPrefix string) ([]models.TrashItem, error) {
+	query := "SELECT " + trashItemColumns + " FROM trash_items WHERE backend_id = ?"
+	args := []any{backendID}
+
+	if pathPrefix != "" {
+		query += " AND path LIKE ? ESCAPE '\\'"
+		args = append(args, like(pathPrefix))
+	}
+
+	return queryAll(ctx, s.db, scanTrashItem, query+" ORDER BY trashed_at DESC", args...)
+}
+
+func (s *SQLStore) ListExpiredTrashItems(ctx context.Context, backendID string, before time.Time, limit int) ([]models.TrashItem, error) {
+	query, args := paginate("SELECT "+trashItemColumns+" FROM trash_items WHERE backend_id = ? AND expires_at > ? AND expires_at <= ? ORDER BY expires_at",
+		[]any{backendID, time.Time{}, before}, limit, 0)
+	return queryAll(ctx, s.db, scanTrashItem, query, args...)
+}
+
+func (s *SQLStore) DeleteTrashItem(ctx context.Context, id uint) error {
+	_, err := s.db.ExecContext(ctx, "DELETE FROM trash_items WHERE id = ?", id)
+	return err
+}
+
+// Client operations
+
+const clientColumns = "id, name, machine_id, version, platform, address, active_syncs, started_at, last_seen_at, stopped_at, revoked_at, revoked_reason, created_at, updated_at"
+
+func scanClient(row scanner, c *models.Client) error {
+	return row.Scan(&c.ID, null(&c.Name), null(&c.MachineID), null(&c.Version), null(&c.Platform), null(&c.Address), null(&c.ActiveSyncs),
+		null(&c.StartedAt), null(&c.LastSeenAt), &c.StoppedAt, &c.RevokedAt, null(&c.RevokedReason), null(&c.CreatedAt), null(&c.UpdatedAt))
+}
+
+func (s *SQLStore) SaveClient(ctx context.Context, client *models.Client) error {
+	timestamps(&client.CreatedAt, nil)
+	client.UpdatedAt = time.Now().UTC()
+
+	// The revocation is only changed by RevokeClient, revoked clients aren't updated at all
+	result, err := s.db.ExecContext(ctx, `INSERT INTO clients (id, name, machine_id, version, platform, address, active_syncs, started_at, last_seen_at,
+		stopped_at, created_at, updated_at) VALUES (`+placeholders(12)+`) ON CONFLICT (id) DO UPDATE SET name = excluded.name,
+		machine_id = excluded.machine_id, version = excluded.version, platform = excluded.platform, address = excluded.address,
+		active_syncs = excluded.active_syncs, started_at = excluded.started_at, last_seen_at = excluded.last_seen_at,
+		stopped_at = excluded.stopped_at, updated_at = excluded.updated_at
+		WHERE clients.revoked_at IS NULL`,
+		client.ID, client.Name, client.MachineID, client.Version, client.Platform, client.Address, client.ActiveSyncs, client.StartedAt,
+		client.LastSeenAt, client.StoppedAt, client.CreatedAt, client.UpdatedAt)
+	if err != nil {
+		return err
+	}
+	if affected, err := result.RowsAffected(); err == nil && affected == 0 {
+		return ErrClientRevoked
+	}
+	return nil
+}
+
+func (s *SQLStore) ListClients(ctx context.Context) ([]models.Client, error) {
+	return queryAll(ctx, s.db, scanClient, "SELECT "+clientColumns+" FROM clients ORDER BY last_seen_at DESC")
+}
+
+func (s *SQLStore) RevokeClient(ctx context.Context, id string, revokedAt *time.Time, reason string) error {
+	result, err := s.db.ExecContext(ctx, "UPDATE clients SET revoked_at = ?, revoked_reason = ?, updated_at = ? WHERE id = ?",
+		revokedAt, reason, time.Now().UTC(), id)
+	if err != nil {
+		return err
+	}
+	if affected, err := result.RowsAffected(); err == nil && affected == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+// Maintenance operations
+
+func scanMaintenance(row scanner, m *models.Maintenance) error {
+	return row.Scan(&m.ClientID, null(&m.Reason), null(&m.Since))
+}
+
+func (s *SQLStore) GetMaintenance(ctx context.Context, clientID string) (*models.Maintenance, error) {
+	return queryOne(ctx, s.db, scanMaintenance, "SELECT client_id, reason, since FROM maintenances WHERE client_id = ?", clientID)
+}
+
+func (s *SQLStore) SaveMaintenance(ctx context.Context, maintenance *models.Maintenance) error {
+	_, err := s.db.ExecContext(ctx, "INSERT INTO maintenances (client_id, reason, since) VALUES (?, ?, ?) ON CONFLICT (client_id) DO UPDATE SET reason = excluded.reason, since = excluded.since",
+		maintenance.ClientID, maintenance.Reason, maintenance.Since)
+	return err
+}
+
+func (s *SQLStore) DeleteMaintenance(ctx context.Context, clientID string) error {
+	_, err := s.db.ExecContext(ctx, "DELETE FROM maintenances WHERE client_id = ?", clientID)
+	return err
+}
+
+// Lock operations
+
+const lockColumns = "id, backend_id, path, owner, client_id, acquired_at, expires_at, created_at, updated_at"
+
+func scanLock(row scanner, l *models.Lock) error {
+	return row.Scan(&l.ID, null(&l.BackendID), null(&l.Path), null(&l.Owner), null(&l.ClientID), null(&l.AcquiredAt),
+		null(&l.ExpiresAt), null(&l.CreatedAt), null(&l.UpdatedAt))
+}
+
+func (s *SQLStore) CreateLock(ctx context.Context, lock *models.Lock) error {
+	timestamps(&lock.CreatedAt, &lock.UpdatedAt)
+
+	id, err := insert(ctx, s.db, "INSERT INTO locks (backend_id, path, owner, client_id, acquired_at, expires_at, created_at, updated_at) VALUES (?, ?, ?, ?, ?, ?, ?, ?)",
+		lock.BackendID, lock.Path, lock.Owner, lock.ClientID, lock.AcquiredAt, lock.ExpiresAt, lock.CreatedAt, lock.UpdatedAt)
+	if err != nil {
+		return err
+	}
+	lock.ID = id
+	return nil
+}
+
+func (s *SQLStore) GetLock(ctx context.Context, backendID, path string) (*models.Lock, error) {
+	return queryOne(ctx, s.db, scanLock, "SELECT "+lockColumns+" FROM locks WHERE backend_id = ? AND path = ? ORDER BY id LIMIT 1", backendID, path)
+}
+
+func (s *SQLStore) ListLocks(ctx context.Context, backendID, pathPrefix string) ([]models.Lock, error) {
+	query := "SELECT " + lockColumns + " FROM locks WHERE 1 = 1"
+	var args []any
+
+	if backendID != "" {
+		query += " AND backend_id = ?"
+		args = append(args, backendID)
+	}
+	if pathPrefix != "" {
+		query += " AND path LIKE ? ESCAPE '\\'"
+		args = append(args, like(pathPrefix))
+	}
+
+	return queryAll(ctx, s.db, scanLock, query+" ORDER BY backend_id, path", args...)
+}
+
+func (s *SQLStore) UpdateLock(ctx context.Context, lock *models.Lock) error {
+	if lock.ID == 0 {
+		return s.CreateLock(ctx, lock)
+	}
+	lock.UpdatedAt = time.Now().UTC()
+
+	_, err := s.db.ExecContext(ctx, `UPDATE locks SET backend_id = ?, path = ?, owner = ?, client_id = ?, acquired_at = ?, expires_at = ?,
+		created_at = ?, updated_at = ? WHERE id = ?`, lock.BackendID, lock.Path, lock.Owner, lock.ClientID, lock.AcquiredAt, lock.ExpiresAt,
+		lock.CreatedAt, lock.UpdatedAt, lock.ID)
+	return err
+}
+
+func (s *SQLStore) DeleteLock(ctx context.Context, id uint) error {
+	_, err := s.db.ExecContext(ctx, "DELETE FROM locks WHERE id = ?", id)
+	return err
+}
+
+// API token operations
+
+const apiTokenColumns = "id, name, hash, prefix, scope, expires_at, last_used_at, revoked_at, created_at, updated_at"
+
+func scanAPIToken(row scanner, t *models.APIToken) error {
+	return row.Scan(&t.ID, null(&t.Name), null(&t.Hash), null(&t.Prefix), null(&t.Scope), &t.ExpiresAt, &t.LastUsedAt,
+		&t.RevokedAt, null(&t.CreatedAt), null(&t.UpdatedAt))
+}
+
+func (s *SQLStore) CreateAPIToken(ctx context.Context, token *models.APIToken) error {
+	timestamps(&token.CreatedAt, &token.UpdatedAt)
+
+	id, err := insert(ctx, s.db, `INSERT INTO api_tokens (name, hash, prefix, scope, expires_at, last_used_at, revoked_at, created_at, updated_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)`, token.Name, token.Hash, token.Prefix, token.Scope, token.ExpiresAt, token.LastUsedAt,
+		token.RevokedAt, token.CreatedAt, token.UpdatedAt)
+	if err != nil {
+		return err
+	}
+	token.ID = id
+	return nil
+}
+
+func (s *SQLStore) GetAPIToken(ctx context.Context, name string) (*models.APIToken, error) {
+	return queryOne(ctx, s.db, scanAPIToken, "SELECT "+apiTokenColumns+" FROM api_tokens WHERE name = ? LIMIT 1", name)
+}
+
+func (s *SQLStore) GetAPITokenByHash(ctx context.Context, hash string) (*models.APIToken, error) {
+	return queryOne(ctx, s.db, scanAPIToken, "SELECT "+apiTokenColumns+" FROM api_tokens WHERE hash = ? LIMIT 1", hash)
+}
+
+func (s *SQLStore) ListAPITokens(ctx context.Context) ([]models.APIToken, error) {
+	return queryAll(ctx, s.db, scanAPIToken, "SELECT "+apiTokenColumns+" FROM api_tokens ORDER BY name")
+}
+
+func (s *SQLStore) UpdateAPIToken(ctx context.Context, token *models.APIToken) error {
+	if token.ID == 0 {
+		return s.CreateAPIToken(ctx, token)
+	}
+	token.UpdatedAt = time.Now().UTC()
+
+	_, err := s.db.ExecContext(ctx, `UPDATE api_tokens SET name = ?, hash = ?, prefix = ?, scope = ?, expires_at = ?, last_used_at = ?,
+		revoked_at = ?, created_at = ?, updated_at = ? WHERE id = ?`, token.Name, token.Hash, token.Prefix, token.Scope, token.ExpiresAt,
+		token.LastUsedAt, token.RevokedAt, token.CreatedAt, token.UpdatedAt, token.ID)
+	return err
+}
+
+// Restore drill operations
+
+const restoreDrillColumns = "id, backend_id, started_at, finished_at, sampled, verified, failed, bytes, failures, error, created_at"
+
+func scanRestoreDrill(row scanner, d *models.RestoreDrill) error {
+	return row.Scan(&d.ID, null(&d.BackendID), null(&d.StartedAt), null(&d.FinishedAt), null(&d.Sampled), null(&d.Verified),
+		null(&d.Failed), null(&d.Bytes), null(&d.Failures), null(&d.Error), null(&d.CreatedAt))
+}
+
+func (s *SQLStore) CreateRestoreDrill(ctx context.Context, drill *models.RestoreDrill) error {
+	timestamps(&drill.CreatedAt, nil)
+
+	id, err := insert(ctx, s.db, `INSERT INTO restore_drills (backend_id, started_at, finished_at, sampled, verified, failed, bytes, failures, error, created_at)
+		VALUES (`+placeholders(10)+`)`, drill.BackendID, drill.StartedAt, drill.FinishedAt, drill.Sampled, drill.Verified, drill.Failed,
+		drill.Bytes, drill.Failures, drill.Error, drill.CreatedAt)
+	if err != nil {
+		return err
+	}
+	drill.ID = id
+	return nil
+}
+
+func (s *SQLStore) ListRestoreDrills(ctx context.Context, backendID string, limit int) ([]models.RestoreDrill, error) {
+	query := "SELECT " + restoreDrillColumns + " FROM restore_drills WHERE 1 = 1"
+	var args []any
+
+	if backendID != "" {
+		query += " AND backend_id = ?"
+		args = append(args, backendID)
+	}
+	query += " ORDER BY started_at DESC"
+	if limit > 0 {
+		query += " LIMIT ?"
+		args = append(args, limit)
+	}
+
+	return queryAll(ctx, s.db, scanRestoreDrill, query, args...)
+}
+
+// Integrity error operations
+
+const integrityErrorColumns = "id, sync_config_id, client_id, path, detected_at, `check`, expected, actual, created_at"
+
+func scanIntegrityError(row scanner, e *models.IntegrityError) error {
+	return row.Scan(&e.ID, null(&e.SyncConfigID), null(&e.ClientID), null(&e.Path), null(&e.DetectedAt), null(&e.Check),
+		null(&e.Expected), null(&e.Actual), null(&e.CreatedAt))
+}
+
+func (s *SQLStore) CreateIntegrityError(ctx context.Context, integrity *models.IntegrityError) error {
+	timestamps(&integrity.CreatedAt, nil)
+
+	id, err := insert(ctx, s.db, "INSERT INTO integrity_errors (sync_config_id, client_id, path, detected_at, `check`, expected, actual, created_at) VALUES ("+placeholders(8)+")",
+		integrity.SyncConfigID, integrity.ClientID, integrity.Path, integrity.DetectedAt, integrity.Check, integrity.Expected, integrity.Actual, integrity.CreatedAt)
+	if err != nil {
+		return err
+	}
+	integrity.ID = id
+	return nil
+}
+
+func (s *SQLStore) ListIntegrityErrors(ctx context.Context, syncConfigID uint, limit int) ([]models.IntegrityError, error) {
+	query := "SELECT " + integrityErrorColumns + " FROM integrity_errors WHERE 1 = 1"
+	var args []any
+
+	if syncConfigID != 0 {
+		query += " AND sync_config_id = ?"
+		args = append(args, syncConfigID)
+	}
+	query += " ORDER BY detected_at DESC"
+	if limit > 0 {
+		query += " LIMIT ?"
+		args = append(args, limit)
+	}
+
+	return queryAll(ctx, s.db, scanIntegrityError, query, args...)
+}
+
+// Search index operations
+
+func scanIndexCursor(row scanner, c *models.IndexCursor) error {
+	return row.Scan(null(&c.Name), null(&c.EventID), null(&c.UpdatedAt))
+}
+
+func (s *SQLStore) GetIndexCursor(ctx context.Context, name string) (*models.IndexCursor, error) {
+	return queryOne(ctx, s.db, scanIndexCursor, "SELECT name, event_id, updated_at FROM index_cursors WHERE name = ? LIMIT 1", name)
+}
+
+func (s *SQLStore) SaveIndexCursor(ctx context.Context, cursor *models.IndexCursor) error {
+	cursor.UpdatedAt = time.Now().UTC()
+
+	_, err := s.db.ExecContext(ctx, `INSERT INTO index_cursors (name, event_id, updated_at) VALUES (?, ?, ?)
+		ON CONFLICT (name) DO UPDATE SET event_id = excluded.event_id, updated_at = excluded.updated_at`,
+		cursor.Name, cursor.EventID, cursor.UpdatedAt)
+	return err
+}
+
+func (s *SQLStore) DeleteIndexCursor(ctx context.Context, name string) error {
+	_, err := s.db.ExecContext(ctx, "DELETE FROM index_cursors WHERE name = ?", name)
+	return err
+}
+
+// Bandwidth usage operations
+
+// AddBandwidthUsage adds the usage to the rollup of the backend and month, creating it if required
+func (s *SQLStore) AddBandwidthUsage(ctx context.Context, usage *models.BandwidthUsage) error {
+	timestamps(&usage.CreatedAt, &usage.UpdatedAt)
+
+	return s.db.QueryRowContext(ctx, `INSERT INTO bandwidth_usages (backend_id, month, bytes_uploaded, bytes_downloaded, api_calls, created_at, updated_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?) ON CONFLICT (backend_id, month) DO UPDATE SET bytes_uploaded = bytes_uploaded + excluded.bytes_uploaded,
+		bytes_downloaded = bytes_downloaded + excluded.bytes_downloaded, api_calls = api_calls + excluded.api_calls, updated_at = excluded.updated_at
+		RETURNING id`, usage.BackendID, usage.Month, usage.BytesUploaded, usage.BytesDownloaded, usage.APICalls, usage.CreatedAt, usage.UpdatedAt).Scan(&usage.ID)
+}
+
+func scanBandwidthUsage(row scanner, u *models.BandwidthUsage) error {
+	return row.Scan(&u.ID, null(&u.BackendID), null(&u.Month), null(&u.BytesUploaded), null(&u.BytesDownloaded), null(&u.APICalls),
+		null(&u.CreatedAt), null(&u.UpdatedAt))
+}
+
+func (s *SQLStore) ListBandwidthUsage(ctx context.Context, backendID, fromMonth, toMonth string) ([]models.BandwidthUsage, error) {
+	query := "SELECT id, backend_id, month, bytes_uploaded, bytes_downloaded, api_calls, created_at, updated_at FROM bandwidth_usages WHERE 1 = 1"
+	var args []any
+
+	if backendID != "" {
+		query += " AND backend_id = ?"
+		args = append(args, backendID)
+	}
+	if fromMonth != "" {
+		query += " AND month >= ?"
+		args = append(args, fromMonth)
+	}
+	if toMonth != "" {
+		query += " AND month <= ?"
+		args = append(args, toMonth)
+	}
+
+	return queryAll(ctx, s.db, scanBandwidthUsage, query+" ORDER BY month DESC, backend_id", args...)
+}
+
+// Storage usage operations
+
+const storageUsageColumns = "id, backend_id, prefix, parent, objects, bytes, updated_at"
+
+func scanStorageUsage(row scanner, u *models.StorageUsage) error {
+	return row.Scan(&u.ID, null(&u.BackendID), null(&u.Prefix), null(&u.Parent), null(&u.Objects), null(&u.Bytes), null(&u.UpdatedAt))
+}
+
+// GetStorageUsage returns the usage of the backend below the prefix ("" for the whole backend)
+func (s *SQLStore) GetStorageUsage(ctx context.Context, backendID, prefix string) (*models.StorageUsage, error) {
+	usage, err := queryOne(ctx, s.db, scanStorageUsage, "SELECT "+storageUsageColumns+" FROM storage_usages WHERE backend_id = ? AND prefix = ?",
+		backendID, prefix)
+	if errors.Is(err, ErrNotFound) {
+		return &models.StorageUsage{BackendID: backendID, Prefix: prefix}, nil
+	}
+	return usage, err
+}
+
+func (s *SQLStore) ListStorageUsage(ctx context.Context, backendID, prefix string) ([]models.StorageUsage, error) {
+	// The whole backend is the parent of itself
+	return queryAll(ctx, s.db, scanStorageUsage, "SELECT "+storageUsageColumns+" FROM storage_usages WHERE backend_id = ? AND parent = ? AND prefix != '' ORDER BY prefix",
+		backendID, prefix)
+}
+
+// Sync activity operations
+
+// AddSyncActivity adds the activity to the rollup of the sync, client and day, creating it if required
+func (s *SQLStore) AddSyncActivity(ctx context.Context, activity *models.SyncActivity) error {
+	timestamps(&activity.CreatedAt, &activity.UpdatedAt)
+
+	return s.db.QueryRowContext(ctx, `INSERT INTO sync_activities (sync_config_id, client_id, day, passes, added, changed, deleted, conflicts, errors, bytes, created_at, updated_at)
+		VALUES (`+placeholders(12)+`) ON CONFLICT (sync_config_id, client_id, day) DO UPDATE SET passes = passes + excluded.passes,
+		added = added + excluded.added, changed = changed + excluded.changed, deleted = deleted + excluded.deleted,
+		conflicts = conflicts + excluded.conflicts, errors = errors + excluded.errors, bytes = bytes + excluded.bytes, updated_at = excluded.updated_at
+		RETURNING id`, activity.SyncConfigID, activity.ClientID, activity.Day, activity.Passes, activity.Added, activity.Changed, activity.Deleted,
+		activity.Conflicts, activity.Errors, activity.Bytes, activity.CreatedAt, activity.UpdatedAt).Scan(&activity.ID)
+}
+
+func scanSyncActivity(row scanner, a *models.SyncActivity) error {
+	return row.Scan(&a.ID, &a.SyncConfigID, null(&a.ClientID), null(&a.Day), null(&a.Passes), null(&a.Added), null(&a.Changed),
+		null(&a.Deleted), null(&a.Conflicts), null(&a.Errors), null(&a.Bytes), null(&a.CreatedAt), null(&a.UpdatedAt))
+}
+
+func (s *SQLStore) ListSyncActivity(ctx context.Context, syncConfigID uint, fromDay, toDay string) ([]models.SyncActivity, error) {
+	query := "SELECT id, sync_config_id, client_id, day, passes, added, changed, deleted, conflicts, errors, bytes, created_at, updated_at FROM sync_activities WHERE 1 = 1"
+	var args []any
+
+	if syncConfigID != 0 {
+		query += " AND sync_config_id = ?"
+		args = append(args, syncConfigID)
+	}
+	if fromDay != "" {
+		query += " AND day >= ?"
+		args = append(args, fromDay)
+	}
+	if toDay != "" {
+		query += " AND day <= ?"
+		args = append(args, toDay)
+	}
+
+	return queryAll(ctx, s.db, scanSyncActivity, query+" ORDER BY day DESC, sync_config_id, client_id", args...)
+}
+
+// Transfer log operations
+
+const transferLogColumns = "id, sync_config_id, client_id, operation, source, destination, bytes, result, error, started_at, finished_at"
+
+func scanTransferLog(row scanner, l *models.TransferLog) error {
+	return row.Scan(&l.ID, &l.SyncConfigID, null(&l.ClientID), null(&l.Operation), null(&l.Source), null(&l.Destination), null(&l.Bytes),
+		null(&l.Result), null(&l.Error), null(&l.StartedAt), null(&l.FinishedAt))
+}
+
+func (s *SQLStore) CreateTransferLog(ctx context.Context, entry *models.TransferLog) error {
+	id, err := insert(ctx, s.db, "INSERT INTO transfer_logs (sync_config_id, client_id, operation, source, destination, bytes, result, error, started_at, finished_at) VALUES ("+placeholders(10)+")",
+		entry.SyncConfigID, entry.ClientID, entry.Operation, entry.Source, entry.Destination, entry.Bytes, entry.Result, entry.Error, entry.StartedAt, entry.FinishedAt)
+	if err != nil {
+		return err
+	}
+	entry.ID = id
+	return nil
+}
+
+func (s *SQLStore) ListTransferLogs(ctx context.Context, filter TransferLogFilter) ([]models.TransferLog, error) {
+	query := "SELECT " + transferLogColumns + " FROM transfer_logs"
+	cond, args := transferLogConditions(filter)
+	if cond != "" {
+		query += " WHERE " + cond
+	}
+	query += " ORDER BY id DESC"
+	if filter.Limit > 0 {
+		query += " LIMIT ?"
+		args = append(args, filter.Limit)
+	}
+
+	return queryAll(ctx, s.db, scanTransferLog, query, args...)
+}
+
+func (s *SQLStore) PruneTransferLogs(ctx context.Context, maxBytes int64) (int64, error) {
+	result, err := s.db.ExecContext(ctx, pruneTransferLogsStatement, maxBytes)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
+// Local hash operations
+
+func scanLocalHash(row scanner, h *models.LocalHash) error {
+	return row.Scan(null(&h.Path), null(&h.Size), null(&h.ModifiedAt), null(&h.Inode), null(&h.MD5Hash), null(&h.SHA256Hash), null(&h.HashedAt))
+}
+
+func (s *SQLStore) GetLocalHash(ctx context.Context, path string) (*models.LocalHash, error) {
+	return queryOne(ctx, s.db, scanLocalHash, "SELECT path, size, modified_at, inode, md5_hash, sha256_hash, hashed_at FROM local_hashes WHERE path = ? LIMIT 1", path)
+}
+
+func (s *SQLStore) SaveLocalHash(ctx context.Context, hash *models.LocalHash) error {
+	_, err := s.db.ExecContext(ctx, `INSERT INTO local_hashes (path, size, modified_at, inode, md5_hash, sha256_hash, hashed_at) VALUES (`+placeholders(7)+`)
+		ON CONFLICT (path) DO UPDATE SET size = excluded.size, modified_at = excluded.modified_at, inode = excluded.inode,
+		md5_hash = excluded.md5_hash, sha256_hash = excluded.sha256_hash, hashed_at = excluded.hashed_at`,
+		hash.Path, hash.Size, hash.ModifiedAt, hash.Inode, hash.MD5Hash, hash.SHA256Hash, hash.HashedAt)
+	return err
+}
+
+// Sync operations
+
+const syncConfigColumns = "id, name, source_path, dest_path, direction, isolated, enabled, `interval`, schedule, jitter, blackout, max_duration, stop_at, deadline_grace, workers, weight, queue_order, chunk_size, ignore_pattern, min_size, max_size, modified_after, modified_before, include_mime, exclude_mime, delete_grace, delta_threshold, dedup, compression, compression_rules, verify, integrity, symlinks, normalization, reserved_names, preserve, publish, on_demand, created_at, updated_at, deleted_at"
+
+func scanSyncConfig(row scanner, c *models.SyncConfig) error {
+	return row.Scan(&c.ID, null(&c.Name), null(&c.SourcePath), null(&c.DestPath), null(&c.Direction), null(&c.Isolated), null(&c.Enabled),
+		null(&c.Interval), null(&c.Schedule), null(&c.Jitter), null(&c.Blackout), null(&c.MaxDuration), null(&c.StopAt), null(&c.DeadlineGrace),
+		null(&c.Workers), null(&c.Weight), null(&c.QueueOrder), null(&c.ChunkSize), null(&c.IgnorePattern), null(&c.MinSize), null(&c.MaxSize), null(&c.ModifiedAfter), null(&c.ModifiedBefore),
+		null(&c.IncludeMime), null(&c.ExcludeMime), null(&c.DeleteGrace), null(&c.DeltaThreshold), null(&c.Dedup), null(&c.Compression), null(&c.CompressionRules), null(&c.Verify), null(&c.Integrity), null(&c.Symlinks), null(&c.Normalization), null(&c.ReservedNames), null(&c.Preserve), null(&c.Publish), null(&c.OnDemand), null(&c.CreatedAt), null(&c.UpdatedAt), &c.DeletedAt)
+}
+
+func syncConfigValues(c *models.SyncConfig) []any {
+	return []any{c.Name, c.SourcePath, c.DestPath, c.Direction, c.Isolated, c.Enabled, c.Interval, c.Schedule, c.Jitter, c.Blackout,
+		c.MaxDuration, c.StopAt, c.DeadlineGrace, c.Workers, c.Weight, c.QueueOrder, c.ChunkSize, c.IgnorePattern, c.MinSize, c.MaxSize, c.ModifiedAfter, c.ModifiedBefore, c.IncludeMime, c.ExcludeMime, c.DeleteGrace, c.DeltaThreshold, c.Dedup, c.Compression, c.CompressionRules, c.Verify, c.Integrity, c.Symlinks, c.Normalization, c.ReservedNames, c.Preserve, c.Publish, c.OnDemand, c.CreatedAt, c.UpdatedAt}
+}
+
+func (s *SQLStore) CreateSyncConfig(ctx context.Context, config *models.SyncConfig) error {
+	// Zero values of columns with a default are replaced by the default, matching GORM
+	if !config.Enabled {
+		config.Enabled = true
+	}
+	if config.Workers == 0 {
+		config.Workers = 4
+	}
+	if config.Weight == 0 {
+		config.Weight = 1
+	}
+	if config.ChunkSize == 0 {
+		config.ChunkSize = 5242880
+	}
+	if config.DeltaThreshold == 0 {
+		config.DeltaThreshold = 67108864
+	}
+	timestamps(&config.CreatedAt, &config.UpdatedAt)
+
+	id, err := insert(ctx, s.db, "INSERT INTO sync_configs (name, source_path, dest_path, direction, isolated, enabled, `interval`, schedule, jitter, blackout, max_duration, stop_at, deadline_grace, workers, weight, queue_order, chunk_size, ignore_pattern, min_size, max_size, modified_after, modified_before, include_mime, exclude_mime, delete_grace, delta_threshold, dedup, compression, compression_rules, verify, integrity, symlinks, normalization, reserved_names, preserve, publish, on_demand, created_at, updated_at) VALUES ("+placeholders(39)+")",
+		syncConfigValues(config)...)
+	if err != nil {
+		return err
+	}
+	config.ID = id
+
+	for i := range config.Selections {
+		config.Selections[i].SyncConfigID = id
+		if err := s.SaveSyncSelection(ctx, &config.Selections[i]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (s *SQLStore) GetSyncConfig(ctx context.Context, name string) (*models.SyncConfig, error) {
+	return queryOne(ctx, s.db, scanSyncConfig, "SELECT "+syncConfigColumns+" FROM sync_configs WHERE name = ? AND deleted_at IS NULL ORDER BY id LIMIT 1", name)
+}
+
+func (s *SQLStore) ListSyncConfigs(ctx context.Context) ([]models.SyncConfig, error) {
+	return queryAll(ctx, s.db, scanSyncConfig, "SELECT "+syncConfigColumns+" FROM sync_configs WHERE deleted_at IS NULL")
+}
+
+func (s *SQLStore) UpdateSyncConfig(ctx context.Context, config *models.SyncConfig) error {
+	if config.ID == 0 {
+		return s.CreateSyncConfig(ctx, config)
+	}
+	config.UpdatedAt = time.Now().UTC()
+
+	_, err := s.db.ExecContext(ctx, "UPDATE sync_configs SET name = ?, source_path = ?, dest_path = ?, direction = ?, isolated = ?, enabled = ?, `interval` = ?, schedule = ?, jitter = ?, blackout = ?, max_duration = ?, stop_at = ?, deadline_grace = ?, workers = ?, weight = ?, queue_order = ?, chunk_size = ?, ignore_pattern = ?, min_size = ?, max_size = ?, modified_after = ?, modified_before = ?, include_mime = ?, exclude_mime = ?, delete_grace = ?, delta_threshold = ?, dedup = ?, compression = ?, compression_rules = ?, verify = ?, integrity = ?, symlinks = ?, normalization = ?, reserved_names = ?, preserve = ?, publish = ?, on_demand = ?, created_at = ?, updated_at = ? WHERE id = ? AND deleted_at IS NULL",
+		append(syncConfigValues(config), config.ID)...)
+	return err
+}
+
+func (s *SQLStore) DeleteSyncConfig(ctx context.Context, id uint) error {
+	_, err := s.db.ExecContext(ctx, "UPDATE sync_configs SET deleted_at = ? WHERE id = ? AND deleted_at IS NULL", time.Now().UTC(), id)
+	return err
+}
+
+// Sync state operations
+
+const syncStateColumns = "id, sync_config_id, backend_id, client_id, last_sync_at, last_cursor, files_scanned, files_synced, bytes_synced, error_count, last_error, bootstrap, anomaly, anomaly_confirmed, scan_cursor, scanned_at, poll_interval, change_rate, journal_cursor, created_at, updated_at"
+
+func scanSyncState(row scanner, st *models.SyncState) error {
+	return row.Scan(&st.ID, null(&st.SyncConfigID), null(&st.BackendID), null(&st.ClientID), null(&st.LastSyncAt), null(&st.LastCursor),
+		null(&st.FilesScanned), null(&st.FilesSynced), null(&st.BytesSynced), null(&st.ErrorCount), null(&st.LastError),
+		null(&st.Bootstrap), null(&st.Anomaly), null(&st.AnomalyConfirmed), null(&st.ScanCursor), null(&st.ScannedAt), null(&st.PollInterval),
+		null(&st.ChangeRate), null(&st.JournalCursor), null(&st.CreatedAt), null(&st.UpdatedAt))
+}
+
+func syncStateValues(st *models.SyncState) []any {
+	return []any{st.SyncConfigID, st.BackendID, st.ClientID, st.LastSyncAt, st.LastCursor, st.FilesScanned, st.FilesSynced,
+		st.BytesSynced, st.ErrorCount, st.LastError, st.Bootstrap, st.Anomaly, st.AnomalyConfirmed, st.ScanCursor, st.ScannedAt, st.PollInterval,
+		st.ChangeRate, st.JournalCursor, st.CreatedAt, st.UpdatedAt}
+}
+
+func (s *SQLStore) CreateSyncState(ctx context.Context, state *models.SyncState) error {
+	timestamps(&state.CreatedAt, &state.UpdatedAt)
+
+	id, err := insert(ctx, s.db, `INSERT INTO sync_states (sync_config_id, backend_id, client_id, last_sync_at, last_cursor, files_scanned,
+		files_synced, bytes_synced, error_count, last_error, bootstrap, anomaly, anomaly_confirmed, scan_cursor, scanned_at,
+		poll_interval, change_rate, journal_cursor, created_at, updated_at) VALUES (`+placeholders(20)+`)`, syncStateValues(state)...)
+	if err != nil {
+		return err
+	}
+	state.ID = id
+	return nil
+}
+
+func (s *SQLStore) GetSyncState(ctx context.Context, syncConfigID uint, backendID, clientID string) (*models.SyncState, error) {
+	return queryOne(ctx, s.db, scanSyncState, "SELECT "+syncStateColumns+" FROM sync_states WHERE sync_config_id = ? AND backend_id = ? AND client_id = ? ORDER BY id LIMIT 1",
+		syncConfigID, backendID, clientID)
+}
+
+func (s *SQLStore) UpdateSyncState(ctx context.Context, state *models.SyncState) error {
+	if state.ID == 0 {
+		return s.CreateSyncState(ctx, state)
+	}
+	state.UpdatedAt = time.Now().UTC()
+
+	_, err := s.db.ExecContext(ctx, `UPDATE sync_states SET sync_config_id = ?, backend_id = ?, client_id = ?, last_sync_at = ?, last_cursor = ?,
+		files_scanned = ?, files_synced = ?, bytes_synced = ?, error_count = ?, last_error = ?, bootstrap = ?, anomaly = ?,
+		anomaly_confirmed = ?, scan_cursor = ?, scanned_at = ?, poll_interval = ?, change_rate = ?, journal_cursor = ?, created_at = ?, updated_at = ? WHERE id = ?`,
+		append(syncStateValues(state), state.ID)...)
+	return err
+}
+
+func (s *SQLStore) DeleteSyncState(ctx context.Context, id uint) error {
+	_, err := s.db.ExecContext(ctx, "DELETE FROM sync_states WHERE id = ?", id)
+	return err
+}
+
+// Sync baseline operations
+
+const syncBaselineColumns = "id, sync_config_id, client_id, path, size, source_e_tag, dest_e_tag, source_modified_at, dest_modified_at, synced_at, placeholder, created_at, updated_at"
+
+func scanSyncBaseline(row scanner, b *models.SyncBaseline) error {
+	return row.Scan(&b.ID, null(&b.SyncConfigID), null(&b.ClientID), null(&b.Path), null(&b.Size), null(&b.SourceETag), null(&b.DestETag),
+		null(&b.SourceModifiedAt), null(&b.DestModifiedAt), null(&b.SyncedAt), null(&b.Placeholder), null(&b.CreatedAt), null(&b.UpdatedAt))
+}
+
+func (s *SQLStore) ListSyncBaselines(ctx context.Context, syncConfigID uint, clientID string) ([]models.SyncBaseline, error) {
+	return queryAll(ctx, s.db, scanSyncBaseline, "SELECT "+syncBaselineColumns+" FROM sync_baselines WHERE sync_config_id = ? AND client_id = ? ORDER BY path",
+		syncConfigID, clientID)
+}
+
+func (s *SQLStore) GetSyncBaseline(ctx context.Context, syncConfigID uint, clientID, path string) (*models.SyncBaseline, error) {
+	return queryOne(ctx, s.db, scanSyncBaseline, "SELECT "+syncBaselineColumns+" FROM sync_baselines WHERE sync_config_id = ? AND client_id = ? AND path = ? LIMIT 1",
+		syncConfigID, clientID, path)
+}
+
+// SaveSyncBaseline creates or replaces the baseline of the path
+func (s *SQLStore) SaveSyncBaseline(ctx context.Context, baseline *models.SyncBaseline) error {
+	timestamps(&baseline.CreatedAt, &baseline.UpdatedAt)
+
+	return s.db.QueryRowContext(ctx, `INSERT INTO sync_baselines (sync_config_id, client_id, path, size, source_e_tag, dest_e_tag, source_modified_at, dest_modified_at, synced_at, placeholder, created_at, updated_at)
+		VALUES (`+placeholders(12)+`) ON CONFLICT (sync_config_id, client_id, path) DO UPDATE SET size = excluded.size,
+		source_e_tag = excluded.source_e_tag, dest_e_tag = excluded.dest_e_tag, source_modified_at = excluded.source_modified_at,
+		dest_modified_at = excluded.dest_modified_at, synced_at = excluded.synced_at, placeholder = excluded.placeholder, updated_at = excluded.updated_at
+		RETURNING id`, baseline.SyncConfigID, baseline.ClientID, baseline.Path, baseline.Size, baseline.SourceETag, baseline.DestETag,
+		baseline.SourceModifiedAt, baseline.DestModifiedAt, baseline.SyncedAt, baseline.Placeholder, baseline.CreatedAt, baseline.UpdatedAt).Scan(&baseline.ID)
+}
+
+func (s *SQLStore) DeleteSyncBaseline(ctx context.Context, syncConfigID uint, clientID, path string) error {
+	_, err := s.db.ExecContext(ctx, "DELETE FROM sync_baselines WHERE sync_config_id = ? AND client_id = ? AND path = ?", syncConfigID, clientID, path)
+	return err
+}
+
+// Sync selection operations
+
+func scanSyncSelection(row scanner, sel *models.SyncSelection) error {
+	return row.Scan(&sel.ID, null(&sel.SyncConfigID), null(&sel.Path), null(&sel.Mode), null(&sel.CreatedAt), null(&sel.UpdatedAt))
+}
+
+// SaveSyncSelection creates or replaces the selection of the directory
+func (s *SQLStore) SaveSyncSelection(ctx context.Context, selection *models.SyncSelection) error {
+	timestamps(&selection.CreatedAt, &selection.UpdatedAt)
+
+	return s.db.QueryRowContext(ctx, `INSERT INTO sync_selections (sync_config_id, path, mode, created_at, updated_at) VALUES (?, ?, ?, ?, ?)
+		ON CONFLICT (sync_config_id, path) DO UPDATE SET mode = excluded.mode, updated_at = excluded.updated_at RETURNING id`,
+		selection.SyncConfigID, selection.Path, selection.Mode, selection.CreatedAt, selection.UpdatedAt).Scan(&selection.ID)
+}
+
+func (s *SQLStore) ListSyncSelections(ctx context.Context, syncConfigID uint) ([]models.SyncSelection, error) {
+	return queryAll(ctx, s.db, scanSyncSelection, "SELECT id, sync_config_id, path, mode, created_at, updated_at FROM sync_selections WHERE sync_config_id = ? ORDER BY path",
+		syncConfigID)
+}
+
+func (s *SQLStore) DeleteSyncSelection(ctx context.Context, syncConfigID uint, path string) error {
+	_, err := s.db.ExecContext(ctx, "DELETE FROM sync_selections WHERE sync_config_id = ? AND path = ?", syncConfigID, path)
+	return err
+}
+
+// Sync pin operations
+
+func scanSyncPin(row scanner, pin *models.SyncPin) error {
+	return row.Scan(&pin.ID, null(&pin.SyncConfigID), null(&pin.ClientID), null(&pin.Path), null(&pin.Pinned), null(&pin.CreatedAt), null(&pin.UpdatedAt))
+}
+
+// SaveSyncPin creates or replaces the pin of the path
+func (s *SQLStore) SaveSyncPin(ctx context.Context, pin *models.SyncPin) error {
+	timestamps(&pin.CreatedAt, &pin.UpdatedAt)
+
+	return s.db.QueryRowContext(ctx, `INSERT INTO sync_pins (sync_config_id, client_id, path, pinned, created_at, updated_at) VALUES (?, ?, ?, ?, ?, ?)
+		ON CONFLICT (sync_config_id, client_id, path) DO UPDATE SET pinned = excluded.pinned, updated_at = excluded.updated_at RETURNING id`,
+		pin.SyncConfigID, pin.ClientID, pin.Path, pin.Pinned, pin.CreatedAt, pin.UpdatedAt).Scan(&pin.ID)
+}
+
+func (s *SQLStore) ListSyncPins(ctx context.Context, syncConfigID uint, clientID string) ([]models.SyncPin, error) {
+	return queryAll(ctx, s.db, scanSyncPin, "SELECT id, sync_config_id, client_id, path, pinned, created_at, updated_at FROM sync_pins WHERE sync_config_id = ? AND client_id = ? ORDER BY path",
+		syncConfigID, clientID)
+}
+
+func (s *SQLStore) DeleteSyncPin(ctx context.Context, syncConfigID uint, clientID, path string) error {
+	_, err := s.db.ExecContext(ctx, "DELETE FROM sync_pins WHERE sync_config_id = ? AND client_id = ? AND path = ?", syncConfigID, clientID, path)
+	return err
+}
+
+// MoveSyncPrefix hands the baselines, pending deletions, selections, pins and states below a directory of one sync over
+// to another sync. Records the target sync already has below its directory are replaced.
+func (s *SQLStore) MoveSyncPrefix(ctx context.Context, move SyncPrefixMove) (int64, error) {
+	if err := move.validate(); err != nil {
+		return 0, err
+	}
+
+	var moved int64
+	err := s.transaction(ctx, func(tx *sql.Tx) error {
+		fromQuery, fromArgs := pathsBelow(move.FromPrefix)
+		toQuery, toArgs := pathsBelow(move.ToPrefix)
+		rebased, rebaseArgs := move.rebase()
+		now := time.Now().UTC()
+
+		for _, table := range []string{"sync_baselines", "pending_deletions", "sync_selections", "sync_pins"} {
+			_, err := tx.ExecContext(ctx, "DELETE FROM "+table+" WHERE sync_config_id = ? AND "+toQuery, append([]any{move.ToSyncID}, toArgs...)...)
+			if err != nil {
+				return err
+			}
+
+			args := append([]any{move.ToSyncID}, rebaseArgs...)
+			args = append(append(args, now, move.FromSyncID), fromArgs...)
+			result, err := tx.ExecContext(ctx, "UPDATE "+table+" SET sync_config_id = ?, path = "+rebased+", updated_at = ? WHERE sync_config_id = ? AND "+fromQuery, args...)
+			if err != nil {
+				return err
+			}
+			if table == "sync_baselines" {
+				moved, _ = result.RowsAffected()
+			}
+		}
+
+		// Clients without state of the target sync continue with the state of the moved paths, e.g. their bootstrap mode
+		_, err := tx.ExecContext(ctx, `INSERT INTO sync_states (sync_config_id, backend_id, client_id, last_sync_at, bootstrap, created_at, updated_at)
+			SELECT ?, backend_id, client_id, last_sync_at, bootstrap, ?, ? FROM sync_states AS s WHERE s.sync_config_id = ?
+			AND NOT EXISTS (SELECT 1 FROM sync_states AS t WHERE t.sync_config_id = ? AND t.client_id = s.client_id)`,
+			move.ToSyncID, now, now, move.FromSyncID, move.ToSyncID)
+		if err != nil {
+			return err
+		}
+
+		if move.Merge {
+			_, err := tx.ExecContext(ctx, "UPDATE sync_configs SET deleted_at = ? WHERE id = ? AND deleted_at IS NULL", now, move.FromSyncID)
+			return err
+		}
+		_, err = tx.ExecContext(ctx, `INSERT INTO sync_selections (sync_config_id, path, mode, created_at, updated_at) VALUES (?, ?, ?, ?, ?)
+			ON CONFLICT (sync_config_id, path) DO UPDATE SET mode = excluded.mode, updated_at = excluded.updated_at`,
+			move.FromSyncID, move.FromPrefix, models.SelectionExclude, now, now)
+		return err
+	})
+	return moved, err
+}
+
+// Pending deletion operations
+
+func scanPendingDeletion(row scanner, p *models.PendingDeletion) error {
+	return row.Scan(&p.ID, null(&p.SyncConfigID), null(&p.ClientID), null(&p.Path), null(&p.Side), null(&p.DetectedAt), null(&p.DueAt),
+		null(&p.CreatedAt), null(&p.UpdatedAt))
+}
+
+// SavePendingDeletion creates or replaces the pending deletion of the path
+func (s *SQLStore) SavePendingDeletion(ctx context.Context, pending *models.PendingDeletion) error {
+	timestamps(&pending.CreatedAt, &pending.UpdatedAt)
+
+	return s.db.QueryRowContext(ctx, `INSERT INTO pending_deletions (sync_config_id, client_id, path, side, detected_at, due_at, created_at, updated_at)
+		VALUES (`+placeholders(8)+`) ON CONFLICT (sync_config_id, client_id, path) DO UPDATE SET side = excluded.side,
+		detected_at = excluded.detected_at, due_at = excluded.due_at, updated_at = excluded.updated_at RETURNING id`,
+		pending.SyncConfigID, pending.ClientID, pending.Path, pending.Side, pending.DetectedAt, pending.DueAt,
+		pending.CreatedAt, pending.UpdatedAt).Scan(&pending.ID)
+}
+
+// ListPendingDeletions returns the pending deletions of all syncs of the client ordered by due time
+func (s *SQLStore) ListPendingDeletions(ctx context.Context, clientID string) ([]models.PendingDeletion, error) {
+	return queryAll(ctx, s.db, scanPendingDeletion, `SELECT id, sync_config_id, client_id, path, side, detected_at, due_at, created_at, updated_at
+		FROM pending_deletions WHERE client_id = ? ORDER BY due_at, path`, clientID)
+}
+
+func (s *SQLStore) DeletePendingDeletion(ctx context.Context, syncConfigID uint, clientID, path string) error {
+	_, err := s.db.ExecContext(ctx, "DELETE FROM pending_deletions WHERE sync_config_id = ? AND client_id = ? AND path = ?", syncConfigID, clientID, path)
+	return err
+}
+
+// Maintenance operations
+
+// PurgeDeleted hard-deletes all records soft-deleted before the time and returns their number.
+// Backends are kept as long as files still refer to them, the locks, trash, events, chunks and usage
+// of purged backends are deleted along with them.
+func (s *SQLStore) PurgeDeleted(ctx context.Context, before time.Time) (int64, error) {
+	var purged int64
+	err := s.transaction(ctx, func(tx *sql.Tx) error {
+		for _, query := range []string{
+			"DELETE FROM tags WHERE deleted_at < ?",
+			"DELETE FROM files WHERE deleted_at < ?",
+			"DELETE FROM filters WHERE deleted_at < ?",
+			"DELETE FROM sync_configs WHERE deleted_at < ?",
+			"DELETE FROM locks WHERE backend_id IN (SELECT id FROM backends WHERE " + purgedBackend + ")",
+			"DELETE FROM trash_items WHERE backend_id IN (SELECT id FROM backends WHERE " + purgedBackend + ")",
+			"DELETE FROM file_events WHERE backend_id IN (SELECT id FROM backends WHERE " + purgedBackend + ")",
+			"DELETE FROM chunks WHERE backend_id IN (SELECT id FROM backends WHERE " + purgedBackend + ")",
+			"DELETE FROM bandwidth_usages WHERE backend_id IN (SELECT id FROM backends WHERE " + purgedBackend + ")",
+			"DELETE FROM storage_usages WHERE backend_id IN (SELECT id FROM backends WHERE " + purgedBackend + ")",
+			"DELETE FROM backends WHERE " + purgedBackend,
+		} {
+			result, err := tx.ExecContext(ctx, query, before)
+			if err != nil {
+				return err
+			}
+			n, _ := result.RowsAffected()
+			purged += n
+		}
+		return nil
+	})
+	return purged, err
+}
+
+// PruneOrphans deletes tags and chunk references of files and states, activity and logs of syncs that no longer
+// exist and returns their number
+func (s *SQLStore) PruneOrphans(ctx context.Context) (int64, error) {
+	var pruned int64
+	err := s.transaction(ctx, func(tx *sql.Tx) error {
+		for _, query := range []string{
+			"DELETE FROM tags WHERE file_id NOT IN (SELECT id FROM files)",
+			"DELETE FROM file_chunks WHERE file_id NOT IN (SELECT id FROM files)",
+			"DELETE FROM sync_states WHERE sync_config_id NOT IN (SELECT id FROM sync_configs)",
+			"DELETE FROM sync_baselines WHERE sync_config_id NOT IN (SELECT id FROM sync_configs)",
+			"DELETE FROM pending_deletions WHERE sync_config_id NOT IN (SELECT id FROM sync_configs)",
+			"DELETE FROM sync_selections WHERE sync_config_id NOT IN (SELECT id FROM sync_configs)",
+			"DELETE FROM sync_pins WHERE sync_config_id NOT IN (SELECT id FROM sync_configs)",
+			"DELETE FROM sync_activities WHERE sync_config_id NOT IN (SELECT id FROM sync_configs)",
+			"DELETE FROM integrity_errors WHERE sync_config_id NOT IN (SELECT id FROM sync_configs)",
+			"DELETE FROM transfer_logs WHERE sync_config_id NOT IN (SELECT id FROM sync_configs)",
+		} {
+			result, err := tx.ExecContext(ctx, query)
+			if err != nil {
+				return err
+			}
+			n, _ := result.RowsAffected()
+			pruned += n
+		}
+		return nil
+	})
+	return pruned, err
+}
+
+// Vacuum rebuilds the database to reclaim the space of deleted records and updates the statistics of the query planner
+func (s *SQLStore) Vacuum(ctx context.Context) error {
+	if _, err := s.db.ExecContext(ctx, "VACUUM"); err != nil {
+		return err
+	}
+	_, err := s.db.ExecContext(ctx, "ANALYZE")
+	return err
+}
@@ -0,0 +1,264 @@
+//go:build nogorm
+
+package store
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// sqlColumn is a column added to an existing table by a migration
+type sqlColumn struct {
+	table      string
+	definition string // Column definition as within the schema, e.g. "`sparse` text"
+}
+
+// sqlMigration repeats a migration of the GORM store in plain SQL. Tables are created with all columns of the
+// schema, while columns are only added if they are missing, since the GORM store creates tables with all columns
+// known to the release that created them.
+type sqlMigration struct {
+	version     int
+	description string
+	tables      []string
+	columns     []sqlColumn
+	statements  []string
+	// convert changes existing rows after the statements ran (optional)
+	convert func(ctx context.Context, tx *sql.Tx) error
+}
+
+// sqlMigrations upgrade databases of older releases from the initial schema up to schemaVersion
+var sqlMigrations = []sqlMigration{
+	{version: 2, description: "Add backend wipe state", columns: []sqlColumn{
+		{"backends", "`wipe_started_at` datetime"},
+	}},
+	{version: 3, description: "Add backend trash", tables: []string{"trash_items"}, columns: []sqlColumn{
+		{"backends", "`trash_enabled` numeric DEFAULT false"},
+		{"backends", "`trash_prefix` text DEFAULT '.gosync-trash/'"},
+		{"backends", "`trash_retention` integer DEFAULT 2592000"},
+	}},
+	{version: 4, description: "Add file version history", tables: []string{"file_events"}, columns: []sqlColumn{
+		{"files", "`version_id` text"},
+	}},
+	{version: 5, description: "Add backend type discriminator", columns: []sqlColumn{
+		{"backends", "`type` text NOT NULL DEFAULT 's3'"},
+	}},
+	{version: 6, description: "Add bandwidth usage rollups", tables: []string{"bandwidth_usages"}},
+	{version: 7, description: "Add backend dns options", columns: []sqlColumn{
+		{"backends", "`dns_server` text"},
+		{"backends", "`ip_preference` text"},
+		{"backends", "`happy_eyeballs` numeric DEFAULT false"},
+		{"backends", "`static_hosts` text"},
+	}},
+	{version: 8, description: "Add sync schedules and baselines", tables: []string{"sync_baselines"}, columns: []sqlColumn{
+		{"sync_configs", "`schedule` text"},
+		{"sync_configs", "`jitter` integer DEFAULT 0"},
+		{"sync_configs", "`blackout` text"},
+	}},
+	{version: 9, description: "Add block signatures for delta sync", tables: []string{"file_blocks"}, columns: []sqlColumn{
+		{"sync_configs", "`delta_threshold` integer DEFAULT 67108864"},
+	}},
+	{version: 10, description: "Add learned backend tuning", tables: []string{"backend_tunings"}},
+	{version: 11, description: "Add chunk deduplication", tables: []string{"chunks", "file_chunks"}, columns: []sqlColumn{
+		{"files", "`deduplicated` numeric DEFAULT false"},
+		{"sync_configs", "`dedup` numeric DEFAULT false"},
+	}},
+	{version: 12, description: "Add advisory file locks", tables: []string{"locks"}},
+	{version: 13, description: "Add client presence", tables: []string{"clients"}},
+	{version: 14, description: "Add per-device isolation of sync configs", columns: []sqlColumn{
+		{"sync_configs", "`isolated` numeric DEFAULT false"},
+	}},
+	{version: 15, description: "Add unique index on file paths", statements: []string{
+		// Keep only the latest of duplicate rows created by concurrent writers
+		"DELETE FROM `files` WHERE deleted_at IS NULL AND id NOT IN (SELECT MAX(id) FROM `files` WHERE deleted_at IS NULL GROUP BY backend_id, path)",
+		"CREATE UNIQUE INDEX IF NOT EXISTS `idx_file_path` ON `files`(`backend_id`,`path`) WHERE deleted_at IS NULL",
+	}},
+	{version: 16, description: "Add deferred deletions", tables: []string{"pending_deletions"}, columns: []sqlColumn{
+		{"sync_configs", "`delete_grace` integer DEFAULT 0"},
+	}},
+	{version: 17, description: "Add selective sync", tables: []string{"sync_selections"}},
+	{version: 18, description: "Add API tokens", tables: []string{"api_tokens"}},
+	{version: 19, description: "Add restore drills", tables: []string{"restore_drills"}},
+	{version: 20, description: "Add search index cursors", tables: []string{"index_cursors"}},
+	{version: 21, description: "Add sync weights", columns: []sqlColumn{
+		{"sync_configs", "`weight` integer DEFAULT 1"},
+	}},
+	{version: 22, description: "Add sync pass deadlines", columns: []sqlColumn{
+		{"sync_configs", "`max_duration` integer DEFAULT 0"},
+		{"sync_configs", "`stop_at` text"},
+		{"sync_configs", "`deadline_grace` integer DEFAULT 0"},
+	}},
+	{version: 23, description: "Add sync bootstrap mode", columns: []sqlColumn{
+		{"sync_states", "`bootstrap` numeric DEFAULT false"},
+	}},
+	{version: 24, description: "Add sync anomaly detection", columns: []sqlColumn{
+		{"sync_states", "`anomaly` text"},
+		{"sync_states", "`anomaly_confirmed` numeric DEFAULT false"},
+	}},
+	{version: 25, description: "Add sync transfer queue order", columns: []sqlColumn{
+		{"sync_configs", "`queue_order` text"},
+	}},
+	{version: 26, description: "Add transfer verification", tables: []string{"integrity_errors"}, columns: []sqlColumn{
+		{"sync_configs", "`verify` text"},
+	}},
+	{version: 27, description: "Add integrity modes", columns: []sqlColumn{
+		{"sync_configs", "`integrity` text"},
+		{"sync_baselines", "`source_modified_at` datetime"},
+		{"sync_baselines", "`dest_modified_at` datetime"},
+	}},
+	{version: 28, description: "Add incremental backend scans", columns: []sqlColumn{
+		{"sync_states", "`scan_cursor` text"},
+		{"sync_states", "`scanned_at` datetime"},
+	}},
+	{version: 29, description: "Add sync activity rollups", tables: []string{"sync_activities"}},
+	{version: 30, description: "Add local hash cache", tables: []string{"local_hashes"}},
+	{version: 31, description: "Add symlink policies", columns: []sqlColumn{
+		{"sync_configs", "`symlinks` text"},
+	}},
+	{version: 32, description: "Add POSIX metadata preservation", columns: []sqlColumn{
+		{"sync_configs", "`preserve` text"},
+		{"files", "`mode` integer DEFAULT 0"},
+		{"files", "`owner` text"},
+		{"files", "`xattrs` text"},
+	}},
+	{version: 33, description: "Add manifest publishing", columns: []sqlColumn{
+		{"sync_configs", "`publish` numeric DEFAULT false"},
+	}},
+	{version: 34, description: "Add sparse file maps", columns: []sqlColumn{
+		{"files", "`sparse` text"},
+	}},
+	{version: 35, description: "Add adaptive polling intervals", columns: []sqlColumn{
+		{"sync_states", "`poll_interval` integer DEFAULT 0"},
+		{"sync_states", "`change_rate` real DEFAULT 0"},
+	}},
+	{version: 36, description: "Add local change journal cursors", columns: []sqlColumn{
+		{"sync_states", "`journal_cursor` text"},
+	}},
+	{version: 37, description: "Add Unicode path normalization", columns: []sqlColumn{
+		{"sync_configs", "`normalization` text"},
+	}},
+	{version: 38, description: "Add reserved name policies", columns: []sqlColumn{
+		{"sync_configs", "`reserved_names` text"},
+	}},
+	{version: 39, description: "Add storage usage and backend quotas", tables: []string{"storage_usages"}, columns: []sqlColumn{
+		{"backends", "`quota_soft` integer DEFAULT 0"},
+		{"backends", "`quota_hard` integer DEFAULT 0"},
+	}, convert: sumSQLStorageUsage},
+	{version: 40, description: "Add transfer log", tables: []string{"transfer_logs"}},
+	{version: 41, description: "Add device registry", columns: []sqlColumn{
+		{"clients", "`name` text"},
+		{"clients", "`machine_id` text"},
+		{"clients", "`revoked_at` datetime"},
+		{"clients", "`revoked_reason` text"},
+	}},
+	{version: 42, description: "Add files on demand", tables: []string{"sync_pins"}, columns: []sqlColumn{
+		{"sync_configs", "`on_demand` numeric DEFAULT false"},
+		{"sync_baselines", "`placeholder` numeric DEFAULT false"},
+	}},
+	{version: 43, description: "Add compression", columns: []sqlColumn{
+		{"sync_configs", "`compression` text"},
+		{"sync_configs", "`compression_rules` text"},
+		{"files", "`compression` text"},
+	}},
+	{version: 44, description: "Add include and exclude rules", columns: []sqlColumn{
+		{"sync_configs", "`min_size` integer DEFAULT 0"},
+		{"sync_configs", "`max_size` integer DEFAULT 0"},
+		{"sync_configs", "`modified_after` text"},
+		{"sync_configs", "`modified_before` text"},
+		{"sync_configs", "`include_mime` text"},
+		{"sync_configs", "`exclude_mime` text"},
+	}},
+	{version: 45, description: "Backfill file events", statements: []string{
+		// Files uploaded before the version history was added would otherwise not exist at any point in time
+		`INSERT INTO file_events (backend_id, path, type, size, md5_hash, sha256_hash, e_tag, version_id, modified_at, occurred_at)
+		SELECT backend_id, path, 'created', size, md5_hash, sha256_hash, e_tag, version_id, modified_at, COALESCE(created_at, modified_at)
+		FROM files WHERE deleted_at IS NULL AND NOT EXISTS (
+			SELECT 1 FROM file_events WHERE file_events.backend_id = files.backend_id AND file_events.path = files.path
+		)`,
+	}},
+	{version: 46, description: "Add persistent maintenance mode", tables: []string{"maintenances"}},
+}
+
+// upgrade runs the migrations after the version of the database, each within its own transaction
+func (s *SQLStore) upgrade(ctx context.Context, version int) error {
+	for _, migration := range sqlMigrations {
+		if migration.version <= version {
+			continue
+		}
+
+		err := s.transaction(ctx, func(tx *sql.Tx) error {
+			for _, table := range migration.tables {
+				for _, statement := range tableSchema(table) {
+					if _, err := tx.ExecContext(ctx, statement); err != nil {
+						return err
+					}
+				}
+			}
+			for _, column := range migration.columns {
+				if err := addColumn(ctx, tx, column); err != nil {
+					return err
+				}
+			}
+			for _, statement := range migration.statements {
+				if _, err := tx.ExecContext(ctx, statement); err != nil {
+					return err
+				}
+			}
+			if migration.convert != nil {
+				if err := migration.convert(ctx, tx); err != nil {
+					return err
+				}
+			}
+
+			_, err := tx.ExecContext(ctx, "INSERT INTO migration_histories (version, description, applied_at) VALUES (?, ?, ?)",
+				migration.version, migration.description, time.Now().Unix())
+			return err
+		})
+		if err != nil {
+			return fmt.Errorf("migration %d (%s) failed: %w", migration.version, migration.description, err)
+		}
+	}
+	return nil
+}
+
+// tableSchema returns the statements of the schema creating the table and its indexes
+func tableSchema(table string) []string {
+	var statements []string
+	for _, statement := range schema {
+		if strings.Contains(statement, "TABLE IF NOT EXISTS `"+table+"` ") || strings.Contains(statement, " ON `"+table+"`(") {
+			statements = append(statements, statement)
+		}
+	}
+	return statements
+}
+
+// addColumn adds the column to its table unless the table already has it
+func addColumn(ctx context.Context, tx *sql.Tx, column sqlColumn) error {
+	name, _, _ := strings.Cut(strings.TrimPrefix(column.definition, "`"), "`")
+
+	var exists int
+	if err := tx.QueryRowContext(ctx, "SELECT COUNT(*) FROM pragma_table_info(?) WHERE name = ?", column.table, name).Scan(&exists); err != nil {
+		return err
+	}
+	if exists > 0 {
+		return nil
+	}
+	_, err := tx.ExecContext(ctx, "ALTER TABLE `"+column.table+"` ADD COLUMN "+column.definition)
+	return err
+}
+
+// sumSQLStorageUsage sums up the existing files of each backend for all directories containing them,
+// by splitting off one directory of their paths after the other
+func sumSQLStorageUsage(ctx context.Context, tx *sql.Tx) error {
+	_, err := tx.ExecContext(ctx, `INSERT INTO storage_usages (backend_id, prefix, parent, objects, bytes, updated_at)
+	WITH RECURSIVE dirs (backend_id, prefix, parent, bytes, rest) AS (
+		SELECT backend_id, '', '', CASE WHEN deduplicated THEN 0 ELSE size END, path FROM files WHERE deleted_at IS NULL
+		UNION ALL
+		SELECT backend_id, CASE WHEN prefix = '' THEN '' ELSE prefix || '/' END || substr(rest, 1, instr(rest, '/') - 1), prefix, bytes,
+			substr(rest, instr(rest, '/') + 1) FROM dirs WHERE instr(rest, '/') > 0
+	)
+	SELECT backend_id, prefix, parent, COUNT(*), SUM(bytes), ? FROM dirs GROUP BY backend_id, prefix`, time.Now().UTC())
+	return err
+}
@@ -0,0 +1,156 @@
+//go:build nogorm
+
+package store
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"time"
+)
+
+// schemaVersion is the migration version the schema below corresponds to, which has to be kept
+// in line with the migrations of the GORM store and sqlMigrations, so databases can be shared between both builds
+const schemaVersion = 46
+
+// schema creates all tables and indexes as created by the migrations of the GORM store
+var schema = []string{
+	"CREATE TABLE IF NOT EXISTS `backends` (`id` text,`name` text NOT NULL,`type` text NOT NULL DEFAULT 's3',`endpoint` text NOT NULL,`region` text,`bucket` text NOT NULL,`use_ssl` numeric DEFAULT true,`access_key` text NOT NULL,`secret_key` text NOT NULL,`dns_server` text,`ip_preference` text,`happy_eyeballs` numeric DEFAULT false,`static_hosts` text,`trash_enabled` numeric DEFAULT false,`trash_prefix` text DEFAULT '.gosync-trash/',`trash_retention` integer,`quota_soft` integer DEFAULT 0,`quota_hard` integer DEFAULT 0,`wipe_started_at` datetime,`created_at` datetime,`updated_at` datetime,`deleted_at` datetime,PRIMARY KEY (`id`))",
+	"CREATE INDEX IF NOT EXISTS `idx_backends_deleted_at` ON `backends`(`deleted_at`)",
+
+	"CREATE TABLE IF NOT EXISTS `files` (`id` integer PRIMARY KEY AUTOINCREMENT,`backend_id` text NOT NULL,`path` text NOT NULL,`size` integer NOT NULL,`md5_hash` text,`sha256_hash` text,`e_tag` text,`version_id` text,`deduplicated` numeric DEFAULT false,`compression` text,`mode` integer DEFAULT 0,`owner` text,`xattrs` text,`sparse` text,`modified_at` datetime,`created_at` datetime,`updated_at` datetime,`deleted_at` datetime,CONSTRAINT `fk_backends_files` FOREIGN KEY (`backend_id`) REFERENCES `backends`(`id`) ON DELETE CASCADE)",
+	"CREATE INDEX IF NOT EXISTS `idx_backend_path` ON `files`(`backend_id`,`path`)",
+	"CREATE UNIQUE INDEX IF NOT EXISTS `idx_file_path` ON `files`(`backend_id`,`path`) WHERE deleted_at IS NULL",
+	"CREATE INDEX IF NOT EXISTS `idx_files_deleted_at` ON `files`(`deleted_at`)",
+
+	"CREATE TABLE IF NOT EXISTS `tags` (`id` integer PRIMARY KEY AUTOINCREMENT,`file_id` integer NOT NULL,`key` text NOT NULL,`value` text NOT NULL,`created_at` datetime,`updated_at` datetime,`deleted_at` datetime,CONSTRAINT `fk_files_tags` FOREIGN KEY (`file_id`) REFERENCES `files`(`id`) ON DELETE CASCADE)",
+	"CREATE INDEX IF NOT EXISTS `idx_file_tags` ON `tags`(`file_id`)",
+	"CREATE INDEX IF NOT EXISTS `idx_tag_key` ON `tags`(`key`)",
+	"CREATE INDEX IF NOT EXISTS `idx_tag_value` ON `tags`(`value`)",
+	"CREATE INDEX IF NOT EXISTS `idx_tags_deleted_at` ON `tags`(`deleted_at`)",
+
+	"CREATE TABLE IF NOT EXISTS `filters` (`id` integer PRIMARY KEY AUTOINCREMENT,`virtual_path` text NOT NULL,`name` text NOT NULL,`query_expression` text NOT NULL,`description` text,`created_at` datetime,`updated_at` datetime,`deleted_at` datetime)",
+	"CREATE UNIQUE INDEX IF NOT EXISTS `idx_filters_virtual_path` ON `filters`(`virtual_path`)",
+	"CREATE INDEX IF NOT EXISTS `idx_filters_deleted_at` ON `filters`(`deleted_at`)",
+
+	"CREATE TABLE IF NOT EXISTS `sync_configs` (`id` integer PRIMARY KEY AUTOINCREMENT,`name` text NOT NULL,`source_path` text NOT NULL,`dest_path` text NOT NULL,`direction` text NOT NULL,`isolated` numeric DEFAULT false,`enabled` numeric DEFAULT true,`interval` integer NOT NULL,`schedule` text,`jitter` integer DEFAULT 0,`blackout` text,`max_duration` integer DEFAULT 0,`stop_at` text,`deadline_grace` integer DEFAULT 0,`workers` integer DEFAULT 4,`weight` integer DEFAULT 1,`queue_order` text,`chunk_size` integer DEFAULT 5242880,`ignore_pattern` text,`min_size` integer DEFAULT 0,`max_size` integer DEFAULT 0,`modified_after` text,`modified_before` text,`include_mime` text,`exclude_mime` text,`delete_grace` integer DEFAULT 0,`delta_threshold` integer DEFAULT 67108864,`dedup` numeric DEFAULT false,`compression` text,`compression_rules` text,`verify` text,`integrity` text,`symlinks` text,`normalization` text,`reserved_names` text,`preserve` text,`publish` numeric DEFAULT false,`on_demand` numeric DEFAULT false,`created_at` datetime,`updated_at` datetime,`deleted_at` datetime)",
+	"CREATE UNIQUE INDEX IF NOT EXISTS `idx_sync_configs_name` ON `sync_configs`(`name`)",
+	"CREATE INDEX IF NOT EXISTS `idx_sync_configs_deleted_at` ON `sync_configs`(`deleted_at`)",
+
+	"CREATE TABLE IF NOT EXISTS `sync_states` (`id` integer PRIMARY KEY AUTOINCREMENT,`sync_config_id` integer NOT NULL,`backend_id` text NOT NULL,`client_id` text NOT NULL,`last_sync_at` datetime,`last_cursor` text,`files_scanned` integer DEFAULT 0,`files_synced` integer DEFAULT 0,`bytes_synced` integer DEFAULT 0,`error_count` integer DEFAULT 0,`last_error` text,`bootstrap` numeric DEFAULT false,`anomaly` text,`anomaly_confirmed` numeric DEFAULT false,`scan_cursor` text,`scanned_at` datetime,`poll_interval` integer DEFAULT 0,`change_rate` real DEFAULT 0,`journal_cursor` text,`created_at` datetime,`updated_at` datetime,CONSTRAINT `fk_sync_configs_states` FOREIGN KEY (`sync_config_id`) REFERENCES `sync_configs`(`id`) ON DELETE CASCADE)",
+	"CREATE INDEX IF NOT EXISTS `idx_sync_backend` ON `sync_states`(`sync_config_id`,`backend_id`)",
+
+	"CREATE TABLE IF NOT EXISTS `sync_baselines` (`id` integer PRIMARY KEY AUTOINCREMENT,`sync_config_id` integer NOT NULL,`client_id` text NOT NULL,`path` text NOT NULL,`size` integer NOT NULL,`source_e_tag` text,`dest_e_tag` text,`source_modified_at` datetime,`dest_modified_at` datetime,`synced_at` datetime,`placeholder` numeric DEFAULT false,`created_at` datetime,`updated_at` datetime)",
+	"CREATE UNIQUE INDEX IF NOT EXISTS `idx_baseline_path` ON `sync_baselines`(`sync_config_id`,`client_id`,`path`)",
+
+	"CREATE TABLE IF NOT EXISTS `pending_deletions` (`id` integer PRIMARY KEY AUTOINCREMENT,`sync_config_id` integer NOT NULL,`client_id` text NOT NULL,`path` text NOT NULL,`side` text NOT NULL,`detected_at` datetime,`due_at` datetime,`created_at` datetime,`updated_at` datetime)",
+	"CREATE UNIQUE INDEX IF NOT EXISTS `idx_pending_path` ON `pending_deletions`(`sync_config_id`,`client_id`,`path`)",
+	"CREATE INDEX IF NOT EXISTS `idx_pending_deletions_due_at` ON `pending_deletions`(`due_at`)",
+
+	"CREATE TABLE IF NOT EXISTS `sync_selections` (`id` integer PRIMARY KEY AUTOINCREMENT,`sync_config_id` integer NOT NULL,`path` text NOT NULL,`mode` text NOT NULL,`created_at` datetime,`updated_at` datetime,CONSTRAINT `fk_sync_configs_selections` FOREIGN KEY (`sync_config_id`) REFERENCES `sync_configs`(`id`) ON DELETE CASCADE)",
+	"CREATE UNIQUE INDEX IF NOT EXISTS `idx_selection_path` ON `sync_selections`(`sync_config_id`,`path`)",
+
+	"CREATE TABLE IF NOT EXISTS `sync_pins` (`id` integer PRIMARY KEY AUTOINCREMENT,`sync_config_id` integer NOT NULL,`client_id` text NOT NULL,`path` text NOT NULL,`pinned` numeric NOT NULL,`created_at` datetime,`updated_at` datetime)",
+	"CREATE UNIQUE INDEX IF NOT EXISTS `idx_pin_path` ON `sync_pins`(`sync_config_id`,`client_id`,`path`)",
+
+	"CREATE TABLE IF NOT EXISTS `trash_items` (`id` integer PRIMARY KEY AUTOINCREMENT,`backend_id` text NOT NULL,`path` text NOT NULL,`trash_key` text NOT NULL,`size` integer NOT NULL,`e_tag` text,`trashed_at` datetime NOT NULL,`expires_at` datetime,`created_at` datetime,CONSTRAINT `fk_trash_items_backend` FOREIGN KEY (`backend_id`) REFERENCES `backends`(`id`))",
+	"CREATE INDEX IF NOT EXISTS `idx_trash_backend_path` ON `trash_items`(`backend_id`,`path`)",
+	"CREATE INDEX IF NOT EXISTS `idx_trash_items_expires_at` ON `trash_items`(`expires_at`)",
+
+	"CREATE TABLE IF NOT EXISTS `file_events` (`id` integer PRIMARY KEY AUTOINCREMENT,`backend_id` text NOT NULL,`path` text NOT NULL,`type` text NOT NULL,`size` integer NOT NULL,`md5_hash` text,`sha256_hash` text,`e_tag` text,`version_id` text,`modified_at` datetime,`occurred_at` datetime NOT NULL)",
+	"CREATE INDEX IF NOT EXISTS `idx_event_backend_path` ON `file_events`(`backend_id`,`path`)",
+	"CREATE INDEX IF NOT EXISTS `idx_file_events_occurred_at` ON `file_events`(`occurred_at`)",
+
+	"CREATE TABLE IF NOT EXISTS `bandwidth_usages` (`id` integer PRIMARY KEY AUTOINCREMENT,`backend_id` text NOT NULL,`month` text NOT NULL,`bytes_uploaded` integer DEFAULT 0,`bytes_downloaded` integer DEFAULT 0,`api_calls` integer DEFAULT 0,`created_at` datetime,`updated_at` datetime)",
+	"CREATE UNIQUE INDEX IF NOT EXISTS `idx_usage_backend_month` ON `bandwidth_usages`(`backend_id`,`month`)",
+
+	"CREATE TABLE IF NOT EXISTS `file_blocks` (`id` integer PRIMARY KEY AUTOINCREMENT,`backend_id` text NOT NULL,`path` text NOT NULL,`number` integer NOT NULL,`offset` integer NOT NULL,`size` integer NOT NULL,`hash` text NOT NULL,`e_tag` text,`created_at` datetime)",
+	"CREATE UNIQUE INDEX IF NOT EXISTS `idx_block_path` ON `file_blocks`(`backend_id`,`path`,`number`)",
+
+	"CREATE TABLE IF NOT EXISTS `backend_tunings` (`backend_id` text,`chunk_size` integer NOT NULL,`throughput` real DEFAULT 0,`latency` real DEFAULT 0,`samples` integer DEFAULT 0,`updated_at` datetime,PRIMARY KEY (`backend_id`))",
+
+	"CREATE TABLE IF NOT EXISTS `chunks` (`id` integer PRIMARY KEY AUTOINCREMENT,`backend_id` text NOT NULL,`hash` text NOT NULL,`size` integer NOT NULL,`created_at` datetime)",
+	"CREATE UNIQUE INDEX IF NOT EXISTS `idx_chunk_hash` ON `chunks`(`backend_id`,`hash`)",
+
+	"CREATE TABLE IF NOT EXISTS `file_chunks` (`id` integer PRIMARY KEY AUTOINCREMENT,`file_id` integer NOT NULL,`position` integer NOT NULL,`chunk_id` integer NOT NULL,CONSTRAINT `fk_files_chunks` FOREIGN KEY (`file_id`) REFERENCES `files`(`id`) ON DELETE CASCADE,CONSTRAINT `fk_file_chunks_chunk` FOREIGN KEY (`chunk_id`) REFERENCES `chunks`(`id`))",
+	"CREATE INDEX IF NOT EXISTS `idx_file_chunks_file_id` ON `file_chunks`(`file_id`)",
+	"CREATE INDEX IF NOT EXISTS `idx_file_chunks_chunk_id` ON `file_chunks`(`chunk_id`)",
+
+	"CREATE TABLE IF NOT EXISTS `locks` (`id` integer PRIMARY KEY AUTOINCREMENT,`backend_id` text NOT NULL,`path` text NOT NULL,`owner` text NOT NULL,`client_id` text NOT NULL,`acquired_at` datetime,`expires_at` datetime,`created_at` datetime,`updated_at` datetime)",
+	"CREATE UNIQUE INDEX IF NOT EXISTS `idx_lock_path` ON `locks`(`backend_id`,`path`)",
+	"CREATE INDEX IF NOT EXISTS `idx_locks_expires_at` ON `locks`(`expires_at`)",
+
+	"CREATE TABLE IF NOT EXISTS `clients` (`id` text,`name` text,`machine_id` text,`version` text,`platform` text,`address` text,`active_syncs` text,`started_at` datetime,`last_seen_at` datetime,`stopped_at` datetime,`revoked_at` datetime,`revoked_reason` text,`created_at` datetime,`updated_at` datetime,PRIMARY KEY (`id`))",
+	"CREATE INDEX IF NOT EXISTS `idx_clients_last_seen_at` ON `clients`(`last_seen_at`)",
+	"CREATE TABLE IF NOT EXISTS `maintenances` (`client_id` text,`reason` text,`since` datetime NOT NULL,PRIMARY KEY (`client_id`))",
+
+	"CREATE TABLE IF NOT EXISTS `api_tokens` (`id` integer PRIMARY KEY AUTOINCREMENT,`name` text NOT NULL,`hash` text NOT NULL,`prefix` text NOT NULL,`scope` text NOT NULL,`expires_at` datetime,`last_used_at` datetime,`revoked_at` datetime,`created_at` datetime,`updated_at` datetime)",
+	"CREATE UNIQUE INDEX IF NOT EXISTS `idx_api_tokens_name` ON `api_tokens`(`name`)",
+	"CREATE UNIQUE INDEX IF NOT EXISTS `idx_api_tokens_hash` ON `api_tokens`(`hash`)",
+
+	"CREATE TABLE IF NOT EXISTS `restore_drills` (`id` integer PRIMARY KEY AUTOINCREMENT,`backend_id` text NOT NULL,`started_at` datetime,`finished_at` datetime,`sampled` integer DEFAULT 0,`verified` integer DEFAULT 0,`failed` integer DEFAULT 0,`bytes` integer DEFAULT 0,`failures` text,`error` text,`created_at` datetime)",
+	"CREATE INDEX IF NOT EXISTS `idx_drill_backend` ON `restore_drills`(`backend_id`,`started_at`)",
+
+	"CREATE TABLE IF NOT EXISTS `integrity_errors` (`id` integer PRIMARY KEY AUTOINCREMENT,`sync_config_id` integer NOT NULL,`client_id` text NOT NULL,`path` text NOT NULL,`detected_at` datetime,`check` text NOT NULL,`expected` text,`actual` text,`created_at` datetime)",
+	"CREATE INDEX IF NOT EXISTS `idx_integrity_sync` ON `integrity_errors`(`sync_config_id`,`detected_at`)",
+
+	"CREATE TABLE IF NOT EXISTS `index_cursors` (`name` text,`event_id` integer NOT NULL DEFAULT 0,`updated_at` datetime,PRIMARY KEY (`name`))",
+
+	"CREATE TABLE IF NOT EXISTS `sync_activities` (`id` integer PRIMARY KEY AUTOINCREMENT,`sync_config_id` integer NOT NULL,`client_id` text NOT NULL,`day` text NOT NULL,`passes` integer DEFAULT 0,`added` integer DEFAULT 0,`changed` integer DEFAULT 0,`deleted` integer DEFAULT 0,`conflicts` integer DEFAULT 0,`errors` integer DEFAULT 0,`bytes` integer DEFAULT 0,`created_at` datetime,`updated_at` datetime)",
+	"CREATE UNIQUE INDEX IF NOT EXISTS `idx_activity_sync_client_day` ON `sync_activities`(`sync_config_id`,`client_id`,`day`)",
+	"CREATE INDEX IF NOT EXISTS `idx_sync_activities_day` ON `sync_activities`(`day`)",
+
+	"CREATE TABLE IF NOT EXISTS `storage_usages` (`id` integer PRIMARY KEY AUTOINCREMENT,`backend_id` text NOT NULL,`prefix` text NOT NULL,`parent` text NOT NULL,`objects` integer DEFAULT 0,`bytes` integer DEFAULT 0,`updated_at` datetime)",
+	"CREATE UNIQUE INDEX IF NOT EXISTS `idx_storage_usage_prefix` ON `storage_usages`(`backend_id`,`prefix`)",
+	"CREATE INDEX IF NOT EXISTS `idx_storage_usage_parent` ON `storage_usages`(`backend_id`,`parent`)",
+
+	"CREATE TABLE IF NOT EXISTS `transfer_logs` (`id` integer PRIMARY KEY AUTOINCREMENT,`sync_config_id` integer NOT NULL,`client_id` text NOT NULL,`operation` text NOT NULL,`source` text NOT NULL,`destination` text NOT NULL,`bytes` integer DEFAULT 0,`result` text NOT NULL,`error` text,`started_at` datetime,`finished_at` datetime NOT NULL)",
+	"CREATE INDEX IF NOT EXISTS `idx_transfer_sync` ON `transfer_logs`(`sync_config_id`)",
+	"CREATE INDEX IF NOT EXISTS `idx_transfer_logs_finished_at` ON `transfer_logs`(`finished_at`)",
+
+	"CREATE TABLE IF NOT EXISTS `local_hashes` (`path` text,`size` integer NOT NULL,`modified_at` datetime,`inode` integer DEFAULT 0,`md5_hash` text,`sha256_hash` text,`hashed_at` datetime,PRIMARY KEY (`path`))",
+}
+
+// migrate creates the schema of empty databases and records it as fully migrated. Databases created by
+// an older release are upgraded by the migrations following their version, see sqlMigrations.
+func (s *SQLStore) migrate(ctx context.Context) error {
+	_, err := s.db.ExecContext(ctx, "CREATE TABLE IF NOT EXISTS `migration_histories` (`id` integer PRIMARY KEY AUTOINCREMENT,`version` integer NOT NULL,`description` text,`applied_at` integer)")
+	if err != nil {
+		return fmt.Errorf("failed to create migration history table: %w", err)
+	}
+	if _, err := s.db.ExecContext(ctx, "CREATE UNIQUE INDEX IF NOT EXISTS `idx_migration_histories_version` ON `migration_histories`(`version`)"); err != nil {
+		return fmt.Errorf("failed to create migration history table: %w", err)
+	}
+
+	var version int
+	if err := s.db.QueryRowContext(ctx, "SELECT COALESCE(MAX(version), 0) FROM migration_histories").Scan(&version); err != nil {
+		return fmt.Errorf("failed to query migration history: %w", err)
+	}
+
+	switch {
+	case version == schemaVersion:
+		return nil
+	case version > schemaVersion:
+		return fmt.Errorf("database schema version %d is newer than the supported version %d", version, schemaVersion)
+	case version > 0:
+		return s.upgrade(ctx, version)
+	}
+
+	return s.transaction(ctx, func(tx *sql.Tx) error {
+		for _, statement := range schema {
+			if _, err := tx.ExecContext(ctx, statement); err != nil {
+				return fmt.Errorf("failed to create schema: %w", err)
+			}
+		}
+
+		// Every version is recorded, so the GORM build doesn't run any of its migrations on this database
+		now := time.Now().Unix()
+		for v := 1; v <= schemaVersion; v++ {
+			if _, err := tx.ExecContext(ctx, "INSERT INTO migration_histories (version, description, applied_at) VALUES (?, ?, ?)",
+				v, fmt.Sprintf("Included in schema version %d", schemaVersion), now); err != nil {
+				return fmt.Errorf("failed to record migration %d: %w", v, err)
+			}
+		}
+		return nil
+	})
+}
@@ -1,16 +1,54 @@
+//go:build !nogorm
+
 package store
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"time"
 
 	"github.com/glebarez/sqlite"
+	config "github.com/mwantia/gosync/internal/config/server"
+	"github.com/mwantia/gosync/pkg/db/migrations"
 	"github.com/mwantia/gosync/pkg/db/models"
 	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
 	"gorm.io/gorm/logger"
 )
 
+// ErrNotFound is returned if a requested record doesn't exist
+var ErrNotFound = gorm.ErrRecordNotFound
+
+// openSQLite opens the GORM based SQLite store and runs all pending migrations
+func openSQLite(ctx context.Context, cfg config.MetadataSQLiteConfig, debug bool) (MetadataStore, error) {
+	logLevel := logger.Silent
+	if debug {
+		logLevel = logger.Info
+	}
+
+	sqliteStore, err := NewSQLiteStore(SQLiteConfig{
+		Path:     cfg.Path,
+		Pragmas:  sqlitePragmas(cfg),
+		LogLevel: logLevel,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to create sqlite store: %w", err)
+	}
+
+	if err := sqliteStore.Connect(ctx); err != nil {
+		return nil, fmt.Errorf("failed to connect to database: %w", err)
+	}
+
+	migrator := migrations.NewMigrator(sqliteStore.DB())
+	if err := migrator.Migrate(ctx); err != nil {
+		sqliteStore.Close()
+		return nil, fmt.Errorf("failed to run migrations: %w", err)
+	}
+
+	return sqliteStore, nil
+}
+
 // SQLiteStore implements MetadataStore using SQLite
 type SQLiteStore struct {
 	db   *gorm.DB
@@ -26,6 +64,7 @@ func (s *SQLiteStore) DB() *gorm.DB {
 type SQLiteConfig struct {
 	Path         string
 	MaxOpenConns int
+	Pragmas      SQLitePragmas
 	LogLevel     logger.LogLevel
 }
 
@@ -40,7 +79,7 @@ func NewSQLiteStore(cfg SQLiteConfig) (*SQLiteStore, error) {
 		cfg.LogLevel = logger.Silent
 	}
 
-	db, err := gorm.Open(sqlite.Open(cfg.Path), &gorm.Config{
+	db, err := gorm.Open(sqlite.Open(sqliteDSN(cfg.Path, cfg.Pragmas)), &gorm.Config{
 		Logger: logger.Default.LogMode(cfg.LogLevel),
 		NowFunc: func() time.Time {
 			return time.Now().UTC()
@@ -89,9 +128,36 @@ func (s *SQLiteStore) Migrate(ctx context.Context) error {
 		&models.Filter{},
 		&models.SyncConfig{},
 		&models.SyncState{},
+		&models.SyncBaseline{},
+		&models.TrashItem{},
+		&models.FileEvent{},
+		&models.BandwidthUsage{},
+		&models.FileBlock{},
+		&models.BackendTuning{},
+		&models.Chunk{},
+		&models.FileChunk{},
+		&models.Lock{},
+		&models.Client{},
+		&models.PendingDeletion{},
+		&models.SyncSelection{},
+		&models.SyncPin{},
+		&models.APIToken{},
+		&models.RestoreDrill{},
+		&models.IndexCursor{},
+		&models.IntegrityError{},
+		&models.SyncActivity{},
+		&models.LocalHash{},
+		&models.StorageUsage{},
+		&models.TransferLog{},
+		&models.Maintenance{},
 	)
 }
 
+// Backup writes a consistent copy of the database to destPath while it stays in use
+func (s *SQLiteStore) Backup(ctx context.Context, destPath string) error {
+	return backupSQLite(ctx, s.path, destPath)
+}
+
 // Health checks database connectivity
 func (s *SQLiteStore) Health(ctx context.Context) error {
 	sqlDB, err := s.db.DB()
@@ -130,10 +196,96 @@ func (s *SQLiteStore) DeleteBackend(ctx context.Context, id string) error {
 	return s.db.WithContext(ctx).Delete(&models.Backend{}, "id = ?", id).Error
 }
 
+// BeginBackendWipe marks the backend as being wiped and soft-deletes all of its files.
+// It returns the total number of file records (including already soft-deleted ones).
+func (s *SQLiteStore) BeginBackendWipe(ctx context.Context, id string) (int64, error) {
+	var total int64
+	err := s.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(&models.Backend{}).
+			Where("id = ? AND wipe_started_at IS NULL", id).
+			Update("wipe_started_at", time.Now().UTC()).Error; err != nil {
+			return err
+		}
+
+		if err := recordFileEvents(tx, id, models.FileEventDeleted); err != nil {
+			return err
+		}
+
+		if err := tx.Where("backend_id = ?", id).Delete(&models.File{}).Error; err != nil {
+			return err
+		}
+		if err := tx.Where("backend_id = ?", id).Delete(&models.StorageUsage{}).Error; err != nil {
+			return err
+		}
+
+		return tx.Unscoped().Model(&models.File{}).Where("backend_id = ?", id).Count(&total).Error
+	})
+	return total, err
+}
+
+// CompleteBackendWipe permanently removes all file records of the backend and clears the wipe state
+func (s *SQLiteStore) CompleteBackendWipe(ctx context.Context, id string) error {
+	return s.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Unscoped().
+			Where("file_id IN (?)", tx.Unscoped().Model(&models.File{}).Select("id").Where("backend_id = ?", id)).
+			Delete(&models.Tag{}).Error; err != nil {
+			return err
+		}
+
+		if err := tx.Unscoped().Where("backend_id = ?", id).Delete(&models.File{}).Error; err != nil {
+			return err
+		}
+
+		if err := tx.Where("backend_id = ?", id).Delete(&models.TrashItem{}).Error; err != nil {
+			return err
+		}
+
+		if err := tx.Where("backend_id = ?", id).Delete(&models.FileEvent{}).Error; err != nil {
+			return err
+		}
+
+		if err := tx.Where("backend_id = ?", id).Delete(&models.FileBlock{}).Error; err != nil {
+			return err
+		}
+
+		if err := tx.Where("chunk_id IN (?)", tx.Model(&models.Chunk{}).Select("id").Where("backend_id = ?", id)).Delete(&models.FileChunk{}).Error; err != nil {
+			return err
+		}
+
+		if err := tx.Where("backend_id = ?", id).Delete(&models.Chunk{}).Error; err != nil {
+			return err
+		}
+
+		if err := tx.Where("backend_id = ?", id).Delete(&models.Lock{}).Error; err != nil {
+			return err
+		}
+
+		return tx.Model(&models.Backend{}).Where("id = ?", id).Update("wipe_started_at", nil).Error
+	})
+}
+
+func (s *SQLiteStore) ListBackendTunings(ctx context.Context) ([]models.BackendTuning, error) {
+	var tunings []models.BackendTuning
+	err := s.db.WithContext(ctx).Find(&tunings).Error
+	return tunings, err
+}
+
+func (s *SQLiteStore) SaveBackendTuning(ctx context.Context, tuning *models.BackendTuning) error {
+	return s.db.WithContext(ctx).Save(tuning).Error
+}
+
 // File operations
 
 func (s *SQLiteStore) CreateFile(ctx context.Context, file *models.File) error {
-	return s.db.WithContext(ctx).Create(file).Error
+	return s.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(file).Error; err != nil {
+			return err
+		}
+		if err := addStorageUsage(tx, file, 1); err != nil {
+			return err
+		}
+		return recordFileEvent(tx, file, models.FileEventCreated)
+	})
 }
 
 func (s *SQLiteStore) GetFile(ctx context.Context, backendID, path string) (*models.File, error) {
@@ -147,12 +299,43 @@ func (s *SQLiteStore) GetFile(ctx context.Context, backendID, path string) (*mod
 	return &file, nil
 }
 
-func (s *SQLiteStore) ListFiles(ctx context.Context, backendID, pathPrefix string, limit, offset int) ([]models.File, error) {
+func (s *SQLiteStore) ListFiles(ctx context.Context, backendID string, filter FileFilter, limit, offset int) ([]models.File, error) {
 	var files []models.File
-	query := s.db.WithContext(ctx).Where("backend_id = ?", backendID)
+	order, keyset, args := fileKeyset(filter)
+	query := s.db.WithContext(ctx).Order(order)
 
-	if pathPrefix != "" {
-		query = query.Where("path LIKE ?", pathPrefix+"%")
+	if backendID != "" {
+		query = query.Where("backend_id = ?", backendID)
+	}
+	if filter.PathPrefix != "" {
+		query = query.Where("path LIKE ? ESCAPE '\\'", like(filter.PathPrefix))
+	}
+	if filter.PathLike != "" {
+		query = query.Where("path LIKE ? ESCAPE '\\'", filter.PathLike)
+	}
+	if !filter.ModifiedAfter.IsZero() {
+		query = query.Where("modified_at > ?", filter.ModifiedAfter)
+	}
+	if !filter.ModifiedBefore.IsZero() {
+		query = query.Where("modified_at < ?", filter.ModifiedBefore)
+	}
+	if filter.MinSize > 0 {
+		query = query.Where("size >= ?", filter.MinSize)
+	}
+	if filter.MaxSize > 0 {
+		query = query.Where("size <= ?", filter.MaxSize)
+	}
+	if filter.Hash != "" {
+		query = query.Where("(md5_hash = ? OR sha256_hash = ?)", filter.Hash, filter.Hash)
+	}
+	for key, value := range filter.Tags {
+		query = query.Where("EXISTS (SELECT 1 FROM tags WHERE tags.file_id = files.id AND tags.key = ? AND tags.value = ? AND tags.deleted_at IS NULL)", key, value)
+	}
+	for _, key := range filter.HasTags {
+		query = query.Where("EXISTS (SELECT 1 FROM tags WHERE tags.file_id = files.id AND tags.key = ? AND tags.deleted_at IS NULL)", key)
+	}
+	if keyset != "" {
+		query = query.Where(keyset, args...)
 	}
 
 	if limit > 0 {
@@ -166,16 +349,383 @@ func (s *SQLiteStore) ListFiles(ctx context.Context, backendID, pathPrefix strin
 	return files, err
 }
 
+// IterateFiles calls fn for every file below the prefix ordered by path, stopping at the first error returned by fn.
+// Files are loaded in batches continuing after the last path, so memory usage is independent of the number of files.
+func (s *SQLiteStore) IterateFiles(ctx context.Context, backendID, pathPrefix string, fn func(file *models.File) error) error {
+	var lastPath string
+	var lastID uint
+
+	for {
+		query := s.db.WithContext(ctx).Where("backend_id = ?", backendID)
+		if pathPrefix != "" {
+			query = query.Where("path LIKE ? ESCAPE '\\'", like(pathPrefix))
+		}
+		if lastID != 0 {
+			query = query.Where("path > ? OR (path = ? AND id > ?)", lastPath, lastPath, lastID)
+		}
+
+		var files []models.File
+		if err := query.Order("path, id").Limit(iterateBatchSize).Find(&files).Error; err != nil {
+			return err
+		}
+
+		for i := range files {
+			if err := fn(&files[i]); err != nil {
+				return err
+			}
+		}
+
+		if len(files) < iterateBatchSize {
+			return nil
+		}
+		lastPath = files[len(files)-1].Path
+		lastID = files[len(files)-1].ID
+	}
+}
+
 func (s *SQLiteStore) UpdateFile(ctx context.Context, file *models.File) error {
-	return s.db.WithContext(ctx).Save(file).Error
+	return s.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		var previous models.File
+		err := tx.Where("id = ?", file.ID).First(&previous).Error
+		if err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
+			return err
+		}
+		if err == nil {
+			if err := addStorageUsage(tx, &previous, -1); err != nil {
+				return err
+			}
+		}
+
+		if err := tx.Save(file).Error; err != nil {
+			return err
+		}
+		if err := addStorageUsage(tx, file, 1); err != nil {
+			return err
+		}
+		return recordFileEvent(tx, file, models.FileEventModified)
+	})
+}
+
+// UpsertFile creates the file or updates the existing file with the same backend and path,
+// relying on the unique index instead of a separate lookup to avoid duplicate rows
+func (s *SQLiteStore) UpsertFile(ctx context.Context, file *models.File) error {
+	return s.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		// Only used to choose the event type and to replace the usage, the conflict clause handles concurrent inserts
+		var existing models.File
+		err := tx.Where("backend_id = ? AND path = ?", file.BackendID, file.Path).First(&existing).Error
+		if err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
+			return err
+		}
+		if err != nil {
+			return upsertFile(tx, file, nil)
+		}
+		return upsertFile(tx, file, &existing)
+	})
+}
+
+func (s *SQLiteStore) UpsertFiles(ctx context.Context, files []models.File) (int, error) {
+	changed := 0
+	err := s.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		changed = 0
+		for i := range files {
+			file := &files[i]
+
+			var existing models.File
+			err := tx.Where("backend_id = ? AND path = ?", file.BackendID, file.Path).First(&existing).Error
+			if err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
+				return err
+			}
+			if err == nil && existing.ETag == file.ETag {
+				file.ID = existing.ID
+				continue
+			}
+
+			previous := &existing
+			if err != nil {
+				previous = nil
+			}
+			if err := upsertFile(tx, file, previous); err != nil {
+				return err
+			}
+			changed++
+		}
+		return nil
+	})
+	return changed, err
+}
+
+// upsertFile creates the file or updates its previous record, if it already exists
+func upsertFile(tx *gorm.DB, file *models.File, previous *models.File) error {
+	err := tx.Clauses(clause.OnConflict{
+		Columns:     []clause.Column{{Name: "backend_id"}, {Name: "path"}},
+		TargetWhere: clause.Where{Exprs: []clause.Expression{clause.Expr{SQL: "deleted_at IS NULL"}}},
+		DoUpdates: clause.AssignmentColumns([]string{
+			"size", "md5_hash", "sha256_hash", "e_tag", "version_id", "deduplicated", "compression", "mode", "owner", "xattrs", "sparse", "modified_at", "updated_at",
+		}),
+	}).Create(file).Error
+	if err != nil {
+		return err
+	}
+
+	eventType := models.FileEventCreated
+	if previous != nil {
+		eventType = models.FileEventModified
+		if err := addStorageUsage(tx, previous, -1); err != nil {
+			return err
+		}
+	}
+	if err := addStorageUsage(tx, file, 1); err != nil {
+		return err
+	}
+	return recordFileEvent(tx, file, eventType)
 }
 
 func (s *SQLiteStore) DeleteFile(ctx context.Context, id uint) error {
-	return s.db.WithContext(ctx).Delete(&models.File{}, id).Error
+	return s.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		var file models.File
+		if err := tx.Where("id = ?", id).First(&file).Error; err != nil {
+			return err
+		}
+
+		if err := tx.Delete(&models.File{}, id).Error; err != nil {
+			return err
+		}
+		if err := addStorageUsage(tx, &file, -1); err != nil {
+			return err
+		}
+		return recordFileEvent(tx, &file, models.FileEventDeleted)
+	})
 }
 
 func (s *SQLiteStore) DeleteFilesByBackend(ctx context.Context, backendID string) error {
-	return s.db.WithContext(ctx).Where("backend_id = ?", backendID).Delete(&models.File{}).Error
+	return s.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := recordFileEvents(tx, backendID, models.FileEventDeleted); err != nil {
+			return err
+		}
+		if err := tx.Where("backend_id = ?", backendID).Delete(&models.StorageUsage{}).Error; err != nil {
+			return err
+		}
+		return tx.Where("backend_id = ?", backendID).Delete(&models.File{}).Error
+	})
+}
+
+func (s *SQLiteStore) FindFilesByHash(ctx context.Context, backendID, sha256Hash string) ([]models.File, error) {
+	var files []models.File
+	err := s.db.WithContext(ctx).
+		Where("backend_id = ? AND sha256_hash = ?", backendID, sha256Hash).
+		Find(&files).Error
+	return files, err
+}
+
+// File history operations
+
+func (s *SQLiteStore) ListFileEvents(ctx context.Context, backendID, pathPrefix string, since, until time.Time) ([]models.FileEvent, error) {
+	var events []models.FileEvent
+	query := s.db.WithContext(ctx).Where("backend_id = ?", backendID)
+
+	if pathPrefix != "" {
+		query = query.Where("path LIKE ? ESCAPE '\\'", like(pathPrefix))
+	}
+	if !since.IsZero() {
+		query = query.Where("occurred_at >= ?", since)
+	}
+	if !until.IsZero() {
+		query = query.Where("occurred_at <= ?", until)
+	}
+
+	err := query.Order("id").Find(&events).Error
+	return events, err
+}
+
+// ListFilesAt reconstructs the files below the prefix as they existed at the provided time,
+// returning the latest non-deleted event of each path.
+func (s *SQLiteStore) ListFilesAt(ctx context.Context, backendID, pathPrefix string, at time.Time) ([]models.FileEvent, error) {
+	var events []models.FileEvent
+	latest := s.db.Model(&models.FileEvent{}).
+		Select("MAX(id)").
+		Where("backend_id = ? AND path LIKE ? ESCAPE '\\' AND occurred_at <= ?", backendID, like(pathPrefix), at).
+		Group("path")
+
+	err := s.db.WithContext(ctx).
+		Where("id IN (?) AND type != ?", latest, models.FileEventDeleted).
+		Order("path").
+		Find(&events).Error
+	return events, err
+}
+
+// ListDeletedFiles returns the tombstones of files below the prefix deleted since the provided time
+func (s *SQLiteStore) ListDeletedFiles(ctx context.Context, backendID, pathPrefix string, since time.Time) ([]models.File, error) {
+	var files []models.File
+	err := s.db.WithContext(ctx).Unscoped().
+		Where("backend_id = ? AND path LIKE ? ESCAPE '\\' AND deleted_at IS NOT NULL AND deleted_at >= ?", backendID, like(pathPrefix), since).
+		Order("path").
+		Find(&files).Error
+	return files, err
+}
+
+func (s *SQLiteStore) ListFileEventsAfter(ctx context.Context, afterID uint, limit int) ([]models.FileEvent, error) {
+	var events []models.FileEvent
+	err := s.db.WithContext(ctx).Where("id > ?", afterID).Order("id").Limit(limit).Find(&events).Error
+	return events, err
+}
+
+func (s *SQLiteStore) LatestFileEventID(ctx context.Context) (uint, error) {
+	var id uint
+	err := s.db.WithContext(ctx).Model(&models.FileEvent{}).Select("COALESCE(MAX(id), 0)").Scan(&id).Error
+	return id, err
+}
+
+func recordFileEvent(tx *gorm.DB, file *models.File, eventType models.FileEventType) error {
+	return tx.Create(&models.FileEvent{
+		BackendID:  file.BackendID,
+		Path:       file.Path,
+		Type:       eventType,
+		Size:       file.Size,
+		MD5Hash:    file.MD5Hash,
+		SHA256Hash: file.SHA256Hash,
+		ETag:       file.ETag,
+		VersionID:  file.VersionID,
+		ModifiedAt: file.ModifiedAt,
+		OccurredAt: time.Now().UTC(),
+	}).Error
+}
+
+// recordFileEvents records an event for every (non-deleted) file of the backend
+func recordFileEvents(tx *gorm.DB, backendID string, eventType models.FileEventType) error {
+	return tx.Exec(`INSERT INTO file_events
+		(backend_id, path, type, size, md5_hash, sha256_hash, e_tag, version_id, modified_at, occurred_at)
+		SELECT backend_id, path, ?, size, md5_hash, sha256_hash, e_tag, version_id, modified_at, ?
+		FROM files WHERE backend_id = ? AND deleted_at IS NULL`, eventType, time.Now().UTC(), backendID).Error
+}
+
+// addStorageUsage adds the file to the usage of all directories containing it, or removes it again if sign is -1.
+// Directories without objects are removed, so their usage isn't listed anymore.
+func addStorageUsage(tx *gorm.DB, file *models.File, sign int64) error {
+	prefixes, parents := usageDirs(file.Path)
+	now := time.Now().UTC()
+	for i, prefix := range prefixes {
+		err := tx.Clauses(clause.OnConflict{
+			Columns: []clause.Column{{Name: "backend_id"}, {Name: "prefix"}},
+			DoUpdates: clause.Assignments(map[string]interface{}{
+				"objects":    gorm.Expr("objects + ?", sign),
+				"bytes":      gorm.Expr("bytes + ?", sign*usageBytes(file)),
+				"updated_at": now,
+			}),
+		}).Create(&models.StorageUsage{
+			BackendID: file.BackendID,
+			Prefix:    prefix,
+			Parent:    parents[i],
+			Objects:   sign,
+			Bytes:     sign * usageBytes(file),
+			UpdatedAt: now,
+		}).Error
+		if err != nil {
+			return err
+		}
+	}
+	if sign > 0 {
+		return nil
+	}
+	return tx.Where("backend_id = ? AND prefix IN ? AND objects <= 0", file.BackendID, prefixes).Delete(&models.StorageUsage{}).Error
+}
+
+// Chunk operations
+
+func (s *SQLiteStore) GetChunk(ctx context.Context, backendID, hash string) (*models.Chunk, error) {
+	var chunk models.Chunk
+	err := s.db.WithContext(ctx).
+		Where("backend_id = ? AND hash = ?", backendID, hash).
+		First(&chunk).Error
+	if err != nil {
+		return nil, err
+	}
+	return &chunk, nil
+}
+
+// CreateChunk records the chunk, loading the existing record if it was already created concurrently
+func (s *SQLiteStore) CreateChunk(ctx context.Context, chunk *models.Chunk) error {
+	err := s.db.WithContext(ctx).Clauses(clause.OnConflict{DoNothing: true}).Create(chunk).Error
+	if err != nil || chunk.ID != 0 {
+		return err
+	}
+
+	return s.db.WithContext(ctx).
+		Where("backend_id = ? AND hash = ?", chunk.BackendID, chunk.Hash).
+		First(chunk).Error
+}
+
+// ListFileChunks returns the chunks of a deduplicated file in manifest order
+func (s *SQLiteStore) ListFileChunks(ctx context.Context, fileID uint) ([]models.Chunk, error) {
+	var chunks []models.Chunk
+	err := s.db.WithContext(ctx).
+		Joins("JOIN file_chunks ON file_chunks.chunk_id = chunks.id").
+		Where("file_chunks.file_id = ?", fileID).
+		Order("file_chunks.position").
+		Find(&chunks).Error
+	return chunks, err
+}
+
+// SetFileChunks replaces the manifest of the file with the chunks in order
+func (s *SQLiteStore) SetFileChunks(ctx context.Context, fileID uint, chunkIDs []uint) error {
+	return s.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("file_id = ?", fileID).Delete(&models.FileChunk{}).Error; err != nil {
+			return err
+		}
+		if len(chunkIDs) == 0 {
+			return nil
+		}
+
+		entries := make([]models.FileChunk, len(chunkIDs))
+		for i, chunkID := range chunkIDs {
+			entries[i] = models.FileChunk{
+				FileID:   fileID,
+				Position: i,
+				ChunkID:  chunkID,
+			}
+		}
+		return tx.CreateInBatches(entries, 100).Error
+	})
+}
+
+// ListUnreferencedChunks returns chunks of the backend created before the time that no file references
+func (s *SQLiteStore) ListUnreferencedChunks(ctx context.Context, backendID string, before time.Time, limit int) ([]models.Chunk, error) {
+	var chunks []models.Chunk
+	err := s.db.WithContext(ctx).
+		Where("backend_id = ? AND created_at < ? AND "+unreferencedChunk, backendID, before).
+		Order("id").
+		Limit(limit).
+		Find(&chunks).Error
+	return chunks, err
+}
+
+// DeleteChunk deletes the chunk unless a file references it by now, returning whether it was deleted
+func (s *SQLiteStore) DeleteChunk(ctx context.Context, id uint) (bool, error) {
+	result := s.db.WithContext(ctx).Where("id = ? AND "+unreferencedChunk, id).Delete(&models.Chunk{})
+	return result.RowsAffected > 0, result.Error
+}
+
+// File block operations
+
+func (s *SQLiteStore) ListFileBlocks(ctx context.Context, backendID, path string) ([]models.FileBlock, error) {
+	var blocks []models.FileBlock
+	err := s.db.WithContext(ctx).
+		Where("backend_id = ? AND path = ?", backendID, path).
+		Order("number").
+		Find(&blocks).Error
+	return blocks, err
+}
+
+// ReplaceFileBlocks replaces all block signatures of the path
+func (s *SQLiteStore) ReplaceFileBlocks(ctx context.Context, backendID, path string, blocks []models.FileBlock) error {
+	return s.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("backend_id = ? AND path = ?", backendID, path).Delete(&models.FileBlock{}).Error; err != nil {
+			return err
+		}
+		if len(blocks) == 0 {
+			return nil
+		}
+		return tx.CreateInBatches(blocks, 100).Error
+	})
 }
 
 // Tag operations
@@ -193,8 +743,9 @@ func (s *SQLiteStore) GetFileTags(ctx context.Context, fileID uint) ([]models.Ta
 func (s *SQLiteStore) GetFilesByTag(ctx context.Context, key, value string, limit, offset int) ([]models.File, error) {
 	var files []models.File
 	query := s.db.WithContext(ctx).
-		Joins("JOIN tags ON tags.file_id = files.id").
-		Where("tags.key = ? AND tags.value = ?", key, value)
+		Joins("JOIN tags ON tags.file_id = files.id AND tags.deleted_at IS NULL").
+		Where("tags.key = ? AND tags.value = ?", key, value).
+		Order("files.id")
 
 	if limit > 0 {
 		query = query.Limit(limit)
@@ -240,8 +791,379 @@ func (s *SQLiteStore) UpdateFilter(ctx context.Context, filter *models.Filter) e
 	return s.db.WithContext(ctx).Save(filter).Error
 }
 
+// DeleteFilter removes the filter permanently, so its virtual path can be used again
 func (s *SQLiteStore) DeleteFilter(ctx context.Context, id uint) error {
-	return s.db.WithContext(ctx).Delete(&models.Filter{}, id).Error
+	return s.db.WithContext(ctx).Unscoped().Delete(&models.Filter{}, id).Error
+}
+
+// Trash operations
+
+func (s *SQLiteStore) CreateTrashItem(ctx context.Context, item *models.TrashItem) error {
+	return s.db.WithContext(ctx).Create(item).Error
+}
+
+func (s *SQLiteStore) GetTrashItem(ctx context.Context, id uint) (*models.TrashItem, error) {
+	var item models.TrashItem
+	err := s.db.WithContext(ctx).Where("id = ?", id).First(&item).Error
+	if err != nil {
+		return nil, err
+	}
+	return &item, nil
+}
+
+func (s *SQLiteStore) ListTrashItems(ctx context.Context, backendID, pathPrefix string) ([]models.TrashItem, error) {
+	var items []models.TrashItem
+	query := s.db.WithContext(ctx).Where("backend_id = ?", backendID)
+
+	if pathPrefix != "" {
+		query = query.Where("path LIKE ? ESCAPE '\\'", like(pathPrefix))
+	}
+
+	err := query.Order("trashed_at DESC").Find(&items).Error
+	return items, err
+}
+
+func (s *SQLiteStore) ListExpiredTrashItems(ctx context.Context, backendID string, before time.Time, limit int) ([]models.TrashItem, error) {
+	var items []models.TrashItem
+	query := s.db.WithContext(ctx).
+		Where("backend_id = ? AND expires_at > ? AND expires_at <= ?", backendID, time.Time{}, before).
+		Order("expires_at")
+
+	if limit > 0 {
+		query = query.Limit(limit)
+	}
+
+	err := query.Find(&items).Error
+	return items, err
+}
+
+func (s *SQLiteStore) DeleteTrashItem(ctx context.Context, id uint) error {
+	return s.db.WithContext(ctx).Delete(&models.TrashItem{}, id).Error
+}
+
+// Client operations
+
+func (s *SQLiteStore) SaveClient(ctx context.Context, client *models.Client) error {
+	// The revocation is only changed by RevokeClient, revoked clients aren't updated at all
+	result := s.db.WithContext(ctx).Omit("RevokedAt", "RevokedReason").Clauses(clause.OnConflict{
+		Columns: []clause.Column{{Name: "id"}},
+		DoUpdates: clause.AssignmentColumns([]string{"name", "machine_id", "version", "platform", "address", "active_syncs",
+			"started_at", "last_seen_at", "stopped_at", "updated_at"}),
+		Where: clause.Where{Exprs: []clause.Expression{clause.Expr{SQL: "clients.revoked_at IS NULL"}}},
+	}).Create(client)
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return ErrClientRevoked
+	}
+	return nil
+}
+
+func (s *SQLiteStore) ListClients(ctx context.Context) ([]models.Client, error) {
+	var clients []models.Client
+	err := s.db.WithContext(ctx).Order("last_seen_at DESC").Find(&clients).Error
+	return clients, err
+}
+
+func (s *SQLiteStore) RevokeClient(ctx context.Context, id string, revokedAt *time.Time, reason string) error {
+	result := s.db.WithContext(ctx).Model(&models.Client{}).Where("id = ?", id).Updates(map[string]any{
+		"revoked_at":     revokedAt,
+		"revoked_reason": reason,
+		"updated_at":     time.Now().UTC(),
+	})
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+// Maintenance operations
+
+func (s *SQLiteStore) GetMaintenance(ctx context.Context, clientID string) (*models.Maintenance, error) {
+	var maintenance models.Maintenance
+	if err := s.db.WithContext(ctx).Where("client_id = ?", clientID).First(&maintenance).Error; err != nil {
+		return nil, err
+	}
+	return &maintenance, nil
+}
+
+func (s *SQLiteStore) SaveMaintenance(ctx context.Context, maintenance *models.Maintenance) error {
+	return s.db.WithContext(ctx).Save(maintenance).Error
+}
+
+func (s *SQLiteStore) DeleteMaintenance(ctx context.Context, clientID string) error {
+	return s.db.WithContext(ctx).Where("client_id = ?", clientID).Delete(&models.Maintenance{}).Error
+}
+
+// Lock operations
+
+func (s *SQLiteStore) CreateLock(ctx context.Context, lock *models.Lock) error {
+	return s.db.WithContext(ctx).Create(lock).Error
+}
+
+func (s *SQLiteStore) GetLock(ctx context.Context, backendID, path string) (*models.Lock, error) {
+	var lock models.Lock
+	err := s.db.WithContext(ctx).
+		Where("backend_id = ? AND path = ?", backendID, path).
+		First(&lock).Error
+	if err != nil {
+		return nil, err
+	}
+	return &lock, nil
+}
+
+func (s *SQLiteStore) ListLocks(ctx context.Context, backendID, pathPrefix string) ([]models.Lock, error) {
+	var locks []models.Lock
+	query := s.db.WithContext(ctx)
+
+	if backendID != "" {
+		query = query.Where("backend_id = ?", backendID)
+	}
+	if pathPrefix != "" {
+		query = query.Where("path LIKE ? ESCAPE '\\'", like(pathPrefix))
+	}
+
+	err := query.Order("backend_id, path").Find(&locks).Error
+	return locks, err
+}
+
+func (s *SQLiteStore) UpdateLock(ctx context.Context, lock *models.Lock) error {
+	return s.db.WithContext(ctx).Save(lock).Error
+}
+
+func (s *SQLiteStore) DeleteLock(ctx context.Context, id uint) error {
+	return s.db.WithContext(ctx).Delete(&models.Lock{}, id).Error
+}
+
+// API token operations
+
+func (s *SQLiteStore) CreateAPIToken(ctx context.Context, token *models.APIToken) error {
+	return s.db.WithContext(ctx).Create(token).Error
+}
+
+func (s *SQLiteStore) GetAPIToken(ctx context.Context, name string) (*models.APIToken, error) {
+	var token models.APIToken
+	err := s.db.WithContext(ctx).Where("name = ?", name).First(&token).Error
+	if err != nil {
+		return nil, err
+	}
+	return &token, nil
+}
+
+func (s *SQLiteStore) GetAPITokenByHash(ctx context.Context, hash string) (*models.APIToken, error) {
+	var token models.APIToken
+	err := s.db.WithContext(ctx).Where("hash = ?", hash).First(&token).Error
+	if err != nil {
+		return nil, err
+	}
+	return &token, nil
+}
+
+func (s *SQLiteStore) ListAPITokens(ctx context.Context) ([]models.APIToken, error) {
+	var tokens []models.APIToken
+	err := s.db.WithContext(ctx).Order("name").Find(&tokens).Error
+	return tokens, err
+}
+
+func (s *SQLiteStore) UpdateAPIToken(ctx context.Context, token *models.APIToken) error {
+	return s.db.WithContext(ctx).Save(token).Error
+}
+
+// Restore drill operations
+
+func (s *SQLiteStore) CreateRestoreDrill(ctx context.Context, drill *models.RestoreDrill) error {
+	return s.db.WithContext(ctx).Create(drill).Error
+}
+
+func (s *SQLiteStore) ListRestoreDrills(ctx context.Context, backendID string, limit int) ([]models.RestoreDrill, error) {
+	var drills []models.RestoreDrill
+	query := s.db.WithContext(ctx)
+
+	if backendID != "" {
+		query = query.Where("backend_id = ?", backendID)
+	}
+	if limit > 0 {
+		query = query.Limit(limit)
+	}
+
+	err := query.Order("started_at DESC").Find(&drills).Error
+	return drills, err
+}
+
+// Integrity error operations
+
+func (s *SQLiteStore) CreateIntegrityError(ctx context.Context, integrity *models.IntegrityError) error {
+	return s.db.WithContext(ctx).Create(integrity).Error
+}
+
+func (s *SQLiteStore) ListIntegrityErrors(ctx context.Context, syncConfigID uint, limit int) ([]models.IntegrityError, error) {
+	var errs []models.IntegrityError
+	query := s.db.WithContext(ctx)
+
+	if syncConfigID != 0 {
+		query = query.Where("sync_config_id = ?", syncConfigID)
+	}
+	if limit > 0 {
+		query = query.Limit(limit)
+	}
+
+	err := query.Order("detected_at DESC").Find(&errs).Error
+	return errs, err
+}
+
+// Search index operations
+
+func (s *SQLiteStore) GetIndexCursor(ctx context.Context, name string) (*models.IndexCursor, error) {
+	var cursor models.IndexCursor
+	err := s.db.WithContext(ctx).Where("name = ?", name).First(&cursor).Error
+	if err != nil {
+		return nil, err
+	}
+	return &cursor, nil
+}
+
+func (s *SQLiteStore) SaveIndexCursor(ctx context.Context, cursor *models.IndexCursor) error {
+	return s.db.WithContext(ctx).Save(cursor).Error
+}
+
+func (s *SQLiteStore) DeleteIndexCursor(ctx context.Context, name string) error {
+	return s.db.WithContext(ctx).Delete(&models.IndexCursor{}, "name = ?", name).Error
+}
+
+// Bandwidth usage operations
+
+// AddBandwidthUsage adds the usage to the rollup of the backend and month, creating it if required
+func (s *SQLiteStore) AddBandwidthUsage(ctx context.Context, usage *models.BandwidthUsage) error {
+	return s.db.WithContext(ctx).Clauses(clause.OnConflict{
+		Columns: []clause.Column{{Name: "backend_id"}, {Name: "month"}},
+		DoUpdates: clause.Assignments(map[string]interface{}{
+			"bytes_uploaded":   gorm.Expr("bytes_uploaded + ?", usage.BytesUploaded),
+			"bytes_downloaded": gorm.Expr("bytes_downloaded + ?", usage.BytesDownloaded),
+			"api_calls":        gorm.Expr("api_calls + ?", usage.APICalls),
+			"updated_at":       time.Now().UTC(),
+		}),
+	}).Create(usage).Error
+}
+
+func (s *SQLiteStore) ListBandwidthUsage(ctx context.Context, backendID, fromMonth, toMonth string) ([]models.BandwidthUsage, error) {
+	var usages []models.BandwidthUsage
+	query := s.db.WithContext(ctx)
+
+	if backendID != "" {
+		query = query.Where("backend_id = ?", backendID)
+	}
+	if fromMonth != "" {
+		query = query.Where("month >= ?", fromMonth)
+	}
+	if toMonth != "" {
+		query = query.Where("month <= ?", toMonth)
+	}
+
+	err := query.Order("month DESC, backend_id").Find(&usages).Error
+	return usages, err
+}
+
+// Storage usage operations
+
+// GetStorageUsage returns the usage of the backend below the prefix ("" for the whole backend)
+func (s *SQLiteStore) GetStorageUsage(ctx context.Context, backendID, prefix string) (*models.StorageUsage, error) {
+	var usage models.StorageUsage
+	err := s.db.WithContext(ctx).Where("backend_id = ? AND prefix = ?", backendID, prefix).First(&usage).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return &models.StorageUsage{BackendID: backendID, Prefix: prefix}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &usage, nil
+}
+
+func (s *SQLiteStore) ListStorageUsage(ctx context.Context, backendID, prefix string) ([]models.StorageUsage, error) {
+	var usages []models.StorageUsage
+	// The whole backend is the parent of itself
+	err := s.db.WithContext(ctx).
+		Where("backend_id = ? AND parent = ? AND prefix != ''", backendID, prefix).
+		Order("prefix").Find(&usages).Error
+	return usages, err
+}
+
+func (s *SQLiteStore) AddSyncActivity(ctx context.Context, activity *models.SyncActivity) error {
+	return s.db.WithContext(ctx).Clauses(clause.OnConflict{
+		Columns: []clause.Column{{Name: "sync_config_id"}, {Name: "client_id"}, {Name: "day"}},
+		DoUpdates: clause.Assignments(map[string]interface{}{
+			"passes":     gorm.Expr("passes + ?", activity.Passes),
+			"added":      gorm.Expr("added + ?", activity.Added),
+			"changed":    gorm.Expr("changed + ?", activity.Changed),
+			"deleted":    gorm.Expr("deleted + ?", activity.Deleted),
+			"conflicts":  gorm.Expr("conflicts + ?", activity.Conflicts),
+			"errors":     gorm.Expr("errors + ?", activity.Errors),
+			"bytes":      gorm.Expr("bytes + ?", activity.Bytes),
+			"updated_at": time.Now().UTC(),
+		}),
+	}).Create(activity).Error
+}
+
+func (s *SQLiteStore) ListSyncActivity(ctx context.Context, syncConfigID uint, fromDay, toDay string) ([]models.SyncActivity, error) {
+	var activities []models.SyncActivity
+	query := s.db.WithContext(ctx)
+
+	if syncConfigID != 0 {
+		query = query.Where("sync_config_id = ?", syncConfigID)
+	}
+	if fromDay != "" {
+		query = query.Where("day >= ?", fromDay)
+	}
+	if toDay != "" {
+		query = query.Where("day <= ?", toDay)
+	}
+
+	err := query.Order("day DESC, sync_config_id, client_id").Find(&activities).Error
+	return activities, err
+}
+
+// Transfer log operations
+
+func (s *SQLiteStore) CreateTransferLog(ctx context.Context, entry *models.TransferLog) error {
+	return s.db.WithContext(ctx).Create(entry).Error
+}
+
+func (s *SQLiteStore) ListTransferLogs(ctx context.Context, filter TransferLogFilter) ([]models.TransferLog, error) {
+	var entries []models.TransferLog
+	query := s.db.WithContext(ctx)
+
+	if cond, args := transferLogConditions(filter); cond != "" {
+		query = query.Where(cond, args...)
+	}
+	if filter.Limit > 0 {
+		query = query.Limit(filter.Limit)
+	}
+
+	err := query.Order("id DESC").Find(&entries).Error
+	return entries, err
+}
+
+func (s *SQLiteStore) PruneTransferLogs(ctx context.Context, maxBytes int64) (int64, error) {
+	result := s.db.WithContext(ctx).Exec(pruneTransferLogsStatement, maxBytes)
+	return result.RowsAffected, result.Error
+}
+
+// Local hash operations
+
+func (s *SQLiteStore) GetLocalHash(ctx context.Context, path string) (*models.LocalHash, error) {
+	var hash models.LocalHash
+	err := s.db.WithContext(ctx).Where("path = ?", path).First(&hash).Error
+	if err != nil {
+		return nil, err
+	}
+	return &hash, nil
+}
+
+func (s *SQLiteStore) SaveLocalHash(ctx context.Context, hash *models.LocalHash) error {
+	return s.db.WithContext(ctx).Save(hash).Error
 }
 
 // Sync operations
@@ -297,3 +1219,241 @@ func (s *SQLiteStore) UpdateSyncState(ctx context.Context, state *models.SyncSta
 func (s *SQLiteStore) DeleteSyncState(ctx context.Context, id uint) error {
 	return s.db.WithContext(ctx).Delete(&models.SyncState{}, id).Error
 }
+
+// Sync baseline operations
+
+func (s *SQLiteStore) ListSyncBaselines(ctx context.Context, syncConfigID uint, clientID string) ([]models.SyncBaseline, error) {
+	var baselines []models.SyncBaseline
+	err := s.db.WithContext(ctx).
+		Where("sync_config_id = ? AND client_id = ?", syncConfigID, clientID).
+		Order("path").
+		Find(&baselines).Error
+	return baselines, err
+}
+
+func (s *SQLiteStore) GetSyncBaseline(ctx context.Context, syncConfigID uint, clientID, path string) (*models.SyncBaseline, error) {
+	var baseline models.SyncBaseline
+	err := s.db.WithContext(ctx).
+		Where("sync_config_id = ? AND client_id = ? AND path = ?", syncConfigID, clientID, path).
+		First(&baseline).Error
+	if err != nil {
+		return nil, err
+	}
+	return &baseline, nil
+}
+
+// SaveSyncBaseline creates or replaces the baseline of the path
+func (s *SQLiteStore) SaveSyncBaseline(ctx context.Context, baseline *models.SyncBaseline) error {
+	return s.db.WithContext(ctx).Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "sync_config_id"}, {Name: "client_id"}, {Name: "path"}},
+		DoUpdates: clause.AssignmentColumns([]string{"size", "source_e_tag", "dest_e_tag", "source_modified_at", "dest_modified_at", "synced_at", "placeholder", "updated_at"}),
+	}).Create(baseline).Error
+}
+
+func (s *SQLiteStore) DeleteSyncBaseline(ctx context.Context, syncConfigID uint, clientID, path string) error {
+	return s.db.WithContext(ctx).
+		Where("sync_config_id = ? AND client_id = ? AND path = ?", syncConfigID, clientID, path).
+		Delete(&models.SyncBaseline{}).Error
+}
+
+// Sync selection operations
+
+// SaveSyncSelection creates or replaces the selection of the directory
+func (s *SQLiteStore) SaveSyncSelection(ctx context.Context, selection *models.SyncSelection) error {
+	return s.db.WithContext(ctx).Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "sync_config_id"}, {Name: "path"}},
+		DoUpdates: clause.AssignmentColumns([]string{"mode", "updated_at"}),
+	}).Create(selection).Error
+}
+
+func (s *SQLiteStore) ListSyncSelections(ctx context.Context, syncConfigID uint) ([]models.SyncSelection, error) {
+	var selections []models.SyncSelection
+	err := s.db.WithContext(ctx).
+		Where("sync_config_id = ?", syncConfigID).
+		Order("path").
+		Find(&selections).Error
+	return selections, err
+}
+
+func (s *SQLiteStore) DeleteSyncSelection(ctx context.Context, syncConfigID uint, path string) error {
+	return s.db.WithContext(ctx).
+		Where("sync_config_id = ? AND path = ?", syncConfigID, path).
+		Delete(&models.SyncSelection{}).Error
+}
+
+// Sync pin operations
+
+// SaveSyncPin creates or replaces the pin of the path
+func (s *SQLiteStore) SaveSyncPin(ctx context.Context, pin *models.SyncPin) error {
+	return s.db.WithContext(ctx).Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "sync_config_id"}, {Name: "client_id"}, {Name: "path"}},
+		DoUpdates: clause.AssignmentColumns([]string{"pinned", "updated_at"}),
+	}).Create(pin).Error
+}
+
+func (s *SQLiteStore) ListSyncPins(ctx context.Context, syncConfigID uint, clientID string) ([]models.SyncPin, error) {
+	var pins []models.SyncPin
+	err := s.db.WithContext(ctx).
+		Where("sync_config_id = ? AND client_id = ?", syncConfigID, clientID).
+		Order("path").
+		Find(&pins).Error
+	return pins, err
+}
+
+func (s *SQLiteStore) DeleteSyncPin(ctx context.Context, syncConfigID uint, clientID, path string) error {
+	return s.db.WithContext(ctx).
+		Where("sync_config_id = ? AND client_id = ? AND path = ?", syncConfigID, clientID, path).
+		Delete(&models.SyncPin{}).Error
+}
+
+// MoveSyncPrefix hands the baselines, pending deletions, selections, pins and states below a directory of one sync over
+// to another sync. Records the target sync already has below its directory are replaced.
+func (s *SQLiteStore) MoveSyncPrefix(ctx context.Context, move SyncPrefixMove) (int64, error) {
+	if err := move.validate(); err != nil {
+		return 0, err
+	}
+
+	var moved int64
+	err := s.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		fromQuery, fromArgs := pathsBelow(move.FromPrefix)
+		toQuery, toArgs := pathsBelow(move.ToPrefix)
+		rebase, rebaseArgs := move.rebase()
+		rebased := gorm.Expr(rebase, rebaseArgs...)
+
+		for _, model := range []any{&models.SyncBaseline{}, &models.PendingDeletion{}, &models.SyncSelection{}, &models.SyncPin{}} {
+			if err := tx.Where("sync_config_id = ?", move.ToSyncID).Where(toQuery, toArgs...).Delete(model).Error; err != nil {
+				return err
+			}
+
+			result := tx.Model(model).
+				Where("sync_config_id = ?", move.FromSyncID).Where(fromQuery, fromArgs...).
+				Updates(map[string]any{"sync_config_id": move.ToSyncID, "path": rebased})
+			if result.Error != nil {
+				return result.Error
+			}
+			if _, ok := model.(*models.SyncBaseline); ok {
+				moved = result.RowsAffected
+			}
+		}
+
+		// Clients without state of the target sync continue with the state of the moved paths, e.g. their bootstrap mode
+		now := time.Now().UTC()
+		err := tx.Exec(`INSERT INTO sync_states (sync_config_id, backend_id, client_id, last_sync_at, bootstrap, created_at, updated_at)
+			SELECT ?, backend_id, client_id, last_sync_at, bootstrap, ?, ? FROM sync_states AS s WHERE s.sync_config_id = ?
+			AND NOT EXISTS (SELECT 1 FROM sync_states AS t WHERE t.sync_config_id = ? AND t.client_id = s.client_id)`,
+			move.ToSyncID, now, now, move.FromSyncID, move.ToSyncID).Error
+		if err != nil {
+			return err
+		}
+
+		if move.Merge {
+			return tx.Delete(&models.SyncConfig{}, move.FromSyncID).Error
+		}
+		return tx.Clauses(clause.OnConflict{
+			Columns:   []clause.Column{{Name: "sync_config_id"}, {Name: "path"}},
+			DoUpdates: clause.AssignmentColumns([]string{"mode", "updated_at"}),
+		}).Create(&models.SyncSelection{
+			SyncConfigID: move.FromSyncID,
+			Path:         move.FromPrefix,
+			Mode:         models.SelectionExclude,
+		}).Error
+	})
+	return moved, err
+}
+
+// Pending deletion operations
+
+// SavePendingDeletion creates or replaces the pending deletion of the path
+func (s *SQLiteStore) SavePendingDeletion(ctx context.Context, pending *models.PendingDeletion) error {
+	return s.db.WithContext(ctx).Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "sync_config_id"}, {Name: "client_id"}, {Name: "path"}},
+		DoUpdates: clause.AssignmentColumns([]string{"side", "detected_at", "due_at", "updated_at"}),
+	}).Create(pending).Error
+}
+
+// ListPendingDeletions returns the pending deletions of all syncs of the client ordered by due time
+func (s *SQLiteStore) ListPendingDeletions(ctx context.Context, clientID string) ([]models.PendingDeletion, error) {
+	var pending []models.PendingDeletion
+	err := s.db.WithContext(ctx).
+		Where("client_id = ?", clientID).
+		Order("due_at, path").
+		Find(&pending).Error
+	return pending, err
+}
+
+func (s *SQLiteStore) DeletePendingDeletion(ctx context.Context, syncConfigID uint, clientID, path string) error {
+	return s.db.WithContext(ctx).
+		Where("sync_config_id = ? AND client_id = ? AND path = ?", syncConfigID, clientID, path).
+		Delete(&models.PendingDeletion{}).Error
+}
+
+// Maintenance operations
+
+// PurgeDeleted hard-deletes all records soft-deleted before the time and returns their number.
+// Backends are kept as long as files still refer to them, the locks, trash, events, chunks and usage
+// of purged backends are deleted along with them.
+func (s *SQLiteStore) PurgeDeleted(ctx context.Context, before time.Time) (int64, error) {
+	var purged int64
+	err := s.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		for _, model := range []any{&models.Tag{}, &models.File{}, &models.Filter{}, &models.SyncConfig{}} {
+			result := tx.Unscoped().Where("deleted_at < ?", before).Delete(model)
+			if result.Error != nil {
+				return result.Error
+			}
+			purged += result.RowsAffected
+		}
+
+		for _, model := range []any{&models.Lock{}, &models.TrashItem{}, &models.FileEvent{}, &models.Chunk{}, &models.BandwidthUsage{}, &models.StorageUsage{}} {
+			result := tx.Unscoped().Where("backend_id IN (SELECT id FROM backends WHERE "+purgedBackend+")", before).Delete(model)
+			if result.Error != nil {
+				return result.Error
+			}
+			purged += result.RowsAffected
+		}
+
+		result := tx.Unscoped().Where(purgedBackend, before).Delete(&models.Backend{})
+		purged += result.RowsAffected
+		return result.Error
+	})
+	return purged, err
+}
+
+// PruneOrphans deletes tags and chunk references of files and states, activity and logs of syncs that no longer
+// exist and returns their number
+func (s *SQLiteStore) PruneOrphans(ctx context.Context) (int64, error) {
+	var pruned int64
+	err := s.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		orphans := []struct {
+			model any
+			query string
+		}{
+			{&models.Tag{}, "file_id NOT IN (SELECT id FROM files)"},
+			{&models.FileChunk{}, "file_id NOT IN (SELECT id FROM files)"},
+			{&models.SyncState{}, "sync_config_id NOT IN (SELECT id FROM sync_configs)"},
+			{&models.SyncBaseline{}, "sync_config_id NOT IN (SELECT id FROM sync_configs)"},
+			{&models.PendingDeletion{}, "sync_config_id NOT IN (SELECT id FROM sync_configs)"},
+			{&models.SyncSelection{}, "sync_config_id NOT IN (SELECT id FROM sync_configs)"},
+			{&models.SyncPin{}, "sync_config_id NOT IN (SELECT id FROM sync_configs)"},
+			{&models.SyncActivity{}, "sync_config_id NOT IN (SELECT id FROM sync_configs)"},
+			{&models.IntegrityError{}, "sync_config_id NOT IN (SELECT id FROM sync_configs)"},
+			{&models.TransferLog{}, "sync_config_id NOT IN (SELECT id FROM sync_configs)"},
+		}
+		for _, orphan := range orphans {
+			result := tx.Unscoped().Where(orphan.query).Delete(orphan.model)
+			if result.Error != nil {
+				return result.Error
+			}
+			pruned += result.RowsAffected
+		}
+		return nil
+	})
+	return pruned, err
+}
+
+// Vacuum rebuilds the database to reclaim the space of deleted records and updates the statistics of the query planner
+func (s *SQLiteStore) Vacuum(ctx context.Context) error {
+	if err := s.db.WithContext(ctx).Exec("VACUUM").Error; err != nil {
+		return err
+	}
+	return s.db.WithContext(ctx).Exec("ANALYZE").Error
+}
@@ -0,0 +1,56 @@
+package store
+
+import (
+	"strings"
+
+	"github.com/mwantia/gosync/pkg/db/models"
+)
+
+// transferLogSize estimates the bytes an entry of the transfer log occupies within the database, made up of its
+// text columns and a fixed overhead for the remaining columns, the row header and the index entries
+const transferLogSize = "96 + length(client_id) + length(operation) + length(source) + length(destination) + length(COALESCE(error, ''))"
+
+// pruneTransferLogsStatement deletes all entries from the newest entry on, whose size summed up with the size of all
+// newer entries exceeds the limit
+const pruneTransferLogsStatement = `DELETE FROM transfer_logs WHERE id <= (
+	SELECT id FROM (SELECT id, SUM(` + transferLogSize + `) OVER (ORDER BY id DESC) AS total FROM transfer_logs)
+	WHERE total > ? ORDER BY id DESC LIMIT 1
+)`
+
+// transferLogConditions returns the conditions of the filter joined by AND together with their arguments,
+// or an empty condition if the filter doesn't restrict the result
+func transferLogConditions(filter TransferLogFilter) (string, []any) {
+	var conditions []string
+	var args []any
+
+	if p := strings.TrimRight(filter.Path, `/\`); p != "" {
+		// Local paths are recorded with the separator of the client, virtual paths always with slashes
+		conditions = append(conditions, "(source = ? OR source LIKE ? OR source LIKE ? OR destination = ? OR destination LIKE ? OR destination LIKE ?)")
+		args = append(args, p, p+"/%", p+`\%`, p, p+"/%", p+`\%`)
+	}
+	if filter.SyncConfigID != 0 {
+		conditions = append(conditions, "sync_config_id = ?")
+		args = append(args, filter.SyncConfigID)
+	}
+	if filter.ClientID != "" {
+		conditions = append(conditions, "client_id = ?")
+		args = append(args, filter.ClientID)
+	}
+	if !filter.Since.IsZero() {
+		conditions = append(conditions, "finished_at >= ?")
+		args = append(args, filter.Since)
+	}
+	if !filter.Until.IsZero() {
+		conditions = append(conditions, "finished_at <= ?")
+		args = append(args, filter.Until)
+	}
+	if filter.Failed {
+		conditions = append(conditions, "result = ?")
+		args = append(args, models.TransferFailed)
+	}
+	if filter.Before != 0 {
+		conditions = append(conditions, "id < ?")
+		args = append(args, filter.Before)
+	}
+	return strings.Join(conditions, " AND "), args
+}
@@ -0,0 +1,24 @@
+package store
+
+import "github.com/mwantia/gosync/pkg/db/models"
+
+// usageDirs returns the directories containing the path, from the whole backend ("") down to the directory of the
+// path, together with the directory containing each of them
+func usageDirs(p string) (prefixes, parents []string) {
+	prefixes, parents = []string{""}, []string{""}
+	for i := 0; i < len(p); i++ {
+		if p[i] == '/' {
+			parents = append(parents, prefixes[len(prefixes)-1])
+			prefixes = append(prefixes, p[:i])
+		}
+	}
+	return prefixes, parents
+}
+
+// usageBytes returns the bytes the file occupies within its backend, which are stored as chunks for deduplicated files
+func usageBytes(file *models.File) int64 {
+	if file.Deduplicated {
+		return 0
+	}
+	return file.Size
+}
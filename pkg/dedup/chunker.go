@@ -0,0 +1,71 @@
+package dedup
+
+import (
+	"bufio"
+	"io"
+	"math/rand/v2"
+)
+
+const (
+	// Chunk size bounds of the content-defined chunker
+	MinChunkSize = 512 << 10
+	AvgChunkSize = 1 << 20
+	MaxChunkSize = 4 << 20
+)
+
+// chunkMask cuts chunks on average every AvgChunkSize bytes past the minimum size
+const chunkMask = AvgChunkSize - MinChunkSize - 1
+
+// gear maps each byte to a pseudo-random value of the rolling gear hash; the table
+// is seeded deterministically, since chunk boundaries must be stable across clients
+var gear = func() [256]uint64 {
+	var table [256]uint64
+	rng := rand.New(rand.NewPCG(0x676f73796e63, 0x6465647570))
+	for i := range table {
+		table[i] = rng.Uint64()
+	}
+	return table
+}()
+
+// Chunker splits a stream into content-defined chunks using a gear rolling hash,
+// so insertions only change the chunks around the modified region
+type Chunker struct {
+	reader *bufio.Reader
+	buffer []byte
+}
+
+// NewChunker creates a new chunker reading from r
+func NewChunker(r io.Reader) *Chunker {
+	return &Chunker{
+		reader: bufio.NewReaderSize(r, MaxChunkSize),
+		buffer: make([]byte, 0, MaxChunkSize),
+	}
+}
+
+// Next returns the next chunk, which is only valid until the following call, or io.EOF at the end
+func (c *Chunker) Next() ([]byte, error) {
+	c.buffer = c.buffer[:0]
+	var hash uint64
+
+	for len(c.buffer) < MaxChunkSize {
+		b, err := c.reader.ReadByte()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		c.buffer = append(c.buffer, b)
+		hash = (hash << 1) + gear[b]
+
+		if len(c.buffer) >= MinChunkSize && hash&chunkMask == 0 {
+			break
+		}
+	}
+
+	if len(c.buffer) == 0 {
+		return nil, io.EOF
+	}
+	return c.buffer, nil
+}
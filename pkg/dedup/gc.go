@@ -0,0 +1,94 @@
+package dedup
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"path"
+	"time"
+
+	"github.com/mwantia/gosync/pkg/db/store"
+	"github.com/mwantia/gosync/pkg/storage"
+)
+
+// CollectGarbage deletes the chunks of the backend that no file references anymore, once they were created before
+// the provided time. The grace period protects chunks of uploads still in progress, whose files aren't recorded
+// yet. Chunk objects without any record, e.g. of uploads that failed to record their chunks, are deleted as well
+// once they were last modified before the time. Returns the number of deleted chunk objects.
+func (s *Store) CollectGarbage(ctx context.Context, before time.Time) (int, error) {
+	collected := 0
+	for {
+		chunks, err := s.store.ListUnreferencedChunks(ctx, s.backend.ID, before, storage.MaxDeleteBatchSize)
+		if err != nil {
+			return collected, fmt.Errorf("failed to list unreferenced chunks: %w", err)
+		}
+
+		// Records are deleted before their objects, so a file referencing the chunk in the meantime keeps it
+		keys := make([]string, 0, len(chunks))
+		for _, chunk := range chunks {
+			deleted, err := s.store.DeleteChunk(ctx, chunk.ID)
+			if err != nil {
+				return collected, fmt.Errorf("failed to delete chunk '%s': %w", chunk.Hash, err)
+			}
+			if deleted {
+				keys = append(keys, ChunkKey(chunk.Hash))
+			}
+		}
+		n, err := s.deleteChunks(ctx, keys)
+		collected += n
+		if err != nil {
+			return collected, err
+		}
+
+		if len(chunks) < storage.MaxDeleteBatchSize {
+			break
+		}
+	}
+
+	var keys []string
+	err := s.storage.List(ctx, ChunkPrefix, func(object storage.ObjectInfo) error {
+		if !object.LastModified.Before(before) {
+			return nil
+		}
+		_, err := s.store.GetChunk(ctx, s.backend.ID, path.Base(object.Key))
+		if errors.Is(err, store.ErrNotFound) {
+			keys = append(keys, object.Key)
+			return nil
+		}
+		return err
+	})
+	if err != nil {
+		return collected, fmt.Errorf("failed to list chunk objects: %w", err)
+	}
+	for start := 0; start < len(keys); start += storage.MaxDeleteBatchSize {
+		n, err := s.deleteChunks(ctx, keys[start:min(start+storage.MaxDeleteBatchSize, len(keys))])
+		collected += n
+		if err != nil {
+			return collected, err
+		}
+	}
+	return collected, nil
+}
+
+// deleteChunks deletes the chunk objects and returns the number of deleted objects. Objects that failed to be
+// deleted are collected by a later run, since their records are already gone.
+func (s *Store) deleteChunks(ctx context.Context, keys []string) (int, error) {
+	if len(keys) == 0 {
+		return 0, nil
+	}
+
+	failed, err := s.storage.DeleteMany(ctx, keys)
+	if err != nil {
+		return 0, fmt.Errorf("failed to delete chunk objects: %w", err)
+	}
+	remaining := len(failed)
+	for _, f := range failed {
+		if errors.Is(f.Err, storage.ErrObjectNotFound) {
+			remaining--
+		}
+	}
+	if remaining > 0 {
+		return len(keys) - remaining, fmt.Errorf("failed to delete %d chunk objects", remaining)
+	}
+	return len(keys), nil
+}
@@ -0,0 +1,59 @@
+package dedup
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+)
+
+// ContentType identifies objects containing a chunk manifest instead of file content
+const ContentType = "application/vnd.gosync.manifest+json"
+
+// ChunkPrefix is the key prefix under which chunks are stored by their hash
+const ChunkPrefix = ".gosync-chunks/"
+
+// manifestVersion is the current version of the manifest format
+const manifestVersion = 1
+
+// Manifest lists the chunks a deduplicated file is assembled from
+type Manifest struct {
+	Version int        `json:"version"`
+	Size    int64      `json:"size"`
+	SHA256  string     `json:"sha256"`
+	Chunks  []ChunkRef `json:"chunks"`
+}
+
+// ChunkRef references a single chunk of a manifest
+type ChunkRef struct {
+	Hash string `json:"hash"`
+	Size int64  `json:"size"`
+}
+
+// ChunkKey returns the object key of the chunk with the hash, fanned out by the first hash byte
+func ChunkKey(hash string) string {
+	if len(hash) < 2 {
+		return ChunkPrefix + hash
+	}
+	return ChunkPrefix + hash[:2] + "/" + hash
+}
+
+// ReadManifest decodes and validates a manifest
+func ReadManifest(r io.Reader) (*Manifest, error) {
+	var manifest Manifest
+	if err := json.NewDecoder(r).Decode(&manifest); err != nil {
+		return nil, fmt.Errorf("failed to decode manifest: %w", err)
+	}
+	if manifest.Version != manifestVersion {
+		return nil, fmt.Errorf("unsupported manifest version %d", manifest.Version)
+	}
+
+	var size int64
+	for _, chunk := range manifest.Chunks {
+		size += chunk.Size
+	}
+	if size != manifest.Size {
+		return nil, fmt.Errorf("manifest size %d doesn't match chunk sizes %d", manifest.Size, size)
+	}
+
+	return &manifest, nil
+}
@@ -0,0 +1,228 @@
+package dedup
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+
+	"github.com/mwantia/gosync/pkg/db/models"
+	"github.com/mwantia/gosync/pkg/db/store"
+	"github.com/mwantia/gosync/pkg/storage"
+)
+
+// Store writes and reads deduplicated files of a backend
+type Store struct {
+	store   store.MetadataStore
+	storage storage.Storage
+	backend *models.Backend
+}
+
+// NewStore creates a new dedup store for the provided backend
+func NewStore(ms store.MetadataStore, st storage.Storage, backend *models.Backend) *Store {
+	return &Store{
+		store:   ms,
+		storage: st,
+		backend: backend,
+	}
+}
+
+// IsChunkKey returns true if the key is located within the chunk prefix
+func IsChunkKey(key string) bool {
+	return strings.HasPrefix(key, ChunkPrefix)
+}
+
+// IsDeduplicated returns true if the object at the key is the manifest of a deduplicated file, either by its content
+// type or by the metadata recorded for its current version
+func (s *Store) IsDeduplicated(ctx context.Context, key string, stat *storage.ObjectInfo) bool {
+	if stat.ContentType == ContentType {
+		return true
+	}
+	record, err := s.store.GetFile(ctx, s.backend.ID, key)
+	return err == nil && record.Deduplicated && record.ETag == stat.ETag
+}
+
+// Put splits the content into chunks, uploads all chunks not yet stored in the backend,
+// writes the manifest to the key and records the file metadata
+func (s *Store) Put(ctx context.Context, key string, r io.Reader, modifiedAt time.Time) (*storage.ObjectInfo, *Manifest, error) {
+	manifest := &Manifest{
+		Version: manifestVersion,
+	}
+	content := sha256.New()
+	chunker := NewChunker(io.TeeReader(r, content))
+
+	var chunkIDs []uint
+	for {
+		data, err := chunker.Next()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return nil, nil, fmt.Errorf("failed to read '%s': %w", key, err)
+		}
+
+		chunk, err := s.putChunk(ctx, data)
+		if err != nil {
+			return nil, nil, err
+		}
+
+		chunkIDs = append(chunkIDs, chunk.ID)
+		manifest.Chunks = append(manifest.Chunks, ChunkRef{
+			Hash: chunk.Hash,
+			Size: chunk.Size,
+		})
+		manifest.Size += chunk.Size
+	}
+	manifest.SHA256 = hex.EncodeToString(content.Sum(nil))
+
+	encoded, err := json.Marshal(manifest)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to encode manifest of '%s': %w", key, err)
+	}
+
+	info, err := s.storage.Put(ctx, key, bytes.NewReader(encoded), int64(len(encoded)), storage.PutOptions{
+		ContentType: ContentType,
+	})
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to write manifest of '%s': %w", key, err)
+	}
+
+	if err := s.record(ctx, key, info, manifest, chunkIDs, modifiedAt); err != nil {
+		return nil, nil, err
+	}
+
+	return info, manifest, nil
+}
+
+// putChunk uploads the chunk unless it is already stored in the backend
+func (s *Store) putChunk(ctx context.Context, data []byte) (*models.Chunk, error) {
+	sum := sha256.Sum256(data)
+	hash := hex.EncodeToString(sum[:])
+
+	if chunk, err := s.store.GetChunk(ctx, s.backend.ID, hash); err == nil {
+		return chunk, nil
+	}
+
+	chunkKey := ChunkKey(hash)
+	if _, err := s.storage.Stat(ctx, chunkKey); err != nil {
+		if !errors.Is(err, storage.ErrObjectNotFound) {
+			return nil, fmt.Errorf("failed to stat chunk '%s': %w", hash, err)
+		}
+
+		_, err := s.storage.Put(ctx, chunkKey, bytes.NewReader(data), int64(len(data)), storage.PutOptions{
+			ContentType: "application/octet-stream",
+			IfNoneMatch: true,
+		})
+		// Another client may have uploaded the same chunk in the meantime
+		if err != nil && !errors.Is(err, storage.ErrPreconditionFailed) {
+			return nil, fmt.Errorf("failed to write chunk '%s': %w", hash, err)
+		}
+	}
+
+	chunk := &models.Chunk{
+		BackendID: s.backend.ID,
+		Hash:      hash,
+		Size:      int64(len(data)),
+	}
+	if err := s.store.CreateChunk(ctx, chunk); err != nil {
+		return nil, fmt.Errorf("failed to record chunk '%s': %w", hash, err)
+	}
+
+	return chunk, nil
+}
+
+func (s *Store) record(ctx context.Context, key string, info *storage.ObjectInfo, manifest *Manifest, chunkIDs []uint, modifiedAt time.Time) error {
+	record := &models.File{
+		BackendID:    s.backend.ID,
+		Path:         key,
+		Size:         manifest.Size,
+		SHA256Hash:   manifest.SHA256,
+		ETag:         info.ETag,
+		VersionID:    info.VersionID,
+		ModifiedAt:   modifiedAt,
+		Deduplicated: true,
+	}
+	if err := s.store.UpsertFile(ctx, record); err != nil {
+		return fmt.Errorf("failed to record metadata of '%s': %w", key, err)
+	}
+
+	if err := s.store.SetFileChunks(ctx, record.ID, chunkIDs); err != nil {
+		return fmt.Errorf("failed to record manifest of '%s': %w", key, err)
+	}
+	return nil
+}
+
+// Open reads the manifest at the key and returns a reader assembling the file content
+func (s *Store) Open(ctx context.Context, key string) (io.ReadCloser, *Manifest, error) {
+	reader, err := s.storage.Get(ctx, key)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer reader.Close()
+
+	manifest, err := ReadManifest(reader)
+	if err != nil {
+		return nil, nil, fmt.Errorf("invalid manifest '%s': %w", key, err)
+	}
+
+	return &assembler{
+		ctx:      ctx,
+		storage:  s.storage,
+		manifest: manifest,
+	}, manifest, nil
+}
+
+// assembler reads all chunks of a manifest in order, verifying each chunk hash
+type assembler struct {
+	ctx      context.Context
+	storage  storage.Storage
+	manifest *Manifest
+	index    int
+	current  *bytes.Reader
+}
+
+func (a *assembler) Read(p []byte) (int, error) {
+	for a.current == nil || a.current.Len() == 0 {
+		if a.index >= len(a.manifest.Chunks) {
+			return 0, io.EOF
+		}
+		if err := a.next(); err != nil {
+			return 0, err
+		}
+	}
+	return a.current.Read(p)
+}
+
+func (a *assembler) next() error {
+	ref := a.manifest.Chunks[a.index]
+	a.index++
+
+	reader, err := a.storage.Get(a.ctx, ChunkKey(ref.Hash))
+	if err != nil {
+		return fmt.Errorf("failed to read chunk '%s': %w", ref.Hash, err)
+	}
+	defer reader.Close()
+
+	data, err := io.ReadAll(io.LimitReader(reader, ref.Size+1))
+	if err != nil {
+		return fmt.Errorf("failed to read chunk '%s': %w", ref.Hash, err)
+	}
+
+	sum := sha256.Sum256(data)
+	if int64(len(data)) != ref.Size || hex.EncodeToString(sum[:]) != ref.Hash {
+		return fmt.Errorf("chunk '%s' is corrupted", ref.Hash)
+	}
+
+	a.current = bytes.NewReader(data)
+	return nil
+}
+
+func (a *assembler) Close() error {
+	return nil
+}
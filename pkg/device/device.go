@@ -0,0 +1,56 @@
+// Package device identifies the devices sharing a metadata store, independent of their hostnames
+package device
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/mwantia/gosync/pkg/db/models"
+)
+
+// MachineID returns the id of this device, derived from the id of its operating system installation, so it stays
+// the same across restarts and renames without revealing the original id. Platforms without such id fall back
+// to the hostname.
+func MachineID() (string, error) {
+	id, err := osMachineID()
+	if err != nil || strings.TrimSpace(id) == "" {
+		if id, err = os.Hostname(); err != nil {
+			return "", fmt.Errorf("failed to determine machine id: %w", err)
+		}
+	}
+
+	sum := sha256.Sum256([]byte("gosync:" + strings.TrimSpace(id)))
+	return hex.EncodeToString(sum[:16]), nil
+}
+
+// Lookup returns the client registered for the machine, or nil if the machine wasn't registered yet
+func Lookup(clients []models.Client, machineID string) *models.Client {
+	for i := range clients {
+		if clients[i].MachineID == machineID {
+			return &clients[i]
+		}
+	}
+	return nil
+}
+
+// ClientID returns the id of the client running on the machine. Registered machines keep their id, while clients
+// registered before machine ids were recorded are claimed by their hostname. New machines are registered with
+// their hostname, which is suffixed with the machine id if another machine already uses it.
+func ClientID(clients []models.Client, machineID, hostname string) string {
+	if client := Lookup(clients, machineID); client != nil {
+		return client.ID
+	}
+
+	for _, client := range clients {
+		if client.ID == hostname {
+			if client.MachineID == "" {
+				return hostname
+			}
+			return hostname + "-" + machineID[:8]
+		}
+	}
+	return hostname
+}
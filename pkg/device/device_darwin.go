@@ -0,0 +1,24 @@
+//go:build darwin
+
+package device
+
+import (
+	"errors"
+	"os/exec"
+	"strings"
+)
+
+// osMachineID reads the hardware UUID of the platform expert device
+func osMachineID() (string, error) {
+	out, err := exec.Command("ioreg", "-rd1", "-c", "IOPlatformExpertDevice").Output()
+	if err != nil {
+		return "", err
+	}
+
+	for _, line := range strings.Split(string(out), "\n") {
+		if _, value, ok := strings.Cut(line, `"IOPlatformUUID" = `); ok {
+			return strings.Trim(strings.TrimSpace(value), `"`), nil
+		}
+	}
+	return "", errors.New("no platform uuid found")
+}
@@ -0,0 +1,18 @@
+//go:build linux
+
+package device
+
+import (
+	"errors"
+	"os"
+)
+
+// osMachineID reads the machine id of systemd, or of D-Bus on systems without systemd
+func osMachineID() (string, error) {
+	for _, name := range []string{"/etc/machine-id", "/var/lib/dbus/machine-id"} {
+		if data, err := os.ReadFile(name); err == nil && len(data) > 0 {
+			return string(data), nil
+		}
+	}
+	return "", errors.New("no machine id found")
+}
@@ -0,0 +1,11 @@
+//go:build !linux && !darwin && !windows
+
+package device
+
+import "os"
+
+// osMachineID reads the host id written by the BSDs during installation
+func osMachineID() (string, error) {
+	data, err := os.ReadFile("/etc/hostid")
+	return string(data), err
+}
@@ -0,0 +1,96 @@
+package engine
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/mwantia/gosync/pkg/db/models"
+)
+
+// changeRateWeight is the weight of the latest pass within the moving average of the change rate
+const changeRateWeight = 0.25
+
+// AdaptiveOptions bounds the polling intervals learned for syncs with an interval
+type AdaptiveOptions struct {
+	Enabled     bool
+	MinInterval time.Duration
+	MaxInterval time.Duration
+}
+
+// Polling is the polling interval learned for a sync on this client. Rates are learned for the whole sync, since
+// its passes always list all of its directories, so hot directories of mostly static syncs are split into syncs
+// of their own to poll the rest less often.
+type Polling struct {
+	Interval time.Duration
+	// ChangeRate is the moving average of the share of scheduled passes that applied changes
+	ChangeRate float64
+}
+
+// Polling returns the polling interval learned for the sync, or a zero interval if the configured interval is used,
+// since adaptive polling is disabled, the sync is scheduled by cron or no scheduled pass completed yet
+func (e *Engine) Polling(ctx context.Context, sc *models.SyncConfig) (Polling, error) {
+	if !e.adaptive.Enabled || sc.Schedule != "" || sc.Interval <= 0 {
+		return Polling{}, nil
+	}
+
+	state, err := loadSyncState(ctx, e.store, sc, e.clientID)
+	if err != nil || state.PollInterval <= 0 {
+		return Polling{}, err
+	}
+	return Polling{
+		Interval:   e.clampInterval(time.Duration(state.PollInterval) * time.Second),
+		ChangeRate: state.ChangeRate,
+	}, nil
+}
+
+// AdaptPolling learns the polling interval of the sync from the result of a complete scheduled pass, starting at
+// the configured interval: a pass that applied changes halves the interval, a pass without changes lengthens it
+// by up to twice, the less the more often previous passes found changes. The interval stays within the bounds.
+func (e *Engine) AdaptPolling(ctx context.Context, sc *models.SyncConfig, result *Result) (Polling, error) {
+	if !e.adaptive.Enabled || sc.Schedule != "" || sc.Interval <= 0 {
+		return Polling{}, nil
+	}
+
+	state, err := loadSyncState(ctx, e.store, sc, e.clientID)
+	if err != nil {
+		return Polling{}, err
+	}
+
+	interval := float64(time.Duration(state.PollInterval) * time.Second)
+	if state.PollInterval <= 0 {
+		interval = float64(time.Duration(sc.Interval) * time.Second)
+	}
+
+	changed := 0.0
+	if result.Uploaded+result.Downloaded+result.Deleted+result.Conflicts > 0 {
+		changed = 1
+	}
+	state.ChangeRate += (changed - state.ChangeRate) * changeRateWeight
+
+	if changed > 0 {
+		interval /= 2
+	} else {
+		interval *= 2 - state.ChangeRate
+	}
+	polling := Polling{
+		Interval:   e.clampInterval(time.Duration(interval).Round(time.Second)),
+		ChangeRate: state.ChangeRate,
+	}
+
+	state.PollInterval = int(polling.Interval / time.Second)
+	if err := saveSyncState(ctx, e.store, state); err != nil {
+		return Polling{}, fmt.Errorf("failed to save polling interval of sync '%s': %w", sc.Name, err)
+	}
+	return polling, nil
+}
+
+func (e *Engine) clampInterval(interval time.Duration) time.Duration {
+	if e.adaptive.MinInterval > 0 {
+		interval = max(interval, e.adaptive.MinInterval)
+	}
+	if e.adaptive.MaxInterval > 0 {
+		interval = min(interval, e.adaptive.MaxInterval)
+	}
+	return interval
+}
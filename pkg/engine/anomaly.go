@@ -0,0 +1,195 @@
+package engine
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"time"
+
+	"github.com/mwantia/gosync/pkg/db/models"
+	"github.com/mwantia/gosync/pkg/db/store"
+	"github.com/mwantia/gosync/pkg/storage"
+)
+
+const (
+	// sameTimeRatio is the share of rewritten files with the same modification time considered anomalous
+	sameTimeRatio = 0.9
+	// entropySamples is the maximum number of rewritten files whose content is compared with the source
+	entropySamples = 16
+	// entropySampleSize is the number of bytes read from the start of each sampled file
+	entropySampleSize = 64 << 10
+	// entropyMinSize skips files too small for a meaningful entropy
+	entropyMinSize = 4 << 10
+	// Sampled files are encrypted if their entropy rose from below entropyLow to above entropyHigh (bits per byte)
+	entropyLow  = 6.5
+	entropyHigh = 7.5
+	// entropyMinSpikes is the number of encrypted samples required, which must also be half of all samples
+	entropyMinSpikes = 4
+)
+
+// ErrPaused is returned for passes of syncs that are paused after an anomaly until it is confirmed
+var ErrPaused = errors.New("sync is paused after an anomaly")
+
+// AnomalyError is returned for passes that weren't applied, since their plan looks like an accidental
+// mass change of the destination, e.g. a wiped or encrypted folder, which would be propagated to the source
+type AnomalyError struct {
+	Reason string
+}
+
+func (e *AnomalyError) Error() string {
+	return "anomalous pass: " + e.Reason
+}
+
+// AnomalyOptions configures the heuristics detecting anomalous passes
+type AnomalyOptions struct {
+	Enabled bool
+	// MaxChangeRatio is the share of synced files a pass may modify or delete in the source (0.5 = 50%)
+	MaxChangeRatio float64
+	// MinFiles is the number of modified or deleted files below which a pass is never anomalous
+	MinFiles int
+	// Entropy samples rewritten files for content turned into random data, as caused by encryption
+	Entropy bool
+}
+
+// Paused returns the anomaly the sync is paused for on this client, or "" if it isn't paused
+func (e *Engine) Paused(ctx context.Context, sc *models.SyncConfig) (string, error) {
+	state, err := loadSyncState(ctx, e.store, sc, e.clientID)
+	if err != nil {
+		return "", err
+	}
+	return state.Anomaly, nil
+}
+
+// ConfirmAnomaly resumes the sync paused after an anomaly on the client, applying its next pass regardless
+// of the heuristics. Returns the confirmed anomaly, or "" if the sync wasn't paused.
+func ConfirmAnomaly(ctx context.Context, ms store.MetadataStore, sc *models.SyncConfig, clientID string) (string, error) {
+	state, err := loadSyncState(ctx, ms, sc, clientID)
+	if err != nil || state.Anomaly == "" {
+		return "", err
+	}
+
+	anomaly := state.Anomaly
+	state.Anomaly = ""
+	state.AnomalyConfirmed = true
+	return anomaly, saveSyncState(ctx, ms, state)
+}
+
+// checkAnomaly returns ErrPaused while the sync is paused and an AnomalyError if the plan is anomalous
+func (e *Engine) checkAnomaly(ctx context.Context, plan *Plan) error {
+	if plan.state != nil && plan.state.Anomaly != "" {
+		return fmt.Errorf("%w: %s", ErrPaused, plan.state.Anomaly)
+	}
+	if !e.anomaly.Enabled || (plan.state != nil && plan.state.AnomalyConfirmed) {
+		return nil
+	}
+
+	if reason := e.detectAnomaly(ctx, plan); reason != "" {
+		return &AnomalyError{Reason: reason}
+	}
+	return nil
+}
+
+// detectAnomaly checks the changes the plan applies to the source, returning the reason if they are anomalous
+func (e *Engine) detectAnomaly(ctx context.Context, plan *Plan) string {
+	var changed int
+	var rewritten []Action
+	for _, action := range plan.Actions {
+		switch {
+		case action.Type == ActionDeleteSource:
+			changed++
+		case action.Type == ActionUpload && action.synced && action.source != nil && action.dest != nil:
+			changed++
+			rewritten = append(rewritten, action)
+		}
+	}
+
+	minFiles := max(e.anomaly.MinFiles, 1)
+	if changed >= minFiles && e.anomaly.MaxChangeRatio > 0 && float64(changed) > e.anomaly.MaxChangeRatio*float64(plan.known) {
+		return fmt.Sprintf("%d of %d synced files were modified or deleted in the destination", changed, plan.known)
+	}
+
+	if len(rewritten) >= minFiles {
+		times := make(map[time.Time]int)
+		for _, action := range rewritten {
+			times[action.dest.LastModified.Truncate(time.Second)]++
+		}
+		for t, count := range times {
+			if float64(count) >= sameTimeRatio*float64(len(rewritten)) {
+				return fmt.Sprintf("%d files were rewritten with the same modification time %s", count, t.Local().Format(time.DateTime))
+			}
+		}
+	}
+
+	if e.anomaly.Entropy {
+		if spikes, samples := e.entropySpikes(ctx, plan, rewritten); spikes >= entropyMinSpikes && spikes*2 >= samples {
+			return fmt.Sprintf("%d of %d sampled files turned into random data, as caused by encryption", spikes, samples)
+		}
+	}
+	return ""
+}
+
+// entropySpikes compares the entropy of evenly spread samples of the rewritten files with their version
+// in the source, returning the number of samples whose content turned into random data
+func (e *Engine) entropySpikes(ctx context.Context, plan *Plan, rewritten []Action) (int, int) {
+	step := max(len(rewritten)/entropySamples, 1)
+
+	spikes, samples := 0, 0
+	for i := 0; i < len(rewritten) && samples < entropySamples; i += step {
+		action := rewritten[i]
+		if action.dest.Size < entropyMinSize || action.source.Size < entropyMinSize {
+			continue
+		}
+
+		before, err := e.sampleEntropy(ctx, plan.source, action.Path, *action.source)
+		if err != nil {
+			continue
+		}
+		after, err := e.sampleEntropy(ctx, plan.dest, action.destPath(), *action.dest)
+		if err != nil {
+			continue
+		}
+
+		samples++
+		if before < entropyLow && after > entropyHigh {
+			spikes++
+		}
+	}
+	return spikes, samples
+}
+
+// sampleEntropy returns the Shannon entropy in bits per byte of the start of the object
+func (e *Engine) sampleEntropy(ctx context.Context, s *side, rel string, stat storage.ObjectInfo) (float64, error) {
+	reader, err := e.open(ctx, s, s.key(rel), &stat)
+	if err != nil {
+		return 0, err
+	}
+	defer reader.Close()
+
+	data, err := io.ReadAll(io.LimitReader(reader, entropySampleSize))
+	if err != nil {
+		return 0, err
+	}
+	return entropy(data), nil
+}
+
+func entropy(data []byte) float64 {
+	if len(data) == 0 {
+		return 0
+	}
+
+	var counts [256]int
+	for _, b := range data {
+		counts[b]++
+	}
+
+	var bits float64
+	for _, count := range counts {
+		if count > 0 {
+			p := float64(count) / float64(len(data))
+			bits -= p * math.Log2(p)
+		}
+	}
+	return bits
+}
@@ -0,0 +1,245 @@
+package engine
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"math/rand/v2"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/mwantia/gosync/pkg/backend"
+	"github.com/mwantia/gosync/pkg/checksum"
+	"github.com/mwantia/gosync/pkg/compress"
+	"github.com/mwantia/gosync/pkg/db/models"
+	"github.com/mwantia/gosync/pkg/db/store"
+	"github.com/mwantia/gosync/pkg/dedup"
+	"github.com/mwantia/gosync/pkg/storage"
+	"github.com/mwantia/gosync/pkg/vfs"
+)
+
+// AuditStatus describes how a file differs from its record
+type AuditStatus string
+
+const (
+	AuditMissing   AuditStatus = "missing"   // Recorded, but doesn't exist
+	AuditCorrupted AuditStatus = "corrupted" // Content doesn't match the recorded hashes
+	AuditDrifted   AuditStatus = "drifted"   // Changed or added without being recorded
+)
+
+// Sides of audited files
+const (
+	AuditSideLocal  = "local"
+	AuditSideRemote = "remote"
+)
+
+// AuditFinding is a single file whose content or existence doesn't match the metadata store
+type AuditFinding struct {
+	Path   string      `json:"path"`
+	Side   string      `json:"side"`
+	Status AuditStatus `json:"status"`
+	Detail string      `json:"detail"`
+}
+
+// AuditReport is the outcome of an audit of one or more roots
+type AuditReport struct {
+	Roots []string `json:"roots"`
+	// Checked is the number of records compared with the objects of the backends
+	Checked int `json:"checked"`
+	// Hashed is the number of local files and downloaded objects whose content was hashed
+	Hashed int   `json:"hashed"`
+	Bytes  int64 `json:"bytes"`
+	// Unverified is the number of local files without recorded hashes to compare with
+	Unverified int            `json:"unverified"`
+	Findings   []AuditFinding `json:"findings"`
+}
+
+// AuditOptions configures the audit of remote roots
+type AuditOptions struct {
+	// Samples is the number of randomly chosen objects downloaded to verify their content (0 = none)
+	Samples int
+	// MaxFileSize excludes larger objects from the sample (0 = unlimited)
+	MaxFileSize int64
+}
+
+func (r *AuditReport) add(p, side string, status AuditStatus, format string, args ...any) {
+	r.Findings = append(r.Findings, AuditFinding{Path: p, Side: side, Status: status, Detail: fmt.Sprintf(format, args...)})
+}
+
+// Sort orders the findings by path and side
+func (r *AuditReport) Sort() {
+	sort.SliceStable(r.Findings, func(i, j int) bool {
+		if r.Findings[i].Path != r.Findings[j].Path {
+			return r.Findings[i].Path < r.Findings[j].Path
+		}
+		return r.Findings[i].Side < r.Findings[j].Side
+	})
+}
+
+// AuditRemote compares the records below the prefix with the objects listed from the backend and downloads
+// a random sample of the matching objects to compare their content with the recorded hashes.
+func AuditRemote(ctx context.Context, ms store.MetadataStore, st storage.Storage, b *models.Backend, prefix string, opts AuditOptions, report *AuditReport) error {
+	if prefix != "" {
+		prefix = strings.TrimSuffix(prefix, "/") + "/"
+	}
+	report.Roots = append(report.Roots, path.Join(b.ID, prefix))
+
+	trash := backend.NewTrash(ms, st, b)
+	internal := func(key string) bool {
+		return backend.IsInternalKey(trash, key)
+	}
+
+	objects := make(map[string]storage.ObjectInfo)
+	err := st.List(ctx, prefix, func(object storage.ObjectInfo) error {
+		if !internal(object.Key) && !strings.HasSuffix(object.Key, "/") {
+			objects[object.Key] = object
+		}
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("failed to list '%s': %w", path.Join(b.ID, prefix), err)
+	}
+
+	sample := make([]models.File, 0, opts.Samples)
+	seen := 0
+	err = ms.IterateFiles(ctx, b.ID, prefix, func(file *models.File) error {
+		if internal(file.Path) {
+			return nil
+		}
+		report.Checked++
+
+		object, ok := objects[file.Path]
+		delete(objects, file.Path)
+		if !ok {
+			report.add(path.Join(b.ID, file.Path), AuditSideRemote, AuditMissing, "recorded object doesn't exist")
+			return nil
+		}
+		if file.ETag != "" && object.ETag != file.ETag {
+			report.add(path.Join(b.ID, file.Path), AuditSideRemote, AuditDrifted, "etag is %s instead of %s", object.ETag, file.ETag)
+			return nil
+		}
+
+		// Matching objects with recorded hashes are sampled, so every object has the same chance
+		if opts.Samples <= 0 || (file.SHA256Hash == "" && file.MD5Hash == "") || (opts.MaxFileSize > 0 && file.Size > opts.MaxFileSize) {
+			return nil
+		}
+		seen++
+		if len(sample) < opts.Samples {
+			sample = append(sample, *file)
+		} else if i := rand.IntN(seen); i < opts.Samples {
+			sample[i] = *file
+		}
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("failed to read records below '%s': %w", path.Join(b.ID, prefix), err)
+	}
+
+	for key := range objects {
+		report.add(path.Join(b.ID, key), AuditSideRemote, AuditDrifted, "object isn't recorded")
+	}
+
+	chunks := dedup.NewStore(ms, st, b)
+	for i := range sample {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+
+		file := &sample[i]
+		var reader io.ReadCloser
+		if file.Deduplicated {
+			reader, _, err = chunks.Open(ctx, file.Path)
+		} else if reader, err = st.Get(ctx, file.Path); err == nil && file.Compression != "" {
+			reader, err = compress.Decompress(reader, file.Compression)
+		}
+		if err != nil {
+			report.add(path.Join(b.ID, file.Path), AuditSideRemote, AuditMissing, "failed to download: %v", err)
+			continue
+		}
+		sums, err := checksum.Reader(reader)
+		reader.Close()
+		if err != nil {
+			return fmt.Errorf("failed to download '%s': %w", path.Join(b.ID, file.Path), err)
+		}
+
+		report.Hashed++
+		report.Bytes += sums.Size
+		if detail := compareSums(file, sums); detail != "" {
+			report.add(path.Join(b.ID, file.Path), AuditSideRemote, AuditCorrupted, "%s", detail)
+		}
+	}
+	return nil
+}
+
+// AuditLocal re-hashes the local files of the sync that were synced by the client and compares them with the
+// hashes recorded for their source. Files whose source changed since they were synced are skipped, since their
+// next pass updates them. Mismatching files modified after they were synced are drifted, others are corrupted.
+func AuditLocal(ctx context.Context, ms store.MetadataStore, sc *models.SyncConfig, clientID string, report *AuditReport) error {
+	source, dest := ResolvePaths(sc, clientID)
+	dest, template := SplitPathTemplate(dest)
+	if !IsLocalPath(dest) || template != "" {
+		return nil
+	}
+	report.Roots = append(report.Roots, dest)
+
+	src := vfs.ParsePath(source)
+	baselines, err := ms.ListSyncBaselines(ctx, sc.ID, clientID)
+	if err != nil {
+		return fmt.Errorf("failed to read baselines of sync '%s': %w", sc.Name, err)
+	}
+
+	for _, baseline := range baselines {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+
+		local := filepath.Join(dest, filepath.FromSlash(baseline.Path))
+		info, err := os.Stat(local)
+		if errors.Is(err, os.ErrNotExist) {
+			report.add(local, AuditSideLocal, AuditMissing, "synced file doesn't exist")
+			continue
+		}
+		if err != nil {
+			return fmt.Errorf("failed to stat '%s': %w", local, err)
+		}
+
+		record, err := ms.GetFile(ctx, src.Backend, path.Join(src.Key, baseline.Path))
+		if err != nil || (record.SHA256Hash == "" && record.MD5Hash == "") || record.ETag != baseline.SourceETag {
+			report.Unverified++
+			continue
+		}
+
+		sums, err := checksum.File(local)
+		if err != nil {
+			return err
+		}
+		report.Hashed++
+		report.Bytes += sums.Size
+
+		if detail := compareSums(record, sums); detail != "" {
+			if info.ModTime().After(baseline.SyncedAt) {
+				report.add(local, AuditSideLocal, AuditDrifted, "modified since it was synced, %s", detail)
+			} else {
+				report.add(local, AuditSideLocal, AuditCorrupted, "%s", detail)
+			}
+		}
+	}
+	return nil
+}
+
+// compareSums describes the first difference between the recorded and computed checksums, empty if they match
+func compareSums(file *models.File, sums checksum.Sums) string {
+	switch {
+	case sums.Size != file.Size:
+		return fmt.Sprintf("size is %d instead of %d", sums.Size, file.Size)
+	case file.SHA256Hash != "" && !strings.EqualFold(sums.SHA256, file.SHA256Hash):
+		return fmt.Sprintf("sha256 is %s instead of %s", sums.SHA256, file.SHA256Hash)
+	case file.MD5Hash != "" && !strings.EqualFold(sums.MD5, file.MD5Hash):
+		return fmt.Sprintf("md5 is %s instead of %s", sums.MD5, file.MD5Hash)
+	}
+	return ""
+}
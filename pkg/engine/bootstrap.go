@@ -0,0 +1,33 @@
+package engine
+
+import (
+	"context"
+
+	"github.com/mwantia/gosync/pkg/db/models"
+	"github.com/mwantia/gosync/pkg/db/store"
+	"github.com/mwantia/gosync/pkg/storage"
+)
+
+// SetBootstrap enables or disables the bootstrap mode of the sync on the client. While bootstrapping,
+// passes only download from the source and never upload or delete anything, so the empty folder of a
+// replaced machine isn't mistaken for the deletion of all files. The mode ends after the first pass
+// that applied all of its actions.
+func SetBootstrap(ctx context.Context, ms store.MetadataStore, sc *models.SyncConfig, clientID string, enabled bool) error {
+	state, err := loadSyncState(ctx, ms, sc, clientID)
+	if err != nil {
+		return err
+	}
+
+	state.Bootstrap = enabled
+	return saveSyncState(ctx, ms, state)
+}
+
+// decideBootstrap decides like a download sync in which the source always wins, but keeps all objects
+// that only exist in the destination, regardless of their baseline
+func decideBootstrap(mode, rel string, s, d *storage.ObjectInfo, b *models.SyncBaseline) (Action, bool) {
+	action, ok := decide(mode, DirectionDownload, rel, s, d, b)
+	if ok && action.Type == ActionDeleteDest {
+		return action, false
+	}
+	return action, ok
+}
@@ -0,0 +1,239 @@
+package engine
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+
+	"github.com/mwantia/gosync/pkg/backend"
+	"github.com/mwantia/gosync/pkg/checksum"
+	"github.com/mwantia/gosync/pkg/compress"
+	"github.com/mwantia/gosync/pkg/db/models"
+	"github.com/mwantia/gosync/pkg/db/store"
+	"github.com/mwantia/gosync/pkg/dedup"
+	"github.com/mwantia/gosync/pkg/publish"
+	"github.com/mwantia/gosync/pkg/storage"
+)
+
+// CompareStatus describes how a file differs between two trees
+type CompareStatus string
+
+const (
+	CompareMissing   CompareStatus = "missing"   // Only exists within the first tree
+	CompareExtra     CompareStatus = "extra"     // Only exists within the second tree
+	CompareDifferent CompareStatus = "different" // Exists within both trees with a different size or content
+)
+
+// CompareTree is one side of a comparison: the objects of a storage below a prefix, or the files of a manifest
+type CompareTree struct {
+	// Name of the tree within the report, e.g. the path it was opened from
+	Name    string
+	Storage storage.Storage
+	// Prefix of the compared objects, either empty or ending with "/"
+	Prefix string
+	// Backend of the storage, which is nil for local directories
+	Backend *models.Backend
+	// Manifest replaces the storage with the files and hashes of a published manifest
+	Manifest *publish.Manifest
+}
+
+// CompareOptions configures how files found within both trees are compared
+type CompareOptions struct {
+	// SizeOnly skips hashing files of the same size
+	SizeOnly bool
+	// Rehash reads the content of all files instead of using recorded and cached hashes
+	Rehash bool
+}
+
+// CompareFinding is a single file that differs between both trees
+type CompareFinding struct {
+	Path   string        `json:"path"`
+	Status CompareStatus `json:"status"`
+	Detail string        `json:"detail,omitempty"`
+}
+
+// CompareReport is the outcome of the comparison of two trees
+type CompareReport struct {
+	A string `json:"a"`
+	B string `json:"b"`
+	// Compared is the number of files found within both trees
+	Compared int `json:"compared"`
+	// Hashed is the number of objects of backends downloaded to hash their content
+	Hashed   int              `json:"hashed"`
+	Bytes    int64            `json:"bytes"`
+	Findings []CompareFinding `json:"findings"`
+}
+
+// compareEntry is a single file of a tree
+type compareEntry struct {
+	key    string
+	size   int64
+	sha256 string
+	record *models.File
+}
+
+// Compare diffs both trees by relative path, reporting files missing from either tree and files whose size or
+// SHA256 differ. Hashes recorded for unchanged objects of backends and cached for unchanged local files are used
+// unless opts.Rehash is set, all other files are read entirely.
+func Compare(ctx context.Context, ms store.MetadataStore, a, b *CompareTree, opts CompareOptions) (*CompareReport, error) {
+	report := &CompareReport{A: a.Name, B: b.Name, Findings: []CompareFinding{}}
+
+	entriesA, err := compareEntries(ctx, ms, a)
+	if err != nil {
+		return nil, err
+	}
+	entriesB, err := compareEntries(ctx, ms, b)
+	if err != nil {
+		return nil, err
+	}
+
+	paths := make([]string, 0, len(entriesA)+len(entriesB))
+	for rel := range entriesA {
+		paths = append(paths, rel)
+	}
+	for rel := range entriesB {
+		if _, ok := entriesA[rel]; !ok {
+			paths = append(paths, rel)
+		}
+	}
+	sort.Strings(paths)
+
+	hashes := checksum.NewCache(ms)
+	for _, rel := range paths {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+
+		ea, okA := entriesA[rel]
+		eb, okB := entriesB[rel]
+		switch {
+		case !okB:
+			report.add(rel, CompareMissing, "only exists within %s", a.Name)
+			continue
+		case !okA:
+			report.add(rel, CompareExtra, "only exists within %s", b.Name)
+			continue
+		}
+
+		report.Compared++
+		if ea.size != eb.size {
+			report.add(rel, CompareDifferent, "size is %d instead of %d", eb.size, ea.size)
+			continue
+		}
+		if opts.SizeOnly {
+			continue
+		}
+
+		hashA, err := report.hash(ctx, ms, hashes, a, ea, opts.Rehash)
+		if err != nil {
+			return nil, fmt.Errorf("failed to hash '%s' of %s: %w", rel, a.Name, err)
+		}
+		hashB, err := report.hash(ctx, ms, hashes, b, eb, opts.Rehash)
+		if err != nil {
+			return nil, fmt.Errorf("failed to hash '%s' of %s: %w", rel, b.Name, err)
+		}
+		if hashA != hashB {
+			report.add(rel, CompareDifferent, "sha256 is %s instead of %s", hashB, hashA)
+		}
+	}
+	return report, nil
+}
+
+func (r *CompareReport) add(p string, status CompareStatus, format string, args ...any) {
+	r.Findings = append(r.Findings, CompareFinding{Path: p, Status: status, Detail: fmt.Sprintf(format, args...)})
+}
+
+// compareEntries returns all files of the tree by relative path. Objects of backends are matched with their records,
+// so deduplicated and compressed files are compared by the size of their content instead of their stored objects.
+func compareEntries(ctx context.Context, ms store.MetadataStore, t *CompareTree) (map[string]*compareEntry, error) {
+	entries := make(map[string]*compareEntry)
+	if t.Manifest != nil {
+		for _, file := range t.Manifest.Files {
+			entries[file.Path] = &compareEntry{key: file.Path, size: file.Size, sha256: file.SHA256}
+		}
+		return entries, nil
+	}
+
+	internal := publish.IsManifestKey
+	records := make(map[string]*models.File)
+	if t.Backend != nil {
+		trash := backend.NewTrash(ms, t.Storage, t.Backend)
+		internal = func(key string) bool {
+			return backend.IsInternalKey(trash, key)
+		}
+
+		err := ms.IterateFiles(ctx, t.Backend.ID, t.Prefix, func(file *models.File) error {
+			records[file.Path] = file
+			return nil
+		})
+		if err != nil {
+			return nil, fmt.Errorf("failed to read records of %s: %w", t.Name, err)
+		}
+	}
+
+	err := t.Storage.List(ctx, t.Prefix, func(object storage.ObjectInfo) error {
+		rel := strings.TrimPrefix(object.Key, t.Prefix)
+		if rel == "" || strings.HasSuffix(rel, "/") || internal(object.Key) {
+			return nil
+		}
+
+		entry := &compareEntry{key: object.Key, size: object.Size}
+		if record, ok := records[object.Key]; ok && record.ETag == object.ETag {
+			entry.record = record
+			if record.Deduplicated || record.Compression != "" {
+				entry.size = record.Size
+			}
+		}
+		entries[rel] = entry
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to list %s: %w", t.Name, err)
+	}
+	return entries, nil
+}
+
+// hash returns the SHA256 of the content of the file
+func (r *CompareReport) hash(ctx context.Context, ms store.MetadataStore, hashes *checksum.Cache, t *CompareTree, entry *compareEntry, rehash bool) (string, error) {
+	if entry.sha256 != "" {
+		return entry.sha256, nil
+	}
+
+	if local, ok := t.Storage.(*storage.LocalStorage); ok {
+		name, err := local.Path(entry.key)
+		if err != nil {
+			return "", err
+		}
+		sums, err := hashes.File(ctx, name, rehash)
+		if err != nil {
+			return "", err
+		}
+		return sums.SHA256, nil
+	}
+
+	if entry.record != nil && entry.record.SHA256Hash != "" && !rehash {
+		return entry.record.SHA256Hash, nil
+	}
+
+	var reader io.ReadCloser
+	var err error
+	if entry.record != nil && entry.record.Deduplicated {
+		reader, _, err = dedup.NewStore(ms, t.Storage, t.Backend).Open(ctx, entry.key)
+	} else if reader, err = t.Storage.Get(ctx, entry.key); err == nil && entry.record != nil && entry.record.Compression != "" {
+		reader, err = compress.Decompress(reader, entry.record.Compression)
+	}
+	if err != nil {
+		return "", err
+	}
+	defer reader.Close()
+
+	sums, err := checksum.Reader(reader)
+	if err != nil {
+		return "", err
+	}
+	r.Hashed++
+	r.Bytes += sums.Size
+	return sums.SHA256, nil
+}
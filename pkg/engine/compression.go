@@ -0,0 +1,84 @@
+package engine
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/mwantia/gosync/pkg/compress"
+	"github.com/mwantia/gosync/pkg/db/models"
+	"github.com/mwantia/gosync/pkg/storage"
+)
+
+// ValidCompression returns an error unless the compression and the compression rules of the sync are supported
+func ValidCompression(sc *models.SyncConfig) error {
+	_, err := compress.ParsePolicy(sc.Compression, sc.CompressionRules)
+	return err
+}
+
+// compression returns the algorithm the file uploaded to the key of the side is compressed by, or "" if it's stored
+// uncompressed. Only files of backends are compressed, while deduplicated files are stored as uncompressed chunks.
+func (p *Plan) compression(to *side, key string) string {
+	if to.backend == nil || p.Config.Dedup || p.compress == nil {
+		return ""
+	}
+	return p.compress.Algorithm(key)
+}
+
+// compressedFile returns the record of the object if its current version is stored compressed, or nil otherwise.
+// The object is only stat'ed if no stat is given and its record is compressed.
+func (e *Engine) compressedFile(ctx context.Context, s *side, key string, stat *storage.ObjectInfo) *models.File {
+	if s.backend == nil {
+		return nil
+	}
+	record, err := e.store.GetFile(ctx, s.backend.ID, key)
+	if err != nil || record.Compression == "" {
+		return nil
+	}
+	if stat == nil {
+		if stat, err = s.storage.Stat(ctx, key); err != nil {
+			return nil
+		}
+	}
+	if record.ETag != stat.ETag {
+		return nil
+	}
+	return record
+}
+
+// decompress returns the content of the object read by the reader, decompressing objects stored compressed.
+// The stat is updated with the size of the actual content.
+func (e *Engine) decompress(ctx context.Context, s *side, key string, stat *storage.ObjectInfo, reader io.ReadCloser) (io.ReadCloser, error) {
+	record := e.compressedFile(ctx, s, key, stat)
+	if record == nil {
+		return reader, nil
+	}
+	stat.Size = record.Size
+	return compress.Decompress(reader, record.Compression)
+}
+
+// substituteCompressed replaces the sizes of compressed objects of a backend by the size of their content, which
+// the records of their current versions describe. Objects are compared like uncompressed ones that way, even after
+// the compression of the sync changed.
+func (e *Engine) substituteCompressed(ctx context.Context, s *side, objects map[string]storage.ObjectInfo) error {
+	if s.backend == nil || len(objects) == 0 {
+		return nil
+	}
+
+	err := e.store.IterateFiles(ctx, s.backend.ID, s.prefix, func(file *models.File) error {
+		if file.Compression == "" {
+			return nil
+		}
+		rel := storage.NormalizePath(s.normalization, strings.TrimPrefix(file.Path, s.prefix))
+		if object, ok := objects[rel]; ok && object.ETag == file.ETag {
+			object.Size = file.Size
+			objects[rel] = object
+		}
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("failed to read records below '%s': %w", s.prefix, err)
+	}
+	return nil
+}
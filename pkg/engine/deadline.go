@@ -0,0 +1,47 @@
+package engine
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/mwantia/gosync/pkg/db/models"
+	"github.com/mwantia/gosync/pkg/schedule"
+)
+
+// ErrDeadline is returned for passes that stopped at the deadline of their sync before applying all actions.
+// The baselines of all applied actions are kept, so the next pass continues with the remaining actions.
+var ErrDeadline = errors.New("pass deadline reached")
+
+// Deadlines returns the soft deadline of a pass started at t, after which no further transfers are started,
+// and the hard deadline cancelling in-flight transfers. Both are zero if the sync doesn't define them.
+func Deadlines(sc *models.SyncConfig, t time.Time) (time.Time, time.Time) {
+	var soft time.Time
+	if sc.MaxDuration > 0 {
+		soft = t.Add(time.Duration(sc.MaxDuration) * time.Second)
+	}
+	if sc.StopAt != "" {
+		// Invalid times are rejected when the sync is created
+		if at, err := schedule.NextClock(sc.StopAt, t.Local()); err == nil && (soft.IsZero() || at.Before(soft)) {
+			soft = at
+		}
+	}
+
+	if soft.IsZero() || sc.DeadlineGrace <= 0 {
+		return soft, time.Time{}
+	}
+	return soft, soft.Add(time.Duration(sc.DeadlineGrace) * time.Second)
+}
+
+// withDeadline applies the hard deadline of the pass to the context, which is cancelled with ErrDeadline as cause
+func (e *Engine) withDeadline(ctx context.Context, p *pass) (context.Context, context.CancelFunc) {
+	if p.hardDeadline.IsZero() {
+		return context.WithCancel(ctx)
+	}
+	return context.WithDeadlineCause(ctx, p.hardDeadline, ErrDeadline)
+}
+
+// expired returns true once the soft deadline of the pass has passed
+func (p *pass) expired(now time.Time) bool {
+	return !p.progress.Deadline.IsZero() && !now.Before(p.progress.Deadline)
+}
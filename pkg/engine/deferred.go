@@ -0,0 +1,150 @@
+package engine
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/mwantia/gosync/pkg/db/models"
+)
+
+// Sides of a pending deletion
+const (
+	SideSource = "source"
+	SideDest   = "dest"
+)
+
+// deletionSide returns the side the action deletes from, if it is a deletion
+func deletionSide(t ActionType) (string, bool) {
+	switch t {
+	case ActionDeleteSource:
+		return SideSource, true
+	case ActionDeleteDest:
+		return SideDest, true
+	}
+	return "", false
+}
+
+// PendingDeletions returns the deletions of all syncs of this client that are waiting for their grace period
+func (e *Engine) PendingDeletions(ctx context.Context) ([]models.PendingDeletion, error) {
+	return e.store.ListPendingDeletions(ctx, e.clientID)
+}
+
+func (e *Engine) pendingDeletions(ctx context.Context, syncConfigID uint) (map[string]models.PendingDeletion, error) {
+	all, err := e.store.ListPendingDeletions(ctx, e.clientID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list pending deletions: %w", err)
+	}
+
+	pending := make(map[string]models.PendingDeletion)
+	for _, p := range all {
+		if p.SyncConfigID == syncConfigID {
+			pending[p.Path] = p
+		}
+	}
+	return pending, nil
+}
+
+// annotateDeletions adds the end of the grace period to the reason of all deletions of the plan
+func (e *Engine) annotateDeletions(ctx context.Context, plan *Plan) error {
+	if plan.Config.DeleteGrace <= 0 {
+		return nil
+	}
+
+	pending, err := e.pendingDeletions(ctx, plan.Config.ID)
+	if err != nil {
+		return err
+	}
+
+	now := time.Now()
+	for i := range plan.Actions {
+		action := &plan.Actions[i]
+		side, ok := deletionSide(action.Type)
+		if !ok {
+			continue
+		}
+
+		due := now.Add(time.Duration(plan.Config.DeleteGrace) * time.Second)
+		if p, ok := pending[action.Path]; ok && p.Side == side {
+			due = p.DueAt
+		}
+		if now.Before(due) {
+			action.Reason += fmt.Sprintf(", deferred until %s", due.Local().Format(time.DateTime))
+		}
+	}
+	return nil
+}
+
+// deferDeletions removes all deletions from the plan whose grace period hasn't passed yet and records them
+// as pending. Pending deletions of paths within the scope of the plan that aren't deleted anymore,
+// e.g. restored files, are dropped.
+// Returns the number of deferred deletions.
+func (e *Engine) deferDeletions(ctx context.Context, plan *Plan) (int, error) {
+	if plan.Config.DeleteGrace <= 0 {
+		return 0, nil
+	}
+
+	pending, err := e.pendingDeletions(ctx, plan.Config.ID)
+	if err != nil {
+		return 0, err
+	}
+
+	now := time.Now().UTC()
+	grace := time.Duration(plan.Config.DeleteGrace) * time.Second
+
+	deferred := 0
+	deleted := make(map[string]bool)
+	actions := make([]Action, 0, len(plan.Actions))
+
+	for _, action := range plan.Actions {
+		side, ok := deletionSide(action.Type)
+		if !ok {
+			actions = append(actions, action)
+			continue
+		}
+		deleted[action.Path] = true
+
+		p, ok := pending[action.Path]
+		if ok && p.Side == side {
+			if !now.Before(p.DueAt) {
+				actions = append(actions, action)
+				continue
+			}
+		} else {
+			err := e.store.SavePendingDeletion(ctx, &models.PendingDeletion{
+				SyncConfigID: plan.Config.ID,
+				ClientID:     e.clientID,
+				Path:         action.Path,
+				Side:         side,
+				DetectedAt:   now,
+				DueAt:        now.Add(grace),
+			})
+			if err != nil {
+				return 0, fmt.Errorf("failed to record pending deletion of '%s': %w", action.Path, err)
+			}
+		}
+		deferred++
+	}
+
+	for path := range pending {
+		if deleted[path] || !withinDir(path, plan.Scope) {
+			continue
+		}
+		if err := e.store.DeletePendingDeletion(ctx, plan.Config.ID, e.clientID, path); err != nil {
+			return 0, fmt.Errorf("failed to drop pending deletion of '%s': %w", path, err)
+		}
+	}
+
+	plan.Actions = actions
+	return deferred, nil
+}
+
+// forgetPath removes the baseline and pending deletion of a deleted path
+func (e *Engine) forgetPath(ctx context.Context, plan *Plan, path string) error {
+	if plan.Config.DeleteGrace > 0 {
+		if err := e.store.DeletePendingDeletion(ctx, plan.Config.ID, e.clientID, path); err != nil {
+			return err
+		}
+	}
+	return e.store.DeleteSyncBaseline(ctx, plan.Config.ID, e.clientID, path)
+}
@@ -0,0 +1,101 @@
+package engine
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/mwantia/gosync/pkg/storage"
+)
+
+// running is a dispatched action together with its own context, so it can be cancelled like any other transfer
+type running struct {
+	item      *queuedAction
+	ctx       context.Context
+	cancel    context.CancelCauseFunc
+	t         *transfer
+	startedAt time.Time
+	err       error
+}
+
+// batched returns true if the action deletes an object of a backend, whose deletions are applied in batches
+func (plan *Plan) batched(action Action) bool {
+	if action.Type != ActionDeleteSource && action.Type != ActionDeleteDest {
+		return false
+	}
+	s, _ := plan.written(action)
+	return s != nil && s.backend != nil
+}
+
+// applyDeletions applies deletions from the same side of a backend by batch delete calls instead of one request
+// per object. Each deletion keeps its own lease and context, so deletions cancelled before the call are skipped.
+func (e *Engine) applyDeletions(ctx context.Context, plan *Plan, batch []*running) {
+	fail := func(err error) {
+		for _, r := range batch {
+			r.err = err
+		}
+	}
+	if err := e.pool.Acquire(ctx, plan.Config.ID, plan.Config.Weight); err != nil {
+		fail(err)
+		return
+	}
+	defer e.pool.Release(plan.Config.ID)
+
+	if err := e.limiter.AcquireFiles(ctx, 1); err != nil {
+		fail(err)
+		return
+	}
+	defer e.limiter.ReleaseFiles(1)
+
+	actions := make([]Action, len(batch))
+	for i, r := range batch {
+		actions[i] = r.item.action
+	}
+	s, _ := plan.written(actions[0])
+
+	errs := e.leasedAll(ctx, plan, actions, func(ctx context.Context, errs []error) {
+		keys := make([]string, 0, len(batch))
+		index := make(map[string]int, len(batch))
+		for i, r := range batch {
+			if errs[i] != nil {
+				continue
+			}
+			if r.ctx.Err() != nil {
+				errs[i] = context.Cause(r.ctx)
+				continue
+			}
+			_, rel := plan.written(r.item.action)
+			key := s.key(rel)
+			keys = append(keys, key)
+			index[key] = i
+		}
+		if len(keys) == 0 {
+			return
+		}
+
+		failed, err := s.trash.Remove(ctx, keys)
+		if err != nil {
+			for _, i := range index {
+				errs[i] = err
+			}
+			return
+		}
+		for _, f := range failed {
+			if !errors.Is(f.Err, storage.ErrObjectNotFound) {
+				errs[index[f.Key]] = f
+			}
+		}
+		for key, i := range index {
+			if errs[i] != nil {
+				continue
+			}
+			r := batch[i]
+			if errs[i] = e.forgetFile(r.ctx, s, key); errs[i] == nil {
+				errs[i] = e.forgetPath(r.ctx, plan, r.item.action.Path)
+			}
+		}
+	})
+	for i, r := range batch {
+		r.err = errs[i]
+	}
+}
@@ -0,0 +1,82 @@
+package engine
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	config "github.com/mwantia/gosync/internal/config/server"
+	"github.com/mwantia/gosync/pkg/db/models"
+	"github.com/mwantia/gosync/pkg/db/store"
+	"github.com/mwantia/gosync/pkg/storage"
+)
+
+func TestCancelledDeletionKeepsObject(t *testing.T) {
+	ctx := context.Background()
+
+	ms, err := store.Open(ctx, config.MetadataServerConfig{
+		Type:   "sqlite",
+		SQLite: config.MetadataSQLiteConfig{Path: filepath.Join(t.TempDir(), "gosync.db")},
+	}, false)
+	if err != nil {
+		t.Fatalf("failed to open store: %v", err)
+	}
+	t.Cleanup(func() { ms.Close() })
+
+	remote, local := t.TempDir(), t.TempDir()
+	if err := ms.CreateBackend(ctx, &models.Backend{ID: "local", Name: "local", Type: storage.TypeLocal, Endpoint: remote}); err != nil {
+		t.Fatalf("failed to create backend: %v", err)
+	}
+	for _, name := range []string{"kept.txt", "deleted-1.txt", "deleted-2.txt"} {
+		if err := os.WriteFile(filepath.Join(local, name), []byte(name), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	sc := &models.SyncConfig{Name: "docs", SourcePath: "local/docs", DestPath: local, Direction: DirectionBidirectional, Enabled: true, Workers: 1}
+	if err := ms.CreateSyncConfig(ctx, sc); err != nil {
+		t.Fatalf("failed to create sync: %v", err)
+	}
+	e := New(ms, Options{ClientID: "client"})
+	if _, err := e.Run(ctx, sc); err != nil {
+		t.Fatalf("failed to run initial pass: %v", err)
+	}
+
+	for _, name := range []string{"kept.txt", "deleted-1.txt", "deleted-2.txt"} {
+		if err := os.Remove(filepath.Join(local, name)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	plan, err := e.Plan(ctx, sc)
+	if err != nil {
+		t.Fatalf("failed to plan: %v", err)
+	}
+	if len(plan.Actions) != 3 {
+		t.Fatalf("expected 3 deletions, got %+v", plan.Actions)
+	}
+
+	// The deletion is cancelled while it's queued, before any worker dispatched the batch of deletions
+	p := e.begin(sc)
+	defer e.end(p)
+	e.planned(p, plan)
+	queue := e.newQueue(plan, plan.Actions)
+	e.setQueue(p, queue)
+	if _, err := e.CancelTransfers(CancelOptions{Path: "kept.txt"}); err != nil {
+		t.Fatalf("failed to cancel deletion: %v", err)
+	}
+	result := &Result{}
+	e.runActions(ctx, plan, p, queue, result, false)
+
+	if result.Deleted != 2 || len(result.Errors) != 0 {
+		t.Fatalf("expected 2 deletions without errors, got %d and %v", result.Deleted, result.Errors)
+	}
+	if _, err := os.Stat(filepath.Join(remote, "docs", "kept.txt")); err != nil {
+		t.Errorf("cancelled deletion removed its object: %v", err)
+	}
+	for _, name := range []string{"deleted-1.txt", "deleted-2.txt"} {
+		if _, err := os.Stat(filepath.Join(remote, "docs", name)); !os.IsNotExist(err) {
+			t.Errorf("expected '%s' to be deleted, got %v", name, err)
+		}
+	}
+}
@@ -0,0 +1,131 @@
+package engine
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+
+	"github.com/mwantia/gosync/pkg/db/models"
+	"github.com/mwantia/gosync/pkg/storage"
+)
+
+// defaultBlockSize is used for delta transfers if the sync has no chunk size configured
+const defaultBlockSize = 5 << 20
+
+func useDelta(sc *models.SyncConfig, size int64) bool {
+	return sc.DeltaThreshold > 0 && size >= sc.DeltaThreshold
+}
+
+func blockSize(sc *models.SyncConfig) int64 {
+	if sc.ChunkSize > 0 {
+		return sc.ChunkSize
+	}
+	return defaultBlockSize
+}
+
+// transferDelta uploads only the blocks that changed since the signatures of the current object were
+// recorded, falling back to a full upload if the target doesn't support delta uploads. Delta uploads
+// interrupted by a shutdown are resumed by the next pass, which only uploads the missing blocks.
+func (e *Engine) transferDelta(ctx context.Context, plan *Plan, to *side, key string, src io.ReaderAt, stat *storage.ObjectInfo) (*storage.ObjectInfo, error) {
+	size := blockSize(plan.Config)
+
+	blocks, err := signatures(src, stat.Size, size)
+	if err != nil {
+		return nil, fmt.Errorf("failed to compute block signatures of '%s': %w", stat.Key, err)
+	}
+
+	opts := storage.PutOptions{
+		ContentType: stat.ContentType,
+	}
+
+	var info *storage.ObjectInfo
+	if delta, ok := to.storage.(storage.DeltaStorage); ok {
+		reuse, etag := e.reusableBlocks(ctx, to, key, blocks)
+		opts.IfMatch = etag
+		opts.Resume = true
+		info, err = delta.PutDelta(ctx, key, src, stat.Size, size, reuse, opts)
+
+		// The object may have changed in the meantime or the backend lacks support
+		if errors.Is(err, storage.ErrNotSupported) || errors.Is(err, storage.ErrPreconditionFailed) {
+			info, err = nil, nil
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to write delta of '%s': %w", key, err)
+		}
+		opts.IfMatch = ""
+		opts.Resume = false
+	}
+
+	if info == nil {
+		info, err = to.storage.Put(ctx, key, io.NewSectionReader(src, 0, stat.Size), stat.Size, opts)
+		if err != nil {
+			return nil, fmt.Errorf("failed to write '%s': %w", key, err)
+		}
+	}
+
+	for i := range blocks {
+		blocks[i].BackendID = to.backend.ID
+		blocks[i].Path = key
+		blocks[i].ETag = info.ETag
+	}
+	if err := e.store.ReplaceFileBlocks(ctx, to.backend.ID, key, blocks); err != nil {
+		return nil, fmt.Errorf("failed to record block signatures of '%s': %w", key, err)
+	}
+
+	return info, e.recordFile(ctx, to, info)
+}
+
+// reusableBlocks compares the blocks with the recorded signatures of the current object.
+// Returns the etag of the current object if at least one block can be reused.
+func (e *Engine) reusableBlocks(ctx context.Context, to *side, key string, blocks []models.FileBlock) ([]bool, string) {
+	prior, err := e.store.ListFileBlocks(ctx, to.backend.ID, key)
+	if err != nil || len(prior) == 0 {
+		return nil, ""
+	}
+
+	// Signatures are only valid for the object they were computed for
+	current, err := to.storage.Stat(ctx, key)
+	if err != nil || current.ETag != prior[0].ETag {
+		return nil, ""
+	}
+
+	reuse := make([]bool, len(blocks))
+	reused := false
+	for i, block := range blocks {
+		if i < len(prior) && prior[i].Offset == block.Offset && prior[i].Size == block.Size && prior[i].Hash == block.Hash {
+			reuse[i], reused = true, true
+		}
+	}
+
+	if !reused {
+		return nil, ""
+	}
+	return reuse, current.ETag
+}
+
+// signatures computes the SHA256 of each fixed-size block of the source
+func signatures(src io.ReaderAt, size, blockSize int64) ([]models.FileBlock, error) {
+	blocks := make([]models.FileBlock, 0, (size+blockSize-1)/blockSize)
+	hash := sha256.New()
+
+	for offset, number := int64(0), 0; offset < size; offset, number = offset+blockSize, number+1 {
+		length := min(blockSize, size-offset)
+
+		hash.Reset()
+		if _, err := io.Copy(hash, io.NewSectionReader(src, offset, length)); err != nil {
+			return nil, err
+		}
+
+		blocks = append(blocks, models.FileBlock{
+			Number: number,
+			Offset: offset,
+			Size:   length,
+			Hash:   hex.EncodeToString(hash.Sum(nil)),
+		})
+	}
+
+	return blocks, nil
+}
@@ -0,0 +1,177 @@
+package engine
+
+import (
+	"errors"
+	"path"
+	"sort"
+	"time"
+
+	"github.com/mwantia/gosync/pkg/db/models"
+	"github.com/mwantia/gosync/pkg/storage"
+)
+
+// OperationList marks subtrees whose listing was denied, in contrast to the action types of denied actions
+const OperationList = "list"
+
+// Delays between probes of a denied subtree, which double with every further denial
+const (
+	deniedProbeInterval = 5 * time.Minute
+	deniedProbeMax      = 6 * time.Hour
+)
+
+// DeniedPath is a subtree of a sync the backend denied access to, e.g. after a bucket policy changed.
+// Operations within the subtree are skipped by passes until it is probed again, instead of failing on every pass.
+type DeniedPath struct {
+	SyncConfigID uint   `json:"sync_config_id"`
+	Sync         string `json:"sync"`
+	// Path relative to the sync, "" for the whole sync
+	Path string `json:"path"`
+	// Operation that was denied, either OperationList or the type of the action
+	Operation string `json:"operation"`
+	// Side whose listing was denied, only set for OperationList
+	Side string `json:"side,omitempty"`
+	// Failures counts the denied operations within the subtree
+	Failures    int       `json:"failures"`
+	Error       string    `json:"error"`
+	Since       time.Time `json:"since"`
+	NextProbeAt time.Time `json:"next_probe_at"`
+
+	// interval between the last denial and the next probe
+	interval time.Duration
+}
+
+// IsAccessDenied returns true if the error was caused by missing permissions for the backend or local path
+func IsAccessDenied(err error) bool {
+	return errors.Is(err, storage.ErrAccessDenied)
+}
+
+// DeniedPaths returns all subtrees of syncs the backends denied access to, ordered by sync and path
+func (e *Engine) DeniedPaths() []DeniedPath {
+	e.mutex.Lock()
+	defer e.mutex.Unlock()
+
+	var result []DeniedPath
+	for _, denied := range e.denied {
+		for _, d := range denied {
+			result = append(result, *d)
+		}
+	}
+
+	sort.Slice(result, func(i, j int) bool {
+		if result[i].Sync != result[j].Sync {
+			return result[i].Sync < result[j].Sync
+		}
+		return result[i].Path < result[j].Path
+	})
+	return result
+}
+
+// deny groups the denied operation with earlier denials of the same subtree. The first denial of a subtree is
+// kept as recent error, while further denials only delay its next probe.
+func (e *Engine) deny(sc *models.SyncConfig, rel, operation, side string, err error) {
+	e.mutex.Lock()
+	defer e.mutex.Unlock()
+
+	now := time.Now().UTC()
+	for _, d := range e.denied[sc.ID] {
+		if d.Operation != operation || d.Side != side || !withinDir(rel, d.Path) {
+			continue
+		}
+
+		d.Failures++
+		d.Error = err.Error()
+		// Denials while probing back off, denials of operations that were already running don't
+		if !now.Before(d.NextProbeAt) {
+			d.interval = min(d.interval*2, deniedProbeMax)
+			d.NextProbeAt = now.Add(d.interval)
+		}
+		return
+	}
+
+	if e.denied == nil {
+		e.denied = make(map[uint][]*DeniedPath)
+	}
+	// Narrower subtrees are covered by the new one
+	denied := e.denied[sc.ID][:0]
+	for _, d := range e.denied[sc.ID] {
+		if d.Operation != operation || d.Side != side || !withinDir(d.Path, rel) {
+			denied = append(denied, d)
+		}
+	}
+	e.denied[sc.ID] = append(denied, &DeniedPath{
+		SyncConfigID: sc.ID,
+		Sync:         sc.Name,
+		Path:         rel,
+		Operation:    operation,
+		Side:         side,
+		Failures:     1,
+		Error:        err.Error(),
+		Since:        now,
+		NextProbeAt:  now.Add(deniedProbeInterval),
+		interval:     deniedProbeInterval,
+	})
+	e.recordError(sc.Name, rel, err)
+}
+
+// denyAction denies the directory of the action, since permissions of buckets are usually granted by prefix
+func (e *Engine) denyAction(sc *models.SyncConfig, action Action, err error) {
+	dir := path.Dir(action.Path)
+	if dir == "." {
+		dir = ""
+	}
+	e.deny(sc, dir, string(action.Type), "", err)
+}
+
+// isDenied returns true if the operation on the path has been denied and the subtree isn't due for a probe yet
+func (e *Engine) isDenied(syncConfigID uint, rel, operation, side string, now time.Time) bool {
+	e.mutex.Lock()
+	defer e.mutex.Unlock()
+
+	for _, d := range e.denied[syncConfigID] {
+		if d.Operation == operation && d.Side == side && withinDir(rel, d.Path) && now.Before(d.NextProbeAt) {
+			return true
+		}
+	}
+	return false
+}
+
+// allow clears all denials of the operation the successful operation on the path proves to be restored
+func (e *Engine) allow(syncConfigID uint, rel, operation, side string) {
+	e.mutex.Lock()
+	defer e.mutex.Unlock()
+
+	denied := e.denied[syncConfigID]
+	if len(denied) == 0 {
+		return
+	}
+
+	kept := denied[:0]
+	for _, d := range denied {
+		restored := d.Operation == operation && d.Side == side
+		if operation == OperationList {
+			// Listing a subtree covers all subtrees within it
+			restored = restored && withinDir(d.Path, rel)
+		} else {
+			restored = restored && withinDir(rel, d.Path)
+		}
+		if !restored {
+			kept = append(kept, d)
+		}
+	}
+
+	if len(kept) == 0 {
+		delete(e.denied, syncConfigID)
+	} else {
+		e.denied[syncConfigID] = kept
+	}
+}
+
+// withinAny returns true if the path is within any of the directories
+func withinAny(rel string, dirs []string) bool {
+	for _, dir := range dirs {
+		if withinDir(rel, dir) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,58 @@
+package engine
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/mwantia/gosync/pkg/db/models"
+)
+
+// drainInterval is the interval at which Drain checks for running passes
+const drainInterval = 100 * time.Millisecond
+
+// ErrShutdown is returned for passes that stopped before applying all actions, since the engine is draining.
+// The baselines of all applied actions are kept and the cursor of the pass is persisted, so the next pass
+// continues with the remaining actions.
+var ErrShutdown = errors.New("engine is shutting down")
+
+// Drain stops all passes from starting further actions and waits until their in-flight actions finished.
+// New passes are rejected with ErrShutdown. Returns the error of the context if it is done before all
+// passes stopped, in which case cancelling the passes keeps their interrupted delta uploads for resuming.
+func (e *Engine) Drain(ctx context.Context) error {
+	e.draining.Store(true)
+
+	ticker := time.NewTicker(drainInterval)
+	defer ticker.Stop()
+
+	for {
+		e.mutex.Lock()
+		running := len(e.passes)
+		e.mutex.Unlock()
+
+		if running == 0 {
+			return nil
+		}
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-ticker.C:
+		}
+	}
+}
+
+// Draining returns true once the engine stopped starting new actions
+func (e *Engine) Draining() bool {
+	return e.draining.Load()
+}
+
+// Cursor returns the path of the first action the last pass of the sync on this client didn't apply,
+// since it was stopped at its deadline or by a shutdown. Returns "" if the last pass completed.
+func (e *Engine) Cursor(ctx context.Context, sc *models.SyncConfig) (string, error) {
+	state, err := loadSyncState(ctx, e.store, sc, e.clientID)
+	if err != nil {
+		return "", err
+	}
+	return state.LastCursor, nil
+}
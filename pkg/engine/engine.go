@@ -0,0 +1,902 @@
+package engine
+
+import (
+	"context"
+	"crypto/ed25519"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"path"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/mwantia/gosync/pkg/backend"
+	"github.com/mwantia/gosync/pkg/checksum"
+	"github.com/mwantia/gosync/pkg/compress"
+	"github.com/mwantia/gosync/pkg/db/models"
+	"github.com/mwantia/gosync/pkg/db/store"
+	"github.com/mwantia/gosync/pkg/dedup"
+	"github.com/mwantia/gosync/pkg/limits"
+	"github.com/mwantia/gosync/pkg/storage"
+)
+
+// ErrReadOnly is returned for passes started while the engine is read-only
+var ErrReadOnly = errors.New("engine is read-only")
+
+// Engine executes sync passes between the source and destination of SyncConfigs
+type Engine struct {
+	mutex    sync.Mutex
+	readOnly atomic.Bool
+	draining atomic.Bool
+	queueID  atomic.Uint64
+
+	store    store.MetadataStore
+	meter    *storage.Meter
+	tuner    *storage.Tuner
+	cache    *storage.Cache
+	clientID string
+
+	limiter       *limits.Limiter
+	pool          *limits.Pool
+	maxWorkers    int
+	streamingOnly bool
+	transferLog   bool
+	leases        LeaseOptions
+	anomaly       AnomalyOptions
+	adaptive      AdaptiveOptions
+	scan          backend.ScanOptions
+	downloads     storage.ParallelOptions
+
+	passes map[uint]*pass
+	errors []RecentError
+	// denied contains the subtrees of each sync the backends denied access to
+	denied map[uint][]*DeniedPath
+	// quotas contains the quota level of each backend after the last pass writing to it
+	quotas map[string]string
+	// hashes caches the content hashes of local files, rehash contains the syncs whose next pass bypasses it
+	hashes *checksum.Cache
+	rehash map[uint]bool
+	// signingKey signs the manifests of published syncs
+	signingKey ed25519.PrivateKey
+}
+
+// Options configures the engine
+type Options struct {
+	// ClientID identifies this client, since baselines and sync states are tracked per client
+	ClientID string
+	// Meter records the bandwidth usage of all backend operations
+	Meter *storage.Meter
+	// Tuner chooses the chunk size of transfers (optional)
+	Tuner *storage.Tuner
+	// Cache keeps the content downloaded by syncs with files on demand on disk (optional)
+	Cache *storage.Cache
+	// Downloads fetch ranges of large files of backends by multiple workers, without a chunk size the chunk size
+	// learned by the tuner is used
+	Downloads storage.ParallelOptions
+	// Limiter delays actions while open files or memory exceed their limits (optional)
+	Limiter *limits.Limiter
+	// Pool shares a global number of workers between all passes by the weight of their sync (optional)
+	Pool *limits.Pool
+	// MaxWorkers caps the workers of each pass, regardless of the workers of the sync (0 = unlimited)
+	MaxWorkers int
+	// StreamingOnly skips delta transfers, which hash files in a separate pass before uploading
+	StreamingOnly bool
+	// Anomaly pauses syncs whose passes look like an accidental mass change of the destination
+	Anomaly AnomalyOptions
+	// ScanWorkers list the subdirectories of backends in parallel (backend.DefaultScanWorkers if 0)
+	ScanWorkers int
+	// ScanPageSize is the maximum number of keys listed per request (backend.DefaultScanPageSize if 0)
+	ScanPageSize int
+	// SigningKey signs the manifests of published syncs, which fail to publish without it (optional)
+	SigningKey ed25519.PrivateKey
+	// Adaptive learns the polling intervals of syncs from how often their passes find changes
+	Adaptive AdaptiveOptions
+	// Hasher computes the checksums of local files that aren't cached, e.g. on worker processes (optional)
+	Hasher func(ctx context.Context, path string) (checksum.Sums, error)
+	// TransferLog records every upload, download, deletion and conflict resolution in the transfer log
+	TransferLog bool
+	// Leases lock the paths written to backends, so clients sharing a backend don't write the same file at once
+	Leases LeaseOptions
+}
+
+// Result summarizes a single sync pass
+type Result struct {
+	Scanned    int
+	Uploaded   int
+	Downloaded int
+	Deleted    int
+	Conflicts  int
+	// Conflicted contains the paths of all conflicts resolved during the pass
+	Conflicted []string
+	// Deferred counts deletions waiting for the grace period of the sync
+	Deferred   int
+	Bytes      int64
+	Errors     []ActionError
+	StartedAt  time.Time
+	FinishedAt time.Time
+	// Bootstrap is set for passes of the whole sync while it is in bootstrap mode on this client
+	Bootstrap bool
+	// Cursor is the path of the first action that wasn't applied by a pass stopped at its deadline or by a shutdown
+	Cursor string
+	// Denied counts the actions and listings skipped, since the backend denied access to their subtree
+	Denied int
+	// Added and Changed split the transfers into files transferred for the first time and files synced before
+	Added   int
+	Changed int
+	// Held counts the transfers held back, since they would exceed the hard quota of their backend
+	Held int
+	// Quotas contains the backends that reached one of their quotas since the last pass
+	Quotas []QuotaAlert
+
+	// confirmed is set once the pass applies a plan despite an anomaly, which uses up the confirmation
+	confirmed bool
+	// held contains the backends transfers were held back for
+	held map[string]bool
+}
+
+// ActionError describes a failed action of a sync pass
+type ActionError struct {
+	Action Action
+	Err    error
+}
+
+func (e ActionError) Error() string {
+	return fmt.Sprintf("failed to %s '%s': %v", e.Action.Type, e.Action.Path, e.Err)
+}
+
+// New creates a new sync engine
+func New(ms store.MetadataStore, opts Options) *Engine {
+	meter := opts.Meter
+	if meter == nil {
+		meter = storage.NewMeter(ms)
+	}
+
+	hashes := checksum.NewCache(ms)
+	if opts.Hasher != nil {
+		hashes.SetHasher(opts.Hasher)
+	}
+
+	return &Engine{
+		store:    ms,
+		meter:    meter,
+		tuner:    opts.Tuner,
+		cache:    opts.Cache,
+		clientID: opts.ClientID,
+		passes:   make(map[uint]*pass),
+
+		limiter:       opts.Limiter,
+		pool:          opts.Pool,
+		maxWorkers:    opts.MaxWorkers,
+		streamingOnly: opts.StreamingOnly,
+		transferLog:   opts.TransferLog,
+		leases:        opts.Leases,
+		anomaly:       opts.Anomaly,
+		adaptive:      opts.Adaptive,
+		downloads:     opts.Downloads,
+		scan: backend.ScanOptions{
+			Workers:  opts.ScanWorkers,
+			PageSize: opts.ScanPageSize,
+		},
+		hashes:     hashes,
+		rehash:     make(map[uint]bool),
+		signingKey: opts.SigningKey,
+	}
+}
+
+// SetReadOnly prevents passes from applying any changes. Passes that are running while the engine becomes
+// read-only finish their in-flight actions, but skip all remaining actions.
+func (e *Engine) SetReadOnly(readOnly bool) {
+	e.readOnly.Store(readOnly)
+}
+
+// ReadOnly returns true if the engine doesn't apply any changes
+func (e *Engine) ReadOnly() bool {
+	return e.readOnly.Load()
+}
+
+// Run plans and executes a single sync pass
+func (e *Engine) Run(ctx context.Context, sc *models.SyncConfig) (*Result, error) {
+	return e.run(ctx, sc, "")
+}
+
+// Refresh plans and executes a pass limited to a single file or directory relative to the sync,
+// e.g. "Photos/2024", without scanning the remaining paths of the sync
+func (e *Engine) Refresh(ctx context.Context, sc *models.SyncConfig, scope string) (*Result, error) {
+	return e.run(ctx, sc, CleanSelectionPath(scope))
+}
+
+func (e *Engine) run(ctx context.Context, sc *models.SyncConfig, scope string) (*Result, error) {
+	if e.ReadOnly() {
+		return nil, ErrReadOnly
+	}
+	if e.Draining() {
+		return nil, ErrShutdown
+	}
+	started := time.Now().UTC()
+
+	// The pass is tracked while enumerating, since listing large syncs takes a while
+	p := e.begin(sc)
+	defer e.end(p)
+
+	ctx, cancel := e.withDeadline(ctx, p)
+	defer cancel()
+
+	plan, err := e.plan(ctx, sc, scope)
+	if err != nil {
+		e.mutex.Lock()
+		e.recordError(sc.Name, "", err)
+		e.mutex.Unlock()
+
+		e.saveState(ctx, sc, &Result{StartedAt: started, FinishedAt: time.Now().UTC()}, nil, err)
+		return nil, err
+	}
+	defer plan.Close()
+
+	result, err := e.execute(ctx, plan, p)
+	result.StartedAt = started
+	return result, err
+}
+
+// Execute applies all actions of the plan using the configured number of workers
+func (e *Engine) Execute(ctx context.Context, plan *Plan) (*Result, error) {
+	p := e.begin(plan.Config)
+	defer e.end(p)
+
+	ctx, cancel := e.withDeadline(ctx, p)
+	defer cancel()
+
+	return e.execute(ctx, plan, p)
+}
+
+// execute applies the plan in phases: metadata-only actions are indexed first, followed by all
+// content transfers, which are started in the order of the transfer queue. Once the soft deadline of the pass has passed,
+// no further transfers are started and the pass returns ErrDeadline, or ErrShutdown once the engine
+// is draining.
+func (e *Engine) execute(ctx context.Context, plan *Plan, p *pass) (*Result, error) {
+	result := &Result{
+		Scanned:   plan.Scanned,
+		Denied:    len(plan.Denied),
+		Bootstrap: plan.Bootstrap && plan.Scope == "",
+		StartedAt: time.Now().UTC(),
+	}
+	if e.ReadOnly() {
+		return result, ErrReadOnly
+	}
+
+	// Anomalous plans aren't applied at all, so the source stays untouched until the pass is confirmed
+	if err := e.checkAnomaly(ctx, plan); err != nil {
+		var anomaly *AnomalyError
+		if errors.As(err, &anomaly) {
+			e.mutex.Lock()
+			e.recordError(plan.Config.Name, "", err)
+			e.mutex.Unlock()
+
+			result.FinishedAt = time.Now().UTC()
+			e.saveState(ctx, plan.Config, result, plan.source, err)
+		}
+		return result, err
+	}
+
+	result.confirmed = plan.state != nil && plan.state.AnomalyConfirmed
+
+	deferred, err := e.deferDeletions(ctx, plan)
+	if err != nil {
+		return result, err
+	}
+	result.Deferred = deferred
+
+	e.planned(p, plan)
+
+	index, transfers := phases(plan)
+
+	// Indexing doesn't transfer any data, so it isn't stopped by the soft deadline
+	e.setPhase(p, PhaseIndex)
+	e.runActions(ctx, plan, p, &transferQueue{items: queued(index)}, result, false)
+
+	queue := e.newQueue(plan, transfers)
+	e.setQueue(p, queue)
+	e.setPhase(p, PhaseTransfer)
+	e.runActions(ctx, plan, p, queue, result, true)
+	remaining := queue.remaining()
+
+	// The cause distinguishes the hard deadline of the pass from other cancellations
+	err = context.Cause(ctx)
+	if err == nil && e.ReadOnly() {
+		err = ErrReadOnly
+	}
+	if err == nil && e.Draining() && len(remaining) > 0 {
+		err = ErrShutdown
+	}
+	if err == nil && len(remaining) > 0 {
+		err = ErrDeadline
+	}
+	if err == nil && len(result.Errors) == 0 {
+		// Manifests are only published for complete passes, so they never describe a partially updated mirror
+		if err = e.publish(ctx, plan, result); err != nil {
+			e.mutex.Lock()
+			e.recordError(plan.Config.Name, "", err)
+			e.mutex.Unlock()
+		}
+		// Unpinned paths are kept until all of their files were replaced by placeholders
+		if clearErr := e.clearUnpinned(ctx, plan); clearErr != nil {
+			e.mutex.Lock()
+			e.recordError(plan.Config.Name, "", clearErr)
+			e.mutex.Unlock()
+		}
+	}
+	if err != nil {
+		result.Cursor = cursor(remaining, result.Errors)
+	}
+	e.checkQuotas(ctx, plan, result)
+
+	result.FinishedAt = time.Now().UTC()
+	e.saveState(ctx, plan.Config, result, plan.source, err)
+	e.saveJournal(ctx, plan, result, err)
+
+	return result, err
+}
+
+// phases splits the actions of the plan into metadata-only actions and actions touching any data
+func phases(plan *Plan) ([]Action, []Action) {
+	var index, transfers []Action
+	for _, action := range plan.Actions {
+		if action.Type == ActionRecord || action.Type == ActionForget {
+			index = append(index, action)
+		} else {
+			transfers = append(transfers, action)
+		}
+	}
+	return index, transfers
+}
+
+// queued returns a queue of the actions in their planned order
+func queued(actions []Action) []*queuedAction {
+	items := make([]*queuedAction, len(actions))
+	for i, action := range actions {
+		items[i] = &queuedAction{action: action, rank: i}
+	}
+	return items
+}
+
+// cursor returns the path of the first action of an interrupted pass that wasn't applied, which is either
+// an in-flight action that failed due to the interruption or the next action that wasn't started
+func cursor(remaining []Action, failures []ActionError) string {
+	switch {
+	case len(failures) > 0:
+		return failures[0].Action.Path
+	case len(remaining) > 0:
+		return remaining[0].Path
+	default:
+		return ""
+	}
+}
+
+// runActions applies the queued actions using the configured number of workers and adds their outcome to the
+// result. Actions are left in the queue if the pass was cancelled, the soft deadline of the pass has passed or
+// the engine is draining. Transfers failing their verification are queued once more, while actions within subtrees
+// the backend denied access to are skipped until the subtree is due for its next probe. Transfers exceeding the hard
+// quota of their backend are held back, while transfers cancelled by CancelTransfers are either dropped or queued
+// once more, both without counting as failures. Deletions from backends are dispatched together with the following
+// queued deletions of the same side and priority, which are applied by batch delete calls.
+func (e *Engine) runActions(ctx context.Context, plan *Plan, p *pass, queue *transferQueue, result *Result, deadline bool) {
+	var mutex, dispatch sync.Mutex
+	var wait sync.WaitGroup
+	retried := make(map[string]bool)
+
+	workers := max(plan.Config.Workers, 1)
+	if e.maxWorkers > 0 {
+		workers = min(workers, e.maxWorkers)
+	}
+
+	// Free workers take the next action from the queue, so reordering the queue applies until an action is started.
+	// Actions aren't started anymore once the soft deadline passes.
+	next := func() []*queuedAction {
+		dispatch.Lock()
+		defer dispatch.Unlock()
+
+		if ctx.Err() != nil || e.ReadOnly() || e.Draining() {
+			return nil
+		}
+		if err := e.limiter.WaitMemory(ctx); err != nil {
+			return nil
+		}
+		if deadline && p.expired(time.Now()) {
+			return nil
+		}
+		return queue.popBatch(storage.MaxDeleteBatchSize, func(head, action Action) bool {
+			return action.Type == head.Type && plan.batched(head)
+		})
+	}
+
+	for i := 0; i < workers; i++ {
+		wait.Add(1)
+		go func() {
+			defer wait.Done()
+
+			for {
+				batch := next()
+				if len(batch) == 0 {
+					return
+				}
+
+				var dispatched []*running
+				for _, item := range batch {
+					action := item.action
+					if e.isDenied(plan.Config.ID, action.Path, string(action.Type), "", time.Now()) {
+						e.finished(p, action, storage.ErrAccessDenied)
+						mutex.Lock()
+						result.Denied++
+						mutex.Unlock()
+						continue
+					}
+					if b := e.exceedsQuota(ctx, plan, action); b != nil {
+						e.aborted(p, action)
+						mutex.Lock()
+						result.Held++
+						if result.held == nil {
+							result.held = make(map[string]bool)
+						}
+						result.held[b.ID] = true
+						mutex.Unlock()
+						continue
+					}
+
+					// Each transfer has its own context, so it can be cancelled without affecting the pass
+					actionCtx, cancel := context.WithCancelCause(ctx)
+					dispatched = append(dispatched, &running{
+						item:      item,
+						ctx:       actionCtx,
+						cancel:    cancel,
+						t:         e.started(p, item.id, action, cancel),
+						startedAt: time.Now().UTC(),
+					})
+				}
+				switch {
+				case len(dispatched) == 1:
+					r := dispatched[0]
+					r.err = e.applyLimited(r.ctx, plan, r.item.action, r.t)
+				case len(dispatched) > 1:
+					e.applyDeletions(ctx, plan, dispatched)
+				}
+
+				for _, r := range dispatched {
+					action, err, t, startedAt := r.item.action, r.err, r.t, r.startedAt
+					cause := context.Cause(r.ctx)
+					r.cancel(nil)
+
+					if err != nil && ctx.Err() == nil && (errors.Is(cause, storage.ErrCancelled) || errors.Is(cause, errRequeued)) {
+						e.aborted(p, action)
+						if errors.Is(cause, errRequeued) {
+							e.requeue(p, queue, action)
+						}
+						continue
+					}
+					e.finished(p, action, err)
+					e.logTransfer(ctx, plan, action, t, startedAt, err)
+
+					if IsAccessDenied(err) {
+						e.denyAction(plan.Config, action, err)
+					} else if err == nil {
+						e.allow(plan.Config.ID, action.Path, string(action.Type), "")
+					}
+
+					mutex.Lock()
+					if errors.Is(err, ErrIntegrity) && !retried[action.Path] {
+						retried[action.Path] = true
+						mutex.Unlock()
+						e.requeue(p, queue, action)
+						continue
+					}
+					switch {
+					case IsAccessDenied(err):
+						result.Denied++
+					case err != nil:
+						result.Errors = append(result.Errors, ActionError{
+							Action: action,
+							Err:    err,
+						})
+					default:
+						result.count(action)
+					}
+					mutex.Unlock()
+				}
+			}
+		}()
+	}
+	wait.Wait()
+}
+
+func (r *Result) count(action Action) {
+	switch action.Type {
+	case ActionDownload:
+		r.Downloaded++
+		r.Bytes += action.Size
+	case ActionUpload:
+		r.Uploaded++
+		r.Bytes += action.Size
+	case ActionDeleteSource, ActionDeleteDest:
+		r.Deleted++
+	case ActionConflict:
+		r.Conflicts++
+		r.Conflicted = append(r.Conflicted, action.Path)
+		r.Bytes += action.Size
+	}
+
+	switch action.Type {
+	case ActionDownload, ActionUpload:
+		if action.synced {
+			r.Changed++
+		} else {
+			r.Added++
+		}
+	case ActionConflict:
+		// Conflicts always change files, since both sides modified them
+		r.Changed++
+	}
+}
+
+// applyLimited applies the action once a worker of the pool and the files it opens are available within the limits
+func (e *Engine) applyLimited(ctx context.Context, plan *Plan, action Action, t *transfer) error {
+	if err := e.pool.Acquire(ctx, plan.Config.ID, plan.Config.Weight); err != nil {
+		return err
+	}
+	defer e.pool.Release(plan.Config.ID)
+
+	files := action.openFiles()
+	if err := e.limiter.AcquireFiles(ctx, files); err != nil {
+		return err
+	}
+	defer e.limiter.ReleaseFiles(files)
+
+	return e.leased(ctx, plan, action, func(ctx context.Context) error {
+		return e.apply(ctx, plan, action, t)
+	})
+}
+
+// openFiles returns the number of files held open at the same time while applying the action,
+// since local sides read or write one file per transfer
+func (a Action) openFiles() int64 {
+	switch a.Type {
+	case ActionDownload, ActionUpload, ActionConflict:
+		return 2
+	case ActionDeleteSource, ActionDeleteDest:
+		return 1
+	default:
+		return 0
+	}
+}
+
+func (e *Engine) apply(ctx context.Context, plan *Plan, action Action, t *transfer) error {
+	switch action.Type {
+	case ActionDownload:
+		if action.Placeholder {
+			info, err := e.putPlaceholder(ctx, plan, action)
+			if err != nil {
+				return err
+			}
+			return e.saveBaseline(ctx, plan, action, action.source, info)
+		}
+		info, err := e.transfer(ctx, plan, plan.source, plan.dest, action.Path, action.destPath(), t)
+		if err != nil {
+			return err
+		}
+		return e.saveBaseline(ctx, plan, action, action.source, info)
+
+	case ActionUpload:
+		info, err := e.transfer(ctx, plan, plan.dest, plan.source, action.destPath(), action.Path, t)
+		if err != nil {
+			return err
+		}
+		return e.saveBaseline(ctx, plan, action, info, action.dest)
+
+	case ActionDeleteSource:
+		if err := plan.source.remove(ctx, e, action.Path); err != nil {
+			return err
+		}
+		return e.forgetPath(ctx, plan, action.Path)
+
+	case ActionDeleteDest:
+		if err := plan.dest.remove(ctx, e, action.destPath()); err != nil {
+			return err
+		}
+		return e.forgetPath(ctx, plan, action.Path)
+
+	case ActionConflict:
+		// Preserve the destination version next to the source version before overwriting it
+		if _, err := e.transfer(ctx, plan, plan.dest, plan.source, action.destPath(), e.conflictPath(action.Path), nil); err != nil {
+			return err
+		}
+		info, err := e.transfer(ctx, plan, plan.source, plan.dest, action.Path, action.destPath(), t)
+		if err != nil {
+			return err
+		}
+		return e.saveBaseline(ctx, plan, action, action.source, info)
+
+	case ActionRecord:
+		return e.saveBaseline(ctx, plan, action, action.source, action.dest)
+
+	case ActionForget:
+		return e.store.DeleteSyncBaseline(ctx, plan.Config.ID, e.clientID, action.Path)
+
+	default:
+		return fmt.Errorf("unsupported action '%s'", action.Type)
+	}
+}
+
+// transfer copies the object from one side to the other and records its metadata, including the POSIX metadata
+// preserved by the sync. The transferred bytes are counted by t, which may be nil if the transfer isn't tracked.
+func (e *Engine) transfer(ctx context.Context, plan *Plan, from, to *side, fromPath, toPath string, t *transfer) (*storage.ObjectInfo, error) {
+	fromKey := from.key(fromPath)
+	toKey := to.key(toPath)
+
+	info, err := e.copyObject(ctx, plan, from, to, fromKey, toKey, t)
+	if err != nil {
+		return nil, err
+	}
+	if err := e.preserveAttributes(ctx, plan, from, to, fromKey, toKey); err != nil {
+		return nil, err
+	}
+	if err := e.recordSparse(ctx, from, to, fromKey, toKey); err != nil {
+		return nil, err
+	}
+	return info, nil
+}
+
+func (e *Engine) copyObject(ctx context.Context, plan *Plan, from, to *side, fromKey, toKey string, t *transfer) (*storage.ObjectInfo, error) {
+	// Use a server-side copy if both sides are within the same backend
+	if from.backend != nil && to.backend != nil && from.backend.ID == to.backend.ID {
+		// Copies of compressed files are compressed as well, so they keep describing the content
+		compressed := e.compressedFile(ctx, from, fromKey, nil)
+		info, err := to.storage.Copy(ctx, fromKey, toKey)
+		if err != nil {
+			return nil, fmt.Errorf("failed to copy '%s': %w", fromKey, err)
+		}
+		if compressed == nil {
+			return info, e.recordFile(ctx, to, info)
+		}
+		info.Size = compressed.Size
+		sums := checksum.Sums{MD5: compressed.MD5Hash, SHA256: compressed.SHA256Hash}
+		return info, e.recordVerifiedFile(ctx, to, info, sums, compressed.Compression)
+	}
+
+	stat, err := from.storage.Stat(ctx, fromKey)
+	if err != nil {
+		return nil, fmt.Errorf("failed to stat '%s': %w", fromKey, err)
+	}
+
+	reader, err := e.openCached(ctx, plan, from, fromKey, stat)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read '%s': %w", fromKey, err)
+	}
+	defer reader.Close()
+
+	if to.backend != nil && plan.Config.Dedup {
+		info, _, err := dedup.NewStore(e.store, to.storage, to.backend).Put(ctx, toKey, t.wrap(reader), stat.LastModified)
+		return info, err
+	}
+
+	// Local files support random access, which allows transferring only changed blocks of uncompressed files
+	algorithm := plan.compression(to, toKey)
+	if src, ok := reader.(io.ReaderAt); ok && to.backend != nil && algorithm == "" && !e.streamingOnly && useDelta(plan.Config, stat.Size) {
+		return e.transferDelta(ctx, plan, to, toKey, src, stat)
+	}
+
+	// Checksums are computed while transferring, so verified transfers read their source only once
+	body := t.wrap(reader)
+	var hasher *checksum.Hasher
+	if verifies(plan.Config) {
+		hasher = checksum.NewHasher()
+		body = io.TeeReader(body, hasher)
+	}
+
+	// Compressed files are written without knowing their size, which is recorded as the size of their content
+	size := stat.Size
+	if algorithm != "" {
+		compressed, err := compress.Compress(body, algorithm)
+		if err != nil {
+			return nil, err
+		}
+		defer compressed.Close()
+		body, size = compressed, -1
+	}
+
+	opts := storage.PutOptions{
+		ContentType: stat.ContentType,
+	}
+	// Holes of sparse files are only recreated within local directories, backends store their zeros
+	if to.backend == nil {
+		if opts.Sparse, err = e.sparseMap(ctx, from, fromKey, stat); err != nil {
+			return nil, err
+		}
+	}
+
+	info, err := to.storage.Put(ctx, toKey, body, size, opts)
+	if err != nil {
+		return nil, fmt.Errorf("failed to write '%s': %w", toKey, err)
+	}
+	if algorithm != "" {
+		info.Size = stat.Size
+	}
+
+	var sums checksum.Sums
+	if hasher != nil {
+		sums = hasher.Sums()
+		if err := e.verifyTransfer(ctx, plan, from, to, fromKey, toKey, stat, sums, algorithm); err != nil {
+			return nil, err
+		}
+	}
+	return info, e.recordVerifiedFile(ctx, to, info, sums, algorithm)
+}
+
+// open returns the content of the object, assembling deduplicated files from their chunks and decompressing
+// compressed files. The stat is updated with the size and content type of the actual content.
+func (e *Engine) open(ctx context.Context, from *side, key string, stat *storage.ObjectInfo) (io.ReadCloser, error) {
+	if from.backend == nil || !e.isDeduplicated(ctx, from, key, stat) {
+		reader, err := from.storage.Get(ctx, key)
+		if err != nil {
+			return nil, err
+		}
+		return e.decompress(ctx, from, key, stat, reader)
+	}
+
+	reader, manifest, err := dedup.NewStore(e.store, from.storage, from.backend).Open(ctx, key)
+	if err != nil {
+		return nil, err
+	}
+
+	stat.Size = manifest.Size
+	stat.ContentType = mime.TypeByExtension(path.Ext(key))
+	return reader, nil
+}
+
+// openTransfer returns the content of the object transferred by a pass. Large objects of backends are read by
+// ranged reads of multiple workers, all other objects are read like by open.
+func (e *Engine) openTransfer(ctx context.Context, from *side, key string, stat *storage.ObjectInfo) (io.ReadCloser, error) {
+	if from.backend == nil || e.downloads.Workers <= 1 || stat.Size < e.downloads.MinSize || e.isDeduplicated(ctx, from, key, stat) {
+		return e.open(ctx, from, key, stat)
+	}
+
+	opts := e.downloads
+	if opts.ChunkSize == 0 && e.tuner != nil {
+		opts.ChunkSize = e.tuner.ChunkSize(from.backend.ID)
+	}
+	reader, err := storage.OpenParallel(ctx, from.storage, *stat, opts)
+	if err != nil {
+		return nil, err
+	}
+	return e.decompress(ctx, from, key, stat, reader)
+}
+
+func (e *Engine) isDeduplicated(ctx context.Context, s *side, key string, stat *storage.ObjectInfo) bool {
+	return dedup.NewStore(e.store, s.storage, s.backend).IsDeduplicated(ctx, key, stat)
+}
+
+func (e *Engine) saveBaseline(ctx context.Context, plan *Plan, action Action, source, dest *storage.ObjectInfo) error {
+	if source == nil || dest == nil {
+		return fmt.Errorf("missing object state for baseline of '%s'", action.Path)
+	}
+	if integrityMode(plan.Config) == IntegrityParanoid {
+		source, dest = paranoidBaseline(source, dest)
+	}
+	// Placeholders stand for the content of the source, whose size is compared in the fast integrity mode
+	size := dest.Size
+	if action.Placeholder {
+		size = source.Size
+	}
+
+	return e.store.SaveSyncBaseline(ctx, &models.SyncBaseline{
+		SyncConfigID:     plan.Config.ID,
+		ClientID:         e.clientID,
+		Path:             action.Path,
+		Size:             size,
+		SourceETag:       source.ETag,
+		DestETag:         dest.ETag,
+		SourceModifiedAt: source.LastModified,
+		DestModifiedAt:   dest.LastModified,
+		SyncedAt:         time.Now().UTC(),
+		Placeholder:      action.Placeholder,
+	})
+}
+
+// conflictPath returns the path of the conflict copy, e.g. "docs/report.conflict-laptop-20240102T150405.pdf"
+func (e *Engine) conflictPath(rel string) string {
+	ext := path.Ext(rel)
+	base := strings.TrimSuffix(rel, ext)
+	return fmt.Sprintf("%s.conflict-%s-%s%s", base, e.clientID, time.Now().UTC().Format("20060102T150405"), ext)
+}
+
+// saveState updates the sync state of this client with the result of the pass
+func (e *Engine) saveState(ctx context.Context, sc *models.SyncConfig, result *Result, source *side, passErr error) {
+	// Persist the state even if the pass was cancelled
+	ctx = context.WithoutCancel(ctx)
+
+	backendID := source.backendID()
+
+	state, err := e.store.GetSyncState(ctx, sc.ID, backendID, e.clientID)
+	if err != nil {
+		if !errors.Is(err, store.ErrNotFound) {
+			e.stateError(sc, err)
+			return
+		}
+		state = &models.SyncState{
+			SyncConfigID: sc.ID,
+			BackendID:    backendID,
+			ClientID:     e.clientID,
+		}
+	}
+
+	state.LastSyncAt = result.FinishedAt
+	state.FilesScanned = int64(result.Scanned)
+	state.FilesSynced = int64(result.Uploaded + result.Downloaded + result.Deleted + result.Conflicts)
+	state.BytesSynced += result.Bytes
+	state.ErrorCount = len(result.Errors) + result.Denied
+	state.LastError = ""
+	if source != nil {
+		// Passes that failed while planning didn't apply any action, so the cursor of an earlier pass is kept
+		state.LastCursor = result.Cursor
+	}
+	if result.confirmed {
+		// The confirmation of an anomaly only applies to a single pass, regardless of its outcome
+		state.AnomalyConfirmed = false
+	}
+
+	var anomaly *AnomalyError
+	switch {
+	case errors.As(passErr, &anomaly):
+		state.Anomaly = anomaly.Reason
+		state.ErrorCount++
+		state.LastError = passErr.Error()
+	case passErr != nil && !errors.Is(passErr, ErrDeadline) && !errors.Is(passErr, ErrShutdown):
+		// Passes stopped at their deadline or by a shutdown aren't failed, since the next pass continues where they stopped
+		state.ErrorCount++
+		state.LastError = passErr.Error()
+	case len(result.Errors) > 0:
+		state.LastError = result.Errors[0].Error()
+	case result.Denied > 0:
+		// Paths within denied subtrees weren't synced, so a bootstrap isn't complete either
+		state.LastError = fmt.Sprintf("skipped %d operations, since access was denied", result.Denied)
+	case result.Held > 0:
+		state.LastError = fmt.Sprintf("held back %d transfers, since they would exceed the quota of their backend", result.Held)
+	case result.Bootstrap && passErr == nil:
+		// All files of the source have been downloaded, so the next pass syncs in both directions again
+		state.Bootstrap = false
+	}
+
+	if state.ID == 0 {
+		err = e.store.CreateSyncState(ctx, state)
+	} else {
+		err = e.store.UpdateSyncState(ctx, state)
+	}
+	if err != nil {
+		e.stateError(sc, err)
+	}
+
+	// Passes are rolled up per day, so digests summarize the activity of syncs without reading their events
+	err = e.store.AddSyncActivity(ctx, &models.SyncActivity{
+		SyncConfigID: sc.ID,
+		ClientID:     e.clientID,
+		Day:          result.FinishedAt.UTC().Format("2006-01-02"),
+		Passes:       1,
+		Added:        int64(result.Added),
+		Changed:      int64(result.Changed),
+		Deleted:      int64(result.Deleted),
+		Conflicts:    int64(result.Conflicts),
+		Errors:       int64(state.ErrorCount),
+		Bytes:        result.Bytes,
+	})
+	if err != nil {
+		e.mutex.Lock()
+		e.recordError(sc.Name, "", fmt.Errorf("failed to record activity of pass: %w", err))
+		e.mutex.Unlock()
+	}
+}
+
+// stateError records that the state of the sync couldn't be saved, e.g. its cursor or an anomaly pausing it
+func (e *Engine) stateError(sc *models.SyncConfig, err error) {
+	e.mutex.Lock()
+	e.recordError(sc.Name, "", fmt.Errorf("failed to save state of sync: %w", err))
+	e.mutex.Unlock()
+}
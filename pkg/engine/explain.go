@@ -0,0 +1,236 @@
+package engine
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/mwantia/gosync/pkg/db/models"
+	"github.com/mwantia/gosync/pkg/db/store"
+	"github.com/mwantia/gosync/pkg/storage"
+)
+
+// Steps of an explanation besides the rules of the sync, see Rules.Evaluate
+const (
+	RuleEnabled   = "enabled"
+	RuleAnomaly   = "anomaly"
+	RuleIgnore    = "ignore"
+	RuleSelection = "selection"
+	RuleDirection = "direction"
+	RuleBaseline  = "baseline"
+	RuleConflict  = "conflict"
+)
+
+// ExplainStep is a single rule evaluated for a path, Side being empty for rules of the path itself
+type ExplainStep struct {
+	Rule   string `json:"rule"`
+	Side   string `json:"side,omitempty"`
+	Passed bool   `json:"passed"`
+	Detail string `json:"detail"`
+}
+
+// Explanation describes why a path of a sync is included or skipped, and what the next pass does with it
+type Explanation struct {
+	Sync string `json:"sync"`
+	// Path is relative to the sync
+	Path string `json:"path"`
+	// Included is set unless the ignore patterns, the selection or the rules of the sync skip the path
+	Included bool          `json:"included"`
+	Steps    []ExplainStep `json:"steps"`
+	// Decision is the action the next pass takes for the path, "" if it's skipped or unchanged
+	Decision ActionType `json:"decision,omitempty"`
+	Reason   string     `json:"reason"`
+}
+
+// Explain traces the decision of the planner for the path relative to the sync. All rules are evaluated for each
+// side holding the path, so every reason for skipping it is reported, while included paths are planned like
+// a refresh of the path without applying the plan.
+func (e *Engine) Explain(ctx context.Context, sc *models.SyncConfig, rel string) (*Explanation, error) {
+	rules, err := ParseRules(sc, time.Now())
+	if err != nil {
+		return nil, fmt.Errorf("invalid rules of sync '%s': %w", sc.Name, err)
+	}
+
+	sourcePath, destPath := ResolvePaths(sc, e.clientID)
+	destPath, template := SplitPathTemplate(destPath)
+
+	source, err := e.openSide(ctx, sourcePath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open source of sync '%s': %w", sc.Name, err)
+	}
+	defer source.close()
+	sides := map[string]*side{SideSource: source}
+	// Templated destinations can't be mapped back, so only the source object is evaluated
+	if template == "" {
+		dest, err := e.openSide(ctx, destPath)
+		if err != nil {
+			return nil, fmt.Errorf("failed to open destination of sync '%s': %w", sc.Name, err)
+		}
+		defer dest.close()
+		sides[SideDest] = dest
+		applyNormalization(sc, source, dest)
+		applyReservedNames(sc, source, dest)
+	} else {
+		applyNormalization(sc, source)
+		applyReservedNames(sc, source)
+	}
+
+	state, err := loadSyncState(ctx, e.store, sc, e.clientID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load state of sync '%s': %w", sc.Name, err)
+	}
+	selections, err := e.store.ListSyncSelections(ctx, sc.ID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list selections of sync '%s': %w", sc.Name, err)
+	}
+	baseline, err := e.baseline(ctx, sc, rel)
+	if err != nil {
+		return nil, err
+	}
+
+	x := &Explanation{Sync: sc.Name, Path: rel, Included: true}
+	add := func(step ExplainStep) {
+		x.Steps = append(x.Steps, step)
+	}
+	// filter adds a step deciding whether the path is included, the first failed one being the reason it's skipped
+	filter := func(step ExplainStep) {
+		add(step)
+		if !step.Passed && x.Included {
+			x.Included = false
+			x.Reason = "skipped by " + step.Rule + ": " + step.Detail
+		}
+	}
+
+	if sc.Enabled {
+		add(ExplainStep{Rule: RuleEnabled, Passed: true, Detail: "sync is enabled"})
+	} else {
+		add(ExplainStep{Rule: RuleEnabled, Detail: "sync is disabled, so no pass is scheduled"})
+	}
+	if state.Anomaly != "" && !state.AnomalyConfirmed {
+		add(ExplainStep{Rule: RuleAnomaly, Detail: "passes are paused until the anomaly is confirmed: " + state.Anomaly})
+	}
+
+	if pattern := ignoredBy(rel, ParseIgnorePatterns(sc.IgnorePattern)); pattern != "" {
+		filter(ExplainStep{Rule: RuleIgnore, Detail: fmt.Sprintf("matches ignore pattern '%s'", pattern)})
+	} else {
+		filter(ExplainStep{Rule: RuleIgnore, Passed: true, Detail: "matches no ignore pattern"})
+	}
+	if len(selections) == 0 {
+		filter(ExplainStep{Rule: RuleSelection, Passed: true, Detail: "all paths are selected"})
+	} else if NewSelection(selections).Selected(rel) {
+		filter(ExplainStep{Rule: RuleSelection, Passed: true, Detail: "selected by the selective sync"})
+	} else {
+		filter(ExplainStep{Rule: RuleSelection, Detail: "not selected by the selective sync"})
+	}
+
+	found := make(map[string]bool)
+	for _, name := range []string{SideSource, SideDest} {
+		s, ok := sides[name]
+		if !ok {
+			continue
+		}
+		key := s.key(rel)
+		stat, err := s.storage.Stat(ctx, key)
+		if errors.Is(err, storage.ErrObjectNotFound) {
+			continue
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to stat '%s': %w", key, err)
+		}
+		found[name] = true
+		if record := e.compressedFile(ctx, s, key, stat); record != nil {
+			stat.Size = record.Size
+		}
+
+		detect := func() string { return e.detectMime(ctx, s, key, *stat) }
+		for _, result := range rules.Evaluate(*stat, detect, true) {
+			filter(ExplainStep{Rule: result.Rule, Side: name, Passed: result.Passed, Detail: result.Detail})
+		}
+	}
+
+	add(ExplainStep{Rule: RuleDirection, Passed: true, Detail: explainDirection(sc, state, found)})
+	if baseline != nil {
+		add(ExplainStep{Rule: RuleBaseline, Passed: true, Detail: "synced before on this client, changes are detected against the last pass"})
+	} else {
+		add(ExplainStep{Rule: RuleBaseline, Passed: true, Detail: "never synced on this client"})
+	}
+
+	if !x.Included {
+		if baseline != nil {
+			x.Reason += ", its baseline is forgotten by the next pass"
+		}
+		return x, nil
+	}
+
+	plan, err := e.plan(ctx, sc, rel)
+	if err != nil {
+		return nil, err
+	}
+	defer plan.Close()
+	for _, action := range plan.Actions {
+		if action.Path == rel {
+			x.Decision, x.Reason = action.Type, action.Reason
+		}
+	}
+	if x.Decision == ActionConflict {
+		add(ExplainStep{Rule: RuleConflict, Detail: "changed on both sides, the destination is kept as conflict copy"})
+	} else {
+		add(ExplainStep{Rule: RuleConflict, Passed: true, Detail: "no conflict"})
+	}
+
+	if x.Decision == "" {
+		switch {
+		case len(found) == 0:
+			x.Reason = "exists on neither side"
+		case baseline != nil:
+			x.Reason = "unchanged since the last pass"
+		default:
+			x.Reason = "no action required by the direction of the sync"
+		}
+	}
+	if !sc.Enabled {
+		x.Reason += ", but the sync is disabled"
+	} else if state.Anomaly != "" && !state.AnomalyConfirmed {
+		x.Reason += ", but passes are paused after an anomaly"
+	}
+	return x, nil
+}
+
+// baseline returns the baseline of the path on this client, or nil if it was never synced
+func (e *Engine) baseline(ctx context.Context, sc *models.SyncConfig, rel string) (*models.SyncBaseline, error) {
+	baseline, err := e.store.GetSyncBaseline(ctx, sc.ID, e.clientID, rel)
+	if errors.Is(err, store.ErrNotFound) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to load baseline of '%s' of sync '%s': %w", rel, sc.Name, err)
+	}
+	return baseline, nil
+}
+
+// explainDirection describes which changes the direction of the sync propagates for the sides holding the path
+func explainDirection(sc *models.SyncConfig, state *models.SyncState, found map[string]bool) string {
+	var exists string
+	switch {
+	case found[SideSource] && found[SideDest]:
+		exists = "exists on both sides"
+	case found[SideSource]:
+		exists = "exists in the source only"
+	case found[SideDest]:
+		exists = "exists in the destination only"
+	default:
+		exists = "exists on neither side"
+	}
+
+	switch {
+	case state.Bootstrap:
+		return exists + ", only downloads while the client bootstraps"
+	case sc.Direction == DirectionDownload:
+		return exists + ", changes of the source are downloaded"
+	case sc.Direction == DirectionUpload:
+		return exists + ", changes of the destination are uploaded"
+	default:
+		return exists + ", changes of either side are synced"
+	}
+}
@@ -0,0 +1,59 @@
+package engine
+
+import (
+	"context"
+	"fmt"
+	"path"
+	"time"
+
+	"github.com/mwantia/gosync/pkg/db/models"
+	"github.com/mwantia/gosync/pkg/storage"
+)
+
+// logTransfer records the applied action in the transfer log, unless it only changed baselines
+func (e *Engine) logTransfer(ctx context.Context, plan *Plan, action Action, t *transfer, startedAt time.Time, err error) {
+	if !e.transferLog {
+		return
+	}
+	switch action.Type {
+	case ActionDownload, ActionUpload, ActionDeleteSource, ActionDeleteDest, ActionConflict:
+	default:
+		return
+	}
+
+	entry := &models.TransferLog{
+		SyncConfigID: plan.Config.ID,
+		ClientID:     e.clientID,
+		Operation:    string(action.Type),
+		Source:       plan.source.location(action.Path),
+		Destination:  plan.dest.location(action.destPath()),
+		Bytes:        action.transferred(),
+		Result:       models.TransferSucceeded,
+		StartedAt:    startedAt,
+		FinishedAt:   time.Now().UTC(),
+	}
+	if err != nil {
+		entry.Bytes = t.done.Load()
+		entry.Result = models.TransferFailed
+		entry.Error = err.Error()
+	}
+
+	// Operations finished while the pass is cancelled are still recorded
+	if err := e.store.CreateTransferLog(context.WithoutCancel(ctx), entry); err != nil {
+		e.mutex.Lock()
+		e.recordError(plan.Config.Name, action.Path, fmt.Errorf("failed to record transfer: %w", err))
+		e.mutex.Unlock()
+	}
+}
+
+// location returns the path of the object as shown to users, the local path within local directories
+// or the virtual path of the object within its backend
+func (s *side) location(rel string) string {
+	key := s.key(rel)
+	if local, ok := s.storage.(*storage.LocalStorage); ok {
+		if name, err := local.Path(key); err == nil {
+			return name
+		}
+	}
+	return path.Join(s.backendID(), key)
+}
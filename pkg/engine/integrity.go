@@ -0,0 +1,168 @@
+package engine
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/mwantia/gosync/pkg/checksum"
+	"github.com/mwantia/gosync/pkg/db/models"
+	"github.com/mwantia/gosync/pkg/storage"
+)
+
+// Integrity modes deciding how changes of files are detected
+const (
+	// IntegrityFast compares size and modification time, falling back to the ETag for older baselines
+	IntegrityFast = "fast"
+	// IntegrityStandard compares the ETag reported by the storage
+	IntegrityStandard = "standard"
+	// IntegrityParanoid hashes the content of both sides on every pass and verifies every transfer
+	IntegrityParanoid = "paranoid"
+)
+
+// contentHashPrefix marks ETags replaced by the SHA256 of the content of the object in paranoid mode
+const contentHashPrefix = "sha256:"
+
+// ValidIntegrityMode returns true if the integrity mode is supported, "" being the same as standard
+func ValidIntegrityMode(mode string) bool {
+	return mode == "" || mode == IntegrityFast || mode == IntegrityStandard || mode == IntegrityParanoid
+}
+
+// integrityMode returns the integrity mode of the sync, defaulting to standard
+func integrityMode(sc *models.SyncConfig) string {
+	if sc.Integrity == "" {
+		return IntegrityStandard
+	}
+	return sc.Integrity
+}
+
+// hashObjects replaces the ETags of all objects with the SHA256 of their content. Recorded hashes are used
+// for objects of backends whose ETag still matches the record and cached hashes for unchanged local files,
+// unless rehash is set. All other objects are read entirely, except for placeholders of files on demand,
+// which already carry the content hash of their baseline.
+func (e *Engine) hashObjects(ctx context.Context, s *side, objects map[string]storage.ObjectInfo, rehash bool) error {
+	for rel, object := range objects {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		if isContentHash(object.ETag) {
+			continue
+		}
+
+		hash, err := e.contentHash(ctx, s, object, rehash)
+		if err != nil {
+			return fmt.Errorf("failed to hash '%s': %w", s.key(rel), err)
+		}
+
+		object.ETag = contentHashPrefix + hash
+		objects[rel] = object
+	}
+	return nil
+}
+
+func (e *Engine) contentHash(ctx context.Context, s *side, object storage.ObjectInfo, rehash bool) (string, error) {
+	key := s.key(object.Key)
+	// Preserved symbolic links are hashed by their target instead
+	if local, ok := s.storage.(*storage.LocalStorage); ok && !local.IsLink(key) {
+		name, err := local.Path(key)
+		if err != nil {
+			return "", err
+		}
+		sums, err := e.hashes.File(ctx, name, rehash)
+		if err != nil {
+			return "", err
+		}
+		return sums.SHA256, nil
+	}
+
+	if s.backend != nil && !rehash {
+		if record, err := e.store.GetFile(ctx, s.backend.ID, key); err == nil && record.ETag == object.ETag && record.SHA256Hash != "" {
+			return record.SHA256Hash, nil
+		}
+	}
+
+	// Deduplicated files are hashed by their assembled content, so both sides of a sync are comparable
+	stat := object
+	reader, err := e.open(ctx, s, key, &stat)
+	if err != nil {
+		return "", err
+	}
+	defer reader.Close()
+
+	sums, err := checksum.Reader(reader)
+	if err != nil {
+		return "", err
+	}
+	return sums.SHA256, nil
+}
+
+// Rehash makes the next pass of the sync in paranoid mode read the content of all files again,
+// instead of using the cached hashes of unchanged local files and the recorded hashes of backend files
+func (e *Engine) Rehash(syncConfigID uint) {
+	e.mutex.Lock()
+	defer e.mutex.Unlock()
+	e.rehash[syncConfigID] = true
+}
+
+// takeRehash returns true once if the sync should be rehashed
+func (e *Engine) takeRehash(syncConfigID uint) bool {
+	e.mutex.Lock()
+	defer e.mutex.Unlock()
+
+	rehash := e.rehash[syncConfigID]
+	delete(e.rehash, syncConfigID)
+	return rehash
+}
+
+// isContentHash returns true if the ETag was replaced by the hash of the content
+func isContentHash(etag string) bool {
+	return strings.HasPrefix(etag, contentHashPrefix)
+}
+
+// unchanged compares the object with its state within the baseline according to the integrity mode.
+// Baselines recorded before the mode of the sync was switched are compared by size until they are recorded again.
+func unchanged(mode string, object *storage.ObjectInfo, b *models.SyncBaseline, etag string, modified time.Time) bool {
+	switch {
+	case mode == IntegrityFast && !modified.IsZero():
+		// Storages report modification times in different precisions when listing and writing objects
+		return object.Size == b.Size && object.LastModified.Truncate(time.Second).Equal(modified.Truncate(time.Second))
+	case isContentHash(object.ETag) != isContentHash(etag):
+		return object.Size == b.Size
+	default:
+		return object.ETag == etag
+	}
+}
+
+// outdated returns true if the baseline lacks the state required by the integrity mode, e.g. after it was switched
+func outdated(mode string, s, d *storage.ObjectInfo, b *models.SyncBaseline) bool {
+	if mode == IntegrityFast {
+		return b.SourceModifiedAt.IsZero() || b.DestModifiedAt.IsZero()
+	}
+	return isContentHash(s.ETag) != isContentHash(b.SourceETag) || isContentHash(d.ETag) != isContentHash(b.DestETag)
+}
+
+// identical returns true if both objects are known to have the same content without comparing them with a baseline
+func identical(mode string, s, d *storage.ObjectInfo) bool {
+	if mode == IntegrityParanoid {
+		return s.ETag == d.ETag
+	}
+	return s.Size == d.Size
+}
+
+// paranoidBaseline returns both objects with the content hash of the other side if the transferred side was only
+// stat'ed, since both sides hold the same content after the transfer
+func paranoidBaseline(source, dest *storage.ObjectInfo) (*storage.ObjectInfo, *storage.ObjectInfo) {
+	switch {
+	case isContentHash(source.ETag) && !isContentHash(dest.ETag):
+		copied := *dest
+		copied.ETag = source.ETag
+		return source, &copied
+	case !isContentHash(source.ETag) && isContentHash(dest.ETag):
+		copied := *source
+		copied.ETag = dest.ETag
+		return &copied, dest
+	default:
+		return source, dest
+	}
+}
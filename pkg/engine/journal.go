@@ -0,0 +1,237 @@
+package engine
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"mime"
+	"path"
+	"strings"
+	"time"
+
+	"github.com/mwantia/gosync/pkg/db/models"
+	"github.com/mwantia/gosync/pkg/storage"
+)
+
+// journalRescanInterval is the maximum age of the last full listing of a local side, after which it is listed
+// entirely once more instead of only its changed directories, catching anything the journal missed
+const journalRescanInterval = 24 * time.Hour
+
+// journalCursor is stored with the sync state after complete passes of syncs with a local side
+type journalCursor struct {
+	Side     string `json:"side"`
+	Position string `json:"position"`
+	// Config is a fingerprint of the settings affecting the listing, which is repeated entirely once they change
+	Config    string    `json:"config"`
+	ScannedAt time.Time `json:"scanned_at"`
+}
+
+// journal tracks the change journal of the local side of a plan
+type journal struct {
+	side  string
+	local *storage.LocalStorage
+	// position of the journal before the side was listed, which the next pass reads changes from
+	position  string
+	config    string
+	scannedAt time.Time
+	// changes are the directories changed since the last complete pass, nil if the side is listed entirely
+	changes []storage.DirChange
+}
+
+// openJournal returns the change journal of the local side of the sync, or nil if the side is listed entirely
+// without recording its position. Passes only list the changed directories if the last complete pass recorded
+// a position with the same settings within the rescan interval; baselines stand in for all other files.
+func (e *Engine) openJournal(ctx context.Context, sc *models.SyncConfig, state *models.SyncState, source, dest *side,
+	scope, template string, selections []models.SyncSelection, initial bool) *journal {
+	// Content hashes, followed links and templated destinations can't be derived from the baselines
+	if scope != "" || template != "" || integrityMode(sc) == IntegrityParanoid || symlinkPolicy(sc) == storage.SymlinkFollow {
+		return nil
+	}
+
+	jr := &journal{}
+	switch {
+	case source.backend == nil && dest.backend != nil:
+		jr.side = SideSource
+		jr.local, _ = source.storage.(*storage.LocalStorage)
+	case dest.backend == nil && source.backend != nil:
+		jr.side = SideDest
+		jr.local, _ = dest.storage.(*storage.LocalStorage)
+	}
+	if jr.local == nil {
+		return nil
+	}
+
+	position, err := jr.local.JournalPosition(ctx)
+	if err != nil {
+		return nil
+	}
+	jr.position = position
+	jr.config = journalConfig(sc, jr.local, selections)
+	jr.scannedAt = time.Now().UTC()
+
+	var cursor journalCursor
+	if initial || state.Bootstrap || state.JournalCursor == "" || json.Unmarshal([]byte(state.JournalCursor), &cursor) != nil {
+		return jr
+	}
+	if cursor.Side != jr.side || cursor.Config != jr.config || time.Since(cursor.ScannedAt) > journalRescanInterval {
+		return jr
+	}
+
+	changes, _, err := jr.local.Changes(ctx, cursor.Position)
+	if err != nil {
+		if !errors.Is(err, storage.ErrJournalReset) && !errors.Is(err, storage.ErrJournalUnavailable) {
+			e.mutex.Lock()
+			e.recordError(sc.Name, "", fmt.Errorf("failed to read change journal, listing all files: %w", err))
+			e.mutex.Unlock()
+		}
+		return jr
+	}
+	jr.changes = changes
+	jr.scannedAt = cursor.ScannedAt
+	return jr
+}
+
+// journalConfig returns the fingerprint of the settings affecting the listing of the local side
+func journalConfig(sc *models.SyncConfig, local *storage.LocalStorage, selections []models.SyncSelection) string {
+	root, _ := local.Path("")
+	hash := sha256.New()
+	fmt.Fprintf(hash, "%s\x00%s\x00%s\x00%s\x00%s\x00%s\x00%s\x00", root, sc.Direction, sc.Integrity, sc.Symlinks,
+		sc.Normalization, sc.ReservedNames, sc.IgnorePattern)
+	for _, selection := range selections {
+		fmt.Fprintf(hash, "%s\x00%s\x00", selection.Mode, selection.Path)
+	}
+	return hex.EncodeToString(hash.Sum(nil))[:16]
+}
+
+// listJournal lists the local side by the directories changed according to its journal: files within changed
+// directories are listed, directories moved or created below them are listed recursively, and all other files
+// are taken from their baselines, since they haven't changed since the last complete pass
+func (e *Engine) listJournal(ctx context.Context, s *side, jr *journal, ignore []string, selection *Selection,
+	baselines []models.SyncBaseline) (map[string]storage.ObjectInfo, error) {
+	objects := make(map[string]storage.ObjectInfo)
+	add := func(object storage.ObjectInfo) error {
+		rel := storage.NormalizePath(s.normalization, object.Key)
+		if isIgnored(rel, ignore) || !selection.Selected(rel) {
+			return nil
+		}
+		s.add(objects, object)
+		return nil
+	}
+
+	known := make(map[string]bool)
+	for _, b := range baselines {
+		for dir := path.Dir(b.Path); dir != "."; dir = path.Dir(dir) {
+			known[dir] = true
+		}
+	}
+
+	changed := make(map[string]bool, len(jr.changes))
+	present := make(map[string]bool)
+	for _, change := range jr.changes {
+		// Baselines are recorded by normalized paths, while the journal and listings return the actual names
+		changed[storage.NormalizePath(s.normalization, change.Dir)] = change.Recursive
+		if change.Recursive {
+			if err := e.listRoot(ctx, s, dirPrefix(change.Dir), ignore, selection, objects); err != nil {
+				return nil, err
+			}
+			continue
+		}
+
+		dirs, err := jr.local.ListDir(ctx, change.Dir, add)
+		if err != nil {
+			return nil, err
+		}
+		for _, dir := range dirs {
+			normalized := storage.NormalizePath(s.normalization, dir)
+			present[normalized] = true
+			// Directories without baselines were created or moved in, so their content has no events of its own
+			if !known[normalized] {
+				if err := e.listRoot(ctx, s, dir+"/", ignore, selection, objects); err != nil {
+					return nil, err
+				}
+			}
+		}
+	}
+
+	for i := range baselines {
+		b := &baselines[i]
+		if _, ok := objects[b.Path]; ok || isIgnored(b.Path, ignore) || !selection.Selected(b.Path) {
+			continue
+		}
+		if journalCovered(b.Path, changed, present) {
+			continue
+		}
+
+		object := storage.ObjectInfo{
+			Key:          b.Path,
+			Size:         b.Size,
+			ETag:         b.DestETag,
+			ContentType:  mime.TypeByExtension(path.Ext(b.Path)),
+			LastModified: b.DestModifiedAt,
+		}
+		if jr.side == SideSource {
+			object.ETag, object.LastModified = b.SourceETag, b.SourceModifiedAt
+		}
+		objects[b.Path] = object
+	}
+	return objects, nil
+}
+
+// journalCovered returns true if the listing of the changed directories decides whether the path exists,
+// i.e. the path is below a recursively changed directory, directly within a changed directory,
+// or below a directory that is missing from the listing of its changed parent
+func journalCovered(rel string, changed, present map[string]bool) bool {
+	dir := ""
+	for {
+		recursive, ok := changed[dir]
+		if ok && recursive {
+			return true
+		}
+
+		prefix := dirPrefix(dir)
+		slash := strings.IndexByte(rel[len(prefix):], '/')
+		if slash < 0 {
+			return ok
+		}
+		child := prefix + rel[len(prefix):len(prefix)+slash]
+		if ok && !present[child] {
+			return true
+		}
+		dir = child
+	}
+}
+
+func dirPrefix(dir string) string {
+	if dir == "" {
+		return ""
+	}
+	return dir + "/"
+}
+
+// saveJournal records the position of the journal after a complete pass, so the next pass only lists the directories
+// changed since. Positions of incomplete passes are discarded, their directories are listed again by the next pass.
+func (e *Engine) saveJournal(ctx context.Context, plan *Plan, result *Result, passErr error) {
+	jr := plan.journal
+	if jr == nil || passErr != nil || len(result.Errors) > 0 || result.Deferred > 0 || result.Denied > 0 || result.Held > 0 || len(plan.Denied) > 0 {
+		return
+	}
+	ctx = context.WithoutCancel(ctx)
+
+	data, err := json.Marshal(journalCursor{Side: jr.side, Position: jr.position, Config: jr.config, ScannedAt: jr.scannedAt})
+	if err != nil {
+		return
+	}
+	state, err := loadSyncState(ctx, e.store, plan.Config, e.clientID)
+	if err == nil {
+		state.JournalCursor = string(data)
+		err = saveSyncState(ctx, e.store, state)
+	}
+	if err != nil {
+		e.mutex.Lock()
+		e.recordError(plan.Config.Name, "", fmt.Errorf("failed to save change journal position: %w", err))
+		e.mutex.Unlock()
+	}
+}
@@ -0,0 +1,128 @@
+package engine
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/mwantia/gosync/pkg/backend"
+)
+
+// LeaseOptions configures the leases coordinating the clients writing to the same backends
+type LeaseOptions struct {
+	Enabled bool
+	// TTL is the duration a lease stays valid if its client stops renewing it, e.g. after a crash
+	TTL time.Duration
+}
+
+// written returns the side and path the action writes to or deletes from, or nil if it only changes baselines
+func (plan *Plan) written(action Action) (*side, string) {
+	switch action.Type {
+	case ActionDownload, ActionConflict, ActionDeleteDest:
+		return plan.dest, action.destPath()
+	case ActionUpload, ActionDeleteSource:
+		return plan.source, action.Path
+	default:
+		return nil, ""
+	}
+}
+
+// leased calls fn while holding the lease of the path the action writes to, so no other client writes to it
+// at the same time. The lease is renewed until fn returns, cancelling its context if the lease is lost to
+// another client. Writes to local directories aren't leased, since only this client accesses them.
+func (e *Engine) leased(ctx context.Context, plan *Plan, action Action, fn func(ctx context.Context) error) error {
+	errs := e.leasedAll(ctx, plan, []Action{action}, func(ctx context.Context, errs []error) {
+		errs[0] = fn(ctx)
+	})
+	return errs[0]
+}
+
+// leasedAll calls fn while holding the leases of the paths all actions write to, returning the outcome of each
+// action. Actions whose lease couldn't be acquired fail with that error, and fn only sets the errors of the
+// other actions. Writes of actions failing after a lease was lost report the lost lease instead.
+func (e *Engine) leasedAll(ctx context.Context, plan *Plan, actions []Action, fn func(ctx context.Context, errs []error)) []error {
+	type held struct {
+		leaser *backend.Leaser
+		lease  *backend.Lease
+		action int
+	}
+
+	errs := make([]error, len(actions))
+	var leases []held
+	for i, action := range actions {
+		s, rel := plan.written(action)
+		if !e.leases.Enabled || s == nil || s.backend == nil {
+			continue
+		}
+		leaser := backend.NewLeaser(s.storage, e.clientID, e.leases.TTL)
+		lease, err := leaser.Acquire(ctx, s.key(rel))
+		if err != nil {
+			errs[i] = err
+			continue
+		}
+		leases = append(leases, held{leaser: leaser, lease: lease, action: i})
+	}
+
+	// fn only applies the actions without an error, which are reported as failed from now on
+	pending := make([]bool, len(actions))
+	applied := 0
+	for i := range errs {
+		if pending[i] = errs[i] == nil; pending[i] {
+			applied++
+		}
+	}
+	if applied == 0 {
+		return errs
+	}
+	if len(leases) == 0 {
+		fn(ctx, errs)
+		return errs
+	}
+
+	leaseCtx, cancel := context.WithCancelCause(ctx)
+	var wait sync.WaitGroup
+	wait.Add(1)
+	go func() {
+		defer wait.Done()
+
+		ticker := time.NewTicker(leases[0].leaser.TTL() / 3)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-leaseCtx.Done():
+				return
+			case <-ticker.C:
+				for _, h := range leases {
+					if err := h.leaser.Renew(leaseCtx, h.lease); err != nil && leaseCtx.Err() == nil {
+						cancel(err)
+						return
+					}
+				}
+			}
+		}
+	}()
+
+	fn(leaseCtx, errs)
+	cause := context.Cause(leaseCtx)
+	cancel(nil)
+	wait.Wait()
+	if ctx.Err() == nil && cause != nil {
+		// Report the lost lease instead of the cancelled write
+		for i := range errs {
+			if pending[i] && errs[i] != nil {
+				errs[i] = cause
+			}
+		}
+	}
+
+	// Leases are released even if the pass was cancelled, so other clients don't wait for them to expire
+	for _, h := range leases {
+		if err := h.leaser.Release(context.WithoutCancel(ctx), h.lease); err != nil {
+			e.mutex.Lock()
+			e.recordError(plan.Config.Name, actions[h.action].Path, fmt.Errorf("failed to release lease: %w", err))
+			e.mutex.Unlock()
+		}
+	}
+	return errs
+}
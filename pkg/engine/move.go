@@ -0,0 +1,82 @@
+package engine
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/mwantia/gosync/pkg/db/models"
+	"github.com/mwantia/gosync/pkg/db/store"
+)
+
+// MovePrefix hands the directory of the sync from over to the sync to, which has to cover the same source and
+// destination paths for all clients. The baselines, pending deletions and selections below the directory are
+// moved, so the passes of to continue where from stopped instead of comparing or transferring all files again.
+// The directory is excluded from from afterwards. Moving the root of from requires merge, which removes from.
+func MovePrefix(ctx context.Context, ms store.MetadataStore, from, to *models.SyncConfig, prefix string, merge bool, clientIDs []string) (*store.SyncPrefixMove, int64, error) {
+	if from.ID == to.ID {
+		return nil, 0, fmt.Errorf("can't move paths of sync '%s' to itself", from.Name)
+	}
+	if len(clientIDs) == 0 {
+		return nil, 0, fmt.Errorf("at least one client is required to resolve the paths of the syncs")
+	}
+
+	prefix = CleanSelectionPath(prefix)
+	switch {
+	case prefix == "" && !merge:
+		return nil, 0, fmt.Errorf("moving the root of sync '%s' merges it into sync '%s' and removes it, which has to be requested", from.Name, to.Name)
+	case prefix != "" && merge:
+		return nil, 0, fmt.Errorf("only the root of sync '%s' can be merged into sync '%s'", from.Name, to.Name)
+	}
+
+	move := &store.SyncPrefixMove{
+		FromSyncID: from.ID,
+		FromPrefix: prefix,
+		ToSyncID:   to.ID,
+		Merge:      merge,
+	}
+
+	// Baselines are moved for all clients at once, so the directory has to map to the same target for each of them
+	for i, clientID := range clientIDs {
+		target, err := targetPrefix(from, to, clientID, prefix)
+		if err != nil {
+			return nil, 0, err
+		}
+		if i > 0 && target != move.ToPrefix {
+			return nil, 0, fmt.Errorf("'/%s' of sync '%s' maps to different directories of sync '%s' for clients '%s' and '%s'",
+				prefix, from.Name, to.Name, clientIDs[0], clientID)
+		}
+		move.ToPrefix = target
+	}
+
+	moved, err := ms.MoveSyncPrefix(ctx, *move)
+	if err != nil {
+		return nil, 0, fmt.Errorf("failed to move '/%s' of sync '%s' to sync '%s': %w", prefix, from.Name, to.Name, err)
+	}
+	return move, moved, nil
+}
+
+// targetPrefix returns the directory of to covering the directory of from on both sides for the client
+func targetPrefix(from, to *models.SyncConfig, clientID, prefix string) (string, error) {
+	fromSource, fromDest := ResolvePaths(from, clientID)
+	toSource, toDest := ResolvePaths(to, clientID)
+
+	for _, sc := range []*models.SyncConfig{from, to} {
+		if _, template := SplitPathTemplate(sc.DestPath); template != "" {
+			return "", fmt.Errorf("paths of sync '%s' can't be moved, since its destination contains per-file variables", sc.Name)
+		}
+	}
+
+	source, ok := relativePath(toSource, joinPath(fromSource, prefix))
+	if !ok {
+		return "", fmt.Errorf("source of sync '%s' doesn't contain '%s'", to.Name, joinPath(fromSource, prefix))
+	}
+	dest, ok := relativePath(toDest, joinPath(fromDest, prefix))
+	if !ok {
+		return "", fmt.Errorf("destination of sync '%s' doesn't contain '%s'", to.Name, joinPath(fromDest, prefix))
+	}
+	if source != dest {
+		return "", fmt.Errorf("'/%s' of sync '%s' maps to '/%s' in the source and '/%s' in the destination of sync '%s'",
+			prefix, from.Name, source, dest, to.Name)
+	}
+	return source, nil
+}
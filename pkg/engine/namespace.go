@@ -0,0 +1,120 @@
+package engine
+
+import (
+	"os"
+	"os/user"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"github.com/mwantia/gosync/pkg/db/models"
+	"github.com/mwantia/gosync/pkg/vfs"
+)
+
+// DevicePrefix is the prefix below which isolated syncs store the files of each client
+const DevicePrefix = "devices"
+
+// ResolvePaths returns the source and destination of the sync for the client, expanding
+// the template variables {client_id}, {hostname} and {user} within both paths.
+// Isolated syncs store their files within devices/<client-id>/ below the source backend.
+func ResolvePaths(sc *models.SyncConfig, clientID string) (string, string) {
+	replacer := strings.NewReplacer(
+		"{client_id}", clientID,
+		"{hostname}", hostname(),
+		"{user}", username(),
+	)
+
+	source := replacer.Replace(sc.SourcePath)
+	dest := replacer.Replace(sc.DestPath)
+
+	if sc.Isolated && !IsLocalPath(source) {
+		vp := vfs.ParsePath(source)
+		source = path.Join(vp.Backend, DevicePrefix, clientID, vp.Key)
+	}
+
+	return source, dest
+}
+
+// ScopeOf returns the path relative to the sync if p is a virtual or local path within its source
+// or destination. Templated destinations can't be mapped back and are only matched by their source.
+func ScopeOf(sc *models.SyncConfig, clientID, p string) (string, bool) {
+	source, dest := ResolvePaths(sc, clientID)
+	dest, template := SplitPathTemplate(dest)
+
+	roots := []string{source}
+	if template == "" {
+		roots = append(roots, dest)
+	}
+
+	for _, root := range roots {
+		if rel, ok := relativePath(root, p); ok {
+			return rel, true
+		}
+	}
+	return "", false
+}
+
+// relativePath returns p relative to root if both are either local or virtual paths and p is within root
+func relativePath(root, p string) (string, bool) {
+	if IsLocalPath(root) != IsLocalPath(p) {
+		return "", false
+	}
+
+	if IsLocalPath(p) {
+		rel, err := filepath.Rel(filepath.Clean(root), filepath.Clean(p))
+		if err != nil || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+			return "", false
+		}
+		return CleanSelectionPath(filepath.ToSlash(rel)), true
+	}
+
+	dir := CleanSelectionPath(root)
+	rel := CleanSelectionPath(p)
+	if !withinDir(rel, dir) {
+		return "", false
+	}
+	return strings.TrimPrefix(strings.TrimPrefix(rel, dir), "/"), true
+}
+
+// joinPath appends the path relative to a sync to one of its local or virtual roots
+func joinPath(root, rel string) string {
+	if IsLocalPath(root) {
+		return filepath.Join(root, filepath.FromSlash(rel))
+	}
+	return path.Join(root, rel)
+}
+
+// RemoteRoots returns the virtual paths of the sync for the client, skipping local directories.
+// Templated destinations are reduced to the directory before their first variable.
+func RemoteRoots(sc *models.SyncConfig, clientID string) []vfs.Path {
+	source, dest := ResolvePaths(sc, clientID)
+	dest, _ = SplitPathTemplate(dest)
+
+	var roots []vfs.Path
+	for _, root := range []string{source, dest} {
+		if root == "" || IsLocalPath(root) {
+			continue
+		}
+		if vp := vfs.ParsePath(root); !vp.IsRoot() {
+			roots = append(roots, vp)
+		}
+	}
+	return roots
+}
+
+func hostname() string {
+	name, err := os.Hostname()
+	if err != nil {
+		return "unknown"
+	}
+	return name
+}
+
+func username() string {
+	u, err := user.Current()
+	if err != nil || u.Username == "" {
+		return "unknown"
+	}
+	// Windows usernames are prefixed with the domain
+	return u.Username[strings.LastIndex(u.Username, `\`)+1:]
+}
@@ -0,0 +1,46 @@
+package engine
+
+import (
+	"errors"
+
+	"github.com/mwantia/gosync/pkg/db/models"
+	"github.com/mwantia/gosync/pkg/storage"
+)
+
+// ValidNormalization returns true if the Unicode normalization policy is supported, "" being the same as nfc
+func ValidNormalization(policy string) bool {
+	return policy == "" || policy == storage.NormalizationNFC || policy == storage.NormalizationNFD || policy == storage.NormalizationNone
+}
+
+// normalizationPolicy returns the Unicode normalization policy of the sync, defaulting to nfc
+func normalizationPolicy(sc *models.SyncConfig) string {
+	if sc.Normalization == "" {
+		return storage.NormalizationNFC
+	}
+	return sc.Normalization
+}
+
+// applyNormalization sets the normalization policy of the sync on all sides. Local directories additionally resolve
+// paths to existing names differing in their normalization, since they aren't necessarily listed beforehand.
+func applyNormalization(sc *models.SyncConfig, sides ...*side) {
+	policy := normalizationPolicy(sc)
+	for _, s := range sides {
+		s.normalization = policy
+		if local, ok := s.storage.(*storage.LocalStorage); ok {
+			local.SetNormalization(policy)
+		}
+	}
+}
+
+// recordCollisions reports the paths skipped while listing the sides, as their names only differ from another
+// object in their normalization and syncing both would overwrite one with the other
+func (e *Engine) recordCollisions(sc *models.SyncConfig, sides ...*side) {
+	e.mutex.Lock()
+	defer e.mutex.Unlock()
+
+	for _, s := range sides {
+		for _, rel := range s.collisions {
+			e.recordError(sc.Name, s.prefix+rel, errors.New("skipped, name only differs from another file in its Unicode normalization"))
+		}
+	}
+}
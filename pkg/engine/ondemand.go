@@ -0,0 +1,212 @@
+package engine
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/mwantia/gosync/pkg/db/models"
+	"github.com/mwantia/gosync/pkg/storage"
+)
+
+// onDemand keeps the files of a sync in files-on-demand mode as empty placeholders within its local destination
+// until they are pinned or opened. Placeholders count as opened once they were read after they were written, which
+// relies on the filesystem recording access times, or once they were touched without writing any content.
+type onDemand struct {
+	local *storage.LocalStorage
+	dest  *side
+	// Ordered from the most to the least specific path
+	pins []models.SyncPin
+	// opened contains the placeholders read or touched since they were written
+	opened map[string]bool
+	// listed contains the ETags of the placeholders as listed, before they were replaced by their baselines
+	listed map[string]string
+}
+
+// ValidOnDemand returns an error if the files of the sync can't be downloaded on demand, which requires a local
+// destination without per-file variables that receives the files of the source
+func ValidOnDemand(sc *models.SyncConfig) error {
+	if !sc.OnDemand {
+		return nil
+	}
+	if sc.Direction == DirectionUpload {
+		return fmt.Errorf("files on demand require the '%s' or '%s' direction", DirectionBidirectional, DirectionDownload)
+	}
+	root, template := SplitPathTemplate(sc.DestPath)
+	if !IsLocalPath(root) {
+		return errors.New("files on demand require a local destination")
+	}
+	if template != "" {
+		return errors.New("files on demand don't support per-file variables")
+	}
+	return nil
+}
+
+// openOnDemand returns the files-on-demand state of the sync on this client, or nil if the sync downloads all files
+func (e *Engine) openOnDemand(ctx context.Context, sc *models.SyncConfig, dest *side) (*onDemand, error) {
+	if !sc.OnDemand {
+		return nil, nil
+	}
+	if err := ValidOnDemand(sc); err != nil {
+		return nil, fmt.Errorf("invalid sync '%s': %w", sc.Name, err)
+	}
+	local, ok := dest.storage.(*storage.LocalStorage)
+	if !ok {
+		return nil, fmt.Errorf("invalid sync '%s': files on demand require a local destination", sc.Name)
+	}
+
+	pins, err := e.store.ListSyncPins(ctx, sc.ID, e.clientID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list pins of sync '%s': %w", sc.Name, err)
+	}
+	for i := range pins {
+		pins[i].Path = CleanSelectionPath(pins[i].Path)
+	}
+	sort.Slice(pins, func(i, j int) bool {
+		return len(pins[i].Path) > len(pins[j].Path)
+	})
+
+	return &onDemand{
+		local:  local,
+		dest:   dest,
+		pins:   pins,
+		opened: make(map[string]bool),
+		listed: make(map[string]string),
+	}, nil
+}
+
+// pin returns the most specific pin of the path, or nil if neither the path nor its directories are pinned or unpinned
+func (od *onDemand) pin(rel string) *models.SyncPin {
+	for i := range od.pins {
+		if withinDir(rel, od.pins[i].Path) {
+			return &od.pins[i]
+		}
+	}
+	return nil
+}
+
+// substitute replaces the listed placeholders that are still empty with the state recorded in their baselines,
+// so opening or touching a placeholder isn't mistaken for a change of its content. Since reading files updates
+// their access time, this has to happen before the content of the destination is hashed, which skips objects
+// already carrying a content hash.
+func (od *onDemand) substitute(objects map[string]storage.ObjectInfo, baselines []models.SyncBaseline) {
+	if od == nil {
+		return
+	}
+
+	for i := range baselines {
+		b := &baselines[i]
+		object, ok := objects[b.Path]
+		if !b.Placeholder || !ok || object.Size != 0 {
+			continue
+		}
+
+		if !object.LastModified.Truncate(time.Second).Equal(b.DestModifiedAt.Truncate(time.Second)) {
+			od.opened[b.Path] = true
+		} else if accessed, ok, err := od.local.AccessTime(od.dest.key(b.Path)); err == nil && ok && accessed.After(object.LastModified) {
+			od.opened[b.Path] = true
+		}
+
+		od.listed[b.Path] = object.ETag
+		object.Size, object.ETag, object.LastModified = b.Size, b.DestETag, b.DestModifiedAt
+		objects[b.Path] = object
+	}
+}
+
+// decide adjusts the action of the path to the files-on-demand mode. Files that are neither pinned nor opened are
+// downloaded as placeholders, unless the destination holds their content. Unchanged placeholders are downloaded
+// once they are pinned or opened, while unchanged files below unpinned paths are replaced by placeholders.
+func (od *onDemand) decide(action Action, ok bool, s, d *storage.ObjectInfo, b *models.SyncBaseline) (Action, bool) {
+	pin := od.pin(action.Path)
+	pinned := pin != nil && pin.Pinned
+	unpinned := pin != nil && !pin.Pinned
+	placeholder := b != nil && b.Placeholder
+	opened := od.opened[action.Path]
+
+	if ok {
+		switch {
+		case action.Type == ActionRecord:
+			action.Placeholder = placeholder
+		case action.Type == ActionDownload && !pinned && !opened && (d == nil || placeholder):
+			action.Placeholder, action.Size = true, 0
+		}
+		return action, true
+	}
+
+	if s == nil || d == nil || b == nil {
+		return action, false
+	}
+	switch {
+	case placeholder && pinned:
+		action.Type, action.Size, action.Reason = ActionDownload, s.Size, "pinned"
+	case placeholder && opened:
+		action.Type, action.Size, action.Reason = ActionDownload, s.Size, "opened"
+	case !placeholder && unpinned:
+		action.Type, action.Reason, action.Placeholder = ActionDownload, "unpinned", true
+	default:
+		return action, false
+	}
+	return action, true
+}
+
+// putPlaceholder writes an empty placeholder of the source object to the destination. Its access and modification
+// time are set to the modification time of the source, so reading the placeholder updates its access time. Files
+// changed since the pass was planned aren't replaced.
+func (e *Engine) putPlaceholder(ctx context.Context, plan *Plan, action Action) (*storage.ObjectInfo, error) {
+	opts := storage.PutOptions{
+		ModifiedAt: action.source.LastModified,
+	}
+	switch etag, listed := plan.onDemand.listed[action.Path]; {
+	case listed:
+		opts.IfMatch = etag
+	case action.dest == nil:
+		opts.IfNoneMatch = true
+	case !isContentHash(action.dest.ETag):
+		opts.IfMatch = action.dest.ETag
+	}
+
+	key := plan.dest.key(action.destPath())
+	info, err := plan.dest.storage.Put(ctx, key, strings.NewReader(""), 0, opts)
+	if errors.Is(err, storage.ErrPreconditionFailed) {
+		return nil, fmt.Errorf("failed to write placeholder of '%s': file changed since the pass was planned", key)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	source := plan.source.key(action.Path)
+	if err := e.preserveAttributes(ctx, plan, plan.source, plan.dest, source, key); err != nil {
+		return nil, err
+	}
+	return info, nil
+}
+
+// openCached reads the content of files downloaded by syncs with files on demand through the content cache, so files
+// opened again after they were replaced by placeholders aren't downloaded from the backend again
+func (e *Engine) openCached(ctx context.Context, plan *Plan, from *side, key string, stat *storage.ObjectInfo) (io.ReadCloser, error) {
+	if e.cache == nil || plan.onDemand == nil || from != plan.source || from.backend == nil || e.isDeduplicated(ctx, from, key, stat) {
+		return e.openTransfer(ctx, from, key, stat)
+	}
+	return e.decompress(ctx, from, key, stat, e.cache.Open(ctx, from.storage, from.backend.ID, *stat))
+}
+
+// clearUnpinned removes the unpinned paths within the scope of a complete pass, whose files were replaced by placeholders
+func (e *Engine) clearUnpinned(ctx context.Context, plan *Plan) error {
+	if plan.onDemand == nil {
+		return nil
+	}
+
+	for _, pin := range plan.onDemand.pins {
+		if pin.Pinned || !withinDir(pin.Path, plan.Scope) {
+			continue
+		}
+		if err := e.store.DeleteSyncPin(ctx, plan.Config.ID, e.clientID, pin.Path); err != nil {
+			return fmt.Errorf("failed to remove unpinned path '%s' of sync '%s': %w", pin.Path, plan.Config.Name, err)
+		}
+	}
+	return nil
+}
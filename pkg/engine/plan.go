@@ -0,0 +1,426 @@
+package engine
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/mwantia/gosync/pkg/compress"
+	"github.com/mwantia/gosync/pkg/db/models"
+	"github.com/mwantia/gosync/pkg/storage"
+)
+
+// Sync directions of a SyncConfig
+const (
+	DirectionBidirectional = "bidirectional"
+	DirectionDownload      = "download"
+	DirectionUpload        = "upload"
+)
+
+// ActionType defines what a sync pass does with a single path
+type ActionType string
+
+const (
+	// ActionDownload copies the source object to the destination
+	ActionDownload ActionType = "download"
+	// ActionUpload copies the destination object to the source
+	ActionUpload       ActionType = "upload"
+	ActionDeleteSource ActionType = "delete-source"
+	ActionDeleteDest   ActionType = "delete-dest"
+	// ActionConflict keeps the source object and uploads the destination object as conflict copy
+	ActionConflict ActionType = "conflict"
+	// ActionRecord only records the baseline of a path that is already in sync
+	ActionRecord ActionType = "record"
+	// ActionForget removes the baseline of a path that was deleted on both sides
+	ActionForget ActionType = "forget"
+)
+
+// Action is a single planned change of a sync pass
+type Action struct {
+	Type   ActionType `json:"type"`
+	Path   string     `json:"path"`
+	Size   int64      `json:"size"`
+	Reason string     `json:"reason"`
+	// Target is the destination path if it differs from the source path due to per-file variables
+	Target string `json:"target,omitempty"`
+	// Placeholder is set if the destination only holds an empty placeholder of the file, see SyncConfig.OnDemand
+	Placeholder bool `json:"placeholder,omitempty"`
+
+	source *storage.ObjectInfo
+	dest   *storage.ObjectInfo
+	// synced is set if the path has been synced before, i.e. has a baseline
+	synced bool
+}
+
+// Plan contains all actions required to bring both sides of a sync in line
+type Plan struct {
+	Config    *models.SyncConfig
+	Actions   []Action
+	Scanned   int
+	Unchanged int
+	// Initial is set for the first pass of the sync on this client, which has no baselines yet
+	Initial bool
+	// Bootstrap is set while the sync only downloads on this client, see SetBootstrap
+	Bootstrap bool
+	// Scope limits the plan to a file or directory relative to the sync, or "" for the whole sync
+	Scope string
+	// Denied contains the directories skipped, since the backend denied listing them
+	Denied []string
+	// Symlinks is the policy for symbolic links within local directories
+	Symlinks string
+	// SkippedLinks contains the symbolic links skipped by the policy, dangling or looping back into a parent directory
+	SkippedLinks []storage.SkippedLink
+	// Journaled is set if only the directories of the local side changed according to its change journal were listed
+	Journaled bool
+
+	source *side
+	dest   *side
+	// state of the sync on this client when the plan was computed
+	state *models.SyncState
+	// journal of the local side, whose position is recorded after a complete pass
+	journal *journal
+	// known is the number of paths with a baseline within the scope
+	known int
+	// onDemand is set if the sync keeps files as placeholders until they are pinned or opened
+	onDemand *onDemand
+	// compress selects the algorithm of files uploaded into backends
+	compress *compress.Policy
+}
+
+// Plan scans both sides of the sync and computes the required actions without changing any data.
+// The plan must be closed once it was executed or isn't needed anymore.
+func (e *Engine) Plan(ctx context.Context, sc *models.SyncConfig) (*Plan, error) {
+	return e.plan(ctx, sc, "")
+}
+
+// plan computes the actions for all paths of the sync within the scope
+func (e *Engine) plan(ctx context.Context, sc *models.SyncConfig, scope string) (*Plan, error) {
+	switch sc.Direction {
+	case DirectionBidirectional, DirectionDownload, DirectionUpload:
+	default:
+		return nil, fmt.Errorf("invalid direction '%s' of sync '%s'", sc.Direction, sc.Name)
+	}
+
+	policy, err := compress.ParsePolicy(sc.Compression, sc.CompressionRules)
+	if err != nil {
+		return nil, fmt.Errorf("invalid compression of sync '%s': %w", sc.Name, err)
+	}
+	rules, err := ParseRules(sc, time.Now())
+	if err != nil {
+		return nil, fmt.Errorf("invalid rules of sync '%s': %w", sc.Name, err)
+	}
+
+	sourcePath, destPath := ResolvePaths(sc, e.clientID)
+
+	// Per-file variables can't be mapped back, so files are only ever copied into the destination
+	destPath, template := SplitPathTemplate(destPath)
+	if template != "" && sc.Direction != DirectionDownload {
+		return nil, fmt.Errorf("invalid destination of sync '%s': per-file variables require the '%s' direction", sc.Name, DirectionDownload)
+	}
+
+	source, err := e.openSide(ctx, sourcePath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open source of sync '%s': %w", sc.Name, err)
+	}
+	dest, err := e.openSide(ctx, destPath)
+	if err != nil {
+		source.close()
+		return nil, fmt.Errorf("failed to open destination of sync '%s': %w", sc.Name, err)
+	}
+	planned := false
+	defer func() {
+		if !planned {
+			source.close()
+			dest.close()
+		}
+	}()
+	var skipped skippedLinks
+	skipped.apply(sc, source, dest)
+	applyNormalization(sc, source, dest)
+	applyReservedNames(sc, source, dest)
+
+	state, err := loadSyncState(ctx, e.store, sc, e.clientID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load state of sync '%s': %w", sc.Name, err)
+	}
+
+	ignore := ParseIgnorePatterns(sc.IgnorePattern)
+
+	selections, err := e.store.ListSyncSelections(ctx, sc.ID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list selections of sync '%s': %w", sc.Name, err)
+	}
+	selection := NewSelection(selections).Within(scope)
+
+	baselines, err := e.store.ListSyncBaselines(ctx, sc.ID, e.clientID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list baselines of sync '%s': %w", sc.Name, err)
+	}
+	od, err := e.openOnDemand(ctx, sc, dest)
+	if err != nil {
+		return nil, err
+	}
+	// The position of the journal is taken before listing, so changes made while listing are seen by the next pass
+	jr := e.openJournal(ctx, sc, state, source, dest, scope, template, selections, len(baselines) == 0)
+	journaled := jr != nil && jr.changes != nil
+
+	var sourceObjects, destObjects map[string]storage.ObjectInfo
+	var sourceDenied, destDenied []string
+	if journaled && jr.side == SideSource {
+		sourceObjects, err = e.listJournal(ctx, source, jr, ignore, selection, baselines)
+	} else {
+		sourceObjects, sourceDenied, err = e.list(ctx, sc, source, SideSource, ignore, selection)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to list source of sync '%s': %w", sc.Name, err)
+	}
+	// Templated destinations are only matched against the selected source objects
+	destSelection := selection
+	if template != "" {
+		destSelection = NewSelection(nil)
+	}
+	if journaled && jr.side == SideDest {
+		destObjects, err = e.listJournal(ctx, dest, jr, ignore, destSelection, baselines)
+	} else {
+		destObjects, destDenied, err = e.list(ctx, sc, dest, SideDest, ignore, destSelection)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to list destination of sync '%s': %w", sc.Name, err)
+	}
+	e.recordCollisions(sc, source, dest)
+
+	// Paths below roots that couldn't be listed on either side are left untouched, as if they were outside of the scope
+	denied := append(sourceDenied, destDenied...)
+	for _, objects := range []map[string]storage.ObjectInfo{sourceObjects, destObjects} {
+		for rel := range objects {
+			if withinAny(rel, denied) {
+				delete(objects, rel)
+			}
+		}
+	}
+
+	if err := e.substituteCompressed(ctx, source, sourceObjects); err != nil {
+		return nil, fmt.Errorf("failed to list source of sync '%s': %w", sc.Name, err)
+	}
+	if err := e.substituteCompressed(ctx, dest, destObjects); err != nil {
+		return nil, fmt.Errorf("failed to list destination of sync '%s': %w", sc.Name, err)
+	}
+	od.substitute(destObjects, baselines)
+	e.applyRules(ctx, rules, source, dest, sourceObjects, destObjects)
+
+	// Hashing the content is the most expensive part of the scan, so it's done after all objects were listed
+	mode := integrityMode(sc)
+	if mode == IntegrityParanoid {
+		rehash := e.takeRehash(sc.ID)
+		if err := e.hashObjects(ctx, source, sourceObjects, rehash); err != nil {
+			return nil, fmt.Errorf("failed to hash source of sync '%s': %w", sc.Name, err)
+		}
+		if err := e.hashObjects(ctx, dest, destObjects, rehash); err != nil {
+			return nil, fmt.Errorf("failed to hash destination of sync '%s': %w", sc.Name, err)
+		}
+	}
+
+	var targets map[string]string
+	if template != "" {
+		destObjects, targets, err = e.mapTemplate(ctx, template, source, sourceObjects, destObjects)
+		if err != nil {
+			return nil, fmt.Errorf("failed to map destination of sync '%s': %w", sc.Name, err)
+		}
+	}
+
+	known := make(map[string]*models.SyncBaseline, len(baselines))
+	paths := make(map[string]bool, len(sourceObjects)+len(destObjects))
+	for i := range baselines {
+		// Baselines outside of the scope aren't deleted, they just weren't listed
+		if !withinDir(baselines[i].Path, scope) || withinAny(baselines[i].Path, denied) {
+			continue
+		}
+		known[baselines[i].Path] = &baselines[i]
+		paths[baselines[i].Path] = true
+	}
+	for rel := range sourceObjects {
+		paths[rel] = true
+	}
+	for rel := range destObjects {
+		paths[rel] = true
+	}
+
+	plan := &Plan{
+		Config:       sc,
+		Initial:      len(baselines) == 0,
+		Bootstrap:    state.Bootstrap,
+		Scope:        scope,
+		Denied:       denied,
+		Symlinks:     symlinkPolicy(sc),
+		SkippedLinks: skipped.list(ignore),
+		Journaled:    journaled,
+		source:       source,
+		dest:         dest,
+		state:        state,
+		journal:      jr,
+		known:        len(known),
+		onDemand:     od,
+		compress:     policy,
+	}
+
+	for rel := range paths {
+		var s, d *storage.ObjectInfo
+		if object, ok := sourceObjects[rel]; ok {
+			s = &object
+		}
+		if object, ok := destObjects[rel]; ok {
+			d = &object
+		}
+		if s != nil || d != nil {
+			plan.Scanned++
+		}
+
+		var action Action
+		var ok bool
+		if plan.Bootstrap {
+			action, ok = decideBootstrap(mode, rel, s, d, known[rel])
+		} else {
+			action, ok = decide(mode, sc.Direction, rel, s, d, known[rel])
+		}
+		if od != nil {
+			action, ok = od.decide(action, ok, s, d, known[rel])
+		}
+		if !ok {
+			plan.Unchanged++
+			continue
+		}
+		action.Target = targets[rel]
+		action.synced = known[rel] != nil
+		plan.Actions = append(plan.Actions, action)
+	}
+
+	sort.Slice(plan.Actions, func(i, j int) bool {
+		return plan.Actions[i].Path < plan.Actions[j].Path
+	})
+
+	if err := e.annotateDeletions(ctx, plan); err != nil {
+		return nil, err
+	}
+
+	planned = true
+	return plan, nil
+}
+
+// Close releases the storages of both sides of the plan
+func (plan *Plan) Close() {
+	plan.source.close()
+	plan.dest.close()
+}
+
+// decide compares both sides against the baseline according to the integrity mode and returns the action for the path, if any
+func decide(mode, direction, rel string, s, d *storage.ObjectInfo, b *models.SyncBaseline) (Action, bool) {
+	action := Action{
+		Path:   rel,
+		source: s,
+		dest:   d,
+	}
+
+	if s == nil && d == nil {
+		action.Type, action.Reason = ActionForget, "deleted on both sides"
+		return action, b != nil
+	}
+
+	// Without baseline, objects of equal size (or content in paranoid mode) on both sides are considered in sync
+	if b == nil && s != nil && d != nil && identical(mode, s, d) {
+		action.Type, action.Size, action.Reason = ActionRecord, s.Size, "already in sync"
+		return action, true
+	}
+
+	sourceChanged := changed(s, b, func(b *models.SyncBaseline) bool {
+		return unchanged(mode, s, b, b.SourceETag, b.SourceModifiedAt)
+	})
+	destChanged := changed(d, b, func(b *models.SyncBaseline) bool {
+		return unchanged(mode, d, b, b.DestETag, b.DestModifiedAt)
+	})
+
+	// Both sides changed to the same content, e.g. after a pass recorded the hash of a source that changed during its transfer
+	if sourceChanged && destChanged && mode == IntegrityParanoid && s != nil && d != nil && s.ETag == d.ETag {
+		action.Type, action.Size, action.Reason = ActionRecord, s.Size, "changed identically on both sides"
+		return action, true
+	}
+
+	if !sourceChanged && !destChanged && b != nil && s != nil && d != nil && outdated(mode, s, d, b) {
+		action.Type, action.Size, action.Reason = ActionRecord, s.Size, "recorded for integrity mode "+mode
+		return action, true
+	}
+
+	switch direction {
+	case DirectionDownload:
+		if !sourceChanged && !destChanged {
+			return action, false
+		}
+		return mirror(action, s, d, b, sourceChanged, ActionDownload, ActionDeleteDest, "source")
+
+	case DirectionUpload:
+		if !sourceChanged && !destChanged {
+			return action, false
+		}
+		return mirror(action, d, s, b, destChanged, ActionUpload, ActionDeleteSource, "destination")
+
+	default:
+		switch {
+		case sourceChanged && destChanged:
+			if s != nil && d != nil {
+				action.Type, action.Size, action.Reason = ActionConflict, d.Size, "changed on both sides"
+				return action, true
+			}
+			// A change always wins over a deletion
+			if s != nil {
+				action.Type, action.Size, action.Reason = ActionDownload, s.Size, "changed in source, deleted in destination"
+			} else {
+				action.Type, action.Size, action.Reason = ActionUpload, d.Size, "changed in destination, deleted in source"
+			}
+			return action, true
+
+		case sourceChanged:
+			return mirror(action, s, d, b, true, ActionDownload, ActionDeleteDest, "source")
+
+		case destChanged:
+			return mirror(action, d, s, b, true, ActionUpload, ActionDeleteSource, "destination")
+		}
+	}
+
+	return action, false
+}
+
+// mirror makes the target match the origin, only deleting objects that were synced before
+func mirror(action Action, origin, target *storage.ObjectInfo, b *models.SyncBaseline, originChanged bool, copyType, deleteType ActionType, name string) (Action, bool) {
+	switch {
+	case origin != nil:
+		action.Type, action.Size = copyType, origin.Size
+		switch {
+		case b == nil:
+			action.Reason = "new in " + name
+		case originChanged:
+			action.Reason = "modified in " + name
+		default:
+			action.Reason = "diverged from " + name
+		}
+	case b != nil:
+		action.Type, action.Size, action.Reason = deleteType, target.Size, "deleted in "+name
+	default:
+		return action, false
+	}
+	return action, true
+}
+
+// destPath returns the path of the action within the destination
+func (a Action) destPath() string {
+	if a.Target != "" {
+		return a.Target
+	}
+	return a.Path
+}
+
+func changed(object *storage.ObjectInfo, b *models.SyncBaseline, unchanged func(*models.SyncBaseline) bool) bool {
+	if b == nil {
+		return object != nil
+	}
+	return object == nil || !unchanged(b)
+}
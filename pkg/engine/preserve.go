@@ -0,0 +1,96 @@
+package engine
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+
+	"github.com/mwantia/gosync/pkg/db/store"
+	"github.com/mwantia/gosync/pkg/storage"
+)
+
+// ValidPreserve returns true if the POSIX metadata listed by the value can be preserved, "" preserving none
+func ValidPreserve(value string) bool {
+	_, err := storage.ParsePreserve(value)
+	return err == nil
+}
+
+// preserveAttributes copies the POSIX metadata preserved by the sync from the source of a transfer to its destination.
+// Metadata of local files is read from and restored to the files, while backends keep it in the records of their files.
+func (e *Engine) preserveAttributes(ctx context.Context, plan *Plan, from, to *side, fromKey, toKey string) error {
+	preserve, err := storage.ParsePreserve(plan.Config.Preserve)
+	if err != nil {
+		return fmt.Errorf("invalid preserved metadata of sync '%s': %w", plan.Config.Name, err)
+	}
+	if !preserve.Any() {
+		return nil
+	}
+
+	attrs, err := e.attributes(ctx, from, fromKey, preserve)
+	if err != nil || attrs == nil {
+		return err
+	}
+
+	if local, ok := to.storage.(*storage.LocalStorage); ok {
+		if local.IsLink(toKey) {
+			return nil
+		}
+		return local.SetAttributes(toKey, attrs, preserve)
+	}
+	if to.backend == nil {
+		return nil
+	}
+
+	record, err := e.store.GetFile(ctx, to.backend.ID, toKey)
+	if err != nil {
+		return fmt.Errorf("failed to load metadata of '%s': %w", toKey, err)
+	}
+	record.Mode = attrs.Mode
+	record.Owner = attrs.Owner
+	record.Xattrs = ""
+	if len(attrs.Xattrs) > 0 {
+		data, err := json.Marshal(attrs.Xattrs)
+		if err != nil {
+			return err
+		}
+		record.Xattrs = string(data)
+	}
+	if err := e.store.UpdateFile(ctx, record); err != nil {
+		return fmt.Errorf("failed to record metadata of '%s': %w", toKey, err)
+	}
+	return nil
+}
+
+// attributes returns the POSIX metadata of the object, or nil if none is known, e.g. for objects of backends
+// that weren't uploaded by a sync preserving it
+func (e *Engine) attributes(ctx context.Context, s *side, key string, preserve storage.Preserve) (*storage.Attributes, error) {
+	if local, ok := s.storage.(*storage.LocalStorage); ok {
+		if local.IsLink(key) {
+			return nil, nil
+		}
+		return local.Attributes(key, preserve)
+	}
+	if s.backend == nil {
+		return nil, nil
+	}
+
+	record, err := e.store.GetFile(ctx, s.backend.ID, key)
+	if errors.Is(err, store.ErrNotFound) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to load metadata of '%s': %w", key, err)
+	}
+
+	attrs := &storage.Attributes{
+		Mode:  record.Mode,
+		Owner: record.Owner,
+	}
+	if record.Xattrs != "" {
+		if err := json.Unmarshal([]byte(record.Xattrs), &attrs.Xattrs); err != nil {
+			return nil, fmt.Errorf("invalid extended attributes of '%s': %w", key, err)
+		}
+	}
+	return attrs, nil
+}
@@ -0,0 +1,297 @@
+package engine
+
+import (
+	"context"
+	"io"
+	"sort"
+	"sync/atomic"
+	"time"
+
+	"github.com/mwantia/gosync/pkg/db/models"
+)
+
+// maxRecentErrors limits the number of errors kept for status reporting
+const maxRecentErrors = 50
+
+// Phase is the current step of a running sync pass
+type Phase string
+
+const (
+	// PhaseEnumerate lists both sides and computes the plan, which determines the totals of the pass
+	PhaseEnumerate Phase = "enumerate"
+	// PhaseIndex records the baselines of paths that are already in sync without touching any data
+	PhaseIndex Phase = "index"
+	// PhaseTransfer copies and deletes content
+	PhaseTransfer Phase = "transfer"
+)
+
+// Progress describes a sync pass that is currently being executed
+type Progress struct {
+	SyncConfigID uint      `json:"sync_config_id"`
+	Name         string    `json:"name"`
+	StartedAt    time.Time `json:"started_at"`
+	Phase        Phase     `json:"phase"`
+	// PhaseStartedAt is the start of the current phase, which is used for estimating the remaining duration
+	PhaseStartedAt time.Time `json:"phase_started_at"`
+	// Initial is set for the first pass of the sync on this client
+	Initial   bool  `json:"initial"`
+	Actions   int   `json:"actions"`
+	Completed int   `json:"completed"`
+	Failed    int   `json:"failed"`
+	Bytes     int64 `json:"bytes"`
+	BytesDone int64 `json:"bytes_done"`
+	// Active contains all actions that are currently applied
+	Active []Transfer `json:"active"`
+	// Deadline is the soft deadline of the pass, after which no further transfers are started
+	Deadline time.Time `json:"deadline,omitempty"`
+	// Bootstrap is set while the sync only downloads on this client
+	Bootstrap bool `json:"bootstrap"`
+}
+
+// Transfer describes the progress of a single action that is currently applied
+type Transfer struct {
+	// ID is the ID the action had within the transfer queue, which cancels the transfer
+	ID        uint64     `json:"id"`
+	Type      ActionType `json:"type"`
+	Path      string     `json:"path"`
+	Size      int64      `json:"size"`
+	BytesDone int64      `json:"bytes_done"`
+}
+
+// Queued returns the number of actions that haven't been started yet
+func (p Progress) Queued() int {
+	return max(p.Actions-p.Completed-p.Failed-len(p.Active), 0)
+}
+
+// Fraction returns the completed share of the pass between 0 and 1, weighted by bytes if known
+func (p Progress) Fraction() float64 {
+	switch {
+	case p.Bytes > 0:
+		return min(float64(p.BytesDone)/float64(p.Bytes), 1)
+	case p.Actions > 0:
+		return float64(p.Completed+p.Failed) / float64(p.Actions)
+	default:
+		return 0
+	}
+}
+
+// ETA estimates the remaining duration of the pass based on its progress so far, or 0 if unknown
+func (p Progress) ETA(now time.Time) time.Duration {
+	fraction := p.Fraction()
+	if p.Phase == PhaseEnumerate || fraction <= 0 || fraction >= 1 {
+		return 0
+	}
+
+	// Enumerating and indexing don't transfer any bytes
+	started := p.StartedAt
+	if p.Bytes > 0 && !p.PhaseStartedAt.IsZero() {
+		started = p.PhaseStartedAt
+	}
+
+	elapsed := now.Sub(started)
+	return time.Duration(float64(elapsed) * (1 - fraction) / fraction)
+}
+
+// RecentError is a failure of a sync pass or one of its actions
+type RecentError struct {
+	Time  time.Time `json:"time"`
+	Sync  string    `json:"sync"`
+	Path  string    `json:"path,omitempty"`
+	Error string    `json:"error"`
+}
+
+// pass tracks the progress of a running sync pass
+type pass struct {
+	progress Progress
+	active   map[string]*transfer
+	// queue holds the transfers that haven't been started yet, once the transfer phase started
+	queue *transferQueue
+	// hardDeadline cancels the in-flight transfers of the pass
+	hardDeadline time.Time
+}
+
+// transfer tracks the bytes read by a running action
+type transfer struct {
+	id     uint64
+	action Action
+	done   atomic.Int64
+	// cancel aborts the action with either ErrCancelled or errRequeued as cause
+	cancel context.CancelCauseFunc
+}
+
+// wrap counts the bytes read from the reader, unless the transfer isn't tracked
+func (t *transfer) wrap(r io.Reader) io.Reader {
+	if t == nil {
+		return r
+	}
+	return &transferReader{reader: r, transfer: t}
+}
+
+type transferReader struct {
+	reader   io.Reader
+	transfer *transfer
+}
+
+func (r *transferReader) Read(p []byte) (int, error) {
+	n, err := r.reader.Read(p)
+	r.transfer.done.Add(int64(n))
+	return n, err
+}
+
+// Progress returns the progress of all running sync passes
+func (e *Engine) Progress() []Progress {
+	e.mutex.Lock()
+	defer e.mutex.Unlock()
+
+	result := make([]Progress, 0, len(e.passes))
+	for _, p := range e.passes {
+		progress := p.progress
+		progress.Active = make([]Transfer, 0, len(p.active))
+		for _, t := range p.active {
+			done := min(t.done.Load(), t.action.transferred())
+			progress.BytesDone += done
+			progress.Active = append(progress.Active, Transfer{
+				ID:        t.id,
+				Type:      t.action.Type,
+				Path:      t.action.Path,
+				Size:      t.action.Size,
+				BytesDone: done,
+			})
+		}
+		sort.Slice(progress.Active, func(i, j int) bool {
+			return progress.Active[i].Path < progress.Active[j].Path
+		})
+		result = append(result, progress)
+	}
+
+	sort.Slice(result, func(i, j int) bool {
+		return result[i].StartedAt.Before(result[j].StartedAt)
+	})
+	return result
+}
+
+// RecentErrors returns the most recent errors of all sync passes, newest first
+func (e *Engine) RecentErrors() []RecentError {
+	e.mutex.Lock()
+	defer e.mutex.Unlock()
+
+	result := make([]RecentError, len(e.errors))
+	for i, err := range e.errors {
+		result[len(e.errors)-1-i] = err
+	}
+	return result
+}
+
+func (e *Engine) begin(sc *models.SyncConfig) *pass {
+	now := time.Now().UTC()
+	soft, hard := Deadlines(sc, now)
+	p := &pass{
+		progress: Progress{
+			SyncConfigID:   sc.ID,
+			Name:           sc.Name,
+			StartedAt:      now,
+			Phase:          PhaseEnumerate,
+			PhaseStartedAt: now,
+			Deadline:       soft.UTC(),
+		},
+		active:       make(map[string]*transfer),
+		hardDeadline: hard,
+	}
+
+	e.mutex.Lock()
+	defer e.mutex.Unlock()
+
+	e.passes[sc.ID] = p
+	return p
+}
+
+// planned sets the totals of the pass once its plan is known
+func (e *Engine) planned(p *pass, plan *Plan) {
+	e.mutex.Lock()
+	defer e.mutex.Unlock()
+
+	p.progress.Initial = plan.Initial
+	p.progress.Bootstrap = plan.Bootstrap
+	p.progress.Actions = len(plan.Actions)
+	for _, action := range plan.Actions {
+		p.progress.Bytes += action.transferred()
+	}
+}
+
+func (e *Engine) setPhase(p *pass, phase Phase) {
+	e.mutex.Lock()
+	defer e.mutex.Unlock()
+
+	p.progress.Phase = phase
+	p.progress.PhaseStartedAt = time.Now().UTC()
+}
+
+func (e *Engine) end(p *pass) {
+	e.mutex.Lock()
+	defer e.mutex.Unlock()
+
+	if e.passes[p.progress.SyncConfigID] == p {
+		delete(e.passes, p.progress.SyncConfigID)
+	}
+}
+
+func (e *Engine) started(p *pass, id uint64, action Action, cancel context.CancelCauseFunc) *transfer {
+	e.mutex.Lock()
+	defer e.mutex.Unlock()
+
+	t := &transfer{id: id, action: action, cancel: cancel}
+	p.active[action.Path] = t
+	return t
+}
+
+// aborted removes the cancelled action from the pass as if it had never been planned
+func (e *Engine) aborted(p *pass, action Action) {
+	e.mutex.Lock()
+	defer e.mutex.Unlock()
+
+	delete(p.active, action.Path)
+	p.progress.Actions--
+	p.progress.Bytes -= action.transferred()
+}
+
+func (e *Engine) finished(p *pass, action Action, err error) {
+	e.mutex.Lock()
+	defer e.mutex.Unlock()
+
+	delete(p.active, action.Path)
+
+	p.progress.BytesDone += action.transferred()
+	if err == nil {
+		p.progress.Completed++
+		return
+	}
+
+	p.progress.Failed++
+	// Denials are grouped by their subtree, instead of reporting every single action
+	if !IsAccessDenied(err) {
+		e.recordError(p.progress.Name, action.Path, err)
+	}
+}
+
+// recordError keeps the error for status reporting; the caller must hold the mutex
+func (e *Engine) recordError(name, path string, err error) {
+	e.errors = append(e.errors, RecentError{
+		Time:  time.Now().UTC(),
+		Sync:  name,
+		Path:  path,
+		Error: err.Error(),
+	})
+	if len(e.errors) > maxRecentErrors {
+		e.errors = e.errors[len(e.errors)-maxRecentErrors:]
+	}
+}
+
+// transferred returns the number of bytes copied by the action, which is 0 for metadata-only actions and deletions
+func (a Action) transferred() int64 {
+	switch a.Type {
+	case ActionDownload, ActionUpload, ActionConflict:
+		return a.Size
+	default:
+		return 0
+	}
+}
@@ -0,0 +1,108 @@
+package engine
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/mwantia/gosync/pkg/db/models"
+	"github.com/mwantia/gosync/pkg/publish"
+	"github.com/mwantia/gosync/pkg/storage"
+)
+
+// ErrNoSigningKey is returned by passes of published syncs if the engine has no key to sign their manifests
+var ErrNoSigningKey = errors.New("no signing key configured for publishing manifests")
+
+// ValidPublish returns an error if the sync can't be published: only upload syncs mirror their local files
+// unchanged to the backend, since deduplicated files are stored as chunks that consumers can't verify
+func ValidPublish(sc *models.SyncConfig) error {
+	if !sc.Publish {
+		return nil
+	}
+	if sc.Direction != DirectionUpload {
+		return fmt.Errorf("publishing requires the '%s' direction", DirectionUpload)
+	}
+	if sc.Dedup {
+		return errors.New("deduplicated syncs can't be published")
+	}
+	return nil
+}
+
+// publish writes a signed manifest of all files below the prefix of the backend after a complete pass that changed
+// the mirror, or if no manifest was published yet. Hashes recorded for unchanged files are reused, all other
+// files are read once and their hashes recorded for the next manifest.
+func (e *Engine) publish(ctx context.Context, plan *Plan, result *Result) error {
+	sc := plan.Config
+	if !sc.Publish {
+		return nil
+	}
+	if err := ValidPublish(sc); err != nil {
+		return fmt.Errorf("failed to publish sync '%s': %w", sc.Name, err)
+	}
+	if e.signingKey == nil {
+		return fmt.Errorf("failed to publish sync '%s': %w", sc.Name, ErrNoSigningKey)
+	}
+
+	s := plan.source
+	if s.backend == nil {
+		s = plan.dest
+	}
+	if s.backend == nil {
+		return fmt.Errorf("failed to publish sync '%s': no backend", sc.Name)
+	}
+
+	if result.Uploaded+result.Deleted == 0 {
+		_, err := s.storage.Stat(ctx, publish.ManifestKey(s.prefix))
+		if err == nil {
+			return nil
+		}
+		if !errors.Is(err, storage.ErrObjectNotFound) {
+			return fmt.Errorf("failed to check manifest of sync '%s': %w", sc.Name, err)
+		}
+	}
+
+	objects := make(map[string]storage.ObjectInfo)
+	if err := e.listRoot(ctx, s, "", nil, NewSelection(nil), objects); err != nil {
+		return fmt.Errorf("failed to list published files of sync '%s': %w", sc.Name, err)
+	}
+
+	manifest := &publish.Manifest{
+		Sync:        sc.Name,
+		GeneratedAt: time.Now().UTC(),
+		Files:       make([]publish.File, 0, len(objects)),
+	}
+	for rel, object := range objects {
+		hash, err := e.publishedHash(ctx, s, object)
+		if err != nil {
+			return fmt.Errorf("failed to hash '%s': %w", s.key(rel), err)
+		}
+		manifest.Files = append(manifest.Files, publish.File{
+			Path:   rel,
+			Size:   object.Size,
+			SHA256: hash,
+		})
+	}
+
+	if err := publish.Write(ctx, s.storage, s.prefix, manifest, e.signingKey); err != nil {
+		return fmt.Errorf("failed to publish sync '%s': %w", sc.Name, err)
+	}
+	return nil
+}
+
+// publishedHash returns the SHA256 of the object, recording it for files whose record has no hash yet
+func (e *Engine) publishedHash(ctx context.Context, s *side, object storage.ObjectInfo) (string, error) {
+	hash, err := e.contentHash(ctx, s, object, false)
+	if err != nil {
+		return "", err
+	}
+
+	record, err := e.store.GetFile(ctx, s.backend.ID, s.key(object.Key))
+	if err == nil && record.ETag == object.ETag && record.SHA256Hash == "" {
+		record.SHA256Hash = hash
+		if err := e.store.UpdateFile(ctx, record); err != nil {
+			return "", fmt.Errorf("failed to record hash: %w", err)
+		}
+	}
+	return hash, nil
+}
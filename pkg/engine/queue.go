@@ -0,0 +1,384 @@
+package engine
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/mwantia/gosync/pkg/storage"
+)
+
+// Orders of the transfer queue of a sync
+const (
+	// QueueOrderSmallest starts the smallest transfers first, so most files become available early
+	QueueOrderSmallest = "smallest"
+	// QueueOrderNewest starts the transfers of the most recently modified files first
+	QueueOrderNewest = "newest"
+)
+
+// ErrNotQueued is returned for transfers that don't exist or have already been started
+var ErrNotQueued = errors.New("transfer isn't queued")
+
+// ErrNoTransfers is returned if no queued or in-flight transfer matches the cancellation
+var ErrNoTransfers = errors.New("no matching transfers")
+
+// errRequeued is the cause of contexts cancelled to restart a transfer, which keeps interrupted uploads for resuming them
+var errRequeued = errors.New("transfer requeued")
+
+// CancelOptions selects the transfers of running passes cancelled by CancelTransfers
+type CancelOptions struct {
+	// ID of a queued or in-flight transfer, or 0 to select the transfers by path
+	ID uint64
+	// Path selects the transfers of the path and all paths below it relative to their sync, "" selecting all transfers
+	Path string
+	// Sync limits the selected transfers to a single sync (optional)
+	Sync string
+	// Requeue restarts in-flight transfers once the other queued transfers of their pass were started, instead
+	// of dropping them. Queued transfers stay queued.
+	Requeue bool
+}
+
+// CancelledTransfer describes a transfer that was removed from its queue or aborted
+type CancelledTransfer struct {
+	ID   uint64     `json:"id"`
+	Sync string     `json:"sync"`
+	Type ActionType `json:"type"`
+	Path string     `json:"path"`
+	// InFlight is set if the transfer was aborted while it was applied
+	InFlight bool `json:"in_flight"`
+	Requeued bool `json:"requeued"`
+}
+
+// selects returns true if the transfer is selected by the options
+func (o CancelOptions) selects(id uint64, action Action) bool {
+	if o.ID != 0 {
+		return id == o.ID
+	}
+	return withinDir(action.Path, o.Path)
+}
+
+// QueuedTransfer describes an action waiting in the transfer queue of a running pass
+type QueuedTransfer struct {
+	ID       uint64     `json:"id"`
+	Sync     string     `json:"sync"`
+	Type     ActionType `json:"type"`
+	Path     string     `json:"path"`
+	Size     int64      `json:"size"`
+	Priority int        `json:"priority"`
+	// Position is the place of the transfer within the queue of its pass, starting at 1
+	Position int `json:"position"`
+}
+
+// ValidQueueOrder returns true if the order is supported by the transfer queue, "" being the planned order
+func ValidQueueOrder(order string) bool {
+	return order == "" || order == QueueOrderSmallest || order == QueueOrderNewest
+}
+
+// transferQueue holds the actions of a pass that haven't been started yet. Actions are started by their
+// manual priority first, followed by the order of their sync.
+type transferQueue struct {
+	mutex sync.Mutex
+	items []*queuedAction
+}
+
+type queuedAction struct {
+	id       uint64
+	action   Action
+	priority int
+	// rank is the position of the action within the order of its sync
+	rank int
+}
+
+// newQueue orders the actions by the queue order of the sync. Initial passes start the smallest transfers
+// first by default, so that most files become available early and the ETA stabilizes quickly.
+func (e *Engine) newQueue(plan *Plan, actions []Action) *transferQueue {
+	order := plan.Config.QueueOrder
+	if order == "" && plan.Initial {
+		order = QueueOrderSmallest
+	}
+
+	sorted := append([]Action(nil), actions...)
+	switch order {
+	case QueueOrderSmallest:
+		sort.SliceStable(sorted, func(i, j int) bool {
+			return sorted[i].Size < sorted[j].Size
+		})
+	case QueueOrderNewest:
+		sort.SliceStable(sorted, func(i, j int) bool {
+			return sorted[i].modified().After(sorted[j].modified())
+		})
+	}
+
+	q := &transferQueue{items: make([]*queuedAction, len(sorted))}
+	for i, action := range sorted {
+		q.items[i] = &queuedAction{
+			id:     e.queueID.Add(1),
+			action: action,
+			rank:   i,
+		}
+	}
+	return q
+}
+
+// popBatch removes and returns the next action together with the following queued actions of the same priority
+// matching it, up to max actions. Returns nil if the queue is empty.
+func (q *transferQueue) popBatch(max int, match func(head, action Action) bool) []*queuedAction {
+	q.mutex.Lock()
+	defer q.mutex.Unlock()
+
+	if len(q.items) == 0 {
+		return nil
+	}
+	head := q.items[0]
+	batch := []*queuedAction{head}
+	kept := q.items[:0]
+	for _, item := range q.items[1:] {
+		if len(batch) < max && item.priority == head.priority && match(head.action, item.action) {
+			batch = append(batch, item)
+			continue
+		}
+		kept = append(kept, item)
+	}
+	q.items = kept
+	return batch
+}
+
+// push appends the action to the end of the queue
+func (q *transferQueue) push(id uint64, action Action) {
+	q.mutex.Lock()
+	defer q.mutex.Unlock()
+
+	rank := 0
+	for _, item := range q.items {
+		rank = max(rank, item.rank+1)
+	}
+	q.items = append(q.items, &queuedAction{
+		id:     id,
+		action: action,
+		rank:   rank,
+	})
+}
+
+// remaining returns all actions that haven't been started in the order they would have been started
+func (q *transferQueue) remaining() []Action {
+	q.mutex.Lock()
+	defer q.mutex.Unlock()
+
+	actions := make([]Action, len(q.items))
+	for i, item := range q.items {
+		actions[i] = item.action
+	}
+	return actions
+}
+
+// prioritize changes the priority of the queued action, returning false if it isn't queued
+func (q *transferQueue) prioritize(id uint64, priority int) bool {
+	q.mutex.Lock()
+	defer q.mutex.Unlock()
+
+	for _, item := range q.items {
+		if item.id == id {
+			item.priority = priority
+			sort.SliceStable(q.items, func(i, j int) bool {
+				if q.items[i].priority != q.items[j].priority {
+					return q.items[i].priority > q.items[j].priority
+				}
+				return q.items[i].rank < q.items[j].rank
+			})
+			return true
+		}
+	}
+	return false
+}
+
+// remove removes the queued action, returning false if it isn't queued
+func (q *transferQueue) remove(id uint64) (Action, bool) {
+	q.mutex.Lock()
+	defer q.mutex.Unlock()
+
+	for i, item := range q.items {
+		if item.id == id {
+			q.items = append(q.items[:i], q.items[i+1:]...)
+			return item.action, true
+		}
+	}
+	return Action{}, false
+}
+
+// removeAll removes and returns all queued actions matching the filter
+func (q *transferQueue) removeAll(match func(uint64, Action) bool) []*queuedAction {
+	q.mutex.Lock()
+	defer q.mutex.Unlock()
+
+	var removed []*queuedAction
+	kept := q.items[:0]
+	for _, item := range q.items {
+		if match(item.id, item.action) {
+			removed = append(removed, item)
+			continue
+		}
+		kept = append(kept, item)
+	}
+	q.items = kept
+	return removed
+}
+
+// Queue returns the transfers waiting in the queues of all running passes, ordered by sync and position
+func (e *Engine) Queue() []QueuedTransfer {
+	e.mutex.Lock()
+	defer e.mutex.Unlock()
+
+	var result []QueuedTransfer
+	for _, p := range e.passes {
+		if p.queue == nil {
+			continue
+		}
+
+		p.queue.mutex.Lock()
+		for i, item := range p.queue.items {
+			result = append(result, QueuedTransfer{
+				ID:       item.id,
+				Sync:     p.progress.Name,
+				Type:     item.action.Type,
+				Path:     item.action.Path,
+				Size:     item.action.Size,
+				Priority: item.priority,
+				Position: i + 1,
+			})
+		}
+		p.queue.mutex.Unlock()
+	}
+
+	sort.SliceStable(result, func(i, j int) bool {
+		if result[i].Sync != result[j].Sync {
+			return result[i].Sync < result[j].Sync
+		}
+		return result[i].Position < result[j].Position
+	})
+	return result
+}
+
+// PrioritizeTransfer changes the priority of a queued transfer. Transfers with a higher priority are started
+// before all other transfers of their pass, regardless of the queue order of the sync.
+func (e *Engine) PrioritizeTransfer(id uint64, priority int) error {
+	e.mutex.Lock()
+	defer e.mutex.Unlock()
+
+	for _, p := range e.passes {
+		if p.queue != nil && p.queue.prioritize(id, priority) {
+			return nil
+		}
+	}
+	return fmt.Errorf("%w: %d", ErrNotQueued, id)
+}
+
+// CancelTransfer removes a queued transfer from its pass. The path isn't synced, so the next pass plans it again.
+func (e *Engine) CancelTransfer(id uint64) error {
+	e.mutex.Lock()
+	defer e.mutex.Unlock()
+
+	for _, p := range e.passes {
+		if p.queue == nil {
+			continue
+		}
+		if action, ok := p.queue.remove(id); ok {
+			p.progress.Actions--
+			p.progress.Bytes -= action.transferred()
+			return nil
+		}
+	}
+	return fmt.Errorf("%w: %d", ErrNotQueued, id)
+}
+
+// CancelTransfers cancels the selected transfers of all running passes. Queued transfers are removed from their
+// queue, while in-flight transfers are aborted through their context, discarding incomplete uploads unless they are
+// requeued. Dropped paths stay unsynced, so the next pass of their sync plans them again. Transfers completing while
+// they are aborted keep their outcome.
+func (e *Engine) CancelTransfers(opts CancelOptions) ([]CancelledTransfer, error) {
+	e.mutex.Lock()
+	defer e.mutex.Unlock()
+
+	cause := storage.ErrCancelled
+	if opts.Requeue {
+		cause = errRequeued
+	}
+
+	var cancelled []CancelledTransfer
+	for _, p := range e.passes {
+		if opts.Sync != "" && p.progress.Name != opts.Sync {
+			continue
+		}
+
+		for _, t := range p.active {
+			if !opts.selects(t.id, t.action) {
+				continue
+			}
+			t.cancel(cause)
+			cancelled = append(cancelled, CancelledTransfer{
+				ID:       t.id,
+				Sync:     p.progress.Name,
+				Type:     t.action.Type,
+				Path:     t.action.Path,
+				InFlight: true,
+				Requeued: opts.Requeue,
+			})
+		}
+
+		if p.queue == nil || opts.Requeue {
+			continue
+		}
+		for _, item := range p.queue.removeAll(opts.selects) {
+			p.progress.Actions--
+			p.progress.Bytes -= item.action.transferred()
+			cancelled = append(cancelled, CancelledTransfer{
+				ID:   item.id,
+				Sync: p.progress.Name,
+				Type: item.action.Type,
+				Path: item.action.Path,
+			})
+		}
+	}
+
+	if len(cancelled) == 0 {
+		return nil, ErrNoTransfers
+	}
+	sort.Slice(cancelled, func(i, j int) bool {
+		if cancelled[i].Sync != cancelled[j].Sync {
+			return cancelled[i].Sync < cancelled[j].Sync
+		}
+		return cancelled[i].Path < cancelled[j].Path
+	})
+	return cancelled, nil
+}
+
+// requeue appends the action to the queue of the pass once more, e.g. after its transfer failed its verification
+func (e *Engine) requeue(p *pass, q *transferQueue, action Action) {
+	e.mutex.Lock()
+	defer e.mutex.Unlock()
+
+	p.progress.Actions++
+	p.progress.Bytes += action.transferred()
+	q.push(e.queueID.Add(1), action)
+}
+
+// setQueue exposes the queue of the pass, so its transfers can be inspected and reordered
+func (e *Engine) setQueue(p *pass, q *transferQueue) {
+	e.mutex.Lock()
+	defer e.mutex.Unlock()
+
+	p.queue = q
+}
+
+// modified returns the latest modification time of both sides of the action
+func (a Action) modified() time.Time {
+	var t time.Time
+	if a.source != nil {
+		t = a.source.LastModified
+	}
+	if a.dest != nil && a.dest.LastModified.After(t) {
+		t = a.dest.LastModified
+	}
+	return t
+}
@@ -0,0 +1,87 @@
+package engine
+
+import (
+	"context"
+
+	"github.com/mwantia/gosync/pkg/db/models"
+)
+
+// Quota levels of a backend, once its usage exceeds the soft or hard quota
+const (
+	QuotaSoft = "soft"
+	QuotaHard = "hard"
+)
+
+// QuotaAlert reports a backend whose usage reached one of its quotas since the last pass writing to it
+type QuotaAlert struct {
+	Backend string `json:"backend"`
+	// Level is either QuotaSoft or QuotaHard
+	Level string `json:"level"`
+	Bytes int64  `json:"bytes"`
+	Quota int64  `json:"quota"`
+}
+
+// writtenSides returns the sides the action writes to
+func writtenSides(plan *Plan, action Action) []*side {
+	switch action.Type {
+	case ActionDownload:
+		return []*side{plan.dest}
+	case ActionUpload:
+		return []*side{plan.source}
+	case ActionConflict:
+		// The conflict copy is written next to the source before the source is written to the destination
+		return []*side{plan.source, plan.dest}
+	default:
+		return nil
+	}
+}
+
+// exceedsQuota returns the backend whose hard quota would be exceeded by the action, or nil if the action may run.
+// Transfers to such backends are held back until their usage shrinks, e.g. since files were deleted.
+func (e *Engine) exceedsQuota(ctx context.Context, plan *Plan, action Action) *models.Backend {
+	for _, s := range writtenSides(plan, action) {
+		if s.backend == nil || s.backend.QuotaHard <= 0 {
+			continue
+		}
+		usage, err := e.store.GetStorageUsage(ctx, s.backend.ID, "")
+		if err == nil && usage.Bytes+action.Size > s.backend.QuotaHard {
+			return s.backend
+		}
+	}
+	return nil
+}
+
+// checkQuotas compares the usage of the backends of the plan with their quotas after the pass. Alerts are only added
+// to the result once the level of a backend rises, so each quota is reported once until the usage drops below it.
+func (e *Engine) checkQuotas(ctx context.Context, plan *Plan, result *Result) {
+	for _, s := range []*side{plan.source, plan.dest} {
+		b := s.backend
+		if b == nil || (b.QuotaSoft <= 0 && b.QuotaHard <= 0) {
+			continue
+		}
+		usage, err := e.store.GetStorageUsage(ctx, b.ID, "")
+		if err != nil {
+			continue
+		}
+
+		alert := QuotaAlert{Backend: b.ID, Bytes: usage.Bytes}
+		switch {
+		case b.QuotaHard > 0 && (usage.Bytes >= b.QuotaHard || result.held[b.ID]):
+			alert.Level, alert.Quota = QuotaHard, b.QuotaHard
+		case b.QuotaSoft > 0 && usage.Bytes >= b.QuotaSoft:
+			alert.Level, alert.Quota = QuotaSoft, b.QuotaSoft
+		}
+
+		e.mutex.Lock()
+		previous := e.quotas[b.ID]
+		if e.quotas == nil {
+			e.quotas = make(map[string]string)
+		}
+		e.quotas[b.ID] = alert.Level
+		e.mutex.Unlock()
+
+		if alert.Level != "" && alert.Level != previous && previous != QuotaHard {
+			result.Quotas = append(result.Quotas, alert)
+		}
+	}
+}
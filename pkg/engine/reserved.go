@@ -0,0 +1,30 @@
+package engine
+
+import (
+	"github.com/mwantia/gosync/pkg/db/models"
+	"github.com/mwantia/gosync/pkg/storage"
+)
+
+// ValidReservedNames returns true if the policy for names Windows doesn't allow is supported, "" being the same as escape
+func ValidReservedNames(policy string) bool {
+	return policy == "" || policy == storage.ReservedEscape || policy == storage.ReservedError
+}
+
+// reservedNamesPolicy returns the policy of the sync for names Windows doesn't allow, defaulting to escape
+func reservedNamesPolicy(sc *models.SyncConfig) string {
+	if sc.ReservedNames == "" {
+		return storage.ReservedEscape
+	}
+	return sc.ReservedNames
+}
+
+// applyReservedNames sets the policy for names Windows doesn't allow on the local sides, which store them escaped
+// or fail to transfer them, while listing them returns the original names again
+func applyReservedNames(sc *models.SyncConfig, sides ...*side) {
+	policy := reservedNamesPolicy(sc)
+	for _, s := range sides {
+		if local, ok := s.storage.(*storage.LocalStorage); ok {
+			local.SetReservedNames(policy)
+		}
+	}
+}
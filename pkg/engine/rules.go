@@ -0,0 +1,217 @@
+package engine
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"path"
+	"strings"
+	"time"
+
+	"github.com/mwantia/gosync/pkg/db/models"
+	"github.com/mwantia/gosync/pkg/filter"
+	"github.com/mwantia/gosync/pkg/storage"
+)
+
+// Rules evaluated by Rules.Evaluate in this order
+const (
+	RuleMinSize        = "min-size"
+	RuleMaxSize        = "max-size"
+	RuleModifiedAfter  = "modified-after"
+	RuleModifiedBefore = "modified-before"
+	RuleIncludeMime    = "include-mime"
+	RuleExcludeMime    = "exclude-mime"
+)
+
+// sniffLength is the number of bytes read to detect the MIME type of files without a known extension
+const sniffLength = 512
+
+// Rules include or exclude the files of a sync by their size, modification time and MIME type. Files skipped by
+// any rule on either side are treated like ignored files, so they are neither transferred nor deleted.
+type Rules struct {
+	minSize, maxSize int64
+	after, before    time.Time
+	include, exclude []string
+}
+
+// RuleResult is the verdict of a single rule for an object
+type RuleResult struct {
+	Rule   string `json:"rule"`
+	Passed bool   `json:"passed"`
+	Detail string `json:"detail"`
+}
+
+// ValidRules returns an error unless the size, time and MIME type rules of the sync are valid
+func ValidRules(sc *models.SyncConfig) error {
+	_, err := ParseRules(sc, time.Now())
+	return err
+}
+
+// ParseRules parses the rules of the sync, relative times being resolved against now
+func ParseRules(sc *models.SyncConfig, now time.Time) (*Rules, error) {
+	if sc.MinSize < 0 || sc.MaxSize < 0 {
+		return nil, fmt.Errorf("sizes must not be negative")
+	}
+	if sc.MaxSize > 0 && sc.MinSize > sc.MaxSize {
+		return nil, fmt.Errorf("minimum size %d is larger than the maximum size %d", sc.MinSize, sc.MaxSize)
+	}
+
+	r := &Rules{
+		minSize: sc.MinSize,
+		maxSize: sc.MaxSize,
+		include: parseMimePatterns(sc.IncludeMime),
+		exclude: parseMimePatterns(sc.ExcludeMime),
+	}
+	var err error
+	if sc.ModifiedAfter != "" {
+		if r.after, err = filter.ParseTime(sc.ModifiedAfter, now); err != nil {
+			return nil, fmt.Errorf("invalid modified after: %w", err)
+		}
+	}
+	if sc.ModifiedBefore != "" {
+		if r.before, err = filter.ParseTime(sc.ModifiedBefore, now); err != nil {
+			return nil, fmt.Errorf("invalid modified before: %w", err)
+		}
+	}
+	if !r.after.IsZero() && !r.before.IsZero() && !r.after.Before(r.before) {
+		return nil, fmt.Errorf("modified after must be before modified before")
+	}
+	for _, pattern := range append(r.include, r.exclude...) {
+		if _, err := path.Match(pattern, ""); err != nil || !strings.Contains(pattern, "/") {
+			return nil, fmt.Errorf("invalid MIME type '%s', it must be <type>/<subtype> like image/*", pattern)
+		}
+	}
+	return r, nil
+}
+
+// parseMimePatterns splits the comma separated MIME types, which are matched case-insensitive
+func parseMimePatterns(value string) []string {
+	var patterns []string
+	for _, pattern := range strings.Split(value, ",") {
+		if pattern = strings.ToLower(strings.TrimSpace(pattern)); pattern != "" {
+			patterns = append(patterns, pattern)
+		}
+	}
+	return patterns
+}
+
+// Empty returns true if no rule is configured, so every object is included
+func (r *Rules) Empty() bool {
+	return r.minSize == 0 && r.maxSize == 0 && r.after.IsZero() && r.before.IsZero() &&
+		len(r.include) == 0 && len(r.exclude) == 0
+}
+
+// Evaluate returns the results of all configured rules for the object, stopping after the first failed rule
+// unless all is set. The MIME type is only detected once a MIME type rule is evaluated.
+func (r *Rules) Evaluate(object storage.ObjectInfo, detect func() string, all bool) []RuleResult {
+	var results []RuleResult
+	add := func(rule string, passed bool, format string, args ...any) bool {
+		results = append(results, RuleResult{Rule: rule, Passed: passed, Detail: fmt.Sprintf(format, args...)})
+		return passed || all
+	}
+
+	if r.minSize > 0 && !add(RuleMinSize, object.Size >= r.minSize, "size of %d bytes, minimum is %d", object.Size, r.minSize) {
+		return results
+	}
+	if r.maxSize > 0 && !add(RuleMaxSize, object.Size <= r.maxSize, "size of %d bytes, maximum is %d", object.Size, r.maxSize) {
+		return results
+	}
+	modified := object.LastModified.Format(time.RFC3339)
+	if !r.after.IsZero() && !add(RuleModifiedAfter, object.LastModified.After(r.after), "modified at %s, must be after %s", modified, r.after.Format(time.RFC3339)) {
+		return results
+	}
+	if !r.before.IsZero() && !add(RuleModifiedBefore, object.LastModified.Before(r.before), "modified at %s, must be before %s", modified, r.before.Format(time.RFC3339)) {
+		return results
+	}
+	if len(r.include) == 0 && len(r.exclude) == 0 {
+		return results
+	}
+
+	mimeType := detect()
+	if len(r.include) > 0 {
+		pattern := matchMime(mimeType, r.include)
+		if !add(RuleIncludeMime, pattern != "", "type %s, included are %s", mimeType, strings.Join(r.include, ", ")) {
+			return results
+		}
+	}
+	if len(r.exclude) > 0 {
+		pattern := matchMime(mimeType, r.exclude)
+		add(RuleExcludeMime, pattern == "", "type %s, excluded are %s", mimeType, strings.Join(r.exclude, ", "))
+	}
+	return results
+}
+
+// Skip returns why the object is skipped by the rules, or "" if it's included
+func (r *Rules) Skip(object storage.ObjectInfo, detect func() string) string {
+	for _, result := range r.Evaluate(object, detect, false) {
+		if !result.Passed {
+			return result.Rule + ": " + result.Detail
+		}
+	}
+	return ""
+}
+
+// matchMime returns the first of the patterns matching the MIME type, or "" if none does
+func matchMime(mimeType string, patterns []string) string {
+	for _, pattern := range patterns {
+		if ok, _ := path.Match(pattern, mimeType); ok {
+			return pattern
+		}
+	}
+	return ""
+}
+
+// detectMime returns the MIME type of the object by its extension or listed content type. The content of local
+// files without either is sniffed, while unknown objects of backends are "application/octet-stream".
+func (e *Engine) detectMime(ctx context.Context, s *side, key string, object storage.ObjectInfo) string {
+	mimeType := mime.TypeByExtension(path.Ext(key))
+	if mimeType == "" {
+		mimeType = object.ContentType
+	}
+	if mimeType == "" && s.backend == nil {
+		if reader, err := s.storage.Get(ctx, key); err == nil {
+			buf := make([]byte, sniffLength)
+			n, _ := io.ReadFull(reader, buf)
+			reader.Close()
+			mimeType = http.DetectContentType(buf[:n])
+		}
+	}
+	if mimeType == "" {
+		return "application/octet-stream"
+	}
+	if parsed, _, err := mime.ParseMediaType(mimeType); err == nil {
+		return parsed
+	}
+	return strings.ToLower(mimeType)
+}
+
+// applyRules removes the objects skipped by the rules from both sides. Their baselines are forgotten like those of
+// ignored files, so neither their changes nor their deletion propagate while they are skipped.
+func (e *Engine) applyRules(ctx context.Context, rules *Rules, source, dest *side, sourceObjects, destObjects map[string]storage.ObjectInfo) {
+	if rules.Empty() {
+		return
+	}
+
+	skipped := make(map[string]bool)
+	for _, side := range []struct {
+		side    *side
+		objects map[string]storage.ObjectInfo
+	}{{source, sourceObjects}, {dest, destObjects}} {
+		for rel, object := range side.objects {
+			if skipped[rel] {
+				continue
+			}
+			key := side.side.key(rel)
+			detect := func() string { return e.detectMime(ctx, side.side, key, object) }
+			if rules.Skip(object, detect) != "" {
+				skipped[rel] = true
+			}
+		}
+	}
+	for rel := range skipped {
+		delete(sourceObjects, rel)
+		delete(destObjects, rel)
+	}
+}
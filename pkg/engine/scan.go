@@ -0,0 +1,144 @@
+package engine
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/mwantia/gosync/pkg/backend"
+	"github.com/mwantia/gosync/pkg/db/models"
+	"github.com/mwantia/gosync/pkg/storage"
+)
+
+// scanBatchSize is the number of listed objects recorded with a single batch upsert
+const scanBatchSize = 500
+
+// ScanResult summarizes the scan of the backends of a sync
+type ScanResult struct {
+	Objects int
+	Bytes   int64
+	// Recorded counts new or changed objects, unchanged objects keep their recorded metadata
+	Recorded int
+	// Resumed is set if the scan continued after the cursor of an interrupted scan
+	Resumed    bool
+	StartedAt  time.Time
+	FinishedAt time.Time
+}
+
+// Scan lists the backends on both sides of the sync and records all new or changed objects as files of their
+// backend, e.g. objects written by other clients or tools. The last completed prefix is stored in the sync state
+// of this client, so scans interrupted by a shutdown or an error continue where they stopped.
+func (e *Engine) Scan(ctx context.Context, sc *models.SyncConfig) (*ScanResult, error) {
+	result := &ScanResult{StartedAt: time.Now().UTC()}
+
+	sourcePath, destPath := ResolvePaths(sc, e.clientID)
+	destPath, _ = SplitPathTemplate(destPath)
+
+	state, err := loadSyncState(ctx, e.store, sc, e.clientID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load state of sync '%s': %w", sc.Name, err)
+	}
+
+	// The cursor is prefixed by the side it belongs to, sides before it have been scanned entirely
+	cursorSide, cursor, _ := strings.Cut(state.ScanCursor, ":")
+	result.Resumed = state.ScanCursor != ""
+
+	for _, s := range []struct{ name, path string }{{SideSource, sourcePath}, {SideDest, destPath}} {
+		if cursorSide == SideDest && s.name == SideSource {
+			continue
+		}
+		if IsLocalPath(s.path) {
+			continue
+		}
+
+		side, err := e.openSide(ctx, s.path)
+		if err != nil {
+			return nil, fmt.Errorf("failed to open %s of sync '%s': %w", s.name, sc.Name, err)
+		}
+
+		sideCursor := ""
+		if cursorSide == s.name {
+			sideCursor = cursor
+		}
+		err = e.scanSide(ctx, state, side, s.name, sideCursor, result)
+		side.close()
+		if err != nil {
+			return result, fmt.Errorf("failed to scan %s of sync '%s': %w", s.name, sc.Name, err)
+		}
+	}
+
+	state.ScanCursor = ""
+	state.ScannedAt = time.Now().UTC()
+	if err := saveSyncState(context.WithoutCancel(ctx), e.store, state); err != nil {
+		return result, fmt.Errorf("failed to save state of sync '%s': %w", sc.Name, err)
+	}
+
+	result.FinishedAt = state.ScannedAt
+	return result, nil
+}
+
+// scanSide records the listed objects of the side in batches. The pending batch is recorded before each
+// checkpoint, so all objects before the stored cursor have been recorded.
+func (e *Engine) scanSide(ctx context.Context, state *models.SyncState, s *side, name, cursor string, result *ScanResult) error {
+	var mutex sync.Mutex
+	batch := make([]models.File, 0, scanBatchSize)
+
+	flush := func() error {
+		if len(batch) == 0 {
+			return nil
+		}
+		recorded, err := e.store.UpsertFiles(ctx, batch)
+		if err != nil {
+			return fmt.Errorf("failed to record scanned objects: %w", err)
+		}
+		result.Recorded += recorded
+		batch = batch[:0]
+		return nil
+	}
+
+	opts := e.scan
+	opts.Cursor = cursor
+	opts.Checkpoint = func(cursor string) error {
+		mutex.Lock()
+		defer mutex.Unlock()
+
+		if err := flush(); err != nil {
+			return err
+		}
+		state.ScanCursor = name + ":" + cursor
+		return saveSyncState(ctx, e.store, state)
+	}
+
+	err := backend.NewScanner(s.storage, opts).Scan(ctx, s.prefix, func(object storage.ObjectInfo) error {
+		if s.isInternal(object.Key) || strings.HasSuffix(object.Key, "/") {
+			return nil
+		}
+
+		mutex.Lock()
+		defer mutex.Unlock()
+
+		result.Objects++
+		result.Bytes += object.Size
+		batch = append(batch, models.File{
+			BackendID:  s.backend.ID,
+			Path:       object.Key,
+			Size:       object.Size,
+			ETag:       object.ETag,
+			VersionID:  object.VersionID,
+			ModifiedAt: object.LastModified,
+		})
+		if len(batch) < scanBatchSize {
+			return nil
+		}
+		return flush()
+	})
+	if err != nil {
+		return err
+	}
+
+	mutex.Lock()
+	defer mutex.Unlock()
+	return flush()
+}
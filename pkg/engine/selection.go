@@ -0,0 +1,107 @@
+package engine
+
+import (
+	"path"
+	"sort"
+	"strings"
+
+	"github.com/mwantia/gosync/pkg/db/models"
+)
+
+// Selection decides which paths of a sync are synced, based on its included and excluded directories
+type Selection struct {
+	// Ordered from the most to the least specific directory
+	rules    []models.SyncSelection
+	includes bool
+	// Scope limits the selection to a single file or directory
+	scope string
+}
+
+// NewSelection creates the selection of a sync, which selects all paths without any selections
+func NewSelection(selections []models.SyncSelection) *Selection {
+	s := &Selection{}
+	for _, selection := range selections {
+		selection.Path = CleanSelectionPath(selection.Path)
+		s.rules = append(s.rules, selection)
+		if selection.Mode == models.SelectionInclude {
+			s.includes = true
+		}
+	}
+
+	sort.Slice(s.rules, func(i, j int) bool {
+		return len(s.rules[i].Path) > len(s.rules[j].Path)
+	})
+	return s
+}
+
+// CleanSelectionPath normalizes the directory of a selection, e.g. "/Photos/2024/" returns "Photos/2024"
+func CleanSelectionPath(p string) string {
+	p = path.Clean("/" + strings.ReplaceAll(p, `\`, "/"))
+	return strings.TrimPrefix(p, "/")
+}
+
+// Within returns a copy of the selection that only selects paths within the file or directory at scope
+func (s *Selection) Within(scope string) *Selection {
+	scoped := *s
+	scoped.scope = scope
+	return &scoped
+}
+
+// Selected returns true if the path is synced, using the most specific selection of its directories
+func (s *Selection) Selected(rel string) bool {
+	if !withinDir(rel, s.scope) {
+		return false
+	}
+	for _, rule := range s.rules {
+		if withinDir(rel, rule.Path) {
+			return rule.Mode == models.SelectionInclude
+		}
+	}
+	return !s.includes
+}
+
+// Roots returns the directories which have to be listed to find all selected paths, so that
+// trees outside of included directories are never listed. Returns "" if the whole sync is listed.
+func (s *Selection) Roots() []string {
+	if s.scope == "" {
+		return s.roots()
+	}
+
+	var roots []string
+	for _, root := range s.roots() {
+		switch {
+		case withinDir(s.scope, root):
+			return []string{s.scope}
+		case withinDir(root, s.scope):
+			roots = append(roots, root)
+		}
+	}
+	return roots
+}
+
+func (s *Selection) roots() []string {
+	if !s.includes {
+		return []string{""}
+	}
+
+	var includes []string
+	for _, rule := range s.rules {
+		if rule.Mode == models.SelectionInclude {
+			includes = append(includes, rule.Path)
+		}
+	}
+	sort.Strings(includes)
+
+	var roots []string
+	for _, dir := range includes {
+		if len(roots) > 0 && withinDir(dir, roots[len(roots)-1]) {
+			continue
+		}
+		roots = append(roots, dir)
+	}
+	return roots
+}
+
+func withinDir(rel, dir string) bool {
+	return dir == "" || rel == dir || strings.HasPrefix(rel, dir+"/")
+}
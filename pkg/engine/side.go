@@ -0,0 +1,307 @@
+package engine
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"path"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/mwantia/gosync/pkg/backend"
+	"github.com/mwantia/gosync/pkg/checksum"
+	"github.com/mwantia/gosync/pkg/db/models"
+	"github.com/mwantia/gosync/pkg/storage"
+	"github.com/mwantia/gosync/pkg/vfs"
+)
+
+// side is one end of a sync, with all paths being relative to its prefix
+type side struct {
+	storage storage.Storage
+	prefix  string
+	// Only set for virtual paths, since local directories have no metadata
+	backend *models.Backend
+	trash   *backend.Trash
+
+	// normalization is the Unicode normalization policy of the sync, names maps normalized paths to the actual
+	// paths of listed objects where they differ, collisions are the paths skipped for sharing a normalized path
+	normalization string
+	mutex         sync.Mutex
+	names         map[string]string
+	collisions    []string
+}
+
+// IsLocalPath returns true if the path refers to a local directory instead of a virtual path
+func IsLocalPath(p string) bool {
+	return filepath.IsAbs(p) || p == "." || p == "~" ||
+		strings.HasPrefix(p, "./") || strings.HasPrefix(p, "../") || strings.HasPrefix(p, "~/")
+}
+
+func (e *Engine) openSide(ctx context.Context, p string) (*side, error) {
+	if IsLocalPath(p) {
+		st, err := storage.NewLocalStorage(&models.Backend{
+			Type:     storage.TypeLocal,
+			Endpoint: p,
+		})
+		if err != nil {
+			return nil, err
+		}
+		return &side{storage: st}, nil
+	}
+
+	vp := vfs.ParsePath(p)
+	if vp.IsRoot() {
+		return nil, fmt.Errorf("invalid path '%s': a backend is required", p)
+	}
+
+	b, err := e.store.GetBackend(ctx, vp.Backend)
+	if err != nil {
+		return nil, fmt.Errorf("failed to find backend '%s': %w", vp.Backend, err)
+	}
+
+	st, err := e.meter.Open(b)
+	if err != nil {
+		return nil, err
+	}
+	if e.tuner != nil {
+		st = e.tuner.Wrap(b.ID, st)
+	}
+
+	prefix := vp.Key
+	if prefix != "" && !strings.HasSuffix(prefix, "/") {
+		prefix += "/"
+	}
+
+	return &side{
+		storage: st,
+		prefix:  prefix,
+		backend: b,
+		trash:   backend.NewTrash(e.store, st, b),
+	}, nil
+}
+
+// close releases the storage of the side, which must not be used afterwards
+func (s *side) close() {
+	if s != nil {
+		storage.Close(s.storage)
+	}
+}
+
+// backendID returns the ID of the backend of the side, or "" for local directories
+func (s *side) backendID() string {
+	if s == nil || s.backend == nil {
+		return ""
+	}
+	return s.backend.ID
+}
+
+// list returns all selected objects of the side by relative path, skipping ignored paths, the trash and snapshots.
+// Roots the backend denied listing are skipped and returned, so their paths aren't mistaken for deletions.
+func (e *Engine) list(ctx context.Context, sc *models.SyncConfig, s *side, name string, ignore []string, selection *Selection) (map[string]storage.ObjectInfo, []string, error) {
+	objects := make(map[string]storage.ObjectInfo)
+	var denied []string
+
+	for _, root := range selection.Roots() {
+		if e.isDenied(sc.ID, root, OperationList, name, time.Now()) {
+			denied = append(denied, root)
+			continue
+		}
+
+		err := e.listRoot(ctx, s, root, ignore, selection, objects)
+		switch {
+		case IsAccessDenied(err):
+			e.deny(sc, root, OperationList, name, err)
+			denied = append(denied, root)
+		case err != nil:
+			return nil, nil, err
+		default:
+			e.allow(sc.ID, root, OperationList, name)
+		}
+	}
+
+	return objects, denied, nil
+}
+
+// listRoot adds all selected objects below the root of the selection to objects. Backends are listed by a scanner,
+// which splits the root by its subdirectories across parallel workers.
+func (e *Engine) listRoot(ctx context.Context, s *side, root string, ignore []string, selection *Selection, objects map[string]storage.ObjectInfo) error {
+	// Scoped roots may refer to a single file, so siblings sharing the prefix are skipped by the selection
+	prefix := s.prefix + root
+
+	add := func(object storage.ObjectInfo) error {
+		if s.isInternal(object.Key) {
+			return nil
+		}
+
+		rel := strings.TrimPrefix(object.Key, s.prefix)
+		normalized := storage.NormalizePath(s.normalization, rel)
+		if rel == "" || strings.HasSuffix(rel, "/") || isIgnored(normalized, ignore) || !selection.Selected(normalized) {
+			return nil
+		}
+
+		object.Key = rel
+		s.add(objects, object)
+		return nil
+	}
+
+	if s.backend == nil {
+		return s.storage.List(ctx, prefix, add)
+	}
+	return backend.NewScanner(s.storage, e.scan).Scan(ctx, prefix, add)
+}
+
+// isInternal returns true if the key belongs to the trash, chunks, snapshots, leases or published manifests of the backend
+// instead of its files
+func (s *side) isInternal(key string) bool {
+	return s.trash != nil && backend.IsInternalKey(s.trash, key)
+}
+
+// add adds the object by its normalized path, remembering its actual path. Of objects whose paths only differ
+// in their normalization, the one already in the form written by the side is kept.
+func (s *side) add(objects map[string]storage.ObjectInfo, object storage.ObjectInfo) {
+	rel := object.Key
+	normalized := storage.NormalizePath(s.normalization, rel)
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if _, ok := objects[normalized]; ok {
+		actual, mapped := s.names[normalized]
+		if !mapped {
+			actual = normalized
+		}
+		if actual != rel {
+			if actual == storage.WritePath(s.normalization, normalized) {
+				s.collisions = append(s.collisions, rel)
+				return
+			}
+			s.collisions = append(s.collisions, actual)
+		}
+	}
+
+	object.Key = normalized
+	objects[normalized] = object
+	if normalized == rel {
+		delete(s.names, normalized)
+		return
+	}
+	if s.names == nil {
+		s.names = make(map[string]string)
+	}
+	s.names[normalized] = rel
+}
+
+// key returns the key of the path, which is the actual key of listed objects or the form new objects are written with
+func (s *side) key(rel string) string {
+	s.mutex.Lock()
+	actual, ok := s.names[rel]
+	s.mutex.Unlock()
+	if !ok {
+		actual = storage.WritePath(s.normalization, rel)
+	}
+	return s.prefix + actual
+}
+
+// remove deletes the object, moving it into the trash for backends
+func (s *side) remove(ctx context.Context, e *Engine, rel string) error {
+	key := s.key(rel)
+	if s.trash == nil {
+		err := s.storage.Delete(ctx, key)
+		if errors.Is(err, storage.ErrObjectNotFound) {
+			return nil
+		}
+		return err
+	}
+
+	failed, err := s.trash.Remove(ctx, []string{key})
+	if err != nil {
+		return err
+	}
+	if len(failed) > 0 && !errors.Is(failed[0].Err, storage.ErrObjectNotFound) {
+		return failed[0]
+	}
+
+	return e.forgetFile(ctx, s, key)
+}
+
+// recordFile creates or updates the file metadata after an object was written to a backend
+func (e *Engine) recordFile(ctx context.Context, s *side, info *storage.ObjectInfo) error {
+	return e.recordVerifiedFile(ctx, s, info, checksum.Sums{}, "")
+}
+
+// recordVerifiedFile records the metadata of the object along with the checksums verified for its content and
+// the algorithm it's compressed by
+func (e *Engine) recordVerifiedFile(ctx context.Context, s *side, info *storage.ObjectInfo, sums checksum.Sums, compression string) error {
+	if s.backend == nil {
+		return nil
+	}
+
+	// Hashes of the previous content are no longer valid and are reset by the upsert
+	record := &models.File{
+		BackendID:   s.backend.ID,
+		Path:        info.Key,
+		Size:        info.Size,
+		ETag:        info.ETag,
+		VersionID:   info.VersionID,
+		MD5Hash:     sums.MD5,
+		SHA256Hash:  sums.SHA256,
+		Compression: compression,
+		ModifiedAt:  info.LastModified,
+	}
+	if record.ModifiedAt.IsZero() {
+		record.ModifiedAt = time.Now().UTC()
+	}
+
+	if err := e.store.UpsertFile(ctx, record); err != nil {
+		return fmt.Errorf("failed to record metadata of '%s': %w", info.Key, err)
+	}
+
+	return nil
+}
+
+func (e *Engine) forgetFile(ctx context.Context, s *side, key string) error {
+	record, err := e.store.GetFile(ctx, s.backend.ID, key)
+	if err != nil {
+		return nil
+	}
+
+	if err := e.store.DeleteFile(ctx, record.ID); err != nil {
+		return fmt.Errorf("failed to remove metadata of '%s': %w", key, err)
+	}
+	return nil
+}
+
+// ParseIgnorePatterns splits the comma or newline separated glob patterns of a sync
+func ParseIgnorePatterns(value string) []string {
+	var patterns []string
+	for _, pattern := range strings.FieldsFunc(value, func(r rune) bool {
+		return r == ',' || r == '\n'
+	}) {
+		if pattern = strings.TrimSpace(pattern); pattern != "" {
+			patterns = append(patterns, pattern)
+		}
+	}
+	return patterns
+}
+
+// isIgnored matches the patterns against the full relative path and each of its segments
+func isIgnored(rel string, patterns []string) bool {
+	return ignoredBy(rel, patterns) != ""
+}
+
+// ignoredBy returns the first of the patterns matching the path or one of its segments, or "" if none does
+func ignoredBy(rel string, patterns []string) string {
+	for _, pattern := range patterns {
+		if ok, _ := path.Match(pattern, rel); ok {
+			return pattern
+		}
+		for _, segment := range strings.Split(rel, "/") {
+			if ok, _ := path.Match(strings.TrimSuffix(pattern, "/"), segment); ok {
+				return pattern
+			}
+		}
+	}
+	return ""
+}
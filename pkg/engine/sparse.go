@@ -0,0 +1,68 @@
+package engine
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+
+	"github.com/mwantia/gosync/pkg/db/store"
+	"github.com/mwantia/gosync/pkg/storage"
+)
+
+// sparseMap returns the data extents of a sparse source, so downloads into local directories recreate its holes.
+// Local files are probed directly, while backends keep the map recorded when the file was uploaded.
+func (e *Engine) sparseMap(ctx context.Context, from *side, key string, stat *storage.ObjectInfo) (*storage.SparseMap, error) {
+	if local, ok := from.storage.(*storage.LocalStorage); ok {
+		return local.SparseMap(key)
+	}
+	if from.backend == nil {
+		return nil, nil
+	}
+
+	record, err := e.store.GetFile(ctx, from.backend.ID, key)
+	if errors.Is(err, store.ErrNotFound) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to load metadata of '%s': %w", key, err)
+	}
+	// Maps of previous versions don't describe the content that is downloaded
+	if record.Sparse == "" || record.ETag != stat.ETag {
+		return nil, nil
+	}
+
+	var sparse storage.SparseMap
+	if err := json.Unmarshal([]byte(record.Sparse), &sparse); err != nil {
+		return nil, fmt.Errorf("invalid sparse map of '%s': %w", key, err)
+	}
+	return &sparse, nil
+}
+
+// recordSparse records the sparse map of a local file after it was uploaded to a backend. Records of dense files
+// keep no map, since recording the object resets it.
+func (e *Engine) recordSparse(ctx context.Context, from, to *side, fromKey, toKey string) error {
+	local, ok := from.storage.(*storage.LocalStorage)
+	if !ok || to.backend == nil {
+		return nil
+	}
+
+	sparse, err := local.SparseMap(fromKey)
+	if err != nil || sparse == nil {
+		return err
+	}
+	data, err := json.Marshal(sparse)
+	if err != nil {
+		return err
+	}
+
+	record, err := e.store.GetFile(ctx, to.backend.ID, toKey)
+	if err != nil {
+		return fmt.Errorf("failed to load metadata of '%s': %w", toKey, err)
+	}
+	record.Sparse = string(data)
+	if err := e.store.UpdateFile(ctx, record); err != nil {
+		return fmt.Errorf("failed to record sparse map of '%s': %w", toKey, err)
+	}
+	return nil
+}
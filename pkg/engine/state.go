@@ -0,0 +1,38 @@
+package engine
+
+import (
+	"context"
+	"errors"
+
+	"github.com/mwantia/gosync/pkg/db/models"
+	"github.com/mwantia/gosync/pkg/db/store"
+	"github.com/mwantia/gosync/pkg/vfs"
+)
+
+// loadSyncState returns the sync state of the client, which is tracked for the backend of the source.
+// A new state is returned if the client has none yet.
+func loadSyncState(ctx context.Context, ms store.MetadataStore, sc *models.SyncConfig, clientID string) (*models.SyncState, error) {
+	source, _ := ResolvePaths(sc, clientID)
+
+	backendID := ""
+	if !IsLocalPath(source) {
+		backendID = vfs.ParsePath(source).Backend
+	}
+
+	state, err := ms.GetSyncState(ctx, sc.ID, backendID, clientID)
+	if errors.Is(err, store.ErrNotFound) {
+		return &models.SyncState{
+			SyncConfigID: sc.ID,
+			BackendID:    backendID,
+			ClientID:     clientID,
+		}, nil
+	}
+	return state, err
+}
+
+func saveSyncState(ctx context.Context, ms store.MetadataStore, state *models.SyncState) error {
+	if state.ID == 0 {
+		return ms.CreateSyncState(ctx, state)
+	}
+	return ms.UpdateSyncState(ctx, state)
+}
@@ -0,0 +1,60 @@
+package engine
+
+import (
+	"sort"
+	"sync"
+
+	"github.com/mwantia/gosync/pkg/db/models"
+	"github.com/mwantia/gosync/pkg/storage"
+)
+
+// ValidSymlinkPolicy returns true if the symlink policy is supported, "" being the same as skip
+func ValidSymlinkPolicy(policy string) bool {
+	return policy == "" || policy == storage.SymlinkSkip || policy == storage.SymlinkFollow || policy == storage.SymlinkPreserve
+}
+
+// symlinkPolicy returns the symlink policy of the sync, defaulting to skip
+func symlinkPolicy(sc *models.SyncConfig) string {
+	if sc.Symlinks == "" {
+		return storage.SymlinkSkip
+	}
+	return sc.Symlinks
+}
+
+// skippedLinks collects the symbolic links skipped while listing the local sides of a sync
+type skippedLinks struct {
+	mutex sync.Mutex
+	links []storage.SkippedLink
+}
+
+// apply sets the symlink policy of the sync on all local sides, backends have no symbolic links
+func (l *skippedLinks) apply(sc *models.SyncConfig, sides ...*side) {
+	for _, s := range sides {
+		if local, ok := s.storage.(*storage.LocalStorage); ok {
+			local.SetSymlinks(symlinkPolicy(sc), l.add)
+		}
+	}
+}
+
+func (l *skippedLinks) add(link storage.SkippedLink) {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+	l.links = append(l.links, link)
+}
+
+// list returns the skipped links outside of ignored paths, sorted by key
+func (l *skippedLinks) list(ignore []string) []storage.SkippedLink {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	var links []storage.SkippedLink
+	for _, link := range l.links {
+		if !isIgnored(link.Key, ignore) {
+			links = append(links, link)
+		}
+	}
+	sort.Slice(links, func(i, j int) bool {
+		return links[i].Key < links[j].Key
+	})
+	return links
+}
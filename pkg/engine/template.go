@@ -0,0 +1,117 @@
+package engine
+
+import (
+	"context"
+	"fmt"
+	"path"
+	"regexp"
+	"strings"
+
+	"github.com/mwantia/gosync/pkg/storage"
+)
+
+// fileVariable matches the variables expanded for each transferred file, e.g. {year} or {tag:event}
+var fileVariable = regexp.MustCompile(`\{(date|year|month|day|tag:[^{}/]+)\}`)
+
+// untagged replaces {tag:<key>} variables of files without the tag
+const untagged = "untagged"
+
+// SplitPathTemplate splits the path into its static root and the template of the per-file
+// directories, e.g. "~/Photos/{year}/{date}" returns "~/Photos" and "{year}/{date}".
+// The template is empty if the path doesn't contain any per-file variables.
+func SplitPathTemplate(p string) (string, string) {
+	loc := fileVariable.FindStringIndex(p)
+	if loc == nil {
+		return p, ""
+	}
+
+	// Split at the start of the segment containing the first variable
+	cut := strings.LastIndexAny(p[:loc[0]], `/\`)
+	if cut < 0 {
+		return "", p
+	}
+	return p[:cut], p[cut+1:]
+}
+
+// expandFileTemplate returns the directory of the object below the destination root, using the
+// modification time of the source object and the tags recorded for it
+func (e *Engine) expandFileTemplate(ctx context.Context, template string, s *side, object *storage.ObjectInfo) (string, error) {
+	var tags map[string]string
+	var err error
+
+	expanded := fileVariable.ReplaceAllStringFunc(template, func(variable string) string {
+		name := strings.Trim(variable, "{}")
+		modified := object.LastModified.Local()
+
+		switch name {
+		case "date":
+			return modified.Format("2006-01-02")
+		case "year":
+			return modified.Format("2006")
+		case "month":
+			return modified.Format("01")
+		case "day":
+			return modified.Format("02")
+		}
+
+		if tags == nil && err == nil {
+			tags, err = e.fileTags(ctx, s, object.Key)
+		}
+		// Tag values must not escape the destination
+		value := strings.NewReplacer("/", "_", `\`, "_").Replace(tags[strings.TrimPrefix(name, "tag:")])
+		if value == "" || value == "." || value == ".." {
+			return untagged
+		}
+		return value
+	})
+	if err != nil {
+		return "", fmt.Errorf("failed to expand '%s' for '%s': %w", template, object.Key, err)
+	}
+
+	return path.Clean(strings.ReplaceAll(expanded, `\`, "/")), nil
+}
+
+// fileTags returns the tags of the object, which are only known for backends
+func (e *Engine) fileTags(ctx context.Context, s *side, rel string) (map[string]string, error) {
+	tags := make(map[string]string)
+	if s.backend == nil {
+		return tags, nil
+	}
+
+	file, err := e.store.GetFile(ctx, s.backend.ID, s.key(rel))
+	if err != nil {
+		// Files without metadata have no tags
+		return tags, nil
+	}
+
+	records, err := e.store.GetFileTags(ctx, file.ID)
+	if err != nil {
+		return nil, err
+	}
+	for _, tag := range records {
+		tags[tag.Key] = tag.Value
+	}
+	return tags, nil
+}
+
+// mapTemplate expands the template for every source object and returns the destination objects
+// by source path, together with the destination path of each source path
+func (e *Engine) mapTemplate(ctx context.Context, template string, source *side, sourceObjects, destObjects map[string]storage.ObjectInfo) (map[string]storage.ObjectInfo, map[string]string, error) {
+	mapped := make(map[string]storage.ObjectInfo, len(sourceObjects))
+	targets := make(map[string]string, len(sourceObjects))
+
+	for rel, object := range sourceObjects {
+		dir, err := e.expandFileTemplate(ctx, template, source, &object)
+		if err != nil {
+			return nil, nil, err
+		}
+
+		target := path.Join(dir, rel)
+		targets[rel] = target
+		if d, ok := destObjects[target]; ok {
+			mapped[rel] = d
+		}
+	}
+
+	return mapped, targets, nil
+}
@@ -0,0 +1,123 @@
+package engine
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/rand/v2"
+	"strconv"
+	"time"
+
+	"github.com/mwantia/gosync/pkg/checksum"
+	"github.com/mwantia/gosync/pkg/compress"
+	"github.com/mwantia/gosync/pkg/db/models"
+	"github.com/mwantia/gosync/pkg/storage"
+)
+
+// Verification modes of transferred files
+const (
+	VerifyOff     = "off"
+	VerifySampled = "sampled"
+	VerifyAlways  = "always"
+)
+
+// verifySampleRate is the share of transfers verified by syncs in sampled mode
+const verifySampleRate = 0.1
+
+// ErrIntegrity is returned for transfers whose written content doesn't match the checksums of their source.
+// The mismatch is recorded as integrity error and the transfer is queued once more within the same pass.
+var ErrIntegrity = errors.New("integrity check failed")
+
+// ValidVerifyMode returns true if the verification mode is supported, "" being the same as off
+func ValidVerifyMode(mode string) bool {
+	return mode == "" || mode == VerifyOff || mode == VerifySampled || mode == VerifyAlways
+}
+
+// verifies decides whether the next transfer of the sync is verified, which syncs in paranoid mode always do
+func verifies(sc *models.SyncConfig) bool {
+	if integrityMode(sc) == IntegrityParanoid {
+		return true
+	}
+	switch sc.Verify {
+	case VerifyAlways:
+		return true
+	case VerifySampled:
+		return rand.Float64() < verifySampleRate
+	default:
+		return false
+	}
+}
+
+// verifyTransfer compares the checksums computed while transferring the object with the checksums recorded for
+// its source and with the written object. The ETag of the written object is used if it is the MD5 of its content,
+// otherwise the object is read back, which downloads it again for multipart or encrypted uploads. Syncs in fast
+// mode never read back the written object, while syncs in paranoid mode always do. Objects written compressed
+// are compared by their decompressed content, since neither their ETag nor their size describe it.
+func (e *Engine) verifyTransfer(ctx context.Context, plan *Plan, from, to *side, fromKey, toKey string, stat *storage.ObjectInfo, sums checksum.Sums, compression string) error {
+	if sums.Size != stat.Size {
+		return e.integrityError(ctx, plan, toKey, "size", strconv.FormatInt(stat.Size, 10), strconv.FormatInt(sums.Size, 10))
+	}
+
+	// Recorded hashes are only valid for the version of the object they were computed for
+	if from.backend != nil {
+		if record, err := e.store.GetFile(ctx, from.backend.ID, fromKey); err == nil && record.ETag == stat.ETag {
+			if record.SHA256Hash != "" && record.SHA256Hash != sums.SHA256 {
+				return e.integrityError(ctx, plan, toKey, "sha256", record.SHA256Hash, sums.SHA256)
+			}
+			if record.MD5Hash != "" && record.MD5Hash != sums.MD5 {
+				return e.integrityError(ctx, plan, toKey, "md5", record.MD5Hash, sums.MD5)
+			}
+		}
+	}
+
+	mode := integrityMode(plan.Config)
+	if mode == IntegrityFast {
+		return nil
+	}
+
+	info, err := to.storage.Stat(ctx, toKey)
+	if err != nil {
+		return fmt.Errorf("failed to stat '%s' for verification: %w", toKey, err)
+	}
+	if compression == "" && mode != IntegrityParanoid && sums.MatchesETag(info.ETag) {
+		return nil
+	}
+	if compression == "" && info.Size != sums.Size {
+		return e.integrityError(ctx, plan, toKey, "size", strconv.FormatInt(sums.Size, 10), strconv.FormatInt(info.Size, 10))
+	}
+
+	reader, err := to.storage.Get(ctx, toKey)
+	if err == nil && compression != "" {
+		reader, err = compress.Decompress(reader, compression)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to read '%s' for verification: %w", toKey, err)
+	}
+	defer reader.Close()
+
+	written, err := checksum.Reader(reader)
+	if err != nil {
+		return fmt.Errorf("failed to read '%s' for verification: %w", toKey, err)
+	}
+	if written.SHA256 != sums.SHA256 {
+		return e.integrityError(ctx, plan, toKey, "sha256", sums.SHA256, written.SHA256)
+	}
+	return nil
+}
+
+// integrityError records the failed check and returns it as ErrIntegrity
+func (e *Engine) integrityError(ctx context.Context, plan *Plan, key, check, expected, actual string) error {
+	err := e.store.CreateIntegrityError(ctx, &models.IntegrityError{
+		SyncConfigID: plan.Config.ID,
+		ClientID:     e.clientID,
+		Path:         key,
+		DetectedAt:   time.Now().UTC(),
+		Check:        check,
+		Expected:     expected,
+		Actual:       actual,
+	})
+	if err != nil {
+		return fmt.Errorf("%w: %s of '%s' is %s, expected %s (failed to record: %v)", ErrIntegrity, check, key, actual, expected, err)
+	}
+	return fmt.Errorf("%w: %s of '%s' is %s, expected %s", ErrIntegrity, check, key, actual, expected)
+}
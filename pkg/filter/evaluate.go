@@ -0,0 +1,177 @@
+package filter
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/mwantia/gosync/pkg/backend"
+	"github.com/mwantia/gosync/pkg/db/models"
+	"github.com/mwantia/gosync/pkg/db/store"
+	"github.com/mwantia/gosync/pkg/dedup"
+)
+
+// tagPageSize is the number of files read at once if the candidates are looked up by a tag
+const tagPageSize = 500
+
+// ErrStop can be returned by the callback of Evaluate to stop without an error
+var ErrStop = errors.New("stop evaluation")
+
+// Evaluate calls fn for each tracked file matching the query. Files of all backends are considered,
+// except trashed objects and chunks. If the query requires a tag with a fixed value, only the files
+// with that tag are read, otherwise all files of the matching backends are checked.
+func Evaluate(ctx context.Context, ms store.MetadataStore, q *Query, fn func(f *File) error) error {
+	backends, err := ms.ListBackends(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to list backends: %w", err)
+	}
+
+	trashes := make(map[string]*backend.Trash, len(backends))
+	for i := range backends {
+		b := &backends[i]
+		trashes[b.ID] = backend.NewTrash(ms, nil, b)
+	}
+
+	e := &evaluation{
+		store:   ms,
+		query:   q,
+		tags:    usesTags(q.root),
+		trashes: trashes,
+		fn:      fn,
+	}
+
+	if key, value, ok := indexTag(q.root); ok {
+		err = e.byTag(ctx, key, value)
+	} else {
+		err = e.byBackend(ctx, backends)
+	}
+	if errors.Is(err, ErrStop) {
+		return nil
+	}
+	return err
+}
+
+type evaluation struct {
+	store store.MetadataStore
+	query *Query
+	// tags is set if the query references tags, which are only read for each file if necessary
+	tags    bool
+	trashes map[string]*backend.Trash
+	fn      func(f *File) error
+}
+
+func (e *evaluation) byTag(ctx context.Context, key, value string) error {
+	for offset := 0; ; offset += tagPageSize {
+		files, err := e.store.GetFilesByTag(ctx, key, value, tagPageSize, offset)
+		if err != nil {
+			return fmt.Errorf("failed to read files with tag '%s': %w", key, err)
+		}
+
+		for i := range files {
+			if err := e.check(ctx, &files[i]); err != nil {
+				return err
+			}
+		}
+		if len(files) < tagPageSize {
+			return nil
+		}
+	}
+}
+
+func (e *evaluation) byBackend(ctx context.Context, backends []models.Backend) error {
+	id, fixed := indexBackend(e.query.root)
+	for _, b := range backends {
+		if fixed && b.ID != id {
+			continue
+		}
+
+		err := e.store.IterateFiles(ctx, b.ID, "", func(file *models.File) error {
+			return e.check(ctx, file)
+		})
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// check calls the callback if the file matches the query
+func (e *evaluation) check(ctx context.Context, file *models.File) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	trash, ok := e.trashes[file.BackendID]
+	if !ok || trash.IsTrashKey(file.Path) || dedup.IsChunkKey(file.Path) {
+		return nil
+	}
+
+	f := &File{
+		Backend:    file.BackendID,
+		Path:       file.Path,
+		Size:       file.Size,
+		ModifiedAt: file.ModifiedAt,
+		Tags:       make(map[string]string),
+	}
+	if e.tags {
+		tags, err := e.store.GetFileTags(ctx, file.ID)
+		if err != nil {
+			return fmt.Errorf("failed to read tags of '%s': %w", file.Path, err)
+		}
+		for _, tag := range tags {
+			f.Tags[tag.Key] = tag.Value
+		}
+	}
+
+	if !e.query.Match(f) {
+		return nil
+	}
+	return e.fn(f)
+}
+
+// indexTag returns a tag with a fixed value all matching files must have
+func indexTag(n node) (string, string, bool) {
+	switch n := n.(type) {
+	case *tagNode:
+		if n.op == "=" && !strings.ContainsAny(n.value, "*?[\\") {
+			return n.key, n.value, true
+		}
+	case *andNode:
+		if key, value, ok := indexTag(n.left); ok {
+			return key, value, true
+		}
+		return indexTag(n.right)
+	}
+	return "", "", false
+}
+
+// indexBackend returns the backend all matching files must be stored in
+func indexBackend(n node) (string, bool) {
+	switch n := n.(type) {
+	case *backendNode:
+		if n.op == "=" && !strings.ContainsAny(n.pattern, "*?[\\") {
+			return n.pattern, true
+		}
+	case *andNode:
+		if id, ok := indexBackend(n.left); ok {
+			return id, true
+		}
+		return indexBackend(n.right)
+	}
+	return "", false
+}
+
+func usesTags(n node) bool {
+	switch n := n.(type) {
+	case *tagNode, *existsNode:
+		return true
+	case *andNode:
+		return usesTags(n.left) || usesTags(n.right)
+	case *orNode:
+		return usesTags(n.left) || usesTags(n.right)
+	case *notNode:
+		return usesTags(n.inner)
+	}
+	return false
+}
@@ -0,0 +1,329 @@
+package filter
+
+import (
+	"fmt"
+	"path"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// File is the candidate a query is evaluated against
+type File struct {
+	Backend    string
+	Path       string
+	Size       int64
+	ModifiedAt time.Time
+	Tags       map[string]string
+}
+
+// Match returns true if the file matches the query
+func (q *Query) Match(f *File) bool {
+	return q.root.match(f, time.Now())
+}
+
+type node interface {
+	// match is called with the time relative values like now-7d are resolved against
+	match(f *File, now time.Time) bool
+}
+
+type andNode struct {
+	left, right node
+}
+
+func (n *andNode) match(f *File, now time.Time) bool {
+	return n.left.match(f, now) && n.right.match(f, now)
+}
+
+type orNode struct {
+	left, right node
+}
+
+func (n *orNode) match(f *File, now time.Time) bool {
+	return n.left.match(f, now) || n.right.match(f, now)
+}
+
+type notNode struct {
+	inner node
+}
+
+func (n *notNode) match(f *File, now time.Time) bool {
+	return !n.inner.match(f, now)
+}
+
+type existsNode struct {
+	key string
+}
+
+func (n *existsNode) match(f *File, _ time.Time) bool {
+	_, ok := f.Tags[n.key]
+	return ok
+}
+
+// tagNode compares the value of a tag, numerically if both values are numbers
+type tagNode struct {
+	key   string
+	op    string
+	value string
+}
+
+func (n *tagNode) match(f *File, _ time.Time) bool {
+	v, ok := f.Tags[n.key]
+	switch n.op {
+	case "=":
+		return ok && matchGlob(n.value, v)
+	case "!=":
+		return !ok || !matchGlob(n.value, v)
+	case "contains":
+		return ok && strings.Contains(v, n.value)
+	}
+	return ok && compare(n.op, compareValues(v, n.value))
+}
+
+// pathNode matches the key of the file, or any of its parent directories, against a pattern
+type pathNode struct {
+	op      string
+	pattern string
+}
+
+func (n *pathNode) match(f *File, _ time.Time) bool {
+	if n.op == "contains" {
+		return strings.Contains(f.Path, n.pattern)
+	}
+
+	return MatchPath(n.pattern, f.Path) == (n.op == "=")
+}
+
+// MatchPath returns true if the path or one of its parent directories matches the glob pattern like used by
+// path.Match, so both "photos/*" and "photos" match all files below photos
+func MatchPath(pattern, p string) bool {
+	pattern = strings.Trim(pattern, "/")
+	for p = strings.Trim(p, "/"); p != "." && p != ""; p = path.Dir(p) {
+		if matchGlob(pattern, p) {
+			return true
+		}
+	}
+	return false
+}
+
+type backendNode struct {
+	op      string
+	pattern string
+}
+
+func (n *backendNode) match(f *File, _ time.Time) bool {
+	return matchGlob(n.pattern, f.Backend) == (n.op == "=")
+}
+
+type sizeNode struct {
+	op   string
+	size int64
+}
+
+func (n *sizeNode) match(f *File, _ time.Time) bool {
+	switch {
+	case f.Size < n.size:
+		return compare(n.op, -1)
+	case f.Size > n.size:
+		return compare(n.op, 1)
+	}
+	return compare(n.op, 0)
+}
+
+// modifiedNode compares the modification time with an absolute time, or with a time relative to now if offset is set
+type modifiedNode struct {
+	op     string
+	at     time.Time
+	offset time.Duration
+}
+
+func (n *modifiedNode) match(f *File, now time.Time) bool {
+	at := n.at
+	if at.IsZero() {
+		at = now.Add(-n.offset)
+	}
+	return compare(n.op, f.ModifiedAt.Compare(at))
+}
+
+// newTerm creates the node comparing the field with the value
+func newTerm(field, key, op, value string) (node, error) {
+	if op == ":" {
+		op = "="
+	}
+
+	switch field {
+	case "tag":
+		return &tagNode{key: key, op: op, value: value}, nil
+	case "path":
+		if op != "=" && op != "!=" && op != "contains" {
+			return nil, fmt.Errorf("unsupported operator '%s' for path", op)
+		}
+		if err := validGlob(value); err != nil {
+			return nil, err
+		}
+		return &pathNode{op: op, pattern: strings.Trim(value, "/")}, nil
+	case "backend":
+		if op != "=" && op != "!=" {
+			return nil, fmt.Errorf("unsupported operator '%s' for backend", op)
+		}
+		if err := validGlob(value); err != nil {
+			return nil, err
+		}
+		return &backendNode{op: op, pattern: value}, nil
+	case "size":
+		if op == "contains" {
+			return nil, fmt.Errorf("unsupported operator '%s' for size", op)
+		}
+		size, err := ParseSize(value)
+		if err != nil {
+			return nil, err
+		}
+		return &sizeNode{op: op, size: size}, nil
+	case "modified_time", "modified":
+		if op != "<" && op != "<=" && op != ">" && op != ">=" {
+			return nil, fmt.Errorf("unsupported operator '%s' for modified_time, use <, <=, > or >=", op)
+		}
+		return parseModified(op, value)
+	}
+	return nil, fmt.Errorf("unknown field '%s'", field)
+}
+
+// compare returns the result of the operator for the result of a three-way comparison
+func compare(op string, c int) bool {
+	switch op {
+	case "=":
+		return c == 0
+	case "!=":
+		return c != 0
+	case "<":
+		return c < 0
+	case "<=":
+		return c <= 0
+	case ">":
+		return c > 0
+	case ">=":
+		return c >= 0
+	}
+	return false
+}
+
+// compareValues compares two tag values numerically if both are numbers, or lexically otherwise
+func compareValues(a, b string) int {
+	x, errA := strconv.ParseFloat(a, 64)
+	y, errB := strconv.ParseFloat(b, 64)
+	if errA != nil || errB != nil {
+		return strings.Compare(a, b)
+	}
+	switch {
+	case x < y:
+		return -1
+	case x > y:
+		return 1
+	}
+	return 0
+}
+
+// matchGlob matches the value against a pattern like used by path.Match, falling back to equality for invalid patterns
+func matchGlob(pattern, value string) bool {
+	if !strings.ContainsAny(pattern, "*?[\\") {
+		return pattern == value
+	}
+	ok, err := path.Match(pattern, value)
+	if err != nil {
+		return pattern == value
+	}
+	return ok
+}
+
+func validGlob(pattern string) error {
+	if _, err := path.Match(pattern, ""); err != nil {
+		return fmt.Errorf("invalid pattern '%s': %w", pattern, err)
+	}
+	return nil
+}
+
+// sizeUnits are binary, like the sizes formatted by the CLI
+var sizeUnits = []struct {
+	suffix string
+	factor int64
+}{
+	{"TB", 1 << 40}, {"GB", 1 << 30}, {"MB", 1 << 20}, {"KB", 1 << 10},
+	{"T", 1 << 40}, {"G", 1 << 30}, {"M", 1 << 20}, {"K", 1 << 10}, {"B", 1},
+}
+
+// ParseSize parses sizes like 512, 10KB or 1.5G
+func ParseSize(value string) (int64, error) {
+	number, factor := strings.ToUpper(strings.TrimSpace(value)), int64(1)
+	for _, unit := range sizeUnits {
+		if strings.HasSuffix(number, unit.suffix) {
+			number, factor = strings.TrimSuffix(number, unit.suffix), unit.factor
+			break
+		}
+	}
+
+	n, err := strconv.ParseFloat(number, 64)
+	if err != nil || n < 0 {
+		return 0, fmt.Errorf("invalid size '%s' (expected e.g. 512, 10KB or 1.5GB)", value)
+	}
+	return int64(n * float64(factor)), nil
+}
+
+// modifiedLayouts contains the accepted layouts for absolute times, parsed in local time
+var modifiedLayouts = []string{
+	time.RFC3339,
+	"2006-01-02T15:04:05",
+	"2006-01-02T15:04",
+	"2006-01-02",
+}
+
+// parseModified parses absolute times like 2024-05-01 and relative times like now-30d, now-12h or now-2w
+func parseModified(op, value string) (node, error) {
+	if rest, ok := cutPrefixFold(value, "now"); ok {
+		if rest == "" {
+			return &modifiedNode{op: op}, nil
+		}
+		if offset, ok := strings.CutPrefix(rest, "-"); ok {
+			if d, err := parseOffset(offset); err == nil {
+				return &modifiedNode{op: op, offset: d}, nil
+			}
+		}
+		return nil, fmt.Errorf("invalid relative time '%s' (expected e.g. now-30d)", value)
+	}
+
+	for _, layout := range modifiedLayouts {
+		if t, err := time.ParseInLocation(layout, value, time.Local); err == nil {
+			return &modifiedNode{op: op, at: t}, nil
+		}
+	}
+	return nil, fmt.Errorf("invalid time '%s' (expected e.g. 2024-05-01 or now-30d)", value)
+}
+
+// ParseTime parses absolute times like 2024-05-01 and relative times like now-30d, which are resolved against now
+func ParseTime(value string, now time.Time) (time.Time, error) {
+	n, err := parseModified("", strings.TrimSpace(value))
+	if err != nil {
+		return time.Time{}, err
+	}
+	m := n.(*modifiedNode)
+	if m.at.IsZero() {
+		return now.Add(-m.offset), nil
+	}
+	return m.at, nil
+}
+
+// parseOffset parses durations, additionally supporting days (d), weeks (w) and years (y)
+func parseOffset(value string) (time.Duration, error) {
+	if n := len(value) - 1; n > 0 {
+		if count, err := strconv.Atoi(value[:n]); err == nil && count >= 0 {
+			switch value[n] {
+			case 'd':
+				return time.Duration(count) * 24 * time.Hour, nil
+			case 'w':
+				return time.Duration(count) * 7 * 24 * time.Hour, nil
+			case 'y':
+				return time.Duration(count) * 365 * 24 * time.Hour, nil
+			}
+		}
+	}
+	return time.ParseDuration(value)
+}
@@ -0,0 +1,264 @@
+package filter
+
+import (
+	"fmt"
+	"strings"
+	"unicode"
+)
+
+// Root is the first segment of all filter paths, e.g. filters/photos/red
+const Root = "filters"
+
+// Query is a parsed filter expression, e.g. "tag:colour=red AND (tag:rating>=4 OR NOT tag:archived)".
+//
+// Terms either compare a tag (tag:key=value, tag:key!=value, tag:key>=value, tag:key contains value or
+// just tag:key to check for its existence) or a field of the file (path, backend, size, modified_time).
+// Terms are combined with AND, OR, NOT and parentheses, with AND binding stronger than OR.
+type Query struct {
+	expr string
+	root node
+}
+
+// SyntaxError describes an invalid filter expression together with the position of the error
+type SyntaxError struct {
+	// Pos is the byte offset of the invalid token within the expression
+	Pos int
+	Msg string
+}
+
+func (e *SyntaxError) Error() string {
+	return fmt.Sprintf("%s at position %d", e.Msg, e.Pos+1)
+}
+
+// Parse parses a filter expression
+func Parse(expr string) (*Query, error) {
+	tokens, err := tokenize(expr)
+	if err != nil {
+		return nil, err
+	}
+
+	p := &parser{tokens: tokens, end: len(expr)}
+	if len(tokens) == 0 {
+		return nil, &SyntaxError{Pos: 0, Msg: "empty expression"}
+	}
+
+	root, err := p.parseOr()
+	if err != nil {
+		return nil, err
+	}
+	if t, ok := p.peek(); ok {
+		return nil, &SyntaxError{Pos: t.pos, Msg: fmt.Sprintf("unexpected '%s'", t.text)}
+	}
+
+	return &Query{
+		expr: strings.TrimSpace(expr),
+		root: root,
+	}, nil
+}
+
+func (q *Query) String() string {
+	return q.expr
+}
+
+type tokenKind int
+
+const (
+	tokenWord tokenKind = iota
+	tokenString
+	tokenOpen
+	tokenClose
+)
+
+type token struct {
+	kind tokenKind
+	text string
+	pos  int
+}
+
+// tokenize splits the expression into words, quoted strings and parentheses.
+// Words end at whitespace, parentheses and quotes, so "tag:title='My trip'" is read as a word followed by a string.
+func tokenize(expr string) ([]token, error) {
+	var tokens []token
+	for i := 0; i < len(expr); {
+		c := rune(expr[i])
+		switch {
+		case unicode.IsSpace(c):
+			i++
+		case c == '(':
+			tokens = append(tokens, token{kind: tokenOpen, text: "(", pos: i})
+			i++
+		case c == ')':
+			tokens = append(tokens, token{kind: tokenClose, text: ")", pos: i})
+			i++
+		case c == '\'' || c == '"':
+			end := strings.IndexByte(expr[i+1:], byte(c))
+			if end < 0 {
+				return nil, &SyntaxError{Pos: i, Msg: "unterminated string"}
+			}
+			tokens = append(tokens, token{kind: tokenString, text: expr[i+1 : i+1+end], pos: i})
+			i += end + 2
+		default:
+			start := i
+			for i < len(expr) && !unicode.IsSpace(rune(expr[i])) && !strings.ContainsRune("()'\"", rune(expr[i])) {
+				i++
+			}
+			tokens = append(tokens, token{kind: tokenWord, text: expr[start:i], pos: start})
+		}
+	}
+	return tokens, nil
+}
+
+type parser struct {
+	tokens []token
+	next   int
+	// end is the position reported for errors at the end of the expression
+	end int
+}
+
+func (p *parser) peek() (token, bool) {
+	if p.next >= len(p.tokens) {
+		return token{}, false
+	}
+	return p.tokens[p.next], true
+}
+
+// keyword consumes the next token if it is the keyword, which is matched case-insensitive
+func (p *parser) keyword(keyword string) bool {
+	t, ok := p.peek()
+	if ok && t.kind == tokenWord && strings.EqualFold(t.text, keyword) {
+		p.next++
+		return true
+	}
+	return false
+}
+
+func (p *parser) parseOr() (node, error) {
+	left, err := p.parseAnd()
+	if err != nil {
+		return nil, err
+	}
+
+	for p.keyword("OR") {
+		right, err := p.parseAnd()
+		if err != nil {
+			return nil, err
+		}
+		left = &orNode{left: left, right: right}
+	}
+	return left, nil
+}
+
+func (p *parser) parseAnd() (node, error) {
+	left, err := p.parseNot()
+	if err != nil {
+		return nil, err
+	}
+
+	for p.keyword("AND") {
+		right, err := p.parseNot()
+		if err != nil {
+			return nil, err
+		}
+		left = &andNode{left: left, right: right}
+	}
+	return left, nil
+}
+
+func (p *parser) parseNot() (node, error) {
+	if p.keyword("NOT") {
+		inner, err := p.parseNot()
+		if err != nil {
+			return nil, err
+		}
+		return &notNode{inner: inner}, nil
+	}
+
+	t, ok := p.peek()
+	if !ok {
+		return nil, &SyntaxError{Pos: p.end, Msg: "unexpected end of expression"}
+	}
+
+	switch t.kind {
+	case tokenOpen:
+		p.next++
+		inner, err := p.parseOr()
+		if err != nil {
+			return nil, err
+		}
+		if c, ok := p.peek(); !ok || c.kind != tokenClose {
+			return nil, &SyntaxError{Pos: t.pos, Msg: "unclosed parenthesis"}
+		}
+		p.next++
+		return inner, nil
+	case tokenWord:
+		p.next++
+		return p.parseTerm(t)
+	default:
+		return nil, &SyntaxError{Pos: t.pos, Msg: fmt.Sprintf("unexpected '%s'", t.text)}
+	}
+}
+
+// operators are ordered, so two character operators are found before their prefixes
+var operators = []string{"!=", ">=", "<=", "=", ">", "<", ":"}
+
+// parseTerm parses a comparison like tag:key=value, size>10MB or tag:key contains value
+func (p *parser) parseTerm(t token) (node, error) {
+	field, key := strings.ToLower(t.text), ""
+	op, value := "", ""
+
+	if rest, ok := cutPrefixFold(t.text, "tag:"); ok {
+		field = "tag"
+		key = rest
+		if i := strings.IndexAny(rest, "!=<>"); i >= 0 {
+			key = rest[:i]
+			op, value = cutOperator(rest[i:])
+		}
+		if key == "" {
+			return nil, &SyntaxError{Pos: t.pos, Msg: "missing tag key"}
+		}
+	} else if i := strings.IndexAny(t.text, "!=<>:"); i >= 0 {
+		field = strings.ToLower(t.text[:i])
+		op, value = cutOperator(t.text[i:])
+	}
+
+	if op == "" && p.keyword("contains") {
+		op = "contains"
+	}
+
+	// Values following the operator as separate token, e.g. quoted strings
+	if op != "" && value == "" {
+		if v, ok := p.peek(); ok && (v.kind == tokenString || (v.kind == tokenWord && op == "contains")) {
+			value = v.text
+			p.next++
+		}
+	}
+
+	if op == "" {
+		if field != "tag" {
+			return nil, &SyntaxError{Pos: t.pos, Msg: fmt.Sprintf("missing operator in '%s'", t.text)}
+		}
+		return &existsNode{key: key}, nil
+	}
+
+	n, err := newTerm(field, key, op, value)
+	if err != nil {
+		return nil, &SyntaxError{Pos: t.pos, Msg: err.Error()}
+	}
+	return n, nil
+}
+
+func cutOperator(s string) (string, string) {
+	for _, op := range operators {
+		if strings.HasPrefix(s, op) {
+			return op, s[len(op):]
+		}
+	}
+	return "", s
+}
+
+func cutPrefixFold(s, prefix string) (string, bool) {
+	if len(s) >= len(prefix) && strings.EqualFold(s[:len(prefix)], prefix) {
+		return s[len(prefix):], true
+	}
+	return s, false
+}
@@ -0,0 +1,317 @@
+package fixture
+
+import (
+	"crypto/md5"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math/rand/v2"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+)
+
+// Size distributions of generated files
+const (
+	SizesSmall  = "small"
+	SizesMedium = "medium"
+	SizesLarge  = "large"
+	SizesMixed  = "mixed"
+)
+
+// baseTime is the modification time of the first file, so generated trees are identical across runs
+var baseTime = time.Date(2024, time.January, 1, 0, 0, 0, 0, time.UTC)
+
+var extensions = []string{".bin", ".txt", ".jpg", ".pdf", ".log", ".dat"}
+
+// Options defines the generated tree
+type Options struct {
+	Files  int
+	Depth  int
+	Fanout int
+	Sizes  string
+	Seed   uint64
+}
+
+// Manifest describes the expected content of a generated tree
+type Manifest struct {
+	Seed    uint64  `json:"seed"`
+	Files   int     `json:"files"`
+	Depth   int     `json:"depth"`
+	Fanout  int     `json:"fanout"`
+	Sizes   string  `json:"sizes"`
+	Bytes   int64   `json:"bytes"`
+	Entries []Entry `json:"entries"`
+}
+
+// Entry is a single file of the manifest
+type Entry struct {
+	Path       string    `json:"path"`
+	Size       int64     `json:"size"`
+	MD5        string    `json:"md5"`
+	SHA256     string    `json:"sha256"`
+	ModifiedAt time.Time `json:"modified_at"`
+}
+
+// Generate writes a reproducible tree into dir and returns its manifest.
+// The same options always produce the same paths, content and modification times.
+func Generate(dir string, opts Options) (*Manifest, error) {
+	if opts.Files < 0 || opts.Depth < 0 {
+		return nil, fmt.Errorf("files and depth must not be negative")
+	}
+	if opts.Fanout <= 0 {
+		opts.Fanout = 4
+	}
+	if opts.Sizes == "" {
+		opts.Sizes = SizesMixed
+	}
+	if _, err := sizeOf(opts.Sizes, rand.New(rand.NewPCG(0, 0))); err != nil {
+		return nil, err
+	}
+
+	manifest := &Manifest{
+		Seed:    opts.Seed,
+		Files:   opts.Files,
+		Depth:   opts.Depth,
+		Fanout:  opts.Fanout,
+		Sizes:   opts.Sizes,
+		Entries: make([]Entry, 0, opts.Files),
+	}
+
+	// Layout and content use separate generators, so changing the content of a file doesn't move other files
+	layout := rand.New(rand.NewPCG(opts.Seed, 0x74726565))
+	for i := 0; i < opts.Files; i++ {
+		rel := filePath(layout, opts, i)
+		size, _ := sizeOf(opts.Sizes, layout)
+
+		entry, err := writeFile(dir, rel, size, opts.Seed, i)
+		if err != nil {
+			return nil, err
+		}
+		manifest.Entries = append(manifest.Entries, entry)
+		manifest.Bytes += entry.Size
+	}
+
+	sort.Slice(manifest.Entries, func(i, j int) bool {
+		return manifest.Entries[i].Path < manifest.Entries[j].Path
+	})
+	return manifest, nil
+}
+
+// filePath returns the path of the i-th file, placed in a random directory up to the maximum depth
+func filePath(r *rand.Rand, opts Options, i int) string {
+	depth := 0
+	if opts.Depth > 0 {
+		depth = r.IntN(opts.Depth + 1)
+	}
+
+	segments := make([]string, 0, depth+1)
+	for level := 0; level < depth; level++ {
+		segments = append(segments, fmt.Sprintf("dir-%d-%02d", level, r.IntN(opts.Fanout)))
+	}
+	segments = append(segments, fmt.Sprintf("file-%06d%s", i, extensions[r.IntN(len(extensions))]))
+
+	return filepath.ToSlash(filepath.Join(segments...))
+}
+
+// sizeOf returns a random size of the distribution
+func sizeOf(sizes string, r *rand.Rand) (int64, error) {
+	switch sizes {
+	case SizesSmall:
+		return r.Int64N(64 << 10), nil
+	case SizesMedium:
+		return 64<<10 + r.Int64N(4<<20-64<<10), nil
+	case SizesLarge:
+		return 4<<20 + r.Int64N(64<<20-4<<20), nil
+	case SizesMixed:
+		switch n := r.IntN(100); {
+		case n < 2:
+			return 0, nil
+		case n < 70:
+			return sizeOf(SizesSmall, r)
+		case n < 95:
+			return sizeOf(SizesMedium, r)
+		default:
+			return sizeOf(SizesLarge, r)
+		}
+	default:
+		return 0, fmt.Errorf("unsupported sizes '%s', expected %s, %s, %s or %s", sizes, SizesSmall, SizesMedium, SizesLarge, SizesMixed)
+	}
+}
+
+// writeFile writes size pseudo-random bytes derived from the seed and index of the file
+func writeFile(dir, rel string, size int64, seed uint64, i int) (Entry, error) {
+	name := filepath.Join(dir, filepath.FromSlash(rel))
+	if err := os.MkdirAll(filepath.Dir(name), 0755); err != nil {
+		return Entry{}, fmt.Errorf("failed to create directory of '%s': %w", rel, err)
+	}
+
+	file, err := os.Create(name)
+	if err != nil {
+		return Entry{}, fmt.Errorf("failed to create '%s': %w", rel, err)
+	}
+	defer file.Close()
+
+	var key [32]byte
+	copy(key[:], fmt.Sprintf("gosync-fixture-%016x-%08x", seed, i))
+	content := io.LimitReader(rand.NewChaCha8(key), size)
+
+	md5Hash := md5.New()
+	sha256Hash := sha256.New()
+	if _, err := io.Copy(io.MultiWriter(file, md5Hash, sha256Hash), content); err != nil {
+		return Entry{}, fmt.Errorf("failed to write '%s': %w", rel, err)
+	}
+	if err := file.Close(); err != nil {
+		return Entry{}, fmt.Errorf("failed to write '%s': %w", rel, err)
+	}
+
+	modifiedAt := baseTime.Add(time.Duration(i) * time.Minute)
+	if err := os.Chtimes(name, modifiedAt, modifiedAt); err != nil {
+		return Entry{}, fmt.Errorf("failed to set modification time of '%s': %w", rel, err)
+	}
+
+	return Entry{
+		Path:       rel,
+		Size:       size,
+		MD5:        hex.EncodeToString(md5Hash.Sum(nil)),
+		SHA256:     hex.EncodeToString(sha256Hash.Sum(nil)),
+		ModifiedAt: modifiedAt,
+	}, nil
+}
+
+// WriteManifest writes the manifest as indented JSON
+func WriteManifest(path string, manifest *Manifest) error {
+	data, err := json.MarshalIndent(manifest, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path, append(data, '\n'), 0644)
+}
+
+// ReadManifest reads a manifest written by WriteManifest
+func ReadManifest(path string) (*Manifest, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var manifest Manifest
+	if err := json.Unmarshal(data, &manifest); err != nil {
+		return nil, fmt.Errorf("failed to parse manifest '%s': %w", path, err)
+	}
+	return &manifest, nil
+}
+
+// Verify compares the tree in dir with the manifest and returns a description of every difference,
+// e.g. after syncing a generated tree to another client
+func Verify(dir string, manifest *Manifest) ([]string, error) {
+	expected := make(map[string]Entry, len(manifest.Entries))
+	for _, entry := range manifest.Entries {
+		expected[entry.Path] = entry
+	}
+
+	var problems []string
+	err := filepath.WalkDir(dir, func(name string, d os.DirEntry, err error) error {
+		if err != nil || d.IsDir() {
+			return err
+		}
+
+		rel, err := filepath.Rel(dir, name)
+		if err != nil {
+			return err
+		}
+		rel = filepath.ToSlash(rel)
+
+		entry, ok := expected[rel]
+		if !ok {
+			problems = append(problems, fmt.Sprintf("unexpected file '%s'", rel))
+			return nil
+		}
+		delete(expected, rel)
+
+		file, err := os.Open(name)
+		if err != nil {
+			return err
+		}
+		defer file.Close()
+
+		sha256Hash := sha256.New()
+		size, err := io.Copy(sha256Hash, file)
+		if err != nil {
+			return fmt.Errorf("failed to read '%s': %w", rel, err)
+		}
+
+		switch {
+		case size != entry.Size:
+			problems = append(problems, fmt.Sprintf("size of '%s' is %d instead of %d", rel, size, entry.Size))
+		case hex.EncodeToString(sha256Hash.Sum(nil)) != entry.SHA256:
+			problems = append(problems, fmt.Sprintf("content of '%s' differs", rel))
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	for rel := range expected {
+		problems = append(problems, fmt.Sprintf("missing file '%s'", rel))
+	}
+	sort.Strings(problems)
+	return problems, nil
+}
+
+// Scan returns the manifest of an existing tree, e.g. to compare two trees that were synced with each other
+func Scan(dir string) (*Manifest, error) {
+	manifest := &Manifest{}
+	err := filepath.WalkDir(dir, func(name string, d os.DirEntry, err error) error {
+		if err != nil || d.IsDir() {
+			return err
+		}
+
+		rel, err := filepath.Rel(dir, name)
+		if err != nil {
+			return err
+		}
+		rel = filepath.ToSlash(rel)
+
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+
+		file, err := os.Open(name)
+		if err != nil {
+			return err
+		}
+		defer file.Close()
+
+		md5Hash := md5.New()
+		sha256Hash := sha256.New()
+		size, err := io.Copy(io.MultiWriter(md5Hash, sha256Hash), file)
+		if err != nil {
+			return fmt.Errorf("failed to read '%s': %w", rel, err)
+		}
+
+		manifest.Entries = append(manifest.Entries, Entry{
+			Path:       rel,
+			Size:       size,
+			MD5:        hex.EncodeToString(md5Hash.Sum(nil)),
+			SHA256:     hex.EncodeToString(sha256Hash.Sum(nil)),
+			ModifiedAt: info.ModTime().UTC(),
+		})
+		manifest.Bytes += size
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	manifest.Files = len(manifest.Entries)
+	sort.Slice(manifest.Entries, func(i, j int) bool {
+		return manifest.Entries[i].Path < manifest.Entries[j].Path
+	})
+	return manifest, nil
+}
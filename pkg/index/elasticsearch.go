@@ -0,0 +1,98 @@
+package index
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+)
+
+// elasticsearch writes documents with the bulk API of Elasticsearch or OpenSearch
+type elasticsearch struct {
+	client *httpClient
+	index  string
+}
+
+func newElasticsearch(client *httpClient, index, apiKey string) *elasticsearch {
+	if apiKey != "" {
+		client.headers["Authorization"] = "ApiKey " + apiKey
+	}
+	return &elasticsearch{
+		client: client,
+		index:  index,
+	}
+}
+
+type bulkAction struct {
+	Index  *bulkTarget `json:"index,omitempty"`
+	Delete *bulkTarget `json:"delete,omitempty"`
+}
+
+type bulkTarget struct {
+	Index string `json:"_index"`
+	ID    string `json:"_id"`
+}
+
+func (e *elasticsearch) Upsert(ctx context.Context, docs []Document) error {
+	var buf bytes.Buffer
+	encoder := json.NewEncoder(&buf)
+	for _, doc := range docs {
+		if err := encoder.Encode(bulkAction{Index: &bulkTarget{Index: e.index, ID: doc.ID}}); err != nil {
+			return err
+		}
+		if err := encoder.Encode(doc); err != nil {
+			return err
+		}
+	}
+	return e.bulk(ctx, buf.Bytes())
+}
+
+func (e *elasticsearch) Delete(ctx context.Context, ids []string) error {
+	var buf bytes.Buffer
+	encoder := json.NewEncoder(&buf)
+	for _, id := range ids {
+		if err := encoder.Encode(bulkAction{Delete: &bulkTarget{Index: e.index, ID: id}}); err != nil {
+			return err
+		}
+	}
+	return e.bulk(ctx, buf.Bytes())
+}
+
+// bulk sends the actions and checks the result of each item, since failed items don't fail the request
+func (e *elasticsearch) bulk(ctx context.Context, body []byte) error {
+	data, _, err := e.client.do(ctx, http.MethodPost, "/_bulk", "application/x-ndjson", body)
+	if err != nil {
+		return fmt.Errorf("failed to write documents into index '%s': %w", e.index, err)
+	}
+
+	var result struct {
+		Errors bool                                `json:"errors"`
+		Items  []map[string]elasticsearchItemError `json:"items"`
+	}
+	if err := json.Unmarshal(data, &result); err != nil {
+		return fmt.Errorf("failed to decode bulk response: %w", err)
+	}
+	if !result.Errors {
+		return nil
+	}
+
+	for _, item := range result.Items {
+		for action, status := range item {
+			// Deleting a missing document is reported as not found
+			if status.Error == nil || (action == "delete" && status.Status == http.StatusNotFound) {
+				continue
+			}
+			return fmt.Errorf("failed to %s document '%s' in index '%s': %s", action, status.ID, e.index, status.Error.Reason)
+		}
+	}
+	return nil
+}
+
+type elasticsearchItemError struct {
+	ID     string `json:"_id"`
+	Status int    `json:"status"`
+	Error  *struct {
+		Reason string `json:"reason"`
+	} `json:"error"`
+}
@@ -0,0 +1,386 @@
+package index
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"path"
+	"slices"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	config "github.com/mwantia/gosync/internal/config/server"
+	"github.com/mwantia/gosync/pkg/backend"
+	"github.com/mwantia/gosync/pkg/compress"
+	"github.com/mwantia/gosync/pkg/db/models"
+	"github.com/mwantia/gosync/pkg/db/store"
+	"github.com/mwantia/gosync/pkg/dedup"
+	"github.com/mwantia/gosync/pkg/log"
+	"github.com/mwantia/gosync/pkg/storage"
+)
+
+const (
+	// defaultInterval is used for indexers without a configured interval
+	defaultInterval = 30 * time.Second
+	// defaultBatchSize is used for indexers without a configured batch size
+	defaultBatchSize = 500
+	// defaultMaxTextSize is the maximum size of extracted text in KB if not configured
+	defaultMaxTextSize = 1024
+)
+
+// Document is the representation of a file within the search index
+type Document struct {
+	ID         string `json:"id"`
+	Backend    string `json:"backend"`
+	Path       string `json:"path"`
+	Name       string `json:"name"`
+	Extension  string `json:"extension"`
+	Size       int64  `json:"size"`
+	MD5Hash    string `json:"md5_hash,omitempty"`
+	SHA256Hash string `json:"sha256_hash,omitempty"`
+	// ModifiedAt is a unix timestamp, so it can be sorted and filtered by all search engines
+	ModifiedAt int64 `json:"modified_at"`
+	// Tags of the file as "key=value"
+	Tags []string `json:"tags,omitempty"`
+	// Text is the content of text files if enabled for their extension
+	Text string `json:"text,omitempty"`
+}
+
+// DocumentID returns the id of the document of a file, which only contains characters accepted by all search engines
+func DocumentID(backendID, key string) string {
+	sum := sha256.Sum256([]byte(backendID + "/" + key))
+	return hex.EncodeToString(sum[:])
+}
+
+// Indexer keeps an external search index up to date with the files of the metadata store. Once all
+// files have been pushed, it follows the change feed of file events, remembering its position in the
+// metadata store, so no changes are lost while the agent isn't running.
+type Indexer struct {
+	name           string
+	store          store.MetadataStore
+	meter          *storage.Meter
+	sink           Sink
+	log            log.LoggerService
+	backends       []string
+	textExtensions []string
+	maxTextSize    int64
+	interval       time.Duration
+	batchSize      int
+}
+
+// NewIndexer creates an indexer pushing documents into the configured search engine
+func NewIndexer(cfg config.IndexerServerConfig, ms store.MetadataStore, meter *storage.Meter, logger log.LoggerService) (*Indexer, error) {
+	sink, err := NewSink(cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	ix := &Indexer{
+		name:        cfg.Name,
+		store:       ms,
+		meter:       meter,
+		sink:        sink,
+		log:         logger,
+		backends:    cfg.Backends,
+		maxTextSize: int64(defaultMaxTextSize) << 10,
+		interval:    defaultInterval,
+		batchSize:   defaultBatchSize,
+	}
+
+	for _, ext := range cfg.TextExtensions {
+		ext = strings.ToLower(ext)
+		if !strings.HasPrefix(ext, ".") {
+			ext = "." + ext
+		}
+		ix.textExtensions = append(ix.textExtensions, ext)
+	}
+	if cfg.MaxTextSize > 0 {
+		ix.maxTextSize = int64(cfg.MaxTextSize) << 10
+	}
+	if cfg.Interval != "" {
+		interval, err := time.ParseDuration(cfg.Interval)
+		if err != nil {
+			return nil, fmt.Errorf("invalid interval of indexer '%s': %w", cfg.Name, err)
+		}
+		ix.interval = interval
+	}
+	if cfg.BatchSize > 0 {
+		ix.batchSize = cfg.BatchSize
+	}
+
+	return ix, nil
+}
+
+// Name returns the name of the indexer
+func (ix *Indexer) Name() string {
+	return ix.name
+}
+
+// Run synchronizes the search index in the configured interval until the context is cancelled
+func (ix *Indexer) Run(ctx context.Context) error {
+	ticker := time.NewTicker(ix.interval)
+	defer ticker.Stop()
+
+	for {
+		if err := ix.Sync(ctx); err != nil && ctx.Err() == nil {
+			ix.log.Error("Failed to update search index '%s': %v", ix.name, err)
+		}
+
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-ticker.C:
+		}
+	}
+}
+
+// Sync pushes all changes since the last run into the search index. Without a stored position,
+// e.g. on the first run or after a reset, all current files are pushed instead.
+func (ix *Indexer) Sync(ctx context.Context) error {
+	backends, err := ix.loadBackends(ctx)
+	if err != nil {
+		return err
+	}
+
+	cursor, err := ix.store.GetIndexCursor(ctx, ix.name)
+	if errors.Is(err, store.ErrNotFound) {
+		cursor, err = ix.reindex(ctx, backends)
+	}
+	if err != nil {
+		return err
+	}
+
+	for {
+		events, err := ix.store.ListFileEventsAfter(ctx, cursor.EventID, ix.batchSize)
+		if err != nil {
+			return fmt.Errorf("failed to list file events: %w", err)
+		}
+		if len(events) == 0 {
+			return nil
+		}
+
+		if err := ix.apply(ctx, backends, events); err != nil {
+			return err
+		}
+
+		cursor.EventID = events[len(events)-1].ID
+		if err := ix.store.SaveIndexCursor(ctx, cursor); err != nil {
+			return fmt.Errorf("failed to save position of indexer '%s': %w", ix.name, err)
+		}
+		ix.log.Debug("Pushed %d file events into search index '%s'", len(events), ix.name)
+
+		if len(events) < ix.batchSize {
+			return nil
+		}
+	}
+}
+
+// reindex pushes all current files and returns the position within the change feed before the files were read,
+// so changes made while reindexing are applied afterwards
+func (ix *Indexer) reindex(ctx context.Context, backends map[string]*indexedBackend) (*models.IndexCursor, error) {
+	latest, err := ix.store.LatestFileEventID(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read latest file event: %w", err)
+	}
+
+	count := 0
+	batch := make([]Document, 0, ix.batchSize)
+	for _, b := range backends {
+		err := ix.store.IterateFiles(ctx, b.backend.ID, "", func(file *models.File) error {
+			if b.skip(file.Path) {
+				return nil
+			}
+
+			doc, err := ix.document(ctx, b, file)
+			if err != nil {
+				return err
+			}
+			batch = append(batch, *doc)
+			count++
+
+			if len(batch) < ix.batchSize {
+				return nil
+			}
+			err = ix.sink.Upsert(ctx, batch)
+			batch = batch[:0]
+			return err
+		})
+		if err != nil {
+			return nil, fmt.Errorf("failed to index files of backend '%s': %w", b.backend.ID, err)
+		}
+	}
+	if len(batch) > 0 {
+		if err := ix.sink.Upsert(ctx, batch); err != nil {
+			return nil, err
+		}
+	}
+
+	cursor := &models.IndexCursor{
+		Name:    ix.name,
+		EventID: latest,
+	}
+	if err := ix.store.SaveIndexCursor(ctx, cursor); err != nil {
+		return nil, fmt.Errorf("failed to save position of indexer '%s': %w", ix.name, err)
+	}
+
+	ix.log.Info("Pushed %d files into search index '%s'", count, ix.name)
+	return cursor, nil
+}
+
+// apply pushes the current state of all files changed by the events, so only the latest change of a path is sent
+func (ix *Indexer) apply(ctx context.Context, backends map[string]*indexedBackend, events []models.FileEvent) error {
+	type change struct {
+		backend *indexedBackend
+		key     string
+	}
+
+	var changes []change
+	seen := make(map[string]bool)
+	for _, event := range events {
+		b, ok := backends[event.BackendID]
+		if !ok || b.skip(event.Path) {
+			continue
+		}
+
+		id := DocumentID(event.BackendID, event.Path)
+		if !seen[id] {
+			seen[id] = true
+			changes = append(changes, change{backend: b, key: event.Path})
+		}
+	}
+
+	var upserts []Document
+	var deletes []string
+	for _, c := range changes {
+		file, err := ix.store.GetFile(ctx, c.backend.backend.ID, c.key)
+		if errors.Is(err, store.ErrNotFound) {
+			deletes = append(deletes, DocumentID(c.backend.backend.ID, c.key))
+			continue
+		}
+		if err != nil {
+			return fmt.Errorf("failed to find file '%s': %w", c.key, err)
+		}
+
+		doc, err := ix.document(ctx, c.backend, file)
+		if err != nil {
+			return err
+		}
+		upserts = append(upserts, *doc)
+	}
+
+	if len(upserts) > 0 {
+		if err := ix.sink.Upsert(ctx, upserts); err != nil {
+			return err
+		}
+	}
+	if len(deletes) > 0 {
+		if err := ix.sink.Delete(ctx, deletes); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// document creates the document of the file, including its tags and text if enabled for its extension
+func (ix *Indexer) document(ctx context.Context, b *indexedBackend, file *models.File) (*Document, error) {
+	name := path.Base(file.Path)
+	doc := &Document{
+		ID:         DocumentID(file.BackendID, file.Path),
+		Backend:    file.BackendID,
+		Path:       file.Path,
+		Name:       name,
+		Extension:  strings.ToLower(path.Ext(name)),
+		Size:       file.Size,
+		MD5Hash:    file.MD5Hash,
+		SHA256Hash: file.SHA256Hash,
+		ModifiedAt: file.ModifiedAt.Unix(),
+	}
+
+	tags, err := ix.store.GetFileTags(ctx, file.ID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read tags of '%s': %w", file.Path, err)
+	}
+	for _, tag := range tags {
+		doc.Tags = append(doc.Tags, tag.Key+"="+tag.Value)
+	}
+
+	if slices.Contains(ix.textExtensions, doc.Extension) && file.Size <= ix.maxTextSize {
+		text, err := ix.text(ctx, b, file)
+		if err != nil {
+			// Documents are still indexed by their metadata if the content can't be read
+			ix.log.Warn("Failed to extract text of '%s/%s': %v", file.BackendID, file.Path, err)
+		}
+		doc.Text = text
+	}
+
+	return doc, nil
+}
+
+// text reads the content of the file as text, replacing invalid UTF-8 sequences
+func (ix *Indexer) text(ctx context.Context, b *indexedBackend, file *models.File) (string, error) {
+	if b.storage == nil {
+		st, err := ix.meter.Open(b.backend)
+		if err != nil {
+			return "", err
+		}
+		b.storage = st
+	}
+
+	var reader io.ReadCloser
+	var err error
+	if file.Deduplicated {
+		reader, _, err = dedup.NewStore(ix.store, b.storage, b.backend).Open(ctx, file.Path)
+	} else if reader, err = b.storage.Get(ctx, file.Path); err == nil && file.Compression != "" {
+		reader, err = compress.Decompress(reader, file.Compression)
+	}
+	if err != nil {
+		return "", err
+	}
+	defer reader.Close()
+
+	data, err := io.ReadAll(io.LimitReader(reader, ix.maxTextSize))
+	if err != nil {
+		return "", err
+	}
+	if !utf8.Valid(data) {
+		return strings.ToValidUTF8(string(data), ""), nil
+	}
+	return string(data), nil
+}
+
+// indexedBackend is a backend whose files are pushed into the search index
+type indexedBackend struct {
+	backend *models.Backend
+	trash   *backend.Trash
+	// storage is opened once the content of a file is read
+	storage storage.Storage
+}
+
+// skip returns true for keys that don't reference files, like trashed objects, chunks and leases
+func (b *indexedBackend) skip(key string) bool {
+	return b.trash.IsTrashKey(key) || dedup.IsChunkKey(key) || backend.IsLeaseKey(key)
+}
+
+func (ix *Indexer) loadBackends(ctx context.Context) (map[string]*indexedBackend, error) {
+	backends, err := ix.store.ListBackends(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list backends: %w", err)
+	}
+
+	result := make(map[string]*indexedBackend)
+	for i := range backends {
+		b := &backends[i]
+		if len(ix.backends) > 0 && !slices.Contains(ix.backends, b.ID) {
+			continue
+		}
+		result[b.ID] = &indexedBackend{
+			backend: b,
+			trash:   backend.NewTrash(ix.store, nil, b),
+		}
+	}
+	return result, nil
+}
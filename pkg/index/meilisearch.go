@@ -0,0 +1,52 @@
+package index
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+)
+
+// meilisearch writes documents with the documents API of Meilisearch. Requests are processed
+// asynchronously as tasks, so accepted documents may not be searchable immediately.
+type meilisearch struct {
+	client *httpClient
+	index  string
+}
+
+func newMeilisearch(client *httpClient, index, apiKey string) *meilisearch {
+	if apiKey != "" {
+		client.headers["Authorization"] = "Bearer " + apiKey
+	}
+	return &meilisearch{
+		client: client,
+		index:  index,
+	}
+}
+
+func (m *meilisearch) Upsert(ctx context.Context, docs []Document) error {
+	body, err := json.Marshal(docs)
+	if err != nil {
+		return err
+	}
+
+	path := "/indexes/" + url.PathEscape(m.index) + "/documents?primaryKey=id"
+	if _, _, err := m.client.do(ctx, http.MethodPost, path, "application/json", body); err != nil {
+		return fmt.Errorf("failed to write documents into index '%s': %w", m.index, err)
+	}
+	return nil
+}
+
+func (m *meilisearch) Delete(ctx context.Context, ids []string) error {
+	body, err := json.Marshal(ids)
+	if err != nil {
+		return err
+	}
+
+	path := "/indexes/" + url.PathEscape(m.index) + "/documents/delete-batch"
+	if _, _, err := m.client.do(ctx, http.MethodPost, path, "application/json", body); err != nil {
+		return fmt.Errorf("failed to delete documents from index '%s': %w", m.index, err)
+	}
+	return nil
+}
@@ -0,0 +1,97 @@
+package index
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+
+	config "github.com/mwantia/gosync/internal/config/server"
+)
+
+// Types of the supported search engines
+const (
+	TypeElasticsearch = "elasticsearch"
+	TypeMeilisearch   = "meilisearch"
+	TypeTypesense     = "typesense"
+)
+
+// defaultTimeout is used for requests to the search engine without a configured timeout
+const defaultTimeout = 30 * time.Second
+
+// Sink writes documents into the index of a search engine
+type Sink interface {
+	// Upsert creates or replaces the documents
+	Upsert(ctx context.Context, docs []Document) error
+	// Delete removes the documents with the ids, missing documents are ignored
+	Delete(ctx context.Context, ids []string) error
+}
+
+// NewSink creates the sink for the search engine of the indexer
+func NewSink(cfg config.IndexerServerConfig) (Sink, error) {
+	timeout := defaultTimeout
+	if cfg.Timeout != "" {
+		parsed, err := time.ParseDuration(cfg.Timeout)
+		if err != nil {
+			return nil, fmt.Errorf("invalid timeout of indexer '%s': %w", cfg.Name, err)
+		}
+		timeout = parsed
+	}
+
+	client := &httpClient{
+		client:  &http.Client{Timeout: timeout},
+		baseURL: strings.TrimSuffix(cfg.URL, "/"),
+		headers: make(map[string]string),
+	}
+
+	switch cfg.Type {
+	case TypeElasticsearch:
+		return newElasticsearch(client, cfg.Index, cfg.APIKey), nil
+	case TypeMeilisearch:
+		return newMeilisearch(client, cfg.Index, cfg.APIKey), nil
+	case TypeTypesense:
+		return newTypesense(client, cfg.Index, cfg.APIKey), nil
+	default:
+		return nil, fmt.Errorf("unsupported search engine '%s' of indexer '%s'", cfg.Type, cfg.Name)
+	}
+}
+
+// httpClient sends requests to the API of a search engine
+type httpClient struct {
+	client  *http.Client
+	baseURL string
+	headers map[string]string
+}
+
+// do sends the request and returns the body of successful responses, or an error including the returned body
+func (c *httpClient) do(ctx context.Context, method, path, contentType string, body []byte) ([]byte, int, error) {
+	req, err := http.NewRequestWithContext(ctx, method, c.baseURL+path, bytes.NewReader(body))
+	if err != nil {
+		return nil, 0, err
+	}
+
+	if contentType != "" {
+		req.Header.Set("Content-Type", contentType)
+	}
+	for key, value := range c.headers {
+		req.Header.Set(key, value)
+	}
+
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer resp.Body.Close()
+
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, resp.StatusCode, err
+	}
+	if resp.StatusCode >= 300 {
+		return nil, resp.StatusCode, fmt.Errorf("unexpected status %s: %s", resp.Status, strings.TrimSpace(string(data)))
+	}
+	return data, resp.StatusCode, nil
+}
@@ -0,0 +1,72 @@
+package index
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+)
+
+// typesense writes documents with the import API of Typesense. The collection must already exist
+// with a schema matching the fields of Document.
+type typesense struct {
+	client     *httpClient
+	collection string
+}
+
+func newTypesense(client *httpClient, collection, apiKey string) *typesense {
+	if apiKey != "" {
+		client.headers["X-TYPESENSE-API-KEY"] = apiKey
+	}
+	return &typesense{
+		client:     client,
+		collection: collection,
+	}
+}
+
+func (t *typesense) Upsert(ctx context.Context, docs []Document) error {
+	var buf bytes.Buffer
+	encoder := json.NewEncoder(&buf)
+	for _, doc := range docs {
+		if err := encoder.Encode(doc); err != nil {
+			return err
+		}
+	}
+
+	path := "/collections/" + url.PathEscape(t.collection) + "/documents/import?action=upsert"
+	data, _, err := t.client.do(ctx, http.MethodPost, path, "text/plain", buf.Bytes())
+	if err != nil {
+		return fmt.Errorf("failed to write documents into collection '%s': %w", t.collection, err)
+	}
+
+	// The import responds with one result per document, even if some of them failed
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	scanner.Buffer(make([]byte, 64<<10), 16<<20)
+	for scanner.Scan() {
+		var result struct {
+			Success bool   `json:"success"`
+			Error   string `json:"error"`
+		}
+		if err := json.Unmarshal(scanner.Bytes(), &result); err != nil {
+			return fmt.Errorf("failed to decode import response: %w", err)
+		}
+		if !result.Success {
+			return fmt.Errorf("failed to write document into collection '%s': %s", t.collection, result.Error)
+		}
+	}
+	return scanner.Err()
+}
+
+func (t *typesense) Delete(ctx context.Context, ids []string) error {
+	for _, id := range ids {
+		path := "/collections/" + url.PathEscape(t.collection) + "/documents/" + url.PathEscape(id)
+		_, status, err := t.client.do(ctx, http.MethodDelete, path, "", nil)
+		if err != nil && status != http.StatusNotFound {
+			return fmt.Errorf("failed to delete document '%s' from collection '%s': %w", id, t.collection, err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,45 @@
+package knownfolder
+
+import (
+	"fmt"
+	"path/filepath"
+)
+
+// Folder is a well-known folder within the home directory of the current user
+type Folder string
+
+const (
+	Documents Folder = "documents"
+	Pictures  Folder = "pictures"
+	Desktop   Folder = "desktop"
+)
+
+// All lists all supported known folders
+var All = []Folder{Documents, Pictures, Desktop}
+
+// Path resolves the absolute location of the known folder on this platform,
+// which may have been moved or localized by the user
+func Path(f Folder) (string, error) {
+	p, err := resolve(f)
+	if err != nil {
+		return "", fmt.Errorf("failed to resolve %s folder: %w", f, err)
+	}
+	if !filepath.IsAbs(p) {
+		return "", fmt.Errorf("failed to resolve %s folder: '%s' is not absolute", f, p)
+	}
+	return filepath.Clean(p), nil
+}
+
+// Name returns the default name of the folder, e.g. "Documents"
+func (f Folder) Name() string {
+	switch f {
+	case Documents:
+		return "Documents"
+	case Pictures:
+		return "Pictures"
+	case Desktop:
+		return "Desktop"
+	default:
+		return string(f)
+	}
+}
@@ -0,0 +1,77 @@
+//go:build !windows
+
+package knownfolder
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// resolve uses the XDG user directories if configured, falling back to the folder name within the home directory
+func resolve(f Folder) (string, error) {
+	var key string
+	switch f {
+	case Documents:
+		key = "XDG_DOCUMENTS_DIR"
+	case Pictures:
+		key = "XDG_PICTURES_DIR"
+	case Desktop:
+		key = "XDG_DESKTOP_DIR"
+	default:
+		return "", fmt.Errorf("unknown folder '%s'", f)
+	}
+
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return "", err
+	}
+
+	if p := os.Getenv(key); p != "" {
+		return expandHome(p, home), nil
+	}
+	if p, ok := lookupUserDir(key, home); ok {
+		return p, nil
+	}
+	return filepath.Join(home, f.Name()), nil
+}
+
+// lookupUserDir reads the key from user-dirs.dirs, as written by xdg-user-dirs-update
+func lookupUserDir(key, home string) (string, bool) {
+	configHome := os.Getenv("XDG_CONFIG_HOME")
+	if configHome == "" {
+		configHome = filepath.Join(home, ".config")
+	}
+
+	file, err := os.Open(filepath.Join(configHome, "user-dirs.dirs"))
+	if err != nil {
+		return "", false
+	}
+	defer file.Close()
+
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		name, value, ok := strings.Cut(line, "=")
+		if !ok || strings.HasPrefix(line, "#") || strings.TrimSpace(name) != key {
+			continue
+		}
+
+		value = strings.Trim(strings.TrimSpace(value), `"`)
+		// A folder pointing to the home directory itself means it is disabled
+		if p := expandHome(value, home); p != "" && filepath.Clean(p) != filepath.Clean(home) {
+			return p, true
+		}
+		return "", false
+	}
+	return "", false
+}
+
+func expandHome(p, home string) string {
+	if rest, ok := strings.CutPrefix(p, "$HOME"); ok {
+		return home + rest
+	}
+	return p
+}
@@ -0,0 +1,25 @@
+//go:build windows
+
+package knownfolder
+
+import (
+	"fmt"
+
+	"golang.org/x/sys/windows"
+)
+
+// resolve looks up the folder with SHGetKnownFolderPath, which respects redirected folders
+func resolve(f Folder) (string, error) {
+	var id *windows.KNOWNFOLDERID
+	switch f {
+	case Documents:
+		id = windows.FOLDERID_Documents
+	case Pictures:
+		id = windows.FOLDERID_Pictures
+	case Desktop:
+		id = windows.FOLDERID_Desktop
+	default:
+		return "", fmt.Errorf("unknown folder '%s'", f)
+	}
+	return windows.KnownFolderPath(id, windows.KF_FLAG_DEFAULT)
+}
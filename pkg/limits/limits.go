@@ -0,0 +1,192 @@
+package limits
+
+import (
+	"context"
+	"runtime"
+	"runtime/metrics"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/mwantia/gosync/pkg/log"
+)
+
+const (
+	// pollInterval defines how often delayed work checks whether the usage dropped below the limits
+	pollInterval = 250 * time.Millisecond
+	// warnInterval limits how often warnings about exceeded limits are logged
+	warnInterval = time.Minute
+	// heapMetric is the memory occupied by live and not yet collected heap objects
+	heapMetric = "/memory/classes/heap/objects:bytes"
+)
+
+// Stats describes the tracked resource usage and how often work was delayed or shed
+type Stats struct {
+	OpenFiles    int64 `json:"open_files"`
+	MaxOpenFiles int64 `json:"max_open_files"`
+	// Memory is the estimated heap memory in bytes
+	Memory          uint64 `json:"memory"`
+	MemoryWatermark uint64 `json:"memory_watermark"`
+	// Delayed counts actions that had to wait for resources
+	Delayed int64 `json:"delayed"`
+	// Shed counts scheduled passes that were postponed, since the memory watermark was exceeded
+	Shed int64 `json:"shed"`
+}
+
+// Limiter enforces self-imposed limits on open files and memory, so large workloads are slowed down
+// instead of failing with EMFILE or being killed for running out of memory. A nil limiter doesn't limit anything.
+type Limiter struct {
+	mutex    sync.Mutex
+	log      log.LoggerService
+	lastWarn time.Time
+
+	maxOpenFiles    int64
+	memoryWatermark uint64
+
+	openFiles atomic.Int64
+	delayed   atomic.Int64
+	shed      atomic.Int64
+}
+
+// New creates a limiter allowing at most maxOpenFiles files held open by transfers and delaying
+// new work while the heap exceeds memoryWatermark bytes; 0 disables the respective limit
+func New(maxOpenFiles int64, memoryWatermark uint64, logger log.LoggerService) *Limiter {
+	return &Limiter{
+		log:             logger,
+		maxOpenFiles:    maxOpenFiles,
+		memoryWatermark: memoryWatermark,
+	}
+}
+
+// AcquireFiles waits until n more files may be opened without exceeding the limit.
+// The files must be released with ReleaseFiles once they were closed.
+func (l *Limiter) AcquireFiles(ctx context.Context, n int64) error {
+	if l == nil || n <= 0 {
+		return nil
+	}
+
+	delayed := false
+	for {
+		if l.tryAcquire(n) {
+			return nil
+		}
+
+		if !delayed {
+			delayed = true
+			l.delayed.Add(1)
+			l.warn("Open files reached the limit of %d, delaying transfers", l.maxOpenFiles)
+		}
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(pollInterval):
+		}
+	}
+}
+
+func (l *Limiter) tryAcquire(n int64) bool {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	open := l.openFiles.Load()
+	// A single acquisition is always allowed, so limits below n can't block forever
+	if l.maxOpenFiles > 0 && open > 0 && open+n > l.maxOpenFiles {
+		return false
+	}
+	l.openFiles.Add(n)
+	return true
+}
+
+// ReleaseFiles releases files acquired with AcquireFiles
+func (l *Limiter) ReleaseFiles(n int64) {
+	if l == nil || n <= 0 {
+		return
+	}
+	l.openFiles.Add(-n)
+}
+
+// WaitMemory waits until the heap is below the memory watermark
+func (l *Limiter) WaitMemory(ctx context.Context) error {
+	if l == nil || l.memoryWatermark == 0 {
+		return nil
+	}
+
+	delayed := false
+	for {
+		memory := heapMemory()
+		if memory < l.memoryWatermark {
+			return nil
+		}
+
+		if !delayed {
+			delayed = true
+			l.delayed.Add(1)
+			l.warn("Memory usage of %d MB exceeds the watermark of %d MB, delaying work", memory>>20, l.memoryWatermark>>20)
+			// Garbage that wasn't collected yet counts towards the heap as well
+			runtime.GC()
+		}
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(pollInterval):
+		}
+	}
+}
+
+// Shed returns true if new passes should be postponed, since the memory watermark is exceeded
+func (l *Limiter) Shed() bool {
+	if l == nil || l.memoryWatermark == 0 {
+		return false
+	}
+
+	memory := heapMemory()
+	if memory < l.memoryWatermark {
+		return false
+	}
+
+	l.shed.Add(1)
+	l.warn("Memory usage of %d MB exceeds the watermark of %d MB, postponing scheduled syncs", memory>>20, l.memoryWatermark>>20)
+	return true
+}
+
+// Stats returns the current resource usage
+func (l *Limiter) Stats() Stats {
+	if l == nil {
+		return Stats{Memory: heapMemory()}
+	}
+
+	return Stats{
+		OpenFiles:       l.openFiles.Load(),
+		MaxOpenFiles:    l.maxOpenFiles,
+		Memory:          heapMemory(),
+		MemoryWatermark: l.memoryWatermark,
+		Delayed:         l.delayed.Load(),
+		Shed:            l.shed.Load(),
+	}
+}
+
+// warn logs the warning unless another warning was logged within the warnInterval
+func (l *Limiter) warn(msg string, args ...any) {
+	l.mutex.Lock()
+	if time.Since(l.lastWarn) < warnInterval {
+		l.mutex.Unlock()
+		return
+	}
+	l.lastWarn = time.Now()
+	l.mutex.Unlock()
+
+	l.log.Warn(msg, args...)
+}
+
+// heapMemory returns the estimated heap memory in bytes without stopping the world
+func heapMemory() uint64 {
+	sample := []metrics.Sample{{Name: heapMetric}}
+	metrics.Read(sample)
+
+	if sample[0].Value.Kind() != metrics.KindUint64 {
+		return 0
+	}
+	return sample[0].Value.Uint64()
+}
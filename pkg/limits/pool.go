@@ -0,0 +1,176 @@
+package limits
+
+import (
+	"context"
+	"sync"
+)
+
+// Pool limits the actions applied at the same time by all sync passes. Free slots are handed to the
+// waiting syncs in proportion to their weight using stride scheduling, so a large sync keeping all of
+// its workers busy can't starve a small one. A nil pool doesn't limit anything.
+type Pool struct {
+	mutex sync.Mutex
+	size  int
+	used  int
+	// clock is the virtual time of the last grant, which syncs starting to wait are moved up to,
+	// so they can't claim the slots they didn't use while idle
+	clock float64
+	syncs map[uint]*poolSync
+}
+
+// poolSync tracks the waiting actions and virtual time of a single sync
+type poolSync struct {
+	weight  int
+	pass    float64
+	running int
+	waiting []chan struct{}
+}
+
+// PoolStats describes the usage of the pool
+type PoolStats struct {
+	Size    int `json:"size"`
+	Used    int `json:"used"`
+	Waiting int `json:"waiting"`
+}
+
+// NewPool creates a pool allowing at most size actions at the same time, or returns nil if size is 0
+func NewPool(size int) *Pool {
+	if size <= 0 {
+		return nil
+	}
+	return &Pool{
+		size:  size,
+		syncs: make(map[uint]*poolSync),
+	}
+}
+
+// Acquire waits until the sync may apply another action. Each slot acquired must be released with Release.
+func (p *Pool) Acquire(ctx context.Context, syncID uint, weight int) error {
+	if p == nil {
+		return nil
+	}
+
+	p.mutex.Lock()
+	s := p.sync(syncID, weight)
+	if p.used < p.size && p.waiters() == 0 {
+		p.grant(s)
+		p.mutex.Unlock()
+		return nil
+	}
+
+	ready := make(chan struct{})
+	s.waiting = append(s.waiting, ready)
+	p.mutex.Unlock()
+
+	select {
+	case <-ready:
+		return nil
+	case <-ctx.Done():
+		p.mutex.Lock()
+		defer p.mutex.Unlock()
+
+		for i, w := range s.waiting {
+			if w == ready {
+				s.waiting = append(s.waiting[:i], s.waiting[i+1:]...)
+				p.cleanup(syncID, s)
+				return ctx.Err()
+			}
+		}
+		// The slot was granted while cancelling, so it is handed on right away
+		p.release(syncID, s)
+		return ctx.Err()
+	}
+}
+
+// Release returns a slot acquired by the sync and hands it to the next waiting sync
+func (p *Pool) Release(syncID uint) {
+	if p == nil {
+		return
+	}
+
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	if s, ok := p.syncs[syncID]; ok {
+		p.release(syncID, s)
+	}
+}
+
+// Stats returns the current usage of the pool
+func (p *Pool) Stats() PoolStats {
+	if p == nil {
+		return PoolStats{}
+	}
+
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	return PoolStats{
+		Size:    p.size,
+		Used:    p.used,
+		Waiting: p.waiters(),
+	}
+}
+
+// sync returns the state of the sync, moving its virtual time up to the clock if it was idle
+func (p *Pool) sync(syncID uint, weight int) *poolSync {
+	s, ok := p.syncs[syncID]
+	if !ok {
+		s = &poolSync{pass: p.clock}
+		p.syncs[syncID] = s
+	}
+	s.weight = max(weight, 1)
+	if s.running == 0 && len(s.waiting) == 0 {
+		s.pass = max(s.pass, p.clock)
+	}
+	return s
+}
+
+func (p *Pool) grant(s *poolSync) {
+	p.used++
+	s.running++
+	p.clock = s.pass
+	s.pass += 1 / float64(s.weight)
+}
+
+func (p *Pool) release(syncID uint, s *poolSync) {
+	p.used--
+	s.running--
+	p.cleanup(syncID, s)
+	p.dispatch()
+}
+
+// dispatch hands free slots to the waiting sync with the lowest virtual time
+func (p *Pool) dispatch() {
+	for p.used < p.size {
+		var next *poolSync
+		for _, s := range p.syncs {
+			if len(s.waiting) > 0 && (next == nil || s.pass < next.pass) {
+				next = s
+			}
+		}
+		if next == nil {
+			return
+		}
+
+		ready := next.waiting[0]
+		next.waiting = next.waiting[1:]
+		p.grant(next)
+		close(ready)
+	}
+}
+
+// cleanup forgets syncs without running or waiting actions, since syncs may be deleted at any time
+func (p *Pool) cleanup(syncID uint, s *poolSync) {
+	if s.running == 0 && len(s.waiting) == 0 && s.pass <= p.clock {
+		delete(p.syncs, syncID)
+	}
+}
+
+func (p *Pool) waiters() int {
+	n := 0
+	for _, s := range p.syncs {
+		n += len(s.waiting)
+	}
+	return n
+}
@@ -0,0 +1,76 @@
+package log
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"net"
+	"os"
+	"strings"
+	"sync"
+)
+
+// journaldSocket is the native protocol socket of systemd-journald
+const journaldSocket = "/run/systemd/journal/socket"
+
+// journaldOutput sends structured entries to journald using its native protocol,
+// so the level is kept as priority and the service is searchable as GOSYNC_SERVICE
+type journaldOutput struct {
+	mutex  sync.Mutex
+	socket string
+	tag    string
+	conn   net.Conn
+}
+
+func newJournaldOutput(socket, tag string) *journaldOutput {
+	if socket == "" {
+		socket = journaldSocket
+	}
+
+	return &journaldOutput{
+		socket: socket,
+		tag:    tag,
+	}
+}
+
+func (o *journaldOutput) write(r record) {
+	var buf bytes.Buffer
+	journaldField(&buf, "MESSAGE", r.Message)
+	journaldField(&buf, "PRIORITY", fmt.Sprint(r.Level.Severity()))
+	journaldField(&buf, "SYSLOG_IDENTIFIER", o.tag)
+	if r.Service != "" {
+		journaldField(&buf, "GOSYNC_SERVICE", strings.TrimPrefix(r.Service, "/"))
+	}
+
+	o.mutex.Lock()
+	defer o.mutex.Unlock()
+
+	if o.conn == nil {
+		conn, err := net.Dial("unixgram", o.socket)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "failed to connect to journald: %v\n", err)
+			return
+		}
+		o.conn = conn
+	}
+
+	if _, err := o.conn.Write(buf.Bytes()); err != nil {
+		fmt.Fprintf(os.Stderr, "failed to write to journald: %v\n", err)
+		o.conn.Close()
+		o.conn = nil
+	}
+}
+
+// journaldField appends the field, using the binary encoding for values spanning multiple lines
+func journaldField(buf *bytes.Buffer, key, value string) {
+	if !strings.Contains(value, "\n") {
+		fmt.Fprintf(buf, "%s=%s\n", key, value)
+		return
+	}
+
+	buf.WriteString(key)
+	buf.WriteByte('\n')
+	binary.Write(buf, binary.LittleEndian, uint64(len(value)))
+	buf.WriteString(value)
+	buf.WriteByte('\n')
+}
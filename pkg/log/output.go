@@ -0,0 +1,140 @@
+package log
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"time"
+
+	config "github.com/mwantia/gosync/internal/config/server"
+	"gopkg.in/natefinch/lumberjack.v2"
+)
+
+// defaultTag is the application name reported to syslog and journald
+const defaultTag = "gosync"
+
+// record is a single formatted log message passed to all outputs
+type record struct {
+	Time    time.Time
+	Level   LogLevel
+	Service string
+	Message string
+}
+
+// output receives every log message above the configured level
+type output interface {
+	write(r record)
+}
+
+// newOutputs creates the outputs defined in the configuration, falling back
+// to stdout and the log file if no outputs are configured
+func newOutputs(cfg config.LogServerConfig) ([]output, error) {
+	if len(cfg.Outputs) == 0 {
+		var outputs []output
+		if !cfg.NoTerminal {
+			outputs = append(outputs, newWriterOutput(cfg, os.Stdout, !cfg.NoColor))
+		}
+		if cfg.File != "" {
+			outputs = append(outputs, newWriterOutput(cfg, newFileWriter(cfg, cfg.File), false))
+		}
+		if len(outputs) == 0 {
+			outputs = append(outputs, newWriterOutput(cfg, os.Stdout, false))
+		}
+		return outputs, nil
+	}
+
+	outputs := make([]output, 0, len(cfg.Outputs))
+	for _, oc := range cfg.Outputs {
+		tag := oc.Tag
+		if tag == "" {
+			tag = defaultTag
+		}
+
+		switch oc.Type {
+		case "stdout":
+			outputs = append(outputs, newWriterOutput(cfg, os.Stdout, !cfg.NoColor))
+
+		case "file":
+			path := oc.Path
+			if path == "" {
+				path = cfg.File
+			}
+			outputs = append(outputs, newWriterOutput(cfg, newFileWriter(cfg, path), false))
+
+		case "syslog":
+			out, err := newSyslogOutput(oc.Network, oc.Address, oc.Facility, tag)
+			if err != nil {
+				return nil, err
+			}
+			outputs = append(outputs, out)
+
+		case "journald":
+			outputs = append(outputs, newJournaldOutput(oc.Address, tag))
+
+		default:
+			return nil, fmt.Errorf("unsupported log output '%s'", oc.Type)
+		}
+	}
+	return outputs, nil
+}
+
+func newFileWriter(cfg config.LogServerConfig, path string) io.Writer {
+	return &lumberjack.Logger{
+		Filename:   path,
+		MaxSize:    cfg.Rotation.MaxSize,
+		MaxBackups: cfg.Rotation.MaxBackups,
+		MaxAge:     cfg.Rotation.MaxAge,
+		Compress:   cfg.Rotation.Compress,
+	}
+}
+
+type logEntry struct {
+	Timestamp string `json:"timestamp"`
+	Level     string `json:"level"`
+	Service   string `json:"service,omitempty"`
+	Message   string `json:"message"`
+}
+
+// writerOutput writes text or JSON lines into a stream
+type writerOutput struct {
+	writer     io.Writer
+	timeFormat string
+	json       bool
+	color      bool
+}
+
+func newWriterOutput(cfg config.LogServerConfig, writer io.Writer, color bool) *writerOutput {
+	return &writerOutput{
+		writer:     writer,
+		timeFormat: cfg.TimeFormat,
+		json:       cfg.JSON,
+		color:      color,
+	}
+}
+
+func (o *writerOutput) write(r record) {
+	timestamp := r.Time.Format(o.timeFormat)
+
+	if o.json {
+		jsonBytes, _ := json.Marshal(logEntry{
+			Timestamp: timestamp,
+			Level:     r.Level.String(),
+			Service:   r.Service,
+			Message:   r.Message,
+		})
+		fmt.Fprintf(o.writer, "%s\n", jsonBytes)
+		return
+	}
+
+	prefix := fmt.Sprintf("[%s] %-5s", timestamp, r.Level)
+	if r.Service != "" {
+		prefix = fmt.Sprintf("%s [%s]", prefix, r.Service)
+	}
+
+	if o.color {
+		fmt.Fprintf(o.writer, "%s%s %s\033[0m\n", Color(r.Level), prefix, r.Message)
+	} else {
+		fmt.Fprintf(o.writer, "%s %s\n", prefix, r.Message)
+	}
+}
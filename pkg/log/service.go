@@ -1,14 +1,12 @@
 package log
 
 import (
-	"encoding/json"
 	"fmt"
-	"io"
 	"os"
+	"sync/atomic"
 	"time"
 
 	config "github.com/mwantia/gosync/internal/config/server"
-	"gopkg.in/natefinch/lumberjack.v2"
 )
 
 type LoggerService interface {
@@ -23,93 +21,54 @@ type LoggerService interface {
 	Fatal(msg string, args ...any)
 
 	Named(name string) LoggerService
+
+	Level() LogLevel
+
+	// SetLevel changes the minimum level of this logger and all loggers sharing its outputs
+	SetLevel(level LogLevel)
 }
 
 type LoggerServiceImpl struct {
 	LoggerService
 
-	cfg    config.LogServerConfig
-	name   string
-	level  LogLevel
-	writer io.Writer
-}
-
-type logEntry struct {
-	Timestamp string `json:"timestamp"`
-	Level     string `json:"level"`
-	Service   string `json:"service,omitempty"`
-	Message   string `json:"message"`
+	cfg     config.LogServerConfig
+	name    string
+	level   *atomic.Int32
+	outputs []output
 }
 
 func NewLoggerService(name string, cfg config.LogServerConfig) LoggerService {
-	level := Parse(cfg.Level)
-
-	impl := &LoggerServiceImpl{
-		cfg:   cfg,
-		name:  name,
-		level: level,
-	}
-
-	impl.setupWriter()
-	return impl
-}
-
-func (impl *LoggerServiceImpl) setupWriter() {
-	var writers []io.Writer
-
-	if !impl.cfg.NoTerminal {
-		writers = append(writers, os.Stdout)
+	level := &atomic.Int32{}
+	level.Store(int32(Parse(cfg.Level)))
+
+	outputs, err := newOutputs(cfg)
+	if err != nil {
+		// The configuration is validated while loading, so only fall back to stdout instead of failing
+		fmt.Fprintf(os.Stderr, "failed to setup log outputs: %v\n", err)
+		outputs = []output{newWriterOutput(cfg, os.Stdout, !cfg.NoColor)}
 	}
 
-	if impl.cfg.File != "" {
-		fileWriter := &lumberjack.Logger{
-			Filename:   impl.cfg.File,
-			MaxSize:    impl.cfg.Rotation.MaxSize,
-			MaxBackups: impl.cfg.Rotation.MaxBackups,
-			MaxAge:     impl.cfg.Rotation.MaxAge,
-			Compress:   impl.cfg.Rotation.Compress,
-		}
-		writers = append(writers, fileWriter)
-	}
-
-	if len(writers) == 0 {
-		writers = append(writers, os.Stdout)
+	return &LoggerServiceImpl{
+		cfg:     cfg,
+		name:    name,
+		level:   level,
+		outputs: outputs,
 	}
-
-	impl.writer = io.MultiWriter(writers...)
 }
 
 func (impl *LoggerServiceImpl) log(level LogLevel, msg string, args ...any) {
-	if level < impl.level {
+	if level < impl.Level() {
 		return
 	}
 
-	timestamp := time.Now().Format(impl.cfg.TimeFormat)
-	formattedMsg := fmt.Sprintf(msg, args...)
-
-	if impl.cfg.JSON {
-		entry := logEntry{
-			Timestamp: timestamp,
-			Level:     level.String(),
-			Message:   formattedMsg,
-		}
-		if impl.name != "" {
-			entry.Service = impl.name
-		}
-
-		jsonBytes, _ := json.Marshal(entry)
-		fmt.Fprintf(impl.writer, "%s\n", jsonBytes)
-	} else {
-		prefix := fmt.Sprintf("[%s] %-5s", timestamp, level)
-		if impl.name != "" {
-			prefix = fmt.Sprintf("%s [%s]", prefix, impl.name)
-		}
-
-		if !impl.cfg.NoTerminal && !impl.cfg.NoColor {
-			fmt.Fprintf(impl.writer, "%s%s %s\033[0m\n", Color(level), prefix, formattedMsg)
-		} else {
-			fmt.Fprintf(impl.writer, "%s %s\n", prefix, formattedMsg)
-		}
+	r := record{
+		Time:    time.Now(),
+		Level:   level,
+		Service: impl.name,
+		Message: fmt.Sprintf(msg, args...),
+	}
+	for _, out := range impl.outputs {
+		out.write(r)
 	}
 
 	if level == Fatal {
@@ -139,9 +98,17 @@ func (impl *LoggerServiceImpl) Fatal(msg string, args ...any) {
 
 func (impl *LoggerServiceImpl) Named(name string) LoggerService {
 	return &LoggerServiceImpl{
-		cfg:    impl.cfg,
-		name:   fmt.Sprintf("%s/%s", impl.name, name),
-		level:  impl.level,
-		writer: impl.writer, // Share the same writer
+		cfg:     impl.cfg,
+		name:    fmt.Sprintf("%s/%s", impl.name, name),
+		level:   impl.level,
+		outputs: impl.outputs, // Share the same outputs
 	}
 }
+
+func (impl *LoggerServiceImpl) Level() LogLevel {
+	return LogLevel(impl.level.Load())
+}
+
+func (impl *LoggerServiceImpl) SetLevel(level LogLevel) {
+	impl.level.Store(int32(level))
+}
@@ -0,0 +1,152 @@
+package log
+
+import (
+	"fmt"
+	"net"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// syslogDialTimeout limits connecting to the syslog server, so an unreachable server doesn't stall logging
+const syslogDialTimeout = 5 * time.Second
+
+var syslogFacilities = map[string]int{
+	"kern":     0,
+	"user":     1,
+	"mail":     2,
+	"daemon":   3,
+	"auth":     4,
+	"syslog":   5,
+	"lpr":      6,
+	"news":     7,
+	"uucp":     8,
+	"cron":     9,
+	"authpriv": 10,
+	"ftp":      11,
+	"local0":   16,
+	"local1":   17,
+	"local2":   18,
+	"local3":   19,
+	"local4":   20,
+	"local5":   21,
+	"local6":   22,
+	"local7":   23,
+}
+
+// Severity maps the level to the syslog severity, which journald uses as priority as well
+func (l LogLevel) Severity() int {
+	switch l {
+	case Debug:
+		return 7
+	case Info:
+		return 6
+	case Warn:
+		return 4
+	case Error:
+		return 3
+	case Fatal:
+		return 2
+	default:
+		return 5
+	}
+}
+
+// syslogOutput sends RFC5424 messages to a syslog server. The connection is established
+// lazily and re-established after failed writes, so a restarted server doesn't lose the output.
+type syslogOutput struct {
+	mutex    sync.Mutex
+	network  string
+	address  string
+	facility int
+	tag      string
+	hostname string
+	conn     net.Conn
+}
+
+func newSyslogOutput(network, address, facility, tag string) (*syslogOutput, error) {
+	if facility == "" {
+		facility = "daemon"
+	}
+	code, ok := syslogFacilities[strings.ToLower(facility)]
+	if !ok {
+		return nil, fmt.Errorf("unsupported syslog facility '%s'", facility)
+	}
+
+	hostname, err := os.Hostname()
+	if err != nil || hostname == "" {
+		hostname = "-"
+	}
+
+	return &syslogOutput{
+		network:  network,
+		address:  address,
+		facility: code,
+		tag:      tag,
+		hostname: hostname,
+	}, nil
+}
+
+func (o *syslogOutput) write(r record) {
+	msg := o.format(r)
+
+	o.mutex.Lock()
+	defer o.mutex.Unlock()
+
+	// Retry once with a new connection, since the server may have closed the previous one
+	for attempt := 0; attempt < 2; attempt++ {
+		if o.conn == nil {
+			conn, err := net.DialTimeout(o.network, o.address, syslogDialTimeout)
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "failed to connect to syslog '%s': %v\n", o.address, err)
+				return
+			}
+			o.conn = conn
+		}
+
+		if _, err := o.conn.Write(msg); err == nil {
+			return
+		}
+		o.conn.Close()
+		o.conn = nil
+	}
+	fmt.Fprintf(os.Stderr, "failed to write to syslog '%s'\n", o.address)
+}
+
+// format returns the RFC5424 message, framed with octet counting for stream connections (RFC6587)
+func (o *syslogOutput) format(r record) []byte {
+	msgID := "-"
+	if r.Service != "" {
+		msgID = syslogHeaderValue(r.Service, 32)
+	}
+
+	msg := fmt.Sprintf("<%d>1 %s %s %s %d %s - %s",
+		o.facility*8+r.Level.Severity(),
+		r.Time.Format("2006-01-02T15:04:05.000000Z07:00"),
+		syslogHeaderValue(o.hostname, 255),
+		syslogHeaderValue(o.tag, 48),
+		os.Getpid(),
+		msgID,
+		r.Message)
+
+	if o.network == "tcp" {
+		msg = fmt.Sprintf("%d %s", len(msg), msg)
+	}
+	return []byte(msg)
+}
+
+// syslogHeaderValue limits header fields to printable ASCII without spaces of the maximum length
+func syslogHeaderValue(value string, length int) string {
+	value = strings.Map(func(r rune) rune {
+		if r < 33 || r > 126 {
+			return '_'
+		}
+		return r
+	}, value)
+
+	if len(value) > length {
+		value = value[:length]
+	}
+	return value
+}
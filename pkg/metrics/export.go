@@ -0,0 +1,180 @@
+package metrics
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+	"time"
+
+	config "github.com/mwantia/gosync/internal/config/server"
+	"github.com/mwantia/gosync/pkg/log"
+)
+
+// Formats supported by the exporter
+const (
+	FormatStatsd   = "statsd"
+	FormatGraphite = "graphite"
+	FormatInflux   = "influx"
+)
+
+const (
+	// dialTimeout limits connecting to the receiver, so an unreachable receiver doesn't block the next push
+	dialTimeout = 5 * time.Second
+	// maxPacketSize keeps UDP packets below the common MTU, so they aren't fragmented
+	maxPacketSize = 1400
+)
+
+var influxEscaper = strings.NewReplacer(",", `\,`, "=", `\=`, " ", `\ `)
+
+// Exporter periodically pushes the metrics of a registry to statsd, graphite or InfluxDB
+type Exporter struct {
+	registry *Registry
+	format   string
+	network  string
+	address  string
+	prefix   string
+	interval time.Duration
+	log      log.LoggerService
+}
+
+// NewExporter creates an exporter pushing the metrics of the registry to the configured receiver
+func NewExporter(cfg config.MetricsExportServerConfig, registry *Registry, logger log.LoggerService) (*Exporter, error) {
+	switch cfg.Format {
+	case FormatStatsd, FormatGraphite, FormatInflux:
+	default:
+		return nil, fmt.Errorf("unsupported metrics format '%s'", cfg.Format)
+	}
+
+	interval, err := time.ParseDuration(cfg.Interval)
+	if err != nil {
+		return nil, fmt.Errorf("invalid metrics interval '%s': %w", cfg.Interval, err)
+	}
+
+	return &Exporter{
+		registry: registry,
+		format:   cfg.Format,
+		network:  cfg.Protocol,
+		address:  cfg.Address,
+		prefix:   strings.TrimSuffix(cfg.Prefix, "."),
+		interval: interval,
+		log:      logger,
+	}, nil
+}
+
+// Run pushes the metrics in the configured interval until the context is cancelled
+func (e *Exporter) Run(ctx context.Context) error {
+	ticker := time.NewTicker(e.interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-ticker.C:
+			if err := e.Push(ctx); err != nil && ctx.Err() == nil {
+				e.log.Warn("Failed to push metrics to '%s': %v", e.address, err)
+			}
+		}
+	}
+}
+
+// Push sends the current value of all metrics to the receiver
+func (e *Exporter) Push(ctx context.Context) error {
+	samples, err := e.registry.Gather(ctx)
+	if err != nil {
+		return err
+	}
+	lines := Encode(e.format, e.prefix, samples, time.Now())
+
+	dialer := &net.Dialer{Timeout: dialTimeout}
+	conn, err := dialer.DialContext(ctx, e.network, e.address)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	conn.SetWriteDeadline(time.Now().Add(dialTimeout))
+
+	// Lines are never split, so each datagram can be parsed on its own
+	limit := 0
+	if e.network == "udp" {
+		limit = maxPacketSize
+	}
+	var buf bytes.Buffer
+	for _, line := range lines {
+		if limit > 0 && buf.Len() > 0 && buf.Len()+len(line) > limit {
+			if _, err := conn.Write(buf.Bytes()); err != nil {
+				return err
+			}
+			buf.Reset()
+		}
+		buf.WriteString(line)
+	}
+	if buf.Len() > 0 {
+		if _, err := conn.Write(buf.Bytes()); err != nil {
+			return err
+		}
+	}
+
+	e.log.Debug("Pushed %d metrics to '%s'", len(lines), e.address)
+	return nil
+}
+
+// Encode returns the samples as newline terminated lines of the format. Names are joined with the prefix
+// by a dot. Statsd and graphite don't support labels, so their values are appended to the name instead,
+// e.g. "gosync.sync_actions.photos". Counters are sent as statsd gauges, since their values are cumulative.
+func Encode(format, prefix string, samples []Sample, now time.Time) []string {
+	lines := make([]string, 0, len(samples))
+	for _, s := range samples {
+		name := s.Name
+		if prefix != "" {
+			name = prefix + "." + name
+		}
+		value := strconv.FormatFloat(s.Value, 'f', -1, 64)
+
+		switch format {
+		case FormatStatsd:
+			lines = append(lines, fmt.Sprintf("%s:%s|g\n", metricPath(name, s), value))
+		case FormatGraphite:
+			lines = append(lines, fmt.Sprintf("%s %s %d\n", metricPath(name, s), value, now.Unix()))
+		case FormatInflux:
+			var line strings.Builder
+			line.WriteString(influxEscaper.Replace(name))
+			for _, key := range s.labelKeys() {
+				// Tags without value are rejected by InfluxDB
+				if s.Labels[key] == "" {
+					continue
+				}
+				fmt.Fprintf(&line, ",%s=%s", influxEscaper.Replace(key), influxEscaper.Replace(s.Labels[key]))
+			}
+			fmt.Fprintf(&line, " value=%s %d\n", value, now.UnixNano())
+			lines = append(lines, line.String())
+		}
+	}
+	return lines
+}
+
+// metricPath appends the label values of the sample to the name as separate path segments
+func metricPath(name string, s Sample) string {
+	var path strings.Builder
+	path.WriteString(name)
+	for _, key := range s.labelKeys() {
+		path.WriteByte('.')
+		if value := s.Labels[key]; value != "" {
+			path.WriteString(strings.Map(pathRune, value))
+		} else {
+			path.WriteString("none")
+		}
+	}
+	return path.String()
+}
+
+// pathRune replaces all characters with a meaning in statsd or graphite paths
+func pathRune(r rune) rune {
+	if r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9' || r == '-' {
+		return r
+	}
+	return '_'
+}
@@ -0,0 +1,97 @@
+package metrics
+
+import (
+	"context"
+	"fmt"
+	"maps"
+	"slices"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// Types of metrics
+const (
+	TypeGauge   = "gauge"
+	TypeCounter = "counter"
+)
+
+// Sample is the current value of a metric. Names don't contain a namespace, which is
+// added by the exposition, e.g. "gosync_" for Prometheus or the configured export prefix.
+type Sample struct {
+	Name   string
+	Help   string
+	Type   string
+	Labels map[string]string
+	Value  float64
+}
+
+// labelKeys returns the label names of the sample in a stable order
+func (s Sample) labelKeys() []string {
+	return slices.Sorted(maps.Keys(s.Labels))
+}
+
+// Collector reads the current values of a set of metrics
+type Collector interface {
+	Collect(ctx context.Context) ([]Sample, error)
+}
+
+// CollectorFunc adapts a function to a Collector
+type CollectorFunc func(ctx context.Context) ([]Sample, error)
+
+func (f CollectorFunc) Collect(ctx context.Context) ([]Sample, error) {
+	return f(ctx)
+}
+
+// Registry gathers the metrics of all registered collectors. Values are read on demand,
+// so the /metrics endpoint and the push exporter always report the same state.
+type Registry struct {
+	mutex      sync.RWMutex
+	collectors []Collector
+}
+
+// NewRegistry creates an empty registry
+func NewRegistry() *Registry {
+	return &Registry{}
+}
+
+// Register adds the collector to the registry
+func (r *Registry) Register(c Collector) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	r.collectors = append(r.collectors, c)
+}
+
+// Gather collects the samples of all collectors, sorted by name and labels
+func (r *Registry) Gather(ctx context.Context) ([]Sample, error) {
+	r.mutex.RLock()
+	collectors := slices.Clone(r.collectors)
+	r.mutex.RUnlock()
+
+	var samples []Sample
+	for _, c := range collectors {
+		collected, err := c.Collect(ctx)
+		if err != nil {
+			return nil, fmt.Errorf("failed to collect metrics: %w", err)
+		}
+		samples = append(samples, collected...)
+	}
+
+	sort.SliceStable(samples, func(i, j int) bool {
+		if samples[i].Name != samples[j].Name {
+			return samples[i].Name < samples[j].Name
+		}
+		return labelString(samples[i], ",") < labelString(samples[j], ",")
+	})
+	return samples, nil
+}
+
+// labelString joins the labels of the sample as key=value pairs
+func labelString(s Sample, sep string) string {
+	pairs := make([]string, 0, len(s.Labels))
+	for _, key := range s.labelKeys() {
+		pairs = append(pairs, key+"="+s.Labels[key])
+	}
+	return strings.Join(pairs, sep)
+}
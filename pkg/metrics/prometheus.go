@@ -0,0 +1,52 @@
+package metrics
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+)
+
+// Namespace is prepended to all metric names served in the Prometheus text format
+const Namespace = "gosync"
+
+// ContentType of the Prometheus text exposition format
+const ContentType = "text/plain; version=0.0.4; charset=utf-8"
+
+var labelEscaper = strings.NewReplacer(`\`, `\\`, "\n", `\n`, `"`, `\"`)
+
+// WritePrometheus writes the samples in the Prometheus text exposition format.
+// The samples must be sorted by name, as returned by Registry.Gather.
+func WritePrometheus(w io.Writer, samples []Sample) error {
+	bw := bufio.NewWriter(w)
+
+	last := ""
+	for _, s := range samples {
+		name := Namespace + "_" + s.Name
+		if s.Name != last {
+			if s.Help != "" {
+				fmt.Fprintf(bw, "# HELP %s %s\n", name, s.Help)
+			}
+			fmt.Fprintf(bw, "# TYPE %s %s\n", name, s.Type)
+			last = s.Name
+		}
+
+		bw.WriteString(name)
+		if len(s.Labels) > 0 {
+			bw.WriteByte('{')
+			for i, key := range s.labelKeys() {
+				if i > 0 {
+					bw.WriteByte(',')
+				}
+				fmt.Fprintf(bw, `%s="%s"`, key, labelEscaper.Replace(s.Labels[key]))
+			}
+			bw.WriteByte('}')
+		}
+		bw.WriteByte(' ')
+		bw.WriteString(strconv.FormatFloat(s.Value, 'g', -1, 64))
+		bw.WriteByte('\n')
+	}
+
+	return bw.Flush()
+}
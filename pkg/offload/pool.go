@@ -0,0 +1,253 @@
+package offload
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"os/exec"
+	"sync"
+	"time"
+
+	"github.com/mwantia/gosync/pkg/checksum"
+	"github.com/mwantia/gosync/pkg/log"
+)
+
+// dialTimeout limits connecting to a remote worker
+const dialTimeout = 10 * time.Second
+
+// worker is a connection to a worker process, used by one request at a time
+type worker struct {
+	name   string
+	reader *bufio.Reader
+	writer io.Writer
+	closer io.Closer
+	cmd    *exec.Cmd
+	// local workers read files by their path instead of receiving their content
+	local bool
+}
+
+// Pool dispatches CPU-heavy work to worker processes, keeping the agent responsive on weak hardware.
+// Work falls back to the agent itself once no worker is left.
+type Pool struct {
+	log  log.LoggerService
+	idle chan *worker
+
+	mutex  sync.Mutex
+	live   int
+	closed bool
+	// down is closed once the last worker failed
+	down chan struct{}
+}
+
+// NewPool starts the local worker processes and connects to the remote workers. Remote workers that can't be reached
+// are skipped, so the agent still starts while they are down.
+func NewPool(ctx context.Context, locals int, remotes []string, logger log.LoggerService) (*Pool, error) {
+	p := &Pool{
+		log:  logger,
+		idle: make(chan *worker, locals+len(remotes)),
+		down: make(chan struct{}),
+	}
+
+	executable, err := os.Executable()
+	if err != nil {
+		return nil, fmt.Errorf("failed to locate executable for worker processes: %w", err)
+	}
+	for i := 0; i < locals; i++ {
+		w, err := startWorker(executable, i)
+		if err != nil {
+			p.Close()
+			return nil, err
+		}
+		p.add(w)
+	}
+
+	dialer := net.Dialer{Timeout: dialTimeout}
+	for _, address := range remotes {
+		conn, err := dialer.DialContext(ctx, "tcp", address)
+		if err != nil {
+			logger.Warn("Skipping remote worker '%s': %v", address, err)
+			continue
+		}
+		p.add(&worker{name: address, reader: bufio.NewReader(conn), writer: conn, closer: conn})
+	}
+
+	if p.live == 0 {
+		close(p.down)
+	}
+	return p, nil
+}
+
+// startWorker starts "gosync worker" as child process, which serves requests on its standard input and output
+func startWorker(executable string, i int) (*worker, error) {
+	cmd := exec.Command(executable, "worker")
+	cmd.Stderr = os.Stderr
+	stdin, err := cmd.StdinPipe()
+	if err != nil {
+		return nil, err
+	}
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return nil, err
+	}
+	if err := cmd.Start(); err != nil {
+		return nil, fmt.Errorf("failed to start worker process: %w", err)
+	}
+
+	return &worker{
+		name:   fmt.Sprintf("local-%d", i),
+		reader: bufio.NewReader(stdout),
+		writer: stdin,
+		closer: stdin,
+		cmd:    cmd,
+		local:  true,
+	}, nil
+}
+
+func (p *Pool) add(w *worker) {
+	p.live++
+	p.idle <- w
+}
+
+// Run closes all workers once the context is cancelled
+func (p *Pool) Run(ctx context.Context) error {
+	<-ctx.Done()
+	p.Close()
+	return nil
+}
+
+// Close stops the local worker processes and disconnects from the remote workers. Busy workers are closed
+// once their request finished.
+func (p *Pool) Close() {
+	p.mutex.Lock()
+	p.closed = true
+	p.mutex.Unlock()
+
+	for {
+		select {
+		case w := <-p.idle:
+			p.drop(w)
+		default:
+			return
+		}
+	}
+}
+
+// drop closes the worker after it failed or the pool was closed
+func (p *Pool) drop(w *worker) {
+	w.closer.Close()
+	if w.cmd != nil {
+		w.cmd.Wait()
+	}
+
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	p.live--
+	if p.live == 0 {
+		close(p.down)
+	}
+}
+
+// Hash computes the checksums of the local file on the next idle worker, or within the agent if none is left
+func (p *Pool) Hash(ctx context.Context, path string) (checksum.Sums, error) {
+	var w *worker
+	select {
+	case w = <-p.idle:
+	case <-p.down:
+		return checksum.File(path)
+	case <-ctx.Done():
+		return checksum.Sums{}, ctx.Err()
+	}
+
+	sums, err := p.hash(ctx, w, path)
+	var failure *workerError
+	if errors.As(err, &failure) {
+		if ctx.Err() != nil {
+			p.drop(w)
+			return checksum.Sums{}, ctx.Err()
+		}
+		p.log.Warn("Removing worker '%s': %v", w.name, failure.err)
+		p.drop(w)
+		return checksum.File(path)
+	}
+
+	p.release(w)
+	return sums, err
+}
+
+// release returns the worker to the idle workers, unless the pool was closed in the meantime
+func (p *Pool) release(w *worker) {
+	p.mutex.Lock()
+	if !p.closed {
+		// Never blocks, the channel has room for all workers
+		p.idle <- w
+		p.mutex.Unlock()
+		return
+	}
+	p.mutex.Unlock()
+	p.drop(w)
+}
+
+// workerError is a failure of the connection to the worker, which leaves it in an unknown state
+type workerError struct {
+	err error
+}
+
+func (e *workerError) Error() string {
+	return e.err.Error()
+}
+
+func (p *Pool) hash(ctx context.Context, w *worker, path string) (checksum.Sums, error) {
+	req := request{Op: OpHash, Path: path}
+	var content *os.File
+	if !w.local {
+		f, err := os.Open(path)
+		if err != nil {
+			return checksum.Sums{}, err
+		}
+		defer f.Close()
+		stat, err := f.Stat()
+		if err != nil {
+			return checksum.Sums{}, err
+		}
+		req = request{Op: OpHash, Size: stat.Size()}
+		content = f
+	}
+
+	// Cancelling the context interrupts the request by closing the connection
+	stop := context.AfterFunc(ctx, func() {
+		w.closer.Close()
+	})
+	defer stop()
+
+	line, err := json.Marshal(req)
+	if err != nil {
+		return checksum.Sums{}, err
+	}
+	if _, err := w.writer.Write(append(line, '\n')); err != nil {
+		return checksum.Sums{}, &workerError{err}
+	}
+	if content != nil {
+		// Files changing while they are sent are hashed by their size at the time of the request
+		if _, err := io.CopyN(w.writer, content, req.Size); err != nil {
+			return checksum.Sums{}, &workerError{fmt.Errorf("failed to send '%s': %w", path, err)}
+		}
+	}
+
+	data, err := w.reader.ReadBytes('\n')
+	if err != nil {
+		return checksum.Sums{}, &workerError{err}
+	}
+	var resp response
+	if err := json.Unmarshal(data, &resp); err != nil {
+		return checksum.Sums{}, &workerError{err}
+	}
+	if resp.Error != "" {
+		return checksum.Sums{}, fmt.Errorf("failed to hash '%s' on worker '%s': %s", path, w.name, resp.Error)
+	}
+	return checksum.Sums{Size: resp.Size, MD5: resp.MD5, SHA256: resp.SHA256}, nil
+}
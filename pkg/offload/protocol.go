@@ -0,0 +1,105 @@
+package offload
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+
+	"github.com/mwantia/gosync/pkg/checksum"
+)
+
+// OpHash computes the checksums of a file, either read by the worker itself or sent along with the request
+const OpHash = "hash"
+
+// request is sent as a single JSON line, followed by Size bytes of content unless Path is set
+type request struct {
+	Op   string `json:"op"`
+	Path string `json:"path,omitempty"`
+	Size int64  `json:"size"`
+}
+
+// response is returned as a single JSON line for each request
+type response struct {
+	Size   int64  `json:"size"`
+	MD5    string `json:"md5,omitempty"`
+	SHA256 string `json:"sha256,omitempty"`
+	Error  string `json:"error,omitempty"`
+}
+
+// Serve handles the requests read from r until it is closed, writing their responses to w. Files are only read
+// by their path if paths is set, i.e. for worker processes on the same machine as the agent.
+func Serve(r io.Reader, w io.Writer, paths bool) error {
+	reader := bufio.NewReader(r)
+	encoder := json.NewEncoder(w)
+
+	for {
+		line, err := reader.ReadBytes('\n')
+		if err != nil {
+			if errors.Is(err, io.EOF) && len(line) == 0 {
+				return nil
+			}
+			return err
+		}
+
+		var req request
+		if err := json.Unmarshal(line, &req); err != nil {
+			return fmt.Errorf("invalid request: %w", err)
+		}
+
+		var sums checksum.Sums
+		switch {
+		case req.Op != OpHash:
+			err = fmt.Errorf("unsupported operation '%s'", req.Op)
+		case req.Path != "" && !paths:
+			err = fmt.Errorf("reading files by path is not permitted")
+		case req.Path != "":
+			sums, err = checksum.File(req.Path)
+		default:
+			sums, err = checksum.Reader(io.LimitReader(reader, req.Size))
+			if err == nil && sums.Size != req.Size {
+				// The stream is out of sync once the content is incomplete
+				return io.ErrUnexpectedEOF
+			}
+		}
+
+		resp := response{Size: sums.Size, MD5: sums.MD5, SHA256: sums.SHA256}
+		if err != nil {
+			resp.Error = err.Error()
+		}
+		if err := encoder.Encode(resp); err != nil {
+			return err
+		}
+	}
+}
+
+// Listen serves remote workers on the address until the context is cancelled. Their requests have to include the
+// content of files, since a remote worker can't read the files of the agent.
+func Listen(ctx context.Context, address string) error {
+	listener, err := net.Listen("tcp", address)
+	if err != nil {
+		return err
+	}
+	stop := context.AfterFunc(ctx, func() {
+		listener.Close()
+	})
+	defer stop()
+
+	for {
+		conn, err := listener.Accept()
+		if err != nil {
+			if ctx.Err() != nil {
+				return nil
+			}
+			return err
+		}
+
+		go func() {
+			defer conn.Close()
+			Serve(conn, conn, false)
+		}()
+	}
+}
@@ -0,0 +1,259 @@
+package publish
+
+import (
+	"bytes"
+	"context"
+	"crypto/ed25519"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"path"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/mwantia/gosync/pkg/checksum"
+	"github.com/mwantia/gosync/pkg/storage"
+)
+
+// ManifestName is the name of the manifest object written to the root of a published sync
+const ManifestName = ".gosync-manifest.json"
+
+// SignatureSuffix is appended to the key of the manifest for the object containing its detached signature
+const SignatureSuffix = ".sig"
+
+// ContentType identifies published manifests
+const ContentType = "application/vnd.gosync.published+json"
+
+// manifestVersion is the current version of the manifest format
+const manifestVersion = 1
+
+// maxManifestSize limits the size of manifests read by consumers
+const maxManifestSize = 1 << 30
+
+// Manifest lists all files of a published mirror at the time of a pass
+type Manifest struct {
+	Version     int       `json:"version"`
+	Sync        string    `json:"sync"`
+	GeneratedAt time.Time `json:"generated_at"`
+	// PublicKey is the ed25519 key the manifest was signed with, which consumers must compare with the key they trust
+	PublicKey string `json:"public_key"`
+	Files     []File `json:"files"`
+}
+
+// File is a single file of a manifest, relative to the root of the mirror
+type File struct {
+	Path   string `json:"path"`
+	Size   int64  `json:"size"`
+	SHA256 string `json:"sha256"`
+}
+
+// IsManifestKey returns true if the key refers to a manifest or its signature, regardless of its prefix
+func IsManifestKey(key string) bool {
+	name := path.Base(key)
+	return name == ManifestName || name == ManifestName+SignatureSuffix
+}
+
+// ManifestKey returns the key of the manifest below the prefix, which is either empty or ends with "/"
+func ManifestKey(prefix string) string {
+	return prefix + ManifestName
+}
+
+// GenerateKey creates a new ed25519 key pair, returning the base64 encoded private seed and public key
+func GenerateKey() (string, string, error) {
+	public, private, err := ed25519.GenerateKey(nil)
+	if err != nil {
+		return "", "", err
+	}
+	return base64.StdEncoding.EncodeToString(private.Seed()), base64.StdEncoding.EncodeToString(public), nil
+}
+
+// ParseSigningKey decodes a base64 encoded ed25519 private key, either its 32 byte seed or the full 64 byte key
+func ParseSigningKey(value string) (ed25519.PrivateKey, error) {
+	data, err := base64.StdEncoding.DecodeString(strings.TrimSpace(value))
+	if err != nil {
+		return nil, fmt.Errorf("invalid signing key: %w", err)
+	}
+	switch len(data) {
+	case ed25519.SeedSize:
+		return ed25519.NewKeyFromSeed(data), nil
+	case ed25519.PrivateKeySize:
+		return ed25519.PrivateKey(data), nil
+	default:
+		return nil, fmt.Errorf("invalid signing key: expected %d or %d bytes, got %d", ed25519.SeedSize, ed25519.PrivateKeySize, len(data))
+	}
+}
+
+// ParsePublicKey decodes a base64 encoded ed25519 public key
+func ParsePublicKey(value string) (ed25519.PublicKey, error) {
+	data, err := base64.StdEncoding.DecodeString(strings.TrimSpace(value))
+	if err != nil {
+		return nil, fmt.Errorf("invalid public key: %w", err)
+	}
+	if len(data) != ed25519.PublicKeySize {
+		return nil, fmt.Errorf("invalid public key: expected %d bytes, got %d", ed25519.PublicKeySize, len(data))
+	}
+	return ed25519.PublicKey(data), nil
+}
+
+// Write signs the manifest and writes it along with its signature below the prefix. The signature covers the exact
+// bytes of the manifest object, so consumers can verify it with any ed25519 implementation.
+func Write(ctx context.Context, st storage.Storage, prefix string, manifest *Manifest, key ed25519.PrivateKey) error {
+	manifest.Version = manifestVersion
+	manifest.PublicKey = base64.StdEncoding.EncodeToString(key.Public().(ed25519.PublicKey))
+	sort.Slice(manifest.Files, func(i, j int) bool {
+		return manifest.Files[i].Path < manifest.Files[j].Path
+	})
+
+	data, err := json.MarshalIndent(manifest, "", "  ")
+	if err != nil {
+		return err
+	}
+	signature := []byte(base64.StdEncoding.EncodeToString(ed25519.Sign(key, data)) + "\n")
+
+	// The manifest is written first, so a signature never refers to a manifest that wasn't written yet
+	manifestKey := ManifestKey(prefix)
+	if _, err := st.Put(ctx, manifestKey, bytes.NewReader(data), int64(len(data)), storage.PutOptions{ContentType: ContentType}); err != nil {
+		return fmt.Errorf("failed to write manifest '%s': %w", manifestKey, err)
+	}
+	if _, err := st.Put(ctx, manifestKey+SignatureSuffix, bytes.NewReader(signature), int64(len(signature)), storage.PutOptions{ContentType: "text/plain"}); err != nil {
+		return fmt.Errorf("failed to write signature of manifest '%s': %w", manifestKey, err)
+	}
+	return nil
+}
+
+// Read loads the manifest below the prefix and verifies its signature with the trusted public key
+func Read(ctx context.Context, st storage.Storage, prefix string, trusted ed25519.PublicKey) (*Manifest, error) {
+	manifestKey := ManifestKey(prefix)
+	data, err := readAll(ctx, st, manifestKey)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read manifest '%s': %w", manifestKey, err)
+	}
+	signature, err := readAll(ctx, st, manifestKey+SignatureSuffix)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read signature of manifest '%s': %w", manifestKey, err)
+	}
+
+	sig, err := base64.StdEncoding.DecodeString(strings.TrimSpace(string(signature)))
+	if err != nil || !ed25519.Verify(trusted, data, sig) {
+		return nil, fmt.Errorf("invalid signature of manifest '%s'", manifestKey)
+	}
+
+	var manifest Manifest
+	if err := json.Unmarshal(data, &manifest); err != nil {
+		return nil, fmt.Errorf("failed to decode manifest '%s': %w", manifestKey, err)
+	}
+	if manifest.Version != manifestVersion {
+		return nil, fmt.Errorf("unsupported manifest version %d", manifest.Version)
+	}
+	return &manifest, nil
+}
+
+func readAll(ctx context.Context, st storage.Storage, key string) ([]byte, error) {
+	reader, err := st.Get(ctx, key)
+	if err != nil {
+		return nil, err
+	}
+	defer reader.Close()
+
+	data, err := io.ReadAll(io.LimitReader(reader, maxManifestSize+1))
+	if err != nil {
+		return nil, err
+	}
+	if len(data) > maxManifestSize {
+		return nil, fmt.Errorf("manifest exceeds %d bytes", maxManifestSize)
+	}
+	return data, nil
+}
+
+// Statuses of files failing the verification of a manifest
+const (
+	StatusMissing   = "missing"
+	StatusSize      = "size"
+	StatusCorrupted = "corrupted"
+)
+
+// Finding is a file of the manifest that doesn't match the mirror
+type Finding struct {
+	Path   string `json:"path"`
+	Status string `json:"status"`
+	Detail string `json:"detail,omitempty"`
+}
+
+// Report summarizes the verification of a mirror against its manifest
+type Report struct {
+	Sync        string    `json:"sync"`
+	GeneratedAt time.Time `json:"generated_at"`
+	Files       int       `json:"files"`
+	Hashed      int       `json:"hashed"`
+	Bytes       int64     `json:"bytes"`
+	Findings    []Finding `json:"findings"`
+}
+
+// Check looks up every file of the manifest below the prefix by its key instead of listing the mirror,
+// comparing its size and with hash also its SHA256
+func Check(ctx context.Context, st storage.Storage, prefix string, manifest *Manifest, hash bool) (*Report, error) {
+	report := &Report{
+		Sync:        manifest.Sync,
+		GeneratedAt: manifest.GeneratedAt,
+		Findings:    []Finding{},
+	}
+
+	for _, file := range manifest.Files {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+		report.Files++
+
+		info, err := st.Stat(ctx, prefix+file.Path)
+		if errors.Is(err, storage.ErrObjectNotFound) {
+			report.Findings = append(report.Findings, Finding{Path: file.Path, Status: StatusMissing})
+			continue
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to stat '%s': %w", file.Path, err)
+		}
+		if info.Size != file.Size {
+			report.Findings = append(report.Findings, Finding{
+				Path:   file.Path,
+				Status: StatusSize,
+				Detail: fmt.Sprintf("expected %d bytes, found %d", file.Size, info.Size),
+			})
+			continue
+		}
+		if !hash {
+			continue
+		}
+
+		sum, err := hashObject(ctx, st, prefix+file.Path)
+		if err != nil {
+			return nil, fmt.Errorf("failed to hash '%s': %w", file.Path, err)
+		}
+		report.Hashed++
+		report.Bytes += info.Size
+		if sum != file.SHA256 {
+			report.Findings = append(report.Findings, Finding{
+				Path:   file.Path,
+				Status: StatusCorrupted,
+				Detail: fmt.Sprintf("expected sha256 %s, found %s", file.SHA256, sum),
+			})
+		}
+	}
+	return report, nil
+}
+
+func hashObject(ctx context.Context, st storage.Storage, key string) (string, error) {
+	reader, err := st.Get(ctx, key)
+	if err != nil {
+		return "", err
+	}
+	defer reader.Close()
+
+	sums, err := checksum.Reader(reader)
+	if err != nil {
+		return "", err
+	}
+	return sums.SHA256, nil
+}
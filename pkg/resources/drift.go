@@ -0,0 +1,225 @@
+package resources
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/mwantia/gosync/pkg/db/models"
+	"github.com/mwantia/gosync/pkg/db/store"
+)
+
+// Kinds of declared resources
+const (
+	KindBackend = "backend"
+	KindSync    = "sync"
+	KindFilter  = "filter"
+)
+
+// DriftStatus describes how the live state of a resource differs from its declaration
+type DriftStatus string
+
+const (
+	DriftMissing DriftStatus = "missing" // Declared, but doesn't exist
+	DriftChanged DriftStatus = "changed" // Exists with different settings
+	DriftExtra   DriftStatus = "extra"   // Exists, but isn't declared
+)
+
+// redacted replaces credentials within drift reports
+const redacted = "<redacted>"
+
+// Drift is a single resource whose live state differs from the document
+type Drift struct {
+	Kind    string      `json:"kind"`
+	Name    string      `json:"name"`
+	Status  DriftStatus `json:"status"`
+	Changes []Change    `json:"changes,omitempty"`
+}
+
+// Change is a single setting of a changed resource
+type Change struct {
+	Field   string `json:"field"`
+	Desired string `json:"desired"`
+	Actual  string `json:"actual"`
+}
+
+// Compare returns the drift between the document and the metadata store, ordered by kind and name.
+// Extra resources are only reported for kinds the document declares, so documents may manage a subset.
+func Compare(ctx context.Context, ms store.MetadataStore, doc *Document) ([]Drift, error) {
+	var drifts []Drift
+
+	if doc.Backends != nil {
+		backends, err := ms.ListBackends(ctx)
+		if err != nil {
+			return nil, fmt.Errorf("failed to list backends: %w", err)
+		}
+
+		live := make(map[string]*models.Backend, len(backends))
+		for i := range backends {
+			live[backends[i].ID] = &backends[i]
+		}
+		for _, b := range doc.Backends {
+			actual, ok := live[b.ID]
+			delete(live, b.ID)
+			drifts = appendDrift(drifts, KindBackend, b.ID, ok, func() []Change { return compareBackend(&b, actual) })
+		}
+		for id := range live {
+			drifts = append(drifts, Drift{Kind: KindBackend, Name: id, Status: DriftExtra})
+		}
+	}
+
+	if doc.Syncs != nil {
+		configs, err := ms.ListSyncConfigs(ctx)
+		if err != nil {
+			return nil, fmt.Errorf("failed to list syncs: %w", err)
+		}
+
+		live := make(map[string]*models.SyncConfig, len(configs))
+		for i := range configs {
+			live[configs[i].Name] = &configs[i]
+		}
+		for _, s := range doc.Syncs {
+			actual, ok := live[s.Name]
+			delete(live, s.Name)
+			drifts = appendDrift(drifts, KindSync, s.Name, ok, func() []Change { return compareSync(&s, actual) })
+		}
+		for name := range live {
+			drifts = append(drifts, Drift{Kind: KindSync, Name: name, Status: DriftExtra})
+		}
+	}
+
+	if doc.Filters != nil {
+		filters, err := ms.ListFilters(ctx)
+		if err != nil {
+			return nil, fmt.Errorf("failed to list filters: %w", err)
+		}
+
+		live := make(map[string]*models.Filter, len(filters))
+		for i := range filters {
+			live[filters[i].VirtualPath] = &filters[i]
+		}
+		for _, f := range doc.Filters {
+			actual, ok := live[f.Path]
+			delete(live, f.Path)
+			drifts = appendDrift(drifts, KindFilter, f.Path, ok, func() []Change { return compareFilter(&f, actual) })
+		}
+		for path := range live {
+			drifts = append(drifts, Drift{Kind: KindFilter, Name: path, Status: DriftExtra})
+		}
+	}
+
+	sort.SliceStable(drifts, func(i, j int) bool {
+		if drifts[i].Kind != drifts[j].Kind {
+			return drifts[i].Kind < drifts[j].Kind
+		}
+		return drifts[i].Name < drifts[j].Name
+	})
+	return drifts, nil
+}
+
+// appendDrift adds the drift of a declared resource, which is missing if it doesn't exist
+func appendDrift(drifts []Drift, kind, name string, exists bool, compare func() []Change) []Drift {
+	if !exists {
+		return append(drifts, Drift{Kind: kind, Name: name, Status: DriftMissing})
+	}
+	if changes := compare(); len(changes) > 0 {
+		return append(drifts, Drift{Kind: kind, Name: name, Status: DriftChanged, Changes: changes})
+	}
+	return drifts
+}
+
+func compareBackend(desired *Backend, actual *models.Backend) []Change {
+	var c changes
+	compare(&c, "name", desired.Name, actual.Name)
+	compare(&c, "type", desired.Type, actual.Type)
+	compare(&c, "endpoint", desired.Endpoint, actual.Endpoint)
+	compare(&c, "region", desired.Region, actual.Region)
+	compare(&c, "bucket", desired.Bucket, actual.Bucket)
+	compare(&c, "use_ssl", desired.UseSSL, actual.UseSSL)
+	secret(&c, "access_key", desired.AccessKey, actual.AccessKey)
+	secret(&c, "secret_key", desired.SecretKey, actual.SecretKey)
+	compare(&c, "dns_server", desired.DNSServer, actual.DNSServer)
+	compare(&c, "ip_preference", desired.IPPreference, actual.IPPreference)
+	compare(&c, "happy_eyeballs", desired.HappyEyeballs, actual.HappyEyeballs)
+	compare(&c, "static_hosts", desired.StaticHosts, actual.StaticHosts)
+	compare(&c, "trash", desired.Trash, actual.TrashEnabled)
+	compare(&c, "trash_prefix", desired.TrashPrefix, actual.TrashPrefix)
+	duration(&c, "trash_retention", desired.TrashRetention, actual.TrashRetention)
+	return c
+}
+
+func compareSync(desired *Sync, actual *models.SyncConfig) []Change {
+	var c changes
+	compare(&c, "source", desired.Source, actual.SourcePath)
+	compare(&c, "dest", desired.Dest, actual.DestPath)
+	compare(&c, "direction", desired.Direction, actual.Direction)
+	compare(&c, "isolated", desired.Isolated, actual.Isolated)
+	compare(&c, "enabled", desired.Enabled, actual.Enabled)
+	duration(&c, "interval", desired.Interval, actual.Interval)
+	compare(&c, "schedule", desired.Schedule, actual.Schedule)
+	duration(&c, "jitter", desired.Jitter, actual.Jitter)
+	compare(&c, "blackout", desired.Blackout, actual.Blackout)
+	duration(&c, "max_duration", desired.MaxDuration, actual.MaxDuration)
+	compare(&c, "stop_at", desired.StopAt, actual.StopAt)
+	duration(&c, "deadline_grace", desired.DeadlineGrace, actual.DeadlineGrace)
+	compare(&c, "workers", desired.Workers, actual.Workers)
+	compare(&c, "weight", desired.Weight, actual.Weight)
+	compare(&c, "queue_order", desired.QueueOrder, actual.QueueOrder)
+	compare(&c, "chunk_size", desired.ChunkSize, actual.ChunkSize)
+	compare(&c, "ignore", desired.Ignore, actual.IgnorePattern)
+	compare(&c, "min_size", desired.MinSize, actual.MinSize)
+	compare(&c, "max_size", desired.MaxSize, actual.MaxSize)
+	compare(&c, "modified_after", desired.ModifiedAfter, actual.ModifiedAfter)
+	compare(&c, "modified_before", desired.ModifiedBefore, actual.ModifiedBefore)
+	compare(&c, "include_mime", desired.IncludeMime, actual.IncludeMime)
+	compare(&c, "exclude_mime", desired.ExcludeMime, actual.ExcludeMime)
+	duration(&c, "delete_grace", desired.DeleteGrace, actual.DeleteGrace)
+	compare(&c, "delta_threshold", desired.DeltaThreshold, actual.DeltaThreshold)
+	compare(&c, "dedup", desired.Dedup, actual.Dedup)
+	compare(&c, "compression", desired.Compression, actual.Compression)
+	compare(&c, "compression_rules", desired.CompressionRules, actual.CompressionRules)
+	compare(&c, "verify", desired.Verify, actual.Verify)
+	compare(&c, "integrity", desired.Integrity, actual.Integrity)
+	compare(&c, "symlinks", desired.Symlinks, actual.Symlinks)
+	compare(&c, "normalization", desired.Normalization, actual.Normalization)
+	compare(&c, "reserved_names", desired.ReservedNames, actual.ReservedNames)
+	compare(&c, "preserve", desired.Preserve, actual.Preserve)
+	compare(&c, "publish", desired.Publish, actual.Publish)
+	return c
+}
+
+func compareFilter(desired *Filter, actual *models.Filter) []Change {
+	var c changes
+	compare(&c, "name", desired.Name, actual.Name)
+	compare(&c, "query", desired.Query, actual.QueryExpression)
+	compare(&c, "description", desired.Description, actual.Description)
+	return c
+}
+
+type changes []Change
+
+// compare records a change if the setting is declared with a different value
+func compare[T comparable](c *changes, field string, desired *T, actual T) {
+	if desired != nil && *desired != actual {
+		*c = append(*c, Change{Field: field, Desired: fmt.Sprint(*desired), Actual: fmt.Sprint(actual)})
+	}
+}
+
+// duration compares a declared duration with a setting stored in seconds
+func duration(c *changes, field string, desired *Duration, actual int64) {
+	if desired != nil && desired.Seconds() != actual {
+		*c = append(*c, Change{
+			Field:   field,
+			Desired: time.Duration(*desired).String(),
+			Actual:  (time.Duration(actual) * time.Second).String(),
+		})
+	}
+}
+
+// secret compares credentials without revealing them in the report
+func secret(c *changes, field string, desired *string, actual string) {
+	if desired != nil && *desired != actual {
+		*c = append(*c, Change{Field: field, Desired: redacted, Actual: redacted})
+	}
+}
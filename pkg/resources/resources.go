@@ -0,0 +1,154 @@
+package resources
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Document declares the backends, syncs and filters expected in the metadata store.
+// Settings that are omitted aren't compared, so documents only need to declare what they manage.
+type Document struct {
+	Backends []Backend `yaml:"backends"`
+	Syncs    []Sync    `yaml:"syncs"`
+	Filters  []Filter  `yaml:"filters"`
+}
+
+// Backend declares a storage backend, identified by its id
+type Backend struct {
+	ID             string    `yaml:"id"`
+	Name           *string   `yaml:"name"`
+	Type           *string   `yaml:"type"`
+	Endpoint       *string   `yaml:"endpoint"`
+	Region         *string   `yaml:"region"`
+	Bucket         *string   `yaml:"bucket"`
+	UseSSL         *bool     `yaml:"use_ssl"`
+	AccessKey      *string   `yaml:"access_key"`
+	SecretKey      *string   `yaml:"secret_key"`
+	DNSServer      *string   `yaml:"dns_server"`
+	IPPreference   *string   `yaml:"ip_preference"`
+	HappyEyeballs  *bool     `yaml:"happy_eyeballs"`
+	StaticHosts    *string   `yaml:"static_hosts"`
+	Trash          *bool     `yaml:"trash"`
+	TrashPrefix    *string   `yaml:"trash_prefix"`
+	TrashRetention *Duration `yaml:"trash_retention"`
+}
+
+// Sync declares a sync configuration, identified by its name
+type Sync struct {
+	Name             string    `yaml:"name"`
+	Source           *string   `yaml:"source"`
+	Dest             *string   `yaml:"dest"`
+	Direction        *string   `yaml:"direction"`
+	Isolated         *bool     `yaml:"isolated"`
+	Enabled          *bool     `yaml:"enabled"`
+	Interval         *Duration `yaml:"interval"`
+	Schedule         *string   `yaml:"schedule"`
+	Jitter           *Duration `yaml:"jitter"`
+	Blackout         *string   `yaml:"blackout"`
+	MaxDuration      *Duration `yaml:"max_duration"`
+	StopAt           *string   `yaml:"stop_at"`
+	DeadlineGrace    *Duration `yaml:"deadline_grace"`
+	Workers          *int      `yaml:"workers"`
+	Weight           *int      `yaml:"weight"`
+	QueueOrder       *string   `yaml:"queue_order"`
+	ChunkSize        *int64    `yaml:"chunk_size"`
+	Ignore           *string   `yaml:"ignore"`
+	MinSize          *int64    `yaml:"min_size"`
+	MaxSize          *int64    `yaml:"max_size"`
+	ModifiedAfter    *string   `yaml:"modified_after"`
+	ModifiedBefore   *string   `yaml:"modified_before"`
+	IncludeMime      *string   `yaml:"include_mime"`
+	ExcludeMime      *string   `yaml:"exclude_mime"`
+	DeleteGrace      *Duration `yaml:"delete_grace"`
+	DeltaThreshold   *int64    `yaml:"delta_threshold"`
+	Dedup            *bool     `yaml:"dedup"`
+	Compression      *string   `yaml:"compression"`
+	CompressionRules *string   `yaml:"compression_rules"`
+	Verify           *string   `yaml:"verify"`
+	Integrity        *string   `yaml:"integrity"`
+	Symlinks         *string   `yaml:"symlinks"`
+	Normalization    *string   `yaml:"normalization"`
+	ReservedNames    *string   `yaml:"reserved_names"`
+	Preserve         *string   `yaml:"preserve"`
+	Publish          *bool     `yaml:"publish"`
+}
+
+// Filter declares a dynamic filter, identified by its virtual path
+type Filter struct {
+	Path        string  `yaml:"path"`
+	Name        *string `yaml:"name"`
+	Query       *string `yaml:"query"`
+	Description *string `yaml:"description"`
+}
+
+// Duration is a duration written like "30s" or "24h", which is stored in seconds
+type Duration time.Duration
+
+func (d *Duration) UnmarshalYAML(node *yaml.Node) error {
+	var value string
+	if err := node.Decode(&value); err != nil {
+		return err
+	}
+
+	parsed, err := time.ParseDuration(value)
+	if err != nil {
+		return fmt.Errorf("line %d: invalid duration '%s', expected e.g. '30s' or '5m'", node.Line, value)
+	}
+	*d = Duration(parsed)
+	return nil
+}
+
+// Seconds returns the duration in whole seconds, as stored in the metadata store
+func (d Duration) Seconds() int64 {
+	return int64(time.Duration(d) / time.Second)
+}
+
+// Load reads the document from the file, or from stdin if the path is "-"
+func Load(path string) (*Document, error) {
+	var data []byte
+	var err error
+	if path == "-" {
+		data, err = io.ReadAll(os.Stdin)
+	} else {
+		data, err = os.ReadFile(path)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read '%s': %w", path, err)
+	}
+
+	return Parse(data)
+}
+
+// Parse decodes the document, rejecting unknown settings and resources without identifier
+func Parse(data []byte) (*Document, error) {
+	doc := &Document{}
+
+	decoder := yaml.NewDecoder(bytes.NewReader(data))
+	decoder.KnownFields(true)
+	if err := decoder.Decode(doc); err != nil && err != io.EOF {
+		return nil, fmt.Errorf("failed to decode resources: %w", err)
+	}
+
+	for i, b := range doc.Backends {
+		if b.ID == "" {
+			return nil, fmt.Errorf("backend #%d has no id", i+1)
+		}
+	}
+	for i, s := range doc.Syncs {
+		if s.Name == "" {
+			return nil, fmt.Errorf("sync #%d has no name", i+1)
+		}
+	}
+	for i, f := range doc.Filters {
+		if f.Path == "" {
+			return nil, fmt.Errorf("filter #%d has no path", i+1)
+		}
+	}
+
+	return doc, nil
+}
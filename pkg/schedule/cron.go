@@ -0,0 +1,216 @@
+package schedule
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// maxSearch limits how far Next looks ahead for expressions that never match (e.g. "0 0 30 2 *")
+const maxSearch = 5 * 366 * 24 * time.Hour
+
+var macros = map[string]string{
+	"@yearly":   "0 0 1 1 *",
+	"@annually": "0 0 1 1 *",
+	"@monthly":  "0 0 1 * *",
+	"@weekly":   "0 0 * * 0",
+	"@daily":    "0 0 * * *",
+	"@midnight": "0 0 * * *",
+	"@hourly":   "0 * * * *",
+}
+
+var monthNames = map[string]int{
+	"jan": 1, "feb": 2, "mar": 3, "apr": 4, "may": 5, "jun": 6,
+	"jul": 7, "aug": 8, "sep": 9, "oct": 10, "nov": 11, "dec": 12,
+}
+
+var dayNames = map[string]int{
+	"sun": 0, "mon": 1, "tue": 2, "wed": 3, "thu": 4, "fri": 5, "sat": 6,
+}
+
+// Cron is a parsed standard five field cron expression (minute hour day-of-month month day-of-week)
+type Cron struct {
+	expr    string
+	minutes uint64
+	hours   uint64
+	days    uint64
+	months  uint64
+	weeks   uint64
+	// Day-of-month and day-of-week are OR'ed if both are restricted
+	anyDay  bool
+	anyWeek bool
+}
+
+// ParseCron parses a cron expression with support for lists, ranges, steps, names and @macros
+func ParseCron(expr string) (*Cron, error) {
+	expr = strings.TrimSpace(expr)
+
+	spec := expr
+	if macro, ok := macros[strings.ToLower(spec)]; ok {
+		spec = macro
+	}
+
+	fields := strings.Fields(spec)
+	if len(fields) != 5 {
+		return nil, fmt.Errorf("invalid cron expression '%s': expected 5 fields, got %d", expr, len(fields))
+	}
+
+	c := &Cron{
+		expr:    expr,
+		anyDay:  fields[2] == "*" || fields[2] == "?",
+		anyWeek: fields[4] == "*" || fields[4] == "?",
+	}
+
+	var err error
+	if c.minutes, err = parseField(fields[0], 0, 59, nil); err != nil {
+		return nil, fmt.Errorf("invalid minute field in '%s': %w", expr, err)
+	}
+	if c.hours, err = parseField(fields[1], 0, 23, nil); err != nil {
+		return nil, fmt.Errorf("invalid hour field in '%s': %w", expr, err)
+	}
+	if c.days, err = parseField(fields[2], 1, 31, nil); err != nil {
+		return nil, fmt.Errorf("invalid day-of-month field in '%s': %w", expr, err)
+	}
+	if c.months, err = parseField(fields[3], 1, 12, monthNames); err != nil {
+		return nil, fmt.Errorf("invalid month field in '%s': %w", expr, err)
+	}
+	if c.weeks, err = parseField(fields[4], 0, 7, dayNames); err != nil {
+		return nil, fmt.Errorf("invalid day-of-week field in '%s': %w", expr, err)
+	}
+
+	// Both 0 and 7 represent sunday
+	if c.weeks&(1<<7) != 0 {
+		c.weeks |= 1
+	}
+	if !c.anyDay && c.anyWeek && !c.possible() {
+		return nil, fmt.Errorf("invalid cron expression '%s': day-of-month never occurs in the selected months", expr)
+	}
+
+	return c, nil
+}
+
+func (c *Cron) String() string {
+	return c.expr
+}
+
+// Next returns the first time matching the expression strictly after t, or the zero time if none exists
+func (c *Cron) Next(t time.Time) time.Time {
+	t = t.Truncate(time.Minute).Add(time.Minute)
+	limit := t.Add(maxSearch)
+
+	for t.Before(limit) {
+		if c.months&(1<<uint(t.Month())) == 0 {
+			t = time.Date(t.Year(), t.Month()+1, 1, 0, 0, 0, 0, t.Location())
+			continue
+		}
+		if !c.matchDay(t) {
+			t = time.Date(t.Year(), t.Month(), t.Day()+1, 0, 0, 0, 0, t.Location())
+			continue
+		}
+		if c.hours&(1<<uint(t.Hour())) == 0 {
+			t = time.Date(t.Year(), t.Month(), t.Day(), t.Hour()+1, 0, 0, 0, t.Location())
+			continue
+		}
+		if c.minutes&(1<<uint(t.Minute())) == 0 {
+			t = t.Add(time.Minute)
+			continue
+		}
+		return t
+	}
+
+	return time.Time{}
+}
+
+// possible returns whether any selected day-of-month exists in any selected month, counting february as 29 days
+func (c *Cron) possible() bool {
+	for month := 1; month <= 12; month++ {
+		if c.months&(1<<uint(month)) == 0 {
+			continue
+		}
+		days := time.Date(2000, time.Month(month)+1, 0, 0, 0, 0, 0, time.UTC).Day()
+		if c.days&(1<<uint(days+1)-1) != 0 {
+			return true
+		}
+	}
+	return false
+}
+
+func (c *Cron) matchDay(t time.Time) bool {
+	day := c.days&(1<<uint(t.Day())) != 0
+	week := c.weeks&(1<<uint(t.Weekday())) != 0
+
+	switch {
+	case c.anyDay && c.anyWeek:
+		return true
+	case c.anyDay:
+		return week
+	case c.anyWeek:
+		return day
+	default:
+		return day || week
+	}
+}
+
+func parseField(field string, min, max int, names map[string]int) (uint64, error) {
+	var bits uint64
+
+	for _, part := range strings.Split(field, ",") {
+		expr, stepValue, hasStep := strings.Cut(part, "/")
+
+		step := 1
+		if hasStep {
+			var err error
+			if step, err = strconv.Atoi(stepValue); err != nil || step <= 0 {
+				return 0, fmt.Errorf("invalid step '%s'", stepValue)
+			}
+		}
+
+		start, end := min, max
+		switch {
+		case expr == "*" || expr == "?":
+		case strings.Contains(expr, "-"):
+			from, to, _ := strings.Cut(expr, "-")
+			var err error
+			if start, err = parseValue(from, min, max, names); err != nil {
+				return 0, err
+			}
+			if end, err = parseValue(to, min, max, names); err != nil {
+				return 0, err
+			}
+			if start > end {
+				return 0, fmt.Errorf("invalid range '%s'", expr)
+			}
+		default:
+			value, err := parseValue(expr, min, max, names)
+			if err != nil {
+				return 0, err
+			}
+			start = value
+			if !hasStep {
+				end = value
+			}
+		}
+
+		for i := start; i <= end; i += step {
+			bits |= 1 << uint(i)
+		}
+	}
+
+	return bits, nil
+}
+
+func parseValue(value string, min, max int, names map[string]int) (int, error) {
+	if n, ok := names[strings.ToLower(value)]; ok {
+		return n, nil
+	}
+
+	n, err := strconv.Atoi(value)
+	if err != nil {
+		return 0, fmt.Errorf("invalid value '%s'", value)
+	}
+	if n < min || n > max {
+		return 0, fmt.Errorf("value %d out of range [%d, %d]", n, min, max)
+	}
+	return n, nil
+}
@@ -0,0 +1,55 @@
+package schedule
+
+import (
+	"testing"
+	"time"
+)
+
+func TestParseCron(t *testing.T) {
+	from := time.Date(2026, time.January, 15, 10, 30, 0, 0, time.UTC)
+
+	tests := []struct {
+		expr string
+		next time.Time
+		err  bool
+	}{
+		{expr: "*/15 * * * *", next: time.Date(2026, time.January, 15, 10, 45, 0, 0, time.UTC)},
+		{expr: "0 2 * * *", next: time.Date(2026, time.January, 16, 2, 0, 0, 0, time.UTC)},
+		{expr: "0 9-17/4 * * mon-fri", next: time.Date(2026, time.January, 15, 13, 0, 0, 0, time.UTC)},
+		{expr: "0 0 * * 7", next: time.Date(2026, time.January, 18, 0, 0, 0, 0, time.UTC)},
+		{expr: "30 6 1,15 jan,jul *", next: time.Date(2026, time.July, 1, 6, 30, 0, 0, time.UTC)},
+		{expr: "0 0 13 * fri", next: time.Date(2026, time.January, 16, 0, 0, 0, 0, time.UTC)},
+		{expr: "0 0 29 2 *", next: time.Date(2028, time.February, 29, 0, 0, 0, 0, time.UTC)},
+		{expr: "@monthly", next: time.Date(2026, time.February, 1, 0, 0, 0, 0, time.UTC)},
+		{expr: "@weekly", next: time.Date(2026, time.January, 18, 0, 0, 0, 0, time.UTC)},
+		{expr: "0 0 30 2 *", err: true},
+		{expr: "0 0 31 4,6,9,11 *", err: true},
+		{expr: "0 0 * *", err: true},
+		{expr: "60 * * * *", err: true},
+		{expr: "* 24 * * *", err: true},
+		{expr: "* * 0 * *", err: true},
+		{expr: "* * * 13 *", err: true},
+		{expr: "* * * * 8", err: true},
+		{expr: "5-1 * * * *", err: true},
+		{expr: "*/0 * * * *", err: true},
+		{expr: "* * * foo *", err: true},
+		{expr: "@never", err: true},
+	}
+
+	for _, test := range tests {
+		cron, err := ParseCron(test.expr)
+		if test.err {
+			if err == nil {
+				t.Errorf("expected '%s' to be rejected", test.expr)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("failed to parse '%s': %v", test.expr, err)
+			continue
+		}
+		if next := cron.Next(from); !next.Equal(test.next) {
+			t.Errorf("expected next run of '%s' at %s, got %s", test.expr, test.next, next)
+		}
+	}
+}
@@ -0,0 +1,169 @@
+package schedule
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+// Window is a recurring daily time window, optionally limited to a range of weekdays.
+// Windows ending before they start wrap around midnight.
+type Window struct {
+	// Weekdays the window starts on (bit per time.Weekday)
+	days  uint8
+	start time.Duration
+	end   time.Duration
+}
+
+// ParseWindows parses a comma separated list of windows like "Mon-Fri 08:00-18:00, 22:00-02:00"
+func ParseWindows(value string) ([]Window, error) {
+	var windows []Window
+
+	for _, part := range strings.Split(value, ",") {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			continue
+		}
+
+		window, err := parseWindow(part)
+		if err != nil {
+			return nil, fmt.Errorf("invalid window '%s': %w", part, err)
+		}
+		windows = append(windows, window)
+	}
+
+	return windows, nil
+}
+
+func parseWindow(value string) (Window, error) {
+	window := Window{
+		days: 0x7f,
+	}
+
+	fields := strings.Fields(value)
+	switch len(fields) {
+	case 1:
+	case 2:
+		days, err := parseField(fields[0], 0, 7, dayNames)
+		if err != nil {
+			return window, err
+		}
+		if days&(1<<7) != 0 {
+			days |= 1
+		}
+		window.days = uint8(days & 0x7f)
+		fields = fields[1:]
+	default:
+		return window, fmt.Errorf("expected '[days] HH:MM-HH:MM'")
+	}
+
+	from, to, ok := strings.Cut(fields[0], "-")
+	if !ok {
+		return window, fmt.Errorf("expected 'HH:MM-HH:MM'")
+	}
+
+	var err error
+	if window.start, err = parseClock(from); err != nil {
+		return window, err
+	}
+	if window.end, err = parseClock(to); err != nil {
+		return window, err
+	}
+	if window.start == window.end {
+		return window, fmt.Errorf("window must not be empty")
+	}
+
+	return window, nil
+}
+
+func parseClock(value string) (time.Duration, error) {
+	t, err := time.Parse("15:04", value)
+	if err != nil {
+		return 0, fmt.Errorf("invalid time '%s'", value)
+	}
+	return time.Duration(t.Hour())*time.Hour + time.Duration(t.Minute())*time.Minute, nil
+}
+
+// NextClock returns the first occurrence of the time of day (HH:MM) after t
+func NextClock(value string, t time.Time) (time.Time, error) {
+	clock, err := parseClock(strings.TrimSpace(value))
+	if err != nil {
+		return time.Time{}, err
+	}
+
+	next := time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, t.Location()).Add(clock)
+	if !next.After(t) {
+		next = next.AddDate(0, 0, 1)
+	}
+	return next, nil
+}
+
+// Active returns whether t is within the window and when the current occurrence ends
+func (w Window) Active(t time.Time) (bool, time.Time) {
+	midnight := time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, t.Location())
+
+	// Check today's occurrence and the one of yesterday, which may wrap into today
+	for _, day := range []time.Time{midnight, midnight.AddDate(0, 0, -1)} {
+		if w.days&(1<<uint(day.Weekday())) == 0 {
+			continue
+		}
+
+		start := day.Add(w.start)
+		end := day.Add(w.end)
+		if w.end < w.start {
+			end = end.AddDate(0, 0, 1)
+		}
+
+		if !t.Before(start) && t.Before(end) {
+			return true, end
+		}
+	}
+
+	return false, time.Time{}
+}
+
+// NextStart returns the start of the first occurrence after t
+func (w Window) NextStart(t time.Time) time.Time {
+	midnight := time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, t.Location())
+
+	for i := 0; i <= 7; i++ {
+		day := midnight.AddDate(0, 0, i)
+		if w.days&(1<<uint(day.Weekday())) == 0 {
+			continue
+		}
+		if start := day.Add(w.start); start.After(t) {
+			return start
+		}
+	}
+
+	return time.Time{}
+}
+
+// Blackout returns whether t is within any of the windows and when all overlapping windows have ended
+func Blackout(windows []Window, t time.Time) (bool, time.Time) {
+	active, until := false, t
+
+	// Follow overlapping or adjacent windows until none is active anymore
+	for {
+		extended := false
+		for _, w := range windows {
+			if ok, end := w.Active(until); ok && end.After(until) {
+				active, until, extended = true, end, true
+			}
+		}
+		if !extended {
+			return active, until
+		}
+	}
+}
+
+// NextBlackout returns the start of the next window after t, or the zero time if there are no windows
+func NextBlackout(windows []Window, t time.Time) time.Time {
+	var next time.Time
+	for _, w := range windows {
+		if start := w.NextStart(t); !start.IsZero() && (next.IsZero() || start.Before(next)) {
+			next = start
+		}
+	}
+	return next
+}
@@ -0,0 +1,55 @@
+package schedule
+
+import (
+	"testing"
+	"time"
+)
+
+func TestParseWindows(t *testing.T) {
+	// 2026-01-15 is a thursday
+	at := func(day, hour, minute int) time.Time {
+		return time.Date(2026, time.January, day, hour, minute, 0, 0, time.UTC)
+	}
+
+	tests := []struct {
+		value  string
+		at     time.Time
+		active bool
+		until  time.Time
+		err    bool
+	}{
+		{value: "08:00-18:00", at: at(15, 12, 0), active: true, until: at(15, 18, 0)},
+		{value: "08:00-18:00", at: at(15, 18, 0)},
+		{value: "22:00-02:00", at: at(16, 1, 0), active: true, until: at(16, 2, 0)},
+		{value: "22:00-02:00", at: at(15, 23, 0), active: true, until: at(16, 2, 0)},
+		{value: "Mon-Fri 08:00-18:00", at: at(17, 12, 0)},
+		{value: "Sun 00:00-12:00", at: at(18, 6, 0), active: true, until: at(18, 12, 0)},
+		{value: "7 00:00-12:00", at: at(18, 6, 0), active: true, until: at(18, 12, 0)},
+		{value: "Fri 22:00-02:00", at: at(17, 1, 0), active: true, until: at(17, 2, 0)},
+		{value: "08:00-12:00, 12:00-14:00", at: at(15, 9, 0), active: true, until: at(15, 14, 0)},
+		{value: "", at: at(15, 12, 0)},
+		{value: "08:00-08:00", err: true},
+		{value: "08:00", err: true},
+		{value: "25:00-26:00", err: true},
+		{value: "Mon-Fri Sat 08:00-18:00", err: true},
+		{value: "Funday 08:00-18:00", err: true},
+	}
+
+	for _, test := range tests {
+		windows, err := ParseWindows(test.value)
+		if test.err {
+			if err == nil {
+				t.Errorf("expected '%s' to be rejected", test.value)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("failed to parse '%s': %v", test.value, err)
+			continue
+		}
+		active, until := Blackout(windows, test.at)
+		if active != test.active || (active && !until.Equal(test.until)) {
+			t.Errorf("expected '%s' at %s to be active %t until %s, got %t until %s", test.value, test.at, test.active, test.until, active, until)
+		}
+	}
+}
@@ -0,0 +1,246 @@
+package secrets
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"reflect"
+	"strings"
+	"sync"
+	"time"
+
+	config "github.com/mwantia/gosync/internal/config/server"
+	"github.com/mwantia/gosync/pkg/db/models"
+)
+
+// Schemes of the references supported by NewResolver
+const (
+	SchemeEnv   = "env"
+	SchemeFile  = "file"
+	SchemeVault = "vault"
+)
+
+// Provider resolves the references of a single scheme, e.g. the variable name of "${env:VAR}"
+type Provider interface {
+	Resolve(ctx context.Context, ref string) (string, error)
+}
+
+// ProviderFunc adapts a function to a Provider
+type ProviderFunc func(ctx context.Context, ref string) (string, error)
+
+func (f ProviderFunc) Resolve(ctx context.Context, ref string) (string, error) {
+	return f(ctx, ref)
+}
+
+type cached struct {
+	value   string
+	expires time.Time
+}
+
+// Resolver expands references like "${env:VAR}", "${file:/run/secrets/key}" or "${vault:secret/data/gosync#key}"
+// within values. References are only resolved once the value is used, so rotated secrets are picked up after the cache expired.
+type Resolver struct {
+	mutex     sync.Mutex
+	providers map[string]Provider
+	ttl       time.Duration
+	cache     map[string]cached
+}
+
+// NewResolver creates a resolver for environment variables, files and Vault
+func NewResolver(cfg config.SecretsServerConfig) (*Resolver, error) {
+	r := newResolver(0)
+	if cfg.CacheTTL != "" {
+		ttl, err := time.ParseDuration(cfg.CacheTTL)
+		if err != nil {
+			return nil, fmt.Errorf("invalid cache ttl '%s': %w", cfg.CacheTTL, err)
+		}
+		r.ttl = ttl
+	}
+
+	vault, err := newVaultProvider(cfg.Vault, newResolver(0))
+	if err != nil {
+		return nil, err
+	}
+	r.Register(SchemeVault, vault)
+
+	return r, nil
+}
+
+// newResolver creates a resolver only supporting environment variables and files
+func newResolver(ttl time.Duration) *Resolver {
+	r := &Resolver{
+		providers: make(map[string]Provider),
+		ttl:       ttl,
+		cache:     make(map[string]cached),
+	}
+	r.Register(SchemeEnv, ProviderFunc(resolveEnv))
+	r.Register(SchemeFile, ProviderFunc(resolveFile))
+	return r
+}
+
+// Register adds or replaces the provider of the scheme
+func (r *Resolver) Register(scheme string, provider Provider) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	r.providers[scheme] = provider
+}
+
+// Expand replaces all references within the value with their resolved values.
+// Values without references are returned unchanged and "$${" is kept as literal "${".
+func (r *Resolver) Expand(ctx context.Context, value string) (string, error) {
+	if !strings.Contains(value, "${") {
+		return value, nil
+	}
+
+	var sb strings.Builder
+	for {
+		start := strings.Index(value, "${")
+		if start < 0 {
+			sb.WriteString(value)
+			return sb.String(), nil
+		}
+
+		if start > 0 && value[start-1] == '$' {
+			sb.WriteString(value[:start-1] + "${")
+			value = value[start+2:]
+			continue
+		}
+
+		end := strings.IndexByte(value[start:], '}')
+		if end < 0 {
+			return "", fmt.Errorf("unterminated secret reference '%s'", value[start:])
+		}
+
+		resolved, err := r.resolve(ctx, value[start+2:start+end])
+		if err != nil {
+			return "", err
+		}
+
+		sb.WriteString(value[:start])
+		sb.WriteString(resolved)
+		value = value[start+end+1:]
+	}
+}
+
+// resolve returns the value of a single reference in the form "<scheme>:<ref>"
+func (r *Resolver) resolve(ctx context.Context, reference string) (string, error) {
+	scheme, ref, ok := strings.Cut(reference, ":")
+	if !ok || ref == "" {
+		return "", fmt.Errorf("invalid secret reference '${%s}', expected '${<scheme>:<ref>}'", reference)
+	}
+
+	r.mutex.Lock()
+	provider, ok := r.providers[scheme]
+	entry, hit := r.cache[reference]
+	r.mutex.Unlock()
+
+	if !ok {
+		return "", fmt.Errorf("unsupported secret reference '${%s}'", reference)
+	}
+	if hit && time.Now().Before(entry.expires) {
+		return entry.value, nil
+	}
+
+	value, err := provider.Resolve(ctx, ref)
+	if err != nil {
+		return "", fmt.Errorf("failed to resolve '${%s}': %w", reference, err)
+	}
+
+	if r.ttl > 0 {
+		r.mutex.Lock()
+		r.cache[reference] = cached{
+			value:   value,
+			expires: time.Now().Add(r.ttl),
+		}
+		r.mutex.Unlock()
+	}
+	return value, nil
+}
+
+// ResolveBackend returns a copy of the backend with all references within its endpoint, bucket and credentials resolved
+func (r *Resolver) ResolveBackend(ctx context.Context, backend *models.Backend) (*models.Backend, error) {
+	resolved := *backend
+	for _, field := range []*string{
+		&resolved.Endpoint,
+		&resolved.Region,
+		&resolved.Bucket,
+		&resolved.AccessKey,
+		&resolved.SecretKey,
+	} {
+		value, err := r.Expand(ctx, *field)
+		if err != nil {
+			return nil, fmt.Errorf("failed to resolve secrets of backend '%s': %w", backend.ID, err)
+		}
+		*field = value
+	}
+	return &resolved, nil
+}
+
+// ExpandConfig resolves all references within the string values of the configuration
+func (r *Resolver) ExpandConfig(ctx context.Context, cfg *config.BaseServerConfig) error {
+	return r.expandValue(ctx, reflect.ValueOf(cfg).Elem(), "")
+}
+
+func (r *Resolver) expandValue(ctx context.Context, v reflect.Value, path string) error {
+	switch v.Kind() {
+	case reflect.String:
+		value, err := r.Expand(ctx, v.String())
+		if err != nil {
+			return fmt.Errorf("%s: %w", path, err)
+		}
+		v.SetString(value)
+
+	case reflect.Struct:
+		t := v.Type()
+		for i := 0; i < t.NumField(); i++ {
+			name, _, _ := strings.Cut(t.Field(i).Tag.Get("mapstructure"), ",")
+			if name == "" {
+				continue
+			}
+			if path != "" {
+				name = path + "." + name
+			}
+			if err := r.expandValue(ctx, v.Field(i), name); err != nil {
+				return err
+			}
+		}
+
+	case reflect.Slice:
+		for i := 0; i < v.Len(); i++ {
+			if err := r.expandValue(ctx, v.Index(i), fmt.Sprintf("%s[%d]", path, i)); err != nil {
+				return err
+			}
+		}
+
+	case reflect.Map:
+		if v.Type().Elem().Kind() != reflect.String {
+			return nil
+		}
+		for _, key := range v.MapKeys() {
+			value, err := r.Expand(ctx, v.MapIndex(key).String())
+			if err != nil {
+				return fmt.Errorf("%s.%s: %w", path, key.String(), err)
+			}
+			v.SetMapIndex(key, reflect.ValueOf(value).Convert(v.Type().Elem()))
+		}
+	}
+	return nil
+}
+
+func resolveEnv(ctx context.Context, name string) (string, error) {
+	value, ok := os.LookupEnv(name)
+	if !ok {
+		return "", fmt.Errorf("environment variable '%s' is not set", name)
+	}
+	return value, nil
+}
+
+// resolveFile returns the content of the file without trailing line breaks, as written by most secret stores
+func resolveFile(ctx context.Context, name string) (string, error) {
+	data, err := os.ReadFile(name)
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimRight(string(data), "\r\n"), nil
+}
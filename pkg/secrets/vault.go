@@ -0,0 +1,114 @@
+package secrets
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	config "github.com/mwantia/gosync/internal/config/server"
+)
+
+// defaultVaultTimeout is used if no timeout is configured
+const defaultVaultTimeout = 10 * time.Second
+
+// vaultProvider reads fields of secrets from Vault using references like "secret/data/gosync#access_key".
+// The path is used as-is, so secrets within KV version 2 engines require the "data/" segment.
+type vaultProvider struct {
+	cfg    config.VaultSecretsConfig
+	client *http.Client
+	// base resolves the token, which may reference an environment variable or file
+	base *Resolver
+}
+
+func newVaultProvider(cfg config.VaultSecretsConfig, base *Resolver) (*vaultProvider, error) {
+	timeout := defaultVaultTimeout
+	if cfg.Timeout != "" {
+		parsed, err := time.ParseDuration(cfg.Timeout)
+		if err != nil {
+			return nil, fmt.Errorf("invalid vault timeout '%s': %w", cfg.Timeout, err)
+		}
+		timeout = parsed
+	}
+
+	return &vaultProvider{
+		cfg:    cfg,
+		client: &http.Client{Timeout: timeout},
+		base:   base,
+	}, nil
+}
+
+func (p *vaultProvider) Resolve(ctx context.Context, ref string) (string, error) {
+	secretPath, field, ok := strings.Cut(ref, "#")
+	if !ok || secretPath == "" || field == "" {
+		return "", fmt.Errorf("expected '<path>#<field>'")
+	}
+
+	address := p.cfg.Address
+	if address == "" {
+		address = os.Getenv("VAULT_ADDR")
+	}
+	if address == "" {
+		return "", fmt.Errorf("vault address isn't configured")
+	}
+
+	token := p.cfg.Token
+	if token == "" {
+		token = os.Getenv("VAULT_TOKEN")
+	}
+	token, err := p.base.Expand(ctx, token)
+	if err != nil {
+		return "", fmt.Errorf("failed to resolve vault token: %w", err)
+	}
+
+	url := strings.TrimRight(address, "/") + "/v1/" + strings.TrimLeft(secretPath, "/")
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return "", err
+	}
+	if token != "" {
+		req.Header.Set("X-Vault-Token", token)
+	}
+	if p.cfg.Namespace != "" {
+		req.Header.Set("X-Vault-Namespace", p.cfg.Namespace)
+	}
+
+	resp, err := p.client.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+		return "", fmt.Errorf("unexpected status %s: %s", resp.Status, strings.TrimSpace(string(body)))
+	}
+
+	var secret struct {
+		Data map[string]any `json:"data"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&secret); err != nil {
+		return "", fmt.Errorf("failed to decode secret: %w", err)
+	}
+
+	// KV version 2 engines nest the fields next to the metadata of the version
+	data := secret.Data
+	if nested, ok := data["data"].(map[string]any); ok {
+		if _, ok := data["metadata"]; ok {
+			data = nested
+		}
+	}
+
+	value, ok := data[field]
+	if !ok {
+		return "", fmt.Errorf("secret '%s' has no field '%s'", secretPath, field)
+	}
+	if s, ok := value.(string); ok {
+		return s, nil
+	}
+	return fmt.Sprint(value), nil
+}
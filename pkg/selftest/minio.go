@@ -0,0 +1,155 @@
+package selftest
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"time"
+
+	"github.com/mwantia/gosync/pkg/db/models"
+	"github.com/mwantia/gosync/pkg/storage"
+)
+
+// minioStartTimeout limits how long to wait for the ephemeral server to become healthy
+const minioStartTimeout = 30 * time.Second
+
+// minioBucket is created within the ephemeral server
+const minioBucket = "gosync-selftest"
+
+// minioServer is an ephemeral MinIO server storing its data within the temporary directory of the run
+type minioServer struct {
+	cmd      *exec.Cmd
+	exited   chan error
+	address  string
+	user     string
+	password string
+}
+
+// startMinIO starts the binary on a free local port and waits until it is healthy
+func startMinIO(ctx context.Context, binary, dir string) (*minioServer, error) {
+	address, err := freeAddress()
+	if err != nil {
+		return nil, err
+	}
+	console, err := freeAddress()
+	if err != nil {
+		return nil, err
+	}
+
+	secret := make([]byte, 16)
+	if _, err := rand.Read(secret); err != nil {
+		return nil, fmt.Errorf("failed to generate credentials: %w", err)
+	}
+
+	logFile, err := os.Create(filepath.Join(dir, "minio.log"))
+	if err != nil {
+		return nil, fmt.Errorf("failed to create minio log: %w", err)
+	}
+	defer logFile.Close()
+
+	m := &minioServer{
+		exited:   make(chan error, 1),
+		address:  address,
+		user:     "gosync-selftest",
+		password: hex.EncodeToString(secret),
+	}
+
+	m.cmd = exec.Command(binary, "server", filepath.Join(dir, "minio"), "--address", address, "--console-address", console, "--quiet")
+	m.cmd.Env = append(os.Environ(), "MINIO_ROOT_USER="+m.user, "MINIO_ROOT_PASSWORD="+m.password)
+	m.cmd.Stdout = logFile
+	m.cmd.Stderr = logFile
+	if err := m.cmd.Start(); err != nil {
+		return nil, fmt.Errorf("failed to start minio: %w", err)
+	}
+	go func() {
+		m.exited <- m.cmd.Wait()
+	}()
+
+	if err := m.waitHealthy(ctx); err != nil {
+		m.stop()
+		return nil, err
+	}
+
+	st, err := storage.NewS3Storage(m.backend())
+	if err != nil {
+		m.stop()
+		return nil, err
+	}
+	if err := st.EnsureBucket(ctx, ""); err != nil {
+		m.stop()
+		return nil, err
+	}
+
+	return m, nil
+}
+
+// waitHealthy polls the liveness endpoint until the server responds or has exited
+func (m *minioServer) waitHealthy(ctx context.Context) error {
+	ctx, cancel := context.WithTimeout(ctx, minioStartTimeout)
+	defer cancel()
+
+	url := fmt.Sprintf("http://%s/minio/health/live", m.address)
+	ticker := time.NewTicker(100 * time.Millisecond)
+	defer ticker.Stop()
+
+	for {
+		req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+		if err != nil {
+			return err
+		}
+		if resp, err := http.DefaultClient.Do(req); err == nil {
+			resp.Body.Close()
+			if resp.StatusCode == http.StatusOK {
+				return nil
+			}
+		}
+
+		select {
+		case err := <-m.exited:
+			m.exited <- err
+			return fmt.Errorf("minio exited during startup: %v", err)
+		case <-ctx.Done():
+			return fmt.Errorf("minio didn't become healthy within %s", minioStartTimeout)
+		case <-ticker.C:
+		}
+	}
+}
+
+// stop kills the server and waits for it to exit
+func (m *minioServer) stop() {
+	if m.cmd.Process != nil {
+		m.cmd.Process.Kill()
+	}
+	<-m.exited
+}
+
+// backend returns the backend used to access the bucket of the server
+func (m *minioServer) backend() *models.Backend {
+	return &models.Backend{
+		ID:        "selftest",
+		Name:      "selftest",
+		Type:      storage.TypeS3,
+		Endpoint:  m.address,
+		Region:    "us-east-1",
+		Bucket:    minioBucket,
+		AccessKey: m.user,
+		SecretKey: m.password,
+	}
+}
+
+// freeAddress returns a local address with a port that is currently unused
+func freeAddress() (string, error) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		return "", fmt.Errorf("failed to find a free port: %w", err)
+	}
+	defer listener.Close()
+
+	return listener.Addr().String(), nil
+}
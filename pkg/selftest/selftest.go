@@ -0,0 +1,506 @@
+package selftest
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path"
+	"path/filepath"
+	"strings"
+	"time"
+
+	config "github.com/mwantia/gosync/internal/config/server"
+	"github.com/mwantia/gosync/pkg/db/models"
+	"github.com/mwantia/gosync/pkg/db/store"
+	"github.com/mwantia/gosync/pkg/engine"
+	"github.com/mwantia/gosync/pkg/fixture"
+	"github.com/mwantia/gosync/pkg/storage"
+)
+
+// Both clients share the remote prefix, but keep separate baselines and local directories
+const (
+	clientA = "selftest-a"
+	clientB = "selftest-b"
+)
+
+// maxProblems limits the number of differences reported for a single step
+const maxProblems = 5
+
+// Options configures a self-test run
+type Options struct {
+	// Backend is used as remote target below a unique prefix. Without backend, an ephemeral
+	// MinIO server is started if MinIOBinary can be found, otherwise a local directory is used.
+	Backend     *models.Backend
+	MinIOBinary string
+	// Files is the number of files of the generated tree (at least 3)
+	Files int
+	Seed  uint64
+	// KeepTemp keeps the temporary directory of the run for inspection
+	KeepTemp bool
+	// OnStep is called after each step has finished (optional)
+	OnStep func(Step)
+}
+
+// Step is the outcome of a single step of the scenario
+type Step struct {
+	Name     string
+	Duration time.Duration
+	Err      error
+}
+
+// Report summarizes a self-test run
+type Report struct {
+	// Target describes the remote side of the run
+	Target  string
+	TempDir string
+	Steps   []Step
+}
+
+// Failed returns true if any step has failed
+func (r *Report) Failed() bool {
+	for _, step := range r.Steps {
+		if step.Err != nil {
+			return true
+		}
+	}
+	return false
+}
+
+type runner struct {
+	opts    Options
+	dir     string
+	store   store.MetadataStore
+	backend *models.Backend
+	sync    *models.SyncConfig
+	engines map[string]*engine.Engine
+	// manifest of the tree generated by the upload step
+	manifest *fixture.Manifest
+}
+
+// Run executes the end-to-end scenario between two clients sharing a remote target and verifies their final state.
+// Errors are only returned if the run couldn't be set up, failed steps are reported within the report.
+func Run(ctx context.Context, opts Options) (*Report, error) {
+	if opts.Files == 0 {
+		opts.Files = 20
+	}
+	if opts.Files < 3 {
+		return nil, fmt.Errorf("at least 3 files are required")
+	}
+
+	dir, err := os.MkdirTemp("", "gosync-selftest-")
+	if err != nil {
+		return nil, fmt.Errorf("failed to create temporary directory: %w", err)
+	}
+	report := &Report{TempDir: dir}
+	if !opts.KeepTemp {
+		defer os.RemoveAll(dir)
+	}
+
+	r := &runner{
+		opts:    opts,
+		dir:     dir,
+		engines: make(map[string]*engine.Engine),
+	}
+
+	switch {
+	case opts.Backend != nil:
+		b := *opts.Backend
+		// Trashed objects are stored outside the prefix and would be left behind
+		b.TrashEnabled = false
+		r.backend = &b
+		report.Target = fmt.Sprintf("backend '%s' (%s)", b.ID, b.Type)
+
+	case opts.MinIOBinary != "":
+		binary, err := exec.LookPath(opts.MinIOBinary)
+		if err != nil {
+			r.backend = r.localBackend()
+			report.Target = fmt.Sprintf("local directory %s (minio not found)", r.backend.Endpoint)
+			break
+		}
+
+		server, err := startMinIO(ctx, binary, dir)
+		if err != nil {
+			return report, err
+		}
+		defer server.stop()
+
+		r.backend = server.backend()
+		report.Target = fmt.Sprintf("ephemeral MinIO at %s", server.address)
+
+	default:
+		r.backend = r.localBackend()
+		report.Target = fmt.Sprintf("local directory %s", r.backend.Endpoint)
+	}
+
+	if err := r.setup(ctx); err != nil {
+		return report, err
+	}
+	defer r.store.Close()
+
+	steps := []struct {
+		name string
+		fn   func(context.Context) error
+	}{
+		{"upload", r.upload},
+		{"download", r.download},
+		{"changes", r.changes},
+		{"conflict", r.conflict},
+		{"interrupt", r.interrupt},
+	}
+
+	for _, step := range steps {
+		if !r.step(ctx, report, step.name, step.fn) {
+			break
+		}
+	}
+	// The remote objects are always removed, even if a step has failed
+	r.step(ctx, report, "cleanup", r.cleanup)
+
+	return report, nil
+}
+
+// step runs fn and records its outcome, returning false if it has failed
+func (r *runner) step(ctx context.Context, report *Report, name string, fn func(context.Context) error) bool {
+	started := time.Now()
+	err := fn(ctx)
+
+	step := Step{
+		Name:     name,
+		Duration: time.Since(started),
+		Err:      err,
+	}
+	report.Steps = append(report.Steps, step)
+	if r.opts.OnStep != nil {
+		r.opts.OnStep(step)
+	}
+	return err == nil
+}
+
+func (r *runner) localBackend() *models.Backend {
+	return &models.Backend{
+		ID:       "selftest",
+		Name:     "selftest",
+		Type:     storage.TypeLocal,
+		Endpoint: filepath.Join(r.dir, "remote"),
+		Bucket:   "selftest",
+	}
+}
+
+// setup creates a temporary metadata store with the backend and a bidirectional sync for both clients
+func (r *runner) setup(ctx context.Context) error {
+	ms, err := store.Open(ctx, config.MetadataServerConfig{
+		Type: "sqlite",
+		SQLite: config.MetadataSQLiteConfig{
+			Path: filepath.Join(r.dir, "metadata.db"),
+		},
+	}, false)
+	if err != nil {
+		return fmt.Errorf("failed to open metadata store: %w", err)
+	}
+	r.store = ms
+
+	if err := ms.CreateBackend(ctx, r.backend); err != nil {
+		return fmt.Errorf("failed to create backend: %w", err)
+	}
+
+	prefix := fmt.Sprintf("gosync-selftest-%s", time.Now().UTC().Format("20060102T150405.000000000"))
+	r.sync = &models.SyncConfig{
+		Name:       "selftest",
+		SourcePath: path.Join(r.backend.ID, prefix),
+		DestPath:   filepath.Join(r.dir, "clients", "{client_id}"),
+		Direction:  engine.DirectionBidirectional,
+		Enabled:    true,
+		Interval:   60,
+		Workers:    4,
+		ChunkSize:  5 * 1024 * 1024,
+	}
+	if err := ms.CreateSyncConfig(ctx, r.sync); err != nil {
+		return fmt.Errorf("failed to create sync: %w", err)
+	}
+
+	for _, clientID := range []string{clientA, clientB} {
+		r.engines[clientID] = engine.New(ms, engine.Options{ClientID: clientID})
+	}
+	return nil
+}
+
+// local returns the path of rel within the local directory of the client
+func (r *runner) local(clientID string, rel ...string) string {
+	return filepath.Join(append([]string{r.dir, "clients", clientID}, rel...)...)
+}
+
+// run executes a single pass for the client and fails if any action has failed
+func (r *runner) run(ctx context.Context, clientID string) (*engine.Result, error) {
+	result, err := r.engines[clientID].Run(ctx, r.sync)
+	if err != nil {
+		return nil, fmt.Errorf("pass of %s failed: %w", clientID, err)
+	}
+	if len(result.Errors) > 0 {
+		return nil, fmt.Errorf("%d actions of %s failed, first: %w", len(result.Errors), clientID, result.Errors[0])
+	}
+	return result, nil
+}
+
+// runAll executes a pass for each client in order
+func (r *runner) runAll(ctx context.Context, clientIDs ...string) error {
+	for _, clientID := range clientIDs {
+		if _, err := r.run(ctx, clientID); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// upload generates a tree for the first client and uploads it
+func (r *runner) upload(ctx context.Context) error {
+	manifest, err := fixture.Generate(r.local(clientA), fixture.Options{
+		Files:  r.opts.Files,
+		Depth:  3,
+		Fanout: 3,
+		Sizes:  fixture.SizesSmall,
+		Seed:   r.opts.Seed,
+	})
+	if err != nil {
+		return err
+	}
+	r.manifest = manifest
+
+	result, err := r.run(ctx, clientA)
+	if err != nil {
+		return err
+	}
+	if result.Uploaded != len(manifest.Entries) {
+		return fmt.Errorf("uploaded %d of %d files", result.Uploaded, len(manifest.Entries))
+	}
+	return nil
+}
+
+// download syncs the uploaded tree to the second client and verifies its content
+func (r *runner) download(ctx context.Context) error {
+	result, err := r.run(ctx, clientB)
+	if err != nil {
+		return err
+	}
+	if result.Downloaded != len(r.manifest.Entries) {
+		return fmt.Errorf("downloaded %d of %d files", result.Downloaded, len(r.manifest.Entries))
+	}
+
+	problems, err := fixture.Verify(r.local(clientB), r.manifest)
+	if err != nil {
+		return err
+	}
+	return problemsError(problems)
+}
+
+// changes modifies, deletes and adds files on both clients and verifies that they converge
+func (r *runner) changes(ctx context.Context) error {
+	modified := r.local(clientA, filepath.FromSlash(r.manifest.Entries[0].Path))
+	if err := appendFile(modified, "modified by selftest\n"); err != nil {
+		return err
+	}
+	if err := os.Remove(r.local(clientA, filepath.FromSlash(r.manifest.Entries[1].Path))); err != nil {
+		return err
+	}
+	if err := writeFile(r.local(clientA, "selftest", "added-a.txt"), "added by client a\n"); err != nil {
+		return err
+	}
+	if err := writeFile(r.local(clientB, "selftest", "added-b.txt"), "added by client b\n"); err != nil {
+		return err
+	}
+
+	if err := r.runAll(ctx, clientA, clientB, clientA); err != nil {
+		return err
+	}
+	return r.converged()
+}
+
+// conflict changes the same file on both clients, which must keep the version of the
+// second client as conflict copy next to the version of the first client
+func (r *runner) conflict(ctx context.Context) error {
+	rel := r.manifest.Entries[2].Path
+	if err := writeFile(r.local(clientA, filepath.FromSlash(rel)), "version of client a\n"); err != nil {
+		return err
+	}
+	if err := writeFile(r.local(clientB, filepath.FromSlash(rel)), "conflicting version of client b\n"); err != nil {
+		return err
+	}
+
+	if err := r.runAll(ctx, clientA); err != nil {
+		return err
+	}
+	result, err := r.run(ctx, clientB)
+	if err != nil {
+		return err
+	}
+	if result.Conflicts != 1 {
+		return fmt.Errorf("expected 1 conflict, got %d", result.Conflicts)
+	}
+	if err := r.runAll(ctx, clientA, clientB); err != nil {
+		return err
+	}
+
+	if err := r.converged(); err != nil {
+		return err
+	}
+
+	content, err := os.ReadFile(r.local(clientA, filepath.FromSlash(rel)))
+	if err != nil {
+		return err
+	}
+	if string(content) != "version of client a\n" {
+		return fmt.Errorf("'%s' doesn't contain the version of client a", rel)
+	}
+
+	ext := path.Ext(rel)
+	pattern := r.local(clientA, filepath.FromSlash(strings.TrimSuffix(rel, ext)+".conflict-"+clientB+"-*"+ext))
+	copies, err := filepath.Glob(pattern)
+	if err != nil {
+		return err
+	}
+	if len(copies) != 1 {
+		return fmt.Errorf("expected 1 conflict copy of '%s', found %d", rel, len(copies))
+	}
+	return nil
+}
+
+// interrupt cancels a pass after its first action has completed and verifies that the next pass finishes the sync
+func (r *runner) interrupt(ctx context.Context) error {
+	manifest, err := fixture.Generate(r.local(clientA, "interrupted"), fixture.Options{
+		Files:  r.opts.Files,
+		Depth:  2,
+		Fanout: 2,
+		Sizes:  fixture.SizesMedium,
+		Seed:   r.opts.Seed + 1,
+	})
+	if err != nil {
+		return err
+	}
+
+	eng := r.engines[clientA]
+	passCtx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	go func() {
+		ticker := time.NewTicker(5 * time.Millisecond)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-passCtx.Done():
+				return
+			case <-ticker.C:
+			}
+
+			for _, p := range eng.Progress() {
+				if p.SyncConfigID == r.sync.ID && p.Completed > 0 {
+					cancel()
+					return
+				}
+			}
+		}
+	}()
+
+	// The interrupted pass is expected to fail
+	result, err := eng.Run(passCtx, r.sync)
+	cancel()
+	if err == nil && len(result.Errors) == 0 && result.Uploaded == len(manifest.Entries) {
+		return fmt.Errorf("pass finished before it could be interrupted")
+	}
+	if ctx.Err() != nil {
+		return ctx.Err()
+	}
+
+	if err := r.runAll(ctx, clientA, clientB); err != nil {
+		return err
+	}
+
+	problems, err := fixture.Verify(r.local(clientB, "interrupted"), manifest)
+	if err != nil {
+		return err
+	}
+	if err := problemsError(problems); err != nil {
+		return err
+	}
+	return r.converged()
+}
+
+// cleanup removes all remote objects below the prefix of the sync
+func (r *runner) cleanup(ctx context.Context) error {
+	if r.sync == nil {
+		return nil
+	}
+
+	st, err := storage.New(r.backend)
+	if err != nil {
+		return err
+	}
+	defer storage.Close(st)
+
+	prefix := strings.TrimPrefix(r.sync.SourcePath, r.backend.ID+"/") + "/"
+	var keys []string
+	err = st.List(ctx, prefix, func(info storage.ObjectInfo) error {
+		keys = append(keys, info.Key)
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("failed to list remote objects: %w", err)
+	}
+
+	failed, err := st.DeleteMany(ctx, keys)
+	if err != nil {
+		return fmt.Errorf("failed to delete remote objects: %w", err)
+	}
+	if len(failed) > 0 {
+		return fmt.Errorf("failed to delete %d remote objects, first: %w", len(failed), failed[0])
+	}
+	return nil
+}
+
+// converged verifies that the local directories of both clients are identical
+func (r *runner) converged() error {
+	manifest, err := fixture.Scan(r.local(clientA))
+	if err != nil {
+		return err
+	}
+
+	problems, err := fixture.Verify(r.local(clientB), manifest)
+	if err != nil {
+		return err
+	}
+	return problemsError(problems)
+}
+
+// problemsError returns an error listing the first problems, or nil if there are none
+func problemsError(problems []string) error {
+	if len(problems) == 0 {
+		return nil
+	}
+
+	shown := problems[:min(len(problems), maxProblems)]
+	msg := strings.Join(shown, "; ")
+	if len(problems) > len(shown) {
+		msg += fmt.Sprintf(" (and %d more)", len(problems)-len(shown))
+	}
+	return errors.New(msg)
+}
+
+func writeFile(name, content string) error {
+	if err := os.MkdirAll(filepath.Dir(name), 0755); err != nil {
+		return err
+	}
+	return os.WriteFile(name, []byte(content), 0644)
+}
+
+func appendFile(name, content string) error {
+	file, err := os.OpenFile(name, os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		return err
+	}
+	if _, err := file.WriteString(content); err != nil {
+		file.Close()
+		return err
+	}
+	return file.Close()
+}
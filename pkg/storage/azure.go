@@ -0,0 +1,315 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore"
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore/to"
+	"github.com/Azure/azure-sdk-for-go/sdk/storage/azblob"
+	"github.com/Azure/azure-sdk-for-go/sdk/storage/azblob/blob"
+	"github.com/Azure/azure-sdk-for-go/sdk/storage/azblob/bloberror"
+	"github.com/Azure/azure-sdk-for-go/sdk/storage/azblob/container"
+	"github.com/mwantia/gosync/pkg/db/models"
+)
+
+// azureMaxBatchSize is the maximum number of sub-requests within a single blob batch
+const azureMaxBatchSize = 256
+
+// AzureStorage implements Storage for Azure Blob Storage containers
+type AzureStorage struct {
+	client    *azblob.Client
+	container *container.Client
+	name      string
+}
+
+// NewAzureStorage creates a new Azure Blob storage for the provided backend
+func NewAzureStorage(backend *models.Backend) (*AzureStorage, error) {
+	serviceURL := backend.Endpoint
+	if serviceURL == "" {
+		serviceURL = fmt.Sprintf("https://%s.blob.core.windows.net/", backend.AccessKey)
+	}
+
+	credential, err := azblob.NewSharedKeyCredential(backend.AccessKey, backend.SecretKey)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create azure credential: %w", err)
+	}
+
+	options := &azblob.ClientOptions{}
+
+	transport, err := newTransport(backend)
+	if err != nil {
+		return nil, err
+	}
+	if transport != nil {
+		options.Transport = &http.Client{Transport: transport}
+	}
+
+	client, err := azblob.NewClientWithSharedKeyCredential(serviceURL, credential, options)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create azure client: %w", err)
+	}
+
+	return &AzureStorage{
+		client:    client,
+		container: client.ServiceClient().NewContainerClient(backend.Bucket),
+		name:      backend.Bucket,
+	}, nil
+}
+
+func (s *AzureStorage) List(ctx context.Context, prefix string, fn func(ObjectInfo) error) error {
+	pager := s.client.NewListBlobsFlatPager(s.name, &azblob.ListBlobsFlatOptions{
+		Prefix: to.Ptr(prefix),
+	})
+
+	for pager.More() {
+		page, err := pager.NextPage(ctx)
+		if err != nil {
+			return toAzureError(err)
+		}
+
+		for _, item := range page.Segment.BlobItems {
+			info := ObjectInfo{
+				Key: deref(item.Name),
+			}
+			if item.VersionID != nil {
+				info.VersionID = *item.VersionID
+			}
+			if props := item.Properties; props != nil {
+				info.Size = deref(props.ContentLength)
+				info.ContentType = deref(props.ContentType)
+				info.LastModified = deref(props.LastModified)
+				if props.ETag != nil {
+					info.ETag = string(*props.ETag)
+				}
+			}
+
+			if err := fn(info); err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+func (s *AzureStorage) Stat(ctx context.Context, key string) (*ObjectInfo, error) {
+	props, err := s.container.NewBlobClient(key).GetProperties(ctx, nil)
+	if err != nil {
+		return nil, toAzureError(err)
+	}
+
+	return &ObjectInfo{
+		Key:          key,
+		Size:         deref(props.ContentLength),
+		ETag:         azureETag(props.ETag),
+		VersionID:    deref(props.VersionID),
+		ContentType:  deref(props.ContentType),
+		LastModified: deref(props.LastModified),
+	}, nil
+}
+
+func (s *AzureStorage) Get(ctx context.Context, key string) (io.ReadCloser, error) {
+	resp, err := s.client.DownloadStream(ctx, s.name, key, nil)
+	if err != nil {
+		return nil, toAzureError(err)
+	}
+
+	return resp.Body, nil
+}
+
+func (s *AzureStorage) GetRange(ctx context.Context, key string, offset, length int64, etag string) (io.ReadCloser, error) {
+	opts := &azblob.DownloadStreamOptions{
+		Range: blob.HTTPRange{Offset: offset, Count: length},
+	}
+	if etag != "" {
+		opts.AccessConditions = &blob.AccessConditions{
+			ModifiedAccessConditions: &blob.ModifiedAccessConditions{IfMatch: to.Ptr(azcore.ETag(etag))},
+		}
+	}
+
+	resp, err := s.client.DownloadStream(ctx, s.name, key, opts)
+	if err != nil {
+		return nil, toAzureError(err)
+	}
+
+	return resp.Body, nil
+}
+
+func (s *AzureStorage) Put(ctx context.Context, key string, reader io.Reader, size int64, opts PutOptions) (*ObjectInfo, error) {
+	if !opts.RetainUntil.IsZero() {
+		return nil, fmt.Errorf("%w: retention locks of azure backends are configured by immutability policies", ErrNotSupported)
+	}
+
+	uploadOpts := &azblob.UploadStreamOptions{
+		BlockSize: opts.PartSize,
+	}
+	if opts.ContentType != "" {
+		uploadOpts.HTTPHeaders = &blob.HTTPHeaders{
+			BlobContentType: to.Ptr(opts.ContentType),
+		}
+	}
+
+	conditions := &blob.ModifiedAccessConditions{}
+	if opts.IfMatch != "" {
+		conditions.IfMatch = to.Ptr(azcore.ETag(opts.IfMatch))
+	}
+	if opts.IfNoneMatch {
+		conditions.IfNoneMatch = to.Ptr(azcore.ETagAny)
+	}
+	uploadOpts.AccessConditions = &blob.AccessConditions{
+		ModifiedAccessConditions: conditions,
+	}
+
+	resp, err := s.client.UploadStream(ctx, s.name, key, reader, uploadOpts)
+	if err != nil {
+		return nil, toAzureError(err)
+	}
+
+	return &ObjectInfo{
+		Key:          key,
+		Size:         size,
+		ETag:         azureETag(resp.ETag),
+		VersionID:    deref(resp.VersionID),
+		ContentType:  opts.ContentType,
+		LastModified: deref(resp.LastModified),
+	}, nil
+}
+
+func (s *AzureStorage) Copy(ctx context.Context, srcKey, dstKey string) (*ObjectInfo, error) {
+	return s.CopyVersion(ctx, srcKey, "", dstKey)
+}
+
+func (s *AzureStorage) CopyVersion(ctx context.Context, srcKey, versionID, dstKey string) (*ObjectInfo, error) {
+	src := s.container.NewBlobClient(srcKey)
+	if versionID != "" {
+		versioned, err := src.WithVersionID(versionID)
+		if err != nil {
+			return nil, fmt.Errorf("failed to reference version '%s': %w", versionID, err)
+		}
+		src = versioned
+	}
+
+	dst := s.container.NewBlobClient(dstKey)
+	if _, err := dst.StartCopyFromURL(ctx, src.URL(), nil); err != nil {
+		return nil, toAzureError(err)
+	}
+
+	// Copies within the same account usually complete immediately, but may be pending
+	for {
+		props, err := dst.GetProperties(ctx, nil)
+		if err != nil {
+			return nil, toAzureError(err)
+		}
+
+		status := deref(props.CopyStatus)
+		switch status {
+		case blob.CopyStatusTypeSuccess:
+			return &ObjectInfo{
+				Key:          dstKey,
+				Size:         deref(props.ContentLength),
+				ETag:         azureETag(props.ETag),
+				VersionID:    deref(props.VersionID),
+				ContentType:  deref(props.ContentType),
+				LastModified: deref(props.LastModified),
+			}, nil
+		case blob.CopyStatusTypePending:
+		default:
+			return nil, fmt.Errorf("failed to copy '%s' to '%s': copy status %s", srcKey, dstKey, status)
+		}
+
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-time.After(500 * time.Millisecond):
+		}
+	}
+}
+
+func (s *AzureStorage) Delete(ctx context.Context, key string) error {
+	_, err := s.client.DeleteBlob(ctx, s.name, key, nil)
+	return toAzureError(err)
+}
+
+func (s *AzureStorage) DeleteMany(ctx context.Context, keys []string) ([]DeleteError, error) {
+	var failed []DeleteError
+
+	for start := 0; start < len(keys); start += azureMaxBatchSize {
+		end := min(start+azureMaxBatchSize, len(keys))
+
+		batch, err := s.container.NewBatchBuilder()
+		if err != nil {
+			return failed, fmt.Errorf("failed to create blob batch: %w", err)
+		}
+
+		for _, key := range keys[start:end] {
+			if err := batch.Delete(key, nil); err != nil {
+				return failed, fmt.Errorf("failed to add '%s' to blob batch: %w", key, err)
+			}
+		}
+
+		resp, err := s.container.SubmitBatch(ctx, batch, nil)
+		if err != nil {
+			return failed, toAzureError(err)
+		}
+
+		for _, item := range resp.Responses {
+			// Deleting a missing blob is treated the same as for S3
+			if item.Error != nil && !bloberror.HasCode(item.Error, bloberror.BlobNotFound) {
+				failed = append(failed, DeleteError{
+					Key: deref(item.BlobName),
+					Err: item.Error,
+				})
+			}
+		}
+	}
+
+	return failed, nil
+}
+
+// DeleteCalls returns the number of blob batches DeleteMany submits, which are limited to 256 sub-requests
+func (s *AzureStorage) DeleteCalls(keys int) int64 {
+	return int64((keys + azureMaxBatchSize - 1) / azureMaxBatchSize)
+}
+
+func deref[T any](v *T) T {
+	var zero T
+	if v == nil {
+		return zero
+	}
+	return *v
+}
+
+func azureETag(etag *azcore.ETag) string {
+	if etag == nil {
+		return ""
+	}
+	return string(*etag)
+}
+
+func toAzureError(err error) error {
+	if err == nil {
+		return nil
+	}
+
+	switch {
+	case bloberror.HasCode(err, bloberror.BlobNotFound, bloberror.ContainerNotFound):
+		return fmt.Errorf("%w: %v", ErrObjectNotFound, err)
+	case bloberror.HasCode(err, bloberror.ConditionNotMet, bloberror.BlobAlreadyExists):
+		return fmt.Errorf("%w: %v", ErrPreconditionFailed, err)
+	}
+
+	var respErr *azcore.ResponseError
+	if errors.As(err, &respErr) && respErr.StatusCode == http.StatusForbidden {
+		return fmt.Errorf("%w: %v", ErrAccessDenied, err)
+	}
+	if errors.As(err, &respErr) {
+		return fmt.Errorf("azure request failed with status %d: %w", respErr.StatusCode, err)
+	}
+
+	return err
+}
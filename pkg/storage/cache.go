@@ -0,0 +1,393 @@
+package storage
+
+import (
+	"container/list"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// CacheBlockSize is the size of the blocks objects are cached in, only the last block of an object may be smaller
+const CacheBlockSize = 4 << 20
+
+// cacheTempPrefix is used for blocks still being fetched, which are removed when the cache is opened
+const cacheTempPrefix = ".fetch-"
+
+// CacheStats describes the usage of a content cache since it was opened
+type CacheStats struct {
+	// Size of all cached blocks in bytes
+	Size    int64 `json:"size"`
+	MaxSize int64 `json:"max_size"`
+	Blocks  int   `json:"blocks"`
+	// Hits count the reads served from cached blocks, Misses the blocks read from the backends
+	Hits   int64 `json:"hits"`
+	Misses int64 `json:"misses"`
+	// ReadAhead counts the blocks fetched ahead of sequential reads
+	ReadAhead int64 `json:"read_ahead"`
+	Evictions int64 `json:"evictions"`
+	// Fetched counts the bytes read from the backends
+	Fetched int64 `json:"fetched"`
+}
+
+// Cache keeps blocks of objects read from backends on disk, so repeated reads of an object are served locally.
+// Blocks are keyed by backend, key and ETag, so changed objects are never served from the cache, and the least
+// recently used blocks are evicted once the cache exceeds its maximum size. Sequential reads fetch the following
+// blocks ahead of time. The order of use is kept in the modification times of the blocks, so it survives restarts.
+type Cache struct {
+	dir       string
+	maxSize   int64
+	readAhead int
+
+	mutex sync.Mutex
+	// lru orders the cached blocks from the most to the least recently used
+	lru    *list.List
+	blocks map[string]*list.Element
+	// loading contains the blocks being fetched, which concurrent reads of the blocks wait for
+	loading map[string]chan struct{}
+	stats   CacheStats
+}
+
+type cacheBlock struct {
+	name string
+	size int64
+}
+
+// NewCache opens the cache within the directory, which may hold at most maxSize bytes. Sequential reads fetch up to
+// readAhead blocks ahead of time.
+func NewCache(dir string, maxSize int64, readAhead int) (*Cache, error) {
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return nil, fmt.Errorf("failed to create cache directory '%s': %w", dir, err)
+	}
+
+	c := &Cache{
+		dir:       dir,
+		maxSize:   maxSize,
+		readAhead: max(readAhead, 0),
+		lru:       list.New(),
+		blocks:    make(map[string]*list.Element),
+		loading:   make(map[string]chan struct{}),
+	}
+	c.stats.MaxSize = maxSize
+
+	var blocks []cacheBlock
+	modified := make(map[string]time.Time)
+	err := filepath.WalkDir(dir, func(name string, entry fs.DirEntry, err error) error {
+		if err != nil || entry.IsDir() {
+			return err
+		}
+		if strings.HasPrefix(entry.Name(), cacheTempPrefix) {
+			return os.Remove(name)
+		}
+		info, err := entry.Info()
+		if err != nil {
+			return err
+		}
+		blocks = append(blocks, cacheBlock{name: name, size: info.Size()})
+		modified[name] = info.ModTime()
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to read cache directory '%s': %w", dir, err)
+	}
+
+	sort.Slice(blocks, func(i, j int) bool {
+		return modified[blocks[i].name].After(modified[blocks[j].name])
+	})
+	for _, block := range blocks {
+		c.blocks[block.name] = c.lru.PushBack(block)
+		c.stats.Size += block.size
+	}
+
+	c.mutex.Lock()
+	c.evict()
+	c.mutex.Unlock()
+
+	return c, nil
+}
+
+// Stats returns the current usage of the cache
+func (c *Cache) Stats() CacheStats {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	stats := c.stats
+	stats.Blocks = len(c.blocks)
+	return stats
+}
+
+// Open returns a reader of the object, which has to be closed to stop fetching blocks ahead of time
+func (c *Cache) Open(ctx context.Context, st Storage, backendID string, object ObjectInfo) *CachedReader {
+	ctx, cancel := context.WithCancel(ctx)
+	return &CachedReader{
+		ctx:       ctx,
+		cancel:    cancel,
+		cache:     c,
+		storage:   st,
+		backendID: backendID,
+		object:    object,
+	}
+}
+
+// blockName returns the file of a block of the object, objects are spread across subdirectories by their hash
+func (c *Cache) blockName(backendID string, object ObjectInfo, index int64) string {
+	sum := sha256.Sum256([]byte(backendID + "\x00" + object.Key + "\x00" + object.ETag))
+	id := hex.EncodeToString(sum[:])
+	return filepath.Join(c.dir, id[:2], id+"."+strconv.FormatInt(index, 10))
+}
+
+// read copies the content of the block at the offset within the block into p
+func (c *Cache) read(ctx context.Context, st Storage, backendID string, object ObjectInfo, index int64, p []byte, offset int64) (int, error) {
+	length := min(CacheBlockSize, object.Size-index*CacheBlockSize)
+	p = p[:min(int64(len(p)), length-offset)]
+
+	// Blocks evicted right after they were loaded are fetched again
+	for {
+		name, err := c.load(ctx, st, backendID, object, index, false)
+		if err != nil {
+			return 0, err
+		}
+
+		file, err := os.Open(name)
+		if errors.Is(err, fs.ErrNotExist) {
+			c.forget(name)
+			continue
+		}
+		if err != nil {
+			return 0, err
+		}
+		n, err := file.ReadAt(p, offset)
+		file.Close()
+		if err == io.EOF && n == len(p) {
+			err = nil
+		}
+		return n, err
+	}
+}
+
+// load returns the file of the block, which is fetched from the storage unless it's cached
+func (c *Cache) load(ctx context.Context, st Storage, backendID string, object ObjectInfo, index int64, ahead bool) (string, error) {
+	name := c.blockName(backendID, object, index)
+
+	for {
+		c.mutex.Lock()
+		if element, ok := c.blocks[name]; ok {
+			if !ahead {
+				c.stats.Hits++
+			}
+			// Blocks are read in many small reads, which only touch the block once
+			touch := c.lru.Front() != element
+			c.lru.MoveToFront(element)
+			c.mutex.Unlock()
+
+			if touch {
+				now := time.Now()
+				os.Chtimes(name, now, now)
+			}
+			return name, nil
+		}
+
+		if done, ok := c.loading[name]; ok {
+			c.mutex.Unlock()
+			// Failed loads are retried, since they may have been cancelled together with the reader that started them
+			select {
+			case <-done:
+			case <-ctx.Done():
+				return "", ctx.Err()
+			}
+			continue
+		}
+
+		done := make(chan struct{})
+		c.loading[name] = done
+		if ahead {
+			c.stats.ReadAhead++
+		} else {
+			c.stats.Misses++
+		}
+		c.mutex.Unlock()
+
+		size, err := c.fetch(ctx, st, object, index, name)
+
+		c.mutex.Lock()
+		delete(c.loading, name)
+		if err == nil {
+			c.blocks[name] = c.lru.PushFront(cacheBlock{name: name, size: size})
+			c.stats.Size += size
+			c.stats.Fetched += size
+			c.evict()
+		}
+		close(done)
+		c.mutex.Unlock()
+
+		return name, err
+	}
+}
+
+// fetch writes the block read from the storage into its file and returns its size
+func (c *Cache) fetch(ctx context.Context, st Storage, object ObjectInfo, index int64, name string) (int64, error) {
+	offset := index * CacheBlockSize
+	length := min(CacheBlockSize, object.Size-offset)
+
+	reader, err := OpenRange(ctx, st, object, offset, length)
+	if err != nil {
+		return 0, fmt.Errorf("failed to read '%s': %w", object.Key, err)
+	}
+	defer reader.Close()
+
+	if err := os.MkdirAll(filepath.Dir(name), 0700); err != nil {
+		return 0, err
+	}
+	temp, err := os.CreateTemp(filepath.Dir(name), cacheTempPrefix)
+	if err != nil {
+		return 0, err
+	}
+	defer os.Remove(temp.Name())
+
+	n, err := io.Copy(temp, reader)
+	if closeErr := temp.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return 0, fmt.Errorf("failed to read '%s': %w", object.Key, err)
+	}
+	if n != length {
+		return 0, fmt.Errorf("%w: '%s' changed while it was read", ErrPreconditionFailed, object.Key)
+	}
+
+	if err := os.Rename(temp.Name(), name); err != nil {
+		return 0, err
+	}
+	return n, nil
+}
+
+// forget removes a block from the index whose file was removed
+func (c *Cache) forget(name string) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	if element, ok := c.blocks[name]; ok {
+		c.stats.Size -= element.Value.(cacheBlock).size
+		c.lru.Remove(element)
+		delete(c.blocks, name)
+	}
+}
+
+// evict removes the least recently used blocks until the cache fits its maximum size, but keeps the block used last
+func (c *Cache) evict() {
+	for c.stats.Size > c.maxSize && c.lru.Len() > 1 {
+		element := c.lru.Back()
+		block := element.Value.(cacheBlock)
+		c.lru.Remove(element)
+		delete(c.blocks, block.name)
+		c.stats.Size -= block.size
+		c.stats.Evictions++
+
+		// Files still open on Windows can't be removed and are evicted again once the cache is reopened
+		os.Remove(block.name)
+	}
+}
+
+// CachedReader reads an object through the cache. Reads continuing where the previous read ended fetch the
+// following blocks ahead of time.
+type CachedReader struct {
+	ctx       context.Context
+	cancel    context.CancelFunc
+	cache     *Cache
+	storage   Storage
+	backendID string
+	object    ObjectInfo
+
+	mutex sync.Mutex
+	wait  sync.WaitGroup
+	// offset is the position of Read, next is the end of the last read, ahead is the first block not fetched ahead yet
+	offset int64
+	next   int64
+	ahead  int64
+}
+
+// Object returns the object read by the reader
+func (r *CachedReader) Object() ObjectInfo {
+	return r.object
+}
+
+func (r *CachedReader) Read(p []byte) (int, error) {
+	r.mutex.Lock()
+	offset := r.offset
+	r.mutex.Unlock()
+
+	n, err := r.ReadAt(p, offset)
+	if n > 0 && err == io.EOF {
+		err = nil
+	}
+
+	r.mutex.Lock()
+	r.offset += int64(n)
+	r.mutex.Unlock()
+	return n, err
+}
+
+func (r *CachedReader) ReadAt(p []byte, off int64) (int, error) {
+	if off < 0 {
+		return 0, fmt.Errorf("invalid offset %d", off)
+	}
+
+	start := off
+	n := 0
+	for n < len(p) && off < r.object.Size {
+		index := off / CacheBlockSize
+		m, err := r.cache.read(r.ctx, r.storage, r.backendID, r.object, index, p[n:], off-index*CacheBlockSize)
+		n += m
+		off += int64(m)
+		if err != nil {
+			return n, err
+		}
+	}
+	r.readAhead(start, off)
+
+	if n < len(p) {
+		return n, io.EOF
+	}
+	return n, nil
+}
+
+// readAhead fetches the blocks following a sequential read in the background
+func (r *CachedReader) readAhead(start, end int64) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	sequential := start == r.next
+	r.next = end
+	if !sequential || r.cache.readAhead == 0 || end == start {
+		return
+	}
+
+	last := (r.object.Size - 1) / CacheBlockSize
+	from := max((end-1)/CacheBlockSize+1, r.ahead)
+	to := min((end-1)/CacheBlockSize+int64(r.cache.readAhead), last)
+	for index := from; index <= to; index++ {
+		r.wait.Add(1)
+		go func(index int64) {
+			defer r.wait.Done()
+			r.cache.load(r.ctx, r.storage, r.backendID, r.object, index, true)
+		}(index)
+	}
+	r.ahead = max(r.ahead, to+1)
+}
+
+// Close stops fetching blocks ahead of time
+func (r *CachedReader) Close() error {
+	r.cancel()
+	r.wait.Wait()
+	return nil
+}
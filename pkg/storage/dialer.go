@@ -0,0 +1,261 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/mwantia/gosync/pkg/db/models"
+)
+
+// IP preferences supported by the backend dialer
+const (
+	PreferIPv4 = "ipv4"
+	PreferIPv6 = "ipv6"
+	OnlyIPv4   = "ipv4-only"
+	OnlyIPv6   = "ipv6-only"
+)
+
+// happyEyeballsDelay is the delay before the fallback address family is dialed (RFC 8305)
+const happyEyeballsDelay = 300 * time.Millisecond
+
+// backendDialer resolves and dials backend endpoints using the DNS options of a backend
+type backendDialer struct {
+	dialer        *net.Dialer
+	resolver      *net.Resolver
+	hosts         map[string][]net.IP
+	preference    string
+	happyEyeballs bool
+}
+
+// newTransport creates a http transport honoring the DNS options of the backend.
+// Returns nil if no DNS options are configured, so the client defaults are used.
+func newTransport(backend *models.Backend) (*http.Transport, error) {
+	if backend.DNSServer == "" && backend.IPPreference == "" && !backend.HappyEyeballs && backend.StaticHosts == "" {
+		return nil, nil
+	}
+
+	dialer, err := newBackendDialer(backend)
+	if err != nil {
+		return nil, err
+	}
+
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.DialContext = dialer.DialContext
+	return transport, nil
+}
+
+func newBackendDialer(backend *models.Backend) (*backendDialer, error) {
+	switch backend.IPPreference {
+	case "", PreferIPv4, PreferIPv6, OnlyIPv4, OnlyIPv6:
+	default:
+		return nil, fmt.Errorf("invalid ip preference '%s'", backend.IPPreference)
+	}
+
+	hosts, err := ParseStaticHosts(backend.StaticHosts)
+	if err != nil {
+		return nil, err
+	}
+
+	d := &backendDialer{
+		dialer: &net.Dialer{
+			Timeout:   30 * time.Second,
+			KeepAlive: 30 * time.Second,
+		},
+		resolver:      net.DefaultResolver,
+		hosts:         hosts,
+		preference:    backend.IPPreference,
+		happyEyeballs: backend.HappyEyeballs,
+	}
+
+	if backend.DNSServer != "" {
+		server := backend.DNSServer
+		if _, _, err := net.SplitHostPort(server); err != nil {
+			server = net.JoinHostPort(server, "53")
+		}
+
+		d.resolver = &net.Resolver{
+			PreferGo: true,
+			Dial: func(ctx context.Context, network, _ string) (net.Conn, error) {
+				return d.dialer.DialContext(ctx, network, server)
+			},
+		}
+	}
+
+	return d, nil
+}
+
+// ParseStaticHosts parses a comma separated list of "host=ip" pins; a host may be listed multiple times
+func ParseStaticHosts(value string) (map[string][]net.IP, error) {
+	hosts := make(map[string][]net.IP)
+
+	for _, entry := range strings.Split(value, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+
+		host, addr, ok := strings.Cut(entry, "=")
+		ip := net.ParseIP(strings.TrimSpace(addr))
+		if !ok || ip == nil {
+			return nil, fmt.Errorf("invalid static host '%s', expected host=ip", entry)
+		}
+
+		host = strings.ToLower(strings.TrimSpace(host))
+		hosts[host] = append(hosts[host], ip)
+	}
+
+	return hosts, nil
+}
+
+func (d *backendDialer) DialContext(ctx context.Context, network, address string) (net.Conn, error) {
+	host, port, err := net.SplitHostPort(address)
+	if err != nil {
+		return nil, err
+	}
+
+	ips, err := d.lookup(ctx, host)
+	if err != nil {
+		return nil, err
+	}
+
+	primary, fallback := d.partition(ips)
+	if len(primary) == 0 {
+		primary, fallback = fallback, nil
+	}
+	if len(primary) == 0 {
+		return nil, fmt.Errorf("no usable addresses for '%s' with ip preference '%s'", host, d.preference)
+	}
+
+	if !d.happyEyeballs || len(fallback) == 0 {
+		return d.dialSerial(ctx, network, append(primary, fallback...), port)
+	}
+
+	return d.dialParallel(ctx, network, primary, fallback, port)
+}
+
+func (d *backendDialer) lookup(ctx context.Context, host string) ([]net.IP, error) {
+	if ips, ok := d.hosts[strings.ToLower(host)]; ok {
+		return ips, nil
+	}
+	if ip := net.ParseIP(host); ip != nil {
+		return []net.IP{ip}, nil
+	}
+
+	addrs, err := d.resolver.LookupIPAddr(ctx, host)
+	if err != nil {
+		return nil, fmt.Errorf("failed to resolve '%s': %w", host, err)
+	}
+
+	ips := make([]net.IP, 0, len(addrs))
+	for _, addr := range addrs {
+		ips = append(ips, addr.IP)
+	}
+	return ips, nil
+}
+
+// partition splits the addresses into the preferred and fallback family, keeping the resolver order
+func (d *backendDialer) partition(ips []net.IP) (primary, fallback []net.IP) {
+	var v4, v6 []net.IP
+	for _, ip := range ips {
+		if ip.To4() != nil {
+			v4 = append(v4, ip)
+		} else {
+			v6 = append(v6, ip)
+		}
+	}
+
+	switch d.preference {
+	case PreferIPv4:
+		return v4, v6
+	case PreferIPv6:
+		return v6, v4
+	case OnlyIPv4:
+		return v4, nil
+	case OnlyIPv6:
+		return v6, nil
+	}
+
+	// Without a preference, the family of the first resolved address is preferred
+	if len(ips) > 0 && ips[0].To4() == nil {
+		return v6, v4
+	}
+	return v4, v6
+}
+
+func (d *backendDialer) dialSerial(ctx context.Context, network string, ips []net.IP, port string) (net.Conn, error) {
+	var errs []error
+	for _, ip := range ips {
+		conn, err := d.dialer.DialContext(ctx, network, net.JoinHostPort(ip.String(), port))
+		if err == nil {
+			return conn, nil
+		}
+		if ctx.Err() != nil {
+			return nil, err
+		}
+		errs = append(errs, err)
+	}
+
+	return nil, errors.Join(errs...)
+}
+
+// dialParallel races the primary against the fallback family, starting the fallback
+// after a short delay or as soon as the primary family failed
+func (d *backendDialer) dialParallel(ctx context.Context, network string, primary, fallback []net.IP, port string) (net.Conn, error) {
+	type result struct {
+		conn    net.Conn
+		err     error
+		primary bool
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	results := make(chan result)
+	race := func(ips []net.IP, primary bool) {
+		conn, err := d.dialSerial(ctx, network, ips, port)
+		select {
+		case results <- result{conn: conn, err: err, primary: primary}:
+		case <-ctx.Done():
+			if conn != nil {
+				conn.Close()
+			}
+		}
+	}
+
+	go race(primary, true)
+
+	timer := time.NewTimer(happyEyeballsDelay)
+	defer timer.Stop()
+
+	var errs []error
+	started, pending := false, 1
+	for {
+		select {
+		case <-timer.C:
+			if !started {
+				started, pending = true, pending+1
+				go race(fallback, false)
+			}
+
+		case res := <-results:
+			pending--
+			if res.err == nil {
+				return res.conn, nil
+			}
+			errs = append(errs, res.err)
+
+			if res.primary && !started {
+				started, pending = true, pending+1
+				go race(fallback, false)
+			}
+			if pending == 0 {
+				return nil, errors.Join(errs...)
+			}
+		}
+	}
+}
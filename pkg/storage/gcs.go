@@ -0,0 +1,275 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"sync"
+
+	gcs "cloud.google.com/go/storage"
+	"github.com/mwantia/gosync/pkg/db/models"
+	"google.golang.org/api/googleapi"
+	"google.golang.org/api/iterator"
+	"google.golang.org/api/option"
+	htransport "google.golang.org/api/transport/http"
+)
+
+const (
+	// gcsListPageSize is the number of objects requested per listing page
+	gcsListPageSize = 1000
+	// gcsDeleteWorkers is the number of parallel deletes, since GCS has no batch delete in the Go client
+	gcsDeleteWorkers = 16
+)
+
+// GCSStorage implements Storage for Google Cloud Storage buckets
+type GCSStorage struct {
+	client *gcs.Client
+	bucket *gcs.BucketHandle
+}
+
+// NewGCSStorage creates a new Google Cloud Storage storage for the provided backend
+func NewGCSStorage(backend *models.Backend) (*GCSStorage, error) {
+	var opts []option.ClientOption
+	if backend.SecretKey != "" {
+		opts = append(opts, option.WithCredentialsJSON([]byte(backend.SecretKey)))
+	}
+	if backend.Endpoint != "" {
+		opts = append(opts, option.WithEndpoint(backend.Endpoint))
+	}
+
+	transport, err := newTransport(backend)
+	if err != nil {
+		return nil, err
+	}
+	if transport != nil {
+		// A custom http client bypasses authentication, so the transport is wrapped with it
+		authorized, err := htransport.NewTransport(context.Background(), transport, append(opts, option.WithScopes(gcs.ScopeFullControl))...)
+		if err != nil {
+			return nil, fmt.Errorf("failed to create gcs transport: %w", err)
+		}
+		opts = append(opts, option.WithHTTPClient(&http.Client{Transport: authorized}))
+	}
+
+	client, err := gcs.NewClient(context.Background(), opts...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create gcs client: %w", err)
+	}
+
+	return &GCSStorage{
+		client: client,
+		bucket: client.Bucket(backend.Bucket),
+	}, nil
+}
+
+func (s *GCSStorage) List(ctx context.Context, prefix string, fn func(ObjectInfo) error) error {
+	it := s.bucket.Objects(ctx, &gcs.Query{
+		Prefix: prefix,
+	})
+	it.PageInfo().MaxSize = gcsListPageSize
+
+	for {
+		attrs, err := it.Next()
+		if errors.Is(err, iterator.Done) {
+			return nil
+		}
+		if err != nil {
+			return toGCSError(err)
+		}
+
+		if err := fn(toGCSObjectInfo(attrs)); err != nil {
+			return err
+		}
+	}
+}
+
+func (s *GCSStorage) Stat(ctx context.Context, key string) (*ObjectInfo, error) {
+	attrs, err := s.bucket.Object(key).Attrs(ctx)
+	if err != nil {
+		return nil, toGCSError(err)
+	}
+
+	info := toGCSObjectInfo(attrs)
+	return &info, nil
+}
+
+func (s *GCSStorage) Get(ctx context.Context, key string) (io.ReadCloser, error) {
+	reader, err := s.bucket.Object(key).NewReader(ctx)
+	if err != nil {
+		return nil, toGCSError(err)
+	}
+
+	return reader, nil
+}
+
+func (s *GCSStorage) GetRange(ctx context.Context, key string, offset, length int64, etag string) (io.ReadCloser, error) {
+	object := s.bucket.Object(key)
+	if etag != "" {
+		// GCS preconditions are based on generations, so the ETag is resolved first
+		attrs, err := object.Attrs(ctx)
+		if err != nil {
+			return nil, toGCSError(err)
+		}
+		if attrs.Etag != etag {
+			return nil, fmt.Errorf("%w: etag of '%s' doesn't match", ErrPreconditionFailed, key)
+		}
+		object = object.If(gcs.Conditions{GenerationMatch: attrs.Generation})
+	}
+
+	reader, err := object.NewRangeReader(ctx, offset, length)
+	if err != nil {
+		return nil, toGCSError(err)
+	}
+
+	return reader, nil
+}
+
+func (s *GCSStorage) Put(ctx context.Context, key string, reader io.Reader, size int64, opts PutOptions) (*ObjectInfo, error) {
+	if !opts.RetainUntil.IsZero() {
+		return nil, fmt.Errorf("%w: retention locks of gcs backends are configured by retention policies", ErrNotSupported)
+	}
+
+	object := s.bucket.Object(key)
+
+	switch {
+	case opts.IfNoneMatch:
+		object = object.If(gcs.Conditions{DoesNotExist: true})
+
+	case opts.IfMatch != "":
+		// GCS preconditions are based on generations, so the ETag is resolved first
+		attrs, err := object.Attrs(ctx)
+		if err != nil {
+			return nil, toGCSError(err)
+		}
+		if attrs.Etag != opts.IfMatch {
+			return nil, fmt.Errorf("%w: etag of '%s' doesn't match", ErrPreconditionFailed, key)
+		}
+		object = object.If(gcs.Conditions{GenerationMatch: attrs.Generation})
+	}
+
+	writer := object.NewWriter(ctx)
+	writer.ContentType = opts.ContentType
+	if opts.PartSize > 0 {
+		writer.ChunkSize = int(opts.PartSize)
+	}
+
+	if _, err := io.Copy(writer, reader); err != nil {
+		writer.Close()
+		return nil, toGCSError(err)
+	}
+	if err := writer.Close(); err != nil {
+		return nil, toGCSError(err)
+	}
+
+	info := toGCSObjectInfo(writer.Attrs())
+	return &info, nil
+}
+
+func (s *GCSStorage) Copy(ctx context.Context, srcKey, dstKey string) (*ObjectInfo, error) {
+	return s.CopyVersion(ctx, srcKey, "", dstKey)
+}
+
+func (s *GCSStorage) CopyVersion(ctx context.Context, srcKey, versionID, dstKey string) (*ObjectInfo, error) {
+	src := s.bucket.Object(srcKey)
+	if versionID != "" {
+		generation, err := strconv.ParseInt(versionID, 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid gcs generation '%s': %w", versionID, err)
+		}
+		src = src.Generation(generation)
+	}
+
+	attrs, err := s.bucket.Object(dstKey).CopierFrom(src).Run(ctx)
+	if err != nil {
+		return nil, toGCSError(err)
+	}
+
+	info := toGCSObjectInfo(attrs)
+	return &info, nil
+}
+
+func (s *GCSStorage) Delete(ctx context.Context, key string) error {
+	return toGCSError(s.bucket.Object(key).Delete(ctx))
+}
+
+func (s *GCSStorage) DeleteMany(ctx context.Context, keys []string) ([]DeleteError, error) {
+	var mutex sync.Mutex
+	var wait sync.WaitGroup
+	var failed []DeleteError
+
+	queue := make(chan string)
+	for i := 0; i < min(gcsDeleteWorkers, len(keys)); i++ {
+		wait.Add(1)
+		go func() {
+			defer wait.Done()
+
+			for key := range queue {
+				err := s.Delete(ctx, key)
+				if err == nil || errors.Is(err, ErrObjectNotFound) {
+					continue
+				}
+
+				mutex.Lock()
+				failed = append(failed, DeleteError{
+					Key: key,
+					Err: err,
+				})
+				mutex.Unlock()
+			}
+		}()
+	}
+
+	for _, key := range keys {
+		if ctx.Err() != nil {
+			break
+		}
+		queue <- key
+	}
+	close(queue)
+	wait.Wait()
+
+	return failed, ctx.Err()
+}
+
+// DeleteCalls returns the number of calls DeleteMany makes, which deletes each object with its own call
+func (s *GCSStorage) DeleteCalls(keys int) int64 {
+	return int64(keys)
+}
+
+// Close closes the client of the storage, which must not be used afterwards
+func (s *GCSStorage) Close() error {
+	return s.client.Close()
+}
+
+func toGCSObjectInfo(attrs *gcs.ObjectAttrs) ObjectInfo {
+	return ObjectInfo{
+		Key:          attrs.Name,
+		Size:         attrs.Size,
+		ETag:         attrs.Etag,
+		VersionID:    strconv.FormatInt(attrs.Generation, 10),
+		ContentType:  attrs.ContentType,
+		LastModified: attrs.Updated,
+	}
+}
+
+func toGCSError(err error) error {
+	if err == nil {
+		return nil
+	}
+
+	if errors.Is(err, gcs.ErrObjectNotExist) || errors.Is(err, gcs.ErrBucketNotExist) {
+		return fmt.Errorf("%w: %v", ErrObjectNotFound, err)
+	}
+
+	var apiErr *googleapi.Error
+	if errors.As(err, &apiErr) && apiErr.Code == http.StatusPreconditionFailed {
+		return fmt.Errorf("%w: %v", ErrPreconditionFailed, err)
+	}
+	if errors.As(err, &apiErr) && apiErr.Code == http.StatusForbidden {
+		return fmt.Errorf("%w: %v", ErrAccessDenied, err)
+	}
+
+	return err
+}
@@ -0,0 +1,408 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"mime"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	"github.com/mwantia/gosync/pkg/db/models"
+)
+
+// localTempPrefix is used for partial uploads, which are hidden from listings
+const localTempPrefix = ".gosync-upload-"
+
+// LocalStorage implements Storage for a directory on the local filesystem.
+// ETags are derived from size and modification time, since hashing each file on stat is too expensive.
+type LocalStorage struct {
+	root string
+	// realRoot is the root with all symbolic links resolved
+	realRoot string
+	// Serializes conditional writes, which can't be expressed atomically on the filesystem
+	mutex sync.Mutex
+
+	// symlinks is the policy for symbolic links, SymlinkSkip if empty
+	symlinks string
+	skipped  func(SkippedLink)
+	// normalization is the Unicode normalization policy of keys, names are matched byte by byte if empty
+	normalization string
+	// reserved is the policy for names Windows doesn't allow, which are written as-is if empty
+	reserved string
+}
+
+// NewLocalStorage creates a new local storage rooted at the backend endpoint
+func NewLocalStorage(backend *models.Backend) (*LocalStorage, error) {
+	if backend.Endpoint == "" {
+		return nil, fmt.Errorf("local backend requires the directory as endpoint")
+	}
+
+	root, err := filepath.Abs(backend.Endpoint)
+	if err != nil {
+		return nil, fmt.Errorf("failed to resolve local directory '%s': %w", backend.Endpoint, err)
+	}
+	if err := os.MkdirAll(root, 0755); err != nil {
+		return nil, fmt.Errorf("failed to create local directory '%s': %w", root, err)
+	}
+	realRoot, err := filepath.EvalSymlinks(root)
+	if err != nil {
+		return nil, fmt.Errorf("failed to resolve local directory '%s': %w", root, err)
+	}
+
+	return &LocalStorage{
+		root:     root,
+		realRoot: realRoot,
+	}, nil
+}
+
+func (s *LocalStorage) List(ctx context.Context, prefix string, fn func(ObjectInfo) error) error {
+	// Only walk the deepest directory covered by the prefix
+	dir := prefix
+	if !strings.HasSuffix(dir, "/") {
+		dir = path.Dir(dir)
+	}
+
+	start, err := s.resolve(dir)
+	if err != nil {
+		return err
+	}
+	real, err := filepath.EvalSymlinks(start)
+	if err != nil {
+		if errors.Is(err, fs.ErrNotExist) {
+			return nil
+		}
+		return toLocalError(err)
+	}
+
+	return toLocalError(s.walk(ctx, start, prefix, []string{real}, fn))
+}
+
+// walk lists all files below the directory. ancestors contains the resolved paths of the directory and all
+// directories above it, so followed links looping back into them are detected.
+func (s *LocalStorage) walk(ctx context.Context, dir, prefix string, ancestors []string, fn func(ObjectInfo) error) error {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		if errors.Is(err, fs.ErrNotExist) {
+			return nil
+		}
+		return err
+	}
+
+	for _, entry := range entries {
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+
+		name := filepath.Join(dir, entry.Name())
+		rel, err := filepath.Rel(s.root, name)
+		if err != nil {
+			return err
+		}
+		key := s.remoteKey(filepath.ToSlash(rel))
+
+		switch {
+		case entry.IsDir():
+			err = s.walk(ctx, name, prefix, append(ancestors, filepath.Join(ancestors[len(ancestors)-1], entry.Name())), fn)
+		case entry.Type()&fs.ModeSymlink != 0:
+			err = s.walkLink(ctx, name, key, prefix, ancestors, fn)
+		case !entry.Type().IsRegular() || strings.HasPrefix(entry.Name(), localTempPrefix) || !strings.HasPrefix(key, prefix):
+			continue
+		default:
+			var stat fs.FileInfo
+			stat, err = entry.Info()
+			if errors.Is(err, fs.ErrNotExist) {
+				continue
+			}
+			if err == nil {
+				err = fn(toLocalObjectInfo(key, stat))
+			}
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (s *LocalStorage) Stat(ctx context.Context, key string) (*ObjectInfo, error) {
+	if s.IsLink(key) {
+		return s.statLink(key)
+	}
+
+	name, err := s.resolve(key)
+	if err != nil {
+		return nil, err
+	}
+
+	stat, err := os.Stat(name)
+	if err != nil {
+		return nil, toLocalError(err)
+	}
+	if stat.IsDir() {
+		return nil, fmt.Errorf("%w: '%s' is a directory", ErrObjectNotFound, key)
+	}
+
+	info := toLocalObjectInfo(key, stat)
+	return &info, nil
+}
+
+func (s *LocalStorage) Get(ctx context.Context, key string) (io.ReadCloser, error) {
+	if s.IsLink(key) {
+		return s.getLink(key)
+	}
+
+	name, err := s.resolve(key)
+	if err != nil {
+		return nil, err
+	}
+
+	file, err := os.Open(name)
+	if err != nil {
+		return nil, toLocalError(err)
+	}
+
+	return file, nil
+}
+
+func (s *LocalStorage) GetRange(ctx context.Context, key string, offset, length int64, etag string) (io.ReadCloser, error) {
+	if s.IsLink(key) {
+		return nil, fmt.Errorf("%w: range reads of symbolic links", ErrNotSupported)
+	}
+
+	name, err := s.resolve(key)
+	if err != nil {
+		return nil, err
+	}
+
+	file, err := os.Open(name)
+	if err != nil {
+		return nil, toLocalError(err)
+	}
+	stat, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return nil, toLocalError(err)
+	}
+	if etag != "" && localETag(stat) != etag {
+		file.Close()
+		return nil, fmt.Errorf("%w: etag of '%s' doesn't match", ErrPreconditionFailed, key)
+	}
+
+	return &rangeReader{Reader: io.NewSectionReader(file, offset, length), closer: file}, nil
+}
+
+func (s *LocalStorage) Put(ctx context.Context, key string, reader io.Reader, size int64, opts PutOptions) (*ObjectInfo, error) {
+	if !opts.RetainUntil.IsZero() {
+		return nil, fmt.Errorf("%w: local backends don't support retention locks", ErrNotSupported)
+	}
+
+	if s.IsLink(key) {
+		return s.putLink(ctx, key, reader, opts)
+	}
+
+	name, err := s.resolve(key)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := os.MkdirAll(filepath.Dir(name), 0755); err != nil {
+		return nil, fmt.Errorf("failed to create directory for '%s': %w", key, err)
+	}
+	if err := s.checkParent(name, key); err != nil {
+		return nil, err
+	}
+
+	// Write into a temporary file first, so readers never see partial uploads
+	temp, err := os.CreateTemp(filepath.Dir(name), localTempPrefix+"*")
+	if err != nil {
+		return nil, fmt.Errorf("failed to create temporary file for '%s': %w", key, err)
+	}
+	defer os.Remove(temp.Name())
+
+	if err := writeFile(temp, contextReader{ctx: ctx, reader: reader}, opts.Sparse); err != nil {
+		temp.Close()
+		return nil, fmt.Errorf("failed to write '%s': %w", key, err)
+	}
+	if err := temp.Close(); err != nil {
+		return nil, fmt.Errorf("failed to write '%s': %w", key, err)
+	}
+	if !opts.ModifiedAt.IsZero() {
+		if err := os.Chtimes(temp.Name(), opts.ModifiedAt, opts.ModifiedAt); err != nil {
+			return nil, fmt.Errorf("failed to write '%s': %w", key, err)
+		}
+	}
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if err := s.checkPrecondition(name, key, false, opts); err != nil {
+		return nil, err
+	}
+	if err := os.Rename(temp.Name(), name); err != nil {
+		return nil, fmt.Errorf("failed to write '%s': %w", key, err)
+	}
+
+	return s.Stat(ctx, key)
+}
+
+func (s *LocalStorage) Copy(ctx context.Context, srcKey, dstKey string) (*ObjectInfo, error) {
+	return s.CopyVersion(ctx, srcKey, "", dstKey)
+}
+
+func (s *LocalStorage) CopyVersion(ctx context.Context, srcKey, versionID, dstKey string) (*ObjectInfo, error) {
+	if versionID != "" {
+		return nil, fmt.Errorf("%w: local backends don't keep object versions", ErrNotSupported)
+	}
+
+	sparse, err := s.SparseMap(srcKey)
+	if err != nil {
+		return nil, err
+	}
+
+	reader, err := s.Get(ctx, srcKey)
+	if err != nil {
+		return nil, err
+	}
+	defer reader.Close()
+
+	return s.Put(ctx, dstKey, reader, -1, PutOptions{Sparse: sparse})
+}
+
+func (s *LocalStorage) Delete(ctx context.Context, key string) error {
+	name, err := s.resolve(strings.TrimSuffix(key, s.linkSuffix(key)))
+	if err != nil {
+		return err
+	}
+	if err := s.checkParent(name, key); err != nil {
+		return err
+	}
+
+	if err := os.Remove(name); err != nil {
+		return toLocalError(err)
+	}
+
+	// Remove empty parent directories, since object stores have no directories either
+	for dir := filepath.Dir(name); dir != s.root && strings.HasPrefix(dir, s.root); dir = filepath.Dir(dir) {
+		if os.Remove(dir) != nil {
+			break
+		}
+	}
+
+	return nil
+}
+
+func (s *LocalStorage) DeleteMany(ctx context.Context, keys []string) ([]DeleteError, error) {
+	var failed []DeleteError
+
+	for _, key := range keys {
+		if ctx.Err() != nil {
+			return failed, ctx.Err()
+		}
+
+		err := s.Delete(ctx, key)
+		if err != nil && !errors.Is(err, ErrObjectNotFound) {
+			failed = append(failed, DeleteError{
+				Key: key,
+				Err: err,
+			})
+		}
+	}
+
+	return failed, nil
+}
+
+// Path returns the absolute path of the key within the directory
+func (s *LocalStorage) Path(key string) (string, error) {
+	return s.resolve(key)
+}
+
+// resolve maps the key to a path within the root directory
+func (s *LocalStorage) resolve(key string) (string, error) {
+	key, err := s.localKey(key)
+	if err != nil {
+		return "", err
+	}
+
+	name := filepath.Join(s.root, filepath.FromSlash(key))
+	if name != s.root && !strings.HasPrefix(name, s.root+string(filepath.Separator)) {
+		return "", fmt.Errorf("invalid key '%s': outside of local directory", key)
+	}
+	if s.normalization != "" && s.normalization != NormalizationNone && !isASCII(key) {
+		return s.matchName(filepath.ToSlash(strings.TrimPrefix(name, s.root))), nil
+	}
+
+	return name, nil
+}
+
+// checkPrecondition compares the current file or symbolic link with the conditions of the write
+func (s *LocalStorage) checkPrecondition(name, key string, link bool, opts PutOptions) error {
+	if !opts.IfNoneMatch && opts.IfMatch == "" {
+		return nil
+	}
+
+	stat, err := os.Stat(name)
+	if link {
+		stat, err = os.Lstat(name)
+	}
+	if err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return err
+	}
+
+	exists := err == nil
+	switch {
+	case opts.IfNoneMatch && exists:
+		return fmt.Errorf("%w: '%s' already exists", ErrPreconditionFailed, key)
+	case opts.IfMatch != "" && (!exists || localETag(stat) != opts.IfMatch):
+		return fmt.Errorf("%w: etag of '%s' doesn't match", ErrPreconditionFailed, key)
+	}
+
+	return nil
+}
+
+func toLocalObjectInfo(key string, stat fs.FileInfo) ObjectInfo {
+	return ObjectInfo{
+		Key:          key,
+		Size:         stat.Size(),
+		ETag:         localETag(stat),
+		ContentType:  mime.TypeByExtension(path.Ext(key)),
+		LastModified: stat.ModTime().UTC(),
+	}
+}
+
+func localETag(stat fs.FileInfo) string {
+	return fmt.Sprintf("%x-%x", stat.ModTime().UnixNano(), stat.Size())
+}
+
+func toLocalError(err error) error {
+	if err == nil {
+		return nil
+	}
+
+	if errors.Is(err, fs.ErrNotExist) {
+		return fmt.Errorf("%w: %v", ErrObjectNotFound, err)
+	}
+	if errors.Is(err, fs.ErrPermission) {
+		return fmt.Errorf("%w: %v", ErrAccessDenied, err)
+	}
+
+	return err
+}
+
+// contextReader aborts long running copies once the context is cancelled
+type contextReader struct {
+	ctx    context.Context
+	reader io.Reader
+}
+
+func (r contextReader) Read(p []byte) (int, error) {
+	if err := r.ctx.Err(); err != nil {
+		return 0, err
+	}
+	return r.reader.Read(p)
+}
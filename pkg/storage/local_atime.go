@@ -0,0 +1,23 @@
+package storage
+
+import (
+	"os"
+	"time"
+)
+
+// AccessTime returns the time the file was last read, which isn't reported on all platforms. Filesystems mounted
+// with noatime never update it, while relatime only updates it for the first read after each modification.
+func (s *LocalStorage) AccessTime(key string) (time.Time, bool, error) {
+	name, err := s.resolve(key)
+	if err != nil {
+		return time.Time{}, false, err
+	}
+
+	stat, err := os.Stat(name)
+	if err != nil {
+		return time.Time{}, false, toLocalError(err)
+	}
+
+	atime, ok := accessTime(stat)
+	return atime, ok, nil
+}
@@ -0,0 +1,17 @@
+//go:build darwin || freebsd || netbsd
+
+package storage
+
+import (
+	"io/fs"
+	"syscall"
+	"time"
+)
+
+func accessTime(stat fs.FileInfo) (time.Time, bool) {
+	sys, ok := stat.Sys().(*syscall.Stat_t)
+	if !ok {
+		return time.Time{}, false
+	}
+	return time.Unix(int64(sys.Atimespec.Sec), int64(sys.Atimespec.Nsec)).UTC(), true
+}
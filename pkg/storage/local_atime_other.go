@@ -0,0 +1,13 @@
+//go:build !(linux || openbsd || dragonfly || solaris || illumos || darwin || freebsd || netbsd || windows)
+
+package storage
+
+import (
+	"io/fs"
+	"time"
+)
+
+// accessTime reports no access times on the remaining platforms
+func accessTime(stat fs.FileInfo) (time.Time, bool) {
+	return time.Time{}, false
+}
@@ -0,0 +1,16 @@
+package storage
+
+import (
+	"io/fs"
+	"syscall"
+	"time"
+)
+
+// accessTime returns the last access time of NTFS, which Windows only updates if enabled for the volume
+func accessTime(stat fs.FileInfo) (time.Time, bool) {
+	sys, ok := stat.Sys().(*syscall.Win32FileAttributeData)
+	if !ok {
+		return time.Time{}, false
+	}
+	return time.Unix(0, sys.LastAccessTime.Nanoseconds()).UTC(), true
+}
@@ -0,0 +1,137 @@
+package storage
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"strings"
+)
+
+// Parts of the POSIX metadata of local files that syncs can preserve
+const (
+	PreserveMode   = "mode"
+	PreserveOwner  = "owner"
+	PreserveXattrs = "xattrs"
+)
+
+// Preserve selects the POSIX metadata of local files that is read and restored
+type Preserve struct {
+	Mode   bool
+	Owner  bool
+	Xattrs bool
+}
+
+// ParsePreserve parses a comma separated list of PreserveMode, PreserveOwner and PreserveXattrs
+func ParsePreserve(value string) (Preserve, error) {
+	var p Preserve
+	for _, part := range strings.Split(value, ",") {
+		switch strings.TrimSpace(part) {
+		case "":
+		case PreserveMode:
+			p.Mode = true
+		case PreserveOwner:
+			p.Owner = true
+		case PreserveXattrs:
+			p.Xattrs = true
+		default:
+			return Preserve{}, fmt.Errorf("unknown metadata '%s'", strings.TrimSpace(part))
+		}
+	}
+	return p, nil
+}
+
+// Any returns true if any metadata is preserved
+func (p Preserve) Any() bool {
+	return p.Mode || p.Owner || p.Xattrs
+}
+
+// Attributes are the POSIX metadata of a local file
+type Attributes struct {
+	// Mode contains the POSIX permission bits including setuid, setgid and sticky bit, e.g. 0o4755, 0 if unknown
+	Mode uint32
+	// Owner is the numeric owner and group, e.g. "1000:1000", "" if unknown
+	Owner string
+	// Xattrs maps the names of the extended attributes to their values
+	Xattrs map[string][]byte
+}
+
+// Attributes reads the selected metadata of the file. Platforms without owners or extended attributes leave them empty.
+func (s *LocalStorage) Attributes(key string, preserve Preserve) (*Attributes, error) {
+	name, err := s.resolve(key)
+	if err != nil {
+		return nil, err
+	}
+
+	stat, err := os.Stat(name)
+	if err != nil {
+		return nil, toLocalError(err)
+	}
+
+	attrs := &Attributes{}
+	if preserve.Mode {
+		attrs.Mode = posixMode(stat.Mode())
+	}
+	if preserve.Owner {
+		attrs.Owner = fileOwner(stat)
+	}
+	if preserve.Xattrs {
+		if attrs.Xattrs, err = readXattrs(name); err != nil {
+			return nil, fmt.Errorf("failed to read extended attributes of '%s': %w", key, err)
+		}
+	}
+	return attrs, nil
+}
+
+// SetAttributes restores the selected metadata of the file, skipping unknown metadata. Owners can only be restored
+// with sufficient privileges, so permission errors are ignored for them.
+func (s *LocalStorage) SetAttributes(key string, attrs *Attributes, preserve Preserve) error {
+	name, err := s.resolve(key)
+	if err != nil {
+		return err
+	}
+
+	if preserve.Owner && attrs.Owner != "" {
+		// Changing the owner clears the setuid and setgid bits, so it has to happen before restoring the mode
+		if err := chown(name, attrs.Owner); err != nil && !errors.Is(err, fs.ErrPermission) {
+			return fmt.Errorf("failed to restore owner of '%s': %w", key, err)
+		}
+	}
+	if preserve.Mode && attrs.Mode != 0 {
+		if err := os.Chmod(name, fileMode(attrs.Mode)); err != nil {
+			return fmt.Errorf("failed to restore mode of '%s': %w", key, err)
+		}
+	}
+	if preserve.Xattrs && len(attrs.Xattrs) > 0 {
+		if err := writeXattrs(name, attrs.Xattrs); err != nil {
+			return fmt.Errorf("failed to restore extended attributes of '%s': %w", key, err)
+		}
+	}
+	return nil
+}
+
+// specialBits maps the POSIX setuid, setgid and sticky bit to their counterparts of fs.FileMode
+var specialBits = []struct {
+	posix uint32
+	mode  fs.FileMode
+}{{0o4000, fs.ModeSetuid}, {0o2000, fs.ModeSetgid}, {0o1000, fs.ModeSticky}}
+
+func posixMode(mode fs.FileMode) uint32 {
+	posix := uint32(mode.Perm())
+	for _, bit := range specialBits {
+		if mode&bit.mode != 0 {
+			posix |= bit.posix
+		}
+	}
+	return posix
+}
+
+func fileMode(posix uint32) fs.FileMode {
+	mode := fs.FileMode(posix).Perm()
+	for _, bit := range specialBits {
+		if posix&bit.posix != 0 {
+			mode |= bit.mode
+		}
+	}
+	return mode
+}
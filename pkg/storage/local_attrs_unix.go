@@ -0,0 +1,33 @@
+//go:build !windows
+
+package storage
+
+import (
+	"fmt"
+	"io/fs"
+	"os"
+	"strconv"
+	"strings"
+	"syscall"
+)
+
+// fileOwner returns the numeric owner and group of the file
+func fileOwner(stat fs.FileInfo) string {
+	if sys, ok := stat.Sys().(*syscall.Stat_t); ok {
+		return fmt.Sprintf("%d:%d", sys.Uid, sys.Gid)
+	}
+	return ""
+}
+
+func chown(name, owner string) error {
+	u, g, ok := strings.Cut(owner, ":")
+	uid, err := strconv.Atoi(u)
+	if err != nil || !ok {
+		return fmt.Errorf("invalid owner '%s'", owner)
+	}
+	gid, err := strconv.Atoi(g)
+	if err != nil {
+		return fmt.Errorf("invalid owner '%s'", owner)
+	}
+	return os.Chown(name, uid, gid)
+}
@@ -0,0 +1,12 @@
+package storage
+
+import "io/fs"
+
+// fileOwner returns "", since files on Windows are owned by security identifiers instead of numeric IDs
+func fileOwner(stat fs.FileInfo) string {
+	return ""
+}
+
+func chown(name, owner string) error {
+	return nil
+}
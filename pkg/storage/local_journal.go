@@ -0,0 +1,129 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// ErrJournalUnavailable is returned if the filesystem of a local directory has no change journal that can be read,
+// e.g. on filesystems other than NTFS or without the required privileges
+var ErrJournalUnavailable = errors.New("change journal unavailable")
+
+// ErrJournalReset is returned if the changes since a journal position are no longer available,
+// e.g. after the journal was recreated, wrapped around or dropped events
+var ErrJournalReset = errors.New("change journal reset")
+
+// DirChange is a directory of a local storage whose entries changed since a journal position
+type DirChange struct {
+	// Dir is the key of the directory relative to the root, or "" for the root itself
+	Dir string `json:"dir"`
+	// Recursive is set if the directories below may have changed as well, e.g. after they were moved
+	Recursive bool `json:"recursive,omitempty"`
+}
+
+// JournalPosition returns the current position of the change journal of the filesystem, which is passed to
+// Changes to learn the directories changed after it. Returns ErrJournalUnavailable if the filesystem has none.
+func (s *LocalStorage) JournalPosition(ctx context.Context) (string, error) {
+	return journalPosition(ctx, s.realRoot)
+}
+
+// Changes returns the directories below the root changed since the journal position, sorted by key, along with
+// the current position. Returns ErrJournalReset if the changes can't be determined anymore.
+func (s *LocalStorage) Changes(ctx context.Context, position string) ([]DirChange, string, error) {
+	names, next, err := journalChanges(ctx, s.realRoot, position)
+	if err != nil {
+		return nil, "", err
+	}
+
+	dirs := make(map[string]bool)
+	for name, recursive := range names {
+		if key, ok := s.journalKey(name); ok {
+			dirs[key] = dirs[key] || recursive
+		}
+	}
+
+	changes := make([]DirChange, 0, len(dirs))
+	for dir, recursive := range dirs {
+		changes = append(changes, DirChange{Dir: dir, Recursive: recursive})
+	}
+	sort.Slice(changes, func(i, j int) bool {
+		return changes[i].Dir < changes[j].Dir
+	})
+	return changes, next, nil
+}
+
+// journalKey maps the resolved path of a directory reported by the journal to its key,
+// returning false for directories outside of the root
+func (s *LocalStorage) journalKey(name string) (string, bool) {
+	rel, err := filepath.Rel(s.realRoot, filepath.Clean(name))
+	if err != nil || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		return "", false
+	}
+	if rel == "." {
+		return "", true
+	}
+	return s.remoteKey(filepath.ToSlash(rel)), true
+}
+
+// ListDir lists the files directly within the directory, applying the symlink policy like List,
+// and returns the keys of its subdirectories. A missing directory has no entries.
+func (s *LocalStorage) ListDir(ctx context.Context, dir string, fn func(ObjectInfo) error) ([]string, error) {
+	name, err := s.resolve(dir)
+	if err != nil {
+		return nil, err
+	}
+	real, err := filepath.EvalSymlinks(name)
+	if err != nil {
+		if errors.Is(err, fs.ErrNotExist) {
+			return nil, nil
+		}
+		return nil, toLocalError(err)
+	}
+	entries, err := os.ReadDir(real)
+	if err != nil {
+		if errors.Is(err, fs.ErrNotExist) {
+			return nil, nil
+		}
+		return nil, toLocalError(err)
+	}
+
+	prefix := ""
+	if dir != "" {
+		prefix = strings.TrimSuffix(dir, "/") + "/"
+	}
+
+	var dirs []string
+	for _, entry := range entries {
+		if ctx.Err() != nil {
+			return nil, ctx.Err()
+		}
+
+		key := prefix + s.remoteName(entry.Name())
+		switch {
+		case entry.IsDir():
+			dirs = append(dirs, key)
+		case entry.Type()&fs.ModeSymlink != 0:
+			err = s.walkLink(ctx, filepath.Join(name, entry.Name()), key, prefix, []string{real}, fn)
+		case !entry.Type().IsRegular() || strings.HasPrefix(entry.Name(), localTempPrefix):
+			continue
+		default:
+			var stat fs.FileInfo
+			stat, err = entry.Info()
+			if errors.Is(err, fs.ErrNotExist) {
+				continue
+			}
+			if err == nil {
+				err = fn(toLocalObjectInfo(key, stat))
+			}
+		}
+		if err != nil {
+			return nil, toLocalError(err)
+		}
+	}
+	return dirs, nil
+}
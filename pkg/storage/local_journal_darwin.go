@@ -0,0 +1,198 @@
+//go:build darwin && cgo
+
+package storage
+
+/*
+#cgo LDFLAGS: -framework CoreServices
+#include <CoreServices/CoreServices.h>
+#include <dispatch/dispatch.h>
+#include <stdlib.h>
+#include <sys/stat.h>
+
+extern void gosyncFSEvent(uintptr_t handle, char *path, FSEventStreamEventFlags flags, FSEventStreamEventId id);
+
+static void gosyncFSEventCallback(ConstFSEventStreamRef stream, void *info, size_t count, void *paths,
+	const FSEventStreamEventFlags flags[], const FSEventStreamEventId ids[]) {
+	char **names = paths;
+	for (size_t i = 0; i < count; i++) {
+		gosyncFSEvent((uintptr_t)info, names[i], flags[i], ids[i]);
+	}
+}
+
+// gosyncFSEventStream replays the directory-level events of the path since the event ID on the queue
+static FSEventStreamRef gosyncFSEventStream(uintptr_t handle, const char *root, FSEventStreamEventId since, dispatch_queue_t queue) {
+	FSEventStreamContext context = {0, (void *)handle, NULL, NULL, NULL};
+	CFStringRef path = CFStringCreateWithCString(NULL, root, kCFStringEncodingUTF8);
+	CFArrayRef paths = CFArrayCreate(NULL, (const void **)&path, 1, &kCFTypeArrayCallBacks);
+	FSEventStreamRef stream = FSEventStreamCreate(NULL, gosyncFSEventCallback, &context, paths, since, 0, kFSEventStreamCreateFlagNone);
+	CFRelease(paths);
+	CFRelease(path);
+	if (stream == NULL) {
+		return NULL;
+	}
+	FSEventStreamSetDispatchQueue(stream, queue);
+	if (!FSEventStreamStart(stream)) {
+		FSEventStreamInvalidate(stream);
+		FSEventStreamRelease(stream);
+		return NULL;
+	}
+	return stream;
+}
+
+static void gosyncFSEventStreamClose(FSEventStreamRef stream) {
+	FSEventStreamStop(stream);
+	FSEventStreamInvalidate(stream);
+	FSEventStreamRelease(stream);
+}
+
+// gosyncFSEventsUUID copies the UUID of the event database of the device containing the path into uuid
+static int gosyncFSEventsUUID(const char *root, char *uuid, size_t size) {
+	struct stat st;
+	if (stat(root, &st) != 0) {
+		return -1;
+	}
+	CFUUIDRef ref = FSEventsCopyUUIDForDevice(st.st_dev);
+	if (ref == NULL) {
+		return -1;
+	}
+	CFStringRef str = CFUUIDCreateString(NULL, ref);
+	Boolean ok = CFStringGetCString(str, uuid, size, kCFStringEncodingUTF8);
+	CFRelease(str);
+	CFRelease(ref);
+	return ok ? 0 : -1;
+}
+*/
+import "C"
+
+import (
+	"context"
+	"fmt"
+	"runtime/cgo"
+	"strings"
+	"sync"
+	"time"
+	"unsafe"
+)
+
+// fseventsTimeout limits the replay of historical events, which FSEvents delivers asynchronously
+const fseventsTimeout = 5 * time.Minute
+
+// fseventsReplay collects the directories of the events replayed by a stream until the history is done
+type fseventsReplay struct {
+	mutex    sync.Mutex
+	dirs     map[string]bool
+	reset    bool
+	finished bool
+	done     chan struct{}
+}
+
+//export gosyncFSEvent
+func gosyncFSEvent(handle C.uintptr_t, path *C.char, flags C.FSEventStreamEventFlags, id C.FSEventStreamEventId) {
+	replay := cgo.Handle(handle).Value().(*fseventsReplay)
+	replay.mutex.Lock()
+	defer replay.mutex.Unlock()
+
+	// Live events following the history are picked up by the next replay
+	if replay.finished {
+		return
+	}
+	if flags&C.kFSEventStreamEventFlagHistoryDone != 0 {
+		replay.finished = true
+		close(replay.done)
+		return
+	}
+
+	name := strings.TrimSuffix(C.GoString(path), "/")
+	switch {
+	case flags&(C.kFSEventStreamEventFlagRootChanged|C.kFSEventStreamEventFlagEventIdsWrapped) != 0:
+		replay.reset = true
+	case flags&(C.kFSEventStreamEventFlagMustScanSubDirs|C.kFSEventStreamEventFlagMount|C.kFSEventStreamEventFlagUnmount) != 0:
+		// Coalesced or dropped events only name the directory below which anything may have changed
+		replay.dirs[name] = true
+	default:
+		if _, ok := replay.dirs[name]; !ok {
+			replay.dirs[name] = false
+		}
+	}
+}
+
+// fseventsUUID returns the UUID of the event database of the volume, which changes once its event IDs are invalid
+func fseventsUUID(root string) (string, error) {
+	croot := C.CString(root)
+	defer C.free(unsafe.Pointer(croot))
+
+	buf := make([]byte, 64)
+	if C.gosyncFSEventsUUID(croot, (*C.char)(unsafe.Pointer(&buf[0])), C.size_t(len(buf))) != 0 {
+		return "", fmt.Errorf("%w: no event database for '%s'", ErrJournalUnavailable, root)
+	}
+	return C.GoString((*C.char)(unsafe.Pointer(&buf[0]))), nil
+}
+
+// journalPosition returns the UUID of the event database of the volume and its latest event ID
+func journalPosition(ctx context.Context, root string) (string, error) {
+	uuid, err := fseventsUUID(root)
+	if err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("fsevents:%s:%d", uuid, uint64(C.FSEventsGetCurrentEventId())), nil
+}
+
+// journalChanges replays the directory-level events of the root since the position. Events only name directories,
+// so their files are listed again, while dropped or coalesced events return their directory recursively.
+func journalChanges(ctx context.Context, root, position string) (map[string]bool, string, error) {
+	var since uint64
+	uuid, id, ok := strings.Cut(strings.TrimPrefix(position, "fsevents:"), ":")
+	if !ok || !strings.HasPrefix(position, "fsevents:") {
+		return nil, "", fmt.Errorf("%w: invalid position '%s'", ErrJournalReset, position)
+	}
+	if _, err := fmt.Sscanf(id, "%d", &since); err != nil {
+		return nil, "", fmt.Errorf("%w: invalid position '%s'", ErrJournalReset, position)
+	}
+
+	current, err := fseventsUUID(root)
+	if err != nil {
+		return nil, "", err
+	}
+	if current != uuid {
+		return nil, "", fmt.Errorf("%w: event database of the volume was recreated", ErrJournalReset)
+	}
+	next := fmt.Sprintf("fsevents:%s:%d", uuid, uint64(C.FSEventsGetCurrentEventId()))
+
+	replay := &fseventsReplay{dirs: make(map[string]bool), done: make(chan struct{})}
+	handle := cgo.NewHandle(replay)
+	defer handle.Delete()
+
+	croot := C.CString(root)
+	defer C.free(unsafe.Pointer(croot))
+	label := C.CString("gosync.fsevents")
+	defer C.free(unsafe.Pointer(label))
+
+	// Events are delivered on a serial queue until the stream is closed
+	queue := C.dispatch_queue_create(label, nil)
+	defer C.dispatch_release(queue)
+	stream := C.gosyncFSEventStream(C.uintptr_t(handle), croot, C.FSEventStreamEventId(since), queue)
+	if stream == nil {
+		return nil, "", fmt.Errorf("%w: unable to create event stream for '%s'", ErrJournalUnavailable, root)
+	}
+
+	timer := time.NewTimer(fseventsTimeout)
+	defer timer.Stop()
+
+	select {
+	case <-replay.done:
+		C.gosyncFSEventStreamClose(stream)
+	case <-ctx.Done():
+		C.gosyncFSEventStreamClose(stream)
+		return nil, "", ctx.Err()
+	case <-timer.C:
+		C.gosyncFSEventStreamClose(stream)
+		return nil, "", fmt.Errorf("%w: replaying events timed out", ErrJournalReset)
+	}
+
+	replay.mutex.Lock()
+	defer replay.mutex.Unlock()
+	if replay.reset {
+		return nil, "", fmt.Errorf("%w: root was moved or event IDs wrapped around", ErrJournalReset)
+	}
+	return replay.dirs, next, nil
+}
@@ -0,0 +1,14 @@
+//go:build !windows && !(darwin && cgo)
+
+package storage
+
+import "context"
+
+// journalPosition always fails, since change journals are only read on Windows and on macOS with cgo
+func journalPosition(ctx context.Context, root string) (string, error) {
+	return "", ErrJournalUnavailable
+}
+
+func journalChanges(ctx context.Context, root, position string) (map[string]bool, string, error) {
+	return nil, "", ErrJournalUnavailable
+}
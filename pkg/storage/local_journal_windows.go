@@ -0,0 +1,298 @@
+package storage
+
+import (
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"path/filepath"
+	"strings"
+	"unsafe"
+
+	"golang.org/x/sys/windows"
+)
+
+// Control codes and reasons of the NTFS update sequence number (USN) change journal
+const (
+	fsctlQueryUsnJournal = 0x000900f4
+	fsctlReadUsnJournal  = 0x000900bb
+
+	usnReasonFileCreate    = 0x00000100
+	usnReasonFileDelete    = 0x00000200
+	usnReasonRenameOldName = 0x00001000
+	usnReasonRenameNewName = 0x00002000
+)
+
+// usnBufferSize is the size of the buffer records of the journal are read into
+const usnBufferSize = 64 << 10
+
+var procOpenFileById = windows.NewLazySystemDLL("kernel32.dll").NewProc("OpenFileById")
+
+// usnJournalData is USN_JOURNAL_DATA_V0
+type usnJournalData struct {
+	JournalID       uint64
+	FirstUsn        int64
+	NextUsn         int64
+	LowestValidUsn  int64
+	MaxUsn          int64
+	MaximumSize     uint64
+	AllocationDelta uint64
+}
+
+// readUsnJournalData is READ_USN_JOURNAL_DATA_V0, which returns USN_RECORD_V2 records
+type readUsnJournalData struct {
+	StartUsn          int64
+	ReasonMask        uint32
+	ReturnOnlyOnClose uint32
+	Timeout           uint64
+	BytesToWaitFor    uint64
+	JournalID         uint64
+}
+
+// fileIDDescriptor is FILE_ID_DESCRIPTOR with the 64-bit file reference numbers of NTFS
+type fileIDDescriptor struct {
+	Size   uint32
+	Type   uint32
+	FileID uint64
+	_      uint64
+}
+
+// usnRecord is the part of a USN_RECORD_V2 required to find the changed directories
+type usnRecord struct {
+	file      uint64
+	parent    uint64
+	reason    uint32
+	directory bool
+	name      string
+}
+
+// usnVolume is an open handle to the volume of a local directory
+type usnVolume struct {
+	handle windows.Handle
+}
+
+func openUsnVolume(root string) (*usnVolume, error) {
+	name, err := windows.UTF16PtrFromString(longPath(root))
+	if err != nil {
+		return nil, err
+	}
+	buf := make([]uint16, windows.MAX_PATH+1)
+	if err := windows.GetVolumePathName(name, &buf[0], uint32(len(buf))); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrJournalUnavailable, err)
+	}
+
+	// Volumes are opened by their device name, e.g. \\.\C:
+	volume := strings.TrimSuffix(windows.UTF16ToString(buf), `\`)
+	if len(volume) != 2 || volume[1] != ':' {
+		return nil, fmt.Errorf("%w: '%s' isn't a local volume", ErrJournalUnavailable, volume)
+	}
+	device, err := windows.UTF16PtrFromString(`\\.\` + volume)
+	if err != nil {
+		return nil, err
+	}
+	handle, err := windows.CreateFile(device, windows.GENERIC_READ, windows.FILE_SHARE_READ|windows.FILE_SHARE_WRITE,
+		nil, windows.OPEN_EXISTING, 0, 0)
+	if err != nil {
+		// Reading the journal requires administrative privileges
+		return nil, fmt.Errorf("%w: %v", ErrJournalUnavailable, err)
+	}
+	return &usnVolume{handle: handle}, nil
+}
+
+func (v *usnVolume) close() {
+	windows.CloseHandle(v.handle)
+}
+
+func (v *usnVolume) query() (*usnJournalData, error) {
+	var data usnJournalData
+	var returned uint32
+	err := windows.DeviceIoControl(v.handle, fsctlQueryUsnJournal, nil, 0,
+		(*byte)(unsafe.Pointer(&data)), uint32(unsafe.Sizeof(data)), &returned, nil)
+	if err != nil {
+		// Filesystems other than NTFS and volumes without an active journal
+		return nil, fmt.Errorf("%w: %v", ErrJournalUnavailable, err)
+	}
+	return &data, nil
+}
+
+// read returns all records from the start up to the end of the journal at the time it was queried
+func (v *usnVolume) read(ctx context.Context, journal *usnJournalData, start int64) ([]usnRecord, error) {
+	var records []usnRecord
+	buf := make([]byte, usnBufferSize)
+
+	for start < journal.NextUsn {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+
+		input := readUsnJournalData{
+			StartUsn:   start,
+			ReasonMask: 0xffffffff,
+			JournalID:  journal.JournalID,
+		}
+		var returned uint32
+		err := windows.DeviceIoControl(v.handle, fsctlReadUsnJournal, (*byte)(unsafe.Pointer(&input)), uint32(unsafe.Sizeof(input)),
+			&buf[0], uint32(len(buf)), &returned, nil)
+		switch {
+		case errors.Is(err, windows.ERROR_JOURNAL_ENTRY_DELETED), errors.Is(err, windows.ERROR_JOURNAL_NOT_ACTIVE):
+			return nil, fmt.Errorf("%w: %v", ErrJournalReset, err)
+		case errors.Is(err, windows.ERROR_HANDLE_EOF):
+			return records, nil
+		case err != nil:
+			return nil, err
+		}
+		if returned <= 8 {
+			return records, nil
+		}
+
+		start = int64(binary.LittleEndian.Uint64(buf))
+		for offset := uint32(8); offset+60 <= returned; {
+			record := buf[offset:returned]
+			length := binary.LittleEndian.Uint32(record)
+			if length < 60 || length > uint32(len(record)) {
+				return nil, fmt.Errorf("invalid journal record of %d bytes", length)
+			}
+			if major := binary.LittleEndian.Uint16(record[4:]); major != 2 {
+				return nil, fmt.Errorf("%w: unsupported journal record version %d", ErrJournalUnavailable, major)
+			}
+
+			nameLength := uint32(binary.LittleEndian.Uint16(record[56:]))
+			nameOffset := uint32(binary.LittleEndian.Uint16(record[58:]))
+			if nameOffset+nameLength > length {
+				return nil, fmt.Errorf("invalid journal record name")
+			}
+			name := make([]uint16, nameLength/2)
+			for i := range name {
+				name[i] = binary.LittleEndian.Uint16(record[nameOffset+uint32(i)*2:])
+			}
+
+			records = append(records, usnRecord{
+				file:      binary.LittleEndian.Uint64(record[8:]),
+				parent:    binary.LittleEndian.Uint64(record[16:]),
+				reason:    binary.LittleEndian.Uint32(record[40:]),
+				directory: binary.LittleEndian.Uint32(record[52:])&windows.FILE_ATTRIBUTE_DIRECTORY != 0,
+				name:      windows.UTF16ToString(name),
+			})
+			offset += length
+		}
+	}
+	return records, nil
+}
+
+// path returns the current path of the file with the reference number, or "" if it doesn't exist anymore
+func (v *usnVolume) path(id uint64) (string, error) {
+	desc := fileIDDescriptor{Size: uint32(unsafe.Sizeof(fileIDDescriptor{})), FileID: id}
+	r, _, err := procOpenFileById.Call(uintptr(v.handle), uintptr(unsafe.Pointer(&desc)), 0,
+		windows.FILE_SHARE_READ|windows.FILE_SHARE_WRITE|windows.FILE_SHARE_DELETE, 0, windows.FILE_FLAG_BACKUP_SEMANTICS)
+	handle := windows.Handle(r)
+	if handle == windows.InvalidHandle {
+		if errors.Is(err, windows.ERROR_INVALID_PARAMETER) || errors.Is(err, windows.ERROR_FILE_NOT_FOUND) {
+			return "", nil
+		}
+		return "", err
+	}
+	defer windows.CloseHandle(handle)
+
+	buf := make([]uint16, windows.MAX_LONG_PATH)
+	n, err := windows.GetFinalPathNameByHandle(handle, &buf[0], uint32(len(buf)), 0)
+	if err != nil {
+		return "", err
+	}
+	return shortPath(windows.UTF16ToString(buf[:n])), nil
+}
+
+// journalPosition returns the ID of the USN journal of the volume and its next USN
+func journalPosition(ctx context.Context, root string) (string, error) {
+	volume, err := openUsnVolume(root)
+	if err != nil {
+		return "", err
+	}
+	defer volume.close()
+
+	journal, err := volume.query()
+	if err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("usn:%x:%d", journal.JournalID, journal.NextUsn), nil
+}
+
+// journalChanges reads all records of the USN journal since the position and returns the parent directories of all
+// changed files. Directories that were created, deleted or renamed are returned recursively, since the records of
+// their content don't reflect the move. Records are volume-wide, directories outside of the root are filtered later.
+func journalChanges(ctx context.Context, root, position string) (map[string]bool, string, error) {
+	var journalID uint64
+	var start int64
+	if _, err := fmt.Sscanf(position, "usn:%x:%d", &journalID, &start); err != nil {
+		return nil, "", fmt.Errorf("%w: invalid position '%s'", ErrJournalReset, position)
+	}
+
+	volume, err := openUsnVolume(root)
+	if err != nil {
+		return nil, "", err
+	}
+	defer volume.close()
+
+	journal, err := volume.query()
+	if err != nil {
+		return nil, "", err
+	}
+	if journal.JournalID != journalID || start < journal.LowestValidUsn || start > journal.NextUsn {
+		return nil, "", fmt.Errorf("%w: journal was recreated or wrapped around", ErrJournalReset)
+	}
+
+	records, err := volume.read(ctx, journal, start)
+	if err != nil {
+		return nil, "", err
+	}
+
+	// Directories that were deleted since can't be opened by their reference number anymore,
+	// so their last known name and parent is taken from their own records
+	known := make(map[uint64]usnRecord)
+	for _, record := range records {
+		if record.directory {
+			known[record.file] = record
+		}
+	}
+
+	paths := make(map[uint64]string)
+	var resolve func(id uint64, depth int) (string, error)
+	resolve = func(id uint64, depth int) (string, error) {
+		if p, ok := paths[id]; ok {
+			return p, nil
+		}
+		p, err := volume.path(id)
+		if err != nil {
+			return "", err
+		}
+		if p == "" {
+			record, ok := known[id]
+			if !ok || depth > 256 {
+				return "", fmt.Errorf("%w: unable to resolve file reference %x", ErrJournalReset, id)
+			}
+			parent, err := resolve(record.parent, depth+1)
+			if err != nil {
+				return "", err
+			}
+			p = filepath.Join(parent, record.name)
+		}
+		paths[id] = p
+		return p, nil
+	}
+
+	dirs := make(map[string]bool)
+	for _, record := range records {
+		parent, err := resolve(record.parent, 0)
+		if err != nil {
+			return nil, "", err
+		}
+		if _, ok := dirs[parent]; !ok {
+			dirs[parent] = false
+		}
+
+		if record.directory && record.reason&(usnReasonFileCreate|usnReasonFileDelete|usnReasonRenameOldName|usnReasonRenameNewName) != 0 {
+			dirs[filepath.Join(parent, record.name)] = true
+		}
+	}
+
+	return dirs, fmt.Sprintf("usn:%x:%d", journal.JournalID, journal.NextUsn), nil
+}
@@ -0,0 +1,236 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// Policies for symbolic links within local directories
+const (
+	// SymlinkSkip ignores symbolic links
+	SymlinkSkip = "skip"
+	// SymlinkFollow lists links as the file or directory they point to, except for links looping back into a parent
+	SymlinkFollow = "follow"
+	// SymlinkPreserve lists links as objects containing their target, with SymlinkSuffix appended to their key
+	SymlinkPreserve = "preserve"
+)
+
+// SymlinkSuffix marks objects containing the target of a preserved symbolic link, e.g. "docs/latest.gosync-symlink"
+const SymlinkSuffix = ".gosync-symlink"
+
+// symlinkContentType is the content type of preserved symbolic links
+const symlinkContentType = "inode/symlink"
+
+// maxLinkTarget limits the length of targets restored from preserved symbolic links
+const maxLinkTarget = 4096
+
+// SkippedLink describes a symbolic link that wasn't listed
+type SkippedLink struct {
+	Key    string `json:"key"`
+	Target string `json:"target"`
+	Reason string `json:"reason"`
+}
+
+// SetSymlinks sets the policy for symbolic links. skipped is called for links skipped by the policy,
+// dangling links and links looping back into a followed directory (optional).
+func (s *LocalStorage) SetSymlinks(policy string, skipped func(SkippedLink)) {
+	s.symlinks = policy
+	s.skipped = skipped
+}
+
+// walkLink lists the symbolic link according to the policy of the storage
+func (s *LocalStorage) walkLink(ctx context.Context, name, key, prefix string, ancestors []string, fn func(ObjectInfo) error) error {
+	target, err := os.Readlink(name)
+	if err != nil {
+		if errors.Is(err, fs.ErrNotExist) {
+			return nil
+		}
+		return err
+	}
+
+	switch s.symlinks {
+	case SymlinkPreserve:
+		key += SymlinkSuffix
+		if !strings.HasPrefix(key, prefix) {
+			return nil
+		}
+		info, err := s.statLink(key)
+		if errors.Is(err, ErrObjectNotFound) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		return fn(*info)
+
+	case SymlinkFollow:
+		stat, err := os.Stat(name)
+		if errors.Is(err, fs.ErrNotExist) {
+			s.skip(key, target, "dangling link")
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+
+		if !stat.IsDir() {
+			if !stat.Mode().IsRegular() || !strings.HasPrefix(key, prefix) {
+				return nil
+			}
+			return fn(toLocalObjectInfo(key, stat))
+		}
+
+		real, err := filepath.EvalSymlinks(name)
+		if err != nil {
+			return err
+		}
+		for _, ancestor := range ancestors {
+			if withinPath(ancestor, real) {
+				s.skip(key, target, "link loops back into a parent directory")
+				return nil
+			}
+		}
+		return s.walk(ctx, name, prefix, append(ancestors, real), fn)
+
+	default:
+		s.skip(key, target, "symbolic link")
+		return nil
+	}
+}
+
+func (s *LocalStorage) skip(key, target, reason string) {
+	if s.skipped != nil {
+		s.skipped(SkippedLink{Key: key, Target: target, Reason: reason})
+	}
+}
+
+// IsLink returns true if the key refers to a preserved symbolic link instead of a file
+func (s *LocalStorage) IsLink(key string) bool {
+	return s.linkSuffix(key) != ""
+}
+
+// linkSuffix returns the suffix of keys referring to preserved symbolic links, "" for all other keys
+func (s *LocalStorage) linkSuffix(key string) string {
+	if s.symlinks == SymlinkPreserve && strings.HasSuffix(key, SymlinkSuffix) {
+		return SymlinkSuffix
+	}
+	return ""
+}
+
+func (s *LocalStorage) statLink(key string) (*ObjectInfo, error) {
+	name, err := s.resolve(strings.TrimSuffix(key, SymlinkSuffix))
+	if err != nil {
+		return nil, err
+	}
+
+	stat, err := os.Lstat(name)
+	if err != nil {
+		return nil, toLocalError(err)
+	}
+	if stat.Mode()&fs.ModeSymlink == 0 {
+		return nil, fmt.Errorf("%w: '%s' is no symbolic link", ErrObjectNotFound, key)
+	}
+	target, err := os.Readlink(name)
+	if err != nil {
+		return nil, toLocalError(err)
+	}
+
+	return &ObjectInfo{
+		Key:          key,
+		Size:         int64(len(target)),
+		ETag:         localETag(stat),
+		ContentType:  symlinkContentType,
+		LastModified: stat.ModTime().UTC(),
+	}, nil
+}
+
+func (s *LocalStorage) getLink(key string) (io.ReadCloser, error) {
+	name, err := s.resolve(strings.TrimSuffix(key, SymlinkSuffix))
+	if err != nil {
+		return nil, err
+	}
+
+	target, err := os.Readlink(name)
+	if err != nil {
+		return nil, toLocalError(err)
+	}
+	return io.NopCloser(strings.NewReader(target)), nil
+}
+
+// putLink restores the symbolic link with the target read from the reader, replacing the file or link at its path
+func (s *LocalStorage) putLink(ctx context.Context, key string, reader io.Reader, opts PutOptions) (*ObjectInfo, error) {
+	data, err := io.ReadAll(io.LimitReader(contextReader{ctx: ctx, reader: reader}, maxLinkTarget+1))
+	if err != nil {
+		return nil, fmt.Errorf("failed to read target of '%s': %w", key, err)
+	}
+	if len(data) == 0 || len(data) > maxLinkTarget {
+		return nil, fmt.Errorf("invalid target of symbolic link '%s'", key)
+	}
+
+	name, err := s.resolve(strings.TrimSuffix(key, SymlinkSuffix))
+	if err != nil {
+		return nil, err
+	}
+	if err := os.MkdirAll(filepath.Dir(name), 0755); err != nil {
+		return nil, fmt.Errorf("failed to create directory for '%s': %w", key, err)
+	}
+	if err := s.checkParent(name, key); err != nil {
+		return nil, err
+	}
+
+	// Create the link under a temporary name first, so it replaces an existing file or link atomically
+	temp, err := os.CreateTemp(filepath.Dir(name), localTempPrefix+"*")
+	if err != nil {
+		return nil, fmt.Errorf("failed to create temporary link for '%s': %w", key, err)
+	}
+	temp.Close()
+	os.Remove(temp.Name())
+
+	if err := os.Symlink(string(data), temp.Name()); err != nil {
+		return nil, fmt.Errorf("failed to create symbolic link '%s': %w", key, err)
+	}
+	defer os.Remove(temp.Name())
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if err := s.checkPrecondition(name, key, true, opts); err != nil {
+		return nil, err
+	}
+	if err := os.Rename(temp.Name(), name); err != nil {
+		return nil, fmt.Errorf("failed to write '%s': %w", key, err)
+	}
+
+	return s.statLink(key)
+}
+
+// checkParent prevents writes and deletions through symbolic links to directories outside of the root,
+// unless links are followed, e.g. after a preserved link was restored in place of a directory
+func (s *LocalStorage) checkParent(name, key string) error {
+	if s.symlinks == SymlinkFollow {
+		return nil
+	}
+
+	real, err := filepath.EvalSymlinks(filepath.Dir(name))
+	if err != nil {
+		if errors.Is(err, fs.ErrNotExist) {
+			return nil
+		}
+		return toLocalError(err)
+	}
+	if !withinPath(real, s.realRoot) {
+		return fmt.Errorf("invalid key '%s': parent directory is a symbolic link outside of local directory", key)
+	}
+	return nil
+}
+
+// withinPath returns true if the path is the directory or within it
+func withinPath(p, dir string) bool {
+	return p == dir || strings.HasPrefix(p, strings.TrimSuffix(dir, string(filepath.Separator))+string(filepath.Separator))
+}
@@ -0,0 +1,164 @@
+package storage
+
+import (
+	"fmt"
+	"runtime"
+	"strings"
+)
+
+// Policies for names Windows doesn't allow within local directories, while other systems and object stores do,
+// i.e. reserved device names like "CON" or "NUL", names ending with a dot or space and characters like ':' or '?'
+const (
+	// ReservedEscape replaces the offending characters with similar looking Unicode characters, which are replaced
+	// back when the directory is listed, e.g. "notes?.txt" is stored as "notes？.txt"
+	ReservedEscape = "escape"
+	// ReservedError fails to write such names
+	ReservedError = "error"
+)
+
+// windowsNames is set if names of local directories are restricted by Windows
+const windowsNames = runtime.GOOS == "windows"
+
+// escapeQuote is prepended to characters of names that would otherwise be mistaken for escaped characters,
+// and appended to reserved device names
+const escapeQuote = '‛'
+
+// escapedRunes maps the characters Windows doesn't allow within names to their replacements. Dots and spaces are
+// only replaced at the end of names, control characters are replaced by their control pictures (U+2400 block).
+var escapedRunes = map[rune]rune{
+	'<': '＜', '>': '＞', ':': '：', '"': '＂', '\\': '＼', '|': '｜', '?': '？', '*': '＊', '.': '．', ' ': '␠',
+}
+
+var unescapedRunes = func() map[rune]rune {
+	m := make(map[rune]rune, len(escapedRunes)+0x20)
+	for r, escaped := range escapedRunes {
+		m[escaped] = r
+	}
+	for r := rune(1); r < 0x20; r++ {
+		m[0x2400+r] = r
+	}
+	return m
+}()
+
+// reservedNames are the device names Windows reserves regardless of their extension
+var reservedNames = map[string]bool{
+	"CON": true, "PRN": true, "AUX": true, "NUL": true,
+	"COM1": true, "COM2": true, "COM3": true, "COM4": true, "COM5": true, "COM6": true, "COM7": true, "COM8": true, "COM9": true,
+	"LPT1": true, "LPT2": true, "LPT3": true, "LPT4": true, "LPT5": true, "LPT6": true, "LPT7": true, "LPT8": true, "LPT9": true,
+}
+
+// SetReservedNames sets the policy for names Windows doesn't allow, which has no effect on other systems
+func (s *LocalStorage) SetReservedNames(policy string) {
+	s.reserved = policy
+}
+
+// localKey returns the key as it is stored within the directory according to the policy for reserved names
+func (s *LocalStorage) localKey(key string) (string, error) {
+	if !windowsNames || s.reserved == "" {
+		return key, nil
+	}
+
+	parts := strings.Split(key, "/")
+	for i, part := range parts {
+		escaped := EscapeName(part)
+		if escaped == part {
+			continue
+		}
+		if s.reserved == ReservedError {
+			return "", fmt.Errorf("invalid key '%s': name '%s' isn't allowed on Windows", key, part)
+		}
+		parts[i] = escaped
+	}
+	return strings.Join(parts, "/"), nil
+}
+
+// remoteName returns the name of an entry of the directory as it is used within keys
+func (s *LocalStorage) remoteName(name string) string {
+	if !windowsNames || s.reserved != ReservedEscape {
+		return name
+	}
+	return UnescapeName(name)
+}
+
+// remoteKey returns the key of a path relative to the directory, with all of its names unescaped
+func (s *LocalStorage) remoteKey(rel string) string {
+	if !windowsNames || s.reserved != ReservedEscape {
+		return rel
+	}
+
+	parts := strings.Split(rel, "/")
+	for i, part := range parts {
+		parts[i] = UnescapeName(part)
+	}
+	return strings.Join(parts, "/")
+}
+
+// EscapeName returns the name with all characters Windows doesn't allow replaced, or the name itself if it is allowed
+// and contains no characters that would be mistaken for replacements
+func EscapeName(name string) string {
+	runes := []rune(name)
+
+	// Windows strips dots and spaces from the end of names
+	trailing := len(runes)
+	for trailing > 0 && (runes[trailing-1] == '.' || runes[trailing-1] == ' ') {
+		trailing--
+	}
+
+	var b strings.Builder
+	for i, r := range runes {
+		_, replacement := unescapedRunes[r]
+		switch {
+		case r == escapeQuote || replacement:
+			b.WriteRune(escapeQuote)
+			b.WriteRune(r)
+		case r < 0x20:
+			b.WriteRune(0x2400 + r)
+		case (r == '.' || r == ' ') && i < trailing:
+			b.WriteRune(r)
+		case escapedRunes[r] != 0:
+			b.WriteRune(escapedRunes[r])
+		default:
+			b.WriteRune(r)
+		}
+	}
+	escaped := b.String()
+
+	// Device names are reserved with any extension and spaces before it, e.g. "con .txt"
+	stem, _, _ := strings.Cut(escaped, ".")
+	stem = strings.TrimRight(stem, " ")
+	if reservedNames[strings.ToUpper(stem)] {
+		escaped = stem + string(escapeQuote) + escaped[len(stem):]
+	}
+	return escaped
+}
+
+// UnescapeName reverses EscapeName
+func UnescapeName(name string) string {
+	if !strings.ContainsFunc(name, func(r rune) bool {
+		_, ok := unescapedRunes[r]
+		return ok || r == escapeQuote
+	}) {
+		return name
+	}
+
+	runes := []rune(name)
+	var b strings.Builder
+	for i := 0; i < len(runes); i++ {
+		r := runes[i]
+		if r == escapeQuote {
+			// Quoted characters are kept, other quotes only mark reserved device names
+			if i+1 < len(runes) {
+				if _, ok := unescapedRunes[runes[i+1]]; ok || runes[i+1] == escapeQuote {
+					b.WriteRune(runes[i+1])
+					i++
+				}
+			}
+			continue
+		}
+		if original, ok := unescapedRunes[r]; ok {
+			r = original
+		}
+		b.WriteRune(r)
+	}
+	return b.String()
+}
@@ -0,0 +1,27 @@
+package storage
+
+import (
+	"path/filepath"
+	"strings"
+)
+
+// longPath returns the absolute path with the \\?\ prefix, which lifts the MAX_PATH limit of Windows API calls
+// made directly instead of through the os package, which adds the prefix itself
+func longPath(name string) string {
+	switch {
+	case !filepath.IsAbs(name) || strings.HasPrefix(name, `\\?\`):
+		return name
+	case strings.HasPrefix(name, `\\`):
+		return `\\?\UNC\` + name[2:]
+	default:
+		return `\\?\` + name
+	}
+}
+
+// shortPath removes the \\?\ prefix from paths returned by the Windows API
+func shortPath(name string) string {
+	if rest, ok := strings.CutPrefix(name, `\\?\UNC\`); ok {
+		return `\\` + rest
+	}
+	return strings.TrimPrefix(name, `\\?\`)
+}
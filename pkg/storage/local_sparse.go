@@ -0,0 +1,129 @@
+package storage
+
+import (
+	"fmt"
+	"io"
+	"os"
+)
+
+// maxSparseExtents limits the data extents of sparse maps, more fragmented files are treated as dense
+const maxSparseExtents = 4096
+
+// Extent is a range of a file
+type Extent struct {
+	Offset int64 `json:"offset"`
+	Length int64 `json:"length"`
+}
+
+// SparseMap lists the data extents of a sparse file in ascending order, all other ranges up to its size are holes
+type SparseMap struct {
+	Data []Extent `json:"data"`
+}
+
+// SparseMap returns the data extents of the file, or nil if it has no holes or the platform can't detect them
+func (s *LocalStorage) SparseMap(key string) (*SparseMap, error) {
+	if s.IsLink(key) {
+		return nil, nil
+	}
+
+	name, err := s.resolve(key)
+	if err != nil {
+		return nil, err
+	}
+
+	file, err := os.Open(name)
+	if err != nil {
+		return nil, toLocalError(err)
+	}
+	defer file.Close()
+
+	stat, err := file.Stat()
+	if err != nil {
+		return nil, toLocalError(err)
+	}
+	if stat.Size() == 0 {
+		return nil, nil
+	}
+
+	data, err := dataExtents(file, stat.Size())
+	if err != nil {
+		return nil, fmt.Errorf("failed to detect holes of '%s': %w", key, err)
+	}
+	if data == nil || len(data) > maxSparseExtents {
+		return nil, nil
+	}
+	if len(data) == 1 && data[0].Offset == 0 && data[0].Length == stat.Size() {
+		return nil, nil
+	}
+	return &SparseMap{Data: data}, nil
+}
+
+// writeFile copies the content into the file, skipping the holes of the sparse map if set
+func writeFile(file *os.File, reader io.Reader, sparse *SparseMap) error {
+	if sparse == nil {
+		_, err := io.Copy(file, reader)
+		return err
+	}
+
+	w := &sparseWriter{file: file, data: sparse.Data}
+	if _, err := io.Copy(w, reader); err != nil {
+		return err
+	}
+	return w.close()
+}
+
+// sparseWriter writes a file sequentially, skipping blocks of zeros within the holes of its sparse map,
+// so the filesystem doesn't allocate them. Non-zero content within holes of an outdated map is still written.
+type sparseWriter struct {
+	file   *os.File
+	data   []Extent
+	next   int
+	offset int64
+}
+
+func (w *sparseWriter) Write(p []byte) (int, error) {
+	written := 0
+	for written < len(p) {
+		hole, length := w.segment(int64(len(p) - written))
+		chunk := p[written : written+int(length)]
+
+		if !hole || !isZero(chunk) {
+			if _, err := w.file.WriteAt(chunk, w.offset); err != nil {
+				return written, err
+			}
+		}
+		w.offset += length
+		written += int(length)
+	}
+	return written, nil
+}
+
+// segment returns whether the current offset is within a hole and the length until the next boundary, at most limit
+func (w *sparseWriter) segment(limit int64) (bool, int64) {
+	for w.next < len(w.data) && w.data[w.next].Offset+w.data[w.next].Length <= w.offset {
+		w.next++
+	}
+	if w.next == len(w.data) {
+		return true, limit
+	}
+
+	extent := w.data[w.next]
+	if extent.Offset <= w.offset {
+		return false, min(limit, extent.Offset+extent.Length-w.offset)
+	}
+	return true, min(limit, extent.Offset-w.offset)
+}
+
+// close extends the file to its full size, since trailing holes were never written
+func (w *sparseWriter) close() error {
+	return w.file.Truncate(w.offset)
+}
+
+func isZero(p []byte) bool {
+	for _, b := range p {
+		if b != 0 {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,10 @@
+//go:build !(linux || darwin || freebsd)
+
+package storage
+
+import "os"
+
+// dataExtents returns no extents, since holes can only be detected on Linux, macOS and FreeBSD
+func dataExtents(file *os.File, size int64) ([]Extent, error) {
+	return nil, nil
+}
@@ -0,0 +1,42 @@
+//go:build linux || darwin || freebsd
+
+package storage
+
+import (
+	"errors"
+	"os"
+
+	"golang.org/x/sys/unix"
+)
+
+// dataExtents returns the data extents of the file using SEEK_DATA and SEEK_HOLE, or nil if the filesystem
+// doesn't support them. Filesystems without holes report the whole file as a single extent.
+func dataExtents(file *os.File, size int64) ([]Extent, error) {
+	extents := []Extent{}
+	for offset := int64(0); offset < size; {
+		start, err := file.Seek(offset, unix.SEEK_DATA)
+		if errors.Is(err, unix.ENXIO) {
+			// No data follows the offset, so the rest of the file is a hole
+			break
+		}
+		if errors.Is(err, unix.EINVAL) || errors.Is(err, unix.ENOTSUP) {
+			return nil, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		end, err := file.Seek(start, unix.SEEK_HOLE)
+		if err != nil {
+			return nil, err
+		}
+		end = min(end, size)
+
+		extents = append(extents, Extent{Offset: start, Length: end - start})
+		if len(extents) > maxSparseExtents {
+			break
+		}
+		offset = end
+	}
+	return extents, nil
+}
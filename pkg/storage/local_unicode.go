@@ -0,0 +1,101 @@
+package storage
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"unicode/utf8"
+
+	"golang.org/x/text/unicode/norm"
+)
+
+// Unicode normalization of paths, since e.g. macOS stores names decomposed (NFD) while other systems and most
+// object stores keep the composed form (NFC) they were created with
+const (
+	// NormalizationNFC compares paths in their composed form and writes new names composed
+	NormalizationNFC = "nfc"
+	// NormalizationNFD compares paths in their composed form and writes new names decomposed
+	NormalizationNFD = "nfd"
+	// NormalizationNone compares and writes paths byte by byte
+	NormalizationNone = "none"
+)
+
+// NormalizePath returns the form of the path compared across storages, which is NFC unless the policy is none
+func NormalizePath(policy, p string) string {
+	if policy == NormalizationNone || isASCII(p) {
+		return p
+	}
+	return norm.NFC.String(p)
+}
+
+// WritePath returns the form new objects of the path are written with according to the policy
+func WritePath(policy, p string) string {
+	if policy != NormalizationNFD || isASCII(p) {
+		return p
+	}
+	return norm.NFD.String(p)
+}
+
+// SetNormalization sets the Unicode normalization policy of the storage. Unless it is none or empty, keys refer to
+// existing files whose names only differ in their normalization, and missing names are created in the policy's form.
+func (s *LocalStorage) SetNormalization(policy string) {
+	s.normalization = policy
+}
+
+// matchName returns the path of the key below the root, matching each missing component to an existing entry of
+// its directory with the same normalized name
+func (s *LocalStorage) matchName(key string) string {
+	name := s.root
+	parts := strings.Split(key, "/")
+	for i, part := range parts {
+		if part == "" || part == "." {
+			continue
+		}
+
+		next := filepath.Join(name, part)
+		if isASCII(part) {
+			name = next
+			continue
+		}
+		if _, err := os.Lstat(next); err == nil {
+			name = next
+			continue
+		}
+		if entry := matchEntry(name, part); entry != "" {
+			name = filepath.Join(name, entry)
+			continue
+		}
+
+		// Neither the component nor anything below it exists yet
+		for _, rest := range parts[i:] {
+			name = filepath.Join(name, WritePath(s.normalization, rest))
+		}
+		return name
+	}
+	return name
+}
+
+// matchEntry returns the name of the entry of the directory equal to the name once both are normalized
+func matchEntry(dir, name string) string {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return ""
+	}
+
+	want := norm.NFC.String(name)
+	for _, entry := range entries {
+		if norm.NFC.String(entry.Name()) == want {
+			return entry.Name()
+		}
+	}
+	return ""
+}
+
+func isASCII(s string) bool {
+	for i := 0; i < len(s); i++ {
+		if s[i] >= utf8.RuneSelf {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,56 @@
+package storage
+
+import (
+	"errors"
+	"strings"
+
+	"golang.org/x/sys/unix"
+)
+
+// xattrNamespace limits the preserved extended attributes to those of users, since the security and system
+// namespaces hold ACLs and labels that only make sense on the host they were set on
+const xattrNamespace = "user."
+
+// readXattrs returns the extended attributes of the user namespace, or none if the filesystem doesn't support them
+func readXattrs(name string) (map[string][]byte, error) {
+	size, err := unix.Listxattr(name, nil)
+	if err != nil || size == 0 {
+		if errors.Is(err, unix.ENOTSUP) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	buf := make([]byte, size)
+	if size, err = unix.Listxattr(name, buf); err != nil {
+		return nil, err
+	}
+
+	xattrs := make(map[string][]byte)
+	for _, attr := range strings.Split(strings.TrimRight(string(buf[:size]), "\x00"), "\x00") {
+		if !strings.HasPrefix(attr, xattrNamespace) {
+			continue
+		}
+		size, err := unix.Getxattr(name, attr, nil)
+		if err != nil {
+			return nil, err
+		}
+		value := make([]byte, size)
+		if size, err = unix.Getxattr(name, attr, value); err != nil {
+			return nil, err
+		}
+		xattrs[attr] = value[:size]
+	}
+	return xattrs, nil
+}
+
+func writeXattrs(name string, xattrs map[string][]byte) error {
+	for attr, value := range xattrs {
+		if !strings.HasPrefix(attr, xattrNamespace) {
+			continue
+		}
+		if err := unix.Setxattr(name, attr, value, 0); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,12 @@
+//go:build !linux
+
+package storage
+
+// readXattrs returns no extended attributes, since they are only supported on Linux
+func readXattrs(name string) (map[string][]byte, error) {
+	return nil, nil
+}
+
+func writeXattrs(name string, xattrs map[string][]byte) error {
+	return nil
+}
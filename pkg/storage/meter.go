@@ -0,0 +1,306 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"sync"
+	"time"
+
+	"github.com/mwantia/gosync/pkg/db/models"
+	"github.com/mwantia/gosync/pkg/log"
+)
+
+// UsageRecorder persists accumulated bandwidth usage (implemented by the metadata store)
+type UsageRecorder interface {
+	AddBandwidthUsage(ctx context.Context, usage *models.BandwidthUsage) error
+}
+
+// SecretResolver resolves secret references within the settings of a backend before it is opened
+type SecretResolver interface {
+	ResolveBackend(ctx context.Context, backend *models.Backend) (*models.Backend, error)
+}
+
+// Meter accumulates transferred bytes and API calls of metered storages per backend
+// and calendar month, until they are flushed into the rollup tables.
+type Meter struct {
+	mutex    sync.Mutex
+	recorder UsageRecorder
+	usage    map[string]*models.BandwidthUsage
+	secrets  SecretResolver
+}
+
+// NewMeter creates a new meter flushing into the provided recorder
+func NewMeter(recorder UsageRecorder) *Meter {
+	return &Meter{
+		recorder: recorder,
+		usage:    make(map[string]*models.BandwidthUsage),
+	}
+}
+
+// SetSecretResolver resolves the secret references of all backends opened by the meter
+func (m *Meter) SetSecretResolver(secrets SecretResolver) {
+	m.secrets = secrets
+}
+
+// Open creates the storage for the backend and wraps it with the meter
+func (m *Meter) Open(backend *models.Backend) (Storage, error) {
+	if m.secrets != nil {
+		resolved, err := m.secrets.ResolveBackend(context.Background(), backend)
+		if err != nil {
+			return nil, err
+		}
+		backend = resolved
+	}
+
+	st, err := New(backend)
+	if err != nil {
+		return nil, err
+	}
+	return m.Wrap(backend.ID, st), nil
+}
+
+// Wrap returns a storage recording all operations of the backend in the meter
+func (m *Meter) Wrap(backendID string, st Storage) Storage {
+	return &meteredStorage{
+		Storage:   st,
+		meter:     m,
+		backendID: backendID,
+	}
+}
+
+func (m *Meter) add(backendID string, uploaded, downloaded, calls int64) {
+	month := time.Now().UTC().Format("2006-01")
+
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	key := backendID + "/" + month
+	usage, ok := m.usage[key]
+	if !ok {
+		usage = &models.BandwidthUsage{
+			BackendID: backendID,
+			Month:     month,
+		}
+		m.usage[key] = usage
+	}
+
+	usage.BytesUploaded += uploaded
+	usage.BytesDownloaded += downloaded
+	usage.APICalls += calls
+}
+
+// Flush persists all accumulated usage and resets the meter. Usage that failed to persist is kept for the
+// next flush, while the errors of all failed backends are returned joined.
+func (m *Meter) Flush(ctx context.Context) error {
+	m.mutex.Lock()
+	pending := m.usage
+	m.usage = make(map[string]*models.BandwidthUsage)
+	m.mutex.Unlock()
+
+	var errs []error
+	for key, usage := range pending {
+		if err := m.recorder.AddBandwidthUsage(ctx, usage); err != nil {
+			m.requeue(key, usage)
+			errs = append(errs, fmt.Errorf("failed to record usage of backend '%s': %w", usage.BackendID, err))
+		}
+	}
+
+	return errors.Join(errs...)
+}
+
+// requeue keeps the usage for the next flush attempt, merged with the usage accumulated in the meantime
+func (m *Meter) requeue(key string, usage *models.BandwidthUsage) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	if current, ok := m.usage[key]; ok {
+		current.BytesUploaded += usage.BytesUploaded
+		current.BytesDownloaded += usage.BytesDownloaded
+		current.APICalls += usage.APICalls
+		return
+	}
+	usage.ID = 0
+	m.usage[key] = usage
+}
+
+// Run periodically flushes the meter until the context is cancelled. Failed flushes are logged and retried
+// by the next tick, since the usage is kept until it's persisted.
+func (m *Meter) Run(ctx context.Context, interval time.Duration, logger log.LoggerService) error {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			// Use a fresh context, so the final usage isn't lost during shutdown
+			flush, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+			defer cancel()
+			return m.Flush(flush)
+		case <-ticker.C:
+			if err := m.Flush(ctx); err != nil {
+				logger.Warn("Failed to flush bandwidth usage: %v", err)
+			}
+		}
+	}
+}
+
+// meteredStorage records all operations of the wrapped storage in a meter
+type meteredStorage struct {
+	Storage
+	meter     *Meter
+	backendID string
+}
+
+func (s *meteredStorage) List(ctx context.Context, prefix string, fn func(ObjectInfo) error) error {
+	// Listings are paginated by 1000 keys for all supported backends
+	count := int64(0)
+	err := s.Storage.List(ctx, prefix, func(object ObjectInfo) error {
+		count++
+		return fn(object)
+	})
+	s.meter.add(s.backendID, 0, 0, count/1000+1)
+	return err
+}
+
+func (s *meteredStorage) ListPage(ctx context.Context, prefix, startAfter string, limit int) ([]ObjectInfo, bool, error) {
+	pager, ok := s.Storage.(PageStorage)
+	if !ok {
+		return nil, false, fmt.Errorf("%w: paginated listings", ErrNotSupported)
+	}
+
+	s.meter.add(s.backendID, 0, 0, 1)
+	return pager.ListPage(ctx, prefix, startAfter, limit)
+}
+
+func (s *meteredStorage) ListLevel(ctx context.Context, prefix string) ([]ObjectInfo, []string, error) {
+	pager, ok := s.Storage.(PageStorage)
+	if !ok {
+		return nil, nil, fmt.Errorf("%w: paginated listings", ErrNotSupported)
+	}
+
+	objects, prefixes, err := pager.ListLevel(ctx, prefix)
+	s.meter.add(s.backendID, 0, 0, int64(len(objects)+len(prefixes))/1000+1)
+	return objects, prefixes, err
+}
+
+func (s *meteredStorage) Stat(ctx context.Context, key string) (*ObjectInfo, error) {
+	s.meter.add(s.backendID, 0, 0, 1)
+	return s.Storage.Stat(ctx, key)
+}
+
+func (s *meteredStorage) Get(ctx context.Context, key string) (io.ReadCloser, error) {
+	s.meter.add(s.backendID, 0, 0, 1)
+	reader, err := s.Storage.Get(ctx, key)
+	if err != nil {
+		return nil, err
+	}
+	return &meteredReader{ReadCloser: reader, storage: s}, nil
+}
+
+func (s *meteredStorage) GetRange(ctx context.Context, key string, offset, length int64, etag string) (io.ReadCloser, error) {
+	ranger, ok := s.Storage.(RangeStorage)
+	if !ok {
+		return nil, fmt.Errorf("%w: range reads", ErrNotSupported)
+	}
+
+	s.meter.add(s.backendID, 0, 0, 1)
+	reader, err := ranger.GetRange(ctx, key, offset, length, etag)
+	if err != nil {
+		return nil, err
+	}
+	return &meteredReader{ReadCloser: reader, storage: s}, nil
+}
+
+func (s *meteredStorage) Put(ctx context.Context, key string, reader io.Reader, size int64, opts PutOptions) (*ObjectInfo, error) {
+	counter := &countingReader{Reader: reader}
+	info, err := s.Storage.Put(ctx, key, counter, size, opts)
+	s.meter.add(s.backendID, counter.n, 0, 1)
+	return info, err
+}
+
+func (s *meteredStorage) PutDelta(ctx context.Context, key string, src io.ReaderAt, size, blockSize int64, reuse []bool, opts PutOptions) (*ObjectInfo, error) {
+	delta, ok := s.Storage.(DeltaStorage)
+	if !ok {
+		return nil, fmt.Errorf("%w: delta uploads", ErrNotSupported)
+	}
+
+	// Each block is transferred with a separate call, but only changed blocks are uploaded
+	var uploaded, calls int64 = 0, 2
+	for offset, index := int64(0), 0; offset < size; offset, index = offset+blockSize, index+1 {
+		calls++
+		if index >= len(reuse) || !reuse[index] {
+			uploaded += min(blockSize, size-offset)
+		}
+	}
+
+	info, err := delta.PutDelta(ctx, key, src, size, blockSize, reuse, opts)
+	s.meter.add(s.backendID, uploaded, 0, calls)
+	return info, err
+}
+
+func (s *meteredStorage) Select(ctx context.Context, key string, opts SelectOptions) (io.ReadCloser, error) {
+	selector, ok := s.Storage.(SelectStorage)
+	if !ok {
+		return nil, fmt.Errorf("%w: server-side queries", ErrNotSupported)
+	}
+
+	// Only the returned records are transferred and counted, scanned bytes are billed separately
+	s.meter.add(s.backendID, 0, 0, 1)
+	reader, err := selector.Select(ctx, key, opts)
+	if err != nil {
+		return nil, err
+	}
+	return &meteredReader{ReadCloser: reader, storage: s}, nil
+}
+
+func (s *meteredStorage) Copy(ctx context.Context, srcKey, dstKey string) (*ObjectInfo, error) {
+	s.meter.add(s.backendID, 0, 0, 1)
+	return s.Storage.Copy(ctx, srcKey, dstKey)
+}
+
+func (s *meteredStorage) CopyVersion(ctx context.Context, srcKey, versionID, dstKey string) (*ObjectInfo, error) {
+	s.meter.add(s.backendID, 0, 0, 1)
+	return s.Storage.CopyVersion(ctx, srcKey, versionID, dstKey)
+}
+
+func (s *meteredStorage) Delete(ctx context.Context, key string) error {
+	s.meter.add(s.backendID, 0, 0, 1)
+	return s.Storage.Delete(ctx, key)
+}
+
+func (s *meteredStorage) DeleteMany(ctx context.Context, keys []string) ([]DeleteError, error) {
+	calls := int64((len(keys) + MaxDeleteBatchSize - 1) / MaxDeleteBatchSize)
+	if counter, ok := s.Storage.(DeleteCounter); ok {
+		calls = counter.DeleteCalls(len(keys))
+	}
+	s.meter.add(s.backendID, 0, 0, calls)
+	return s.Storage.DeleteMany(ctx, keys)
+}
+
+func (s *meteredStorage) Close() error {
+	return Close(s.Storage)
+}
+
+type meteredReader struct {
+	io.ReadCloser
+	storage *meteredStorage
+}
+
+func (r *meteredReader) Read(p []byte) (int, error) {
+	n, err := r.ReadCloser.Read(p)
+	r.storage.meter.add(r.storage.backendID, 0, int64(n), 0)
+	return n, err
+}
+
+type countingReader struct {
+	io.Reader
+	n int64
+}
+
+func (r *countingReader) Read(p []byte) (int, error) {
+	n, err := r.Reader.Read(p)
+	r.n += int64(n)
+	return n, err
+}
@@ -0,0 +1,163 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"sync"
+)
+
+// DefaultParallelChunkSize is the size of the ranges read by parallel downloads if no chunk size is configured
+const DefaultParallelChunkSize = 16 << 20
+
+// ParallelOptions configures the ranged reads of large objects by multiple workers
+type ParallelOptions struct {
+	// Workers fetch ranges of the same object at once, objects are read by a single request if this is 1 or less
+	Workers int
+	// ChunkSize is the size of each range (DefaultParallelChunkSize if 0)
+	ChunkSize int64
+	// MinSize is the size objects need to have to be read in parallel
+	MinSize int64
+}
+
+// OpenParallel reads the object by ranged reads of multiple workers, which are reassembled in order. Up to one chunk
+// per worker is buffered in memory, and each range is read only if the ETag of the object is unchanged. Objects
+// smaller than the minimum size or two chunks, and storages without range reads, read the object by a single request.
+func OpenParallel(ctx context.Context, st Storage, object ObjectInfo, opts ParallelOptions) (io.ReadCloser, error) {
+	chunkSize := opts.ChunkSize
+	if chunkSize <= 0 {
+		chunkSize = DefaultParallelChunkSize
+	}
+	ranger, ok := st.(RangeStorage)
+	if !ok || opts.Workers <= 1 || object.Size < max(opts.MinSize, 2*chunkSize) {
+		return st.Get(ctx, object.Key)
+	}
+
+	// The first range is requested right away, so storages only supporting range reads of some objects fall back
+	parent := ctx
+	ctx, cancel := context.WithCancel(ctx)
+	first, err := ranger.GetRange(ctx, object.Key, 0, chunkSize, object.ETag)
+	if err != nil {
+		cancel()
+		if errors.Is(err, ErrNotSupported) {
+			return st.Get(parent, object.Key)
+		}
+		return nil, err
+	}
+
+	r := &parallelReader{
+		cancel:  cancel,
+		queue:   make(chan *parallelChunk, opts.Workers),
+		workers: make(chan struct{}, opts.Workers),
+	}
+	r.wait.Add(1)
+	go r.run(ctx, ranger, object, chunkSize, first)
+	return r, nil
+}
+
+// parallelChunk is a single range of the object, whose data is available once done is closed
+type parallelChunk struct {
+	done chan struct{}
+	data []byte
+	err  error
+}
+
+type parallelReader struct {
+	cancel context.CancelFunc
+	wait   sync.WaitGroup
+	// queue contains the chunks in the order of the object, workers limits the chunks being fetched or buffered
+	queue   chan *parallelChunk
+	workers chan struct{}
+
+	current *parallelChunk
+	offset  int
+	err     error
+}
+
+// run starts fetching the chunks of the object in order, as long as a worker is available
+func (r *parallelReader) run(ctx context.Context, ranger RangeStorage, object ObjectInfo, chunkSize int64, first io.ReadCloser) {
+	defer r.wait.Done()
+	defer close(r.queue)
+
+	for offset := int64(0); offset < object.Size; offset += chunkSize {
+		select {
+		case r.workers <- struct{}{}:
+		case <-ctx.Done():
+			if first != nil {
+				first.Close()
+			}
+			return
+		}
+
+		chunk := &parallelChunk{done: make(chan struct{})}
+		r.queue <- chunk
+
+		reader := first
+		first = nil
+		r.wait.Add(1)
+		go func(offset, length int64) {
+			defer r.wait.Done()
+			defer close(chunk.done)
+			chunk.data, chunk.err = fetchChunk(ctx, ranger, object, reader, offset, length)
+		}(offset, min(chunkSize, object.Size-offset))
+	}
+}
+
+// fetchChunk reads the range of the object, using the reader of the range if it was already requested
+func fetchChunk(ctx context.Context, ranger RangeStorage, object ObjectInfo, reader io.ReadCloser, offset, length int64) ([]byte, error) {
+	if reader == nil {
+		var err error
+		if reader, err = ranger.GetRange(ctx, object.Key, offset, length, object.ETag); err != nil {
+			return nil, err
+		}
+	}
+	defer reader.Close()
+
+	data := make([]byte, length)
+	if _, err := io.ReadFull(reader, data); err != nil {
+		if errors.Is(err, io.ErrUnexpectedEOF) || errors.Is(err, io.EOF) {
+			return nil, fmt.Errorf("%w: '%s' changed while it was read", ErrPreconditionFailed, object.Key)
+		}
+		return nil, err
+	}
+	return data, nil
+}
+
+func (r *parallelReader) Read(p []byte) (int, error) {
+	if r.err != nil {
+		return 0, r.err
+	}
+
+	for r.current == nil || r.offset == len(r.current.data) {
+		if r.current != nil {
+			// The buffer of the consumed chunk is released, so its worker fetches the next chunk
+			r.current = nil
+			<-r.workers
+		}
+
+		chunk, ok := <-r.queue
+		if !ok {
+			r.err = io.EOF
+			return 0, r.err
+		}
+		<-chunk.done
+		if chunk.err != nil {
+			r.err = chunk.err
+			return 0, r.err
+		}
+		r.current, r.offset = chunk, 0
+	}
+
+	n := copy(p, r.current.data[r.offset:])
+	r.offset += n
+	return n, nil
+}
+
+// Close stops fetching chunks and waits for the workers. Chunks never block on the queue, since each queued chunk
+// holds one of the workers and the queue fits all of them.
+func (r *parallelReader) Close() error {
+	r.cancel()
+	r.wait.Wait()
+	return nil
+}
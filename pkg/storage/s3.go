@@ -0,0 +1,551 @@
+package storage
+
+import (
+	"cmp"
+	"context"
+	"crypto/md5"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/minio/minio-go/v7"
+	"github.com/minio/minio-go/v7/pkg/credentials"
+	"github.com/mwantia/gosync/pkg/db/models"
+)
+
+const (
+	// s3MinPartSize is the minimum size of all but the last part of a multipart upload
+	s3MinPartSize = 5 << 20
+	// s3MaxParts is the maximum number of parts of a multipart upload
+	s3MaxParts = 10000
+)
+
+// S3Storage implements Storage for S3-compatible backends
+type S3Storage struct {
+	client *minio.Client
+	core   minio.Core
+	bucket string
+}
+
+// NewS3Storage creates a new S3-backed storage for the provided backend
+func NewS3Storage(backend *models.Backend) (*S3Storage, error) {
+	opts := &minio.Options{
+		Creds:  credentials.NewStaticV4(backend.AccessKey, backend.SecretKey, ""),
+		Secure: backend.UseSSL,
+		Region: backend.Region,
+	}
+
+	transport, err := newTransport(backend)
+	if err != nil {
+		return nil, err
+	}
+	if transport != nil {
+		opts.Transport = transport
+	}
+
+	client, err := minio.New(backend.Endpoint, opts)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create s3 client: %w", err)
+	}
+
+	return &S3Storage{
+		client: client,
+		core:   minio.Core{Client: client},
+		bucket: backend.Bucket,
+	}, nil
+}
+
+// EnsureBucket creates the bucket of the backend if it doesn't exist yet
+func (s *S3Storage) EnsureBucket(ctx context.Context, region string) error {
+	exists, err := s.client.BucketExists(ctx, s.bucket)
+	if err != nil {
+		return fmt.Errorf("failed to check bucket '%s': %w", s.bucket, err)
+	}
+	if exists {
+		return nil
+	}
+
+	if err := s.client.MakeBucket(ctx, s.bucket, minio.MakeBucketOptions{Region: region}); err != nil {
+		return fmt.Errorf("failed to create bucket '%s': %w", s.bucket, err)
+	}
+	return nil
+}
+
+func (s *S3Storage) List(ctx context.Context, prefix string, fn func(ObjectInfo) error) error {
+	objects := s.client.ListObjects(ctx, s.bucket, minio.ListObjectsOptions{
+		Prefix:    prefix,
+		Recursive: true,
+	})
+
+	for object := range objects {
+		if object.Err != nil {
+			return toStorageError(object.Err)
+		}
+
+		if err := fn(toObjectInfo(object)); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// ListPage lists a single page using ListObjectsV2, continuing after the key of the previous page
+func (s *S3Storage) ListPage(ctx context.Context, prefix, startAfter string, limit int) ([]ObjectInfo, bool, error) {
+	// The listing is stopped once the page is complete, instead of requesting all further pages
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	objects := s.client.ListObjects(ctx, s.bucket, minio.ListObjectsOptions{
+		Prefix:     prefix,
+		StartAfter: startAfter,
+		MaxKeys:    limit,
+		Recursive:  true,
+	})
+
+	page := make([]ObjectInfo, 0, limit)
+	for object := range objects {
+		if object.Err != nil {
+			return nil, false, toStorageError(object.Err)
+		}
+		if len(page) == limit {
+			return page, true, nil
+		}
+		page = append(page, toObjectInfo(object))
+	}
+	return page, false, nil
+}
+
+// ListLevel lists the objects directly below the prefix using "/" as delimiter
+func (s *S3Storage) ListLevel(ctx context.Context, prefix string) ([]ObjectInfo, []string, error) {
+	objects := s.client.ListObjects(ctx, s.bucket, minio.ListObjectsOptions{
+		Prefix:    prefix,
+		Recursive: false,
+	})
+
+	var level []ObjectInfo
+	var prefixes []string
+	for object := range objects {
+		if object.Err != nil {
+			return nil, nil, toStorageError(object.Err)
+		}
+		// Common prefixes are returned as objects without content
+		if strings.HasSuffix(object.Key, "/") {
+			prefixes = append(prefixes, object.Key)
+			continue
+		}
+		level = append(level, toObjectInfo(object))
+	}
+	return level, prefixes, nil
+}
+
+func (s *S3Storage) Stat(ctx context.Context, key string) (*ObjectInfo, error) {
+	object, err := s.client.StatObject(ctx, s.bucket, key, minio.StatObjectOptions{})
+	if err != nil {
+		return nil, toStorageError(err)
+	}
+
+	info := toObjectInfo(object)
+	return &info, nil
+}
+
+func (s *S3Storage) Get(ctx context.Context, key string) (io.ReadCloser, error) {
+	object, err := s.client.GetObject(ctx, s.bucket, key, minio.GetObjectOptions{})
+	if err != nil {
+		return nil, toStorageError(err)
+	}
+
+	return object, nil
+}
+
+func (s *S3Storage) GetRange(ctx context.Context, key string, offset, length int64, etag string) (io.ReadCloser, error) {
+	opts := minio.GetObjectOptions{}
+	if err := opts.SetRange(offset, offset+length-1); err != nil {
+		return nil, err
+	}
+	if etag != "" {
+		opts.SetMatchETag(etag)
+	}
+
+	object, err := s.client.GetObject(ctx, s.bucket, key, opts)
+	if err != nil {
+		return nil, toStorageError(err)
+	}
+	// The request is only sent with the first read, which is where its errors are reported
+	return &s3Reader{Object: object}, nil
+}
+
+func (s *S3Storage) Put(ctx context.Context, key string, reader io.Reader, size int64, opts PutOptions) (*ObjectInfo, error) {
+	putOpts := minio.PutObjectOptions{
+		ContentType: opts.ContentType,
+	}
+	// Let the client choose if the part size would exceed the maximum number of parts
+	if opts.PartSize >= s3MinPartSize && (size < 0 || size <= opts.PartSize*s3MaxParts) {
+		putOpts.PartSize = uint64(opts.PartSize)
+	}
+	if opts.IfMatch != "" {
+		putOpts.SetMatchETag(opts.IfMatch)
+	}
+	if opts.IfNoneMatch {
+		putOpts.SetMatchETagExcept("*")
+	}
+	if !opts.RetainUntil.IsZero() {
+		putOpts.Mode = minio.Governance
+		if opts.Compliance {
+			putOpts.Mode = minio.Compliance
+		}
+		putOpts.RetainUntilDate = opts.RetainUntil.UTC()
+	}
+
+	started := time.Now()
+	upload, err := s.client.PutObject(ctx, s.bucket, key, reader, size, putOpts)
+	if err != nil {
+		if errors.Is(context.Cause(ctx), ErrCancelled) {
+			s.abortUploads(context.WithoutCancel(ctx), key, started)
+		}
+		return nil, toStorageError(err)
+	}
+
+	return &ObjectInfo{
+		Key:          upload.Key,
+		Size:         upload.Size,
+		ETag:         upload.ETag,
+		VersionID:    upload.VersionID,
+		LastModified: upload.LastModified,
+	}, nil
+}
+
+// PutDelta uploads changed blocks as parts of a multipart upload and copies unchanged blocks from the current object
+func (s *S3Storage) PutDelta(ctx context.Context, key string, src io.ReaderAt, size, blockSize int64, reuse []bool, opts PutOptions) (*ObjectInfo, error) {
+	if opts.IfMatch == "" && slices.Contains(reuse, true) {
+		return nil, fmt.Errorf("%w: delta uploads require the etag of the current object", ErrPreconditionFailed)
+	}
+	if blockSize < s3MinPartSize || (size+blockSize-1)/blockSize > s3MaxParts {
+		return nil, fmt.Errorf("%w: block size %d is invalid for multipart uploads", ErrNotSupported, blockSize)
+	}
+
+	putOpts := minio.PutObjectOptions{
+		ContentType: opts.ContentType,
+	}
+
+	var uploadID string
+	var uploaded map[int]minio.ObjectPart
+	if opts.Resume {
+		uploadID, uploaded = s.interruptedUpload(ctx, key)
+	}
+	if uploadID == "" {
+		var err error
+		if uploadID, err = s.core.NewMultipartUpload(ctx, s.bucket, key, putOpts); err != nil {
+			return nil, toStorageError(err)
+		}
+	}
+
+	// Uploads interrupted by a cancellation are kept, so their parts don't have to be uploaded again,
+	// unless the transfer was cancelled for good
+	abort := func() {
+		if !opts.Resume || ctx.Err() == nil || errors.Is(context.Cause(ctx), ErrCancelled) {
+			s.core.AbortMultipartUpload(context.WithoutCancel(ctx), s.bucket, key, uploadID)
+		}
+	}
+
+	parts, err := s.putDeltaParts(ctx, key, uploadID, src, size, blockSize, reuse, opts.IfMatch, uploaded)
+	if err != nil {
+		abort()
+		return nil, err
+	}
+
+	if opts.IfMatch != "" {
+		putOpts.SetMatchETag(opts.IfMatch)
+	}
+	upload, err := s.core.CompleteMultipartUpload(ctx, s.bucket, key, uploadID, parts, putOpts)
+	if err != nil {
+		abort()
+		return nil, toStorageError(err)
+	}
+
+	return &ObjectInfo{
+		Key:          key,
+		Size:         size,
+		ETag:         upload.ETag,
+		VersionID:    upload.VersionID,
+		ContentType:  opts.ContentType,
+		LastModified: upload.LastModified,
+	}, nil
+}
+
+func (s *S3Storage) putDeltaParts(ctx context.Context, key, uploadID string, src io.ReaderAt, size, blockSize int64, reuse []bool, etag string, uploaded map[int]minio.ObjectPart) ([]minio.CompletePart, error) {
+	var parts []minio.CompletePart
+
+	for offset, index := int64(0), 0; offset < size; offset, index = offset+blockSize, index+1 {
+		length := min(blockSize, size-offset)
+		partID := index + 1
+
+		if index < len(reuse) && reuse[index] {
+			part, err := s.core.CopyObjectPart(ctx, s.bucket, key, s.bucket, key, uploadID, partID, offset, length, map[string]string{
+				"x-amz-copy-source-if-match": etag,
+			})
+			if err != nil {
+				return nil, toStorageError(err)
+			}
+			parts = append(parts, part)
+			continue
+		}
+
+		// Parts of an interrupted upload are kept if their content didn't change in the meantime
+		if part, ok := uploaded[partID]; ok && part.Size == length && partMatches(src, offset, length, part.ETag) {
+			parts = append(parts, minio.CompletePart{
+				PartNumber: partID,
+				ETag:       part.ETag,
+			})
+			continue
+		}
+
+		part, err := s.core.PutObjectPart(ctx, s.bucket, key, uploadID, partID, io.NewSectionReader(src, offset, length), length, minio.PutObjectPartOptions{})
+		if err != nil {
+			return nil, toStorageError(err)
+		}
+		parts = append(parts, minio.CompletePart{
+			PartNumber: part.PartNumber,
+			ETag:       part.ETag,
+		})
+	}
+
+	return parts, nil
+}
+
+// abortUploads aborts the incomplete multipart uploads of the key initiated since the time, e.g. those of
+// a cancelled upload whose parts would otherwise be kept until the lifecycle rules of the bucket remove them
+func (s *S3Storage) abortUploads(ctx context.Context, key string, since time.Time) {
+	result, err := s.core.ListMultipartUploads(ctx, s.bucket, key, "", "", "", 1000)
+	if err != nil {
+		return
+	}
+
+	// Uploads are initiated by the server, whose clock may differ slightly
+	since = since.Add(-time.Minute)
+	for _, upload := range result.Uploads {
+		if upload.Key == key && upload.Initiated.After(since) {
+			s.core.AbortMultipartUpload(ctx, s.bucket, key, upload.UploadID)
+		}
+	}
+}
+
+// interruptedUpload returns the last incomplete multipart upload of the key together with its uploaded parts.
+// Returns an empty upload ID if there is none or it can't be listed.
+func (s *S3Storage) interruptedUpload(ctx context.Context, key string) (string, map[int]minio.ObjectPart) {
+	result, err := s.core.ListMultipartUploads(ctx, s.bucket, key, "", "", "", 1000)
+	if err != nil {
+		return "", nil
+	}
+
+	var latest *minio.ObjectMultipartInfo
+	for i, upload := range result.Uploads {
+		// The prefix also matches the uploads of longer keys
+		if upload.Key == key && (latest == nil || upload.Initiated.After(latest.Initiated)) {
+			latest = &result.Uploads[i]
+		}
+	}
+	if latest == nil {
+		return "", nil
+	}
+
+	parts := make(map[int]minio.ObjectPart)
+	for marker := 0; ; {
+		result, err := s.core.ListObjectParts(ctx, s.bucket, key, latest.UploadID, marker, 1000)
+		if err != nil {
+			return "", nil
+		}
+		for _, part := range result.ObjectParts {
+			parts[part.PartNumber] = part
+		}
+		if !result.IsTruncated {
+			break
+		}
+		marker = result.NextPartNumberMarker
+	}
+
+	return latest.UploadID, parts
+}
+
+// partMatches compares the ETag of an uploaded part with the MD5 of the block. Parts of encrypted
+// uploads have different ETags, so they never match and are uploaded again.
+func partMatches(src io.ReaderAt, offset, length int64, etag string) bool {
+	hash := md5.New()
+	if _, err := io.Copy(hash, io.NewSectionReader(src, offset, length)); err != nil {
+		return false
+	}
+	return hex.EncodeToString(hash.Sum(nil)) == strings.Trim(etag, `"`)
+}
+
+// Select runs an S3 Select query against the object and streams the matching records
+func (s *S3Storage) Select(ctx context.Context, key string, opts SelectOptions) (io.ReadCloser, error) {
+	input := minio.SelectObjectInputSerialization{}
+	switch strings.ToLower(opts.Compression) {
+	case "", "none":
+		input.CompressionType = minio.SelectCompressionNONE
+	case "gzip":
+		input.CompressionType = minio.SelectCompressionGZIP
+	case "bzip2":
+		input.CompressionType = minio.SelectCompressionBZIP
+	default:
+		return nil, fmt.Errorf("%w: compression '%s', expected none, gzip or bzip2", ErrNotSupported, opts.Compression)
+	}
+
+	switch opts.Format {
+	case SelectFormatCSV:
+		header := minio.CSVFileHeaderInfoNone
+		switch strings.ToLower(opts.CSVHeader) {
+		case "use":
+			header = minio.CSVFileHeaderInfoUse
+		case "ignore":
+			header = minio.CSVFileHeaderInfoIgnore
+		case "", "none":
+		default:
+			return nil, fmt.Errorf("%w: csv header '%s', expected use, ignore or none", ErrNotSupported, opts.CSVHeader)
+		}
+		input.CSV = &minio.CSVInputOptions{
+			FileHeaderInfo:  header,
+			RecordDelimiter: "\n",
+			FieldDelimiter:  cmp.Or(opts.CSVDelimiter, ","),
+		}
+	case SelectFormatJSON:
+		input.JSON = &minio.JSONInputOptions{Type: minio.JSONDocumentType}
+		if opts.JSONLines {
+			input.JSON.Type = minio.JSONLinesType
+		}
+	case SelectFormatParquet:
+		// Parquet objects are compressed internally, so the object itself must not be
+		input.CompressionType = minio.SelectCompressionNONE
+		input.Parquet = &minio.ParquetInputOptions{}
+	default:
+		return nil, fmt.Errorf("%w: format '%s', expected csv, json or parquet", ErrNotSupported, opts.Format)
+	}
+
+	output := minio.SelectObjectOutputSerialization{}
+	switch cmp.Or(opts.Output, opts.Format) {
+	case SelectFormatCSV:
+		output.CSV = &minio.CSVOutputOptions{
+			RecordDelimiter: "\n",
+			FieldDelimiter:  cmp.Or(opts.CSVDelimiter, ","),
+		}
+	case SelectFormatJSON, SelectFormatParquet:
+		output.JSON = &minio.JSONOutputOptions{RecordDelimiter: "\n"}
+	default:
+		return nil, fmt.Errorf("%w: output '%s', expected csv or json", ErrNotSupported, opts.Output)
+	}
+
+	results, err := s.client.SelectObjectContent(ctx, s.bucket, key, minio.SelectObjectOptions{
+		Expression:          opts.Expression,
+		ExpressionType:      minio.QueryExpressionTypeSQL,
+		InputSerialization:  input,
+		OutputSerialization: output,
+	})
+	if err != nil {
+		return nil, toStorageError(err)
+	}
+
+	return results, nil
+}
+
+func (s *S3Storage) Copy(ctx context.Context, srcKey, dstKey string) (*ObjectInfo, error) {
+	return s.CopyVersion(ctx, srcKey, "", dstKey)
+}
+
+func (s *S3Storage) CopyVersion(ctx context.Context, srcKey, versionID, dstKey string) (*ObjectInfo, error) {
+	upload, err := s.client.CopyObject(ctx, minio.CopyDestOptions{
+		Bucket: s.bucket,
+		Object: dstKey,
+	}, minio.CopySrcOptions{
+		Bucket:    s.bucket,
+		Object:    srcKey,
+		VersionID: versionID,
+	})
+	if err != nil {
+		return nil, toStorageError(err)
+	}
+
+	return &ObjectInfo{
+		Key:          upload.Key,
+		Size:         upload.Size,
+		ETag:         upload.ETag,
+		VersionID:    upload.VersionID,
+		LastModified: upload.LastModified,
+	}, nil
+}
+
+func (s *S3Storage) Delete(ctx context.Context, key string) error {
+	return toStorageError(s.client.RemoveObject(ctx, s.bucket, key, minio.RemoveObjectOptions{}))
+}
+
+func (s *S3Storage) DeleteMany(ctx context.Context, keys []string) ([]DeleteError, error) {
+	var failed []DeleteError
+
+	for start := 0; start < len(keys); start += MaxDeleteBatchSize {
+		end := min(start+MaxDeleteBatchSize, len(keys))
+
+		objects := make(chan minio.ObjectInfo, end-start)
+		for _, key := range keys[start:end] {
+			objects <- minio.ObjectInfo{Key: key}
+		}
+		close(objects)
+
+		for result := range s.client.RemoveObjects(ctx, s.bucket, objects, minio.RemoveObjectsOptions{}) {
+			failed = append(failed, DeleteError{
+				Key: result.ObjectName,
+				Err: result.Err,
+			})
+		}
+
+		if err := ctx.Err(); err != nil {
+			return failed, err
+		}
+	}
+
+	return failed, nil
+}
+
+func toObjectInfo(object minio.ObjectInfo) ObjectInfo {
+	return ObjectInfo{
+		Key:          object.Key,
+		Size:         object.Size,
+		ETag:         object.ETag,
+		VersionID:    object.VersionID,
+		ContentType:  object.ContentType,
+		LastModified: object.LastModified,
+	}
+}
+
+// s3Reader reports the errors of lazily sent requests as the errors of the storage
+type s3Reader struct {
+	*minio.Object
+}
+
+func (r *s3Reader) Read(p []byte) (int, error) {
+	n, err := r.Object.Read(p)
+	if err != nil && err != io.EOF {
+		err = toStorageError(err)
+	}
+	return n, err
+}
+
+func toStorageError(err error) error {
+	if err == nil {
+		return nil
+	}
+
+	switch minio.ToErrorResponse(err).StatusCode {
+	case http.StatusNotFound:
+		return fmt.Errorf("%w: %v", ErrObjectNotFound, err)
+	case http.StatusPreconditionFailed:
+		return fmt.Errorf("%w: %v", ErrPreconditionFailed, err)
+	case http.StatusForbidden:
+		return fmt.Errorf("%w: %v", ErrAccessDenied, err)
+	}
+
+	return err
+}
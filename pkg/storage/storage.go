@@ -0,0 +1,220 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"time"
+
+	"github.com/mwantia/gosync/pkg/db/models"
+)
+
+// ErrObjectNotFound is returned when the requested object doesn't exist in the backend
+var ErrObjectNotFound = errors.New("object not found")
+
+// ErrPreconditionFailed is returned when a conditional write was rejected by the backend
+var ErrPreconditionFailed = errors.New("precondition failed")
+
+// ErrAccessDenied is returned when the credentials of the backend lack the permission for the operation,
+// e.g. after the policy of a bucket changed
+var ErrAccessDenied = errors.New("access denied")
+
+// ErrNotSupported is returned when an operation isn't available for the backend type
+var ErrNotSupported = errors.New("operation not supported")
+
+// ErrCancelled is the cause of contexts cancelled to abort a single transfer for good. Storages discard the
+// incomplete uploads of such transfers, instead of keeping them for resuming them later.
+var ErrCancelled = errors.New("transfer cancelled")
+
+// Backend types supported by New
+const (
+	TypeS3    = "s3"
+	TypeAzure = "azure"
+	TypeGCS   = "gcs"
+	TypeLocal = "local"
+)
+
+// MaxDeleteBatchSize is the maximum number of keys removed with a single batch delete call
+const MaxDeleteBatchSize = 1000
+
+// ObjectInfo describes a single object stored within a backend
+type ObjectInfo struct {
+	Key          string
+	Size         int64
+	ETag         string
+	VersionID    string
+	ContentType  string
+	LastModified time.Time
+}
+
+// Storage defines the interface for object operations on a backend
+type Storage interface {
+	// List walks all objects below the prefix and calls fn for each of them
+	List(ctx context.Context, prefix string, fn func(ObjectInfo) error) error
+	Stat(ctx context.Context, key string) (*ObjectInfo, error)
+	Get(ctx context.Context, key string) (io.ReadCloser, error)
+	Put(ctx context.Context, key string, reader io.Reader, size int64, opts PutOptions) (*ObjectInfo, error)
+	// Copy duplicates an object within the same backend using a server-side copy
+	Copy(ctx context.Context, srcKey, dstKey string) (*ObjectInfo, error)
+	// CopyVersion copies a specific (possibly non-current) version of an object
+	CopyVersion(ctx context.Context, srcKey, versionID, dstKey string) (*ObjectInfo, error)
+	Delete(ctx context.Context, key string) error
+	// DeleteMany removes multiple objects using batched delete calls and returns
+	// the keys that failed to be deleted (partial failures don't return an error)
+	DeleteMany(ctx context.Context, keys []string) ([]DeleteError, error)
+}
+
+// DeleteCounter is implemented by storages whose DeleteMany doesn't take one call per MaxDeleteBatchSize keys,
+// so the calls are metered as they are billed
+type DeleteCounter interface {
+	// DeleteCalls returns the number of calls DeleteMany makes to remove the number of keys
+	DeleteCalls(keys int) int64
+}
+
+// DeltaStorage is implemented by storages that can assemble an object from new blocks and unchanged
+// blocks of the current object, so only changed blocks are transferred. reuse marks the fixed-size
+// blocks that are copied server-side from the current object, which must match opts.IfMatch. With
+// opts.Resume, uploads interrupted by the cancellation of the context are kept and continued by the
+// next upload of the key, which only transfers the blocks that weren't uploaded yet.
+type DeltaStorage interface {
+	PutDelta(ctx context.Context, key string, src io.ReaderAt, size, blockSize int64, reuse []bool, opts PutOptions) (*ObjectInfo, error)
+}
+
+// RangeStorage is implemented by storages that can read a part of an object, so large objects can be read block by block.
+// Reads fail with ErrPreconditionFailed if the object no longer matches the etag, which isn't checked if empty.
+type RangeStorage interface {
+	GetRange(ctx context.Context, key string, offset, length int64, etag string) (io.ReadCloser, error)
+}
+
+// PageStorage is implemented by storages that list objects page by page in the lexical order of their keys,
+// so listings can continue after the last listed key and large prefixes can be split by their subdirectories.
+type PageStorage interface {
+	// ListPage returns up to limit objects below the prefix whose keys sort after startAfter,
+	// and whether further objects follow
+	ListPage(ctx context.Context, prefix, startAfter string, limit int) ([]ObjectInfo, bool, error)
+	// ListLevel returns the objects directly below the prefix and the common prefixes of all deeper objects,
+	// which end with "/"
+	ListLevel(ctx context.Context, prefix string) ([]ObjectInfo, []string, error)
+}
+
+// SelectStorage is implemented by storages that can filter the content of structured objects
+// server-side, so only the records matching the SQL expression are transferred.
+type SelectStorage interface {
+	Select(ctx context.Context, key string, opts SelectOptions) (io.ReadCloser, error)
+}
+
+// Input formats of objects queried with Select
+const (
+	SelectFormatCSV     = "csv"
+	SelectFormatJSON    = "json"
+	SelectFormatParquet = "parquet"
+)
+
+// SelectOptions configures a single server-side query
+type SelectOptions struct {
+	// Expression is the SQL expression, e.g. "SELECT * FROM s3object s WHERE s.id = '1'"
+	Expression string
+	// Format of the object (csv, json or parquet)
+	Format string
+	// Compression of the object (none, gzip or bzip2)
+	Compression string
+	// CSVHeader describes the first line of CSV objects (use, ignore or none)
+	CSVHeader string
+	// CSVDelimiter separates the fields of CSV objects ("," if empty)
+	CSVDelimiter string
+	// JSONLines reads JSON objects as one document per line instead of a single document
+	JSONLines bool
+	// Output format of the returned records (csv or json), same as the input if empty
+	Output string
+}
+
+// PutOptions configures a single upload
+type PutOptions struct {
+	ContentType string
+	// PartSize of multipart uploads, chosen by the storage client if 0
+	PartSize int64
+	// IfMatch only writes the object if its current ETag matches
+	IfMatch string
+	// IfNoneMatch only writes the object if it doesn't exist yet
+	IfNoneMatch bool
+	// Resume keeps interrupted delta uploads and continues the last interrupted upload of the key
+	Resume bool
+	// RetainUntil locks the written object version against deletion and overwrites until the time passes,
+	// which requires object lock to be enabled for the bucket
+	RetainUntil time.Time
+	// Compliance locks the version in compliance mode, which can't be lifted before RetainUntil even by administrators
+	Compliance bool
+	// Sparse recreates the holes of a sparse file instead of writing its zeros, only supported by local storages
+	Sparse *SparseMap
+	// ModifiedAt sets the access and modification time of the written file, only supported by local storages
+	ModifiedAt time.Time
+}
+
+// DeleteError describes the failed deletion of a single object within a batch
+type DeleteError struct {
+	Key string
+	Err error
+}
+
+func (e DeleteError) Error() string {
+	return fmt.Sprintf("failed to delete '%s': %v", e.Key, e.Err)
+}
+
+// New creates the storage implementation for the provided backend
+func New(backend *models.Backend) (Storage, error) {
+	if backend == nil {
+		return nil, fmt.Errorf("backend is required")
+	}
+
+	switch backend.Type {
+	case TypeS3, "":
+		return NewS3Storage(backend)
+	case TypeAzure:
+		return NewAzureStorage(backend)
+	case TypeGCS:
+		return NewGCSStorage(backend)
+	case TypeLocal:
+		return NewLocalStorage(backend)
+	default:
+		return nil, fmt.Errorf("unsupported backend type: %s", backend.Type)
+	}
+}
+
+// Close releases the resources of storages holding a client, like GCS, and does nothing for all other storages
+func Close(st Storage) error {
+	if closer, ok := st.(io.Closer); ok {
+		return closer.Close()
+	}
+	return nil
+}
+
+// OpenRange reads length bytes of the object starting at offset. Storages without range reads read the object from
+// its start, which can't detect whether the object was replaced by a version of the same size.
+func OpenRange(ctx context.Context, st Storage, object ObjectInfo, offset, length int64) (io.ReadCloser, error) {
+	if ranger, ok := st.(RangeStorage); ok {
+		reader, err := ranger.GetRange(ctx, object.Key, offset, length, object.ETag)
+		if !errors.Is(err, ErrNotSupported) {
+			return reader, err
+		}
+	}
+
+	reader, err := st.Get(ctx, object.Key)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := io.CopyN(io.Discard, reader, offset); err != nil {
+		reader.Close()
+		return nil, err
+	}
+	return &rangeReader{Reader: io.LimitReader(reader, length), closer: reader}, nil
+}
+
+type rangeReader struct {
+	io.Reader
+	closer io.Closer
+}
+
+func (r *rangeReader) Close() error {
+	return r.closer.Close()
+}
@@ -0,0 +1,281 @@
+package storage
+
+import (
+	"context"
+	"io"
+	"sync"
+	"time"
+
+	"github.com/mwantia/gosync/pkg/db/models"
+)
+
+const (
+	// tunerAlpha is the weight of new samples in the moving averages
+	tunerAlpha = 0.2
+	// tunerMinSample is the minimum transfer size used to measure throughput
+	tunerMinSample = 1 << 20
+	// tunerOverhead is the targeted share of request latency within the duration of a single chunk
+	tunerOverhead = 0.1
+)
+
+// TuningStore persists learned tuning values (implemented by the metadata store)
+type TuningStore interface {
+	ListBackendTunings(ctx context.Context) ([]models.BackendTuning, error)
+	SaveBackendTuning(ctx context.Context, tuning *models.BackendTuning) error
+}
+
+// Tuner learns the throughput and latency of each backend from completed transfers and derives
+// the chunk size for multipart uploads and ranged downloads, so each request is dominated by
+// transferring data instead of request latency.
+type Tuner struct {
+	mutex   sync.Mutex
+	store   TuningStore
+	min     int64
+	max     int64
+	tunings map[string]*models.BackendTuning
+	dirty   map[string]bool
+}
+
+// NewTuner creates a tuner with the chunk size bounds and loads the persisted values
+func NewTuner(ctx context.Context, ts TuningStore, minChunkSize, maxChunkSize int64) (*Tuner, error) {
+	t := &Tuner{
+		store:   ts,
+		min:     minChunkSize,
+		max:     max(maxChunkSize, minChunkSize),
+		tunings: make(map[string]*models.BackendTuning),
+		dirty:   make(map[string]bool),
+	}
+
+	tunings, err := ts.ListBackendTunings(ctx)
+	if err != nil {
+		return nil, err
+	}
+	for i := range tunings {
+		t.tunings[tunings[i].BackendID] = &tunings[i]
+	}
+
+	return t, nil
+}
+
+// ChunkSize returns the learned chunk size of the backend, or the lower bound if nothing was learned yet
+func (t *Tuner) ChunkSize(backendID string) int64 {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	if tuning, ok := t.tunings[backendID]; ok && tuning.ChunkSize > 0 {
+		return min(max(tuning.ChunkSize, t.min), t.max)
+	}
+	return t.min
+}
+
+// Tuning returns a copy of the learned values of the backend
+func (t *Tuner) Tuning(backendID string) (models.BackendTuning, bool) {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	tuning, ok := t.tunings[backendID]
+	if !ok {
+		return models.BackendTuning{}, false
+	}
+	return *tuning, true
+}
+
+// Wrap returns a storage measuring all transfers of the backend and applying the learned chunk size
+func (t *Tuner) Wrap(backendID string, st Storage) Storage {
+	return &tunedStorage{
+		Storage:   st,
+		tuner:     t,
+		backendID: backendID,
+	}
+}
+
+func (t *Tuner) observeLatency(backendID string, latency time.Duration) {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	tuning := t.tuning(backendID)
+	tuning.Latency = average(tuning.Latency, latency.Seconds())
+	t.update(tuning)
+}
+
+func (t *Tuner) observeTransfer(backendID string, size int64, duration time.Duration) {
+	if size < tunerMinSample || duration <= 0 {
+		return
+	}
+
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	tuning := t.tuning(backendID)
+	tuning.Throughput = average(tuning.Throughput, float64(size)/duration.Seconds())
+	t.update(tuning)
+}
+
+func (t *Tuner) tuning(backendID string) *models.BackendTuning {
+	tuning, ok := t.tunings[backendID]
+	if !ok {
+		tuning = &models.BackendTuning{
+			BackendID: backendID,
+			ChunkSize: t.min,
+		}
+		t.tunings[backendID] = tuning
+	}
+	return tuning
+}
+
+// update derives the chunk size, so latency only accounts for tunerOverhead of each chunk request
+func (t *Tuner) update(tuning *models.BackendTuning) {
+	tuning.Samples++
+	tuning.UpdatedAt = time.Now().UTC()
+
+	if tuning.Throughput > 0 && tuning.Latency > 0 {
+		size := int64(tuning.Latency * tuning.Throughput * (1 - tunerOverhead) / tunerOverhead)
+		tuning.ChunkSize = min(max(size, t.min), t.max)
+	}
+
+	t.dirty[tuning.BackendID] = true
+}
+
+// Flush persists all changed tuning values
+func (t *Tuner) Flush(ctx context.Context) error {
+	t.mutex.Lock()
+	var pending []models.BackendTuning
+	for backendID := range t.dirty {
+		pending = append(pending, *t.tunings[backendID])
+	}
+	t.dirty = make(map[string]bool)
+	t.mutex.Unlock()
+
+	for i := range pending {
+		if err := t.store.SaveBackendTuning(ctx, &pending[i]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Run periodically flushes the tuner until the context is cancelled
+func (t *Tuner) Run(ctx context.Context, interval time.Duration) error {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			flush, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+			defer cancel()
+			return t.Flush(flush)
+		case <-ticker.C:
+			if err := t.Flush(ctx); err != nil {
+				return err
+			}
+		}
+	}
+}
+
+func average(current, sample float64) float64 {
+	if current == 0 {
+		return sample
+	}
+	return current*(1-tunerAlpha) + sample*tunerAlpha
+}
+
+// tunedStorage measures the operations of the wrapped storage for a tuner
+type tunedStorage struct {
+	Storage
+	tuner     *Tuner
+	backendID string
+}
+
+func (s *tunedStorage) Close() error {
+	return Close(s.Storage)
+}
+
+func (s *tunedStorage) Stat(ctx context.Context, key string) (*ObjectInfo, error) {
+	// Stat requests carry no payload, so their duration approximates the request latency
+	started := time.Now()
+	info, err := s.Storage.Stat(ctx, key)
+	if err == nil {
+		s.tuner.observeLatency(s.backendID, time.Since(started))
+	}
+	return info, err
+}
+
+func (s *tunedStorage) Get(ctx context.Context, key string) (io.ReadCloser, error) {
+	started := time.Now()
+	reader, err := s.Storage.Get(ctx, key)
+	if err != nil {
+		return nil, err
+	}
+	return &tunedReader{ReadCloser: reader, storage: s, started: started}, nil
+}
+
+func (s *tunedStorage) GetRange(ctx context.Context, key string, offset, length int64, etag string) (io.ReadCloser, error) {
+	ranger, ok := s.Storage.(RangeStorage)
+	if !ok {
+		return nil, ErrNotSupported
+	}
+
+	started := time.Now()
+	reader, err := ranger.GetRange(ctx, key, offset, length, etag)
+	if err != nil {
+		return nil, err
+	}
+	return &tunedReader{ReadCloser: reader, storage: s, started: started}, nil
+}
+
+func (s *tunedStorage) Put(ctx context.Context, key string, reader io.Reader, size int64, opts PutOptions) (*ObjectInfo, error) {
+	if opts.PartSize == 0 {
+		opts.PartSize = s.tuner.ChunkSize(s.backendID)
+	}
+
+	started := time.Now()
+	counter := &countingReader{Reader: reader}
+	info, err := s.Storage.Put(ctx, key, counter, size, opts)
+	if err == nil {
+		s.tuner.observeTransfer(s.backendID, counter.n, time.Since(started))
+	}
+	return info, err
+}
+
+func (s *tunedStorage) PutDelta(ctx context.Context, key string, src io.ReaderAt, size, blockSize int64, reuse []bool, opts PutOptions) (*ObjectInfo, error) {
+	delta, ok := s.Storage.(DeltaStorage)
+	if !ok {
+		return nil, ErrNotSupported
+	}
+	return delta.PutDelta(ctx, key, src, size, blockSize, reuse, opts)
+}
+
+func (s *tunedStorage) ListPage(ctx context.Context, prefix, startAfter string, limit int) ([]ObjectInfo, bool, error) {
+	pager, ok := s.Storage.(PageStorage)
+	if !ok {
+		return nil, false, ErrNotSupported
+	}
+	return pager.ListPage(ctx, prefix, startAfter, limit)
+}
+
+func (s *tunedStorage) ListLevel(ctx context.Context, prefix string) ([]ObjectInfo, []string, error) {
+	pager, ok := s.Storage.(PageStorage)
+	if !ok {
+		return nil, nil, ErrNotSupported
+	}
+	return pager.ListLevel(ctx, prefix)
+}
+
+type tunedReader struct {
+	io.ReadCloser
+	storage *tunedStorage
+	started time.Time
+	n       int64
+}
+
+func (r *tunedReader) Read(p []byte) (int, error) {
+	n, err := r.ReadCloser.Read(p)
+	r.n += int64(n)
+	return n, err
+}
+
+func (r *tunedReader) Close() error {
+	r.storage.tuner.observeTransfer(r.storage.backendID, r.n, time.Since(r.started))
+	return r.ReadCloser.Close()
+}
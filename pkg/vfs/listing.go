@@ -0,0 +1,73 @@
+package vfs
+
+import (
+	"sort"
+	"strings"
+	"time"
+)
+
+// Object is a single file within the virtual filesystem, identified by its full key
+type Object struct {
+	Key        string
+	Size       int64
+	ModifiedAt time.Time
+	LockedBy   string
+}
+
+// Entry represents a single file or directory within a virtual filesystem listing
+type Entry struct {
+	Name       string
+	IsDir      bool
+	Size       int64
+	ModifiedAt time.Time
+	// LockedBy is the owner of an active lock on the file, if any
+	LockedBy string
+}
+
+// Collapse groups the objects below the prefix into the direct children of the prefix.
+// Directories are aggregated with the total size and latest modification of their contents.
+func Collapse(prefix string, objects []Object) []Entry {
+	if prefix != "" && !strings.HasSuffix(prefix, "/") {
+		prefix += "/"
+	}
+
+	entries := make(map[string]*Entry)
+	for _, object := range objects {
+		if !strings.HasPrefix(object.Key, prefix) {
+			continue
+		}
+
+		name, rest, isDir := strings.Cut(strings.TrimPrefix(object.Key, prefix), "/")
+		if name == "" {
+			continue
+		}
+
+		entry, ok := entries[name]
+		if !ok {
+			entry = &Entry{
+				Name:  name,
+				IsDir: isDir && rest != "",
+			}
+			if !entry.IsDir {
+				entry.LockedBy = object.LockedBy
+			}
+			entries[name] = entry
+		}
+
+		entry.Size += object.Size
+		if object.ModifiedAt.After(entry.ModifiedAt) {
+			entry.ModifiedAt = object.ModifiedAt
+		}
+	}
+
+	result := make([]Entry, 0, len(entries))
+	for _, entry := range entries {
+		result = append(result, *entry)
+	}
+
+	sort.Slice(result, func(i, j int) bool {
+		return result[i].Name < result[j].Name
+	})
+
+	return result
+}
@@ -0,0 +1,37 @@
+package vfs
+
+import "strings"
+
+// Path represents a parsed virtual filesystem path in the form of backend/key
+type Path struct {
+	Backend string
+	Key     string
+}
+
+// ParsePath splits a virtual path into its backend and object key
+func ParsePath(path string) Path {
+	path = strings.Trim(path, "/")
+
+	backend, key, _ := strings.Cut(path, "/")
+	return Path{
+		Backend: backend,
+		Key:     key,
+	}
+}
+
+// IsRoot returns true if the path doesn't reference any backend
+func (p Path) IsRoot() bool {
+	return p.Backend == ""
+}
+
+// IsBackend returns true if the path references a backend without any key
+func (p Path) IsBackend() bool {
+	return p.Backend != "" && p.Key == ""
+}
+
+func (p Path) String() string {
+	if p.Key == "" {
+		return p.Backend
+	}
+	return p.Backend + "/" + p.Key
+}
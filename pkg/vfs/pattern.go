@@ -0,0 +1,182 @@
+package vfs
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// Pattern matches the keys of files within a backend by a glob or a regular expression. Patterns are translated into
+// a SQL LIKE pattern selecting a superset of the matching files, so the metadata store narrows them down before each
+// key is matched exactly.
+type Pattern struct {
+	source string
+	expr   *regexp.Regexp
+	like   string
+	base   string
+}
+
+// IsGlob returns true if the key contains any of the wildcards of glob patterns
+func IsGlob(key string) bool {
+	return strings.ContainsAny(key, "*?[")
+}
+
+// CompileGlob compiles a glob pattern. '*' matches any characters except '/', '**' matches across directories,
+// '?' matches a single character except '/' and '[...]' matches a class of characters, negated by '[!...]' or
+// '[^...]'. Wildcards are escaped by '\'.
+func CompileGlob(glob string) (*Pattern, error) {
+	glob = strings.Trim(glob, "/")
+
+	var expr, like, literal strings.Builder
+	expr.WriteString("^")
+	wildcard := false
+
+	for i := 0; i < len(glob); i++ {
+		c := glob[i]
+		wildcard = wildcard || strings.IndexByte("*?[", c) >= 0
+		// The base directory is the literal text preceding the first wildcard, without escapes
+		if !wildcard && c == '\\' && i+1 < len(glob) {
+			literal.WriteByte(glob[i+1])
+		} else if !wildcard {
+			literal.WriteByte(c)
+		}
+
+		switch c {
+		case '*':
+			if i+1 < len(glob) && glob[i+1] == '*' {
+				i++
+				// Directories matched by '**/' are optional, so 'a/**/b' matches 'a/b' as well
+				if i+1 < len(glob) && glob[i+1] == '/' && (i < 2 || glob[i-2] == '/') {
+					i++
+					expr.WriteString("(?:.*/)?")
+				} else {
+					expr.WriteString(".*")
+				}
+			} else {
+				expr.WriteString("[^/]*")
+			}
+			writeLikeAny(&like)
+		case '?':
+			expr.WriteString("[^/]")
+			like.WriteByte('_')
+		case '[':
+			end, class, err := globClass(glob, i)
+			if err != nil {
+				return nil, err
+			}
+			i = end
+			expr.WriteString(class)
+			like.WriteByte('_')
+		case '\\':
+			if i+1 == len(glob) {
+				return nil, fmt.Errorf("invalid pattern '%s': trailing escape", glob)
+			}
+			i++
+			expr.WriteString(regexp.QuoteMeta(glob[i : i+1]))
+			writeLikeLiteral(&like, glob[i:i+1])
+		default:
+			expr.WriteString(regexp.QuoteMeta(glob[i : i+1]))
+			writeLikeLiteral(&like, glob[i:i+1])
+		}
+	}
+	expr.WriteString("$")
+
+	compiled, err := regexp.Compile(expr.String())
+	if err != nil {
+		return nil, fmt.Errorf("invalid pattern '%s': %w", glob, err)
+	}
+
+	p := &Pattern{source: glob, expr: compiled, like: like.String()}
+	if prefix := literal.String(); strings.Contains(prefix, "/") {
+		p.base = prefix[:strings.LastIndex(prefix, "/")+1]
+	}
+	return p, nil
+}
+
+// CompileRegex compiles a regular expression, which has to match the whole key of files
+func CompileRegex(expr string) (*Pattern, error) {
+	compiled, err := regexp.Compile("^(?:" + expr + ")$")
+	if err != nil {
+		return nil, fmt.Errorf("invalid regular expression '%s': %w", expr, err)
+	}
+
+	// Only the literal prefix of the expression narrows down the files within the metadata store, which is only
+	// reported for the expression without anchors
+	prefix, _ := regexp.MustCompile("(?:" + expr + ")").LiteralPrefix()
+	var like strings.Builder
+	writeLikeLiteral(&like, prefix)
+	writeLikeAny(&like)
+
+	p := &Pattern{source: expr, expr: compiled, like: like.String()}
+	if i := strings.LastIndex(prefix, "/"); i >= 0 {
+		p.base = prefix[:i+1]
+	}
+	return p, nil
+}
+
+// Match returns true if the key of a file matches the pattern
+func (p *Pattern) Match(key string) bool {
+	return p.expr.MatchString(key)
+}
+
+// Like returns the SQL LIKE pattern selecting all keys matching the pattern, escaping '%', '_' and '\' by '\'
+func (p *Pattern) Like() string {
+	return p.like
+}
+
+// Base returns the directory preceding the first wildcard including its trailing '/', which all matching keys
+// start with, or "" if the pattern starts with a wildcard
+func (p *Pattern) Base() string {
+	return p.base
+}
+
+func (p *Pattern) String() string {
+	return p.source
+}
+
+// globClass translates the character class starting at index i of the glob into a regular expression and returns
+// the index of its closing bracket
+func globClass(glob string, i int) (int, string, error) {
+	var class strings.Builder
+	class.WriteString("[")
+
+	j := i + 1
+	if j < len(glob) && (glob[j] == '!' || glob[j] == '^') {
+		class.WriteString("^/")
+		j++
+	}
+	for start := j; j < len(glob); j++ {
+		c := glob[j]
+		switch {
+		case c == ']' && j > start:
+			class.WriteString("]")
+			return j, class.String(), nil
+		case c == '-' && j > start && j+1 < len(glob) && glob[j+1] != ']':
+			class.WriteByte('-')
+		case c == '\\' && j+1 < len(glob):
+			j++
+			class.WriteString(regexp.QuoteMeta(glob[j : j+1]))
+		default:
+			class.WriteString(regexp.QuoteMeta(glob[j : j+1]))
+		}
+	}
+	return 0, "", fmt.Errorf("invalid pattern '%s': unterminated character class", glob)
+}
+
+func writeLikeLiteral(like *strings.Builder, s string) {
+	for i := 0; i < len(s); i++ {
+		if c := s[i]; c == '%' || c == '_' || c == '\\' {
+			like.WriteByte('\\')
+		}
+		like.WriteByte(s[i])
+	}
+}
+
+// writeLikeAny appends a wildcard matching any characters, unless the pattern already ends with one
+func writeLikeAny(like *strings.Builder) {
+	s := like.String()
+	if strings.HasSuffix(s, "%") && !strings.HasSuffix(s, "\\%") {
+		return
+	}
+	like.WriteByte('%')
+}
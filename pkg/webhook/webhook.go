@@ -0,0 +1,310 @@
+package webhook
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"slices"
+	"sync"
+	"text/template"
+	"time"
+
+	config "github.com/mwantia/gosync/internal/config/server"
+	"github.com/mwantia/gosync/pkg/log"
+)
+
+const (
+	// queueSize is the number of pending events before new events are dropped
+	queueSize = 256
+	// defaultTimeout is used for webhooks without a configured timeout
+	defaultTimeout = 10 * time.Second
+	// defaultMaxRetries is used for webhooks without a configured number of retries
+	defaultMaxRetries = 3
+	// maxBackoff limits the delay between two delivery attempts
+	maxBackoff = 5 * time.Minute
+)
+
+// SignatureHeader contains the HMAC-SHA256 signature of the body as "sha256=<hex>"
+const SignatureHeader = "X-GoSync-Signature"
+
+// EventType defines the lifecycle events sent to webhooks
+type EventType string
+
+const (
+	EventSyncStarted  EventType = "sync.started"
+	EventSyncFinished EventType = "sync.finished"
+	EventSyncFailed   EventType = "sync.failed"
+	EventConflict     EventType = "sync.conflict"
+	// EventAnomaly is sent once a sync is paused, since its pass looked like an accidental mass change
+	EventAnomaly EventType = "sync.anomaly"
+	// EventDigest summarizes the activity of all syncs over the last day or week
+	EventDigest EventType = "sync.digest"
+	// EventQuota is sent once the usage of a backend reaches its soft or hard quota
+	EventQuota EventType = "backend.quota"
+)
+
+// Event is sent to all webhooks subscribed to its type
+type Event struct {
+	Type     EventType `json:"type"`
+	Time     time.Time `json:"time"`
+	ClientID string    `json:"client_id"`
+	Sync     string    `json:"sync"`
+	// Path of the conflicting file for conflict events
+	Path   string  `json:"path,omitempty"`
+	Error  string  `json:"error,omitempty"`
+	Result *Result `json:"result,omitempty"`
+	Digest *Digest `json:"digest,omitempty"`
+	Quota  *Quota  `json:"quota,omitempty"`
+}
+
+// Result summarizes a finished or failed sync pass
+type Result struct {
+	StartedAt  time.Time `json:"started_at"`
+	FinishedAt time.Time `json:"finished_at"`
+	Uploaded   int       `json:"uploaded"`
+	Downloaded int       `json:"downloaded"`
+	Deleted    int       `json:"deleted"`
+	Deferred   int       `json:"deferred"`
+	Conflicts  int       `json:"conflicts"`
+	Failed     int       `json:"failed"`
+	Bytes      int64     `json:"bytes"`
+}
+
+// Quota describes the quota of a backend its usage reached
+type Quota struct {
+	Backend string `json:"backend"`
+	// Level is either "soft" or "hard", uploads to the backend are held back once it reached its hard quota
+	Level string `json:"level"`
+	Bytes int64  `json:"bytes"`
+	Quota int64  `json:"quota"`
+}
+
+// Digest summarizes the activity of all syncs between both days (inclusive)
+type Digest struct {
+	// Period of the digest, either "daily" or "weekly"
+	Period string       `json:"period"`
+	From   string       `json:"from"`
+	To     string       `json:"to"`
+	Syncs  []DigestSync `json:"syncs"`
+}
+
+// DigestSync summarizes the activity of a single sync within a digest
+type DigestSync struct {
+	Sync      string `json:"sync"`
+	Passes    int64  `json:"passes"`
+	Added     int64  `json:"added"`
+	Changed   int64  `json:"changed"`
+	Deleted   int64  `json:"deleted"`
+	Conflicts int64  `json:"conflicts"`
+	Errors    int64  `json:"errors"`
+	Bytes     int64  `json:"bytes"`
+}
+
+type hook struct {
+	url        string
+	events     []string
+	secret     string
+	headers    map[string]string
+	template   *template.Template
+	timeout    time.Duration
+	maxRetries int
+}
+
+type delivery struct {
+	hook  *hook
+	event Event
+}
+
+// Dispatcher delivers events to the configured webhooks in the background,
+// so a slow or unreachable endpoint never delays a sync pass.
+type Dispatcher struct {
+	wait   sync.WaitGroup
+	hooks  []*hook
+	client *http.Client
+	queue  chan delivery
+	log    log.LoggerService
+}
+
+// NewDispatcher creates a dispatcher for the configured webhooks
+func NewDispatcher(cfgs []config.WebhookServerConfig, logger log.LoggerService) (*Dispatcher, error) {
+	d := &Dispatcher{
+		client: &http.Client{},
+		queue:  make(chan delivery, queueSize),
+		log:    logger,
+	}
+
+	for i, cfg := range cfgs {
+		if cfg.URL == "" {
+			return nil, fmt.Errorf("webhook %d has no url", i)
+		}
+
+		h := &hook{
+			url:        cfg.URL,
+			events:     cfg.Events,
+			secret:     cfg.Secret,
+			headers:    cfg.Headers,
+			timeout:    defaultTimeout,
+			maxRetries: defaultMaxRetries,
+		}
+
+		if cfg.Timeout != "" {
+			timeout, err := time.ParseDuration(cfg.Timeout)
+			if err != nil {
+				return nil, fmt.Errorf("invalid timeout of webhook '%s': %w", cfg.URL, err)
+			}
+			h.timeout = timeout
+		}
+		if cfg.MaxRetries > 0 {
+			h.maxRetries = cfg.MaxRetries
+		}
+
+		if cfg.Template != "" {
+			tmpl, err := template.New(cfg.URL).Funcs(template.FuncMap{
+				"json": toJSON,
+			}).Parse(cfg.Template)
+			if err != nil {
+				return nil, fmt.Errorf("invalid template of webhook '%s': %w", cfg.URL, err)
+			}
+			h.template = tmpl
+		}
+
+		d.hooks = append(d.hooks, h)
+	}
+
+	return d, nil
+}
+
+// Notify queues the event for all subscribed webhooks without blocking.
+// Events are dropped if the queue is full.
+func (d *Dispatcher) Notify(event Event) {
+	if event.Time.IsZero() {
+		event.Time = time.Now().UTC()
+	}
+
+	for _, h := range d.hooks {
+		if len(h.events) > 0 && !slices.Contains(h.events, string(event.Type)) {
+			continue
+		}
+
+		select {
+		case d.queue <- delivery{hook: h, event: event}:
+		default:
+			d.log.Warn("Dropping event '%s' for webhook '%s': queue is full", event.Type, h.url)
+		}
+	}
+}
+
+// Run delivers queued events until the context is cancelled and all pending deliveries have finished
+func (d *Dispatcher) Run(ctx context.Context) error {
+	defer d.wait.Wait()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case next := <-d.queue:
+			d.wait.Add(1)
+			go func() {
+				defer d.wait.Done()
+				d.deliver(ctx, next)
+			}()
+		}
+	}
+}
+
+// deliver sends the event and retries failed deliveries with exponential backoff
+func (d *Dispatcher) deliver(ctx context.Context, next delivery) {
+	body, err := next.hook.render(next.event)
+	if err != nil {
+		d.log.Error("Failed to render event '%s' for webhook '%s': %v", next.event.Type, next.hook.url, err)
+		return
+	}
+
+	backoff := time.Second
+	for attempt := 0; ; attempt++ {
+		retry, err := d.send(ctx, next.hook, next.event.Type, body)
+		if err == nil {
+			d.log.Debug("Delivered event '%s' to webhook '%s'", next.event.Type, next.hook.url)
+			return
+		}
+		if !retry || attempt >= next.hook.maxRetries {
+			d.log.Error("Failed to deliver event '%s' to webhook '%s': %v", next.event.Type, next.hook.url, err)
+			return
+		}
+
+		d.log.Warn("Failed to deliver event '%s' to webhook '%s', retrying in %s: %v", next.event.Type, next.hook.url, backoff, err)
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(backoff):
+		}
+		backoff = min(backoff*2, maxBackoff)
+	}
+}
+
+// send performs a single delivery attempt and reports whether a failed attempt should be retried
+func (d *Dispatcher) send(ctx context.Context, h *hook, eventType EventType, body []byte) (bool, error) {
+	ctx, cancel := context.WithTimeout(ctx, h.timeout)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, h.url, bytes.NewReader(body))
+	if err != nil {
+		return false, err
+	}
+
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("X-GoSync-Event", string(eventType))
+	for key, value := range h.headers {
+		req.Header.Set(key, value)
+	}
+	if h.secret != "" {
+		req.Header.Set(SignatureHeader, Sign(h.secret, body))
+	}
+
+	resp, err := d.client.Do(req)
+	if err != nil {
+		return true, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode >= 300 {
+		// Client errors won't succeed on retry, except for rate limiting
+		retry := resp.StatusCode >= 500 || resp.StatusCode == http.StatusTooManyRequests
+		return retry, fmt.Errorf("unexpected status %s", resp.Status)
+	}
+	return false, nil
+}
+
+// render returns the body of the event, rendered with the template of the webhook if configured
+func (h *hook) render(event Event) ([]byte, error) {
+	if h.template == nil {
+		return json.Marshal(event)
+	}
+
+	var buf bytes.Buffer
+	if err := h.template.Execute(&buf, event); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// Sign returns the signature of the body for the SignatureHeader
+func Sign(secret string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+// toJSON encodes values within templates, so strings are quoted and escaped properly
+func toJSON(v any) (string, error) {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return "", err
+	}
+	return string(data), nil
+}